@@ -0,0 +1,352 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/allegro/akubra/audit/config"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	// hashSuffixLength is length of `,"hash":"<sha256 hex>"}` record ending
+	hashSuffixLength = len(`,"hash":""}`) + 2*sha256.Size
+	// tailChunkSize is size of chunks file is read in backwards looking for
+	// last record
+	tailChunkSize = 4096
+)
+
+// BackendResult is outcome of request on single backend
+type BackendResult struct {
+	Backend string `json:"backend"`
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Record describes mutating request. Records are chained, Hash is SHA-256
+// (HMAC-SHA256 if log has key) of record encoded without Hash, which includes
+// Hash of previous record as PrevHash, so modification or removal of any
+// record but the last breaks the chain. Violation describes rule request was
+// rejected for, without being sent to backends. Gap is size of incomplete
+// record, left by interrupted write, truncated before record was written
+type Record struct {
+	Seq       uint64          `json:"seq"`
+	Time      string          `json:"ts"`
+	ReqID     string          `json:"reqID"`
+	Method    string          `json:"method"`
+	Bucket    string          `json:"bucket"`
+	Key       string          `json:"key,omitempty"`
+	AccessKey string          `json:"access_key,omitempty"`
+	Size      int64           `json:"size"`
+	Results   []BackendResult `json:"results"`
+	Violation string          `json:"violation,omitempty"`
+	Gap       int64           `json:"gap,omitempty"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash,omitempty"`
+}
+
+// NewRecord creates Record of request, Results are to be filled by caller
+func NewRecord(req *http.Request, reqID, accessKey string) Record {
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	return Record{
+		Time:      time.Now().Format(time.RFC3339Nano),
+		ReqID:     reqID,
+		Method:    req.Method,
+		Bucket:    bucket,
+		Key:       key,
+		AccessKey: accessKey,
+		Size:      req.ContentLength,
+	}
+}
+
+// IsMutation reports if request method may modify stored data
+func IsMutation(req *http.Request) bool {
+	return req.Method == http.MethodPut || req.Method == http.MethodDelete || req.Method == http.MethodPost
+}
+
+// Log appends records to file. File is locked while record is written, so
+// processes sharing it during binary upgrade keep single chain, which is
+// continued from last record of file
+type Log struct {
+	mx   sync.Mutex
+	file *os.File
+	sync bool
+	key  []byte
+	// seq, prev and size describe file after last write of this process
+	seq  uint64
+	prev string
+	size int64
+	// gap is size of incomplete records truncated since last write
+	gap int64
+}
+
+// New opens audit log, it returns nil if no Path is configured
+func New(conf config.Audit) (*Log, error) {
+	if conf.Path == "" {
+		return nil, nil
+	}
+	key, err := LoadKey(conf)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(conf.Path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return nil, err
+	}
+	auditLog := &Log{file: file, sync: conf.Sync, key: key, size: -1}
+	if err = auditLog.recover(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("audit log %s can't be continued: %s", conf.Path, err)
+	}
+	return auditLog, nil
+}
+
+// LoadKey reads key of audit log, nil is returned if no KeyFile is configured
+func LoadKey(conf config.Audit) ([]byte, error) {
+	if conf.KeyFile == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read audit log key: %s", err)
+	}
+	key := bytes.TrimSpace(content)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit log key file %s is empty", conf.KeyFile)
+	}
+	return key, nil
+}
+
+// recover truncates incomplete last record of file left by interrupted
+// write, so chain may be continued
+func (l *Log) recover() error {
+	unlock, err := lockFile(l.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	_, _, err = l.lastValidRecord(info.Size())
+	return err
+}
+
+// Write chains and appends record, failures are logged
+func (l *Log) Write(record Record) {
+	if l == nil {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if err := l.append(record); err != nil {
+		metrics.Mark("audit.errors")
+		log.Printf("Audit record of request %s not written: %s", record.ReqID, err)
+		return
+	}
+	metrics.Mark("audit.records")
+}
+
+func (l *Log) append(record Record) error {
+	unlock, err := lockFile(l.file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size != l.size {
+		last, validSize, err := l.lastValidRecord(size)
+		if err != nil {
+			return err
+		}
+		l.seq, l.prev, size = last.Seq, last.Hash, validSize
+	}
+	record.Seq = l.seq + 1
+	record.PrevHash = l.prev
+	record.Gap = l.gap
+	record.Hash = ""
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	record.Hash = digest(l.key, line)
+	line = append(line[:len(line)-1], `,"hash":"`...)
+	line = append(line, record.Hash...)
+	line = append(line, "\"}\n"...)
+	n, err := l.file.Write(line)
+	if err != nil {
+		l.size = -1
+		if n > 0 {
+			// Partially written record would break the chain
+			if truncateErr := l.file.Truncate(size); truncateErr != nil {
+				log.Printf("Cannot truncate partially written audit record: %s", truncateErr)
+			}
+		}
+		return err
+	}
+	l.seq, l.prev, l.size, l.gap = record.Seq, record.Hash, size+int64(n), 0
+	if l.sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+// lastValidRecord reads last record of file of given size, incomplete line
+// following it is truncated and counted as gap. Size of valid records is
+// returned
+func (l *Log) lastValidRecord(size int64) (Record, int64, error) {
+	validSize, err := lastLineEnd(l.file, size)
+	if err != nil {
+		return Record{}, 0, err
+	}
+	if validSize < size {
+		if err = l.file.Truncate(validSize); err != nil {
+			return Record{}, 0, err
+		}
+		metrics.Mark("audit.truncated")
+		log.Printf("Incomplete last audit record truncated (%d bytes)", size-validSize)
+		l.gap += size - validSize
+	}
+	last, err := lastRecord(l.file, validSize, l.key)
+	return last, validSize, err
+}
+
+// lockFile locks file exclusively, returned function unlocks it
+func lockFile(file *os.File) (func(), error) {
+	fd := int(file.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := syscall.Flock(fd, syscall.LOCK_UN); err != nil {
+			log.Printf("Cannot unlock audit log: %s", err)
+		}
+	}, nil
+}
+
+// Close closes audit log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.file.Close()
+}
+
+// lastLineEnd returns offset following last line break of file of given
+// size, 0 if there is none
+func lastLineEnd(file io.ReaderAt, size int64) (int64, error) {
+	for offset := size; offset > 0; {
+		chunk := int64(tailChunkSize)
+		if chunk > offset {
+			chunk = offset
+		}
+		offset -= chunk
+		buf := make([]byte, chunk)
+		if _, err := file.ReadAt(buf, offset); err != nil {
+			return 0, err
+		}
+		if end := bytes.LastIndexByte(buf, '\n'); end >= 0 {
+			return offset + int64(end) + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// lastRecord reads last record of file of given size, empty Record is
+// returned for empty file
+func lastRecord(file io.ReaderAt, size int64, key []byte) (Record, error) {
+	if size == 0 {
+		return Record{}, nil
+	}
+	tail := make([]byte, 0)
+	for offset := size; offset > 0; {
+		chunk := int64(tailChunkSize)
+		if chunk > offset {
+			chunk = offset
+		}
+		offset -= chunk
+		buf := make([]byte, chunk)
+		if _, err := file.ReadAt(buf, offset); err != nil {
+			return Record{}, err
+		}
+		tail = append(buf, tail...)
+		if start := bytes.LastIndexByte(tail[:len(tail)-1], '\n'); start >= 0 {
+			tail = tail[start+1:]
+			break
+		}
+	}
+	if tail[len(tail)-1] != '\n' {
+		return Record{}, errors.New("last record is incomplete")
+	}
+	return parseRecord(tail[:len(tail)-1], key)
+}
+
+// digest returns hex encoded SHA-256 of content, HMAC-SHA256 if key is set
+func digest(key, content []byte) string {
+	if key == nil {
+		sum := sha256.Sum256(content)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseRecord decodes line and checks its hash
+func parseRecord(line, key []byte) (Record, error) {
+	record := Record{}
+	if len(line) < hashSuffixLength || !bytes.HasPrefix(line[len(line)-hashSuffixLength:], []byte(`,"hash":"`)) {
+		return record, errors.New("record has no hash")
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, err
+	}
+	content := append([]byte{}, line[:len(line)-hashSuffixLength]...)
+	if !hmac.Equal([]byte(digest(key, append(content, '}'))), []byte(record.Hash)) {
+		return record, errors.New("record hash mismatch")
+	}
+	return record, nil
+}
+
+// Verify checks chain of records read from reader, chained with key if it's
+// set. It returns number of valid records read before first problem found
+func Verify(reader io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	verified := 0
+	var previous *Record
+	for scanner.Scan() {
+		record, err := parseRecord(scanner.Bytes(), key)
+		if err != nil {
+			return verified, fmt.Errorf("line %d: %s", verified+1, err)
+		}
+		if previous != nil && (record.Seq != previous.Seq+1 || record.PrevHash != previous.Hash) {
+			return verified, fmt.Errorf("line %d: chain broken after record %d", verified+1, previous.Seq)
+		}
+		previous = &record
+		verified++
+	}
+	return verified, scanner.Err()
+}
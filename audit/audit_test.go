@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/audit/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLog(t *testing.T) (*Log, string, func()) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := New(config.Audit{Path: path})
+	require.NoError(t, err)
+	return auditLog, path, func() {
+		_ = auditLog.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestNewShouldReturnNilWithoutPath(t *testing.T) {
+	auditLog, err := New(config.Audit{})
+
+	require.NoError(t, err)
+	assert.Nil(t, auditLog)
+	auditLog.Write(Record{})
+}
+
+func TestNewRecordShouldDescribeRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/dir/key", strings.NewReader("data"))
+
+	record := NewRecord(req, "req-1", "access")
+
+	assert.Equal(t, "PUT", record.Method)
+	assert.Equal(t, "bucket", record.Bucket)
+	assert.Equal(t, "dir/key", record.Key)
+	assert.Equal(t, "access", record.AccessKey)
+	assert.Equal(t, "req-1", record.ReqID)
+	assert.Equal(t, int64(4), record.Size)
+}
+
+func TestWrittenRecordsShouldBeChained(t *testing.T) {
+	auditLog, path, cleanup := newTestLog(t)
+	defer cleanup()
+
+	auditLog.Write(Record{ReqID: "1", Method: "PUT", Results: []BackendResult{{Backend: "first", Status: 200}}})
+	auditLog.Write(Record{ReqID: "2", Method: "DELETE", Results: []BackendResult{{Backend: "first", Error: "timeout"}}})
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	verified, err := Verify(bytes.NewReader(content), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, verified)
+	last, err := lastRecord(bytes.NewReader(content), int64(len(content)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), last.Seq)
+	assert.Equal(t, "2", last.ReqID)
+}
+
+func TestLogShouldContinueChainOfExistingFile(t *testing.T) {
+	auditLog, path, cleanup := newTestLog(t)
+	defer cleanup()
+	auditLog.Write(Record{ReqID: "1"})
+
+	reopened, err := New(config.Audit{Path: path})
+	require.NoError(t, err)
+	defer func() {
+		_ = reopened.Close()
+	}()
+	reopened.Write(Record{ReqID: "2"})
+	auditLog.Write(Record{ReqID: "3"})
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+	verified, err := Verify(file, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, verified)
+}
+
+func TestVerifyShouldDetectModifiedAndRemovedRecords(t *testing.T) {
+	auditLog, path, cleanup := newTestLog(t)
+	defer cleanup()
+	for _, reqID := range []string{"1", "2", "3"} {
+		auditLog.Write(Record{ReqID: reqID, Bucket: "bucket"})
+	}
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(content), "\n")
+
+	modified := strings.Replace(string(content), `"reqID":"2","method":"","bucket":"bucket"`, `"reqID":"2","method":"","bucket":"other"`, 1)
+	verified, err := Verify(strings.NewReader(modified), nil)
+	assert.Equal(t, 1, verified)
+	assert.EqualError(t, err, "line 2: record hash mismatch")
+
+	verified, err = Verify(strings.NewReader(lines[0]+lines[2]), nil)
+	assert.Equal(t, 1, verified)
+	assert.EqualError(t, err, "line 2: chain broken after record 1")
+}
+
+func TestLogShouldTruncateIncompleteLastRecord(t *testing.T) {
+	auditLog, path, cleanup := newTestLog(t)
+	defer cleanup()
+	auditLog.Write(Record{ReqID: "1"})
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0640)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reopened, err := New(config.Audit{Path: path})
+	require.NoError(t, err)
+	defer func() {
+		_ = reopened.Close()
+	}()
+	reopened.Write(Record{ReqID: "2"})
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	verified, err := Verify(bytes.NewReader(content), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, verified)
+	last, err := lastRecord(bytes.NewReader(content), int64(len(content)), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2", last.ReqID)
+	assert.Equal(t, int64(len(`{"seq":2`)), last.Gap)
+}
+
+func TestLogShouldTruncateIncompleteRecordOfOtherProcess(t *testing.T) {
+	auditLog, path, cleanup := newTestLog(t)
+	defer cleanup()
+	auditLog.Write(Record{ReqID: "1"})
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0640)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	auditLog.Write(Record{ReqID: "2"})
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	verified, err := Verify(bytes.NewReader(content), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, verified)
+}
+
+func TestKeyedChainShouldNotBeRecomputedWithoutKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	keyFile := filepath.Join(dir, "audit.key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("secret\n"), 0600))
+	conf := config.Audit{Path: filepath.Join(dir, "audit.log"), KeyFile: keyFile}
+	auditLog, err := New(conf)
+	require.NoError(t, err)
+	auditLog.Write(Record{ReqID: "1"})
+	auditLog.Write(Record{ReqID: "2"})
+	require.NoError(t, auditLog.Close())
+	content, err := ioutil.ReadFile(conf.Path)
+	require.NoError(t, err)
+	key, err := LoadKey(conf)
+	require.NoError(t, err)
+
+	verified, err := Verify(bytes.NewReader(content), key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, verified)
+	_, err = Verify(bytes.NewReader(content), nil)
+	assert.EqualError(t, err, "line 1: record hash mismatch")
+	_, err = New(config.Audit{Path: conf.Path})
+	assert.Error(t, err)
+}
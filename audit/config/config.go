@@ -0,0 +1,14 @@
+package config
+
+// Audit configuration, mutating requests are not audited if Path is not
+// defined
+type Audit struct {
+	// Path of file records are appended to
+	Path string `yaml:"Path"`
+	// Sync flushes file to disk after each record
+	Sync bool `yaml:"Sync"`
+	// KeyFile holds secret key records are chained with (HMAC-SHA256),
+	// chain of records without key may be recomputed by anyone who can
+	// write the file
+	KeyFile string `yaml:"KeyFile"`
+}
@@ -3,6 +3,7 @@ package balancing
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"net/http"
 	"sort"
 	"sync"
@@ -17,13 +18,32 @@ import (
 // ResponseTimeBalancer proxies calls to balancing nodes
 type ResponseTimeBalancer struct {
 	Nodes []Node
+	// Weights are read preference weights of nodes. Active nodes with positive
+	// weight are elected randomly in proportion to it, others are elected by
+	// response time only if no weighted node is available
+	Weights   map[Node]int
+	randomInt func(int) int
 }
 
 // Elect elects node and calls it with args
 func (balancer *ResponseTimeBalancer) Elect(skipNodes ...Node) (Node, error) {
 	start := time.Now()
-	var elected Node
+	elected := balancer.electWeighted(skipNodes)
+	if elected == nil {
+		elected = balancer.electFastest(skipNodes)
+	}
+	if elected == nil {
+		return nil, ErrNoActiveNodes
+	}
+	// Disrupt node stats. If all nodes has zero weight only first would
+	// get all the load unless response will come
+	elected.UpdateTimeSpent(time.Since(start))
+	return elected, nil
+}
 
+// electFastest returns active node with the least time spent
+func (balancer *ResponseTimeBalancer) electFastest(skipNodes []Node) Node {
+	var elected Node
 	for _, node := range balancer.Nodes {
 		if !node.IsActive() || inSkipNodes(skipNodes, node) {
 			continue
@@ -38,13 +58,40 @@ func (balancer *ResponseTimeBalancer) Elect(skipNodes ...Node) (Node, error) {
 			elected = node
 		}
 	}
-	if elected == nil {
-		return nil, ErrNoActiveNodes
+	return elected
+}
+
+// electWeighted draws one of active weighted nodes, it returns nil if there
+// is none
+func (balancer *ResponseTimeBalancer) electWeighted(skipNodes []Node) Node {
+	if len(balancer.Weights) == 0 {
+		return nil
 	}
-	// Disrupt node stats. If all nodes has zero weight only first would
-	// get all the load unless response will come
-	elected.UpdateTimeSpent(time.Since(start))
-	return elected, nil
+	candidates := make([]Node, 0, len(balancer.Weights))
+	sum := 0
+	for _, node := range balancer.Nodes {
+		weight := balancer.Weights[node]
+		if weight <= 0 || !node.IsActive() || inSkipNodes(skipNodes, node) {
+			continue
+		}
+		candidates = append(candidates, node)
+		sum += weight
+	}
+	if sum == 0 {
+		return nil
+	}
+	randomInt := balancer.randomInt
+	if randomInt == nil {
+		randomInt = rand.Intn
+	}
+	draw := randomInt(sum)
+	for _, node := range candidates {
+		draw -= balancer.Weights[node]
+		if draw < 0 {
+			return node
+		}
+	}
+	return candidates[len(candidates)-1]
 }
 
 func inSkipNodes(skipNodes []Node, node Node) bool {
@@ -559,6 +606,7 @@ func NewBalancerPrioritySet(storagesConfig config.Storages, backends map[string]
 	priorities := make([]int, 0)
 	priotitiesFilter := make(map[int]struct{})
 	priorityStorage := make(map[int][]*MeasuredStorage)
+	priorityWeights := make(map[int]map[Node]int)
 	for _, storageConfig := range storagesConfig {
 		breaker := newBreaker(storageConfig.BreakerProbeSize,
 			storageConfig.BreakerCallTimeLimit.Duration,
@@ -584,6 +632,12 @@ func NewBalancerPrioritySet(storagesConfig config.Storages, backends map[string]
 
 		priorityStorage[storageConfig.Priority] = append(
 			priorityStorage[storageConfig.Priority], mstorage)
+		if storageConfig.Weight > 0 {
+			if _, ok := priorityWeights[storageConfig.Priority]; !ok {
+				priorityWeights[storageConfig.Priority] = make(map[Node]int)
+			}
+			priorityWeights[storageConfig.Priority][mstorage] = storageConfig.Weight
+		}
 	}
 	sort.Ints(priorities)
 	bps := &BalancerPrioritySet{balancers: []*ResponseTimeBalancer{}}
@@ -592,7 +646,7 @@ func NewBalancerPrioritySet(storagesConfig config.Storages, backends map[string]
 		for _, node := range priorityStorage[key] {
 			nodes = append(nodes, Node(node))
 		}
-		balancer := &ResponseTimeBalancer{Nodes: nodes}
+		balancer := &ResponseTimeBalancer{Nodes: nodes, Weights: priorityWeights[key]}
 		bps.balancers = append(bps.balancers, balancer)
 	}
 	return bps
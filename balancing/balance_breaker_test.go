@@ -63,6 +63,37 @@ func TestResponseTimeBalancingMemberElects(t *testing.T) {
 	require.Equal(t, nil, member)
 }
 
+func TestResponseTimeBalancerElectsByWeight(t *testing.T) {
+	preferred := &nodeMock{time: 10, active: true}
+	other := &nodeMock{time: 1, active: true}
+	unweighted := &nodeMock{time: 0, active: true}
+	draw := 0
+	balancer := &ResponseTimeBalancer{
+		Nodes:     []Node{preferred, other, unweighted},
+		Weights:   map[Node]int{preferred: 90, other: 10},
+		randomInt: func(n int) int { require.Equal(t, 100, n); return draw },
+	}
+
+	for draw = 0; draw < 90; draw += 10 {
+		member, err := balancer.Elect()
+		require.NoError(t, err)
+		require.Equal(t, preferred, member)
+	}
+	draw = 95
+	member, err := balancer.Elect()
+	require.NoError(t, err)
+	require.Equal(t, other, member)
+
+	balancer.randomInt = func(n int) int { require.Equal(t, 10, n); return 0 }
+	member, err = balancer.Elect(preferred)
+	require.NoError(t, err)
+	require.Equal(t, other, member)
+
+	member, err = balancer.Elect(preferred, other)
+	require.NoError(t, err)
+	require.Equal(t, unweighted, member)
+}
+
 type nodeMock struct {
 	err    error
 	calls  float64
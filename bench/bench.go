@@ -0,0 +1,279 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bnogas/minio-go/pkg/s3signer"
+)
+
+// Distributions of keys picked for requests
+const (
+	// Uniform picks all keys with the same probability
+	Uniform = "uniform"
+	// Zipf picks few keys often and most keys rarely, like hot objects
+	Zipf = "zipf"
+	// Sequential picks keys in order, starting over after the last one
+	Sequential = "sequential"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	zipfS         = 1.1
+	zipfV         = 1
+)
+
+// Config of generated load
+type Config struct {
+	// Endpoint of proxy e.g. http://localhost:8080
+	Endpoint string
+	Bucket   string
+	// Prefix of generated keys
+	Prefix string
+	// AccessKey and Secret sign requests with AWS V4 signature, requests
+	// are anonymous if empty
+	AccessKey string
+	Secret    string
+	Region    string
+	// Concurrency is number of requests sent at once
+	Concurrency int
+	// Duration of load, it ends earlier if Requests are sent
+	Duration time.Duration
+	// Requests limits number of sent requests if positive
+	Requests int64
+	// Keys is number of distinct keys
+	Keys int
+	// Distribution of keys, Uniform, Zipf or Sequential
+	Distribution string
+	// Sizes of PUT objects, one is picked at random for each request
+	Sizes []int64
+	// ReadRatio is part of GET requests, the rest are PUTs
+	ReadRatio float64
+	// Prefill puts all keys before load is measured, so GETs find objects
+	Prefill bool
+}
+
+// Validate checks Config is runnable
+func (c Config) Validate() error {
+	switch {
+	case c.Endpoint == "" || c.Bucket == "":
+		return errors.New("endpoint and bucket are required")
+	case c.Concurrency <= 0 || c.Keys <= 0:
+		return errors.New("concurrency and keys should be positive")
+	case c.Duration <= 0 && c.Requests <= 0:
+		return errors.New("duration or requests should be positive")
+	case c.ReadRatio < 0 || c.ReadRatio > 1:
+		return errors.New("read ratio should be in [0, 1] range")
+	case c.ReadRatio < 1 && len(c.Sizes) == 0:
+		return errors.New("sizes of objects are required for PUT requests")
+	}
+	for _, size := range c.Sizes {
+		if size < 0 {
+			return fmt.Errorf("size %d cannot be negative", size)
+		}
+	}
+	switch c.Distribution {
+	case Uniform, Zipf, Sequential:
+	default:
+		return fmt.Errorf("unknown distribution %q", c.Distribution)
+	}
+	return nil
+}
+
+// Bench sends PUT and GET requests to proxy
+type Bench struct {
+	conf   Config
+	client *http.Client
+	// payload is source of PUT bodies, it's as long as the largest size
+	payload []byte
+	// sequence is the last key picked by Sequential distribution
+	sequence int64
+	// issued counts requests against Requests limit
+	issued int64
+}
+
+// New creates Bench, client sends requests
+func New(conf Config, client *http.Client) (*Bench, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if conf.Region == "" {
+		conf.Region = defaultRegion
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	maxSize := int64(0)
+	for _, size := range conf.Sizes {
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	payload := make([]byte, maxSize)
+	_, _ = rand.New(rand.NewSource(time.Now().UnixNano())).Read(payload)
+	return &Bench{conf: conf, client: client, payload: payload}, nil
+}
+
+// Run prefills keys if configured and measures load
+func (b *Bench) Run(ctx context.Context) (*Report, error) {
+	if b.conf.Prefill {
+		if err := b.prefill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if b.conf.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.conf.Duration)
+		defer cancel()
+	}
+	results := make([][]result, b.conf.Concurrency)
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	for worker := 0; worker < b.conf.Concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			results[worker] = b.work(ctx, rand.New(rand.NewSource(time.Now().UnixNano()+int64(worker))))
+		}(worker)
+	}
+	wg.Wait()
+	return newReport(time.Since(start), results), nil
+}
+
+// work sends requests until context is done or Requests are sent
+func (b *Bench) work(ctx context.Context, random *rand.Rand) []result {
+	pick := b.keyPicker(random)
+	var results []result
+	for ctx.Err() == nil {
+		if b.conf.Requests > 0 && atomic.AddInt64(&b.issued, 1) > b.conf.Requests {
+			break
+		}
+		key := pick()
+		var res result
+		if random.Float64() < b.conf.ReadRatio {
+			res = b.get(ctx, key)
+		} else {
+			res = b.put(ctx, key, b.conf.Sizes[random.Intn(len(b.conf.Sizes))])
+		}
+		if res.err != nil && ctx.Err() != nil {
+			// request interrupted by end of benchmark
+			break
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// prefill puts each key once
+func (b *Bench) prefill(ctx context.Context) error {
+	keys := make(chan int)
+	errs := make(chan error, b.conf.Concurrency)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < b.conf.Concurrency; worker++ {
+		wg.Add(1)
+		go func(random *rand.Rand) {
+			defer wg.Done()
+			for key := range keys {
+				res := b.put(ctx, key, b.conf.Sizes[random.Intn(len(b.conf.Sizes))])
+				if res.err == nil && res.status >= http.StatusMultipleChoices {
+					res.err = fmt.Errorf("responded with status %d", res.status)
+				}
+				if res.err != nil {
+					errs <- fmt.Errorf("prefill of %s failed: %s", b.key(key), res.err)
+					return
+				}
+			}
+		}(rand.New(rand.NewSource(time.Now().UnixNano() + int64(worker))))
+	}
+	var err error
+	for key := 0; key < b.conf.Keys && err == nil; key++ {
+		select {
+		case keys <- key:
+		case err = <-errs:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	close(keys)
+	wg.Wait()
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	return err
+}
+
+// keyPicker returns function picking keys of configured distribution
+func (b *Bench) keyPicker(random *rand.Rand) func() int {
+	switch b.conf.Distribution {
+	case Zipf:
+		if b.conf.Keys == 1 {
+			return func() int { return 0 }
+		}
+		zipf := rand.NewZipf(random, zipfS, zipfV, uint64(b.conf.Keys-1))
+		return func() int { return int(zipf.Uint64()) }
+	case Sequential:
+		return func() int { return int((atomic.AddInt64(&b.sequence, 1) - 1) % int64(b.conf.Keys)) }
+	}
+	return func() int { return random.Intn(b.conf.Keys) }
+}
+
+func (b *Bench) key(key int) string {
+	return fmt.Sprintf("%s%08d", b.conf.Prefix, key)
+}
+
+func (b *Bench) put(ctx context.Context, key int, size int64) result {
+	req, err := http.NewRequest(http.MethodPut, b.url(key), bytes.NewReader(b.payload[:size]))
+	if err != nil {
+		return result{op: http.MethodPut, err: err}
+	}
+	res := b.do(ctx, req)
+	res.bytes = size
+	return res
+}
+
+func (b *Bench) get(ctx context.Context, key int) result {
+	req, err := http.NewRequest(http.MethodGet, b.url(key), nil)
+	if err != nil {
+		return result{op: http.MethodGet, err: err}
+	}
+	return b.do(ctx, req)
+}
+
+func (b *Bench) url(key int) string {
+	return fmt.Sprintf("%s/%s/%s", b.conf.Endpoint, b.conf.Bucket, b.key(key))
+}
+
+// do sends request, its latency includes reading whole response body
+func (b *Bench) do(ctx context.Context, req *http.Request) result {
+	req = req.WithContext(ctx)
+	if b.conf.AccessKey != "" {
+		req = s3signer.SignV4(*req, b.conf.AccessKey, b.conf.Secret, "", b.conf.Region)
+	}
+	res := result{op: req.Method}
+	start := time.Now()
+	resp, err := b.client.Do(req)
+	if err != nil {
+		res.latency = time.Since(start)
+		res.err = err
+		return res
+	}
+	read, err := io.Copy(ioutil.Discard, resp.Body)
+	if closeErr := resp.Body.Close(); err == nil {
+		err = closeErr
+	}
+	res.latency = time.Since(start)
+	res.status = resp.StatusCode
+	res.err = err
+	if req.Method == http.MethodGet {
+		res.bytes = read
+	}
+	return res
+}
@@ -0,0 +1,125 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objectServer stores objects in memory like S3 would
+type objectServer struct {
+	mx      sync.Mutex
+	objects map[string][]byte
+	signed  int
+}
+
+func (os *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	os.mx.Lock()
+	defer os.mx.Unlock()
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		os.signed++
+	}
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		os.objects[r.URL.Path] = body
+	case http.MethodGet:
+		object, ok := os.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(object)
+	}
+}
+
+func runBench(t *testing.T, conf Config) (*Report, *objectServer) {
+	server := &objectServer{objects: map[string][]byte{}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	conf.Endpoint = ts.URL
+	conf.Bucket = "bucket"
+	bench, err := New(conf, ts.Client())
+	require.NoError(t, err)
+
+	report, err := bench.Run(context.Background())
+
+	require.NoError(t, err)
+	return report, server
+}
+
+func TestBenchShouldSendConfiguredNumberOfRequests(t *testing.T) {
+	report, server := runBench(t, Config{Concurrency: 4, Requests: 100, Keys: 10, Distribution: Sequential,
+		Sizes: []int64{1024}, ReadRatio: 0.5, Prefill: true, AccessKey: "access", Secret: "secret"})
+
+	requests := 0
+	for _, op := range report.Operations {
+		requests += op.Requests
+		assert.Equal(t, 0, op.Errors)
+		assert.Equal(t, op.Requests, op.Statuses[http.StatusOK])
+		assert.Equal(t, int64(op.Requests*1024), op.Bytes)
+	}
+	assert.Equal(t, 100, requests)
+	assert.Len(t, server.objects, 10)
+	assert.Equal(t, 110, server.signed)
+}
+
+func TestBenchShouldRunForConfiguredDuration(t *testing.T) {
+	start := time.Now()
+	report, _ := runBench(t, Config{Concurrency: 2, Duration: 50 * time.Millisecond, Keys: 5, Distribution: Zipf,
+		Sizes: []int64{10}})
+
+	require.Len(t, report.Operations, 1)
+	assert.Equal(t, http.MethodPut, report.Operations[0].Method)
+	assert.True(t, report.Operations[0].Requests > 0)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestBenchShouldRejectInvalidConfig(t *testing.T) {
+	valid := Config{Endpoint: "http://localhost", Bucket: "bucket", Concurrency: 1, Requests: 1, Keys: 1,
+		Distribution: Uniform, Sizes: []int64{1}}
+	require.NoError(t, valid.Validate())
+	testCases := []func(*Config){
+		func(c *Config) { c.Bucket = "" },
+		func(c *Config) { c.Concurrency = 0 },
+		func(c *Config) { c.Requests = 0 },
+		func(c *Config) { c.ReadRatio = 1.5 },
+		func(c *Config) { c.Sizes = nil },
+		func(c *Config) { c.Distribution = "pareto" },
+	}
+	for i, modify := range testCases {
+		conf := valid
+		modify(&conf)
+		assert.Error(t, conf.Validate(), "case %d", i)
+	}
+}
+
+func TestReportShouldComputeLatencyPercentiles(t *testing.T) {
+	results := make([]result, 0, 1000)
+	for i := 1; i <= 1000; i++ {
+		results = append(results, result{op: http.MethodGet, latency: time.Duration(i) * time.Millisecond, status: http.StatusOK})
+	}
+	results = append(results, result{op: http.MethodPut, latency: time.Millisecond, status: http.StatusCreated})
+	report := newReport(time.Second, [][]result{results[:500], results[500:]})
+
+	require.Len(t, report.Operations, 2)
+	get := report.Operations[1]
+	assert.Equal(t, 500*time.Millisecond, get.Percentile(50))
+	assert.Equal(t, 990*time.Millisecond, get.Percentile(99))
+	assert.Equal(t, 999*time.Millisecond, get.Percentile(99.9))
+	assert.Equal(t, time.Second, get.Max())
+
+	out := &bytes.Buffer{}
+	require.NoError(t, report.Write(out))
+	assert.Contains(t, out.String(), "200:1000")
+	assert.Contains(t, out.String(), "201:1")
+}
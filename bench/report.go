@@ -0,0 +1,136 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Percentiles of latency reported for each operation
+var Percentiles = []float64{50, 90, 99, 99.9}
+
+// result of single request
+type result struct {
+	op      string
+	latency time.Duration
+	status  int
+	bytes   int64
+	err     error
+}
+
+// Operation sums up requests of single method
+type Operation struct {
+	Method   string
+	Requests int
+	// Errors counts requests failed without response
+	Errors int
+	// Statuses counts responses by status code
+	Statuses map[int]int
+	// Bytes sent by PUT or received by GET requests
+	Bytes int64
+	// latencies are sorted ascending
+	latencies []time.Duration
+}
+
+// Percentile of latency, nearest rank of sorted latencies
+func (o *Operation) Percentile(p float64) time.Duration {
+	if len(o.latencies) == 0 {
+		return 0
+	}
+	// epsilon keeps float error of e.g. 99.9 percent from skipping a rank
+	rank := int(math.Ceil(p/100*float64(len(o.latencies)) - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	return o.latencies[rank-1]
+}
+
+// Max latency
+func (o *Operation) Max() time.Duration {
+	return o.Percentile(100)
+}
+
+// Report of benchmark
+type Report struct {
+	Elapsed    time.Duration
+	Operations []*Operation
+}
+
+func newReport(elapsed time.Duration, results [][]result) *Report {
+	byMethod := map[string]*Operation{
+		http.MethodPut: {Method: http.MethodPut, Statuses: map[int]int{}},
+		http.MethodGet: {Method: http.MethodGet, Statuses: map[int]int{}},
+	}
+	for _, workerResults := range results {
+		for _, res := range workerResults {
+			op := byMethod[res.op]
+			op.Requests++
+			op.latencies = append(op.latencies, res.latency)
+			if res.err != nil {
+				op.Errors++
+				continue
+			}
+			op.Statuses[res.status]++
+			op.Bytes += res.bytes
+		}
+	}
+	report := &Report{Elapsed: elapsed}
+	for _, method := range []string{http.MethodPut, http.MethodGet} {
+		op := byMethod[method]
+		if op.Requests == 0 {
+			continue
+		}
+		sort.Slice(op.latencies, func(i, j int) bool { return op.latencies[i] < op.latencies[j] })
+		report.Operations = append(report.Operations, op)
+	}
+	return report
+}
+
+// Write prints report as table
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "op\trequests\terrors\treq/s\tMiB/s\t")
+	for _, p := range Percentiles {
+		fmt.Fprintf(tw, "p%g\t", p)
+	}
+	fmt.Fprintf(tw, "max\tstatuses\t\n")
+	seconds := r.Elapsed.Seconds()
+	for _, op := range r.Operations {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.2f\t", op.Method, op.Requests, op.Errors,
+			float64(op.Requests)/seconds, float64(op.Bytes)/seconds/(1<<20))
+		for _, p := range Percentiles {
+			fmt.Fprintf(tw, "%s\t", roundLatency(op.Percentile(p)))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t\n", roundLatency(op.Max()), statuses(op.Statuses))
+	}
+	fmt.Fprintf(tw, "elapsed %s\t\n", r.Elapsed.Round(time.Millisecond))
+	return tw.Flush()
+}
+
+func roundLatency(latency time.Duration) time.Duration {
+	return latency.Round(10 * time.Microsecond)
+}
+
+// statuses formats counts of status codes e.g. "200:95 404:5"
+func statuses(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	formatted := ""
+	for i, code := range codes {
+		if i > 0 {
+			formatted += " "
+		}
+		formatted += fmt.Sprintf("%d:%d", code, counts[code])
+	}
+	if formatted == "" {
+		return "-"
+	}
+	return formatted
+}
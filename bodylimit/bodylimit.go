@@ -0,0 +1,166 @@
+package bodylimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/allegro/akubra/bodylimit/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// ErrEntityTooLarge is returned by body reader when limit is exceeded
+var ErrEntityTooLarge = errors.New("request body exceeds size limit")
+
+// ErrIncompleteBody is returned by body reader when body is shorter than
+// declared Content-Length
+var ErrIncompleteBody = errors.New("request body is shorter than Content-Length")
+
+// ErrContentLengthMismatch is returned by body reader when body is longer
+// than declared Content-Length
+var ErrContentLengthMismatch = errors.New("request body is longer than Content-Length")
+
+// limitedBody counts read bytes, it fails once limit or declared length is
+// exceeded or source ends before declared length. Bytes over limit or
+// declared length are never returned
+type limitedBody struct {
+	source        io.ReadCloser
+	limit         int64
+	contentLength int64
+	read          int64
+	err           error
+	// mx guards err, which is checked when backends may still read body
+	mx sync.Mutex
+}
+
+// Read implements io.Reader interface
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	lb.mx.Lock()
+	defer lb.mx.Unlock()
+	if lb.err != nil {
+		return 0, lb.err
+	}
+	n, err := lb.source.Read(p)
+	switch {
+	case lb.limit > 0 && lb.read+int64(n) > lb.limit:
+		n, lb.err = int(lb.limit-lb.read), ErrEntityTooLarge
+	case lb.contentLength >= 0 && lb.read+int64(n) > lb.contentLength:
+		n, lb.err = int(lb.contentLength-lb.read), ErrContentLengthMismatch
+	case err == io.EOF && lb.contentLength >= 0 && lb.read+int64(n) < lb.contentLength:
+		lb.err = ErrIncompleteBody
+	}
+	lb.read += int64(n)
+	if lb.err != nil {
+		return n, lb.err
+	}
+	return n, err
+}
+
+// Close implements io.Closer interface
+func (lb *limitedBody) Close() error {
+	return lb.source.Close()
+}
+
+func (lb *limitedBody) failure() error {
+	lb.mx.Lock()
+	defer lb.mx.Unlock()
+	return lb.err
+}
+
+type bodyLimitRoundTripper struct {
+	roundTripper http.RoundTripper
+	perAccessKey *config.Limits
+	accessKeys   map[string]config.Limits
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (bl *bodyLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return bl.roundTripper.RoundTrip(req)
+	}
+	limit := bl.limit(req)
+	if limit > 0 && req.ContentLength > limit {
+		return reject(req, "declared")
+	}
+	body := &limitedBody{source: req.Body, limit: limit, contentLength: req.ContentLength}
+	limitedReq := *req
+	limitedReq.Body = body
+	resp, err := bl.roundTripper.RoundTrip(&limitedReq)
+	switch failure := body.failure(); failure {
+	case nil:
+		return resp, err
+	case ErrEntityTooLarge:
+		discard(resp)
+		return reject(req, "streamed")
+	default:
+		discard(resp)
+		reqID := req.Context().Value(log.ContextreqIDKey)
+		log.Printf("Request %s body doesn't match Content-Length %d: %s", reqID, req.ContentLength, failure)
+		metrics.Mark("bodylimit.content_length_mismatch")
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrIncompleteBody,
+			"You did not provide the number of bytes specified by the Content-Length HTTP header."), nil
+	}
+}
+
+// limit returns the lowest limit applying to request, zero if none
+func (bl *bodyLimitRoundTripper) limit(req *http.Request) int64 {
+	limits := bl.perAccessKey
+	if accessKeyLimits, ok := bl.accessKeys[utils.ExtractAccessKey(req)]; ok {
+		limits = &accessKeyLimits
+	}
+	if limits == nil {
+		return 0
+	}
+	limit := limits.MaxRequestBodySize.SizeInBytes
+	objectLimit := limits.MaxObjectSize.SizeInBytes
+	if isObjectUpload(req) && objectLimit > 0 && (limit == 0 || objectLimit < limit) {
+		limit = objectLimit
+	}
+	return limit
+}
+
+// isObjectUpload reports if request uploads whole object, multipart upload
+// parts aren't objects
+func isObjectUpload(req *http.Request) bool {
+	if req.Method != http.MethodPut || req.URL.Query().Get("uploadId") != "" {
+		return false
+	}
+	path := strings.Trim(req.URL.Path, "/")
+	return strings.Contains(path, "/")
+}
+
+func reject(req *http.Request, reason string) (*http.Response, error) {
+	metrics.Mark("bodylimit." + reason + ".rejected")
+	log.Debugf("Request %s rejected by body size limit", req.Context().Value(log.ContextreqIDKey))
+	return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrEntityTooLarge,
+		"Your proposed upload exceeds the maximum allowed size."), nil
+}
+
+func discard(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Cannot close response body: %s", err)
+	}
+}
+
+// Decorator creates httphandler.Decorator rejecting requests with bodies over
+// configured size with 400 EntityTooLarge. Bodies are checked against declared
+// Content-Length as well, so decorators and backends never get more or less
+// data than declared
+func Decorator(conf config.BodyLimits) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return &bodyLimitRoundTripper{
+			roundTripper: roundTripper,
+			perAccessKey: conf.PerAccessKey,
+			accessKeys:   conf.AccessKeys,
+		}
+	}
+}
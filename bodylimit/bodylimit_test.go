@@ -0,0 +1,118 @@
+package bodylimit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/bodylimit/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	calls int
+	read  int
+}
+
+// RoundTrip reads whole body like backends do
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rts.calls++
+	body, err := ioutil.ReadAll(req.Body)
+	rts.read += len(body)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func size(bytes int64) types.HumanSizeUnits {
+	return types.HumanSizeUnits{SizeInBytes: bytes}
+}
+
+func upload(url, accessKey string, body string, contentLength int64) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, url, ioutil.NopCloser(strings.NewReader(body)))
+	req.ContentLength = contentLength
+	if accessKey != "" {
+		req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	}
+	return req
+}
+
+func requireS3Error(t *testing.T, resp *http.Response, status int, code string) {
+	require.Equal(t, status, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	s3Error := types.S3Error{}
+	require.NoError(t, xml.Unmarshal(bytes.TrimPrefix(body, []byte(xml.Header)), &s3Error))
+	assert.Equal(t, code, s3Error.Code)
+}
+
+var limits = config.BodyLimits{
+	PerAccessKey: &config.Limits{MaxObjectSize: size(10), MaxRequestBodySize: size(20)},
+	AccessKeys:   map[string]config.Limits{"vip": {MaxObjectSize: size(100)}},
+}
+
+func TestShouldRejectDeclaredOversizedUploadsBeforeSendingBody(t *testing.T) {
+	stub := &roundTripperStub{}
+	rt := Decorator(limits)(stub)
+
+	resp, err := rt.RoundTrip(upload("http://akubra.local/bucket/key", "client", strings.Repeat("a", 11), 11))
+
+	require.NoError(t, err)
+	requireS3Error(t, resp, http.StatusBadRequest, types.S3ErrEntityTooLarge)
+	assert.Equal(t, 0, stub.calls)
+}
+
+func TestShouldRejectStreamedOversizedUploads(t *testing.T) {
+	stub := &roundTripperStub{}
+	rt := Decorator(limits)(stub)
+
+	resp, err := rt.RoundTrip(upload("http://akubra.local/bucket/key", "client", strings.Repeat("a", 11), -1))
+
+	require.NoError(t, err)
+	requireS3Error(t, resp, http.StatusBadRequest, types.S3ErrEntityTooLarge)
+}
+
+func TestShouldApplyLimitsOfAccessKeyAndRequestType(t *testing.T) {
+	for _, testCase := range []struct {
+		name, url, accessKey string
+		size                 int64
+		expectedStatus       int
+	}{
+		{"object within limit", "http://akubra.local/bucket/key", "client", 10, http.StatusOK},
+		{"part over object limit", "http://akubra.local/bucket/key?partNumber=1&uploadId=1", "client", 20, http.StatusOK},
+		{"part over body limit", "http://akubra.local/bucket/key?partNumber=1&uploadId=1", "client", 21, http.StatusBadRequest},
+		{"access key override", "http://akubra.local/bucket/key", "vip", 100, http.StatusOK},
+		{"access key override limit", "http://akubra.local/bucket/key", "vip", 101, http.StatusBadRequest},
+	} {
+		stub := &roundTripperStub{}
+		rt := Decorator(limits)(stub)
+
+		resp, err := rt.RoundTrip(upload(testCase.url, testCase.accessKey, strings.Repeat("a", int(testCase.size)), testCase.size))
+
+		require.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.expectedStatus, resp.StatusCode, testCase.name)
+	}
+}
+
+func TestShouldRejectBodiesNotMatchingContentLength(t *testing.T) {
+	for name, req := range map[string]*http.Request{
+		"shorter": upload("http://akubra.local/bucket/key", "", "abc", 5),
+		"longer":  upload("http://akubra.local/bucket/key", "", "abcdef", 5),
+	} {
+		stub := &roundTripperStub{}
+		rt := Decorator(config.BodyLimits{})(stub)
+
+		resp, err := rt.RoundTrip(req)
+
+		require.NoError(t, err, name)
+		requireS3Error(t, resp, http.StatusBadRequest, types.S3ErrIncompleteBody)
+		assert.True(t, stub.read <= 5, name)
+	}
+}
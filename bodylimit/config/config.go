@@ -0,0 +1,21 @@
+package config
+
+import "github.com/allegro/akubra/types"
+
+// Limits defines request body size limits, undefined limits are not applied
+type Limits struct {
+	// MaxObjectSize limits body of object uploads, parts of multipart
+	// uploads are limited by MaxRequestBodySize only
+	MaxObjectSize types.HumanSizeUnits `yaml:"MaxObjectSize"`
+	// MaxRequestBodySize limits body of any request
+	MaxRequestBodySize types.HumanSizeUnits `yaml:"MaxRequestBodySize"`
+}
+
+// BodyLimits configuration, oversized requests are rejected before their
+// bodies are spooled or sent to backends
+type BodyLimits struct {
+	// PerAccessKey is default limit for each access key
+	PerAccessKey *Limits `yaml:"PerAccessKey"`
+	// AccessKeys overrides PerAccessKey for given access keys
+	AccessKeys map[string]Limits `yaml:"AccessKeys"`
+}
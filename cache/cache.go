@@ -0,0 +1,354 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/cache/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+// responseCache keeps responses in memory tier, entries evicted from memory
+// are moved to disk tier if it's enabled
+type responseCache struct {
+	mx            sync.Mutex
+	memory        *tier
+	disk          *tier
+	diskPath      string
+	maxObjectSize int64
+	ttl           time.Duration
+	now           func() time.Time
+}
+
+func newResponseCache(conf config.Cache) *responseCache {
+	rc := &responseCache{
+		memory:        newTier(conf.MaxSize.SizeInBytes),
+		maxObjectSize: conf.MaxObjectSize.SizeInBytes,
+		ttl:           conf.TTL.Duration,
+		now:           time.Now,
+	}
+	if rc.maxObjectSize <= 0 || rc.maxObjectSize > conf.MaxSize.SizeInBytes {
+		rc.maxObjectSize = conf.MaxSize.SizeInBytes
+	}
+	if conf.DiskPath != "" && conf.DiskMaxSize.SizeInBytes > 0 {
+		rc.diskPath = conf.DiskPath
+		rc.disk = newTier(conf.DiskMaxSize.SizeInBytes)
+		rc.disk.onRemove = removeFile
+		rc.memory.onEvict = rc.moveToDisk
+	}
+	return rc
+}
+
+// get returns fresh entry, body of entries from disk tier is read from file
+func (rc *responseCache) get(key string, withBody bool) (*entry, []byte) {
+	rc.mx.Lock()
+	e, ok := rc.memory.get(key)
+	if !ok && rc.disk != nil {
+		e, ok = rc.disk.get(key)
+	}
+	if !ok || (withBody && !e.hasBody) {
+		rc.mx.Unlock()
+		return nil, nil
+	}
+	if rc.now().After(e.expires) {
+		rc.remove(key)
+		rc.mx.Unlock()
+		return nil, nil
+	}
+	rc.mx.Unlock()
+	if !withBody || e.file == "" {
+		return e, e.body
+	}
+	body, err := ioutil.ReadFile(e.file)
+	if err != nil {
+		log.Debugf("Cannot read cached response %s: %s", e.file, err)
+		return nil, nil
+	}
+	return e, body
+}
+
+func (rc *responseCache) put(e *entry) {
+	rc.mx.Lock()
+	defer rc.mx.Unlock()
+	if rc.disk != nil {
+		rc.disk.remove(e.key)
+	}
+	rc.memory.put(e)
+	metrics.UpdateGauge("cache.memory.size", rc.memory.size)
+}
+
+func (rc *responseCache) remove(key string) {
+	rc.memory.remove(key)
+	if rc.disk != nil {
+		rc.disk.remove(key)
+	}
+}
+
+// invalidate removes responses of object, or of all bucket objects if path
+// is bucket path
+func (rc *responseCache) invalidate(path string) {
+	bucketPrefix := strings.TrimSuffix(path, "/") + "/"
+	matches := func(e *entry) bool {
+		return e.path == path || strings.HasPrefix(e.path, bucketPrefix)
+	}
+	rc.mx.Lock()
+	defer rc.mx.Unlock()
+	removed := rc.memory.removeIf(matches)
+	if rc.disk != nil {
+		removed += rc.disk.removeIf(matches)
+	}
+	if removed > 0 {
+		metrics.Mark("cache.invalidated")
+	}
+}
+
+// moveToDisk writes body of entry evicted from memory to disk tier
+func (rc *responseCache) moveToDisk(e *entry) {
+	if !e.hasBody {
+		return
+	}
+	sum := sha1.Sum([]byte(e.key))
+	file := filepath.Join(rc.diskPath, hex.EncodeToString(sum[:]))
+	if err := ioutil.WriteFile(file, e.body, 0600); err != nil {
+		log.Printf("Cannot write cached response to %s: %s", file, err)
+		return
+	}
+	onDisk := *e
+	onDisk.body = nil
+	onDisk.file = file
+	if !rc.disk.put(&onDisk) {
+		removeFile(&onDisk)
+	}
+}
+
+func removeFile(e *entry) {
+	if err := os.Remove(e.file); err != nil && !os.IsNotExist(err) {
+		log.Debugf("Cannot remove cached response %s: %s", e.file, err)
+	}
+}
+
+type cachingRoundTripper struct {
+	roundTripper http.RoundTripper
+	cache        *responseCache
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (crt *cachingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := crt.roundTripper.RoundTrip(req)
+		if req.Method != http.MethodOptions {
+			crt.cache.invalidate(req.URL.Path)
+		}
+		return resp, err
+	}
+	key, verified := cacheKey(req)
+	if !verified {
+		return crt.roundTripper.RoundTrip(req)
+	}
+	if resp := crt.notModified(req, key); resp != nil {
+		metrics.Mark("cache.notmodified")
+		return resp, nil
+	}
+	if !isCacheable(req) {
+		return crt.roundTripper.RoundTrip(req)
+	}
+	if e, body := crt.cache.get(key, req.Method == http.MethodGet); e != nil {
+		metrics.Mark("cache.hit")
+		return cachedResponse(req, e, body), nil
+	}
+	metrics.Mark("cache.miss")
+	resp, err := crt.roundTripper.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	return crt.store(req, key, resp)
+}
+
+// store caches response allowed to be cached by Cache-Control
+func (crt *cachingRoundTripper) store(req *http.Request, key string, resp *http.Response) (*http.Response, error) {
+	ttl, cacheable := freshness(resp.Header.Get("Cache-Control"), crt.cache.ttl)
+	withBody := req.Method == http.MethodGet
+	if !cacheable || (withBody && (resp.ContentLength < 0 || resp.ContentLength > crt.cache.maxObjectSize)) {
+		return resp, nil
+	}
+	e := &entry{
+		key:     key,
+		path:    req.URL.Path,
+		header:  cloneHeader(resp.Header),
+		status:  resp.StatusCode,
+		hasBody: withBody,
+		expires: crt.cache.now().Add(ttl),
+	}
+	if withBody {
+		body, err := ioutil.ReadAll(resp.Body)
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Debugf("Cannot close response body: %s", closeErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		e.body = body
+	}
+	e.size = int64(len(e.body)) + headerSize(e.header)
+	crt.cache.put(e)
+	return resp, nil
+}
+
+// notModified answers If-None-Match request with 304 if ETag of object cached
+// for the same access key matches, backends are not asked then
+func (crt *cachingRoundTripper) notModified(req *http.Request, key string) *http.Response {
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || !isObjectRead(req) || req.Header.Get("If-Match") != "" || req.Header.Get("If-Unmodified-Since") != "" {
+		return nil
+	}
+	e, _ := crt.cache.get(key, false)
+	if e == nil || !etagMatches(ifNoneMatch, e.header.Get("ETag")) {
+		return nil
+	}
+	header := http.Header{}
+	for _, name := range notModifiedHeaders {
+		if value := e.header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(http.StatusNotModified) + " " + http.StatusText(http.StatusNotModified),
+		StatusCode: http.StatusNotModified,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Request:    req,
+		Body:       http.NoBody,
+	}
+}
+
+// notModifiedHeaders are sent in 304 response, as RFC 7232 requires
+var notModifiedHeaders = []string{"ETag", "Cache-Control", "Expires", "Last-Modified", "Content-Location", "Vary"}
+
+// etagMatches compares ETag with If-None-Match list using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// isCacheable reports if request reads whole object unconditionally and
+// client accepts cached response
+func isCacheable(req *http.Request) bool {
+	if !isObjectRead(req) || req.Header.Get("Range") != "" {
+		return false
+	}
+	for _, header := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if req.Header.Get(header) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// isObjectRead reports if request reads object and client accepts cached
+// response
+func isObjectRead(req *http.Request) bool {
+	path := strings.Trim(req.URL.Path, "/")
+	if !strings.Contains(path, "/") || req.URL.RawQuery != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(req.Header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-cache") && !strings.Contains(cacheControl, "no-store")
+}
+
+// freshness returns how long response may be cached according to its
+// Cache-Control, ttl is upper bound
+func freshness(cacheControl string, ttl time.Duration) (time.Duration, bool) {
+	for _, directive := range strings.Split(strings.ToLower(cacheControl), ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "no-store" || directive == "no-cache" || directive == "private":
+			return 0, false
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			if maxAge := time.Duration(seconds) * time.Second; maxAge < ttl {
+				ttl = maxAge
+			}
+		}
+	}
+	return ttl, true
+}
+
+// cacheKey separates responses of access keys, as backends authorize them.
+// Access key of request is known only if edge authentication verified its
+// signature or it's anonymous read of public bucket, Authorization of other
+// requests may be forged so they get no key
+func cacheKey(req *http.Request) (string, bool) {
+	accessKey, verified := types.AuthenticatedAccessKey(req.Context())
+	if !verified && !types.IsAnonymousRead(req.Context()) {
+		return "", false
+	}
+	return accessKey + "\x00" + req.URL.Path, true
+}
+
+func cachedResponse(req *http.Request, e *entry, body []byte) *http.Response {
+	resp := &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cloneHeader(e.header),
+		Request:       req,
+		ContentLength: -1,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+	}
+	if contentLength, err := strconv.ParseInt(e.header.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = contentLength
+	}
+	if e.hasBody && req.Method == http.MethodGet {
+		resp.ContentLength = int64(len(body))
+	}
+	return resp
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// Decorator creates httphandler.Decorator caching GET and HEAD responses of
+// objects, responses are invalidated by requests changing object sent through
+// this instance
+func Decorator(conf config.Cache) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if conf.MaxSize.SizeInBytes <= 0 {
+			return roundTripper
+		}
+		return &cachingRoundTripper{roundTripper: roundTripper, cache: newResponseCache(conf)}
+	}
+}
@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/cache/config"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backendStub struct {
+	objects      map[string]string
+	cacheControl string
+	calls        int
+}
+
+func (bs *backendStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	bs.calls++
+	if req.Method == http.MethodPut {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		bs.objects[req.URL.Path] = string(body)
+		return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}
+	object, ok := bs.objects[req.URL.Path]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Request: req, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}
+	header := http.Header{}
+	header.Set("Content-Length", strconv.Itoa(len(object)))
+	header.Set("ETag", `"etag"`)
+	if bs.cacheControl != "" {
+		header.Set("Cache-Control", bs.cacheControl)
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Request:       req,
+		Header:        header,
+		ContentLength: int64(len(object)),
+		Body:          ioutil.NopCloser(strings.NewReader(object)),
+	}, nil
+}
+
+func newCachingRoundTripper(conf config.Cache) (*cachingRoundTripper, *backendStub) {
+	backend := &backendStub{objects: map[string]string{"/bucket/object": "content"}}
+	if conf.MaxSize.SizeInBytes == 0 {
+		conf.MaxSize = types.HumanSizeUnits{SizeInBytes: 1024}
+	}
+	if conf.TTL.Duration == 0 {
+		conf.TTL = metrics.Interval{Duration: time.Minute}
+	}
+	return Decorator(conf)(backend).(*cachingRoundTripper), backend
+}
+
+// request returns request of access key verified by edge authentication
+func request(method, path string) *http.Request {
+	return requestOf("access-key", method, path)
+}
+
+func requestOf(accessKey, method, path string) *http.Request {
+	req := httptest.NewRequest(method, "http://localhost"+path, nil)
+	req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	return req.WithContext(types.WithAuthenticatedAccessKey(req.Context(), accessKey))
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestCacheShouldServeRepeatedGetFromMemory(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	for i := 0; i < 2; i++ {
+		resp, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "content", readBody(t, resp))
+		assert.Equal(t, `"etag"`, resp.Header.Get("ETag"))
+	}
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestCacheShouldServeHeadFromCachedGet(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+	resp, err := crt.RoundTrip(request(http.MethodHead, "/bucket/object"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(len("content")), resp.ContentLength)
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestCacheShouldNotServeGetFromCachedHead(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	_, err := crt.RoundTrip(request(http.MethodHead, "/bucket/object"))
+	require.NoError(t, err)
+	resp, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "content", readBody(t, resp))
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCacheShouldInvalidateObjectOnPut(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+	putReq := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/object", strings.NewReader("changed"))
+	_, err = crt.RoundTrip(putReq)
+	require.NoError(t, err)
+	resp, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "changed", readBody(t, resp))
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestCacheShouldInvalidateBucketObjectsOnBucketDelete(t *testing.T) {
+	crt, _ := newCachingRoundTripper(config.Cache{})
+
+	_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+	crt.cache.invalidate("/bucket")
+
+	key, _ := cacheKey(request(http.MethodGet, "/bucket/object"))
+	e, _ := crt.cache.get(key, false)
+	assert.Nil(t, e)
+}
+
+func TestCacheShouldHonorCacheControl(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+	backend.cacheControl = "private, max-age=60"
+
+	for i := 0; i < 2; i++ {
+		_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+		require.NoError(t, err)
+	}
+	noCacheReq := request(http.MethodGet, "/bucket/object")
+	noCacheReq.Header.Set("Cache-Control", "no-cache")
+	_, err := crt.RoundTrip(noCacheReq)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestCacheShouldExpireEntriesAfterMaxAge(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+	backend.cacheControl = "max-age=10"
+	now := time.Now()
+	crt.cache.now = func() time.Time { return now }
+
+	_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+	now = now.Add(11 * time.Second)
+	_, err = crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCacheShouldSeparateAccessKeys(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	for _, accessKey := range []string{"first", "second"} {
+		_, err := crt.RoundTrip(requestOf(accessKey, http.MethodGet, "/bucket/object"))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCacheShouldNotServeRequestsWithUnverifiedAccessKey(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+	_, err := crt.RoundTrip(requestOf("victim", http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		forged := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/object", nil)
+		forged.Header.Set("Authorization", "AWS victim:forged")
+		_, err = crt.RoundTrip(forged)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 3, backend.calls)
+}
+
+func TestCacheShouldServeAnonymousReadsOfPublicBuckets(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/object", nil)
+		_, err := crt.RoundTrip(req.WithContext(types.WithAnonymousRead(req.Context())))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestCacheShouldSkipObjectsBiggerThanMaxObjectSize(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{MaxObjectSize: types.HumanSizeUnits{SizeInBytes: 3}})
+
+	for i := 0; i < 2; i++ {
+		resp, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+		require.NoError(t, err)
+		assert.Equal(t, "content", readBody(t, resp))
+	}
+
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCacheShouldMoveEvictedEntriesToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	crt, backend := newCachingRoundTripper(config.Cache{
+		MaxSize:     types.HumanSizeUnits{SizeInBytes: 64},
+		DiskPath:    dir,
+		DiskMaxSize: types.HumanSizeUnits{SizeInBytes: 1024},
+	})
+	backend.objects["/bucket/other"] = "other content"
+
+	for _, path := range []string{"/bucket/object", "/bucket/other", "/bucket/object"} {
+		resp, err := crt.RoundTrip(request(http.MethodGet, path))
+		require.NoError(t, err)
+		assert.Equal(t, backend.objects[path], readBody(t, resp))
+	}
+
+	assert.Equal(t, 2, backend.calls)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestCacheShouldAnswerMatchingIfNoneMatchLocally(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+	backend.cacheControl = "max-age=60"
+
+	_, err := crt.RoundTrip(request(http.MethodHead, "/bucket/object"))
+	require.NoError(t, err)
+	req := request(http.MethodGet, "/bucket/object")
+	req.Header.Set("If-None-Match", `"other", W/"etag"`)
+	resp, err := crt.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, `"etag"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "max-age=60", resp.Header.Get("Cache-Control"))
+	assert.Empty(t, resp.Header.Get("Content-Length"))
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestCacheShouldForwardIfNoneMatchWithDifferentETag(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	_, err := crt.RoundTrip(request(http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+	req := request(http.MethodGet, "/bucket/object")
+	req.Header.Set("If-None-Match", `"other"`)
+	resp, err := crt.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, backend.calls)
+}
+
+func TestCacheShouldForwardIfNoneMatchOfUnknownObject(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+
+	req := request(http.MethodGet, "/bucket/object")
+	req.Header.Set("If-None-Match", "*")
+	_, err := crt.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestCacheShouldForwardIfNoneMatchWithUnverifiedAccessKey(t *testing.T) {
+	crt, backend := newCachingRoundTripper(config.Cache{})
+	_, err := crt.RoundTrip(requestOf("victim", http.MethodGet, "/bucket/object"))
+	require.NoError(t, err)
+
+	forged := httptest.NewRequest(http.MethodHead, "http://localhost/bucket/object", nil)
+	forged.Header.Set("Authorization", "AWS victim:forged")
+	forged.Header.Set("If-None-Match", `"etag"`)
+	_, err = crt.RoundTrip(forged)
+	require.NoError(t, err)
+	other := requestOf("other", http.MethodHead, "/bucket/object")
+	other.Header.Set("If-None-Match", `"etag"`)
+	_, err = crt.RoundTrip(other)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, backend.calls)
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+// Cache configuration of GET and HEAD responses, responses are not cached if
+// MaxSize is not defined
+type Cache struct {
+	// MaxSize of responses kept in memory
+	MaxSize types.HumanSizeUnits `yaml:"MaxSize"`
+	// MaxObjectSize is size of the biggest cached object
+	MaxObjectSize types.HumanSizeUnits `yaml:"MaxObjectSize"`
+	// TTL of cached responses, shorter max-age of response takes precedence
+	TTL metrics.Interval `yaml:"TTL"`
+	// DiskPath is directory of responses evicted from memory, disk tier is
+	// disabled if not defined
+	DiskPath string `yaml:"DiskPath"`
+	// DiskMaxSize of responses kept on disk
+	DiskMaxSize types.HumanSizeUnits `yaml:"DiskMaxSize"`
+}
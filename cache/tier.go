@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"time"
+)
+
+// entry is cached response
+type entry struct {
+	key  string
+	path string
+	// header and status of response, body is cached for GET responses only
+	header  http.Header
+	status  int
+	hasBody bool
+	body    []byte
+	// file keeps body of entries in disk tier
+	file    string
+	size    int64
+	expires time.Time
+}
+
+func headerSize(header http.Header) int64 {
+	size := int64(0)
+	for name, values := range header {
+		for _, value := range values {
+			size += int64(len(name) + len(value))
+		}
+	}
+	return size
+}
+
+// tier keeps entries up to maxSize, least recently used entries are evicted
+// first
+type tier struct {
+	maxSize int64
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+	// onEvict is called for entries evicted to make room for new ones
+	onEvict func(*entry)
+	// onRemove is called for every entry leaving tier
+	onRemove func(*entry)
+}
+
+func newTier(maxSize int64) *tier {
+	return &tier{
+		maxSize:  maxSize,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		onEvict:  func(*entry) {},
+		onRemove: func(*entry) {},
+	}
+}
+
+func (t *tier) get(key string) (*entry, bool) {
+	element, ok := t.entries[key]
+	if !ok {
+		return nil, false
+	}
+	t.order.MoveToFront(element)
+	return element.Value.(*entry), true
+}
+
+// put stores entry, entries bigger than tier are not stored
+func (t *tier) put(e *entry) bool {
+	if e.size > t.maxSize {
+		return false
+	}
+	t.remove(e.key)
+	t.entries[e.key] = t.order.PushFront(e)
+	t.size += e.size
+	for t.size > t.maxSize {
+		oldest := t.order.Back().Value.(*entry)
+		t.remove(oldest.key)
+		t.onEvict(oldest)
+	}
+	return true
+}
+
+func (t *tier) remove(key string) {
+	element, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	e := element.Value.(*entry)
+	t.order.Remove(element)
+	delete(t.entries, key)
+	t.size -= e.size
+	t.onRemove(e)
+}
+
+// removeIf removes entries matching predicate
+func (t *tier) removeIf(matches func(*entry) bool) int {
+	removed := 0
+	for key, element := range t.entries {
+		if matches(element.Value.(*entry)) {
+			t.remove(key)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,259 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/akubra/compression/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/klauspost/compress/zstd"
+)
+
+const chunkSize = 32 * 1024
+
+// compressingBody compresses source while it's read, so response is streamed
+// without buffering whole body
+type compressingBody struct {
+	source io.ReadCloser
+	writer io.WriteCloser
+	buf    bytes.Buffer
+	chunk  []byte
+	// err is source or compression error, io.EOF once compressed stream is
+	// complete
+	err error
+}
+
+func newCompressingBody(source io.ReadCloser, algorithm string, level int) (*compressingBody, error) {
+	cb := &compressingBody{source: source, chunk: make([]byte, chunkSize)}
+	var err error
+	switch algorithm {
+	case config.Zstd:
+		encoderLevel := zstd.SpeedDefault
+		if level != 0 {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		cb.writer, err = zstd.NewWriter(&cb.buf, zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+	default:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		cb.writer, err = gzip.NewWriterLevel(&cb.buf, level)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cb, nil
+}
+
+// Read implements io.Reader interface
+func (cb *compressingBody) Read(p []byte) (int, error) {
+	for cb.buf.Len() == 0 && cb.err == nil {
+		n, err := cb.source.Read(cb.chunk)
+		if n > 0 {
+			if _, writeErr := cb.writer.Write(cb.chunk[:n]); writeErr != nil {
+				cb.err = writeErr
+				break
+			}
+		}
+		switch {
+		case err == io.EOF:
+			cb.err = io.EOF
+			if closeErr := cb.writer.Close(); closeErr != nil {
+				cb.err = closeErr
+			}
+		case err != nil:
+			cb.err = err
+		}
+	}
+	if cb.buf.Len() > 0 {
+		return cb.buf.Read(p)
+	}
+	return 0, cb.err
+}
+
+// Close implements io.Closer interface, writer of body not read to the end is
+// closed to release encoder resources
+func (cb *compressingBody) Close() error {
+	if cb.err == nil {
+		_ = cb.writer.Close()
+	}
+	return cb.source.Close()
+}
+
+// decompressingBody decodes gzip or zstd encoded source, stream header is read
+// on first Read
+type decompressingBody struct {
+	source    io.ReadCloser
+	algorithm string
+	reader    io.ReadCloser
+}
+
+// Read implements io.Reader interface
+func (db *decompressingBody) Read(p []byte) (int, error) {
+	if db.reader == nil {
+		reader, err := db.newReader()
+		if err != nil {
+			return 0, err
+		}
+		db.reader = reader
+	}
+	return db.reader.Read(p)
+}
+
+func (db *decompressingBody) newReader() (io.ReadCloser, error) {
+	if db.algorithm == config.Zstd {
+		decoder, err := zstd.NewReader(db.source, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return gzip.NewReader(db.source)
+}
+
+// Close implements io.Closer interface
+func (db *decompressingBody) Close() error {
+	if db.reader != nil {
+		_ = db.reader.Close()
+	}
+	return db.source.Close()
+}
+
+type compressingRoundTripper struct {
+	roundTripper http.RoundTripper
+	algorithm    string
+	level        int
+	contentTypes []string
+	minSize      int64
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (crt *compressingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := crt.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil || resp.Body == nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	acceptEncoding := req.Header.Get("Accept-Encoding")
+	switch contentEncoding := strings.ToLower(resp.Header.Get("Content-Encoding")); contentEncoding {
+	case config.Gzip, config.Zstd:
+		resp.Header.Add("Vary", "Accept-Encoding")
+		if acceptEncoding != "" && !acceptsEncoding(acceptEncoding, contentEncoding) {
+			decompress(resp, contentEncoding)
+		}
+	case "", "identity":
+		if !crt.isCompressible(resp) {
+			return resp, nil
+		}
+		resp.Header.Add("Vary", "Accept-Encoding")
+		if acceptsEncoding(acceptEncoding, crt.algorithm) {
+			crt.compress(req, resp)
+		}
+	}
+	return resp, nil
+}
+
+// isCompressible checks response content type and size, responses of
+// unknown size are compressed
+func (crt *compressingRoundTripper) isCompressible(resp *http.Response) bool {
+	if resp.ContentLength >= 0 && resp.ContentLength < crt.minSize {
+		return false
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	for _, contentType := range crt.contentTypes {
+		if contentType == mediaType || (strings.HasSuffix(contentType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(contentType, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (crt *compressingRoundTripper) compress(req *http.Request, resp *http.Response) {
+	body, err := newCompressingBody(resp.Body, crt.algorithm, crt.level)
+	if err != nil {
+		log.Printf("Cannot compress response of %s: %s", req.Context().Value(log.ContextreqIDKey), err)
+		return
+	}
+	resp.Body = body
+	resp.Header.Set("Content-Encoding", crt.algorithm)
+	encoded(resp)
+	metrics.Mark("compression.compressed")
+}
+
+// decompress decodes response for clients refusing its encoding, S3 clients
+// not sending Accept-Encoding expect objects as they were stored
+func decompress(resp *http.Response, algorithm string) {
+	resp.Body = &decompressingBody{source: resp.Body, algorithm: algorithm}
+	resp.Header.Del("Content-Encoding")
+	encoded(resp)
+	metrics.Mark("compression.decompressed")
+}
+
+// encoded updates headers of response which body was re-encoded, ETag of
+// stored object becomes weak validator
+func encoded(resp *http.Response) {
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-MD5")
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+}
+
+// acceptsEncoding checks Accept-Encoding request header, encodings with q=0
+// are refused
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	accepted := false
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = value
+				}
+			}
+		}
+		if name == encoding {
+			return quality > 0
+		}
+		accepted = quality > 0
+	}
+	return accepted
+}
+
+// Decorator creates httphandler.Decorator compressing GET responses of
+// configured content types for clients accepting configured algorithm, gzip
+// and zstd encoded responses are decompressed for clients which refuse them
+func Decorator(conf config.Compression) httphandler.Decorator {
+	contentTypes := make([]string, 0, len(conf.ContentTypes))
+	for _, contentType := range conf.ContentTypes {
+		contentTypes = append(contentTypes, strings.ToLower(contentType))
+	}
+	algorithm := strings.ToLower(conf.Algorithm)
+	if algorithm == "" {
+		algorithm = config.Gzip
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if len(contentTypes) == 0 {
+			return roundTripper
+		}
+		return &compressingRoundTripper{
+			roundTripper: roundTripper,
+			algorithm:    algorithm,
+			level:        conf.Level,
+			contentTypes: contentTypes,
+			minSize:      conf.MinSize.SizeInBytes,
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/compression/config"
+	"github.com/allegro/akubra/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (rtf roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rtf(req)
+}
+
+func backend(contentType, contentEncoding string, body []byte) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		header.Set("ETag", `"etag"`)
+		if contentEncoding != "" {
+			header.Set("Content-Encoding", contentEncoding)
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        header,
+			ContentLength: int64(len(body)),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			Request:       req,
+		}, nil
+	})
+}
+
+func get(acceptEncoding string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/object", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	return req
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	_, err := writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func zstdEncoded(t *testing.T, content string) []byte {
+	buf := &bytes.Buffer{}
+	writer, err := zstd.NewWriter(buf)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+var textConfig = config.Compression{ContentTypes: []string{"text/*", "application/json"}, MinSize: types.HumanSizeUnits{SizeInBytes: 10}}
+
+func TestShouldCompressEligibleResponseForClientAcceptingGzip(t *testing.T) {
+	content := strings.Repeat("compressible ", 1000)
+	rt := Decorator(textConfig)(backend("text/plain; charset=utf-8", "", []byte(content)))
+
+	resp, err := rt.RoundTrip(get("deflate, gzip;q=0.5"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, `W/"etag"`, resp.Header.Get("ETag"))
+	assert.Empty(t, resp.Header.Get("Content-Length"))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	compressed, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.True(t, len(compressed) < len(content))
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decompressed))
+}
+
+func TestShouldCompressEligibleResponseWithZstdForClientAcceptingIt(t *testing.T) {
+	content := strings.Repeat("compressible ", 1000)
+	zstdConfig := textConfig
+	zstdConfig.Algorithm = config.Zstd
+	rt := Decorator(zstdConfig)(backend("application/json", "", []byte(content)))
+
+	resp, err := rt.RoundTrip(get("gzip, zstd"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "zstd", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `W/"etag"`, resp.Header.Get("ETag"))
+	compressed, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.True(t, len(compressed) < len(content))
+	decoder, err := zstd.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	defer decoder.Close()
+	decompressed, err := ioutil.ReadAll(decoder)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decompressed))
+
+	resp, err = rt.RoundTrip(get("gzip"))
+	require.NoError(t, err)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+}
+
+func TestShouldNotCompressIneligibleResponses(t *testing.T) {
+	testCases := []struct {
+		name           string
+		contentType    string
+		body           string
+		acceptEncoding string
+	}{
+		{"not allowed content type", "image/jpeg", "0123456789abcdef", "gzip"},
+		{"too small", "application/json", "{}", "gzip"},
+		{"client refuses gzip", "text/html", "0123456789abcdef", "gzip;q=0, *"},
+		{"client doesn't accept gzip", "text/html", "0123456789abcdef", ""},
+	}
+	for _, tc := range testCases {
+		rt := Decorator(textConfig)(backend(tc.contentType, "", []byte(tc.body)))
+
+		resp, err := rt.RoundTrip(get(tc.acceptEncoding))
+		require.NoError(t, err, tc.name)
+
+		assert.Empty(t, resp.Header.Get("Content-Encoding"), tc.name)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.body, string(body), tc.name)
+	}
+}
+
+func TestShouldDecompressGzipResponseForClientNotAcceptingIt(t *testing.T) {
+	rt := Decorator(textConfig)(backend("text/plain", "gzip", gzipped(t, "content")))
+
+	resp, err := rt.RoundTrip(get("identity"))
+	require.NoError(t, err)
+
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, `W/"etag"`, resp.Header.Get("ETag"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(body))
+}
+
+func TestShouldDecompressZstdResponseForClientNotAcceptingIt(t *testing.T) {
+	rt := Decorator(textConfig)(backend("text/plain", "zstd", zstdEncoded(t, "content")))
+
+	resp, err := rt.RoundTrip(get("gzip"))
+	require.NoError(t, err)
+
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `W/"etag"`, resp.Header.Get("ETag"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, "content", string(body))
+}
+
+func TestShouldPassGzipResponseToClientAcceptingIt(t *testing.T) {
+	stored := gzipped(t, "content")
+	rt := Decorator(textConfig)(backend("text/plain", "gzip", stored))
+
+	resp, err := rt.RoundTrip(get("gzip"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, `"etag"`, resp.Header.Get("ETag"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, stored, body)
+}
+
+func TestDecoratorShouldNotWrapWithoutContentTypes(t *testing.T) {
+	rt := &http.Transport{}
+
+	assert.Equal(t, rt, Decorator(config.Compression{})(rt))
+}
+
+func TestShouldPassGzipResponseToClientWithoutAcceptEncoding(t *testing.T) {
+	stored := gzipped(t, "content")
+	rt := Decorator(textConfig)(backend("application/gzip", "gzip", stored))
+
+	resp, err := rt.RoundTrip(get(""))
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, stored, body)
+}
@@ -0,0 +1,25 @@
+package config
+
+import "github.com/allegro/akubra/types"
+
+const (
+	// Gzip compression algorithm
+	Gzip = "gzip"
+	// Zstd compression algorithm
+	Zstd = "zstd"
+)
+
+// Compression configuration of responses, responses are not compressed if
+// ContentTypes are not defined
+type Compression struct {
+	// Algorithm of compression, gzip or zstd, default: gzip
+	Algorithm string `yaml:"Algorithm"`
+	// Level of compression from 1 (fastest) to 9 (best) for gzip and to 22
+	// for zstd, default level of algorithm is used if not set
+	Level int `yaml:"Level"`
+	// ContentTypes are compressed media types, "text/*" matches all text
+	// types
+	ContentTypes []string `yaml:"ContentTypes"`
+	// MinSize of compressed response body
+	MinSize types.HumanSizeUnits `yaml:"MinSize"`
+}
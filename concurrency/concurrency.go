@@ -0,0 +1,160 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/akubra/concurrency/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/types"
+)
+
+// limiter keeps number of requests in flight under the limit, requests over
+// the limit wait in queue for a free slot
+type limiter struct {
+	slots         chan struct{}
+	queued        int64
+	maxQueued     int64
+	timeout       time.Duration
+	metricsPrefix string
+}
+
+func newLimiter(metricsPrefix string, limit config.Limit) *limiter {
+	return &limiter{
+		slots:         make(chan struct{}, limit.MaxInFlight),
+		maxQueued:     int64(limit.MaxQueued),
+		timeout:       limit.QueueTimeout.Duration,
+		metricsPrefix: metricsPrefix,
+	}
+}
+
+// acquire returns false if request should be shed
+func (l *limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		l.updateInFlight()
+		return true
+	default:
+	}
+	queued := atomic.AddInt64(&l.queued, 1)
+	defer func() {
+		metrics.UpdateGauge(l.metricsPrefix+".queued", atomic.AddInt64(&l.queued, -1))
+	}()
+	if queued > l.maxQueued {
+		return false
+	}
+	metrics.UpdateGauge(l.metricsPrefix+".queued", queued)
+	start := time.Now()
+	defer metrics.UpdateSince(l.metricsPrefix+".wait", start)
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		l.updateInFlight()
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+	l.updateInFlight()
+}
+
+func (l *limiter) updateInFlight() {
+	metrics.UpdateGauge(l.metricsPrefix+".in_flight", int64(len(l.slots)))
+}
+
+// releasingBody frees limiter slot when response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (rb *releasingBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.once.Do(rb.release)
+	return err
+}
+
+type limitedRoundTripper struct {
+	roundTripper http.RoundTripper
+	limiter      *limiter
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (lrt *limitedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !lrt.limiter.acquire(req.Context()) {
+		metrics.Mark(lrt.limiter.metricsPrefix + ".rejected")
+		log.Debugf("Request %s shed by %s concurrency limit", req.Context().Value(log.ContextreqIDKey), lrt.limiter.metricsPrefix)
+		return types.NewS3ErrorResponse(req, http.StatusServiceUnavailable, types.S3ErrServiceUnavailable, "Please reduce your request rate."), nil
+	}
+	resp, err := lrt.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil || resp.Body == nil {
+		lrt.limiter.release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: lrt.limiter.release}
+	return resp, err
+}
+
+// Decorator creates httphandler.Decorator limiting number of requests in flight,
+// slot is held until response body is closed
+func Decorator(limit *config.Limit) httphandler.Decorator {
+	return decorator("concurrency.global", limit)
+}
+
+func decorator(metricsPrefix string, limit *config.Limit) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if limit == nil {
+			return roundTripper
+		}
+		return &limitedRoundTripper{
+			roundTripper: roundTripper,
+			limiter:      newLimiter(metricsPrefix, *limit),
+		}
+	}
+}
+
+type limitedShardClient struct {
+	storages.NamedShardClient
+	roundTripper http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (lsc *limitedShardClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	return lsc.roundTripper.RoundTrip(req)
+}
+
+// LimitShards replaces shard clients with limited ones
+func LimitShards(shards map[string]storages.NamedShardClient, limits map[string]config.Limit) error {
+	for name, limit := range limits {
+		shard, ok := shards[name]
+		if !ok {
+			return fmt.Errorf("concurrency limit defined for unknown shard %q", name)
+		}
+		limit := limit
+		shards[name] = &limitedShardClient{
+			NamedShardClient: shard,
+			roundTripper:     decorator(fmt.Sprintf("concurrency.shard.%s", metrics.Clean(name)), &limit)(shard),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package concurrency
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/concurrency/config"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	err error
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rts.err != nil {
+		return nil, rts.err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString("ok")),
+		Request:    req,
+	}, nil
+}
+
+type shardClientStub struct {
+	roundTripperStub
+	name string
+}
+
+func (scs *shardClientStub) Name() string {
+	return scs.name
+}
+
+func (scs *shardClientStub) Backends() []*storages.StorageClient {
+	return nil
+}
+
+func (scs *shardClientStub) StreamsBody() bool {
+	return false
+}
+
+func limitedRequest(t *testing.T, roundTripper http.RoundTripper) *http.Response {
+	resp, err := roundTripper.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+	require.NoError(t, err)
+	return resp
+}
+
+func TestDecoratorShouldNotWrapWithoutLimit(t *testing.T) {
+	stub := &roundTripperStub{}
+	assert.Equal(t, stub, Decorator(nil)(stub))
+}
+
+func TestShouldShedRequestsOverLimitUntilBodyIsClosed(t *testing.T) {
+	limited := Decorator(&config.Limit{MaxInFlight: 1})(&roundTripperStub{})
+
+	first := limitedRequest(t, limited)
+	assert.Equal(t, http.StatusOK, first.StatusCode)
+
+	shed := limitedRequest(t, limited)
+	assert.Equal(t, http.StatusServiceUnavailable, shed.StatusCode)
+	body, err := ioutil.ReadAll(shed.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "<Code>ServiceUnavailable</Code>")
+
+	require.NoError(t, first.Body.Close())
+	require.NoError(t, first.Body.Close())
+	assert.Equal(t, http.StatusOK, limitedRequest(t, limited).StatusCode)
+}
+
+func TestQueuedRequestShouldProceedWhenSlotIsReleased(t *testing.T) {
+	limited := Decorator(&config.Limit{
+		MaxInFlight:  1,
+		MaxQueued:    1,
+		QueueTimeout: metrics.Interval{Duration: time.Second},
+	})(&roundTripperStub{})
+	first := limitedRequest(t, limited)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		first.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, limitedRequest(t, limited).StatusCode)
+}
+
+func TestQueuedRequestShouldBeShedAfterTimeout(t *testing.T) {
+	limited := Decorator(&config.Limit{
+		MaxInFlight:  1,
+		MaxQueued:    1,
+		QueueTimeout: metrics.Interval{Duration: 10 * time.Millisecond},
+	})(&roundTripperStub{})
+	first := limitedRequest(t, limited)
+	defer first.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, limitedRequest(t, limited).StatusCode)
+	assert.Equal(t, int64(0), limited.(*limitedRoundTripper).limiter.queued)
+}
+
+func TestShouldReleaseSlotOnError(t *testing.T) {
+	limited := Decorator(&config.Limit{MaxInFlight: 1})(&roundTripperStub{err: errors.New("connection refused")})
+
+	for i := 0; i < 2; i++ {
+		_, err := limited.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+		assert.EqualError(t, err, "connection refused")
+	}
+}
+
+func TestLimitShardsShouldWrapConfiguredShards(t *testing.T) {
+	shards := map[string]storages.NamedShardClient{
+		"limited":   &shardClientStub{name: "limited"},
+		"unlimited": &shardClientStub{name: "unlimited"},
+	}
+	unlimited := shards["unlimited"]
+
+	require.NoError(t, LimitShards(shards, map[string]config.Limit{"limited": {MaxInFlight: 1}}))
+
+	assert.IsType(t, &limitedShardClient{}, shards["limited"])
+	assert.Equal(t, "limited", shards["limited"].Name())
+	assert.Equal(t, unlimited, shards["unlimited"])
+	first := limitedRequest(t, shards["limited"])
+	defer first.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, limitedRequest(t, shards["limited"]).StatusCode)
+}
+
+func TestLimitShardsShouldFailForUnknownShard(t *testing.T) {
+	err := LimitShards(map[string]storages.NamedShardClient{}, map[string]config.Limit{"missing": {MaxInFlight: 1}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,21 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// Limit defines in flight requests limit
+type Limit struct {
+	// MaxInFlight is number of requests processed at once
+	MaxInFlight int `yaml:"MaxInFlight"`
+	// MaxQueued is number of requests waiting for free slot, further requests are rejected
+	MaxQueued int `yaml:"MaxQueued"`
+	// QueueTimeout is maximal time request waits in queue, zero means until client disconnects
+	QueueTimeout metrics.Interval `yaml:"QueueTimeout"`
+}
+
+// ConcurrencyLimits configuration, limits are not applied if not defined
+type ConcurrencyLimits struct {
+	// Global limits all requests
+	Global *Limit `yaml:"Global"`
+	// Shards limits requests handled by given shards
+	Shards map[string]Limit `yaml:"Shards"`
+}
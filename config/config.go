@@ -4,18 +4,38 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
 
 	"fmt"
 
 	httphandler "github.com/allegro/akubra/httphandler/config"
 
+	auditconfig "github.com/allegro/akubra/audit/config"
+	bodylimitconfig "github.com/allegro/akubra/bodylimit/config"
+	cacheconfig "github.com/allegro/akubra/cache/config"
+	compressionconfig "github.com/allegro/akubra/compression/config"
+	concurrencyconfig "github.com/allegro/akubra/concurrency/config"
+	corsconfig "github.com/allegro/akubra/cors/config"
 	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	encryptionconfig "github.com/allegro/akubra/encryption/config"
+	hooksconfig "github.com/allegro/akubra/hooks/config"
+	hotspotsconfig "github.com/allegro/akubra/hotspots/config"
+	inventoryconfig "github.com/allegro/akubra/inventory/config"
+	lifecycleconfig "github.com/allegro/akubra/lifecycle/config"
 	"github.com/allegro/akubra/log"
 	logconfig "github.com/allegro/akubra/log/config"
 	"github.com/allegro/akubra/metrics"
+	mirrorconfig "github.com/allegro/akubra/mirror/config"
+	netaclconfig "github.com/allegro/akubra/netacl/config"
+	notificationsconfig "github.com/allegro/akubra/notifications/config"
+	ratelimitconfig "github.com/allegro/akubra/ratelimit/config"
+	readonlyconfig "github.com/allegro/akubra/readonly/config"
 	confregions "github.com/allegro/akubra/regions/config"
+	spoolconfig "github.com/allegro/akubra/spool/config"
+	statusconfig "github.com/allegro/akubra/status/config"
 	storages "github.com/allegro/akubra/storages/config"
+	usageconfig "github.com/allegro/akubra/usage/config"
+	watchdogconfig "github.com/allegro/akubra/watchdog/config"
+	wormconfig "github.com/allegro/akubra/worm/config"
 	"gopkg.in/validator.v1"
 	"gopkg.in/yaml.v2"
 )
@@ -28,13 +48,34 @@ const TechnicalEndpointHeaderContentType = "application/yaml"
 
 // YamlConfig contains configuration fields of config file
 type YamlConfig struct {
-	Service          httphandler.Service                `yaml:"Service"`
-	Storages         storages.StoragesMap               `yaml:"Storages"`
-	Shards           storages.ShardsMap                 `yaml:"Shards"`
-	ShardingPolicies confregions.ShardingPolicies       `yaml:"ShardingPolicies"`
-	CredentialsStore crdstoreconfig.CredentialsStoreMap `yaml:"CredentialsStore"`
-	Logging          logconfig.LoggingConfig            `yaml:"Logging"`
-	Metrics          metrics.Config                     `yaml:"Metrics"`
+	Service           httphandler.Service                 `yaml:"Service"`
+	Storages          storages.StoragesMap                `yaml:"Storages"`
+	Shards            storages.ShardsMap                  `yaml:"Shards"`
+	ShardingPolicies  confregions.ShardingPolicies        `yaml:"ShardingPolicies"`
+	CredentialsStore  crdstoreconfig.CredentialsStoreMap  `yaml:"CredentialsStore"`
+	Logging           logconfig.LoggingConfig             `yaml:"Logging"`
+	Metrics           metrics.Config                      `yaml:"Metrics"`
+	RateLimits        ratelimitconfig.RateLimits          `yaml:"RateLimits"`
+	ConcurrencyLimits concurrencyconfig.ConcurrencyLimits `yaml:"ConcurrencyLimits"`
+	Spooling          spoolconfig.Spooling                `yaml:"Spooling"`
+	BodyLimits        bodylimitconfig.BodyLimits          `yaml:"BodyLimits"`
+	Mirroring         mirrorconfig.Mirroring              `yaml:"Mirroring"`
+	Inventory         inventoryconfig.Inventory           `yaml:"Inventory"`
+	Cache             cacheconfig.Cache                   `yaml:"Cache"`
+	Compression       compressionconfig.Compression       `yaml:"Compression"`
+	CORS              corsconfig.CORS                     `yaml:"CORS"`
+	Encryption        encryptionconfig.Encryption         `yaml:"Encryption"`
+	Usage             usageconfig.Usage                   `yaml:"Usage"`
+	Watchdog          watchdogconfig.Watchdog             `yaml:"Watchdog"`
+	HotSpots          hotspotsconfig.HotSpots             `yaml:"HotSpots"`
+	NetworkACL        netaclconfig.NetworkACL             `yaml:"NetworkACL"`
+	Audit             auditconfig.Audit                   `yaml:"Audit"`
+	ReadOnly          readonlyconfig.ReadOnly             `yaml:"ReadOnly"`
+	WORM              wormconfig.WORM                     `yaml:"WORM"`
+	Lifecycle         lifecycleconfig.Lifecycle           `yaml:"Lifecycle"`
+	Notifications     notificationsconfig.Notifications   `yaml:"Notifications"`
+	Hooks             hooksconfig.Hooks                   `yaml:"Hooks"`
+	Status            statusconfig.Status                 `yaml:"Status"`
 }
 
 // Config contains processed YamlConfig data
@@ -49,27 +90,50 @@ func parseConf(file io.Reader) (YamlConfig, error) {
 	if err != nil {
 		return YamlConfig{}, err
 	}
+	return parseContent(bs, "", nil)
+}
+
+// parseContent interpolates references of content, merges files it
+// includes, relative to dir, and applies overrides
+func parseContent(bs []byte, dir string, overrides []Override) (YamlConfig, error) {
 	rc := YamlConfig{}
+	bs, err := interpolate(bs)
+	if err != nil {
+		return rc, err
+	}
+	bs, err = resolveIncludes(bs, dir)
+	if err != nil {
+		return rc, err
+	}
+	bs, err = applyOverrides(bs, overrides)
+	if err != nil {
+		return rc, err
+	}
 	err = yaml.Unmarshal(bs, &rc)
 	return rc, err
 }
 
-// Configure parse configuration file
-func Configure(configFilePath string) (conf Config, err error) {
-	confFile, err := os.Open(configFilePath)
+// Configure parse configuration from location, see NewSource for supported
+// locations, overrides are applied on top of it
+func Configure(location string, overrides ...Override) (conf Config, err error) {
+	source, err := NewSource(location)
 	if err != nil {
-		log.Fatalf("[ ERROR ] Problem with opening config file: '%s' - err: %v !", configFilePath, err)
 		return conf, err
 	}
-	defer func() {
-		err = confFile.Close()
-		if err != nil {
-			log.Debugf("Cannot close configuration, reason: %s", err)
-		}
-	}()
-	yconf, err := parseConf(confFile)
+	return ConfigureFromSource(source, overrides...)
+}
+
+// ConfigureFromSource parse configuration read from source, overrides are
+// applied on top of it
+func ConfigureFromSource(source Source, overrides ...Override) (conf Config, err error) {
+	content, err := source.Read()
+	if err != nil {
+		log.Printf("[ ERROR ] Problem with reading config: '%s' - err: %v !", source, err)
+		return conf, err
+	}
+	yconf, err := parseContent(content, includeDir(source), overrides)
 	if err != nil {
-		log.Fatalf("[ ERROR ] Problem with parsing config file: '%s' - err: %v !", configFilePath, err)
+		log.Printf("[ ERROR ] Problem with parsing config: '%s' - err: %v !", source, err)
 		return conf, err
 	}
 	conf.YamlConfig = yconf
@@ -82,25 +146,25 @@ func logWriteHeaderErr(err error, when string) {
 	}
 }
 
+func registerValidationFuncs() error {
+	if err := validator.SetValidationFunc("NoEmptyValuesSlice", NoEmptyValuesInSliceValidator); err != nil {
+		return err
+	}
+	return validator.SetValidationFunc("UniqueValuesSlice", UniqueValuesInSliceValidator)
+}
+
 // ValidateConf validate configuration from YAML file
 func ValidateConf(conf YamlConfig, enableLogicalValidator bool) (bool, map[string][]error) {
-	err := validator.SetValidationFunc("NoEmptyValuesSlice", NoEmptyValuesInSliceValidator)
-	if err != nil {
-		return false, map[string][]error{"SetValidationFuncError": []error{err}}
-	}
-	err = validator.SetValidationFunc("UniqueValuesSlice", UniqueValuesInSliceValidator)
-	if err != nil {
+	if err := registerValidationFuncs(); err != nil {
 		return false, map[string][]error{"SetValidationFuncError": []error{err}}
 	}
 
 	valid, validationErrors := validator.Validate(conf)
 
 	if valid && enableLogicalValidator {
-		validListenPorts, portsValidationErrors := conf.ListenPortsLogicalValidator()
-		validRegionsEntries, regionsValidationErrors := conf.RegionsEntryLogicalValidator()
-		validTransportsEntries, transportsValidationErrors := conf.TransportsEntryLogicalValidator()
-		valid = valid && validListenPorts && validRegionsEntries && validTransportsEntries
-		validationErrors = mergeErrors(validationErrors, portsValidationErrors, regionsValidationErrors, transportsValidationErrors)
+		logicalErrors := logicalValidationErrors(conf)
+		valid = len(logicalErrors) == 0
+		validationErrors = mergeErrors(validationErrors, logicalErrors)
 	}
 
 	for propertyName, validatorMessage := range validationErrors {
@@ -53,13 +53,13 @@ const (
           ResponseHeaderTimeout: 2s
 Storages:
   dummy:
-    Endpoint: "http://127.0.0.1:8080"
+    Backend: "http://127.0.0.1:8080"
     Type: "passthrough"
     Maintenance: false
 Shards:
   cluster1test:
-    Backends:
-      - dummy
+    Storages:
+      - Name: dummy
 DisableKeepAlives: false
 `
 )
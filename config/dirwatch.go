@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+)
+
+// dirWatchSettle is quiet period after last directory event before content
+// is compared, so multi step updates trigger single reload
+const dirWatchSettle = 200 * time.Millisecond
+
+// WatchDirs calls onChange when content of files in any of dirs changes.
+// Files of Kubernetes ConfigMap and Secret volumes are symlinks through
+// "..data" symlink, which is atomically swapped on update, so files are
+// compared by content they resolve to and hidden ".." entries are skipped
+func WatchDirs(dirs []string, onChange func()) error {
+	events, err := dirEvents(dirs)
+	if err != nil {
+		return err
+	}
+	go watchDirs(dirs, events, onChange)
+	return nil
+}
+
+func watchDirs(dirs []string, events <-chan struct{}, onChange func()) {
+	lastChecksum := dirsChecksum(dirs)
+	for range events {
+		settle(events)
+		checksum := dirsChecksum(dirs)
+		if bytes.Equal(checksum, lastChecksum) {
+			continue
+		}
+		log.Printf("Configuration directories %s changed", strings.Join(dirs, ", "))
+		lastChecksum = checksum
+		onChange()
+	}
+}
+
+// settle waits until no events come for dirWatchSettle
+func settle(events <-chan struct{}) {
+	for {
+		select {
+		case <-events:
+		case <-time.After(dirWatchSettle):
+			return
+		}
+	}
+}
+
+// dirsChecksum sums names and content of regular files and symlinks to them
+// in dirs, subdirectories are not descended
+func dirsChecksum(dirs []string) []byte {
+	hash := sha256.New()
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			log.Printf("Cannot read configuration directory %s: %s", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "..") || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				log.Debugf("Skipping %s in configuration directory checksum: %s", path, err)
+				continue
+			}
+			_, _ = fmt.Fprintf(hash, "%s\x00%d\x00", path, len(content))
+			_, _ = hash.Write(content)
+		}
+	}
+	return hash.Sum(nil)
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/allegro/akubra/log"
+	"golang.org/x/sys/unix"
+)
+
+// watchDirEvents may change files of directory, symlink swaps of Kubernetes
+// volumes are renames
+const watchDirEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_CREATE | unix.IN_DELETE
+
+// dirEvents signals inotify events of dirs
+func dirEvents(dirs []string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if _, err = unix.InotifyAddWatch(fd, dir, watchDirEvents); err != nil {
+			_ = unix.Close(fd)
+			return nil, err
+		}
+	}
+	events := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := unix.Read(fd, buf); err != nil {
+				log.Printf("Watching configuration directories stopped: %s", err)
+				_ = unix.Close(fd)
+				close(events)
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// dirWatchPollInterval is how often directories are compared
+const dirWatchPollInterval = 2 * time.Second
+
+// dirEvents signals every dirWatchPollInterval, changes are detected by
+// content comparison
+func dirEvents(dirs []string) (<-chan struct{}, error) {
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	}
+	events := make(chan struct{}, 1)
+	go func() {
+		for range time.Tick(dirWatchPollInterval) {
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mountConfigMap lays out dir as kubelet does, files are symlinks through
+// "..data" pointing to timestamped directory
+func mountConfigMap(t *testing.T, dir, version, content string) {
+	versionDir := filepath.Join(dir, "..2018_01_02_"+version)
+	require.NoError(t, os.Mkdir(versionDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(versionDir, "akubra.yaml"), []byte(content), 0644))
+	require.NoError(t, os.Symlink(filepath.Base(versionDir), filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	if _, err := os.Lstat(filepath.Join(dir, "akubra.yaml")); os.IsNotExist(err) {
+		require.NoError(t, os.Symlink("..data/akubra.yaml", filepath.Join(dir, "akubra.yaml")))
+	}
+}
+
+// waitForChanges waits until expected number of changes is reached or timeout
+// passes, then lets late changes come
+func waitForChanges(changes *int32, expected int32, timeout time.Duration) int32 {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) && atomic.LoadInt32(changes) < expected {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(2 * dirWatchSettle)
+	return atomic.LoadInt32(changes)
+}
+
+func TestWatchDirsShouldNotifyOnceAboutConfigMapSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-config")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	mountConfigMap(t, dir, "1", "Service: {}")
+	var changes int32
+
+	require.NoError(t, WatchDirs([]string{dir}, func() { atomic.AddInt32(&changes, 1) }))
+	mountConfigMap(t, dir, "2", "Service: {}")
+	require.Equal(t, int32(0), waitForChanges(&changes, 1, time.Second))
+	mountConfigMap(t, dir, "3", "Storages: {}")
+
+	require.Equal(t, int32(1), waitForChanges(&changes, 1, 5*time.Second))
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// includeKey lists glob patterns of files merged into configuration
+const includeKey = "Include"
+
+// resolveIncludes merges files matching Include patterns of content into it,
+// in order of patterns and file names. Maps are merged key by key, other
+// values of included files replace previous ones. Relative patterns are
+// resolved against dir
+func resolveIncludes(content []byte, dir string) ([]byte, error) {
+	merged := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(content, &merged); err != nil {
+		return nil, err
+	}
+	patterns, err := includePatterns(merged[includeKey])
+	if err != nil || len(patterns) == 0 {
+		return content, err
+	}
+	delete(merged, includeKey)
+	for _, pattern := range patterns {
+		paths, err := includePaths(pattern, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			included, err := readInclude(path)
+			if err != nil {
+				return nil, err
+			}
+			mergeMaps(merged, included)
+		}
+	}
+	return yaml.Marshal(merged)
+}
+
+// includePatterns accepts single pattern or list of them
+func includePatterns(value interface{}) ([]string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{typed}, nil
+	case []interface{}:
+		patterns := make([]string, 0, len(typed))
+		for _, item := range typed {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s should list file patterns, got %v", includeKey, item)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	}
+	return nil, fmt.Errorf("%s should be file pattern or list of them, got %v", includeKey, value)
+}
+
+// includePaths lists sorted files matching pattern, pattern without
+// wildcards has to match existing file
+func includePaths(pattern, dir string) ([]string, error) {
+	if !filepath.IsAbs(pattern) && dir != "" {
+		pattern = filepath.Join(dir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %s", includeKey, pattern, err)
+	}
+	if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+		return nil, fmt.Errorf("included file %q does not exist", pattern)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func readInclude(path string) (map[interface{}]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if content, err = interpolate(content); err != nil {
+		return nil, fmt.Errorf("included file %q: %s", path, err)
+	}
+	included := make(map[interface{}]interface{})
+	if err = yaml.Unmarshal(content, &included); err != nil {
+		return nil, fmt.Errorf("included file %q: %s", path, err)
+	}
+	if _, nested := included[includeKey]; nested {
+		return nil, fmt.Errorf("included file %q: nested %s is not supported", path, includeKey)
+	}
+	return included, nil
+}
+
+// mergeMaps merges src into dst recursively
+func mergeMaps(dst, src map[interface{}]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[interface{}]interface{})
+		dstMap, dstIsMap := dst[key].(map[interface{}]interface{})
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
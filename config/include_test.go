@@ -0,0 +1,68 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "akubra-include")
+	require.NoError(t, err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestResolveIncludesShouldMergeFilesInOrder(t *testing.T) {
+	require.NoError(t, os.Setenv("AKUBRA_TEST_INCLUDED_BACKEND", "http://dc2:9000"))
+	defer func() { _ = os.Unsetenv("AKUBRA_TEST_INCLUDED_BACKEND") }()
+	dir := writeConfigFiles(t, map[string]string{
+		"conf.d/20-dc2.yaml": "Storages:\n  dc2:\n    Backend: ${AKUBRA_TEST_INCLUDED_BACKEND}\n",
+		"conf.d/10-dc1.yaml": "Storages:\n  dc1:\n    Backend: http://dc1:9000\n    Type: passthrough\n",
+		"overrides.yaml":     "Storages:\n  dc1:\n    Type: s3\nShards:\n  main: {}\n",
+	})
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	content, err := resolveIncludes([]byte("Include:\n  - conf.d/*.yaml\n  - overrides.yaml\nStorages:\n  dc1:\n    Maintenance: true\n"), dir)
+	require.NoError(t, err)
+
+	merged := make(map[string]interface{})
+	require.NoError(t, yaml.Unmarshal(content, &merged))
+	assert.Equal(t, map[string]interface{}{
+		"Storages": map[interface{}]interface{}{
+			"dc1": map[interface{}]interface{}{"Backend": "http://dc1:9000", "Type": "s3", "Maintenance": true},
+			"dc2": map[interface{}]interface{}{"Backend": "http://dc2:9000"},
+		},
+		"Shards": map[interface{}]interface{}{"main": map[interface{}]interface{}{}},
+	}, merged)
+}
+
+func TestResolveIncludesShouldKeepContentWithoutIncludes(t *testing.T) {
+	content := []byte("Storages: {}\n")
+
+	resolved, err := resolveIncludes(content, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, content, resolved)
+}
+
+func TestResolveIncludesShouldFailOnMissingOrNestedIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"nested.yaml": "Include: other.yaml\n"})
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	_, err := resolveIncludes([]byte("Include: missing.yaml\n"), dir)
+	assert.EqualError(t, err, `included file "`+filepath.Join(dir, "missing.yaml")+`" does not exist`)
+	_, err = resolveIncludes([]byte("Include: nested.yaml\n"), dir)
+	assert.EqualError(t, err, `included file "`+filepath.Join(dir, "nested.yaml")+`": nested Include is not supported`)
+	_, err = resolveIncludes([]byte("Include: empty.d/*.yaml\n"), dir)
+	assert.NoError(t, err)
+}
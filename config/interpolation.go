@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const filePrefix = "file://"
+
+// interpolationPattern matches ${REFERENCE} and escaped $${REFERENCE}
+var interpolationPattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// interpolate replaces ${ENV_VAR} references with environment variables values
+// and ${file:///path/to/secret} references with given file content (trailing
+// new lines are trimmed). $${...} is left as literal ${...}. References are
+// resolved in parsed scalar values, so resolved values can't change document
+// structure and references in comments are ignored. All unresolved
+// references are reported in single error.
+func interpolate(content []byte) ([]byte, error) {
+	var root interface{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return content, nil
+	}
+	unresolved := make([]string, 0)
+	root = interpolateNode(root, &unresolved)
+	if len(unresolved) > 0 {
+		return nil, fmt.Errorf("unresolved configuration references: %s", strings.Join(unresolved, ", "))
+	}
+	return yaml.Marshal(root)
+}
+
+// interpolateNode resolves references of string values of node recursively,
+// map keys are left as they are
+func interpolateNode(node interface{}, unresolved *[]string) interface{} {
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range typed {
+			typed[key] = interpolateNode(value, unresolved)
+		}
+	case []interface{}:
+		for i, value := range typed {
+			typed[i] = interpolateNode(value, unresolved)
+		}
+	case string:
+		return interpolateScalar(typed, unresolved)
+	}
+	return node
+}
+
+// interpolateScalar resolves references of value. Value being a single
+// reference to number or boolean keeps its type, so it may set numeric
+// fields, other values are strings
+func interpolateScalar(value string, unresolved *[]string) interface{} {
+	if !interpolationPattern.MatchString(value) {
+		return value
+	}
+	result := interpolationPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		reference := interpolationPattern.FindStringSubmatch(match)[1]
+		resolved, err := resolveReference(reference)
+		if err != nil {
+			*unresolved = append(*unresolved, err.Error())
+			return match
+		}
+		return resolved
+	})
+	if strings.HasPrefix(value, "$$") || interpolationPattern.FindString(value) != value {
+		return result
+	}
+	return typedScalar(result)
+}
+
+// typedScalar returns number or boolean represented by value, if value is
+// its canonical YAML form, value itself otherwise
+func typedScalar(value string) interface{} {
+	var typed interface{}
+	if err := yaml.Unmarshal([]byte(value), &typed); err != nil {
+		return value
+	}
+	switch typed.(type) {
+	case int, int64, uint64, float64, bool:
+		canonical, err := yaml.Marshal(typed)
+		if err == nil && strings.TrimSpace(string(canonical)) == value {
+			return typed
+		}
+	}
+	return value
+}
+
+func resolveReference(reference string) (string, error) {
+	if strings.HasPrefix(reference, filePrefix) {
+		path := strings.TrimPrefix(reference, filePrefix)
+		value, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read file %q: %s", path, err)
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+	if reference == "" {
+		return "", fmt.Errorf("empty reference")
+	}
+	value, ok := os.LookupEnv(reference)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q is not set", reference)
+	}
+	return value, nil
+}
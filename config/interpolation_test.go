@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func interpolatedValue(t *testing.T, content []byte, key string) interface{} {
+	values := make(map[string]interface{})
+	require.NoError(t, yaml.Unmarshal(content, &values))
+	return values[key]
+}
+
+func TestInterpolateShouldReplaceEnvironmentVariables(t *testing.T) {
+	require.NoError(t, os.Setenv("AKUBRA_TEST_SECRET", "s3cr3t"))
+	defer os.Unsetenv("AKUBRA_TEST_SECRET")
+
+	result, err := interpolate([]byte("Secret: ${AKUBRA_TEST_SECRET}"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", interpolatedValue(t, result, "Secret"))
+}
+
+func TestInterpolateShouldReplaceFileReferences(t *testing.T) {
+	secretFile, err := ioutil.TempFile("", "akubra-secret")
+	require.NoError(t, err)
+	defer os.Remove(secretFile.Name())
+	_, err = secretFile.WriteString("s3cr3t\n")
+	require.NoError(t, err)
+	require.NoError(t, secretFile.Close())
+
+	result, err := interpolate([]byte("Secret: ${file://" + secretFile.Name() + "}"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", interpolatedValue(t, result, "Secret"))
+}
+
+func TestInterpolateShouldKeepEscapedReferences(t *testing.T) {
+	result, err := interpolate([]byte("Value: $${NOT_INTERPOLATED}"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "${NOT_INTERPOLATED}", interpolatedValue(t, result, "Value"))
+}
+
+func TestInterpolateShouldReportAllUnresolvedReferences(t *testing.T) {
+	_, err := interpolate([]byte("A: ${AKUBRA_TEST_MISSING}\nB: ${file:///nonexistent/akubra/secret}"))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `environment variable "AKUBRA_TEST_MISSING" is not set`)
+	assert.Contains(t, err.Error(), `cannot read file "/nonexistent/akubra/secret"`)
+}
+
+func TestParseConfShouldInterpolateValues(t *testing.T) {
+	require.NoError(t, os.Setenv("AKUBRA_TEST_BACKEND", "http://127.0.0.1:9090"))
+	defer os.Unsetenv("AKUBRA_TEST_BACKEND")
+
+	conf, err := parseConf(bytes.NewBufferString("Storages:\n  default:\n    Backend: ${AKUBRA_TEST_BACKEND}\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:9090", conf.Storages["default"].Backend.Host)
+}
+
+func TestInterpolateShouldKeepStructureOfValuesWithYAMLSyntax(t *testing.T) {
+	for _, secret := range []string{"abc #def", "key: value", "*alias", "&anchor", "first\nsecond", "- item", "yes", "0755"} {
+		require.NoError(t, os.Setenv("AKUBRA_TEST_SECRET", secret))
+
+		result, err := interpolate([]byte("Secret: ${AKUBRA_TEST_SECRET}\nOther: value\n"))
+
+		require.NoError(t, err)
+		values := make(map[string]interface{})
+		require.NoError(t, yaml.Unmarshal(result, &values))
+		assert.Equal(t, map[string]interface{}{"Secret": secret, "Other": "value"}, values)
+	}
+	require.NoError(t, os.Unsetenv("AKUBRA_TEST_SECRET"))
+}
+
+func TestInterpolateShouldIgnoreReferencesInComments(t *testing.T) {
+	result, err := interpolate([]byte("# uses ${AKUBRA_TEST_MISSING}\nValue: plain # ${AKUBRA_TEST_MISSING}\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, "plain", interpolatedValue(t, result, "Value"))
+}
+
+func TestInterpolateShouldKeepTypeOfNumericReferences(t *testing.T) {
+	require.NoError(t, os.Setenv("AKUBRA_TEST_PORT", "8080"))
+	defer os.Unsetenv("AKUBRA_TEST_PORT")
+
+	result, err := interpolate([]byte("Port: ${AKUBRA_TEST_PORT}\nListen: :${AKUBRA_TEST_PORT}\n"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 8080, interpolatedValue(t, result, "Port"))
+	assert.Equal(t, ":8080", interpolatedValue(t, result, "Listen"))
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Override sets configuration value under key path, it's applied on top of
+// configuration files
+type Override struct {
+	Path  []string
+	Value interface{}
+}
+
+// ParseOverride parses "Dotted.Key.Path=value" expression, value is YAML,
+// so numbers, booleans and lists keep their types. Path segments index
+// lists if they're numbers, e.g. "Shards.cluster1.Storages.0.Name=dc1"
+func ParseOverride(expression string) (Override, error) {
+	parts := strings.SplitN(expression, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Override{}, fmt.Errorf("override %q should be key path and value separated with '='", expression)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(parts[1]), &value); err != nil {
+		return Override{}, fmt.Errorf("override of %s has invalid value: %s", parts[0], err)
+	}
+	return NewOverride(parts[0], value)
+}
+
+// NewOverride creates override of dotted key path
+func NewOverride(path string, value interface{}) (Override, error) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return Override{}, fmt.Errorf("override key path %q has empty segment", path)
+		}
+	}
+	return Override{Path: segments, Value: value}, nil
+}
+
+// applyOverrides sets values of overrides in content, in given order
+func applyOverrides(content []byte, overrides []Override) ([]byte, error) {
+	if len(overrides) == 0 {
+		return content, nil
+	}
+	var root interface{}
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		var err error
+		if root, err = setPath(root, override.Path, override.Value); err != nil {
+			return nil, fmt.Errorf("override of %s: %s", strings.Join(override.Path, "."), err)
+		}
+	}
+	return yaml.Marshal(root)
+}
+
+// setPath returns node with value set under path, missing maps are created
+func setPath(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch typed := node.(type) {
+	case nil:
+		return setPath(make(map[interface{}]interface{}), path, value)
+	case map[interface{}]interface{}:
+		child, err := setPath(typed[path[0]], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		typed[path[0]] = child
+		return typed, nil
+	case []interface{}:
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 || index >= len(typed) {
+			return nil, fmt.Errorf("%s is not index of list of %d items", path[0], len(typed))
+		}
+		if typed[index], err = setPath(typed[index], path[1:], value); err != nil {
+			return nil, err
+		}
+		return typed, nil
+	}
+	return nil, fmt.Errorf("%s can't be set in value %v", path[0], node)
+}
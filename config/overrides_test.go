@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestApplyOverridesShouldSetValuesUnderKeyPaths(t *testing.T) {
+	overrides := make([]Override, 0)
+	for _, expression := range []string{
+		"Service.Server.Listen=127.0.0.1:8080",
+		"Shards.main.Storages.1.Weight=2",
+		"Storages.dc1.Maintenance=true",
+		"Logging.SyncLogMethods=[PUT, DELETE]",
+	} {
+		override, err := ParseOverride(expression)
+		require.NoError(t, err)
+		overrides = append(overrides, override)
+	}
+	content := []byte("Service:\n  Server:\n    Listen: :80\nShards:\n  main:\n    Storages:\n      - Name: dc1\n      - Name: dc2\n")
+
+	content, err := applyOverrides(content, overrides)
+	require.NoError(t, err)
+
+	merged := make(map[string]interface{})
+	require.NoError(t, yaml.Unmarshal(content, &merged))
+	assert.Equal(t, map[string]interface{}{
+		"Service": map[interface{}]interface{}{"Server": map[interface{}]interface{}{"Listen": "127.0.0.1:8080"}},
+		"Shards": map[interface{}]interface{}{"main": map[interface{}]interface{}{"Storages": []interface{}{
+			map[interface{}]interface{}{"Name": "dc1"},
+			map[interface{}]interface{}{"Name": "dc2", "Weight": 2},
+		}}},
+		"Storages": map[interface{}]interface{}{"dc1": map[interface{}]interface{}{"Maintenance": true}},
+		"Logging":  map[interface{}]interface{}{"SyncLogMethods": []interface{}{"PUT", "DELETE"}},
+	}, merged)
+}
+
+func TestApplyOverridesShouldFailOnInvalidPaths(t *testing.T) {
+	_, err := ParseOverride("Service.Server.Listen")
+	assert.EqualError(t, err, `override "Service.Server.Listen" should be key path and value separated with '='`)
+	_, err = ParseOverride("Service..Listen=:80")
+	assert.EqualError(t, err, `override key path "Service..Listen" has empty segment`)
+
+	override, err := ParseOverride("Shards.main.Storages.2.Weight=2")
+	require.NoError(t, err)
+	_, err = applyOverrides([]byte("Shards:\n  main:\n    Storages:\n      - Name: dc1\n"), []Override{override})
+	assert.EqualError(t, err, "override of Shards.main.Storages.2.Weight: 2 is not index of list of 1 items")
+}
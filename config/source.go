@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	consulScheme = "consul"
+	etcdScheme   = "etcd"
+	s3Scheme     = "s3"
+	fileScheme   = "file"
+
+	remoteSourceRequestTimeout = 5 * time.Second
+	// redacted replaces credentials in locations of sources
+	redacted = "REDACTED"
+)
+
+// Source provides raw configuration content
+type Source interface {
+	// Read returns current configuration content
+	Read() ([]byte, error)
+	// String returns human readable source location without credentials
+	String() string
+}
+
+// NewSource creates Source for given location. Location can be a file path
+// or one of:
+//
+//	consul://host:port/path/to/key[?token=TOKEN]
+//	etcd://host:port/path/to/key
+//	s3://bucket/path/to/key?endpoint=http://host:port
+//
+// S3 requests are signed if AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+// environment variables are set.
+func NewSource(location string) (Source, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Scheme == "" {
+		return fileSource{path: location}, nil
+	}
+	switch parsed.Scheme {
+	case fileScheme:
+		return fileSource{path: parsed.Path}, nil
+	case consulScheme:
+		return newConsulSource(parsed)
+	case etcdScheme:
+		return newEtcdSource(parsed)
+	case s3Scheme:
+		return newS3Source(parsed)
+	}
+	return nil, fmt.Errorf("unsupported configuration source scheme %q", parsed.Scheme)
+}
+
+type fileSource struct {
+	path string
+}
+
+func (fs fileSource) Read() ([]byte, error) {
+	return ioutil.ReadFile(fs.path)
+}
+
+func (fs fileSource) String() string {
+	return fs.path
+}
+
+// includeDir is directory relative Include patterns of source are resolved
+// against, working directory is used for remote sources
+func includeDir(source Source) string {
+	if fs, ok := source.(fileSource); ok {
+		return filepath.Dir(fs.path)
+	}
+	return ""
+}
+
+// redactedLocation returns location with password and query params other
+// than S3 endpoint, which may carry tokens, replaced, so it may be logged
+func redactedLocation(location *url.URL) string {
+	safe := *location
+	if location.User != nil {
+		if _, hasPassword := location.User.Password(); hasPassword {
+			safe.User = url.UserPassword(location.User.Username(), redacted)
+		}
+	}
+	query := location.Query()
+	for name := range query {
+		if name != "endpoint" {
+			query.Set(name, redacted)
+		}
+	}
+	safe.RawQuery = query.Encode()
+	return safe.String()
+}
+
+type consulSource struct {
+	kv       *api.KV
+	key      string
+	location string
+}
+
+func newConsulSource(location *url.URL) (Source, error) {
+	consulConfig := api.DefaultConfig()
+	consulConfig.Address = location.Host
+	consulConfig.Token = location.Query().Get("token")
+	consulConfig.HttpClient = &http.Client{Timeout: remoteSourceRequestTimeout}
+	client, err := api.NewClient(consulConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Consul client: %s", err)
+	}
+	return consulSource{
+		kv:       client.KV(),
+		key:      strings.TrimPrefix(location.Path, "/"),
+		location: redactedLocation(location),
+	}, nil
+}
+
+func (cs consulSource) Read() ([]byte, error) {
+	pair, _, err := cs.kv.Get(cs.key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, fmt.Errorf("no such key %q in consul", cs.key)
+	}
+	return pair.Value, nil
+}
+
+func (cs consulSource) String() string {
+	return cs.location
+}
+
+type etcdSource struct {
+	client   *http.Client
+	endpoint string
+	key      string
+	location string
+}
+
+type etcdRangeResponse struct {
+	Kvs []struct {
+		Value string `json:"value"`
+	} `json:"kvs"`
+}
+
+func newEtcdSource(location *url.URL) (Source, error) {
+	if location.Path == "" || location.Path == "/" {
+		return nil, fmt.Errorf("no etcd key given in %q", redactedLocation(location))
+	}
+	return etcdSource{
+		client:   &http.Client{Timeout: remoteSourceRequestTimeout},
+		endpoint: fmt.Sprintf("http://%s/v3/kv/range", location.Host),
+		key:      location.Path,
+		location: redactedLocation(location),
+	}, nil
+}
+
+// Read uses etcd v3 grpc-gateway JSON API
+func (es etcdSource) Read() ([]byte, error) {
+	payload, err := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(es.key))})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := es.client.Post(es.endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	body, err := readRemoteBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	rangeResponse := etcdRangeResponse{}
+	if err = json.Unmarshal(body, &rangeResponse); err != nil {
+		return nil, fmt.Errorf("unable to parse etcd response: %s", err)
+	}
+	if len(rangeResponse.Kvs) == 0 {
+		return nil, fmt.Errorf("no such key %q in etcd", es.key)
+	}
+	return base64.StdEncoding.DecodeString(rangeResponse.Kvs[0].Value)
+}
+
+func (es etcdSource) String() string {
+	return es.location
+}
+
+type s3Source struct {
+	client    *http.Client
+	objectURL string
+	location  string
+}
+
+func newS3Source(location *url.URL) (Source, error) {
+	endpoint := location.Query().Get("endpoint")
+	if endpoint == "" {
+		return nil, fmt.Errorf("no endpoint query param given in %q", redactedLocation(location))
+	}
+	return s3Source{
+		client:    &http.Client{Timeout: remoteSourceRequestTimeout},
+		objectURL: strings.TrimSuffix(endpoint, "/") + "/" + location.Host + location.Path,
+		location:  redactedLocation(location),
+	}, nil
+}
+
+func (ss s3Source) Read() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, ss.objectURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey != "" && secretKey != "" {
+		req = s3signer.SignV2(*req, accessKey, secretKey)
+	}
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readRemoteBody(resp)
+}
+
+func (ss s3Source) String() string {
+	return ss.location
+}
+
+func readRemoteBody(resp *http.Response) ([]byte, error) {
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Debugf("Cannot close configuration source response body: %s", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("configuration source responded with status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// WatchSource polls source every interval and calls onChange if content has changed.
+// Returned channel stops watching when closed.
+func WatchSource(source Source, interval time.Duration, onChange func()) chan<- struct{} {
+	stop := make(chan struct{})
+	lastChecksum := sourceChecksum(source)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				checksum := sourceChecksum(source)
+				if checksum == nil || bytes.Equal(checksum, lastChecksum) {
+					continue
+				}
+				log.Printf("Configuration source %s changed", source)
+				lastChecksum = checksum
+				onChange()
+			}
+		}
+	}()
+	return stop
+}
+
+func sourceChecksum(source Source) []byte {
+	content, err := source.Read()
+	if err != nil {
+		log.Printf("Cannot read configuration source %s: %s", source, err)
+		return nil
+	}
+	checksum := sha256.Sum256(content)
+	return checksum[:]
+}
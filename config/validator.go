@@ -1,17 +1,42 @@
 package config
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"net/http"
 
+	compressionconfig "github.com/allegro/akubra/compression/config"
+	concurrencyconfig "github.com/allegro/akubra/concurrency/config"
+	corsconfig "github.com/allegro/akubra/cors/config"
+	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	encryptionconfig "github.com/allegro/akubra/encryption/config"
+	"github.com/allegro/akubra/hooks"
+	inventoryconfig "github.com/allegro/akubra/inventory/config"
+	"github.com/allegro/akubra/log"
+	logconfig "github.com/allegro/akubra/log/config"
+	"github.com/allegro/akubra/netacl"
+	notificationsconfig "github.com/allegro/akubra/notifications/config"
 	confregions "github.com/allegro/akubra/regions/config"
+	"github.com/allegro/akubra/storages/auth"
+	storages "github.com/allegro/akubra/storages/config"
+	transportconfig "github.com/allegro/akubra/transport/config"
+	usageconfig "github.com/allegro/akubra/usage/config"
 	set "github.com/deckarep/golang-set"
+	"gopkg.in/validator.v1"
 )
 
+// endpointDialTimeout limits time spent on each endpoint reachability check
+const endpointDialTimeout = 2 * time.Second
+
 // NoEmptyValuesInSliceValidator for strings in slice
 func NoEmptyValuesInSliceValidator(v interface{}, param string) error {
 	val := reflect.ValueOf(v)
@@ -66,20 +91,104 @@ func (c *YamlConfig) validateRegionCluster(policyName string, policies confregio
 		errList = append(errList, fmt.Errorf("No shards defined for policy \"%s\"", policyName))
 	}
 
+	weightsSum := 0
+	seenShards := set.NewSet()
 	for _, policy := range policies.Shards {
-		fmt.Printf("sharding policies %v\n", c.Shards)
 		_, exists := c.Shards[policy.ShardName]
 		if !exists {
 			errList = append(errList, fmt.Errorf("Shard \"%s\" in policy \"%s\" is not defined", policy.ShardName, policyName))
 		}
+		if !seenShards.Add(policy.ShardName) {
+			errList = append(errList, fmt.Errorf("Shard \"%s\" is duplicated in policy \"%s\"", policy.ShardName, policyName))
+		}
 		if policy.Weight < 0 || policy.Weight > 1 {
 			errList = append(errList, fmt.Errorf("Weight for shard \"%s\" in policy \"%s\" is not valid", policy.ShardName, policyName))
+			continue
+		}
+		if !policy.Drained {
+			weightsSum += int(math.Floor(policy.Weight * 100))
 		}
 	}
+	if len(policies.Shards) > 0 && weightsSum == 0 {
+		errList = append(errList, fmt.Errorf("Weights sum for policy \"%s\" is zero", policyName))
+	}
 
 	if len(policies.Domains) == 0 {
 		errList = append(errList, fmt.Errorf("No domain defined for policy \"%s\"", policyName))
 	}
+	if canary := policies.Canary; canary != nil {
+		if _, exists := c.Shards[canary.ShardName]; !exists {
+			errList = append(errList, fmt.Errorf("Canary shard \"%s\" in policy \"%s\" is not defined", canary.ShardName, policyName))
+		}
+		if seenShards.Contains(canary.ShardName) {
+			errList = append(errList, fmt.Errorf("Canary shard \"%s\" is already in shards of policy \"%s\"", canary.ShardName, policyName))
+		}
+		if canary.Percentage < 0 || canary.Percentage > 100 {
+			errList = append(errList, fmt.Errorf("Canary percentage in policy \"%s\" should be in range [0, 100]", policyName))
+		}
+	}
+	for _, rule := range policies.Replication {
+		if _, exists := c.ShardingPolicies[rule.Region]; !exists || rule.Region == policyName {
+			errList = append(errList, fmt.Errorf("Replication region \"%s\" of policy \"%s\" is not valid", rule.Region, policyName))
+		}
+	}
+	if failover := policies.FailoverRegion; failover != "" {
+		if _, exists := c.ShardingPolicies[failover]; !exists || failover == policyName {
+			errList = append(errList, fmt.Errorf("Failover region \"%s\" of policy \"%s\" is not valid", failover, policyName))
+		}
+	}
+	if policies.DrainConcurrency < 0 {
+		errList = append(errList, fmt.Errorf("Drain concurrency in policy \"%s\" should not be negative", policyName))
+	}
+	if boundedLoad := policies.BoundedLoad; boundedLoad != nil && boundedLoad.Factor <= 1 {
+		errList = append(errList, fmt.Errorf("Bounded load factor in policy \"%s\" should be greater than 1", policyName))
+	}
+	errList = append(errList, c.validateKeyPrefixes(policyName, policies.KeyPrefixes)...)
+	return errList
+}
+
+func (c *YamlConfig) validateKeyPrefixes(policyName string, keyPrefixes []confregions.KeyPrefix) []error {
+	errList := make([]error, 0)
+	seenPrefixes := make(map[string]bool, len(keyPrefixes))
+	for _, keyPrefix := range keyPrefixes {
+		if _, exists := c.Shards[keyPrefix.ShardName]; !exists {
+			errList = append(errList, fmt.Errorf("Key prefix shard \"%s\" in policy \"%s\" is not defined", keyPrefix.ShardName, policyName))
+		}
+		if keyPrefix.Bucket == "" || strings.Contains(keyPrefix.Bucket, "/") || keyPrefix.Prefix == "" {
+			errList = append(errList, fmt.Errorf("Key prefix \"%s\" of bucket \"%s\" in policy \"%s\" is not valid", keyPrefix.Prefix, keyPrefix.Bucket, policyName))
+			continue
+		}
+		path := keyPrefix.Bucket + "/" + keyPrefix.Prefix
+		if seenPrefixes[path] {
+			errList = append(errList, fmt.Errorf("Key prefix \"%s\" of bucket \"%s\" is duplicated in policy \"%s\"", keyPrefix.Prefix, keyPrefix.Bucket, policyName))
+		}
+		seenPrefixes[path] = true
+	}
+	return errList
+}
+
+// validateRegionBuckets checks that each bucket is mapped to one region
+func (c *YamlConfig) validateRegionBuckets() []error {
+	errList := make([]error, 0)
+	regionNames := make([]string, 0, len(c.ShardingPolicies))
+	for regionName := range c.ShardingPolicies {
+		regionNames = append(regionNames, regionName)
+	}
+	sort.Strings(regionNames)
+	bucketRegions := make(map[string]string)
+	for _, regionName := range regionNames {
+		for _, bucket := range c.ShardingPolicies[regionName].Buckets {
+			if bucket == "" || strings.Contains(bucket, "/") {
+				errList = append(errList, fmt.Errorf("Bucket \"%s\" in policy \"%s\" is not valid", bucket, regionName))
+				continue
+			}
+			if other, exists := bucketRegions[bucket]; exists {
+				errList = append(errList, fmt.Errorf("Bucket \"%s\" is mapped to policies \"%s\" and \"%s\"", bucket, other, regionName))
+				continue
+			}
+			bucketRegions[bucket] = regionName
+		}
+	}
 	return errList
 }
 
@@ -92,6 +201,7 @@ func (c *YamlConfig) RegionsEntryLogicalValidator() (valid bool, validationError
 	for regionName, regionConf := range c.ShardingPolicies {
 		errList = append(errList, c.validateRegionCluster(regionName, regionConf)...)
 	}
+	errList = append(errList, c.validateRegionBuckets()...)
 	validationErrors, valid = prepareErrors(errList, "RegionsEntryLogicalValidator")
 	return
 }
@@ -120,6 +230,10 @@ func (c *YamlConfig) ListenPortsLogicalValidator() (valid bool, validationErrors
 	listenParts := strings.Split(c.Service.Server.Listen, ":")
 	listenTechnicalParts := strings.Split(c.Service.Server.TechnicalEndpointListen, ":")
 	valid = true
+	if len(listenParts) < 2 || len(listenTechnicalParts) < 2 {
+		// malformed addresses are reported by schema validation
+		return valid, errorsList
+	}
 	if listenParts[0] == listenTechnicalParts[0] && listenParts[1] == listenTechnicalParts[1] {
 		valid = false
 		errorDetail := []error{errors.New("Listen and TechnicalEndpointListen has the same port")}
@@ -128,6 +242,926 @@ func (c *YamlConfig) ListenPortsLogicalValidator() (valid bool, validationErrors
 	return valid, errorsList
 }
 
+// StoragesEntryLogicalValidator checks the correctness of "Storages" part of configuration file
+func (c *YamlConfig) StoragesEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if len(c.Storages) == 0 {
+		errList = append(errList, errors.New("Empty storages definition"))
+	}
+	backends := make(map[string]string)
+	for _, storageName := range c.sortedStorageNames() {
+		storage := c.Storages[storageName]
+		if storage.Backend.URL == nil || storage.Backend.Host == "" {
+			errList = append(errList, fmt.Errorf("No backend defined for storage \"%s\"", storageName))
+			continue
+		}
+		if _, ok := auth.Decorators[storage.Type]; !ok {
+			errList = append(errList, fmt.Errorf("Unknown type \"%s\" for storage \"%s\"", storage.Type, storageName))
+		}
+		if otherName, ok := backends[backendIdentity(storage)]; ok {
+			errList = append(errList, fmt.Errorf("Storages \"%s\" and \"%s\" share the same backend \"%s\"", otherName, storageName, storage.Backend))
+		}
+		backends[backendIdentity(storage)] = storageName
+		if storage.TLS != nil && storage.Backend.Scheme != "https" {
+			errList = append(errList, fmt.Errorf("TLS defined for storage \"%s\" with non https backend", storageName))
+		}
+		if err := validateHTTP2Mode(storage.HTTP2, storage.Backend.Scheme); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": %s", storageName, err))
+		}
+		if err := validateAddressingStyle(storage); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": %s", storageName, err))
+		}
+		if err := validateCapabilities(storage.Capabilities); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": %s", storageName, err))
+		}
+		if err := validateSSE(storage); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": %s", storageName, err))
+		}
+		if queue := storage.Queue; queue != nil && (queue.Workers <= 0 || queue.Size < 0 || queue.Timeout.Duration < 0) {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": Queue Workers should be positive, Size and Timeout cannot be negative", storageName))
+		}
+		if err := validateFaults(storage.Faults); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\": %s", storageName, err))
+		}
+		if storage.Type == auth.S3AuthService {
+			endpoint, ok := storage.Properties["AuthServiceEndpoint"]
+			if !ok {
+				endpoint = "default"
+			}
+			if _, exists := c.CredentialsStore[endpoint]; !exists {
+				errList = append(errList, fmt.Errorf("Credentials store \"%s\" for storage \"%s\" is not defined", endpoint, storageName))
+			}
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "StoragesEntryLogicalValidator")
+	return
+}
+
+func validateAddressingStyle(storage storages.Storage) error {
+	switch storage.AddressingStyle {
+	case "", storages.PathStyle:
+		return nil
+	case storages.PreserveStyle:
+		if storage.Type != storages.Passthrough {
+			return fmt.Errorf("AddressingStyle \"%s\" requires %s type, other types sign requests for backend host", storage.AddressingStyle, storages.Passthrough)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported AddressingStyle \"%s\"", storage.AddressingStyle)
+}
+
+func validateCapabilities(capabilities map[string]bool) error {
+	for capability := range capabilities {
+		known := false
+		for _, knownCapability := range storages.KnownCapabilities {
+			known = known || capability == knownCapability
+		}
+		if !known {
+			return fmt.Errorf("unknown capability \"%s\", known capabilities: %s", capability, strings.Join(storages.KnownCapabilities, ", "))
+		}
+	}
+	return nil
+}
+
+func validateSSE(storage storages.Storage) error {
+	sse := storage.SSE
+	if sse == nil {
+		return nil
+	}
+	if storage.Type == storages.Passthrough {
+		return fmt.Errorf("SSE cannot be managed for %s type, changed headers would break client signatures", storages.Passthrough)
+	}
+	switch sse.Inject {
+	case "", storages.SSEAES256, storages.SSEKMS:
+	default:
+		return fmt.Errorf("unsupported SSE Inject algorithm \"%s\"", sse.Inject)
+	}
+	if sse.Inject != "" && sse.Strip {
+		return errors.New("SSE Inject and Strip are exclusive")
+	}
+	if sse.KMSKeyID != "" && sse.Inject != storages.SSEKMS {
+		return fmt.Errorf("SSE KMSKeyID requires Inject \"%s\"", storages.SSEKMS)
+	}
+	return nil
+}
+
+func validateFaults(faults []storages.Fault) error {
+	total := 0.0
+	for i, fault := range faults {
+		if fault.Percentage <= 0 || fault.Percentage > 100 {
+			return fmt.Errorf("Fault %d Percentage should be in (0, 100] range", i+1)
+		}
+		total += fault.Percentage
+		if fault.Latency.Duration < 0 {
+			return fmt.Errorf("Fault %d Latency cannot be negative", i+1)
+		}
+		if fault.Status != 0 && (fault.Status < http.StatusInternalServerError || fault.Status > 599) {
+			return fmt.Errorf("Fault %d Status should be 5xx", i+1)
+		}
+		if fault.Status != 0 && fault.Reset {
+			return fmt.Errorf("Fault %d Status and Reset are exclusive", i+1)
+		}
+		if fault.Latency.Duration == 0 && fault.Status == 0 && !fault.Reset {
+			return fmt.Errorf("Fault %d should define Latency, Status or Reset", i+1)
+		}
+	}
+	if total > 100 {
+		return errors.New("Faults Percentage should sum up to 100 at most")
+	}
+	return nil
+}
+
+func validateHTTP2Mode(mode, scheme string) error {
+	switch {
+	case mode == "":
+		return nil
+	case mode == transportconfig.HTTP2 && scheme != "https":
+		return fmt.Errorf("HTTP2 mode \"%s\" requires https backend", mode)
+	case mode == transportconfig.HTTP2Cleartext && scheme != "http":
+		return fmt.Errorf("HTTP2 mode \"%s\" requires http backend", mode)
+	case mode != transportconfig.HTTP2 && mode != transportconfig.HTTP2Cleartext:
+		return fmt.Errorf("unsupported HTTP2 mode \"%s\"", mode)
+	}
+	return nil
+}
+
+// backendIdentity distinguishes storages by backend, type and properties, so
+// storages of one endpoint with different credentials aren't duplicates
+func backendIdentity(storage storages.Storage) string {
+	properties := make([]string, 0, len(storage.Properties))
+	for name, value := range storage.Properties {
+		properties = append(properties, name+"="+value)
+	}
+	sort.Strings(properties)
+	return fmt.Sprintf("%s %s %s", storage.Backend, storage.Type, strings.Join(properties, ","))
+}
+
+// ShardsEntryLogicalValidator checks the correctness of "Shards" part of configuration file
+func (c *YamlConfig) ShardsEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if len(c.Shards) == 0 {
+		errList = append(errList, errors.New("Empty shards definition"))
+	}
+	shardNames := make([]string, 0, len(c.Shards))
+	for shardName := range c.Shards {
+		shardNames = append(shardNames, shardName)
+	}
+	sort.Strings(shardNames)
+	for _, shardName := range shardNames {
+		shard := c.Shards[shardName]
+		if len(shard.Storages) == 0 {
+			errList = append(errList, fmt.Errorf("No storages defined for shard \"%s\"", shardName))
+		}
+		if shard.BodyMode != "" && shard.BodyMode != storages.SpoolBody && shard.BodyMode != storages.StreamBody {
+			errList = append(errList, fmt.Errorf("Unsupported BodyMode \"%s\" for shard \"%s\"", shard.BodyMode, shardName))
+		}
+		errList = append(errList, validateMethodPolicies(shardName, shard.MethodPolicies)...)
+		errList = append(errList, validateBucketAliases(shardName, shard.BucketAliases)...)
+		seenStorages := set.NewSet()
+		primaries := 0
+		for _, storage := range shard.Storages {
+			if !c.Storages[storage.Name].Shadow {
+				primaries++
+			}
+			if _, exists := c.Storages[storage.Name]; !exists {
+				errList = append(errList, fmt.Errorf("Storage \"%s\" in shard \"%s\" is not defined", storage.Name, shardName))
+			}
+			if !seenStorages.Add(storage.Name) {
+				errList = append(errList, fmt.Errorf("Storage \"%s\" is duplicated in shard \"%s\"", storage.Name, shardName))
+			}
+			if storage.Weight < 0 {
+				errList = append(errList, fmt.Errorf("Negative Weight of storage \"%s\" in shard \"%s\"", storage.Name, shardName))
+			}
+		}
+		if len(shard.Storages) > 0 && primaries == 0 {
+			errList = append(errList, fmt.Errorf("Only shadow storages defined for shard \"%s\"", shardName))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "ShardsEntryLogicalValidator")
+	return
+}
+
+func validateMethodPolicies(shardName string, policies map[string]string) []error {
+	errList := make([]error, 0)
+	methods := make([]string, 0, len(policies))
+	for method := range policies {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		allowed, known := storages.AllowedMethodPolicies[method]
+		if !known {
+			errList = append(errList, fmt.Errorf("Unsupported method \"%s\" in MethodPolicies of shard \"%s\"", method, shardName))
+			continue
+		}
+		supported := false
+		for _, policy := range allowed {
+			supported = supported || policies[method] == policy
+		}
+		if !supported {
+			errList = append(errList, fmt.Errorf("Unsupported policy \"%s\" for method \"%s\" of shard \"%s\", allowed: %s",
+				policies[method], method, shardName, strings.Join(allowed, ", ")))
+		}
+	}
+	return errList
+}
+
+// validateBucketAliases checks that backend bucket names are valid and
+// unique, so they can be mapped back to client bucket names
+func validateBucketAliases(shardName string, aliases map[string]string) []error {
+	errList := make([]error, 0)
+	buckets := make([]string, 0, len(aliases))
+	for bucket := range aliases {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	aliasedBy := make(map[string]string, len(aliases))
+	for _, bucket := range buckets {
+		internal := aliases[bucket]
+		if internal == "" || strings.Contains(internal, "/") {
+			errList = append(errList, fmt.Errorf("Invalid alias \"%s\" of bucket \"%s\" in shard \"%s\"", internal, bucket, shardName))
+			continue
+		}
+		if other, exists := aliasedBy[internal]; exists {
+			errList = append(errList, fmt.Errorf("Buckets \"%s\" and \"%s\" have the same alias \"%s\" in shard \"%s\"", other, bucket, internal, shardName))
+		}
+		aliasedBy[internal] = bucket
+	}
+	return errList
+}
+
+// ConcurrencyLimitsEntryLogicalValidator checks the correctness of "ConcurrencyLimits" part of configuration file
+func (c *YamlConfig) ConcurrencyLimitsEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if global := c.ConcurrencyLimits.Global; global != nil {
+		errList = append(errList, validateConcurrencyLimit("global", *global)...)
+	}
+	shardNames := make([]string, 0, len(c.ConcurrencyLimits.Shards))
+	for shardName := range c.ConcurrencyLimits.Shards {
+		shardNames = append(shardNames, shardName)
+	}
+	sort.Strings(shardNames)
+	for _, shardName := range shardNames {
+		if _, exists := c.Shards[shardName]; !exists {
+			errList = append(errList, fmt.Errorf("Concurrency limit defined for unknown shard \"%s\"", shardName))
+		}
+		errList = append(errList, validateConcurrencyLimit(fmt.Sprintf("shard \"%s\"", shardName), c.ConcurrencyLimits.Shards[shardName])...)
+	}
+	validationErrors, valid = prepareErrors(errList, "ConcurrencyLimitsEntryLogicalValidator")
+	return
+}
+
+func validateConcurrencyLimit(name string, limit concurrencyconfig.Limit) []error {
+	errList := make([]error, 0)
+	if limit.MaxInFlight <= 0 {
+		errList = append(errList, fmt.Errorf("MaxInFlight of %s concurrency limit should be positive", name))
+	}
+	if limit.MaxQueued < 0 || limit.QueueTimeout.Duration < 0 {
+		errList = append(errList, fmt.Errorf("MaxQueued and QueueTimeout of %s concurrency limit cannot be negative", name))
+	}
+	return errList
+}
+
+// MirroringEntryLogicalValidator checks the correctness of "Mirroring" part of configuration file
+func (c *YamlConfig) MirroringEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if c.Mirroring.Shard != "" {
+		if _, exists := c.Shards[c.Mirroring.Shard]; !exists {
+			errList = append(errList, fmt.Errorf("Mirroring defined for unknown shard \"%s\"", c.Mirroring.Shard))
+		}
+		if c.Mirroring.Percentage <= 0 || c.Mirroring.Percentage > 100 {
+			errList = append(errList, fmt.Errorf("Mirroring Percentage should be in range (0, 100], got %v", c.Mirroring.Percentage))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "MirroringEntryLogicalValidator")
+	return
+}
+
+// InventoryEntryLogicalValidator checks the correctness of "Inventory" part of configuration file
+func (c *YamlConfig) InventoryEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if c.Inventory.Shard != "" {
+		if _, exists := c.Shards[c.Inventory.Shard]; !exists {
+			errList = append(errList, fmt.Errorf("Inventory defined for unknown shard \"%s\"", c.Inventory.Shard))
+		}
+		if c.Inventory.Interval.Duration <= 0 {
+			errList = append(errList, errors.New("Inventory Interval should be positive"))
+		}
+		if c.Inventory.Format != "" && c.Inventory.Format != inventoryconfig.CSV {
+			errList = append(errList, fmt.Errorf("Unsupported inventory Format \"%s\", supported: %s", c.Inventory.Format, inventoryconfig.CSV))
+		}
+		if c.Inventory.Path == "" && c.Inventory.Bucket == "" {
+			errList = append(errList, errors.New("Inventory needs Path or Bucket reports are written to"))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "InventoryEntryLogicalValidator")
+	return
+}
+
+// CacheEntryLogicalValidator checks the correctness of "Cache" part of configuration file
+func (c *YamlConfig) CacheEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if c.Cache.MaxSize.SizeInBytes > 0 {
+		if c.Cache.TTL.Duration <= 0 {
+			errList = append(errList, errors.New("Cache TTL should be positive"))
+		}
+		if c.Cache.DiskPath != "" && c.Cache.DiskMaxSize.SizeInBytes <= 0 {
+			errList = append(errList, errors.New("Cache DiskMaxSize should be positive when DiskPath is defined"))
+		}
+		if c.Service.Server.AuthServiceEndpoint == "" {
+			errList = append(errList, errors.New("Cache requires Service.Server.AuthServiceEndpoint, responses are cached per verified access key"))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "CacheEntryLogicalValidator")
+	return
+}
+
+// CompressionEntryLogicalValidator checks the correctness of "Compression" part of configuration file
+func (c *YamlConfig) CompressionEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	maxLevels := map[string]int{"": 9, compressionconfig.Gzip: 9, compressionconfig.Zstd: 22}
+	maxLevel, supported := maxLevels[strings.ToLower(c.Compression.Algorithm)]
+	if !supported {
+		errList = append(errList, fmt.Errorf("Unsupported compression Algorithm \"%s\", supported: %s, %s",
+			c.Compression.Algorithm, compressionconfig.Gzip, compressionconfig.Zstd))
+	}
+	if supported && (c.Compression.Level < 0 || c.Compression.Level > maxLevel) {
+		errList = append(errList, fmt.Errorf("Compression Level should be in range [1, %d] or 0 for default, got %d",
+			maxLevel, c.Compression.Level))
+	}
+	validationErrors, valid = prepareErrors(errList, "CompressionEntryLogicalValidator")
+	return
+}
+
+// CORSEntryLogicalValidator checks the correctness of "CORS" part of configuration file
+func (c *YamlConfig) CORSEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if c.CORS.Global != nil {
+		errList = append(errList, validateCORSRule("Global CORS rule", *c.CORS.Global)...)
+	}
+	for bucket, rule := range c.CORS.Buckets {
+		errList = append(errList, validateCORSRule(fmt.Sprintf("CORS rule of bucket \"%s\"", bucket), rule)...)
+	}
+	validationErrors, valid = prepareErrors(errList, "CORSEntryLogicalValidator")
+	return
+}
+
+func validateCORSRule(name string, rule corsconfig.Rule) []error {
+	errList := make([]error, 0)
+	if len(rule.AllowedOrigins) == 0 {
+		errList = append(errList, fmt.Errorf("%s has no AllowedOrigins", name))
+	}
+	if len(rule.AllowedMethods) == 0 {
+		errList = append(errList, fmt.Errorf("%s has no AllowedMethods", name))
+	}
+	for _, method := range rule.AllowedMethods {
+		allowed := false
+		for _, allowedMethod := range corsconfig.AllowedMethods {
+			if method == allowedMethod {
+				allowed = true
+			}
+		}
+		if !allowed {
+			errList = append(errList, fmt.Errorf("%s has unsupported method \"%s\", supported: %s", name, method, strings.Join(corsconfig.AllowedMethods, ", ")))
+		}
+	}
+	for _, pattern := range append(append([]string{}, rule.AllowedOrigins...), rule.AllowedHeaders...) {
+		if strings.Count(pattern, "*") > 1 {
+			errList = append(errList, fmt.Errorf("%s pattern \"%s\" may contain one wildcard only", name, pattern))
+		}
+	}
+	return errList
+}
+
+// EncryptionEntryLogicalValidator checks the correctness of "Encryption" part of configuration file
+func (c *YamlConfig) EncryptionEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	encryption := c.Encryption
+	switch encryption.KeyProvider {
+	case "":
+	case encryptionconfig.StaticKeys:
+		if _, exists := encryption.MasterKeys[encryption.MasterKeyID]; !exists {
+			errList = append(errList, fmt.Errorf("Master key \"%s\" is not defined", encryption.MasterKeyID))
+		}
+		for _, id := range c.sortedMasterKeyIDs() {
+			if key, err := base64.StdEncoding.DecodeString(encryption.MasterKeys[id]); err != nil || len(key) != 32 {
+				errList = append(errList, fmt.Errorf("Master key \"%s\" should be base64 encoded 32 bytes key", id))
+			}
+		}
+	case encryptionconfig.VaultTransit:
+		vault := encryption.Vault
+		if vault == nil || vault.Endpoint.URL == nil || vault.Endpoint.Host == "" {
+			errList = append(errList, errors.New("No Vault Endpoint defined for encryption"))
+		} else if vault.KeyName == "" || (vault.Token == "" && vault.TokenFile == "") {
+			errList = append(errList, errors.New("Vault KeyName and Token or TokenFile are required for encryption"))
+		}
+	default:
+		errList = append(errList, fmt.Errorf("Unsupported encryption KeyProvider \"%s\", supported: %s, %s",
+			encryption.KeyProvider, encryptionconfig.StaticKeys, encryptionconfig.VaultTransit))
+	}
+	if encryption.KeyProvider != "" && c.Service.Server.AuthServiceEndpoint == "" {
+		errList = append(errList, errors.New("Encryption requires Service.Server.AuthServiceEndpoint, signatures are verified before uploads are encrypted"))
+	}
+	validationErrors, valid = prepareErrors(errList, "EncryptionEntryLogicalValidator")
+	return
+}
+
+// UsageEntryLogicalValidator checks the correctness of "Usage" part of configuration file
+func (c *YamlConfig) UsageEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	usage := c.Usage
+	switch usage.Sink {
+	case "":
+	case usageconfig.File:
+		if usage.Path == "" {
+			errList = append(errList, errors.New("Usage Path is required for file sink"))
+		}
+	case usageconfig.Statsd:
+		if _, _, err := net.SplitHostPort(usage.Addr); err != nil {
+			errList = append(errList, fmt.Errorf("Usage Addr \"%s\" of statsd sink is not valid", usage.Addr))
+		}
+	case usageconfig.KafkaREST:
+		if usage.Endpoint.URL == nil || usage.Endpoint.Host == "" || usage.Topic == "" {
+			errList = append(errList, errors.New("Usage Endpoint and Topic are required for kafka-rest sink"))
+		}
+	default:
+		errList = append(errList, fmt.Errorf("Unsupported usage Sink \"%s\", supported: %s, %s, %s",
+			usage.Sink, usageconfig.File, usageconfig.Statsd, usageconfig.KafkaREST))
+	}
+	if usage.Interval.Duration < 0 {
+		errList = append(errList, errors.New("Usage Interval should be positive"))
+	}
+	validationErrors, valid = prepareErrors(errList, "UsageEntryLogicalValidator")
+	return
+}
+
+// WatchdogEntryLogicalValidator checks the correctness of "Watchdog" part of configuration file
+func (c *YamlConfig) WatchdogEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	watchdog := c.Watchdog
+	limits := []int64{watchdog.MaxGoroutines, watchdog.MaxConnections, watchdog.MaxSpoolFiles, watchdog.MaxOpenFiles}
+	limitDefined := false
+	for _, limit := range limits {
+		if limit < 0 {
+			errList = append(errList, errors.New("Watchdog limits should not be negative"))
+			break
+		}
+		limitDefined = limitDefined || limit > 0
+	}
+	if (limitDefined || watchdog.DumpPath != "") && watchdog.Interval.Duration <= 0 {
+		errList = append(errList, errors.New("Watchdog Interval should be positive when limits or DumpPath are defined"))
+	}
+	validationErrors, valid = prepareErrors(errList, "WatchdogEntryLogicalValidator")
+	return
+}
+
+// HotSpotsEntryLogicalValidator checks the correctness of "HotSpots" part of configuration file
+func (c *YamlConfig) HotSpotsEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if c.HotSpots.Capacity < 0 {
+		errList = append(errList, errors.New("HotSpots Capacity should not be negative"))
+	}
+	if c.HotSpots.Window.Duration < 0 {
+		errList = append(errList, errors.New("HotSpots Window should not be negative"))
+	}
+	validationErrors, valid = prepareErrors(errList, "HotSpotsEntryLogicalValidator")
+	return
+}
+
+// NetworkACLEntryLogicalValidator checks the correctness of "NetworkACL" part of configuration file
+func (c *YamlConfig) NetworkACLEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	acl := c.NetworkACL
+	if _, err := netacl.Decorator(acl); err != nil {
+		errList = append(errList, fmt.Errorf("NetworkACL Service: %s", err))
+	}
+	if _, err := netacl.NewFilter(acl.TechnicalEndpoint); err != nil {
+		errList = append(errList, fmt.Errorf("NetworkACL TechnicalEndpoint: %s", err))
+	}
+	if acl.ProxyProtocol && len(acl.TrustedProxies) == 0 {
+		errList = append(errList, errors.New("NetworkACL TrustedProxies should be defined when ProxyProtocol is enabled"))
+	}
+	validationErrors, valid = prepareErrors(errList, "NetworkACLEntryLogicalValidator")
+	return
+}
+
+// WORMEntryLogicalValidator checks the correctness of "WORM" part of configuration file
+func (c *YamlConfig) WORMEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	buckets := make([]string, 0, len(c.WORM.Buckets))
+	for bucket := range c.WORM.Buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		rule := c.WORM.Buckets[bucket]
+		if rule.Retention.Duration < 0 {
+			errList = append(errList, fmt.Errorf("WORM Retention of bucket \"%s\" should not be negative", bucket))
+		}
+		if !rule.NoOverwrite && rule.Retention.Duration == 0 {
+			errList = append(errList, fmt.Errorf("WORM rule of bucket \"%s\" should define NoOverwrite or Retention", bucket))
+		}
+	}
+	if len(c.WORM.Buckets) > 0 && c.Service.Server.AuthServiceEndpoint == "" {
+		errList = append(errList, errors.New("WORM requires Service.Server.AuthServiceEndpoint, object state is read for verified clients only"))
+	}
+	validationErrors, valid = prepareErrors(errList, "WORMEntryLogicalValidator")
+	return
+}
+
+// LifecycleEntryLogicalValidator checks the correctness of "Lifecycle" part of configuration file
+func (c *YamlConfig) LifecycleEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	lifecycle := c.Lifecycle
+	if lifecycle.Shard != "" {
+		if _, exists := c.Shards[lifecycle.Shard]; !exists {
+			errList = append(errList, fmt.Errorf("Lifecycle defined for unknown shard \"%s\"", lifecycle.Shard))
+		}
+		if lifecycle.Interval.Duration <= 0 {
+			errList = append(errList, errors.New("Lifecycle Interval should be positive"))
+		}
+	}
+	for _, rule := range lifecycle.Rules {
+		if rule.Bucket == "" {
+			errList = append(errList, errors.New("Lifecycle rule needs Bucket"))
+			continue
+		}
+		if rule.Days <= 0 {
+			errList = append(errList, fmt.Errorf("Lifecycle Days of bucket \"%s\" should be positive", rule.Bucket))
+		}
+		worm, locked := c.WORM.Buckets[rule.Bucket]
+		if locked && time.Duration(rule.Days)*24*time.Hour < worm.Retention.Duration {
+			errList = append(errList, fmt.Errorf("Lifecycle rule of bucket \"%s\" expires objects before WORM Retention", rule.Bucket))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "LifecycleEntryLogicalValidator")
+	return
+}
+
+// NotificationsEntryLogicalValidator checks the correctness of "Notifications" part of configuration file
+func (c *YamlConfig) NotificationsEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	notifications := c.Notifications
+	if notifications.QueueSize < 0 {
+		errList = append(errList, errors.New("Notifications QueueSize should not be negative"))
+	}
+	names := make(map[string]bool, len(notifications.Targets))
+	for _, target := range notifications.Targets {
+		if target.Name == "" {
+			errList = append(errList, errors.New("Notification target needs Name"))
+			continue
+		}
+		if names[target.Name] {
+			errList = append(errList, fmt.Errorf("Notification target \"%s\" is duplicated", target.Name))
+		}
+		names[target.Name] = true
+		if target.Endpoint.URL == nil || target.Endpoint.Host == "" {
+			errList = append(errList, fmt.Errorf("Notification target \"%s\" needs Endpoint", target.Name))
+		}
+		switch target.Type {
+		case notificationsconfig.Webhook:
+		case notificationsconfig.KafkaREST:
+			if target.Topic == "" {
+				errList = append(errList, fmt.Errorf("Notification target \"%s\" needs Topic", target.Name))
+			}
+		case notificationsconfig.SQS:
+			if target.AccessKey != "" && (target.Secret == "" || target.Region == "") {
+				errList = append(errList, fmt.Errorf("Notification target \"%s\" needs Secret and Region to sign requests", target.Name))
+			}
+		default:
+			errList = append(errList, fmt.Errorf("Unsupported notification target Type \"%s\", supported: %s, %s, %s",
+				target.Type, notificationsconfig.Webhook, notificationsconfig.KafkaREST, notificationsconfig.SQS))
+		}
+		for _, event := range target.Events {
+			if event != notificationsconfig.ObjectCreated && event != notificationsconfig.ObjectRemoved {
+				errList = append(errList, fmt.Errorf("Unknown event \"%s\" of notification target \"%s\"", event, target.Name))
+			}
+		}
+		if target.Timeout.Duration < 0 {
+			errList = append(errList, fmt.Errorf("Timeout of notification target \"%s\" should not be negative", target.Name))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "NotificationsEntryLogicalValidator")
+	return
+}
+
+// LoggingEntryLogicalValidator checks the correctness of "Logging" part of configuration file
+func (c *YamlConfig) LoggingEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := validateAccessLogFilter("AccesslogFilter", c.Logging.AccesslogFilter)
+	for bucket, filter := range c.Logging.AccesslogFilter.Buckets {
+		name := fmt.Sprintf("AccesslogFilter of bucket \"%s\"", bucket)
+		errList = append(errList, validateAccessLogFilter(name, filter)...)
+		if len(filter.Buckets) > 0 {
+			errList = append(errList, fmt.Errorf("%s can't define Buckets", name))
+		}
+	}
+	subsystems := make([]string, 0, len(c.Logging.Levels))
+	for subsystem := range c.Logging.Levels {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	for _, subsystem := range subsystems {
+		if _, ok := log.LogLevelMap[c.Logging.Levels[subsystem]]; !ok {
+			errList = append(errList, fmt.Errorf("Levels: unknown level \"%s\" of subsystem \"%s\"", c.Logging.Levels[subsystem], subsystem))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "LoggingEntryLogicalValidator")
+	return
+}
+
+// accessLogStatusPattern matches status codes and "Nxx" classes
+var accessLogStatusPattern = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+
+func validateAccessLogFilter(name string, filter logconfig.AccessLogFilter) []error {
+	errList := make([]error, 0)
+	if filter.SampleRate < 0 {
+		errList = append(errList, fmt.Errorf("%s SampleRate should not be negative", name))
+	}
+	for _, status := range filter.Statuses {
+		if !accessLogStatusPattern.MatchString(strings.ToLower(status)) {
+			errList = append(errList, fmt.Errorf("%s status \"%s\" should be code or class like 5xx", name, status))
+		}
+	}
+	return errList
+}
+
+// StatusEntryLogicalValidator checks the correctness of "Status" part of configuration file
+func (c *YamlConfig) StatusEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	status := c.Status
+	if status.Listen != "" && (status.Listen == c.Service.Server.Listen || status.Listen == c.Service.Server.TechnicalEndpointListen) {
+		errList = append(errList, fmt.Errorf("Status Listen \"%s\" is already used by service", status.Listen))
+	}
+	if status.CheckInterval.Duration < 0 || status.CheckTimeout.Duration < 0 {
+		errList = append(errList, errors.New("Status CheckInterval and CheckTimeout should not be negative"))
+	}
+	if status.Readiness.MinHealthyBackends < 0 {
+		errList = append(errList, errors.New("Status Readiness MinHealthyBackends should not be negative"))
+	}
+	for _, shard := range status.Readiness.Shards {
+		if _, defined := c.Shards[shard]; !defined {
+			errList = append(errList, fmt.Errorf("Status Readiness shard \"%s\" is not defined", shard))
+		}
+	}
+	for _, store := range status.Readiness.CredentialsStores {
+		if _, defined := c.CredentialsStore[store]; !defined {
+			errList = append(errList, fmt.Errorf("Status Readiness credentials store \"%s\" is not defined", store))
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "StatusEntryLogicalValidator")
+	return
+}
+
+// HooksEntryLogicalValidator checks the correctness of "Hooks" part of configuration file
+func (c *YamlConfig) HooksEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if _, err := hooks.Decorator(c.Hooks); err != nil {
+		errList = append(errList, fmt.Errorf("Hooks: %s", err))
+	}
+	validationErrors, valid = prepareErrors(errList, "HooksEntryLogicalValidator")
+	return
+}
+
+// CredentialsStoreEntryLogicalValidator checks the correctness of "CredentialsStore" part of configuration file
+func (c *YamlConfig) CredentialsStoreEntryLogicalValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	if endpoint := c.Service.Server.AuthServiceEndpoint; endpoint != "" {
+		if _, exists := c.CredentialsStore[endpoint]; !exists {
+			errList = append(errList, fmt.Errorf("Credentials store \"%s\" for edge authentication is not defined", endpoint))
+		}
+	}
+	cacheFiles := make(map[string]string)
+	for _, name := range c.sortedCredentialsStoreNames() {
+		store := c.CredentialsStore[name]
+		endpoints := store.AllEndpoints()
+		if len(endpoints) == 0 && store.Type != crdstoreconfig.FileStore {
+			errList = append(errList, fmt.Errorf("Invalid endpoint for credentials store \"%s\"", name))
+		}
+		for _, endpoint := range endpoints {
+			if endpoint.URL == nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+				errList = append(errList, fmt.Errorf("Invalid endpoint for credentials store \"%s\"", name))
+				break
+			}
+		}
+		errList = append(errList, validateCredentialsStoreType(name, store)...)
+		errList = append(errList, validateCredentialsStoreAuth(name, store)...)
+		if store.RefreshThreshold < 0 || store.RefreshThreshold > 100 {
+			errList = append(errList, fmt.Errorf("RefreshThreshold of credentials store \"%s\" should be a percentage", name))
+		}
+		if store.NegativeTTL.Duration < 0 {
+			errList = append(errList, fmt.Errorf("NegativeTTL of credentials store \"%s\" cannot be negative", name))
+		}
+		if store.Retries < 0 || store.DialTimeout.Duration < 0 || store.RequestTimeout.Duration < 0 || store.RetryBackoff.Duration < 0 {
+			errList = append(errList, fmt.Errorf("Retries, timeouts and RetryBackoff of credentials store \"%s\" cannot be negative", name))
+		}
+		if store.CacheSize < 0 {
+			errList = append(errList, fmt.Errorf("CacheSize of credentials store \"%s\" cannot be negative", name))
+		}
+		if store.CacheFileKey != "" {
+			key, err := base64.StdEncoding.DecodeString(store.CacheFileKey)
+			if err != nil || (len(key) != 16 && len(key) != 24 && len(key) != 32) {
+				errList = append(errList, fmt.Errorf("CacheFileKey of credentials store \"%s\" should be base64 encoded 16, 24 or 32 bytes key", name))
+			}
+		}
+		cacheFile := store.CacheFile
+		if cacheFile == "" {
+			continue
+		}
+		if other, ok := cacheFiles[cacheFile]; ok {
+			errList = append(errList, fmt.Errorf("Credentials stores \"%s\" and \"%s\" share CacheFile", other, name))
+		}
+		cacheFiles[cacheFile] = name
+	}
+	validationErrors, valid = prepareErrors(errList, "CredentialsStoreEntryLogicalValidator")
+	return
+}
+
+func validateCredentialsStoreType(name string, store crdstoreconfig.CredentialsStore) []error {
+	switch store.Type {
+	case "", crdstoreconfig.HTTPStore:
+		return nil
+	case crdstoreconfig.FileStore:
+		if store.File == "" {
+			return []error{fmt.Errorf("No File defined for credentials store \"%s\"", name)}
+		}
+		return nil
+	case crdstoreconfig.VaultStore:
+	default:
+		return []error{fmt.Errorf("Unsupported Type \"%s\" of credentials store \"%s\"", store.Type, name)}
+	}
+	vault := store.Vault
+	if vault == nil || (vault.Token == "" && vault.TokenFile == "") {
+		return []error{fmt.Errorf("No Vault Token or TokenFile defined for credentials store \"%s\"", name)}
+	}
+	if vault.Engine != "" && vault.Engine != crdstoreconfig.VaultKV2 && vault.Engine != crdstoreconfig.VaultAWS {
+		return []error{fmt.Errorf("Unsupported Vault Engine \"%s\" of credentials store \"%s\"", vault.Engine, name)}
+	}
+	return nil
+}
+
+func validateCredentialsStoreAuth(name string, store crdstoreconfig.CredentialsStore) []error {
+	errList := make([]error, 0)
+	known := make(map[string]bool)
+	for _, endpoint := range store.AllEndpoints() {
+		if endpoint.URL == nil {
+			continue
+		}
+		known[endpoint.String()] = true
+		auth := store.EndpointAuth(endpoint.String())
+		if auth == nil {
+			continue
+		}
+		if auth.TLS != nil && endpoint.Scheme != "https" {
+			errList = append(errList, fmt.Errorf("TLS defined for credentials store \"%s\" with non https endpoint \"%s\"", name, endpoint))
+		}
+		if auth.BearerToken != "" && auth.BearerTokenFile != "" {
+			errList = append(errList, fmt.Errorf("Both BearerToken and BearerTokenFile defined for credentials store \"%s\" endpoint \"%s\"", name, endpoint))
+		}
+	}
+	endpoints := make([]string, 0, len(store.EndpointsAuth))
+	for endpoint := range store.EndpointsAuth {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		if !known[endpoint] {
+			errList = append(errList, fmt.Errorf("EndpointsAuth of credentials store \"%s\" defines unknown endpoint \"%s\"", name, endpoint))
+		}
+	}
+	return errList
+}
+
+// EndpointsReachabilityValidator checks if storages and credentials stores endpoints accept connections
+func (c *YamlConfig) EndpointsReachabilityValidator() (valid bool, validationErrors map[string][]error) {
+	errList := make([]error, 0)
+	for _, storageName := range c.sortedStorageNames() {
+		backend := c.Storages[storageName].Backend
+		if backend.URL == nil {
+			continue
+		}
+		if err := dialEndpoint(backend.Scheme, backend.Host); err != nil {
+			errList = append(errList, fmt.Errorf("Storage \"%s\" backend is unreachable: %s", storageName, err))
+		}
+	}
+	for _, name := range c.sortedCredentialsStoreNames() {
+		for _, endpoint := range c.CredentialsStore[name].AllEndpoints() {
+			if endpoint.URL == nil {
+				continue
+			}
+			if err := dialEndpoint(endpoint.Scheme, endpoint.Host); err != nil {
+				errList = append(errList, fmt.Errorf("Credentials store \"%s\" endpoint %s is unreachable: %s", name, endpoint.Host, err))
+			}
+		}
+	}
+	validationErrors, valid = prepareErrors(errList, "EndpointsReachabilityValidator")
+	return
+}
+
+func dialEndpoint(scheme, host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := "80"
+		if scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(host, port)
+	}
+	conn, err := net.DialTimeout("tcp", host, endpointDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (c *YamlConfig) sortedStorageNames() []string {
+	names := make([]string, 0, len(c.Storages))
+	for name := range c.Storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *YamlConfig) sortedMasterKeyIDs() []string {
+	ids := make([]string, 0, len(c.Encryption.MasterKeys))
+	for id := range c.Encryption.MasterKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (c *YamlConfig) sortedCredentialsStoreNames() []string {
+	names := make([]string, 0, len(c.CredentialsStore))
+	for name := range c.CredentialsStore {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks whole configuration and returns all found problems at once,
+// unlike ValidateConf it does not stop on schema errors. If checkEndpoints is
+// set storages and credentials stores endpoints are dialed as well.
+func Validate(conf YamlConfig, checkEndpoints bool) []error {
+	if err := registerValidationFuncs(); err != nil {
+		return []error{err}
+	}
+	_, validationErrors := validator.Validate(conf)
+	allErrors := mergeErrors(validationErrors, logicalValidationErrors(conf))
+	if checkEndpoints {
+		_, endpointsValidationErrors := conf.EndpointsReachabilityValidator()
+		allErrors = mergeErrors(allErrors, endpointsValidationErrors)
+	}
+
+	names := make([]string, 0, len(allErrors))
+	for name := range allErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errList := make([]error, 0)
+	for _, name := range names {
+		for _, err := range allErrors[name] {
+			errList = append(errList, fmt.Errorf("%s: %s", name, err))
+		}
+	}
+	return errList
+}
+
+// logicalValidationErrors runs all logical validators of configuration, they
+// check values and relations schema validation can't express
+func logicalValidationErrors(conf YamlConfig) map[string][]error {
+	_, portsValidationErrors := conf.ListenPortsLogicalValidator()
+	_, regionsValidationErrors := conf.RegionsEntryLogicalValidator()
+	_, transportsValidationErrors := conf.TransportsEntryLogicalValidator()
+	_, storagesValidationErrors := conf.StoragesEntryLogicalValidator()
+	_, shardsValidationErrors := conf.ShardsEntryLogicalValidator()
+	_, credentialsStoreValidationErrors := conf.CredentialsStoreEntryLogicalValidator()
+	_, concurrencyLimitsValidationErrors := conf.ConcurrencyLimitsEntryLogicalValidator()
+	_, mirroringValidationErrors := conf.MirroringEntryLogicalValidator()
+	_, inventoryValidationErrors := conf.InventoryEntryLogicalValidator()
+	_, cacheValidationErrors := conf.CacheEntryLogicalValidator()
+	_, compressionValidationErrors := conf.CompressionEntryLogicalValidator()
+	_, corsValidationErrors := conf.CORSEntryLogicalValidator()
+	_, encryptionValidationErrors := conf.EncryptionEntryLogicalValidator()
+	_, usageValidationErrors := conf.UsageEntryLogicalValidator()
+	_, watchdogValidationErrors := conf.WatchdogEntryLogicalValidator()
+	_, hotSpotsValidationErrors := conf.HotSpotsEntryLogicalValidator()
+	_, networkACLValidationErrors := conf.NetworkACLEntryLogicalValidator()
+	_, wormValidationErrors := conf.WORMEntryLogicalValidator()
+	_, lifecycleValidationErrors := conf.LifecycleEntryLogicalValidator()
+	_, notificationsValidationErrors := conf.NotificationsEntryLogicalValidator()
+	_, hooksValidationErrors := conf.HooksEntryLogicalValidator()
+	_, statusValidationErrors := conf.StatusEntryLogicalValidator()
+	_, loggingValidationErrors := conf.LoggingEntryLogicalValidator()
+	return mergeErrors(portsValidationErrors, regionsValidationErrors,
+		transportsValidationErrors, storagesValidationErrors, shardsValidationErrors,
+		credentialsStoreValidationErrors, concurrencyLimitsValidationErrors, mirroringValidationErrors,
+		inventoryValidationErrors, cacheValidationErrors, compressionValidationErrors, corsValidationErrors,
+		encryptionValidationErrors, usageValidationErrors, watchdogValidationErrors, hotSpotsValidationErrors,
+		networkACLValidationErrors, wormValidationErrors, lifecycleValidationErrors, notificationsValidationErrors,
+		hooksValidationErrors, statusValidationErrors, loggingValidationErrors)
+}
+
 func mergeErrors(maps ...map[string][]error) (output map[string][]error) {
 	size := len(maps)
 	if size == 0 {
@@ -3,16 +3,39 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
 	"time"
 
+	cacheconfig "github.com/allegro/akubra/cache/config"
+	compressionconfig "github.com/allegro/akubra/compression/config"
+	concurrencyconfig "github.com/allegro/akubra/concurrency/config"
+	corsconfig "github.com/allegro/akubra/cors/config"
+	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	encryptionconfig "github.com/allegro/akubra/encryption/config"
+	hooksconfig "github.com/allegro/akubra/hooks/config"
+	hotspotsconfig "github.com/allegro/akubra/hotspots/config"
 	httphandlerconfig "github.com/allegro/akubra/httphandler/config"
+	inventoryconfig "github.com/allegro/akubra/inventory/config"
+	lifecycleconfig "github.com/allegro/akubra/lifecycle/config"
 	"github.com/allegro/akubra/metrics"
+	mirrorconfig "github.com/allegro/akubra/mirror/config"
+	netaclconfig "github.com/allegro/akubra/netacl/config"
+	notificationsconfig "github.com/allegro/akubra/notifications/config"
 	shardsconfig "github.com/allegro/akubra/regions/config"
+	statusconfig "github.com/allegro/akubra/status/config"
+	"github.com/allegro/akubra/storages/auth"
+	storageconfig "github.com/allegro/akubra/storages/config"
 	transportconfig "github.com/allegro/akubra/transport/config"
+	"github.com/allegro/akubra/types"
+	usageconfig "github.com/allegro/akubra/usage/config"
+	watchdogconfig "github.com/allegro/akubra/watchdog/config"
+	wormconfig "github.com/allegro/akubra/worm/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/validator.v1"
@@ -276,6 +299,162 @@ func TestValidatorShouldFailWithMissingClusterDefinition(t *testing.T) {
 		validationErrors["RegionsEntryLogicalValidator"][0])
 }
 
+func TestValidatorShouldFailWithInvalidCanary(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains: []string{"domain.dc"},
+		Canary:  &shardsconfig.Canary{ShardName: "cluster1test", Percentage: 101},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Canary shard \"cluster1test\" is already in shards of policy \"testregion\""),
+		errors.New("Canary percentage in policy \"testregion\" should be in range [0, 100]"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailWithInvalidBoundedLoadFactor(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:      []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains:     []string{"domain.dc"},
+		BoundedLoad: &shardsconfig.BoundedLoad{Factor: 1},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Bounded load factor in policy \"testregion\" should be greater than 1"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailIfAllShardsAreDrained(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:           []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1, Drained: true}},
+		Domains:          []string{"domain.dc"},
+		DrainConcurrency: -1,
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Weights sum for policy \"testregion\" is zero"),
+		errors.New("Drain concurrency in policy \"testregion\" should not be negative"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailWithBucketMappedToManyRegions(t *testing.T) {
+	firstRegion := shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains: []string{"first.dc"},
+		Buckets: []string{"images", "docs/old"},
+	}
+	secondRegion := shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains: []string{"second.dc"},
+		Buckets: []string{"images"},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"first": firstRegion, "second": secondRegion}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Bucket \"docs/old\" in policy \"first\" is not valid"),
+		errors.New("Bucket \"images\" is mapped to policies \"first\" and \"second\""),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailWithInvalidReplicationRegion(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:      []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains:     []string{"domain.dc"},
+		Replication: []shardsconfig.ReplicationRule{{Region: "testregion"}, {Region: "other"}},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Replication region \"testregion\" of policy \"testregion\" is not valid"),
+		errors.New("Replication region \"other\" of policy \"testregion\" is not valid"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailWithInvalidFailoverRegion(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:         []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains:        []string{"domain.dc"},
+		FailoverRegion: "testregion",
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Failover region \"testregion\" of policy \"testregion\" is not valid"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
+func TestValidatorShouldFailWithInvalidKeyPrefixes(t *testing.T) {
+	regionConfig := shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains: []string{"domain.dc"},
+		KeyPrefixes: []shardsconfig.KeyPrefix{
+			{Bucket: "media", Prefix: "thumbs/", ShardName: "cluster1test"},
+			{Bucket: "media", Prefix: "thumbs/", ShardName: "cluster1test"},
+			{Bucket: "media", Prefix: "", ShardName: "cluster1test"},
+			{Bucket: "media", Prefix: "video/", ShardName: "cluster2test"},
+		},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	regions := map[string]shardsconfig.Policies{"testregion": regionConfig}
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235", regions, nil)
+
+	valid, validationErrors := yamlConfig.RegionsEntryLogicalValidator()
+
+	assert.False(t, valid)
+	assert.Equal(t, []error{
+		errors.New("Key prefix \"thumbs/\" of bucket \"media\" is duplicated in policy \"testregion\""),
+		errors.New("Key prefix \"\" of bucket \"media\" in policy \"testregion\" is not valid"),
+		errors.New("Key prefix shard \"cluster2test\" in policy \"testregion\" is not defined"),
+	}, validationErrors["RegionsEntryLogicalValidator"])
+}
+
 func TestValidatorShouldFailWithEmptyTransportsDefinition(t *testing.T) {
 	transports := make(transportconfig.Transports, 0)
 	var size httphandlerconfig.HumanSizeUnits
@@ -464,3 +643,766 @@ func prepareTransportsForEntryLogicalValidatorTest(maxIdleConns, maxIdleConnsPer
 		},
 	}
 }
+
+func prepareConfigForValidateTest() YamlConfig {
+	regionConfig := shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 1}},
+		Domains: []string{"domain.dc"},
+	}
+	var size httphandlerconfig.HumanSizeUnits
+	size.SizeInBytes = 2048
+	yamlConfig := PrepareYamlConfig(size, 31, 45, "127.0.0.1:81",
+		"127.0.0.1:1234", "127.0.0.1:1235",
+		map[string]shardsconfig.Policies{"region": regionConfig}, nil)
+	yamlConfig.Service.Server.ReadTimeout = metrics.Interval{Duration: time.Second}
+	yamlConfig.Service.Server.WriteTimeout = metrics.Interval{Duration: time.Second}
+	yamlConfig.Service.Server.ShutdownTimeout = metrics.Interval{Duration: time.Second}
+	for name, storage := range yamlConfig.Storages {
+		storage.Type = storageconfig.Passthrough
+		yamlConfig.Storages[name] = storage
+	}
+	return yamlConfig
+}
+
+func testYAMLUrl(t *testing.T, rawurl string) types.YAMLUrl {
+	parsed, err := url.Parse(rawurl)
+	require.NoError(t, err)
+	return types.YAMLUrl{URL: parsed}
+}
+
+func TestValidateShouldPassWithValidConfig(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	assert.Empty(t, Validate(yamlConfig, false))
+}
+
+func TestValidateShouldReportAllErrorsAtOnce(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Service.Server.ReadTimeout = metrics.Interval{}
+	yamlConfig.Storages["duplicate"] = yamlConfig.Storages["default"]
+	yamlConfig.Storages["unknown"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8082"),
+		Type:    "unknown",
+	}
+	yamlConfig.Shards["cluster2test"] = storageconfig.Shard{
+		Storages: storageconfig.Storages{{Name: "default"}, {Name: "default"}, {Name: "missing"}},
+	}
+	yamlConfig.ShardingPolicies["region"] = shardsconfig.Policies{
+		Shards:  []shardsconfig.Policy{{ShardName: "cluster1test", Weight: 0}},
+		Domains: []string{"domain.dc"},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 6)
+	assert.Contains(t, strings.Join(messages, "\n"), "ReadTimeout")
+	assert.Contains(t, messages, "RegionsEntryLogicalValidator: Weights sum for policy \"region\" is zero")
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Storage \"default\" is duplicated in shard \"cluster2test\"")
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Storage \"missing\" in shard \"cluster2test\" is not defined")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storages \"default\" and \"duplicate\" share the same backend \"http://127.0.0.1:8080\"")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Unknown type \"unknown\" for storage \"unknown\"")
+}
+
+func TestValidateShouldFailWhenCredentialsStoreIsNotDefined(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	storage := yamlConfig.Storages["default"]
+	storage.Type = "S3AuthService"
+	storage.Properties = map[string]string{"AuthServiceEndpoint": "missing"}
+	yamlConfig.Storages["default"] = storage
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"default": crdstoreconfig.CredentialsStore{Endpoint: testYAMLUrl(t, "localhost:8090")},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Invalid endpoint for credentials store \"default\"", errs[0].Error())
+	assert.Equal(t, "StoragesEntryLogicalValidator: Credentials store \"missing\" for storage \"default\" is not defined", errs[1].Error())
+}
+
+func TestValidateShouldRejectSharedCredentialsCacheFile(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"first":  crdstoreconfig.CredentialsStore{Endpoint: testYAMLUrl(t, "http://localhost:8090"), CacheFile: "/var/cache/akubra/crd.json"},
+		"second": crdstoreconfig.CredentialsStore{Endpoint: testYAMLUrl(t, "http://localhost:8091"), CacheFile: "/var/cache/akubra/crd.json"},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Credentials stores \"first\" and \"second\" share CacheFile", errs[0].Error())
+}
+
+func TestValidateShouldCheckCredentialsCacheSettings(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"encrypted": crdstoreconfig.CredentialsStore{
+			Endpoint:     testYAMLUrl(t, "http://localhost:8090"),
+			CacheFile:    "/var/cache/akubra/encrypted.json",
+			CacheFileKey: "MDEyMzQ1Njc4OWFiY2RlZg==",
+			CacheSize:    100,
+		},
+		"invalid": crdstoreconfig.CredentialsStore{
+			Endpoint:     testYAMLUrl(t, "http://localhost:8091"),
+			CacheFile:    "/var/cache/akubra/invalid.json",
+			CacheFileKey: "c2hvcnQ=",
+			CacheSize:    -1,
+			NegativeTTL:  metrics.Interval{Duration: -time.Second},
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 3)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: NegativeTTL of credentials store \"invalid\" cannot be negative", errs[0].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: CacheSize of credentials store \"invalid\" cannot be negative", errs[1].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: CacheFileKey of credentials store \"invalid\" should be base64 encoded 16, 24 or 32 bytes key", errs[2].Error())
+}
+
+func TestValidateShouldCheckCredentialsStoreAuth(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"plain": crdstoreconfig.CredentialsStore{
+			Endpoint: testYAMLUrl(t, "http://localhost:8090"),
+			Auth:     &crdstoreconfig.Auth{TLS: &crdstoreconfig.TLS{RootCAFile: "/etc/akubra/ca.pem"}},
+		},
+		"secured": crdstoreconfig.CredentialsStore{
+			Endpoint:  testYAMLUrl(t, "https://localhost:8443"),
+			Endpoints: []types.YAMLUrl{testYAMLUrl(t, "https://localhost:8444")},
+			Auth:      &crdstoreconfig.Auth{BearerTokenFile: "/run/akubra/token"},
+			EndpointsAuth: map[string]crdstoreconfig.Auth{
+				"https://localhost:8444": {BearerToken: "token", BearerTokenFile: "/run/akubra/token"},
+				"https://localhost:8445": {BearerToken: "token"},
+			},
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 3)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: TLS defined for credentials store \"plain\" with non https endpoint \"http://localhost:8090\"", errs[0].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Both BearerToken and BearerTokenFile defined for credentials store \"secured\" endpoint \"https://localhost:8444\"", errs[1].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: EndpointsAuth of credentials store \"secured\" defines unknown endpoint \"https://localhost:8445\"", errs[2].Error())
+}
+
+func TestValidateShouldRejectUndefinedEdgeAuthenticationStore(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Service.Server.AuthServiceEndpoint = "edge"
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Credentials store \"edge\" for edge authentication is not defined", errs[0].Error())
+}
+
+func TestValidateShouldCheckCredentialsStoreFailoverEndpoints(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"failover": crdstoreconfig.CredentialsStore{
+			Endpoints: []types.YAMLUrl{testYAMLUrl(t, "http://localhost:8090"), testYAMLUrl(t, "ftp://localhost:8091")},
+		},
+		"none": crdstoreconfig.CredentialsStore{},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Invalid endpoint for credentials store \"failover\"", errs[0].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Invalid endpoint for credentials store \"none\"", errs[1].Error())
+}
+
+func TestValidateShouldCheckCredentialsStoreTypes(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"aws": crdstoreconfig.CredentialsStore{
+			Endpoint: testYAMLUrl(t, "https://vault:8200"),
+			Type:     crdstoreconfig.VaultStore,
+			Vault:    &crdstoreconfig.Vault{TokenFile: "/run/vault/token", Engine: "gcp"},
+		},
+		"file": crdstoreconfig.CredentialsStore{Type: crdstoreconfig.FileStore},
+		"kv":   crdstoreconfig.CredentialsStore{Endpoint: testYAMLUrl(t, "https://vault:8200"), Type: crdstoreconfig.VaultStore},
+		"valid": crdstoreconfig.CredentialsStore{
+			Endpoint: testYAMLUrl(t, "https://vault:8200"),
+			Type:     crdstoreconfig.VaultStore,
+			Vault:    &crdstoreconfig.Vault{Token: "token"},
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 3)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Unsupported Vault Engine \"gcp\" of credentials store \"aws\"", errs[0].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: No File defined for credentials store \"file\"", errs[1].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: No Vault Token or TokenFile defined for credentials store \"kv\"", errs[2].Error())
+}
+
+func TestValidateShouldCheckCredentialsStoreTimeouts(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CredentialsStore = crdstoreconfig.CredentialsStoreMap{
+		"default": crdstoreconfig.CredentialsStore{
+			Endpoint:         testYAMLUrl(t, "http://localhost:8090"),
+			RefreshThreshold: 120,
+			Retries:          -1,
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: RefreshThreshold of credentials store \"default\" should be a percentage", errs[0].Error())
+	assert.Equal(t, "CredentialsStoreEntryLogicalValidator: Retries, timeouts and RetryBackoff of credentials store \"default\" cannot be negative", errs[1].Error())
+}
+
+func TestValidateShouldCheckAddressingStyle(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages["signed"] = storageconfig.Storage{
+		Backend:         testYAMLUrl(t, "http://127.0.0.1:8081"),
+		Type:            auth.S3FixedKey,
+		AddressingStyle: storageconfig.PreserveStyle,
+	}
+	yamlConfig.Storages["unknown"] = storageconfig.Storage{
+		Backend:         testYAMLUrl(t, "http://127.0.0.1:8082"),
+		Type:            storageconfig.Passthrough,
+		AddressingStyle: "virtual",
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"signed\": AddressingStyle \"preserve\" requires passthrough type, other types sign requests for backend host")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"unknown\": unsupported AddressingStyle \"virtual\"")
+}
+
+func TestValidateShouldCheckSSEPolicy(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages["passthrough"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8081"),
+		Type:    storageconfig.Passthrough,
+		SSE:     &storageconfig.SSE{Strip: true},
+	}
+	yamlConfig.Storages["algorithm"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8082"),
+		Type:    auth.S3FixedKey,
+		SSE:     &storageconfig.SSE{Inject: "DES"},
+	}
+	yamlConfig.Storages["exclusive"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8083"),
+		Type:    auth.S3FixedKey,
+		SSE:     &storageconfig.SSE{Inject: storageconfig.SSEAES256, Strip: true},
+	}
+	yamlConfig.Storages["kms"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8084"),
+		Type:    auth.S3FixedKey,
+		SSE:     &storageconfig.SSE{Inject: storageconfig.SSEAES256, KMSKeyID: "key"},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 4)
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"passthrough\": SSE cannot be managed for passthrough type, changed headers would break client signatures")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"algorithm\": unsupported SSE Inject algorithm \"DES\"")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"exclusive\": SSE Inject and Strip are exclusive")
+	assert.Contains(t, messages, "StoragesEntryLogicalValidator: Storage \"kms\": SSE KMSKeyID requires Inject \"aws:kms\"")
+}
+
+func TestValidateShouldRejectInvalidStorageQueue(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages["queued"] = storageconfig.Storage{
+		Backend: testYAMLUrl(t, "http://127.0.0.1:8081"),
+		Type:    storageconfig.Passthrough,
+		Queue:   &storageconfig.Queue{Workers: 0, Size: 10},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "Storage \"queued\": Queue Workers should be positive, Size and Timeout cannot be negative")
+}
+
+func TestValidateShouldRejectUnknownCapabilities(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages["limited"] = storageconfig.Storage{
+		Backend:      testYAMLUrl(t, "http://127.0.0.1:8081"),
+		Type:         storageconfig.Passthrough,
+		Capabilities: map[string]bool{storageconfig.CapabilityCopy: false, "Teleport": true},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "Storage \"limited\": unknown capability \"Teleport\"")
+}
+
+func TestValidateShouldRejectUnsupportedBodyMode(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	shard := yamlConfig.Shards["cluster1test"]
+	shard.BodyMode = "tee"
+	yamlConfig.Shards["cluster1test"] = shard
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "ShardsEntryLogicalValidator: Unsupported BodyMode \"tee\" for shard \"cluster1test\"", errs[0].Error())
+}
+
+func TestValidateShouldRejectUnsupportedMethodPolicies(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	shard := yamlConfig.Shards["cluster1test"]
+	shard.MethodPolicies = map[string]string{
+		"GET":   storageconfig.SingleBackend,
+		"LIST":  storageconfig.AggregateResponses,
+		"PUT":   storageconfig.SingleBackend,
+		"PATCH": storageconfig.ReplicateRequest,
+	}
+	yamlConfig.Shards["cluster1test"] = shard
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Unsupported method \"PATCH\" in MethodPolicies of shard \"cluster1test\"")
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Unsupported policy \"single\" for method \"PUT\" of shard \"cluster1test\", allowed: replicate")
+}
+
+func TestValidateShouldRejectAmbiguousBucketAliases(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	shard := yamlConfig.Shards["cluster1test"]
+	shard.BucketAliases = map[string]string{
+		"docs":   "tenant1-files",
+		"files":  "tenant1-files",
+		"photos": "",
+	}
+	yamlConfig.Shards["cluster1test"] = shard
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Buckets \"docs\" and \"files\" have the same alias \"tenant1-files\" in shard \"cluster1test\"")
+	assert.Contains(t, messages, "ShardsEntryLogicalValidator: Invalid alias \"\" of bucket \"photos\" in shard \"cluster1test\"")
+}
+
+func TestValidateShouldRejectNegativeStorageWeight(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	shard := yamlConfig.Shards["cluster1test"]
+	shard.Storages[0].Weight = -1
+	yamlConfig.Shards["cluster1test"] = shard
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "ShardsEntryLogicalValidator: Negative Weight of storage \"default\" in shard \"cluster1test\"", errs[0].Error())
+}
+
+func TestValidateShouldCheckConcurrencyLimits(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.ConcurrencyLimits = concurrencyconfig.ConcurrencyLimits{
+		Global: &concurrencyconfig.Limit{MaxInFlight: 100, MaxQueued: 10},
+		Shards: map[string]concurrencyconfig.Limit{
+			"cluster1test": {MaxInFlight: 0},
+			"missing":      {MaxInFlight: 10, MaxQueued: -1},
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 3)
+	assert.Equal(t, "ConcurrencyLimitsEntryLogicalValidator: MaxInFlight of shard \"cluster1test\" concurrency limit should be positive", errs[0].Error())
+	assert.Equal(t, "ConcurrencyLimitsEntryLogicalValidator: Concurrency limit defined for unknown shard \"missing\"", errs[1].Error())
+	assert.Equal(t, "ConcurrencyLimitsEntryLogicalValidator: MaxQueued and QueueTimeout of shard \"missing\" concurrency limit cannot be negative", errs[2].Error())
+}
+
+func TestValidateShouldCheckEndpointsReachabilityOnlyWhenRequested(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachableAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages = storageconfig.StoragesMap{
+		"default": storageconfig.Storage{Backend: testYAMLUrl(t, server.URL), Type: storageconfig.Passthrough},
+		"down":    storageconfig.Storage{Backend: testYAMLUrl(t, "http://"+unreachableAddr), Type: storageconfig.Passthrough},
+	}
+
+	assert.Empty(t, Validate(yamlConfig, false))
+	errs := Validate(yamlConfig, true)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "Storage \"down\" backend is unreachable")
+}
+
+func TestValidateShouldCheckHTTP2Mode(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Storages = storageconfig.StoragesMap{
+		"h2":      storageconfig.Storage{Backend: testYAMLUrl(t, "http://127.0.0.1:8080"), Type: storageconfig.Passthrough, HTTP2: "h2"},
+		"h2c":     storageconfig.Storage{Backend: testYAMLUrl(t, "http://127.0.0.1:8081"), Type: storageconfig.Passthrough, HTTP2: "h2c"},
+		"unknown": storageconfig.Storage{Backend: testYAMLUrl(t, "http://127.0.0.1:8082"), Type: storageconfig.Passthrough, HTTP2: "spdy"},
+	}
+	yamlConfig.Shards["cluster1test"] = storageconfig.Shard{Storages: storageconfig.Storages{{Name: "h2c"}}}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, "StoragesEntryLogicalValidator: Storage \"h2\": HTTP2 mode \"h2\" requires https backend", errs[0].Error())
+	assert.Equal(t, "StoragesEntryLogicalValidator: Storage \"unknown\": unsupported HTTP2 mode \"spdy\"", errs[1].Error())
+}
+
+func TestValidateShouldRejectShardOfShadowStoragesOnly(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	storage := yamlConfig.Storages["default"]
+	storage.Shadow = true
+	yamlConfig.Storages["default"] = storage
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "ShardsEntryLogicalValidator: Only shadow storages defined for shard \"cluster1test\"", errs[0].Error())
+}
+
+func TestValidateShouldRejectMirroringToUnknownShard(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Mirroring = mirrorconfig.Mirroring{Shard: "test-cluster", Percentage: 150}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "MirroringEntryLogicalValidator: Mirroring defined for unknown shard \"test-cluster\"")
+	assert.Contains(t, messages, "MirroringEntryLogicalValidator: Mirroring Percentage should be in range (0, 100], got 150")
+}
+
+func TestValidateShouldRejectIncompleteInventory(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Inventory = inventoryconfig.Inventory{Shard: "cluster1test", Format: "parquet"}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages, "InventoryEntryLogicalValidator: Inventory Interval should be positive")
+	assert.Contains(t, messages, "InventoryEntryLogicalValidator: Unsupported inventory Format \"parquet\", supported: csv")
+	assert.Contains(t, messages, "InventoryEntryLogicalValidator: Inventory needs Path or Bucket reports are written to")
+}
+
+func TestValidateShouldRejectCacheWithoutTTL(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Cache = cacheconfig.Cache{
+		MaxSize:  types.HumanSizeUnits{SizeInBytes: 1024},
+		DiskPath: "/tmp",
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages, "CacheEntryLogicalValidator: Cache TTL should be positive")
+	assert.Contains(t, messages, "CacheEntryLogicalValidator: Cache DiskMaxSize should be positive when DiskPath is defined")
+	assert.Contains(t, messages, "CacheEntryLogicalValidator: Cache requires Service.Server.AuthServiceEndpoint, responses are cached per verified access key")
+}
+
+func TestValidateShouldRejectUnsupportedCompression(t *testing.T) {
+	for _, testCase := range []struct {
+		compression     compressionconfig.Compression
+		expectedMessage string
+	}{
+		{compressionconfig.Compression{Algorithm: "br", ContentTypes: []string{"text/*"}},
+			"CompressionEntryLogicalValidator: Unsupported compression Algorithm \"br\", supported: gzip, zstd"},
+		{compressionconfig.Compression{Level: 19, ContentTypes: []string{"text/*"}},
+			"CompressionEntryLogicalValidator: Compression Level should be in range [1, 9] or 0 for default, got 19"},
+		{compressionconfig.Compression{Algorithm: "zstd", Level: 23, ContentTypes: []string{"text/*"}},
+			"CompressionEntryLogicalValidator: Compression Level should be in range [1, 22] or 0 for default, got 23"},
+		{compressionconfig.Compression{Algorithm: "zstd", Level: 19, ContentTypes: []string{"text/*"}}, ""},
+	} {
+		yamlConfig := prepareConfigForValidateTest()
+		yamlConfig.Compression = testCase.compression
+
+		errs := Validate(yamlConfig, false)
+
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		if testCase.expectedMessage == "" {
+			assert.Empty(t, messages)
+			continue
+		}
+		assert.Equal(t, []string{testCase.expectedMessage}, messages)
+	}
+}
+
+func TestValidateShouldRejectInvalidCORSRules(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.CORS = corsconfig.CORS{
+		Global: &corsconfig.Rule{AllowedMethods: []string{"GET"}},
+		Buckets: map[string]corsconfig.Rule{
+			"uploads": {AllowedOrigins: []string{"https://*.*.example.com"}, AllowedMethods: []string{"PATCH"}},
+		},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages, "CORSEntryLogicalValidator: Global CORS rule has no AllowedOrigins")
+	assert.Contains(t, messages, "CORSEntryLogicalValidator: CORS rule of bucket \"uploads\" has unsupported method \"PATCH\", supported: GET, PUT, POST, DELETE, HEAD")
+	assert.Contains(t, messages, "CORSEntryLogicalValidator: CORS rule of bucket \"uploads\" pattern \"https://*.*.example.com\" may contain one wildcard only")
+}
+
+func TestValidateShouldCheckEncryptionKeys(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Encryption = encryptionconfig.Encryption{
+		KeyProvider: encryptionconfig.StaticKeys,
+		MasterKeys:  map[string]string{"old": "c2hvcnQ=", "current": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="},
+		MasterKeyID: "new",
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages, "EncryptionEntryLogicalValidator: Master key \"new\" is not defined")
+	assert.Contains(t, messages, "EncryptionEntryLogicalValidator: Master key \"old\" should be base64 encoded 32 bytes key")
+	assert.Contains(t, messages, "EncryptionEntryLogicalValidator: Encryption requires Service.Server.AuthServiceEndpoint, signatures are verified before uploads are encrypted")
+}
+
+func TestValidateShouldCheckUsageSink(t *testing.T) {
+	for _, testCase := range []struct {
+		usage    usageconfig.Usage
+		expected string
+	}{
+		{usageconfig.Usage{Sink: usageconfig.File}, "UsageEntryLogicalValidator: Usage Path is required for file sink"},
+		{usageconfig.Usage{Sink: usageconfig.Statsd, Addr: "localhost"}, "UsageEntryLogicalValidator: Usage Addr \"localhost\" of statsd sink is not valid"},
+		{usageconfig.Usage{Sink: usageconfig.KafkaREST, Topic: "usage"}, "UsageEntryLogicalValidator: Usage Endpoint and Topic are required for kafka-rest sink"},
+		{usageconfig.Usage{Sink: "kafka"}, "UsageEntryLogicalValidator: Unsupported usage Sink \"kafka\", supported: file, statsd, kafka-rest"},
+	} {
+		yamlConfig := prepareConfigForValidateTest()
+		yamlConfig.Usage = testCase.usage
+
+		errs := Validate(yamlConfig, false)
+
+		require.Len(t, errs, 1, testCase.expected)
+		assert.Equal(t, testCase.expected, errs[0].Error())
+	}
+}
+
+func TestValidateShouldRequireWatchdogInterval(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Watchdog = watchdogconfig.Watchdog{MaxGoroutines: 10000, MaxSpoolFiles: -1}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "WatchdogEntryLogicalValidator: Watchdog limits should not be negative")
+	assert.Contains(t, messages, "WatchdogEntryLogicalValidator: Watchdog Interval should be positive when limits or DumpPath are defined")
+}
+
+func TestValidateShouldRejectNegativeHotSpotsCapacity(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.HotSpots = hotspotsconfig.HotSpots{Capacity: -1}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "HotSpotsEntryLogicalValidator: HotSpots Capacity should not be negative", errs[0].Error())
+}
+
+func TestValidateShouldRejectInvalidNetworkACL(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.NetworkACL = netaclconfig.NetworkACL{
+		TechnicalEndpoint: &netaclconfig.ACL{Allow: []string{"10.0.0.0/33"}},
+		ProxyProtocol:     true,
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages, "NetworkACLEntryLogicalValidator: NetworkACL TechnicalEndpoint: invalid Allow network: invalid CIDR address: 10.0.0.0/33")
+	assert.Contains(t, messages, "NetworkACLEntryLogicalValidator: NetworkACL TrustedProxies should be defined when ProxyProtocol is enabled")
+}
+
+func TestValidateShouldRejectInvalidWORMRules(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.WORM = wormconfig.WORM{Buckets: map[string]wormconfig.Rule{
+		"negative": {Retention: metrics.Interval{Duration: -time.Hour}},
+		"empty":    {},
+		"valid":    {NoOverwrite: true},
+	}}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages, "WORMEntryLogicalValidator: WORM rule of bucket \"empty\" should define NoOverwrite or Retention")
+	assert.Contains(t, messages, "WORMEntryLogicalValidator: WORM Retention of bucket \"negative\" should not be negative")
+	assert.Contains(t, messages, "WORMEntryLogicalValidator: WORM requires Service.Server.AuthServiceEndpoint, object state is read for verified clients only")
+}
+
+func TestValidateShouldRejectInvalidLifecycleRules(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.WORM = wormconfig.WORM{Buckets: map[string]wormconfig.Rule{
+		"retained": {Retention: metrics.Interval{Duration: 30 * 24 * time.Hour}},
+	}}
+	yamlConfig.Lifecycle = lifecycleconfig.Lifecycle{
+		Shard: "unknown",
+		Rules: []lifecycleconfig.Rule{{Bucket: "retained", Days: 7}, {Bucket: "logs"}, {Days: 1}},
+	}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"LifecycleEntryLogicalValidator: Lifecycle defined for unknown shard \"unknown\"",
+		"LifecycleEntryLogicalValidator: Lifecycle Interval should be positive",
+		"LifecycleEntryLogicalValidator: Lifecycle rule of bucket \"retained\" expires objects before WORM Retention",
+		"LifecycleEntryLogicalValidator: Lifecycle Days of bucket \"logs\" should be positive",
+		"LifecycleEntryLogicalValidator: Lifecycle rule needs Bucket",
+		"WORMEntryLogicalValidator: WORM requires Service.Server.AuthServiceEndpoint, object state is read for verified clients only",
+	}, messages)
+}
+
+func TestValidateShouldRejectInvalidNotificationTargets(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	endpoint := types.YAMLUrl{URL: &url.URL{Scheme: "http", Host: "hooks:8080"}}
+	yamlConfig.Notifications = notificationsconfig.Notifications{Targets: []notificationsconfig.Target{
+		{Name: "hook", Type: notificationsconfig.Webhook, Endpoint: endpoint},
+		{Name: "hook", Type: notificationsconfig.Webhook, Endpoint: endpoint, Events: []string{"ObjectRestore"}},
+		{Name: "kafka", Type: notificationsconfig.KafkaREST, Endpoint: endpoint},
+		{Name: "queue", Type: notificationsconfig.SQS, AccessKey: "AKIAEXAMPLE"},
+		{Type: notificationsconfig.Webhook},
+	}}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"NotificationsEntryLogicalValidator: Notification target \"hook\" is duplicated",
+		"NotificationsEntryLogicalValidator: Unknown event \"ObjectRestore\" of notification target \"hook\"",
+		"NotificationsEntryLogicalValidator: Notification target \"kafka\" needs Topic",
+		"NotificationsEntryLogicalValidator: Notification target \"queue\" needs Endpoint",
+		"NotificationsEntryLogicalValidator: Notification target \"queue\" needs Secret and Region to sign requests",
+		"NotificationsEntryLogicalValidator: Notification target needs Name",
+	}, messages)
+}
+
+func TestValidateShouldRejectInvalidHookExpressions(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Hooks = hooksconfig.Hooks{{Name: "deletes", When: `method = "DELETE"`, Reject: http.StatusForbidden}}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], `HooksEntryLogicalValidator: Hooks: hook 1 (deletes): expression "method = \"DELETE\"": unexpected '=' at 7`)
+}
+
+func TestValidateShouldRejectUndefinedReadinessRequirements(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Status = statusconfig.Status{Readiness: statusconfig.Readiness{Shards: []string{"missing"}, CredentialsStores: []string{"missing"}}}
+
+	errs := Validate(yamlConfig, false)
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.ElementsMatch(t, []string{
+		"StatusEntryLogicalValidator: Status Readiness shard \"missing\" is not defined",
+		"StatusEntryLogicalValidator: Status Readiness credentials store \"missing\" is not defined",
+	}, messages)
+}
+
+func TestValidateShouldRejectUnknownSubsystemLogLevels(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	yamlConfig.Logging.Levels = map[string]string{"sharding": "Debug", "crdstore": "Verbose"}
+
+	errs := Validate(yamlConfig, false)
+
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], `LoggingEntryLogicalValidator: Levels: unknown level "Verbose" of subsystem "crdstore"`)
+}
+
+func TestValidateShouldRejectInvalidStorageFaults(t *testing.T) {
+	testCases := map[string][]storageconfig.Fault{
+		`Storage "default": Fault 1 Percentage should be in (0, 100] range`: {{Percentage: 0, Reset: true}},
+		`Storage "default": Fault 1 Status should be 5xx`:                   {{Percentage: 10, Status: http.StatusNotFound}},
+		`Storage "default": Fault 1 Status and Reset are exclusive`:         {{Percentage: 10, Status: http.StatusServiceUnavailable, Reset: true}},
+		`Storage "default": Fault 2 should define Latency, Status or Reset`: {{Percentage: 10, Reset: true}, {Percentage: 10}},
+		`Storage "default": Faults Percentage should sum up to 100 at most`: {{Percentage: 60, Reset: true}, {Percentage: 50, Reset: true}},
+	}
+	for message, faults := range testCases {
+		yamlConfig := prepareConfigForValidateTest()
+		storage := yamlConfig.Storages["default"]
+		storage.Faults = faults
+		yamlConfig.Storages["default"] = storage
+
+		errs := Validate(yamlConfig, false)
+
+		require.Len(t, errs, 1, message)
+		assert.EqualError(t, errs[0], "StoragesEntryLogicalValidator: "+message)
+	}
+}
+
+func TestValidateShouldAcceptStoragesOfOneBackendWithDifferentCredentials(t *testing.T) {
+	yamlConfig := prepareConfigForValidateTest()
+	for _, name := range []string{"first", "second"} {
+		yamlConfig.Storages[name] = storageconfig.Storage{
+			Backend:    testYAMLUrl(t, "http://127.0.0.1:8082"),
+			Type:       auth.S3FixedKey,
+			Properties: map[string]string{"AccessKey": name, "Secret": name + "-secret"},
+		}
+	}
+	assert.Empty(t, Validate(yamlConfig, false))
+
+	yamlConfig.Storages["second"] = yamlConfig.Storages["first"]
+	assert.Len(t, Validate(yamlConfig, false), 1)
+}
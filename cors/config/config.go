@@ -0,0 +1,36 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// Rule defines cross-origin requests accepted by bucket
+type Rule struct {
+	// AllowedOrigins may contain one "*" wildcard, e.g. "https://*.example.com"
+	AllowedOrigins []string `yaml:"AllowedOrigins"`
+	// AllowedMethods are GET, PUT, POST, DELETE or HEAD
+	AllowedMethods []string `yaml:"AllowedMethods"`
+	// AllowedHeaders may be requested in preflight, may contain one "*"
+	// wildcard
+	AllowedHeaders []string `yaml:"AllowedHeaders"`
+	// ExposeHeaders are response headers accessible to browser scripts
+	ExposeHeaders []string `yaml:"ExposeHeaders"`
+	// MaxAge of preflight response in browser cache
+	MaxAge metrics.Interval `yaml:"MaxAge"`
+	// AllowCredentials allows requests with cookies or authorization
+	AllowCredentials bool `yaml:"AllowCredentials"`
+}
+
+// CORS configuration, cross-origin requests are handled by backends if no
+// rule is defined
+type CORS struct {
+	// Global rule applies to buckets without own rule
+	Global *Rule `yaml:"Global"`
+	// Buckets rules override Global rule
+	Buckets map[string]Rule `yaml:"Buckets"`
+	// AnswerOptions answers all OPTIONS requests at proxy, they never reach
+	// backends. Otherwise OPTIONS requests other than preflights of buckets
+	// with rules are sent to backends as HEAD
+	AnswerOptions bool `yaml:"AnswerOptions"`
+}
+
+// AllowedMethods lists methods accepted in rules
+var AllowedMethods = []string{"GET", "PUT", "POST", "DELETE", "HEAD"}
@@ -0,0 +1,220 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/akubra/cors/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// corsRoundTripper answers preflight requests of buckets with CORS rules and
+// adds CORS headers to responses of cross-origin requests
+type corsRoundTripper struct {
+	roundTripper  http.RoundTripper
+	global        *config.Rule
+	buckets       map[string]config.Rule
+	answerOptions bool
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (crt *corsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule := crt.rule(req)
+	if req.Method == http.MethodOptions && crt.answerOptions {
+		return options(req, rule), nil
+	}
+	if rule == nil {
+		return crt.roundTripper.RoundTrip(req)
+	}
+	origin := req.Header.Get("Origin")
+	if isPreflight(req) {
+		return preflight(req, rule, origin), nil
+	}
+	resp, err := crt.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	for name := range resp.Header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			resp.Header.Del(name)
+		}
+	}
+	resp.Header.Add("Vary", "Origin")
+	if origin != "" && matchesAny(rule.AllowedOrigins, origin) && contains(rule.AllowedMethods, req.Method) {
+		setAllowOrigin(resp.Header, rule, origin)
+		if len(rule.ExposeHeaders) > 0 {
+			resp.Header.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+		}
+	}
+	return resp, nil
+}
+
+// rule returns rule of requested bucket or global rule
+func (crt *corsRoundTripper) rule(req *http.Request) *config.Rule {
+	bucket, _ := utils.SplitBucketKey(req.URL.Path)
+	if rule, ok := crt.buckets[bucket]; ok {
+		return &rule
+	}
+	return crt.global
+}
+
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflight generates response to preflight request, it's never sent to
+// backends
+func preflight(req *http.Request, rule *config.Rule, origin string) *http.Response {
+	method := req.Header.Get("Access-Control-Request-Method")
+	requestedHeaders := make([]string, 0)
+	for _, header := range strings.Split(req.Header.Get("Access-Control-Request-Headers"), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			requestedHeaders = append(requestedHeaders, header)
+		}
+	}
+	if !matchesAny(rule.AllowedOrigins, origin) || !contains(rule.AllowedMethods, method) || !allowsHeaders(rule, requestedHeaders) {
+		return rejectPreflight(req, origin)
+	}
+	metrics.Mark("cors.preflight.accepted")
+	header := http.Header{}
+	setAllowOrigin(header, rule, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(requestedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if rule.MaxAge.Duration > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(rule.MaxAge.Duration.Seconds())))
+	}
+	header.Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	return emptyResponse(req, header)
+}
+
+func rejectPreflight(req *http.Request, origin string) *http.Response {
+	metrics.Mark("cors.preflight.rejected")
+	log.Debugf("Preflight request %s from origin %s rejected", req.Context().Value(log.ContextreqIDKey), origin)
+	resp := types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied, "CORSResponse: This CORS request is not allowed.")
+	resp.Header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	return resp
+}
+
+// options answers OPTIONS request at proxy, preflights of buckets without
+// rule are rejected, other requests get methods allowed by rule
+func options(req *http.Request, rule *config.Rule) *http.Response {
+	origin := req.Header.Get("Origin")
+	if isPreflight(req) {
+		if rule == nil {
+			return rejectPreflight(req, origin)
+		}
+		return preflight(req, rule, origin)
+	}
+	metrics.Mark("cors.options")
+	methods := config.AllowedMethods
+	if rule != nil {
+		methods = rule.AllowedMethods
+	}
+	header := http.Header{}
+	header.Set("Allow", strings.Join(append(append([]string{}, methods...), http.MethodOptions), ", "))
+	return emptyResponse(req, header)
+}
+
+func emptyResponse(req *http.Request, header http.Header) *http.Response {
+	header.Set("Content-Length", "0")
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Request:    req,
+		Body:       http.NoBody,
+	}
+}
+
+func setAllowOrigin(header http.Header, rule *config.Rule, origin string) {
+	if contains(rule.AllowedOrigins, "*") && !rule.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if rule.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func allowsHeaders(rule *config.Rule, headers []string) bool {
+	for _, header := range headers {
+		if !matchesAny(rule.AllowedHeaders, strings.ToLower(header)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny reports if value matches one of patterns, pattern may contain
+// single "*" wildcard
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		wildcard := strings.Index(pattern, "*")
+		if wildcard < 0 {
+			if pattern == value {
+				return true
+			}
+			continue
+		}
+		prefix, suffix := pattern[:wildcard], pattern[wildcard+1:]
+		if len(value) >= len(prefix)+len(suffix) && strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Decorator creates httphandler.Decorator handling cross-origin requests of
+// buckets according to CORS configuration, preflight requests are answered
+// without contacting backends. With AnswerOptions all OPTIONS requests are
+// answered by proxy
+func Decorator(conf config.CORS) httphandler.Decorator {
+	buckets := make(map[string]config.Rule, len(conf.Buckets))
+	for bucket, rule := range conf.Buckets {
+		buckets[bucket] = lowerHeaders(rule)
+	}
+	var global *config.Rule
+	if conf.Global != nil {
+		rule := lowerHeaders(*conf.Global)
+		global = &rule
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if global == nil && len(buckets) == 0 && !conf.AnswerOptions {
+			return roundTripper
+		}
+		return &corsRoundTripper{roundTripper: roundTripper, global: global, buckets: buckets, answerOptions: conf.AnswerOptions}
+	}
+}
+
+// lowerHeaders makes allowed headers matching case insensitive
+func lowerHeaders(rule config.Rule) config.Rule {
+	headers := make([]string, 0, len(rule.AllowedHeaders))
+	for _, header := range rule.AllowedHeaders {
+		headers = append(headers, strings.ToLower(header))
+	}
+	rule.AllowedHeaders = headers
+	return rule
+}
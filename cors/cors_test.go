@@ -0,0 +1,171 @@
+package cors
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/cors/config"
+	"github.com/allegro/akubra/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backendStub struct {
+	requests []*http.Request
+}
+
+func (bs *backendStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	bs.requests = append(bs.requests, req)
+	header := http.Header{}
+	header.Set("Access-Control-Allow-Origin", "https://backend.example.com")
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Request: req, Body: ioutil.NopCloser(strings.NewReader("OK"))}, nil
+}
+
+var corsConfig = config.CORS{
+	Global: &config.Rule{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "HEAD"},
+	},
+	Buckets: map[string]config.Rule{
+		"uploads": {
+			AllowedOrigins:   []string{"https://*.example.com"},
+			AllowedMethods:   []string{"GET", "PUT"},
+			AllowedHeaders:   []string{"Content-Type", "x-amz-*"},
+			ExposeHeaders:    []string{"ETag"},
+			MaxAge:           metrics.Interval{Duration: time.Hour},
+			AllowCredentials: true,
+		},
+	},
+}
+
+func newCORS(conf config.CORS) (http.RoundTripper, *backendStub) {
+	backend := &backendStub{}
+	return Decorator(conf)(backend), backend
+}
+
+func preflightRequest(path, origin, method, headers string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, "http://localhost"+path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return req
+}
+
+func TestShouldAnswerAllowedPreflightWithoutBackend(t *testing.T) {
+	rt, backend := newCORS(corsConfig)
+
+	resp, err := rt.RoundTrip(preflightRequest("/uploads/key", "https://app.example.com", "PUT", "content-type, X-Amz-Meta-Author"))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, PUT", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, X-Amz-Meta-Author", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "3600", resp.Header.Get("Access-Control-Max-Age"))
+	assert.Contains(t, resp.Header.Get("Vary"), "Origin")
+	assert.Empty(t, backend.requests)
+}
+
+func TestShouldRejectDisallowedPreflight(t *testing.T) {
+	testCases := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+	}{
+		{"origin", "https://example.org", "PUT", ""},
+		{"method", "https://app.example.com", "DELETE", ""},
+		{"header", "https://app.example.com", "PUT", "Authorization"},
+	}
+	for _, tc := range testCases {
+		rt, backend := newCORS(corsConfig)
+
+		resp, err := rt.RoundTrip(preflightRequest("/uploads/key", tc.origin, tc.method, tc.headers))
+		require.NoError(t, err, tc.name)
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, tc.name)
+		assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"), tc.name)
+		assert.Empty(t, backend.requests, tc.name)
+	}
+}
+
+func TestShouldUseGlobalRuleForBucketsWithoutOwnRule(t *testing.T) {
+	rt, _ := newCORS(corsConfig)
+
+	resp, err := rt.RoundTrip(preflightRequest("/images/key", "https://any.org", "GET", ""))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestShouldAddCORSHeadersToActualResponse(t *testing.T) {
+	rt, backend := newCORS(corsConfig)
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/uploads/key", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	require.Len(t, backend.requests, 1)
+	assert.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "ETag", resp.Header.Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", resp.Header.Get("Vary"))
+}
+
+func TestShouldNotAllowActualResponseOfDisallowedOrigin(t *testing.T) {
+	rt, _ := newCORS(corsConfig)
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/uploads/key", nil)
+	req.Header.Set("Origin", "https://example.org")
+
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", resp.Header.Get("Vary"))
+}
+
+func TestShouldPassRequestsOfBucketsWithoutRules(t *testing.T) {
+	rt, backend := newCORS(config.CORS{Buckets: corsConfig.Buckets})
+	req := preflightRequest("/images/key", "https://app.example.com", "GET", "")
+
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	require.Len(t, backend.requests, 1)
+	assert.Equal(t, http.MethodOptions, backend.requests[0].Method)
+	assert.Equal(t, "https://backend.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestShouldAnswerAllOptionsRequestsInAnswerOptionsMode(t *testing.T) {
+	rt, backend := newCORS(config.CORS{Buckets: corsConfig.Buckets, AnswerOptions: true})
+
+	optionsResp, err := rt.RoundTrip(httptest.NewRequest(http.MethodOptions, "http://localhost/uploads/key", nil))
+	require.NoError(t, err)
+	unknownBucketResp, err := rt.RoundTrip(httptest.NewRequest(http.MethodOptions, "http://localhost/images/key", nil))
+	require.NoError(t, err)
+	preflightResp, err := rt.RoundTrip(preflightRequest("/images/key", "https://app.example.com", "GET", ""))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, optionsResp.StatusCode)
+	assert.Equal(t, "GET, PUT, OPTIONS", optionsResp.Header.Get("Allow"))
+	assert.Equal(t, "GET, PUT, POST, DELETE, HEAD, OPTIONS", unknownBucketResp.Header.Get("Allow"))
+	assert.Equal(t, http.StatusForbidden, preflightResp.StatusCode)
+	assert.Empty(t, backend.requests)
+}
+
+func TestShouldPassOptionsRequestsWithoutAnswerOptionsMode(t *testing.T) {
+	rt, backend := newCORS(corsConfig)
+
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodOptions, "http://localhost/uploads/key", nil))
+	require.NoError(t, err)
+
+	assert.Len(t, backend.requests, 1)
+}
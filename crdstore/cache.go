@@ -0,0 +1,130 @@
+package crdstore
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/allegro/akubra/metrics"
+)
+
+// cacheEntry keeps secret key as bytes, so it can be zeroed on eviction
+type cacheEntry struct {
+	key    string
+	csd    CredentialsStoreData
+	secret []byte
+}
+
+// credentialsCache is LRU cache of credentials bounded by number of entries.
+// Secret keys of evicted and replaced entries are zeroed, loaded credentials
+// are copies of cached ones
+type credentialsCache struct {
+	mx            sync.Mutex
+	maxEntries    int
+	entries       map[string]*list.Element
+	lru           *list.List
+	metricsPrefix string
+}
+
+func newCredentialsCache(maxEntries int, metricsPrefix string) *credentialsCache {
+	return &credentialsCache{
+		maxEntries:    maxEntries,
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+		metricsPrefix: metricsPrefix,
+	}
+}
+
+// Load returns copy of cached credentials and marks them recently used
+func (cc *credentialsCache) Load(key string) (*CredentialsStoreData, bool) {
+	cc.mx.Lock()
+	defer cc.mx.Unlock()
+	element, ok := cc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	cc.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry).credentials(), true
+}
+
+// Store caches copy of credentials, least recently used entries are evicted
+// if cache is full
+func (cc *credentialsCache) Store(key string, csd *CredentialsStoreData) {
+	entry := &cacheEntry{key: key, csd: *csd, secret: []byte(csd.SecretKey)}
+	entry.csd.SecretKey = ""
+	cc.mx.Lock()
+	defer cc.mx.Unlock()
+	if element, ok := cc.entries[key]; ok {
+		cc.remove(element)
+	}
+	cc.entries[key] = cc.lru.PushFront(entry)
+	for cc.maxEntries > 0 && cc.lru.Len() > cc.maxEntries {
+		cc.remove(cc.lru.Back())
+		metrics.Mark(cc.metricsPrefix + ".evictions")
+	}
+	metrics.UpdateGauge(cc.metricsPrefix+".entries", int64(cc.lru.Len()))
+}
+
+// Delete drops cached credentials
+func (cc *credentialsCache) Delete(key string) {
+	cc.mx.Lock()
+	defer cc.mx.Unlock()
+	if element, ok := cc.entries[key]; ok {
+		cc.remove(element)
+		metrics.UpdateGauge(cc.metricsPrefix+".entries", int64(cc.lru.Len()))
+	}
+}
+
+// Purge drops all cached credentials
+func (cc *credentialsCache) Purge() {
+	cc.mx.Lock()
+	defer cc.mx.Unlock()
+	for cc.lru.Len() > 0 {
+		cc.remove(cc.lru.Back())
+	}
+	metrics.UpdateGauge(cc.metricsPrefix+".entries", 0)
+}
+
+// Range calls f with copies of cached credentials until f returns false
+func (cc *credentialsCache) Range(f func(key string, csd *CredentialsStoreData) bool) {
+	cc.mx.Lock()
+	entries := make([]*cacheEntry, 0, cc.lru.Len())
+	for element := cc.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, element.Value.(*cacheEntry))
+	}
+	snapshot := make([]*CredentialsStoreData, len(entries))
+	for i, entry := range entries {
+		snapshot[i] = entry.credentials()
+	}
+	cc.mx.Unlock()
+	for i, entry := range entries {
+		if !f(entry.key, snapshot[i]) {
+			return
+		}
+	}
+}
+
+// Len returns number of cached entries
+func (cc *credentialsCache) Len() int {
+	cc.mx.Lock()
+	defer cc.mx.Unlock()
+	return cc.lru.Len()
+}
+
+func (cc *credentialsCache) remove(element *list.Element) {
+	entry := cc.lru.Remove(element).(*cacheEntry)
+	delete(cc.entries, entry.key)
+	zero(entry.secret)
+}
+
+func (entry *cacheEntry) credentials() *CredentialsStoreData {
+	csd := entry.csd
+	csd.SecretKey = string(entry.secret)
+	return &csd
+}
+
+// zero overwrites secret bytes
+func zero(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
@@ -0,0 +1,50 @@
+package crdstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsCacheShouldEvictLeastRecentlyUsed(t *testing.T) {
+	cache := newCredentialsCache(2, "crdstore.test.cache")
+	cache.Store("first", &CredentialsStoreData{AccessKey: "first", SecretKey: "secret_1"})
+	cache.Store("second", &CredentialsStoreData{AccessKey: "second", SecretKey: "secret_2"})
+	_, ok := cache.Load("first")
+	require.True(t, ok)
+
+	cache.Store("third", &CredentialsStoreData{AccessKey: "third", SecretKey: "secret_3"})
+
+	require.Equal(t, 2, cache.Len())
+	_, ok = cache.Load("second")
+	require.False(t, ok, "least recently used entry should be evicted")
+	_, ok = cache.Load("first")
+	require.True(t, ok)
+	_, ok = cache.Load("third")
+	require.True(t, ok)
+}
+
+func TestCredentialsCacheShouldZeroDroppedSecrets(t *testing.T) {
+	cache := newCredentialsCache(1, "crdstore.test.cache")
+	cache.Store("first", &CredentialsStoreData{AccessKey: "first", SecretKey: "secret_1"})
+	evicted := cache.entries["first"].Value.(*cacheEntry)
+	cache.Store("second", &CredentialsStoreData{AccessKey: "second", SecretKey: "secret_2"})
+	replaced := cache.entries["second"].Value.(*cacheEntry)
+	cache.Store("second", &CredentialsStoreData{AccessKey: "second", SecretKey: "secret_3"})
+
+	require.Equal(t, make([]byte, len("secret_1")), evicted.secret)
+	require.Equal(t, make([]byte, len("secret_2")), replaced.secret)
+	csd, ok := cache.Load("second")
+	require.True(t, ok)
+	require.Equal(t, "secret_3", csd.SecretKey)
+}
+
+func TestCredentialsCacheShouldReturnCopies(t *testing.T) {
+	cache := newCredentialsCache(0, "crdstore.test.cache")
+	cache.Store("first", &CredentialsStoreData{AccessKey: "first", SecretKey: "secret_1"})
+	csd, _ := cache.Load("first")
+	csd.SecretKey = "changed"
+
+	csd, _ = cache.Load("first")
+	require.Equal(t, "secret_1", csd.SecretKey)
+}
@@ -0,0 +1,145 @@
+package crdstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// persistedCredentials is cache entry as written to cache file, EOL is kept
+// so TTL is honored across restarts
+type persistedCredentials struct {
+	AccessKey string    `json:"access"`
+	SecretKey string    `json:"secret"`
+	EOL       time.Time `json:"eol"`
+}
+
+// cacheFile persists credentials cache in JSON file, so cache is warm right
+// after restart instead of being filled with requests to credentials service.
+// File is encrypted with AES-GCM if key is given
+type cacheFile struct {
+	path  string
+	key   []byte
+	dirty chan struct{}
+}
+
+func newCacheFile(path string, key []byte) *cacheFile {
+	return &cacheFile{path: path, key: key, dirty: make(chan struct{}, 1)}
+}
+
+// load stores entries of cache file in cache, missing file is not an error
+func (cf *cacheFile) load(cache *credentialsCache) error {
+	data, err := ioutil.ReadFile(cf.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read credentials cache file %s: %s", cf.path, err)
+	}
+	if data, err = cf.open(data); err != nil {
+		return fmt.Errorf("unable to decrypt credentials cache file %s: %s", cf.path, err)
+	}
+	defer zero(data)
+	entries := make(map[string]persistedCredentials)
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("unable to parse credentials cache file %s: %s", cf.path, err)
+	}
+	for key, entry := range entries {
+		cache.Store(key, &CredentialsStoreData{AccessKey: entry.AccessKey, SecretKey: entry.SecretKey, EOL: entry.EOL})
+	}
+	return nil
+}
+
+// save writes credentials found in cache to temporary file and replaces cache
+// file with it, so file is never left partially written
+func (cf *cacheFile) save(cache *credentialsCache) error {
+	entries := make(map[string]persistedCredentials)
+	cache.Range(func(key string, csd *CredentialsStoreData) bool {
+		if csd.AccessKey != "" {
+			entries[key] = persistedCredentials{AccessKey: csd.AccessKey, SecretKey: csd.SecretKey, EOL: csd.EOL}
+		}
+		return true
+	})
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	defer zero(plaintext)
+	data, err := cf.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	tmpPath := cf.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("unable to write credentials cache file %s: %s", tmpPath, err)
+	}
+	return os.Rename(tmpPath, cf.path)
+}
+
+// scheduleSave requests cache write without waiting for it, requests made
+// while write is pending are coalesced
+func (cf *cacheFile) scheduleSave() {
+	select {
+	case cf.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// run writes cache on every scheduled save until done is closed
+func (cf *cacheFile) run(cache *credentialsCache, done <-chan struct{}) {
+	for {
+		select {
+		case <-cf.dirty:
+			if err := cf.save(cache); err != nil {
+				logger.WithField("file", cf.path).Errorf("Cannot persist credentials cache: %s", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// seal encrypts cache file content, nonce is prepended to ciphertext
+func (cf *cacheFile) seal(plaintext []byte) ([]byte, error) {
+	if cf.key == nil {
+		return plaintext, nil
+	}
+	gcm, err := cf.cipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts cache file content
+func (cf *cacheFile) open(data []byte) ([]byte, error) {
+	if cf.key == nil {
+		return data, nil
+	}
+	gcm, err := cf.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("file is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func (cf *cacheFile) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cf.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
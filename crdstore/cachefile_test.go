@@ -0,0 +1,101 @@
+package crdstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRestoreCredentialsFromCacheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	eol := time.Now().Add(5 * time.Second).Round(time.Millisecond)
+	cache := newCredentialsCache(0, "crdstore.test.cache")
+	cache.Store("access_____storage", &CredentialsStoreData{AccessKey: "access", SecretKey: "secret", EOL: eol})
+	cache.Store("missing_____storage", &CredentialsStoreData{EOL: eol, err: ErrCredentialsNotFound})
+
+	file := newCacheFile(filepath.Join(dir, "cache.json"), nil)
+	require.NoError(t, file.save(cache))
+	info, err := os.Stat(file.path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	restored := newCredentialsCache(0, "crdstore.test.cache")
+	require.NoError(t, file.load(restored))
+	csd, ok := restored.Load("access_____storage")
+	require.True(t, ok)
+	require.Equal(t, "secret", csd.SecretKey)
+	require.True(t, eol.Equal(csd.EOL), "EOL should be kept across restarts")
+	_, ok = restored.Load("missing_____storage")
+	require.False(t, ok, "negative entries should not be persisted")
+}
+
+func TestShouldIgnoreMissingCacheFile(t *testing.T) {
+	file := newCacheFile(filepath.Join(os.TempDir(), "crdstore-missing", "cache.json"), nil)
+	require.NoError(t, file.load(newCredentialsCache(0, "crdstore.test.cache")))
+}
+
+func TestShouldEncryptCacheFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	cache := newCredentialsCache(0, "crdstore.test.cache")
+	cache.Store("access_____storage", &CredentialsStoreData{AccessKey: "access", SecretKey: "secret", EOL: time.Now().Add(5 * time.Second)})
+
+	file := newCacheFile(filepath.Join(dir, "cache.json"), []byte("0123456789abcdef"))
+	require.NoError(t, file.save(cache))
+	content, err := ioutil.ReadFile(file.path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(content, []byte("secret")), "secret should not be stored in plain text")
+
+	restored := newCredentialsCache(0, "crdstore.test.cache")
+	require.NoError(t, file.load(restored))
+	csd, ok := restored.Load("access_____storage")
+	require.True(t, ok)
+	require.Equal(t, "secret", csd.SecretKey)
+
+	wrongKey := newCacheFile(file.path, []byte("fedcba9876543210"))
+	require.Error(t, wrongKey.load(newCredentialsCache(0, "crdstore.test.cache")))
+}
+
+func TestShouldRejectInvalidCacheFileKey(t *testing.T) {
+	key, err := cacheFileKey("")
+	require.NoError(t, err)
+	require.Nil(t, key)
+	key, err = cacheFileKey("MDEyMzQ1Njc4OWFiY2RlZg==")
+	require.NoError(t, err)
+	require.Equal(t, []byte("0123456789abcdef"), key)
+
+	for _, invalid := range []string{"not base64!", "c2hvcnQ="} {
+		_, err = cacheFileKey(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestStoreShouldNotBeCreatedWithInvalidCacheFileKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "cache.json")
+
+	_, err = NewStores(config.CredentialsStoreMap{
+		"encrypted": config.CredentialsStore{
+			Endpoint:     types.YAMLUrl{URL: &url.URL{Scheme: "http", Host: "127.0.0.1:8091"}},
+			CacheFile:    path,
+			CacheFileKey: "not base64!",
+		},
+	})
+
+	require.Error(t, err)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "cache file should not be written")
+}
@@ -5,13 +5,132 @@ import (
 	"github.com/allegro/akubra/types"
 )
 
+const (
+	// HTTPStore gets credentials from akubra-crdstore service
+	HTTPStore = "http"
+	// VaultStore gets credentials from HashiCorp Vault
+	VaultStore = "vault"
+	// FileStore gets credentials from local YAML file
+	FileStore = "file"
+	// VaultKV2 is Vault key value secrets engine version 2
+	VaultKV2 = "kv2"
+	// VaultAWS is Vault AWS secrets engine
+	VaultAWS = "aws"
+)
+
 // CredentialsStore configuration
 type CredentialsStore struct {
+	// Type is "http" (default), "vault" or "file"
+	Type string `yaml:"Type"`
 	// Endpoint url points ObjectStorage API url
 	Endpoint types.YAMLUrl `yaml:"Endpoint"`
-	// AuthRefreshInterval defines how often CredentialsStore cache will lookup for value changes
+	// Endpoints are failover credentials service urls, tried after Endpoint
+	Endpoints []types.YAMLUrl `yaml:"Endpoints"`
+	// Auth secures connections to every endpoint of store
+	Auth *Auth `yaml:"Auth,omitempty"`
+	// EndpointsAuth maps endpoint urls to their Auth, used instead of store Auth
+	EndpointsAuth map[string]Auth `yaml:"EndpointsAuth"`
+	// HealthCheckInterval defines how often unavailable endpoints are checked, default: 5s
+	HealthCheckInterval metrics.Interval `yaml:"HealthCheckInterval"`
+	// Vault configures store of "vault" type
+	Vault *Vault `yaml:"Vault,omitempty"`
+	// File is path of credentials YAML file of store of "file" type
+	File string `yaml:"File"`
+	// AuthRefreshInterval defines how often CredentialsStore cache will lookup for value changes, default: 10s
 	AuthRefreshInterval metrics.Interval `yaml:"AuthRefreshInterval"`
+	// NegativeTTL defines how long unknown credentials are cached, default: 2s
+	NegativeTTL metrics.Interval `yaml:"NegativeTTL"`
+	// RefreshThreshold is percent of AuthRefreshInterval after which entry is
+	// refreshed in background, default: 80
+	RefreshThreshold int `yaml:"RefreshThreshold"`
+	// DialTimeout limits connecting to credentials service, default: 50ms
+	DialTimeout metrics.Interval `yaml:"DialTimeout"`
+	// RequestTimeout limits single request to credentials service, default: 100ms
+	RequestTimeout metrics.Interval `yaml:"RequestTimeout"`
+	// MaxIdleConnsPerHost limits connections kept open to every endpoint for
+	// reuse, default: 64
+	MaxIdleConnsPerHost int `yaml:"MaxIdleConnsPerHost"`
+	// Retries is number of retries of requests failed with connection error
+	// or 5xx status, default: 0
+	Retries int `yaml:"Retries"`
+	// RetryBackoff is delay before first retry, doubled for every next one, default: 50ms
+	RetryBackoff metrics.Interval `yaml:"RetryBackoff"`
+	// CacheFile is path of file credentials cache is persisted in, cache is
+	// kept in memory only if empty
+	CacheFile string `yaml:"CacheFile"`
+	// CacheFileKey is base64 encoded AES key (16, 24 or 32 bytes) CacheFile is
+	// encrypted with, file is not encrypted if empty
+	CacheFileKey string `yaml:"CacheFileKey"`
+	// CacheSize limits number of cached credentials, least recently used are
+	// evicted, default: 10000
+	CacheSize int `yaml:"CacheSize"`
+	// Prefetch lists credentials fetched on startup
+	Prefetch *Prefetch `yaml:"Prefetch,omitempty"`
+}
+
+// Prefetch defines credentials of known tenants the cache is warmed with on
+// startup, credentials of every access key are fetched for every backend
+type Prefetch struct {
+	AccessKeys []string `yaml:"AccessKeys"`
+	Backends   []string `yaml:"Backends"`
+}
+
+// Vault configures credentials store of "vault" type, Vault servers
+// addresses are given as store endpoints
+type Vault struct {
+	// Token authenticates requests to Vault
+	Token string `yaml:"Token"`
+	// TokenFile is read on every request instead of Token, e.g. file written by Vault agent
+	TokenFile string `yaml:"TokenFile"`
+	// Engine is "kv2" (default) or "aws"
+	Engine string `yaml:"Engine"`
+	// Mount is secrets engine mount path, default: "secret" for kv2, "aws" for aws
+	Mount string `yaml:"Mount"`
+	// Path is secret path (kv2) or role name (aws), "{accessKey}" and "{backend}"
+	// are replaced with client access key and storage name, default:
+	// "akubra/{accessKey}/{backend}" for kv2, "{backend}" for aws
+	Path string `yaml:"Path"`
+}
+
+// Auth defines TLS and authentication options of connections to credentials
+// service endpoints
+type Auth struct {
+	// TLS configures https endpoints
+	TLS *TLS `yaml:"TLS,omitempty"`
+	// BearerToken is sent in Authorization header of every request
+	BearerToken string `yaml:"BearerToken"`
+	// BearerTokenFile is read on every request instead of BearerToken
+	BearerTokenFile string `yaml:"BearerTokenFile"`
+}
+
+// TLS defines https endpoint connection options
+type TLS struct {
+	// RootCAFile is PEM encoded CA bundle trusted instead of system roots
+	RootCAFile string `yaml:"RootCAFile"`
+	// CertFile and KeyFile are client certificate for mutual TLS
+	CertFile string `yaml:"CertFile"`
+	KeyFile  string `yaml:"KeyFile"`
+	// ServerName overrides SNI and verified certificate host name
+	ServerName string `yaml:"ServerName"`
 }
 
 // CredentialsStoreMap - map of credentialsStores configurations
 type CredentialsStoreMap map[string]CredentialsStore
+
+// AllEndpoints returns Endpoint, if defined, followed by Endpoints
+func (cs CredentialsStore) AllEndpoints() []types.YAMLUrl {
+	endpoints := make([]types.YAMLUrl, 0, len(cs.Endpoints)+1)
+	if cs.Endpoint.URL != nil {
+		endpoints = append(endpoints, cs.Endpoint)
+	}
+	return append(endpoints, cs.Endpoints...)
+}
+
+// EndpointAuth returns Auth of endpoint, EndpointsAuth entry takes precedence
+// over store Auth
+func (cs CredentialsStore) EndpointAuth(endpoint string) *Auth {
+	if auth, ok := cs.EndpointsAuth[endpoint]; ok {
+		return &auth
+	}
+	return cs.Auth
+}
@@ -1,149 +1,432 @@
 package crdstore
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"errors"
 
-	"sync"
-	"sync/atomic"
-	"unsafe"
-
 	"io/ioutil"
 
 	"github.com/allegro/akubra/crdstore/config"
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/sync/syncmap"
 )
 
 const (
-	keyPattern                   = "%s_____%s"
-	requestOptionsRequestTimeout = 100 * time.Millisecond
-	refreshTTLPercent            = 80 // Background refresh after refreshTTLPercent*TTL
+	keyPattern                 = "%s_____%s"
+	defaultTTL                 = 10 * time.Second
+	defaultNegativeTTL         = 2 * time.Second
+	defaultDialTimeout         = 50 * time.Millisecond
+	defaultRequestTimeout      = 100 * time.Millisecond
+	defaultRetryBackoff        = 50 * time.Millisecond
+	defaultRefreshPercent      = 80 // Background refresh after defaultRefreshPercent*TTL
+	refreshQueueSize           = 1024
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultCacheSize           = 10000
+	defaultMaxIdleConnsPerHost = 64
 )
 
 // ErrCredentialsNotFound - Credential for given accessKey and backend haven't been found in yaml file
 var ErrCredentialsNotFound = errors.New("credentials not found")
 
-// CredentialStore instance
-var instances map[string]*CredentialsStore
+// logger logs entries of "crdstore" subsystem
+var logger = log.For("crdstore")
 
 // CredentialsStore - gets a caches credentials from akubra-crdstore
 type CredentialsStore struct {
-	endpoint string
-	cache    *syncmap.Map
-	TTL      time.Duration
-	lock     sync.Mutex
+	endpoints []*endpoint
+	cache     *credentialsCache
+	TTL       time.Duration
+	file      *cacheFile
+	client    *http.Client
+	// negativeTTL is how long unknown credentials are cached
+	negativeTTL time.Duration
+	// refreshPercent is percent of TTL after which entry is refreshed in background
+	refreshPercent int
+	retries        int
+	retryBackoff   time.Duration
+	// filePath is credentials file of file store
+	filePath string
+	// metricsPrefix is "crdstore.<name>"
+	metricsPrefix string
+	// fetch gets credentials from endpoint, GetFromService is used if nil
+	fetch func(endpoint, accessKey, backend string) (*CredentialsStoreData, error)
+	// refreshGroup collapses concurrent refreshes of the same key
+	refreshGroup     singleflight.Group
+	refreshes        chan refreshRequest
+	pendingRefreshes syncmap.Map
+	// stopWatch stops watching credentials file of file store
+	stopWatch func()
+	// done is closed when store is closed, background goroutines exit then
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// refreshRequest identifies key queued for background refresh
+type refreshRequest struct {
+	accessKey string
+	backend   string
+	key       string
+}
+
+// transientError is error of request to credentials service which may succeed if retried
+type transientError struct {
+	error
+}
+
+// Stores are credentials stores of configuration, by name. Stores are created
+// with handler and closed when it's replaced
+type Stores map[string]*CredentialsStore
+
+// NewStores creates credentials stores of storeMap, stores created before
+// failure are closed
+func NewStores(storeMap config.CredentialsStoreMap) (Stores, error) {
+	stores := make(Stores, len(storeMap))
+	for name, cfg := range storeMap {
+		instance, err := newCredentialsStore(name, cfg)
+		if err != nil {
+			stores.Close()
+			return nil, fmt.Errorf("credentials store `%s` initialization failed: %s", name, err)
+		}
+		stores[name] = instance
+	}
+	return stores, nil
 }
 
-// GetInstance - Get crdstore instance for endpoint
-func GetInstance(endpointName string) (instance *CredentialsStore, err error) {
-	if instance, ok := instances[endpointName]; ok {
+// Get returns store named name
+func (stores Stores) Get(name string) (*CredentialsStore, error) {
+	if instance, ok := stores[name]; ok {
 		return instance, nil
 	}
-	return nil, fmt.Errorf("error credentialStore `%s` is not defined", endpointName)
+	return nil, fmt.Errorf("error credentialStore `%s` is not defined", name)
 }
 
-// InitializeCredentialsStore - Constructor for CredentialsStore
-func InitializeCredentialsStore(storeMap config.CredentialsStoreMap) {
-	instances = make(map[string]*CredentialsStore)
-	for name, cfg := range storeMap {
-		instances[name] = &CredentialsStore{
-			endpoint: cfg.Endpoint.String(),
-			cache:    new(syncmap.Map),
-			TTL:      cfg.AuthRefreshInterval.Duration,
+// Close closes all stores
+func (stores Stores) Close() {
+	for _, instance := range stores {
+		instance.Close()
+	}
+}
+
+func newCredentialsStore(name string, cfg config.CredentialsStore) (*CredentialsStore, error) {
+	dialer := &net.Dialer{Timeout: durationOrDefault(cfg.DialTimeout.Duration, defaultDialTimeout)}
+	transport, err := newEndpointsRoundTripper(cfg, dialer)
+	if err != nil {
+		return nil, err
+	}
+	metricsPrefix := fmt.Sprintf("crdstore.%s", metrics.Clean(name))
+	instance := &CredentialsStore{
+		cache:         newCredentialsCache(intOrDefault(cfg.CacheSize, defaultCacheSize), metricsPrefix+".cache"),
+		metricsPrefix: metricsPrefix,
+		TTL:           durationOrDefault(cfg.AuthRefreshInterval.Duration, defaultTTL),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   durationOrDefault(cfg.RequestTimeout.Duration, defaultRequestTimeout),
+		},
+		negativeTTL:    durationOrDefault(cfg.NegativeTTL.Duration, defaultNegativeTTL),
+		refreshes:      make(chan refreshRequest, refreshQueueSize),
+		refreshPercent: defaultRefreshPercent,
+		retries:        cfg.Retries,
+		retryBackoff:   durationOrDefault(cfg.RetryBackoff.Duration, defaultRetryBackoff),
+		done:           make(chan struct{}),
+	}
+	for _, endpointURL := range cfg.AllEndpoints() {
+		instance.endpoints = append(instance.endpoints, &endpoint{url: endpointURL.String()})
+	}
+	if cfg.Type == config.VaultStore && cfg.Vault != nil {
+		instance.fetch = newVaultProvider(instance.client, *cfg.Vault).get
+	}
+	if cfg.Type == config.FileStore {
+		provider, err := newFileProvider(cfg.File, instance.purgeCache)
+		if err != nil {
+			return nil, err
+		}
+		// File is the only "endpoint" of store, its errors are never transient
+		instance.endpoints = []*endpoint{{url: cfg.File}}
+		instance.filePath = cfg.File
+		instance.fetch = provider.get
+		instance.stopWatch = provider.stopWatch
+	}
+	if cfg.RefreshThreshold > 0 {
+		instance.refreshPercent = cfg.RefreshThreshold
+	}
+	if cfg.CacheFile != "" {
+		key, err := cacheFileKey(cfg.CacheFileKey)
+		if err != nil {
+			instance.Close()
+			return nil, err
+		}
+		instance.file = newCacheFile(cfg.CacheFile, key)
+		if err := instance.file.load(instance.cache); err != nil {
+			logger.WithField("store", name).Warnf("Credentials store starts with empty cache: %s", err)
 		}
+		go instance.file.run(instance.cache, instance.done)
 	}
+	if len(instance.endpoints) > 1 && cfg.Type != config.FileStore {
+		go instance.checkEndpoints(durationOrDefault(cfg.HealthCheckInterval.Duration, defaultHealthCheckInterval))
+	}
+	go instance.refresher()
+	if cfg.Prefetch != nil {
+		go instance.prefetchOnStartup(name, *cfg.Prefetch)
+	}
+	return instance, nil
+}
+
+// Close stops background refreshes, endpoint health checks, cache file writes
+// and credentials file watch. Closed store still serves credentials, so
+// requests in flight of replaced handler are finished
+func (cs *CredentialsStore) Close() {
+	cs.closeOnce.Do(func() {
+		if cs.done != nil {
+			close(cs.done)
+		}
+		if cs.stopWatch != nil {
+			cs.stopWatch()
+		}
+	})
+}
+
+// cacheFileKey decodes AES key of cache file, file isn't encrypted if
+// encodedKey is empty. Invalid key is an error, so secrets are never written in
+// plain text by mistake
+func cacheFileKey(encodedKey string) ([]byte, error) {
+	if encodedKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CacheFileKey: %s", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid CacheFileKey: AES key should have 16, 24 or 32 bytes, got %d", len(key))
+}
+
+func intOrDefault(value, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func durationOrDefault(duration, defaultDuration time.Duration) time.Duration {
+	if duration > 0 {
+		return duration
+	}
+	return defaultDuration
 }
 
 func (cs *CredentialsStore) prepareKey(accessKey, backend string) string {
 	return fmt.Sprintf(keyPattern, accessKey, backend)
 }
 
-func (cs *CredentialsStore) updateCache(accessKey, backend, key string, csd *CredentialsStoreData, blocking bool) (newCsd *CredentialsStoreData, err error) {
-	if !blocking {
-		if !cs.tryLock() {
-			return csd, nil
+// refresh gets credentials from service and updates cache. Concurrent
+// refreshes of the same key are collapsed into single request, which is not
+// canceled with ctx of any caller. Cached credentials are kept if service fails
+func (cs *CredentialsStore) refresh(ctx context.Context, accessKey, backend, key string) (*CredentialsStoreData, error) {
+	refreshed := cs.refreshGroup.DoChan(key, func() (interface{}, error) {
+		newCsd, err := cs.getFromServiceWithRetries(context.Background(), accessKey, backend)
+		eol := time.Now().Add(cs.TTL)
+		switch {
+		case err == nil:
+			newCsd.err = nil
+			// Leased credentials may expire before TTL
+			if !newCsd.EOL.IsZero() && newCsd.EOL.Before(eol) {
+				eol = newCsd.EOL
+			}
+		case err == ErrCredentialsNotFound:
+			newCsd = &CredentialsStoreData{err: ErrCredentialsNotFound}
+			eol = time.Now().Add(cs.negativeTTL)
+		default:
+			newCsd = &CredentialsStoreData{}
+			if cached, ok := cs.cache.Load(key); ok {
+				newCsd = cached
+			}
+			newCsd.err = err
+			logger.WithField("key", key).Warnf("Error while updating cache: %s", err)
 		}
-	} else {
-		cs.lock.Lock()
-	}
-	newCsd, err = cs.GetFromService(cs.endpoint, accessKey, backend)
-	switch {
-	case err == nil:
-		newCsd.err = nil
-	case err == ErrCredentialsNotFound:
-		newCsd = &CredentialsStoreData{EOL: time.Now().Add(cs.TTL), err: ErrCredentialsNotFound}
-	default:
-		if csd == nil {
-			newCsd = &CredentialsStoreData{EOL: time.Now().Add(cs.TTL), err: err}
-		} else {
-			*newCsd = *csd
+		newCsd.EOL = eol
+		cs.cache.Store(key, newCsd)
+		if cs.file != nil {
+			cs.file.scheduleSave()
 		}
-		newCsd.err = err
-		log.Printf("Error while updating cache for key `%s`: `%s`", key, err)
+		return newCsd, nil
+	})
+	var result singleflight.Result
+	select {
+	case result = <-refreshed:
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	newCsd.EOL = time.Now().Add(cs.TTL)
-	cs.cache.Store(key, newCsd)
-	cs.lock.Unlock()
+	newCsd := result.Val.(*CredentialsStoreData)
 	if newCsd.AccessKey == "" {
 		return nil, newCsd.err
 	}
 	return newCsd, nil
 }
 
-func (cs *CredentialsStore) tryLock() bool {
-	// #nosec
-	return atomic.CompareAndSwapInt32((*int32)(unsafe.Pointer(&cs.lock)), 0, 1)
+// purgeCache drops all cached credentials
+func (cs *CredentialsStore) purgeCache() {
+	cs.cache.Purge()
+	if cs.file != nil {
+		cs.file.scheduleSave()
+	}
+}
+
+// scheduleRefresh queues background refresh of key, unless it's already queued
+func (cs *CredentialsStore) scheduleRefresh(accessKey, backend, key string) {
+	if cs.refreshes == nil {
+		return
+	}
+	if _, queued := cs.pendingRefreshes.LoadOrStore(key, struct{}{}); queued {
+		return
+	}
+	select {
+	case cs.refreshes <- refreshRequest{accessKey: accessKey, backend: backend, key: key}:
+	default:
+		cs.pendingRefreshes.Delete(key)
+		logger.WithField("key", key).Debugf("Credentials refresh queue is full, key will be refreshed on expiration")
+	}
+}
+
+// refresher refreshes queued keys in background until store is closed
+func (cs *CredentialsStore) refresher() {
+	for {
+		select {
+		case request := <-cs.refreshes:
+			if _, err := cs.refresh(context.Background(), request.accessKey, request.backend, request.key); err != nil {
+				logger.WithField("key", request.key).Debugf("Failed to update cache %q", err)
+			}
+			cs.pendingRefreshes.Delete(request.key)
+		case <-cs.done:
+			return
+		}
+	}
 }
 
 // Get - Gets key from cache or from akubra-crdstore if TTL has expired
 func (cs *CredentialsStore) Get(accessKey, backend string) (csd *CredentialsStoreData, err error) {
+	return cs.GetWithContext(context.Background(), accessKey, backend)
+}
+
+// GetWithContext gets key like Get, it stops waiting for credentials service
+// when ctx is done
+func (cs *CredentialsStore) GetWithContext(ctx context.Context, accessKey, backend string) (csd *CredentialsStoreData, err error) {
 	key := cs.prepareKey(accessKey, backend)
 
-	if value, ok := cs.cache.Load(key); ok {
-		csd = value.(*CredentialsStoreData)
+	csd, _ = cs.cache.Load(key)
+	refreshTimeoutDuration := cs.TTL / 100 * time.Duration(100-cs.refreshPercent)
+	if cause := missCause(csd); cause != "" {
+		cs.markCache("miss." + cause)
+		return cs.refresh(ctx, accessKey, backend, key)
 	}
-	refreshTimeoutDuration := cs.TTL / 100 * (100 - refreshTTLPercent)
+	if csd.AccessKey == "" {
+		cs.markCache("negative_hit")
+		return nil, ErrCredentialsNotFound
+	}
+	if time.Now().Add(refreshTimeoutDuration).After(csd.EOL) {
+		cs.scheduleRefresh(accessKey, backend, key)
+	}
+	cs.markCache("hit")
+
+	return
+}
+
+// missCause tells why cached entry cannot be used, it's empty if it can.
+// Unexpired entries of unknown credentials are used until negative TTL passes
+func missCause(csd *CredentialsStoreData) string {
 	switch {
-	case csd == nil || csd.AccessKey == "":
-		return cs.updateCache(accessKey, backend, key, csd, true)
+	case csd == nil:
+		return "missing"
 	case time.Now().After(csd.EOL):
-		return cs.updateCache(accessKey, backend, key, csd, false)
-	case time.Now().Add(refreshTimeoutDuration).After(csd.EOL):
-		go func() {
-			_, err := cs.updateCache(accessKey, backend, key, csd, false)
-			if err != nil {
-				log.Debugln("Failed to update cache %q", err)
-			}
-		}()
+		return "expired"
+	case csd.AccessKey == "" && csd.err != ErrCredentialsNotFound:
+		return "error"
 	}
+	return ""
+}
 
-	return
+// markCache counts cache hits and misses by their cause
+func (cs *CredentialsStore) markCache(result string) {
+	metrics.Mark(cs.metricsPrefix + ".cache." + result)
+}
+
+// getFromServiceWithRetries asks endpoints in order of availability until one
+// of them responds, transient failures of all endpoints are retried with
+// exponential backoff
+func (cs *CredentialsStore) getFromServiceWithRetries(ctx context.Context, accessKey, backend string) (csd *CredentialsStoreData, err error) {
+	backoff := cs.retryBackoff
+	for attempt := 0; ; attempt++ {
+		for _, e := range cs.orderedEndpoints() {
+			if cs.fetch != nil {
+				csd, err = cs.fetch(e.url, accessKey, backend)
+			} else {
+				csd, err = cs.GetFromServiceWithContext(ctx, e.url, accessKey, backend)
+			}
+			cs.markEndpoint(e, err)
+			if _, transient := err.(transientError); !transient {
+				return csd, err
+			}
+		}
+		if attempt >= cs.retries {
+			return csd, err
+		}
+		logger.WithFields(log.Fields{"access_key": accessKey, "backend": backend}).Debugf("Retrying credentials request in %s: %s", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return csd, ctx.Err()
+		}
+		backoff *= 2
+	}
 }
 
 // GetFromService - Get Credential akubra-crdstore service
 func (cs *CredentialsStore) GetFromService(endpoint, accessKey, backend string) (csd *CredentialsStoreData, err error) {
+	return cs.GetFromServiceWithContext(context.Background(), endpoint, accessKey, backend)
+}
+
+// GetFromServiceWithContext gets credentials from akubra-crdstore service,
+// request is canceled when ctx is done
+func (cs *CredentialsStore) GetFromServiceWithContext(ctx context.Context, endpoint, accessKey, backend string) (csd *CredentialsStoreData, err error) {
 	csd = &CredentialsStoreData{}
-	client := http.Client{
-		Timeout: requestOptionsRequestTimeout,
+	client := cs.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultRequestTimeout}
 	}
-	resp, err := client.Get(fmt.Sprintf(urlPattern, endpoint, accessKey, backend))
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(urlPattern, endpoint, accessKey, backend), nil)
+	if err != nil {
+		return csd, err
+	}
+	since := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	cs.collectMetrics(resp, err, since)
+	if err != nil {
+		return csd, transientError{fmt.Errorf("unable to make request to credentials store service - err: %s", err)}
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Warnf("Cannot close request body: %q", closeErr)
+		}
+	}()
 	switch {
-	case err != nil:
-		return csd, fmt.Errorf("unable to make request to credentials store service - err: %s", err)
 	case resp.StatusCode == http.StatusNotFound:
 		return nil, ErrCredentialsNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return csd, transientError{fmt.Errorf("unable to get credentials from store service - StatusCode: %d (backend: `%s`, endpoint: `%s`", resp.StatusCode, backend, endpoint)}
 	case resp.StatusCode != http.StatusOK:
 		return csd, fmt.Errorf("unable to get credentials from store service - StatusCode: %d (backend: `%s`, endpoint: `%s`", resp.StatusCode, backend, endpoint)
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Printf("Cannot close request body: %q\n", closeErr)
-		}
-	}()
 
 	credentials, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -158,3 +441,16 @@ func (cs *CredentialsStore) GetFromService(endpoint, accessKey, backend string)
 
 	return
 }
+
+func (cs *CredentialsStore) collectMetrics(resp *http.Response, err error, since time.Time) {
+	if cs.metricsPrefix == "" {
+		return
+	}
+	metrics.UpdateSince(cs.metricsPrefix+".service.all", since)
+	if err != nil {
+		metrics.UpdateSince(cs.metricsPrefix+".service.err", since)
+	}
+	if resp != nil {
+		metrics.UpdateSince(fmt.Sprintf(cs.metricsPrefix+".service.status_%d", resp.StatusCode), since)
+	}
+}
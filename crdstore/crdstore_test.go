@@ -1,6 +1,7 @@
 package crdstore
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -9,8 +10,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/allegro/akubra/crdstore/config"
 	"github.com/allegro/akubra/log"
@@ -29,8 +33,19 @@ const (
 	existingStorage = "storage_exists"
 	errorAccess     = "access_error"
 	errorStorage    = "storage_error"
+	flakyAccess     = "access_flaky"
+	flakyStorage    = "storage_flaky"
+	countedAccess   = "access_counted"
+	countedStorage  = "storage_counted"
+	batchAccess     = "access_batch"
+	batchStorage    = "storage_batch"
 )
 
+var flakyFailures, countedCalls int32
+
+// testStores are stores of initConfig
+var testStores Stores
+
 var existingCredentials = CredentialsStoreData{AccessKey: "access_exists", SecretKey: "secret_exists"}
 
 func httpHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +72,46 @@ func httpHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Cannot write crdstore OK response %q", err)
 		}
 
+	case fmt.Sprintf("/%s/%s", flakyAccess, flakyStorage):
+		if atomic.AddInt32(&flakyFailures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		resp, _ := json.Marshal(CredentialsStoreData{AccessKey: flakyAccess, SecretKey: "secret_flaky"})
+		_, err := w.Write(resp)
+		if err != nil {
+			log.Printf("Cannot write crdstore OK response %q", err)
+		}
+
+	case fmt.Sprintf("/%s/%s", countedAccess, countedStorage):
+		atomic.AddInt32(&countedCalls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		resp, _ := json.Marshal(CredentialsStoreData{AccessKey: countedAccess, SecretKey: "secret_counted"})
+		_, err := w.Write(resp)
+		if err != nil {
+			log.Printf("Cannot write crdstore OK response %q", err)
+		}
+
+	case prefetchPath:
+		var keys []prefetchKey
+		if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fetched := make([]prefetchedCredentials, 0, len(keys))
+		for _, key := range keys {
+			if key.AccessKey == batchAccess && key.Backend == batchStorage {
+				fetched = append(fetched, prefetchedCredentials{prefetchKey: key, Credentials: CredentialsStoreData{AccessKey: batchAccess, SecretKey: "secret_batch"}})
+			}
+		}
+		resp, _ := json.Marshal(fetched)
+		_, err := w.Write(resp)
+		if err != nil {
+			log.Printf("Cannot write crdstore OK response %q", err)
+		}
+
 	case fmt.Sprintf("/%s/%s", emptyAccess, emptyStorage):
 		w.WriteHeader(http.StatusOK)
 	default:
@@ -70,9 +125,16 @@ func initConfig() {
 	cfg := config.CredentialsStoreMap{
 		"default": config.CredentialsStore{Endpoint: types.YAMLUrl{URL: mockURL}, AuthRefreshInterval: metrics.Interval{Duration: 10 * time.Second}},
 		"invalid": config.CredentialsStore{Endpoint: types.YAMLUrl{URL: invalidURL}, AuthRefreshInterval: metrics.Interval{Duration: 10 * time.Second}},
+		"retrying": config.CredentialsStore{Endpoint: types.YAMLUrl{URL: mockURL}, AuthRefreshInterval: metrics.Interval{Duration: 10 * time.Second},
+			Retries: 2, RetryBackoff: metrics.Interval{Duration: time.Millisecond}},
+		"failover": config.CredentialsStore{Endpoints: []types.YAMLUrl{{URL: invalidURL}, {URL: mockURL}},
+			AuthRefreshInterval: metrics.Interval{Duration: 10 * time.Second}},
 	}
 
-	InitializeCredentialsStore(cfg)
+	var err error
+	if testStores, err = NewStores(cfg); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -92,7 +154,7 @@ func TestMain(m *testing.M) {
 }
 func TestShouldPrepareInternalKeyBasedOnAccessAndStorageType(t *testing.T) {
 	expectedKey := "access_____storage_type"
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 	key := cs.prepareKey("access", "storage_type")
 	require.Equal(t, expectedKey, key, "keys must be equal")
@@ -100,7 +162,7 @@ func TestShouldPrepareInternalKeyBasedOnAccessAndStorageType(t *testing.T) {
 
 func TestShouldSetCredentialsFromExternalServiceEndpoint(t *testing.T) {
 	t.Skip("FIXME: mock existing storage")
-	cs, _ := GetInstance("default")
+	cs, _ := testStores.Get("default")
 
 	csd, err := cs.Get(existingCredentials.AccessKey, existingStorage)
 	require.NoError(t, err)
@@ -109,7 +171,7 @@ func TestShouldSetCredentialsFromExternalServiceEndpoint(t *testing.T) {
 }
 
 func TestShouldNotCacheCredentialOnErrorFromExternalService(t *testing.T) {
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 	_, err = cs.Get("access_error", "storage_error")
 	require.Error(t, err)
@@ -118,7 +180,7 @@ func TestShouldNotCacheCredentialOnErrorFromExternalService(t *testing.T) {
 func TestShouldGetCredentialFromCacheIfExternalServiceFails(t *testing.T) {
 	expectedCredentials := &CredentialsStoreData{AccessKey: errorAccess, SecretKey: "secret_1"}
 
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 	cs.cache.Store(cs.prepareKey(errorAccess, errorStorage), expectedCredentials)
 	crd, err := cs.Get(errorAccess, errorStorage)
@@ -130,7 +192,7 @@ func TestShouldGetCredentialFromCacheIfExternalServiceFails(t *testing.T) {
 func TestShouldGetCredentialFromCacheIfConnectionRefused(t *testing.T) {
 	expectedCredentials := &CredentialsStoreData{AccessKey: errorAccess, SecretKey: "secret_1"}
 
-	cs, err := GetInstance("invalid")
+	cs, err := testStores.Get("invalid")
 	require.NoError(t, err)
 	cs.cache.Store(cs.prepareKey(errorAccess, errorStorage), expectedCredentials)
 	crd, err := cs.Get(errorAccess, errorStorage)
@@ -141,7 +203,7 @@ func TestShouldGetCredentialFromCacheIfConnectionRefused(t *testing.T) {
 
 func TestShouldGetCredentialFromCacheIfTTLIsNotExpired(t *testing.T) {
 	expectedCredentials := &CredentialsStoreData{AccessKey: existingAccess, SecretKey: "secret_1", EOL: time.Now().Add(10 * time.Second)}
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 
 	cs.cache.Store(cs.prepareKey(existingAccess, existingStorage), expectedCredentials)
@@ -154,7 +216,7 @@ func TestShouldGetCredentialFromCacheIfTTLIsNotExpired(t *testing.T) {
 func TestShouldUpdateCredentialsIfTTLIsExpired(t *testing.T) {
 	oldCredentials := &CredentialsStoreData{AccessKey: existingAccess, SecretKey: "secret_1", EOL: time.Now().Add(-20 * time.Second)}
 
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 
 	cs.cache.Store(cs.prepareKey(existingAccess, existingStorage), oldCredentials)
@@ -169,7 +231,7 @@ func TestShouldDeleteCachedCredentialsOnErrCredentialsNotFound(t *testing.T) {
 	backend := "no_storage"
 	oldCredentials := &CredentialsStoreData{AccessKey: accessKey, SecretKey: "secret_1", EOL: time.Now().Add(-10 * time.Second)}
 
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 
 	cs.cache.Store(cs.prepareKey("not_existing", backend), oldCredentials)
@@ -179,40 +241,46 @@ func TestShouldDeleteCachedCredentialsOnErrCredentialsNotFound(t *testing.T) {
 	require.Nil(t, crd)
 }
 
-func TestShouldGetCredentialsFromCacheIfUpdateIsLocked(t *testing.T) {
-	expectedCredentials := &CredentialsStoreData{AccessKey: existingAccess, SecretKey: "secret_1", EOL: time.Now().Add(-11 * time.Second)}
-	cs, err := GetInstance("default")
+func TestShouldCollapseConcurrentRefreshesOfKey(t *testing.T) {
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
-	cs.cache.Store(cs.prepareKey(existingAccess, existingStorage), expectedCredentials)
-	cs.lock.Lock()
-	crd, err := cs.Get(existingAccess, existingStorage)
-	cs.lock.Unlock()
+	atomic.StoreInt32(&countedCalls, 0)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			crd, err := cs.Get(countedAccess, countedStorage)
+			require.NoError(t, err)
+			require.Equal(t, "secret_counted", crd.SecretKey)
+		}()
+	}
+	wg.Wait()
 
-	require.NoError(t, err)
-	require.Equal(t, expectedCredentials.SecretKey, crd.SecretKey)
+	require.Equal(t, int32(1), atomic.LoadInt32(&countedCalls))
 }
 
 func TestShouldUpdateCacheInBackground(t *testing.T) {
 	cachedCredentials := &CredentialsStoreData{AccessKey: existingAccess, SecretKey: "secret_1", EOL: time.Now().Add(1 * time.Second)}
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 
-	cs.cache.Store(cs.prepareKey(existingAccess, existingStorage), cachedCredentials)
-	_, err = cs.Get(existingAccess, existingStorage)
+	key := cs.prepareKey(existingAccess, existingStorage)
+	cs.cache.Store(key, cachedCredentials)
+	crd, err := cs.Get(existingAccess, existingStorage)
 	require.NoError(t, err)
+	require.Equal(t, cachedCredentials.SecretKey, crd.SecretKey)
 
-	time.Sleep(1 * time.Second)
+	time.Sleep(200 * time.Millisecond)
 
-	cs.lock.Lock()
-	crd, err := cs.Get(existingAccess, existingStorage)
-	cs.lock.Unlock()
-
-	require.NoError(t, err)
-	require.Equal(t, existingCredentials.SecretKey, crd.SecretKey)
+	value, ok := cs.cache.Load(key)
+	require.True(t, ok)
+	require.Equal(t, existingCredentials.SecretKey, value.SecretKey)
 }
 
 func TestShouldGetAnErrorOnInvalidJSON(t *testing.T) {
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 	crd, err := cs.Get(invalidAccess, invalidStorage)
 
@@ -221,10 +289,135 @@ func TestShouldGetAnErrorOnInvalidJSON(t *testing.T) {
 }
 
 func TestShouldGetAnErrorOnEmptyString(t *testing.T) {
-	cs, err := GetInstance("default")
+	cs, err := testStores.Get("default")
 	require.NoError(t, err)
 	crd, err := cs.Get(emptyAccess, emptyStorage)
 
 	require.Error(t, err)
 	require.Nil(t, crd)
 }
+
+func TestShouldRetryTransientServiceErrors(t *testing.T) {
+	cs, err := testStores.Get("retrying")
+	require.NoError(t, err)
+
+	atomic.StoreInt32(&flakyFailures, 2)
+	crd, err := cs.Get(flakyAccess, flakyStorage)
+	require.NoError(t, err)
+	require.Equal(t, "secret_flaky", crd.SecretKey)
+
+	atomic.StoreInt32(&flakyFailures, 4)
+	_, err = cs.GetFromService(httpEndpoint, flakyAccess, flakyStorage)
+	require.Error(t, err)
+	_, err = cs.getFromServiceWithRetries(context.Background(), flakyAccess, flakyStorage)
+	require.Error(t, err, "retries should be limited")
+}
+
+func TestShouldNotRetryClientErrors(t *testing.T) {
+	cs, err := testStores.Get("retrying")
+	require.NoError(t, err)
+
+	_, err = cs.GetFromService(httpEndpoint, errorAccess, errorStorage)
+	require.Error(t, err)
+	_, transient := err.(transientError)
+	require.False(t, transient)
+}
+
+func TestShouldStopWaitingForCredentialsWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		httpHandler(w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+	cs := &CredentialsStore{
+		cache:     newCredentialsCache(0, "crdstore.test.cache"),
+		TTL:       time.Second,
+		endpoints: []*endpoint{{url: server.URL}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	crd, err := cs.GetWithContext(ctx, existingAccess, existingStorage)
+
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, crd)
+}
+
+func TestShouldTellCacheMissCause(t *testing.T) {
+	valid := time.Now().Add(time.Second)
+	require.Equal(t, "missing", missCause(nil))
+	require.Equal(t, "expired", missCause(&CredentialsStoreData{AccessKey: "access", EOL: time.Now().Add(-time.Second)}))
+	require.Equal(t, "", missCause(&CredentialsStoreData{EOL: valid, err: ErrCredentialsNotFound}))
+	require.Equal(t, "error", missCause(&CredentialsStoreData{EOL: valid, err: fmt.Errorf("service unavailable")}))
+	require.Equal(t, "", missCause(&CredentialsStoreData{AccessKey: "access", EOL: valid}))
+}
+
+func TestShouldCacheUnknownCredentialsForNegativeTTL(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	cs := &CredentialsStore{
+		cache:       newCredentialsCache(0, "crdstore.test.cache"),
+		TTL:         time.Second,
+		negativeTTL: 100 * time.Millisecond,
+		endpoints:   []*endpoint{{url: server.URL}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cs.Get("access_bogus", "storage")
+			require.Equal(t, ErrCredentialsNotFound, err)
+		}()
+	}
+	wg.Wait()
+	_, err := cs.Get("access_bogus", "storage")
+	require.Equal(t, ErrCredentialsNotFound, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls), "concurrent and repeated misses should make single request")
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = cs.Get("access_bogus", "storage")
+	require.Equal(t, ErrCredentialsNotFound, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls), "unknown credentials should be requested again after negative TTL")
+}
+
+func TestNewStoresShouldReportInvalidStore(t *testing.T) {
+	stores, err := NewStores(config.CredentialsStoreMap{
+		"missing": config.CredentialsStore{Type: config.FileStore, File: "/nonexistent/credentials.yaml"},
+	})
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "credentials store `missing` initialization failed")
+	require.Nil(t, stores)
+}
+
+func TestClosedStoreShouldServeCredentials(t *testing.T) {
+	endpointURL, err := url.Parse(httpEndpoint)
+	require.NoError(t, err)
+	stores, err := NewStores(config.CredentialsStoreMap{
+		"default": config.CredentialsStore{Endpoint: types.YAMLUrl{URL: endpointURL}},
+	})
+	require.NoError(t, err)
+	cs, err := stores.Get("default")
+	require.NoError(t, err)
+
+	stores.Close()
+	stores.Close()
+
+	crd, err := cs.Get(existingAccess, existingStorage)
+	require.NoError(t, err)
+	require.Equal(t, existingCredentials.SecretKey, crd.SecretKey)
+	select {
+	case <-cs.done:
+	default:
+		t.Fatal("background goroutines of closed store should be stopped")
+	}
+}
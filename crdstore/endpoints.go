@@ -0,0 +1,123 @@
+package crdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// endpoint is credentials service instance, it's marked unavailable after
+// transient failure until successful request or health check
+type endpoint struct {
+	url         string
+	unavailable int32
+}
+
+func (e *endpoint) available() bool {
+	return atomic.LoadInt32(&e.unavailable) == 0
+}
+
+// setAvailable changes endpoint state, it reports if state has changed
+func (e *endpoint) setAvailable(available bool) bool {
+	if available {
+		return atomic.CompareAndSwapInt32(&e.unavailable, 1, 0)
+	}
+	return atomic.CompareAndSwapInt32(&e.unavailable, 0, 1)
+}
+
+// orderedEndpoints returns available endpoints in configured order followed
+// by unavailable ones, which are tried as last resort
+func (cs *CredentialsStore) orderedEndpoints() []*endpoint {
+	ordered := make([]*endpoint, 0, len(cs.endpoints))
+	for _, e := range cs.endpoints {
+		if e.available() {
+			ordered = append(ordered, e)
+		}
+	}
+	for _, e := range cs.endpoints {
+		if !e.available() {
+			ordered = append(ordered, e)
+		}
+	}
+	return ordered
+}
+
+// markEndpoint records result of request to endpoint
+func (cs *CredentialsStore) markEndpoint(e *endpoint, err error) {
+	_, transient := err.(transientError)
+	if !e.setAvailable(!transient) {
+		return
+	}
+	if transient {
+		logger.WithField("endpoint", e.url).Warnf("Credentials store endpoint marked unavailable: %s", err)
+		return
+	}
+	logger.WithField("endpoint", e.url).Infof("Credentials store endpoint is available again")
+}
+
+// checkEndpoints probes unavailable endpoints every interval until store is
+// closed. Any response below 500 means endpoint accepts requests again
+func (cs *CredentialsStore) checkEndpoints(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-cs.done:
+			return
+		}
+		for _, e := range cs.endpoints {
+			if e.available() {
+				continue
+			}
+			if err := cs.probe(context.Background(), e); err != nil {
+				logger.WithField("endpoint", e.url).Debugf("Credentials store endpoint health check failed: %s", err)
+				continue
+			}
+			if e.setAvailable(true) {
+				logger.WithField("endpoint", e.url).Infof("Credentials store endpoint is available again")
+			}
+		}
+	}
+}
+
+// Check reports if credentials store is reachable, any of its endpoints has
+// to respond with status below 500. File of file store has to exist
+func (cs *CredentialsStore) Check(ctx context.Context) error {
+	if cs.filePath != "" {
+		_, err := os.Stat(cs.filePath)
+		return err
+	}
+	var err error
+	for _, e := range cs.orderedEndpoints() {
+		if err = cs.probe(ctx, e); err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("no endpoints defined")
+	}
+	return err
+}
+
+func (cs *CredentialsStore) probe(ctx context.Context, e *endpoint) error {
+	req, err := http.NewRequest(http.MethodGet, e.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		logger.Debugf("Cannot close health check response body: %s", closeErr)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("endpoint %s responded with status %d", e.url, resp.StatusCode)
+	}
+	return nil
+}
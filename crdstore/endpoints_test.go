@@ -0,0 +1,61 @@
+package crdstore
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldFailoverToNextEndpoint(t *testing.T) {
+	cs, err := testStores.Get("failover")
+	require.NoError(t, err)
+	require.Len(t, cs.endpoints, 2)
+
+	crd, err := cs.getFromServiceWithRetries(context.Background(), existingAccess, existingStorage)
+	require.NoError(t, err)
+	require.Equal(t, existingCredentials.SecretKey, crd.SecretKey)
+
+	require.False(t, cs.endpoints[0].available())
+	require.True(t, cs.endpoints[1].available())
+	require.Equal(t, []*endpoint{cs.endpoints[1], cs.endpoints[0]}, cs.orderedEndpoints())
+}
+
+func TestShouldNotMarkEndpointUnavailableOnClientErrors(t *testing.T) {
+	cs := &CredentialsStore{endpoints: []*endpoint{{url: httpEndpoint}}, client: &http.Client{Timeout: time.Second}}
+
+	_, err := cs.getFromServiceWithRetries(context.Background(), errorAccess, errorStorage)
+	require.Error(t, err)
+	_, err = cs.getFromServiceWithRetries(context.Background(), "not_existing", "storage")
+	require.Equal(t, ErrCredentialsNotFound, err)
+
+	require.True(t, cs.endpoints[0].available())
+}
+
+func TestShouldRestoreEndpointAfterHealthCheck(t *testing.T) {
+	unavailable := &endpoint{url: httpEndpoint, unavailable: 1}
+	cs := &CredentialsStore{endpoints: []*endpoint{unavailable}, client: &http.Client{Timeout: time.Second}}
+
+	go cs.checkEndpoints(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	require.True(t, unavailable.available())
+}
+
+func TestCheckShouldSucceedIfAnyEndpointResponds(t *testing.T) {
+	cs, err := testStores.Get("failover")
+	require.NoError(t, err)
+
+	require.NoError(t, cs.Check(context.Background()))
+
+	cs = &CredentialsStore{endpoints: []*endpoint{cs.endpoints[0]}, client: cs.client}
+	require.Error(t, cs.Check(context.Background()))
+}
+
+func TestCheckShouldVerifyFileOfFileStore(t *testing.T) {
+	cs := &CredentialsStore{filePath: "/not/existing/credentials.yaml"}
+
+	require.Error(t, cs.Check(context.Background()))
+}
@@ -0,0 +1,92 @@
+package crdstore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// fileCredentials are backend credentials as defined in credentials file
+type fileCredentials struct {
+	AccessKey string `yaml:"AccessKey"`
+	SecretKey string `yaml:"SecretKey"`
+}
+
+// fileProvider serves credentials defined in YAML file mapping access keys
+// to storage names and their credentials. File is reloaded on change
+type fileProvider struct {
+	path        string
+	mx          sync.RWMutex
+	content     []byte
+	credentials map[string]map[string]fileCredentials
+	onReload    func()
+	// stopWatch stops watching file for changes
+	stopWatch func()
+}
+
+func newFileProvider(path string, onReload func()) (*fileProvider, error) {
+	fp := &fileProvider{path: path, onReload: onReload}
+	if _, err := fp.reload(); err != nil {
+		return nil, err
+	}
+	stopWatch, err := watchFile(path, fp.reloadOnChange)
+	if err != nil {
+		logger.WithField("file", path).Warnf("Credentials file will not be reloaded on change: %s", err)
+		stopWatch = func() {}
+	}
+	fp.stopWatch = stopWatch
+	return fp, nil
+}
+
+// get returns credentials of accessKey for backend, endpoint is ignored
+func (fp *fileProvider) get(_, accessKey, backend string) (*CredentialsStoreData, error) {
+	fp.mx.RLock()
+	defer fp.mx.RUnlock()
+	credentials, ok := fp.credentials[accessKey][backend]
+	if !ok {
+		return nil, ErrCredentialsNotFound
+	}
+	return &CredentialsStoreData{AccessKey: credentials.AccessKey, SecretKey: credentials.SecretKey}, nil
+}
+
+// reload reads credentials file, it reports if file content has changed
+func (fp *fileProvider) reload() (bool, error) {
+	content, err := ioutil.ReadFile(fp.path)
+	if err != nil {
+		return false, fmt.Errorf("unable to read credentials file %s: %s", fp.path, err)
+	}
+	fp.mx.RLock()
+	unchanged := fp.credentials != nil && bytes.Equal(content, fp.content)
+	fp.mx.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	credentials := make(map[string]map[string]fileCredentials)
+	if err = yaml.Unmarshal(content, &credentials); err != nil {
+		return false, fmt.Errorf("unable to parse credentials file %s: %s", fp.path, err)
+	}
+	fp.mx.Lock()
+	fp.content = content
+	fp.credentials = credentials
+	fp.mx.Unlock()
+	return true, nil
+}
+
+// reloadOnChange reloads file after change notification, invalid file is
+// ignored and previous credentials are kept
+func (fp *fileProvider) reloadOnChange() {
+	changed, err := fp.reload()
+	if err != nil {
+		logger.WithField("file", fp.path).Errorf("Credentials file not reloaded: %s", err)
+		return
+	}
+	if changed {
+		logger.WithField("file", fp.path).Infof("Credentials file reloaded")
+		if fp.onReload != nil {
+			fp.onReload()
+		}
+	}
+}
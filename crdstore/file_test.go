@@ -0,0 +1,59 @@
+package crdstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCredentialsFile = `
+client-access:
+  akubra:
+    AccessKey: client-access
+    SecretKey: client-secret
+  storage1:
+    AccessKey: backend-access
+    SecretKey: backend-secret
+`
+
+func TestShouldGetCredentialsFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testCredentialsFile), 0600))
+	reloads := 0
+
+	fp, err := newFileProvider(path, func() { reloads++ })
+	require.NoError(t, err)
+	defer fp.stopWatch()
+
+	csd, err := fp.get("", "client-access", "storage1")
+	require.NoError(t, err)
+	require.Equal(t, "backend-access", csd.AccessKey)
+	require.Equal(t, "backend-secret", csd.SecretKey)
+	_, err = fp.get("", "client-access", "storage2")
+	require.Equal(t, ErrCredentialsNotFound, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("client-access: [invalid"), 0600))
+	fp.reloadOnChange()
+	_, err = fp.get("", "client-access", "storage1")
+	require.NoError(t, err, "credentials should be kept if file is invalid")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("other-access:\n  storage1: {AccessKey: a, SecretKey: s}\n"), 0600))
+	fp.reloadOnChange()
+	_, err = fp.get("", "client-access", "storage1")
+	require.Equal(t, ErrCredentialsNotFound, err)
+	csd, err = fp.get("", "other-access", "storage1")
+	require.NoError(t, err)
+	require.Equal(t, "s", csd.SecretKey)
+	require.True(t, reloads > 0)
+}
+
+func TestShouldFailOnMissingCredentialsFile(t *testing.T) {
+	_, err := newFileProvider(filepath.Join(os.TempDir(), "crdstore-missing", "credentials.yaml"), nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,50 @@
+package crdstore
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchFileEvents are events of file directory which may change file,
+// directory is watched so files replaced with rename or symlink swap
+// (e.g. Kubernetes ConfigMap volumes) are noticed
+const watchFileEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE | unix.IN_DELETE
+
+// watchFile calls onChange after changes in directory of path, detected with
+// inotify, until returned stop function is called
+func watchFile(path string, onChange func()) (func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := unix.InotifyAddWatch(fd, filepath.Dir(path), watchFileEvents)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer func() { _ = unix.Close(fd) }()
+		buf := make([]byte, 4096)
+		for {
+			_, err := unix.Read(fd, buf)
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err != nil {
+				logger.WithField("file", path).Warnf("Watching stopped: %s", err)
+				return
+			}
+			onChange()
+		}
+	}()
+	// Removed watch generates IN_IGNORED event, which wakes blocked read up
+	stop := func() {
+		close(done)
+		_, _ = unix.InotifyRmWatch(fd, uint32(wd))
+	}
+	return stop, nil
+}
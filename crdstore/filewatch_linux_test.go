@@ -0,0 +1,50 @@
+package crdstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldNotifyAboutReplacedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0600))
+	var changes int32
+
+	stop, err := watchFile(path, func() { atomic.AddInt32(&changes, 1) })
+	require.NoError(t, err)
+	defer stop()
+	tmpPath := filepath.Join(dir, "credentials.yaml.new")
+	require.NoError(t, ioutil.WriteFile(tmpPath, []byte("{}"), 0600))
+	atomic.StoreInt32(&changes, 0)
+	require.NoError(t, os.Rename(tmpPath, path))
+	time.Sleep(100 * time.Millisecond)
+
+	require.True(t, atomic.LoadInt32(&changes) > 0)
+}
+
+func TestShouldNotNotifyAfterWatchIsStopped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0600))
+	var changes int32
+
+	stop, err := watchFile(path, func() { atomic.AddInt32(&changes, 1) })
+	require.NoError(t, err)
+	stop()
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0600))
+	time.Sleep(100 * time.Millisecond)
+
+	require.Zero(t, atomic.LoadInt32(&changes))
+}
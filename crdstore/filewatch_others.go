@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package crdstore
+
+import (
+	"os"
+	"time"
+)
+
+// watchFilePollInterval is how often file is checked for changes
+const watchFilePollInterval = 5 * time.Second
+
+// watchFile calls onChange after changes of path modification time or size,
+// until returned stop function is called
+func watchFile(path string, onChange func()) (func(), error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(watchFilePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			current, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if !current.ModTime().Equal(info.ModTime()) || current.Size() != info.Size() {
+				info = current
+				onChange()
+			}
+		}
+	}()
+	return func() { close(done) }, nil
+}
@@ -0,0 +1,144 @@
+package crdstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/log"
+)
+
+// prefetchPath is batch endpoint of credentials service
+const prefetchPath = "/prefetch"
+
+// prefetchKey identifies credentials requested from batch endpoint
+type prefetchKey struct {
+	AccessKey string `json:"access"`
+	Backend   string `json:"backend"`
+}
+
+// prefetchedCredentials is single entry of batch endpoint response,
+// credentials missing in response are not cached
+type prefetchedCredentials struct {
+	prefetchKey
+	Credentials CredentialsStoreData `json:"credentials"`
+}
+
+// errPrefetchUnsupported is returned by services without batch endpoint
+var errPrefetchUnsupported = errors.New("credentials store service does not support prefetch")
+
+// Prefetch warms cache with credentials of every access key for every backend.
+// Credentials are fetched with single batched request, stores without batch
+// support are asked for every pair separately
+func (cs *CredentialsStore) Prefetch(accessKeys []string, backends []string) error {
+	keys := make([]prefetchKey, 0, len(accessKeys)*len(backends))
+	for _, accessKey := range accessKeys {
+		for _, backend := range backends {
+			keys = append(keys, prefetchKey{AccessKey: accessKey, Backend: backend})
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if cs.fetch != nil {
+		return cs.prefetchOneByOne(keys)
+	}
+	var err error
+	for _, e := range cs.orderedEndpoints() {
+		var fetched []prefetchedCredentials
+		fetched, err = cs.getBatchFromService(e.url, keys)
+		if err == errPrefetchUnsupported {
+			return cs.prefetchOneByOne(keys)
+		}
+		cs.markEndpoint(e, err)
+		if err == nil {
+			cs.storePrefetched(fetched)
+			return nil
+		}
+		if _, transient := err.(transientError); !transient {
+			return err
+		}
+	}
+	return err
+}
+
+// prefetchOnStartup warms cache with configured credentials
+func (cs *CredentialsStore) prefetchOnStartup(name string, prefetch config.Prefetch) {
+	if err := cs.Prefetch(prefetch.AccessKeys, prefetch.Backends); err != nil {
+		logger.WithField("store", name).Warnf("Credentials store prefetch failed: %s", err)
+		return
+	}
+	logger.WithField("store", name).Infof("Credentials store prefetched credentials of %d access keys", len(prefetch.AccessKeys))
+}
+
+// prefetchOneByOne refreshes every key, first error is returned
+func (cs *CredentialsStore) prefetchOneByOne(keys []prefetchKey) (err error) {
+	for _, pk := range keys {
+		_, refreshErr := cs.refresh(context.Background(), pk.AccessKey, pk.Backend, cs.prepareKey(pk.AccessKey, pk.Backend))
+		if refreshErr != nil && refreshErr != ErrCredentialsNotFound && err == nil {
+			err = refreshErr
+		}
+	}
+	return
+}
+
+// storePrefetched caches credentials received from batch endpoint
+func (cs *CredentialsStore) storePrefetched(fetched []prefetchedCredentials) {
+	eol := time.Now().Add(cs.TTL)
+	for _, entry := range fetched {
+		if entry.Credentials.AccessKey == "" {
+			continue
+		}
+		csd := entry.Credentials
+		csd.EOL = eol
+		cs.cache.Store(cs.prepareKey(entry.AccessKey, entry.Backend), &csd)
+	}
+	if cs.file != nil {
+		cs.file.scheduleSave()
+	}
+	log.Debugf("Prefetched %d credentials", len(fetched))
+}
+
+// getBatchFromService posts requested keys to batch endpoint of credentials service
+func (cs *CredentialsStore) getBatchFromService(endpoint string, keys []prefetchKey) ([]prefetchedCredentials, error) {
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	client := cs.client
+	if client == nil {
+		client = &http.Client{Timeout: defaultRequestTimeout}
+	}
+	resp, err := client.Post(endpoint+prefetchPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, transientError{fmt.Errorf("unable to make prefetch request to credentials store service - err: %s", err)}
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Warnf("Cannot close request body: %q", closeErr)
+		}
+	}()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return nil, errPrefetchUnsupported
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, transientError{fmt.Errorf("unable to prefetch credentials from store service - StatusCode: %d (endpoint: `%s`)", resp.StatusCode, endpoint)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unable to prefetch credentials from store service - StatusCode: %d (endpoint: `%s`)", resp.StatusCode, endpoint)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read prefetch response body from credentials store service - err: %s", err)
+	}
+	var fetched []prefetchedCredentials
+	if err = json.Unmarshal(content, &fetched); err != nil {
+		return nil, fmt.Errorf("unable to parse prefetch response from credentials store service - err: %s", err)
+	}
+	return fetched, nil
+}
@@ -0,0 +1,45 @@
+package crdstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldPrefetchCredentialsInSingleBatch(t *testing.T) {
+	cs, err := testStores.Get("default")
+	require.NoError(t, err)
+
+	require.NoError(t, cs.Prefetch([]string{batchAccess, "access_unknown"}, []string{batchStorage}))
+
+	csd, ok := cs.cache.Load(cs.prepareKey(batchAccess, batchStorage))
+	require.True(t, ok, "batch only credentials should be cached")
+	require.Equal(t, "secret_batch", csd.SecretKey)
+	_, ok = cs.cache.Load(cs.prepareKey("access_unknown", batchStorage))
+	require.False(t, ok)
+}
+
+func TestShouldPrefetchOneByOneIfBatchIsUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefetchPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		httpHandler(w, r)
+	}))
+	defer server.Close()
+	cs := &CredentialsStore{
+		cache:     newCredentialsCache(0, "crdstore.test.cache"),
+		TTL:       time.Second,
+		endpoints: []*endpoint{{url: server.URL}},
+	}
+
+	require.NoError(t, cs.Prefetch([]string{existingAccess}, []string{existingStorage, "storage_unknown"}))
+
+	csd, ok := cs.cache.Load(cs.prepareKey(existingAccess, existingStorage))
+	require.True(t, ok)
+	require.Equal(t, existingCredentials.SecretKey, csd.SecretKey)
+}
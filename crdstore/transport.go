@@ -0,0 +1,142 @@
+package crdstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/crdstore/config"
+)
+
+// endpointTransport sends requests to single endpoint with its TLS settings
+// and credentials
+type endpointTransport struct {
+	prefix          string
+	transport       http.RoundTripper
+	bearerToken     string
+	bearerTokenFile string
+}
+
+// endpointsRoundTripper applies Auth of endpoint request is sent to,
+// requests to other urls go through default transport
+type endpointsRoundTripper struct {
+	defaultTransport http.RoundTripper
+	endpoints        []endpointTransport
+}
+
+// idleConnTimeout is how long pooled connections to credentials service are kept
+const idleConnTimeout = 90 * time.Second
+
+func newEndpointsRoundTripper(cfg config.CredentialsStore, dialer *net.Dialer) (http.RoundTripper, error) {
+	maxIdleConnsPerHost := intOrDefault(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	rt := &endpointsRoundTripper{defaultTransport: newPooledTransport(dialer, nil, maxIdleConnsPerHost)}
+	for _, endpointURL := range cfg.AllEndpoints() {
+		auth := cfg.EndpointAuth(endpointURL.String())
+		if auth == nil {
+			continue
+		}
+		et := endpointTransport{
+			prefix:          strings.TrimSuffix(endpointURL.String(), "/"),
+			transport:       rt.defaultTransport,
+			bearerToken:     auth.BearerToken,
+			bearerTokenFile: auth.BearerTokenFile,
+		}
+		if auth.TLS != nil {
+			tlsConfig, err := newTLSConfig(*auth.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("endpoint %s: %s", endpointURL.String(), err)
+			}
+			et.transport = newPooledTransport(dialer, tlsConfig, maxIdleConnsPerHost)
+		}
+		rt.endpoints = append(rt.endpoints, et)
+	}
+	return rt, nil
+}
+
+// newPooledTransport creates transport keeping up to maxIdleConnsPerHost
+// connections to every endpoint for reuse
+func newPooledTransport(dialer *net.Dialer, tlsConfig *tls.Config, maxIdleConnsPerHost int) *http.Transport {
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+	}
+}
+
+func newTLSConfig(conf config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: conf.ServerName}
+	if conf.RootCAFile != "" {
+		caPEM, err := ioutil.ReadFile(conf.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read RootCAFile: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in RootCAFile %q", conf.RootCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// RoundTrip sends request with transport and credentials of matching endpoint
+func (rt *endpointsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	et := rt.match(req.URL.String())
+	if et == nil {
+		return rt.defaultTransport.RoundTrip(req)
+	}
+	token, err := et.token()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		// RoundTripper should not modify request
+		authorized := new(http.Request)
+		*authorized = *req
+		authorized.Header = make(http.Header, len(req.Header)+1)
+		for name, values := range req.Header {
+			authorized.Header[name] = values
+		}
+		authorized.Header.Set("Authorization", "Bearer "+token)
+		req = authorized
+	}
+	return et.transport.RoundTrip(req)
+}
+
+// match returns endpoint with the longest url prefix of requested url
+func (rt *endpointsRoundTripper) match(url string) *endpointTransport {
+	var matched *endpointTransport
+	for i, et := range rt.endpoints {
+		if url != et.prefix && !strings.HasPrefix(url, et.prefix+"/") {
+			continue
+		}
+		if matched == nil || len(et.prefix) > len(matched.prefix) {
+			matched = &rt.endpoints[i]
+		}
+	}
+	return matched
+}
+
+func (et *endpointTransport) token() (string, error) {
+	if et.bearerTokenFile == "" {
+		return et.bearerToken, nil
+	}
+	token, err := ioutil.ReadFile(et.bearerTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read BearerTokenFile: %s", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
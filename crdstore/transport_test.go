@@ -0,0 +1,70 @@
+package crdstore
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldSendCredentialsRequestsWithEndpointAuth(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		httpHandler(w, r)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "crdstore")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, caPEM, 0600))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("token\n"), 0600))
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	cfg := config.CredentialsStore{
+		Endpoint:      types.YAMLUrl{URL: serverURL},
+		EndpointsAuth: map[string]config.Auth{server.URL: {TLS: &config.TLS{RootCAFile: caFile}, BearerTokenFile: tokenFile}},
+	}
+	transport, err := newEndpointsRoundTripper(cfg, &net.Dialer{})
+	require.NoError(t, err)
+	cs := &CredentialsStore{client: &http.Client{Transport: transport}}
+
+	csd, err := cs.GetFromService(server.URL, existingAccess, existingStorage)
+	require.NoError(t, err)
+	require.Equal(t, existingCredentials.SecretKey, csd.SecretKey)
+
+	cfg.EndpointsAuth = nil
+	transport, err = newEndpointsRoundTripper(cfg, &net.Dialer{})
+	require.NoError(t, err)
+	cs = &CredentialsStore{client: &http.Client{Transport: transport}}
+	_, err = cs.GetFromService(server.URL, existingAccess, existingStorage)
+	require.Error(t, err, "server certificate should not be trusted without RootCAFile")
+}
+
+func TestShouldRejectInvalidRootCAFile(t *testing.T) {
+	serverURL, err := url.Parse("https://localhost:8443")
+	require.NoError(t, err)
+	cfg := config.CredentialsStore{
+		Endpoint: types.YAMLUrl{URL: serverURL},
+		Auth:     &config.Auth{TLS: &config.TLS{RootCAFile: "/nonexistent/ca.pem"}},
+	}
+
+	_, err = newEndpointsRoundTripper(cfg, &net.Dialer{})
+
+	require.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package crdstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/crdstore/config"
+	"golang.org/x/sync/syncmap"
+)
+
+const (
+	// vaultLeaseMargin is time before lease expiration when it's not renewed anymore
+	vaultLeaseMargin = 5 * time.Second
+	// vaultRenewIncrement is lease extension requested on renewal
+	vaultRenewIncrement = "1h"
+)
+
+type vaultResponse struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int64           `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+}
+
+type vaultKVData struct {
+	Data struct {
+		AccessKey string `json:"access"`
+		SecretKey string `json:"secret"`
+	} `json:"data"`
+}
+
+type vaultAWSData struct {
+	AccessKey     string `json:"access_key"`
+	SecretKey     string `json:"secret_key"`
+	SecurityToken string `json:"security_token"`
+}
+
+// vaultLease is renewable lease of credentials generated by secrets engine
+type vaultLease struct {
+	id          string
+	credentials CredentialsStoreData
+	end         time.Time
+}
+
+// vaultProvider reads credentials from HashiCorp Vault secrets engine. Static
+// credentials are read from KV v2 engine with "access" and "secret" fields,
+// dynamic ones are generated by AWS engine and their leases are renewed as
+// long as Vault allows
+type vaultProvider struct {
+	client *http.Client
+	conf   config.Vault
+	leases syncmap.Map
+	now    func() time.Time
+}
+
+func newVaultProvider(client *http.Client, conf config.Vault) *vaultProvider {
+	if conf.Engine == "" {
+		conf.Engine = config.VaultKV2
+	}
+	if conf.Mount == "" {
+		conf.Mount = map[string]string{config.VaultKV2: "secret", config.VaultAWS: "aws"}[conf.Engine]
+	}
+	if conf.Path == "" {
+		conf.Path = map[string]string{config.VaultKV2: "akubra/{accessKey}/{backend}", config.VaultAWS: "{backend}"}[conf.Engine]
+	}
+	return &vaultProvider{client: client, conf: conf, now: time.Now}
+}
+
+// get returns credentials of accessKey for backend, lease of previously
+// generated credentials is renewed instead of generating new ones
+func (vp *vaultProvider) get(endpoint, accessKey, backend string) (*CredentialsStoreData, error) {
+	path := strings.NewReplacer("{accessKey}", accessKey, "{backend}", backend).Replace(vp.conf.Path)
+	if vp.conf.Engine == config.VaultAWS {
+		key := fmt.Sprintf(keyPattern, accessKey, backend)
+		if value, ok := vp.leases.Load(key); ok {
+			lease := value.(*vaultLease)
+			if vp.now().Add(vaultLeaseMargin).Before(lease.end) {
+				csd, err := vp.renew(endpoint, lease)
+				if err == nil {
+					return csd, nil
+				}
+				logger.WithField("path", path).Warnf("Cannot renew Vault lease, new credentials will be generated: %s", err)
+			}
+			vp.leases.Delete(key)
+		}
+		return vp.generate(endpoint, key, path)
+	}
+	resp, err := vp.do(endpoint, http.MethodGet, "/v1/"+vp.conf.Mount+"/data/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := vaultKVData{}
+	if err = json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("unable to parse Vault secret %s: %s", path, err)
+	}
+	if data.Data.AccessKey == "" || data.Data.SecretKey == "" {
+		return nil, fmt.Errorf("vault secret %s has no access and secret fields", path)
+	}
+	return &CredentialsStoreData{AccessKey: data.Data.AccessKey, SecretKey: data.Data.SecretKey}, nil
+}
+
+// generate reads new credentials from AWS engine role
+func (vp *vaultProvider) generate(endpoint, key, path string) (*CredentialsStoreData, error) {
+	resp, err := vp.do(endpoint, http.MethodGet, "/v1/"+vp.conf.Mount+"/creds/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	data := vaultAWSData{}
+	if err = json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("unable to parse Vault credentials %s: %s", path, err)
+	}
+	if data.SecurityToken != "" {
+		return nil, fmt.Errorf("vault role %s issues STS credentials, which are not supported", path)
+	}
+	lease := &vaultLease{
+		id:          resp.LeaseID,
+		credentials: CredentialsStoreData{AccessKey: data.AccessKey, SecretKey: data.SecretKey},
+		end:         vp.now().Add(time.Duration(resp.LeaseDuration) * time.Second),
+	}
+	if resp.Renewable && resp.LeaseID != "" {
+		vp.leases.Store(key, lease)
+	}
+	return lease.credentialsData(), nil
+}
+
+// credentialsData returns leased credentials, which expire before lease does
+func (lease *vaultLease) credentialsData() *CredentialsStoreData {
+	return &CredentialsStoreData{
+		AccessKey: lease.credentials.AccessKey,
+		SecretKey: lease.credentials.SecretKey,
+		EOL:       lease.end.Add(-vaultLeaseMargin),
+	}
+}
+
+// renew extends lease of generated credentials
+func (vp *vaultProvider) renew(endpoint string, lease *vaultLease) (*CredentialsStoreData, error) {
+	body, err := json.Marshal(map[string]string{"lease_id": lease.id, "increment": vaultRenewIncrement})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := vp.do(endpoint, http.MethodPut, "/v1/sys/leases/renew", body)
+	if err != nil {
+		return nil, err
+	}
+	lease.end = vp.now().Add(time.Duration(resp.LeaseDuration) * time.Second)
+	return lease.credentialsData(), nil
+}
+
+// do sends authorized request to Vault. Connection errors and 5xx responses
+// are transient, so other endpoints are tried
+func (vp *vaultProvider) do(endpoint, method, path string, body []byte) (*vaultResponse, error) {
+	token, err := vp.token()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := vp.client.Do(req)
+	if err != nil {
+		return nil, transientError{fmt.Errorf("unable to make request to Vault - err: %s", err)}
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			logger.Warnf("Cannot close Vault response body: %q", closeErr)
+		}
+	}()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	switch {
+	case err != nil:
+		return nil, transientError{fmt.Errorf("unable to read Vault response - err: %s", err)}
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrCredentialsNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, transientError{fmt.Errorf("vault request %s %s failed - StatusCode: %d", method, path, resp.StatusCode)}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("vault request %s %s failed - StatusCode: %d", method, path, resp.StatusCode)
+	}
+	vaultResp := &vaultResponse{}
+	if err = json.Unmarshal(respBody, vaultResp); err != nil {
+		return nil, fmt.Errorf("unable to parse Vault response: %s", err)
+	}
+	return vaultResp, nil
+}
+
+// token returns configured token, token file is read on every call, so
+// token rotated by Vault agent is picked up
+func (vp *vaultProvider) token() (string, error) {
+	if vp.conf.TokenFile == "" {
+		return vp.conf.Token, nil
+	}
+	token, err := ioutil.ReadFile(vp.conf.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read Vault token: %s", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,80 @@
+package crdstore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/crdstore/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldReadCredentialsFromVaultKV2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		if r.URL.Path != "/v1/secret/data/akubra/access/storage" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write([]byte(`{"data": {"data": {"access": "backend-access", "secret": "backend-secret"}, "metadata": {"version": 1}}}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+	vp := newVaultProvider(server.Client(), config.Vault{Token: "vault-token"})
+
+	csd, err := vp.get(server.URL, "access", "storage")
+	require.NoError(t, err)
+	require.Equal(t, "backend-access", csd.AccessKey)
+	require.Equal(t, "backend-secret", csd.SecretKey)
+
+	_, err = vp.get(server.URL, "access", "missing")
+	require.Equal(t, ErrCredentialsNotFound, err)
+}
+
+func TestShouldRenewVaultAWSCredentialsLease(t *testing.T) {
+	generated, renewed := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/aws/creds/storage":
+			generated++
+			_, err := w.Write([]byte(`{"lease_id": "aws/creds/storage/1", "lease_duration": 60, "renewable": true,
+				"data": {"access_key": "AKIA", "secret_key": "generated", "security_token": null}}`))
+			require.NoError(t, err)
+		case "/v1/sys/leases/renew":
+			renewed++
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			request := map[string]string{}
+			require.NoError(t, json.Unmarshal(body, &request))
+			require.Equal(t, "aws/creds/storage/1", request["lease_id"])
+			_, err = w.Write([]byte(`{"lease_id": "aws/creds/storage/1", "lease_duration": 30, "renewable": true}`))
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	now := time.Now()
+	vp := newVaultProvider(server.Client(), config.Vault{Token: "vault-token", Engine: config.VaultAWS})
+	vp.now = func() time.Time { return now }
+
+	csd, err := vp.get(server.URL, "access", "storage")
+	require.NoError(t, err)
+	require.Equal(t, "generated", csd.SecretKey)
+	require.Equal(t, now.Add(55*time.Second), csd.EOL)
+
+	csd, err = vp.get(server.URL, "access", "storage")
+	require.NoError(t, err)
+	require.Equal(t, "generated", csd.SecretKey)
+	require.Equal(t, now.Add(25*time.Second), csd.EOL)
+	require.Equal(t, 1, generated)
+	require.Equal(t, 1, renewed)
+
+	now = now.Add(28 * time.Second)
+	_, err = vp.get(server.URL, "access", "storage")
+	require.NoError(t, err)
+	require.Equal(t, 2, generated, "expiring lease should be replaced")
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+const (
+	// StaticKeys wraps object keys with master keys defined in configuration
+	StaticKeys = "static"
+	// VaultTransit wraps object keys with HashiCorp Vault transit engine
+	VaultTransit = "vault"
+)
+
+// Encryption configuration of object bodies encrypted by proxy, objects are
+// not encrypted if KeyProvider is not defined
+type Encryption struct {
+	// KeyProvider wrapping keys of objects, "static" or "vault"
+	KeyProvider string `yaml:"KeyProvider"`
+	// MasterKeys maps IDs to base64 encoded 32 bytes AES keys of "static"
+	// provider, keys other than MasterKeyID are used for decryption only
+	MasterKeys map[string]string `yaml:"MasterKeys"`
+	// MasterKeyID is ID of master key wrapping keys of new objects
+	MasterKeyID string `yaml:"MasterKeyID"`
+	// Vault configures "vault" provider
+	Vault *Vault `yaml:"Vault,omitempty"`
+	// Buckets lists buckets which objects are encrypted, all if empty
+	Buckets []string `yaml:"Buckets"`
+}
+
+// Vault configures transit secrets engine generating and decrypting object
+// keys
+type Vault struct {
+	// Endpoint is Vault server url
+	Endpoint types.YAMLUrl `yaml:"Endpoint"`
+	// Token authenticates requests to Vault
+	Token string `yaml:"Token"`
+	// TokenFile is read on every request instead of Token, e.g. file written by Vault agent
+	TokenFile string `yaml:"TokenFile"`
+	// Mount is transit engine mount path, default: "transit"
+	Mount string `yaml:"Mount"`
+	// KeyName is name of transit key wrapping keys of new objects
+	KeyName string `yaml:"KeyName"`
+	// RequestTimeout limits single request to Vault, default: 1s
+	RequestTimeout metrics.Interval `yaml:"RequestTimeout"`
+}
@@ -0,0 +1,440 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/akubra/encryption/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// Object metadata describing encryption, stored by backends as user metadata
+const (
+	schemeHeader    = "X-Amz-Meta-Akubra-Encryption"
+	keyHeader       = "X-Amz-Meta-Akubra-Encryption-Key"
+	keyIDHeader     = "X-Amz-Meta-Akubra-Encryption-Key-Id"
+	plainSizeHeader = "X-Amz-Meta-Akubra-Unencrypted-Content-Length"
+	plainETagHeader = "X-Amz-Meta-Akubra-Unencrypted-Etag"
+	// scheme names cipher and segment size of encrypted objects
+	scheme = "AES256-GCM-64K"
+)
+
+// encryptingRoundTripper encrypts bodies of objects uploaded to encrypted
+// buckets and decrypts bodies of encrypted objects. Backends store only
+// cipher text and wrapped object key
+type encryptingRoundTripper struct {
+	roundTripper http.RoundTripper
+	keys         keyProvider
+	buckets      map[string]bool
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (ert *encryptingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	if key == "" {
+		return ert.roundTripper.RoundTrip(req)
+	}
+	switch req.Method {
+	case http.MethodPut, http.MethodPost:
+		if !ert.encrypts(bucket) {
+			return ert.roundTripper.RoundTrip(req)
+		}
+		return ert.upload(req)
+	case http.MethodGet, http.MethodHead:
+		return ert.read(req)
+	}
+	return ert.roundTripper.RoundTrip(req)
+}
+
+func (ert *encryptingRoundTripper) encrypts(bucket string) bool {
+	return len(ert.buckets) == 0 || ert.buckets[bucket]
+}
+
+// upload encrypts uploaded object, requests which would store plain text in
+// encrypted bucket are rejected
+func (ert *encryptingRoundTripper) upload(req *http.Request) (*http.Response, error) {
+	query := req.URL.Query()
+	_, uploads := query["uploads"]
+	if uploads || query.Get("uploadId") != "" {
+		return notImplemented(req, "Multipart uploads are not supported in encrypted buckets.")
+	}
+	if req.Method != http.MethodPut || len(query) > 0 {
+		return ert.roundTripper.RoundTrip(req)
+	}
+	if copySource := req.Header.Get("X-Amz-Copy-Source"); copySource != "" {
+		return ert.copyObject(req, copySource)
+	}
+	// Headers covered by client signature are rewritten, so it has to be
+	// verified before, chunk signatures are verified while body is read
+	if _, verified := types.AuthenticatedAccessKey(req.Context()); !verified {
+		return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied,
+			"Uploads to encrypted buckets require verified signature."), nil
+	}
+	streaming := awschunked.IsStreamingUpload(req)
+	var decoder *awschunked.Reader
+	if streaming {
+		verifier := awschunked.VerifierOf(req.Context())
+		if verifier == nil {
+			return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied,
+				"Streaming uploads to encrypted buckets require verified V4 signature."), nil
+		}
+		req, decoder = awschunked.Decode(req, verifier)
+	}
+	if req.ContentLength < 0 {
+		return types.NewS3ErrorResponse(req, http.StatusLengthRequired, types.S3ErrMissingContentLength,
+			"You must provide the Content-Length HTTP header."), nil
+	}
+	dataKey, wrapped, keyID, err := ert.keys.dataKey()
+	if err != nil {
+		metrics.Mark("encryption.err")
+		log.Printf("Cannot generate key of encrypted object %s: %s", req.URL.Path, err)
+		return types.NewS3ErrorResponseForStatus(req, http.StatusServiceUnavailable), nil
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newBodyVerifier(req)
+	if err != nil {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidDigest,
+			"The Content-MD5 or x-amz-content-sha256 you specified was invalid."), nil
+	}
+	encrypted := req.WithContext(req.Context())
+	encrypted.Header = make(http.Header, len(req.Header)+5)
+	for name, values := range req.Header {
+		encrypted.Header[name] = values
+	}
+	encrypted.Header.Del("Content-Md5")
+	encrypted.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	encrypted.Header.Set(schemeHeader, scheme)
+	encrypted.Header.Set(keyHeader, base64.StdEncoding.EncodeToString(wrapped))
+	encrypted.Header.Set(keyIDHeader, keyID)
+	encrypted.Header.Set(plainSizeHeader, strconv.FormatInt(req.ContentLength, 10))
+	if plainMD5 := declaredMD5(req, verifier, streaming); plainMD5 != nil {
+		encrypted.Header.Set(plainETagHeader, hex.EncodeToString(plainMD5))
+	}
+	encrypted.ContentLength = encryptedSize(req.ContentLength)
+	encrypted.Header.Set("Content-Length", strconv.FormatInt(encrypted.ContentLength, 10))
+	var source io.Reader = http.NoBody
+	if req.Body != nil {
+		source = io.TeeReader(req.Body, verifier)
+	}
+	verify := verifier.verify
+	if decoder != nil {
+		// Last chunk is read, so all chunk signatures are verified before
+		// last segment is sealed
+		verify = func() error {
+			trailing, err := io.Copy(ioutil.Discard, req.Body)
+			if err != nil {
+				return err
+			}
+			if trailing > 0 {
+				return errors.New("body is longer than X-Amz-Decoded-Content-Length")
+			}
+			return verifier.verify()
+		}
+	}
+	encrypted.Body = ioutil.NopCloser(newEncryptingReader(source, aead, req.ContentLength, verify))
+	metrics.Mark("encryption.encrypted")
+	resp, err := ert.roundTripper.RoundTrip(encrypted)
+	if decoder != nil && decoder.Err() == awschunked.ErrSignatureMismatch {
+		if resp != nil && resp.Body != nil {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Debugf("Cannot close response body: %s", closeErr)
+			}
+		}
+		return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrSignatureDoesNotMatch,
+			"The request signature we calculated does not match the signature you provided."), nil
+	}
+	if resp != nil {
+		resp.Request = req
+		// Backend ETag is MD5 of cipher text, whole plain text was read by now
+		if err == nil && resp.StatusCode == http.StatusOK {
+			resp.Header.Set("ETag", fmt.Sprintf("%q", hex.EncodeToString(verifier.md5.Sum(nil))))
+		}
+	}
+	return resp, err
+}
+
+// declaredMD5 returns plain text checksum known before body is sent, given
+// by client or computed while body was spooled, nil if it isn't known
+func declaredMD5(req *http.Request, verifier *bodyVerifier, streaming bool) []byte {
+	if verifier.md5Sum != nil {
+		return verifier.md5Sum
+	}
+	if streaming {
+		return nil
+	}
+	digester, ok := req.Body.(types.Digester)
+	if !ok {
+		return nil
+	}
+	digest, ok := digester.MD5()
+	if !ok {
+		return nil
+	}
+	return digest
+}
+
+// copyObject allows server side copies keeping encryption metadata only
+func (ert *encryptingRoundTripper) copyObject(req *http.Request, copySource string) (*http.Response, error) {
+	if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		return notImplemented(req, "Copying with metadata replacement is not supported in encrypted buckets.")
+	}
+	source, err := url.PathUnescape(copySource)
+	if err != nil {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidArgument,
+			"Invalid copy source encoding."), nil
+	}
+	if sourceBucket, _ := utils.SplitBucketKey(source); !ert.encrypts(sourceBucket) {
+		return notImplemented(req, "Copying objects of unencrypted buckets to encrypted buckets is not supported.")
+	}
+	return ert.roundTripper.RoundTrip(req)
+}
+
+// read decrypts encrypted objects, ranges are translated to ranges of
+// encrypted segments
+func (ert *encryptingRoundTripper) read(req *http.Request) (*http.Response, error) {
+	start, end, ranged := parseRange(req.Header.Get("Range"))
+	if req.Method != http.MethodGet || !ranged || !ert.encrypts(bucketOf(req)) {
+		resp, err := ert.roundTripper.RoundTrip(req)
+		if err != nil || !isEncrypted(resp) {
+			return resp, err
+		}
+		if resp.StatusCode == http.StatusPartialContent {
+			// Ranges which can't be translated are ignored, whole object is returned
+			discard(resp)
+			resp, err = ert.roundTripper.RoundTrip(withRange(req, ""))
+			if err != nil || !isEncrypted(resp) {
+				return resp, err
+			}
+		}
+		return ert.decrypt(req, resp, 0, -1, false)
+	}
+	segmentsRange := fmt.Sprintf("bytes=%d-", start/segmentSize*sealedSegmentSize)
+	if end >= 0 {
+		segmentsRange += strconv.FormatInt((end/segmentSize+1)*sealedSegmentSize-1, 10)
+	}
+	resp, err := ert.roundTripper.RoundTrip(withRange(req, segmentsRange))
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if !isEncrypted(resp) {
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Request = req
+			return resp, nil
+		}
+		// Objects stored before encryption was enabled are read as they are
+		discard(resp)
+		return ert.roundTripper.RoundTrip(req)
+	}
+	return ert.decrypt(req, resp, start, end, true)
+}
+
+// withRange returns copy of request with Range header replaced, it's removed
+// if byteRange is empty
+func withRange(req *http.Request, byteRange string) *http.Request {
+	rangeReq := req.WithContext(req.Context())
+	rangeReq.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		rangeReq.Header[name] = values
+	}
+	rangeReq.Header.Del("Range")
+	if byteRange != "" {
+		rangeReq.Header.Set("Range", byteRange)
+	}
+	return rangeReq
+}
+
+// decrypt replaces body of encrypted object response with plain text of
+// requested range, end is -1 for range ending with object
+func (ert *encryptingRoundTripper) decrypt(req *http.Request, resp *http.Response, start, end int64, ranged bool) (*http.Response, error) {
+	size, err := strconv.ParseInt(resp.Header.Get(plainSizeHeader), 10, 64)
+	if err != nil || resp.Header.Get(schemeHeader) != scheme {
+		discard(resp)
+		return ert.failure(req, fmt.Errorf("unsupported encryption %q of object size %q",
+			resp.Header.Get(schemeHeader), resp.Header.Get(plainSizeHeader)))
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Header.Get(keyHeader))
+	if err != nil {
+		discard(resp)
+		return ert.failure(req, err)
+	}
+	dataKey, err := ert.keys.unwrap(wrapped, resp.Header.Get(keyIDHeader))
+	if err != nil {
+		discard(resp)
+		return ert.failure(req, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		discard(resp)
+		return ert.failure(req, err)
+	}
+	if plainETag := resp.Header.Get(plainETagHeader); plainETag != "" {
+		resp.Header.Set("ETag", fmt.Sprintf("%q", plainETag))
+	}
+	for _, name := range []string{schemeHeader, keyHeader, keyIDHeader, plainSizeHeader, plainETagHeader} {
+		resp.Header.Del(name)
+	}
+	resp.Request = req
+	backendStatus := resp.StatusCode
+	metrics.Mark("encryption.decrypted")
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+	if ranged {
+		if start >= size {
+			discard(resp)
+			invalidRange := types.NewS3ErrorResponse(req, http.StatusRequestedRangeNotSatisfiable, types.S3ErrInvalidRange,
+				"The requested range is not satisfiable")
+			invalidRange.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return invalidRange, nil
+		}
+		resp.StatusCode = http.StatusPartialContent
+		resp.Status = fmt.Sprintf("%d %s", http.StatusPartialContent, http.StatusText(http.StatusPartialContent))
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	length := end - start + 1
+	resp.ContentLength = length
+	resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	if req.Method == http.MethodHead || resp.Body == nil {
+		return resp, nil
+	}
+	// Backend returns whole object if it ignores range
+	firstSegment := int64(0)
+	if backendStatus == http.StatusPartialContent {
+		firstSegment = start / segmentSize
+	}
+	skip := start - firstSegment*segmentSize
+	resp.Body = newDecryptingReader(resp.Body, aead, size, firstSegment, skip, length)
+	return resp, nil
+}
+
+func (ert *encryptingRoundTripper) failure(req *http.Request, err error) (*http.Response, error) {
+	metrics.Mark("encryption.err")
+	log.Printf("Cannot decrypt object %s: %s", req.URL.Path, err)
+	return types.NewS3ErrorResponse(req, http.StatusInternalServerError, types.S3ErrInternalError,
+		"Object cannot be decrypted."), nil
+}
+
+// bodyVerifier checks digests declared by client against plain text
+type bodyVerifier struct {
+	io.Writer
+	md5       hash.Hash
+	sha256    hash.Hash
+	md5Sum    []byte
+	sha256Sum []byte
+}
+
+func newBodyVerifier(req *http.Request) (*bodyVerifier, error) {
+	bv := &bodyVerifier{md5: md5.New(), sha256: sha256.New()}
+	bv.Writer = io.MultiWriter(bv.md5, bv.sha256)
+	var err error
+	if contentMD5 := req.Header.Get("Content-Md5"); contentMD5 != "" {
+		if bv.md5Sum, err = base64.StdEncoding.DecodeString(contentMD5); err != nil {
+			return nil, err
+		}
+	}
+	if contentSHA256 := req.Header.Get("X-Amz-Content-Sha256"); len(contentSHA256) == 2*sha256.Size {
+		if bv.sha256Sum, err = hex.DecodeString(contentSHA256); err != nil {
+			return nil, err
+		}
+	}
+	return bv, nil
+}
+
+func (bv *bodyVerifier) verify() error {
+	if bv.md5Sum != nil && !bytes.Equal(bv.md5Sum, bv.md5.Sum(nil)) {
+		return fmt.Errorf("%s: Content-MD5 does not match body", types.S3ErrBadDigest)
+	}
+	if bv.sha256Sum != nil && !bytes.Equal(bv.sha256Sum, bv.sha256.Sum(nil)) {
+		return fmt.Errorf("%s: x-amz-content-sha256 does not match body", types.S3ErrBadDigest)
+	}
+	return nil
+}
+
+func isEncrypted(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) &&
+		resp.Header.Get(schemeHeader) != ""
+}
+
+// parseRange parses single range of bytes, end is -1 for open range. Suffix
+// and multiple ranges aren't translated, whole object is read for them
+func parseRange(header string) (start, end int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(header, "bytes=")), "-", 2)
+	if len(bounds) != 2 || bounds[0] == "" {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if bounds[1] == "" {
+		return start, -1, true
+	}
+	end, err = strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func bucketOf(req *http.Request) string {
+	bucket, _ := utils.SplitBucketKey(req.URL.Path)
+	return bucket
+}
+
+func notImplemented(req *http.Request, message string) (*http.Response, error) {
+	return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented, message), nil
+}
+
+func discard(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.Debugf("Could not discard response body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Could not close response body: %s", err)
+	}
+}
+
+// Decorator creates httphandler.Decorator encrypting objects according to
+// configuration, requests are not changed if KeyProvider is not defined
+func Decorator(conf config.Encryption) (httphandler.Decorator, error) {
+	if conf.KeyProvider == "" {
+		return func(roundTripper http.RoundTripper) http.RoundTripper { return roundTripper }, nil
+	}
+	keys, err := newKeyProvider(conf)
+	if err != nil {
+		return nil, err
+	}
+	buckets := make(map[string]bool, len(conf.Buckets))
+	for _, bucket := range conf.Buckets {
+		buckets[bucket] = true
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return &encryptingRoundTripper{roundTripper: roundTripper, keys: keys, buckets: buckets}
+	}, nil
+}
@@ -0,0 +1,447 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/crdstore"
+	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/encryption/config"
+	"github.com/allegro/akubra/storages/auth"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/types"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMasterKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+type storedObject struct {
+	header http.Header
+	body   []byte
+}
+
+// backendStub stores objects in memory and serves ranges of them
+type backendStub struct {
+	objects  map[string]storedObject
+	requests []*http.Request
+}
+
+func (bs *backendStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	bs.requests = append(bs.requests, req)
+	switch req.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) != req.ContentLength {
+			return types.NewS3ErrorResponseForStatus(req, http.StatusBadRequest), nil
+		}
+		header := http.Header{}
+		for name, values := range req.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				header[name] = values
+			}
+		}
+		header.Set("ETag", etag(body))
+		bs.objects[req.URL.Path] = storedObject{header: header, body: body}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {etag(body)}}, Body: http.NoBody, Request: req}, nil
+	case http.MethodGet, http.MethodHead:
+		object, ok := bs.objects[req.URL.Path]
+		if !ok {
+			return types.NewS3ErrorResponseForStatus(req, http.StatusNotFound), nil
+		}
+		header := http.Header{}
+		for name, values := range object.header {
+			header[name] = values
+		}
+		status, body := http.StatusOK, object.body
+		if start, end, ok := parseRange(req.Header.Get("Range")); ok {
+			if start >= int64(len(body)) {
+				return types.NewS3ErrorResponseForStatus(req, http.StatusRequestedRangeNotSatisfiable), nil
+			}
+			if end < 0 || end >= int64(len(body)) {
+				end = int64(len(body)) - 1
+			}
+			header.Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10)+"/"+strconv.Itoa(len(body)))
+			status, body = http.StatusPartialContent, body[start:end+1]
+		}
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		return &http.Response{StatusCode: status, Header: header, ContentLength: int64(len(body)),
+			Body: ioutil.NopCloser(bytes.NewReader(body)), Request: req}, nil
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+}
+
+func newEncryption(t *testing.T, buckets ...string) (http.RoundTripper, *backendStub) {
+	decorator, err := Decorator(config.Encryption{
+		KeyProvider: config.StaticKeys,
+		MasterKeys:  map[string]string{"current": testMasterKey},
+		MasterKeyID: "current",
+		Buckets:     buckets,
+	})
+	require.NoError(t, err)
+	backend := &backendStub{objects: make(map[string]storedObject)}
+	return decorator(backend), backend
+}
+
+func etag(body []byte) string {
+	digest := md5.Sum(body)
+	return `"` + hex.EncodeToString(digest[:]) + `"`
+}
+
+func testBody(size int) []byte {
+	body := make([]byte, size)
+	for i := range body {
+		body[i] = byte(i % 251)
+	}
+	return body
+}
+
+// verified marks request as one which signature was checked by edge authentication
+func verified(req *http.Request) *http.Request {
+	return req.WithContext(types.WithAuthenticatedAccessKey(req.Context(), "client"))
+}
+
+func put(t *testing.T, rt http.RoundTripper, path string, body []byte) *http.Response {
+	req := verified(httptest.NewRequest(http.MethodPut, "http://localhost"+path, bytes.NewReader(body)))
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func get(t *testing.T, rt http.RoundTripper, path, byteRange string) (*http.Response, []byte) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestShouldStoreOnlyEncryptedBodies(t *testing.T) {
+	rt, backend := newEncryption(t)
+	plain := testBody(3*segmentSize + 100)
+
+	resp := put(t, rt, "/bucket/key", plain)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	stored := backend.objects["/bucket/key"]
+	assert.Len(t, stored.body, len(plain)+4*tagSize)
+	assert.False(t, bytes.Contains(stored.body, plain[:1024]))
+	assert.Equal(t, scheme, stored.header.Get(schemeHeader))
+	assert.Equal(t, "current", stored.header.Get(keyIDHeader))
+	assert.Equal(t, strconv.Itoa(len(plain)), stored.header.Get(plainSizeHeader))
+
+	getResp, body := get(t, rt, "/bucket/key", "")
+	assert.Equal(t, http.StatusOK, getResp.StatusCode)
+	assert.Equal(t, plain, body)
+	assert.Equal(t, int64(len(plain)), getResp.ContentLength)
+	assert.Empty(t, getResp.Header.Get(keyHeader))
+}
+
+func TestShouldTranslateRangesToEncryptedSegments(t *testing.T) {
+	rt, backend := newEncryption(t)
+	plain := testBody(3*segmentSize + 100)
+	put(t, rt, "/bucket/key", plain)
+
+	testCases := []struct {
+		byteRange    string
+		start, end   int
+		backendRange string
+	}{
+		{"bytes=10-20", 10, 20, "bytes=0-65551"},
+		{"bytes=65530-65545", 65530, 65545, "bytes=0-131103"},
+		{"bytes=196600-", 196600, len(plain) - 1, "bytes=131104-"},
+		{"bytes=131072-999999", 131072, len(plain) - 1, "bytes=131104-1048831"},
+	}
+	for _, tc := range testCases {
+		backend.requests = nil
+		resp, body := get(t, rt, "/bucket/key", tc.byteRange)
+
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode, tc.byteRange)
+		assert.Equal(t, plain[tc.start:tc.end+1], body, tc.byteRange)
+		assert.Equal(t, "bytes "+strconv.Itoa(tc.start)+"-"+strconv.Itoa(tc.end)+"/"+strconv.Itoa(len(plain)),
+			resp.Header.Get("Content-Range"), tc.byteRange)
+		assert.Equal(t, tc.backendRange, backend.requests[0].Header.Get("Range"), tc.byteRange)
+	}
+
+	resp, _ := get(t, rt, "/bucket/key", "bytes=999999-")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+}
+
+func TestShouldReadUnencryptedObjectsAsTheyAre(t *testing.T) {
+	rt, backend := newEncryption(t)
+	backend.objects["/bucket/legacy"] = storedObject{header: http.Header{}, body: []byte("plain text")}
+
+	resp, body := get(t, rt, "/bucket/legacy", "bytes=6-9")
+
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "text", string(body))
+	require.Len(t, backend.requests, 2)
+	assert.Equal(t, "bytes=6-9", backend.requests[1].Header.Get("Range"))
+}
+
+func TestShouldDetectTamperedObjects(t *testing.T) {
+	rt, backend := newEncryption(t)
+	put(t, rt, "/bucket/key", testBody(100))
+	backend.objects["/bucket/key"].body[10] ^= 1
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+
+	assert.Error(t, err)
+}
+
+func TestShouldAbortUploadWithInvalidContentMD5(t *testing.T) {
+	rt, backend := newEncryption(t)
+	plain := testBody(100)
+	digest := md5.Sum(append([]byte("other"), plain...))
+	req := verified(httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewReader(plain)))
+	req.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(digest[:]))
+
+	_, err := rt.RoundTrip(req)
+
+	assert.Error(t, err)
+	assert.Empty(t, backend.objects)
+}
+
+func TestShouldReturnETagsOfPlainText(t *testing.T) {
+	rt, backend := newEncryption(t)
+	plain := testBody(100000)
+	digest := md5.Sum(plain)
+	req := verified(httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewReader(plain)))
+	req.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(digest[:]))
+
+	putResp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	getResp, _ := get(t, rt, "/bucket/key", "")
+	rangeResp, _ := get(t, rt, "/bucket/key", "bytes=10-20")
+	headResp, err := rt.RoundTrip(httptest.NewRequest(http.MethodHead, "http://localhost/bucket/key", nil))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, etag(plain), backend.objects["/bucket/key"].header.Get("ETag"))
+	for _, resp := range []*http.Response{putResp, getResp, rangeResp, headResp} {
+		assert.Equal(t, etag(plain), resp.Header.Get("ETag"))
+		assert.Empty(t, resp.Header.Get(plainETagHeader))
+	}
+}
+
+// spooledBody carries checksum computed while body was spooled
+type spooledBody struct {
+	*bytes.Reader
+	digest []byte
+}
+
+func (sb *spooledBody) Close() error { return nil }
+
+func (sb *spooledBody) MD5() ([]byte, bool) { return sb.digest, true }
+
+func TestShouldStoreETagOfSpooledPlainText(t *testing.T) {
+	rt, _ := newEncryption(t)
+	plain := testBody(100)
+	digest := md5.Sum(plain)
+	req := verified(httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil))
+	req.Body = &spooledBody{Reader: bytes.NewReader(plain), digest: digest[:]}
+	req.ContentLength = int64(len(plain))
+
+	_, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	getResp, _ := get(t, rt, "/bucket/key", "")
+
+	assert.Equal(t, etag(plain), getResp.Header.Get("ETag"))
+}
+
+// Plain text MD5 is known after body is sent, so it can't be stored in
+// metadata of objects uploaded without Content-MD5 and not spooled
+func TestShouldReturnETagOfEncryptedObjectIfPlainTextMD5IsUnknownBeforeUpload(t *testing.T) {
+	rt, backend := newEncryption(t)
+	plain := testBody(100)
+
+	putResp := put(t, rt, "/bucket/key", plain)
+	getResp, _ := get(t, rt, "/bucket/key", "")
+
+	assert.Equal(t, etag(plain), putResp.Header.Get("ETag"))
+	assert.Equal(t, backend.objects["/bucket/key"].header.Get("ETag"), getResp.Header.Get("ETag"))
+	assert.NotEqual(t, etag(plain), getResp.Header.Get("ETag"))
+}
+
+func TestShouldRejectRequestsStoringPlainTextInEncryptedBuckets(t *testing.T) {
+	rt, backend := newEncryption(t, "secret")
+
+	multipart, err := rt.RoundTrip(httptest.NewRequest(http.MethodPost, "http://localhost/secret/key?uploads", nil))
+	require.NoError(t, err)
+	copyReq := httptest.NewRequest(http.MethodPut, "http://localhost/secret/key", nil)
+	copyReq.Header.Set("X-Amz-Copy-Source", "/public/key")
+	copyResp, err := rt.RoundTrip(copyReq)
+	require.NoError(t, err)
+	plainResp := put(t, rt, "/public/key", []byte("plain"))
+
+	assert.Equal(t, http.StatusNotImplemented, multipart.StatusCode)
+	assert.Equal(t, http.StatusNotImplemented, copyResp.StatusCode)
+	assert.Equal(t, http.StatusOK, plainResp.StatusCode)
+	assert.Equal(t, "plain", string(backend.objects["/public/key"].body))
+}
+
+func TestShouldWrapDataKeysWithVaultTransit(t *testing.T) {
+	dataKey := base64.StdEncoding.EncodeToString(testBody(dataKeySize))
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		payload := make(map[string]interface{})
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		switch r.URL.Path {
+		case "/v1/transit/datakey/plaintext/objects":
+			_, _ = w.Write([]byte(`{"data": {"plaintext": "` + dataKey + `", "ciphertext": "vault:v1:wrapped"}}`))
+		case "/v1/transit/decrypt/objects":
+			require.Equal(t, "vault:v1:wrapped", payload["ciphertext"])
+			_, _ = w.Write([]byte(`{"data": {"plaintext": "` + dataKey + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	vaultURL, err := url.Parse(vault.URL)
+	require.NoError(t, err)
+	provider := newVaultTransit(config.Vault{Endpoint: types.YAMLUrl{URL: vaultURL}, Token: "token", KeyName: "objects"})
+
+	key, wrapped, keyID, err := provider.dataKey()
+	require.NoError(t, err)
+	unwrapped, err := provider.unwrap(wrapped, keyID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "vault:v1:wrapped", string(wrapped))
+	assert.Equal(t, "objects", keyID)
+	assert.Equal(t, key, unwrapped)
+}
+
+const testCredentials = `
+client:
+  akubra:
+    AccessKey: client
+    SecretKey: client-secret
+  backend:
+    AccessKey: backend
+    SecretKey: backend-secret
+`
+
+// newAuthenticatedEncryption chains edge authentication, encryption and
+// resigning with backend keys of auth service, as handler and storages do
+func newAuthenticatedEncryption(t *testing.T) (http.RoundTripper, *backendStub) {
+	dir, err := ioutil.TempDir("", "encryption")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(testCredentials), 0600))
+	stores, err := crdstore.NewStores(crdstoreconfig.CredentialsStoreMap{
+		"auth": crdstoreconfig.CredentialsStore{Type: crdstoreconfig.FileStore, File: file},
+	})
+	require.NoError(t, err)
+	defer stores.Close()
+	edge, err := auth.EdgeDecorator("auth", stores)
+	require.NoError(t, err)
+	store, err := stores.Get("auth")
+	require.NoError(t, err)
+	encrypt, err := Decorator(config.Encryption{
+		KeyProvider: config.StaticKeys,
+		MasterKeys:  map[string]string{"current": testMasterKey},
+		MasterKeyID: "current",
+	})
+	require.NoError(t, err)
+	backend := &backendStub{objects: make(map[string]storedObject)}
+	verifying := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if auth.DoesSignMatch(req, auth.Keys{AccessKeyID: "backend", SecretAccessKey: "backend-secret"}) != auth.ErrNone {
+			return types.NewS3ErrorResponseForStatus(req, http.StatusForbidden), nil
+		}
+		return backend.RoundTrip(req)
+	})
+	return edge(encrypt(auth.SignAuthServiceDecorator("backend", "backend:9000", store)(verifying))), backend
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// streamingUpload returns V4 signed aws-chunked upload of plain, chunk
+// signatures are made with chunkSecret
+func streamingUpload(t *testing.T, plain []byte, chunkSecret string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", nil)
+	req.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(plain)))
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req = s3signer.SignV4(*req, "client", "client-secret", "", "us-east-1")
+	authHeader, err := auth.ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	require.NoError(t, err)
+	signer, err := awschunked.NewSigner(chunkSecret, req.Header.Get("X-Amz-Date"), authHeader.Region, authHeader.Signature)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(awschunked.NewEncoder(bytes.NewReader(plain), signer, 64*1024))
+	require.NoError(t, err)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return req
+}
+
+func TestShouldEncryptUploadsSignedByClients(t *testing.T) {
+	rt, backend := newAuthenticatedEncryption(t)
+	plain := testBody(100000)
+	digest := sha256.Sum256(plain)
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", bytes.NewReader(plain))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(digest[:]))
+	req = s3signer.SignV4(*req, "client", "client-secret", "", "us-east-1")
+
+	resp, err := rt.RoundTrip(req)
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, backend.requests, 1)
+	assert.Contains(t, backend.requests[0].Header.Get("Authorization"), "Credential=backend/")
+	assert.Equal(t, scheme, backend.objects["/bucket/key"].header.Get(schemeHeader))
+	assert.NotEqual(t, plain, backend.objects["/bucket/key"].body)
+}
+
+func TestShouldVerifyChunkSignaturesOfStreamingUploads(t *testing.T) {
+	rt, backend := newAuthenticatedEncryption(t)
+	plain := testBody(200000)
+
+	validResp, err := rt.RoundTrip(streamingUpload(t, plain, "client-secret"))
+	require.NoError(t, err)
+	stored := backend.objects["/bucket/key"].body
+	tamperedResp, err := rt.RoundTrip(streamingUpload(t, testBody(100), "other-secret"))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, validResp.StatusCode)
+	assert.Equal(t, encryptedSize(int64(len(plain))), int64(len(stored)))
+	assert.Equal(t, http.StatusForbidden, tamperedResp.StatusCode)
+	assert.Equal(t, stored, backend.objects["/bucket/key"].body)
+}
+
+func TestShouldRejectUploadsNotVerifiedByEdgeAuthentication(t *testing.T) {
+	rt, backend := newEncryption(t)
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewReader([]byte("plain")))
+
+	resp, err := rt.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, backend.requests)
+}
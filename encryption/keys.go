@@ -0,0 +1,199 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/encryption/config"
+	"github.com/allegro/akubra/log"
+)
+
+// dataKeySize is size of AES-256 keys objects are encrypted with
+const dataKeySize = 32
+
+// keyProvider generates object data keys and unwraps stored ones
+type keyProvider interface {
+	// dataKey returns new data key, its wrapped form and ID of wrapping key
+	dataKey() (key, wrapped []byte, keyID string, err error)
+	// unwrap returns data key wrapped with key of given ID
+	unwrap(wrapped []byte, keyID string) ([]byte, error)
+}
+
+func newKeyProvider(conf config.Encryption) (keyProvider, error) {
+	switch conf.KeyProvider {
+	case config.StaticKeys:
+		return newStaticKeys(conf.MasterKeys, conf.MasterKeyID)
+	case config.VaultTransit:
+		if conf.Vault == nil || conf.Vault.Endpoint.URL == nil {
+			return nil, errors.New("no Vault endpoint defined")
+		}
+		return newVaultTransit(*conf.Vault), nil
+	}
+	return nil, fmt.Errorf("unsupported key provider %q", conf.KeyProvider)
+}
+
+// staticKeys wraps data keys with AES-GCM master keys from configuration
+type staticKeys struct {
+	masterKeys  map[string]cipher.AEAD
+	masterKeyID string
+}
+
+func newStaticKeys(masterKeys map[string]string, masterKeyID string) (*staticKeys, error) {
+	keys := &staticKeys{masterKeys: make(map[string]cipher.AEAD, len(masterKeys)), masterKeyID: masterKeyID}
+	for id, encoded := range masterKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q is not valid base64: %s", id, err)
+		}
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("master key %q should have %d bytes", id, dataKeySize)
+		}
+		if keys.masterKeys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := keys.masterKeys[masterKeyID]; !ok {
+		return nil, fmt.Errorf("master key %q is not defined", masterKeyID)
+	}
+	return keys, nil
+}
+
+func (sk *staticKeys) dataKey() ([]byte, []byte, string, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, "", err
+	}
+	master := sk.masterKeys[sk.masterKeyID]
+	nonce := make([]byte, master.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, "", err
+	}
+	return key, master.Seal(nonce, nonce, key, []byte(sk.masterKeyID)), sk.masterKeyID, nil
+}
+
+func (sk *staticKeys) unwrap(wrapped []byte, keyID string) ([]byte, error) {
+	master, ok := sk.masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not defined", keyID)
+	}
+	if len(wrapped) < master.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return master.Open(nil, wrapped[:master.NonceSize()], wrapped[master.NonceSize():], []byte(keyID))
+}
+
+// vaultTransit generates and decrypts data keys with Vault transit engine,
+// plain data keys never leave memory of proxy
+type vaultTransit struct {
+	client *http.Client
+	conf   config.Vault
+}
+
+type vaultTransitResponse struct {
+	Data struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	} `json:"data"`
+}
+
+func newVaultTransit(conf config.Vault) *vaultTransit {
+	if conf.Mount == "" {
+		conf.Mount = "transit"
+	}
+	timeout := conf.RequestTimeout.Duration
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &vaultTransit{client: &http.Client{Timeout: timeout}, conf: conf}
+}
+
+func (vt *vaultTransit) dataKey() ([]byte, []byte, string, error) {
+	resp, err := vt.do("/datakey/plaintext/"+vt.conf.KeyName, map[string]interface{}{"bits": dataKeySize * 8})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	key, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil || len(key) != dataKeySize {
+		return nil, nil, "", errors.New("vault returned invalid data key")
+	}
+	return key, []byte(resp.Data.Ciphertext), vt.conf.KeyName, nil
+}
+
+func (vt *vaultTransit) unwrap(wrapped []byte, keyID string) ([]byte, error) {
+	resp, err := vt.do("/decrypt/"+keyID, map[string]interface{}{"ciphertext": string(wrapped)})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (vt *vaultTransit) do(path string, payload map[string]interface{}) (*vaultTransitResponse, error) {
+	token, err := vt.token()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(vt.conf.Endpoint.String(), "/") + "/v1/" + vt.conf.Mount + path
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := vt.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make request to Vault - err: %s", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Cannot close Vault response body: %q", closeErr)
+		}
+	}()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read Vault response - err: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault request %s failed - StatusCode: %d", path, resp.StatusCode)
+	}
+	transitResp := &vaultTransitResponse{}
+	if err = json.Unmarshal(respBody, transitResp); err != nil {
+		return nil, fmt.Errorf("unable to parse Vault response: %s", err)
+	}
+	return transitResp, nil
+}
+
+// token returns configured token, token file is read on every call, so
+// token rotated by Vault agent is picked up
+func (vt *vaultTransit) token() (string, error) {
+	if vt.conf.TokenFile == "" {
+		return vt.conf.Token, nil
+	}
+	token, err := ioutil.ReadFile(vt.conf.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read Vault token: %s", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// segmentSize is size of plain text sealed at once, objects are
+	// encrypted in segments, so they're streamed and read by ranges
+	segmentSize = 64 * 1024
+	// tagSize is size of authentication tag added to every segment
+	tagSize = 16
+	// sealedSegmentSize is size of every encrypted segment but the last one
+	sealedSegmentSize = segmentSize + tagSize
+)
+
+// segments returns number of segments of plain text of given size, empty
+// object has single empty segment
+func segments(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + segmentSize - 1) / segmentSize
+}
+
+// encryptedSize returns size of encrypted object of given plain text size
+func encryptedSize(size int64) int64 {
+	return size + segments(size)*tagSize
+}
+
+// segmentNonce binds segment to its position, so segments can't be
+// reordered, and last segment is marked, so object can't be truncated.
+// Every object has its own key, so nonces are never reused
+func segmentNonce(index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], uint64(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptingReader seals plain text of known size segment by segment while
+// it's read
+type encryptingReader struct {
+	source   io.Reader
+	aead     cipher.AEAD
+	size     int64
+	index    int64
+	segments int64
+	plain    []byte
+	buf      []byte
+	sealed   []byte
+	// verify is called once whole plain text is read, its error aborts
+	// stream before last segment is returned
+	verify func() error
+	err    error
+}
+
+func newEncryptingReader(source io.Reader, aead cipher.AEAD, size int64, verify func() error) *encryptingReader {
+	return &encryptingReader{source: source, aead: aead, size: size, segments: segments(size),
+		plain: make([]byte, segmentSize), buf: make([]byte, sealedSegmentSize), verify: verify}
+}
+
+// Read implements io.Reader interface
+func (er *encryptingReader) Read(p []byte) (int, error) {
+	if len(er.sealed) == 0 && er.err == nil {
+		er.err = er.sealNext()
+	}
+	if len(er.sealed) == 0 {
+		return 0, er.err
+	}
+	n := copy(p, er.sealed)
+	er.sealed = er.sealed[n:]
+	return n, nil
+}
+
+func (er *encryptingReader) sealNext() error {
+	if er.index == er.segments {
+		return io.EOF
+	}
+	length := er.size - er.index*segmentSize
+	if length > segmentSize {
+		length = segmentSize
+	}
+	if _, err := io.ReadFull(er.source, er.plain[:length]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("body is shorter than Content-Length")
+		}
+		return err
+	}
+	last := er.index == er.segments-1
+	if last && er.verify != nil {
+		if err := er.verify(); err != nil {
+			return err
+		}
+	}
+	er.sealed = er.aead.Seal(er.buf[:0], segmentNonce(er.index, last), er.plain[:length], nil)
+	er.index++
+	return nil
+}
+
+// decryptingReader opens segments of encrypted object while they're read,
+// source may start at any segment. skip bytes of first segment are omitted
+// and at most limit bytes of plain text are returned
+type decryptingReader struct {
+	source   io.ReadCloser
+	aead     cipher.AEAD
+	size     int64
+	index    int64
+	segments int64
+	skip     int64
+	limit    int64
+	sealed   []byte
+	plain    []byte
+	err      error
+}
+
+func newDecryptingReader(source io.ReadCloser, aead cipher.AEAD, size, firstSegment, skip, limit int64) *decryptingReader {
+	return &decryptingReader{source: source, aead: aead, size: size, index: firstSegment, segments: segments(size),
+		skip: skip, limit: limit, sealed: make([]byte, sealedSegmentSize)}
+}
+
+// Read implements io.Reader interface
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 && dr.err == nil {
+		dr.err = dr.openNext()
+	}
+	if len(dr.plain) == 0 {
+		return 0, dr.err
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+func (dr *decryptingReader) openNext() error {
+	if dr.limit <= 0 || dr.index >= dr.segments {
+		return io.EOF
+	}
+	length := dr.size - dr.index*segmentSize
+	if length > segmentSize {
+		length = segmentSize
+	}
+	sealed := dr.sealed[:length+tagSize]
+	if _, err := io.ReadFull(dr.source, sealed); err != nil {
+		return fmt.Errorf("cannot read encrypted segment %d: %s", dr.index, err)
+	}
+	plain, err := dr.aead.Open(sealed[:0], segmentNonce(dr.index, dr.index == dr.segments-1), sealed, nil)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt segment %d: %s", dr.index, err)
+	}
+	dr.index++
+	plain = plain[dr.skip:]
+	dr.skip = 0
+	if int64(len(plain)) > dr.limit {
+		plain = plain[:dr.limit]
+	}
+	dr.limit -= int64(len(plain))
+	dr.plain = plain
+	return nil
+}
+
+// Close closes source
+func (dr *decryptingReader) Close() error {
+	return dr.source.Close()
+}
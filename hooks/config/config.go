@@ -0,0 +1,24 @@
+package config
+
+// Hook changes requests selected by When expression, hooks are evaluated in
+// order. Expressions are described in README
+type Hook struct {
+	// Name of hook used in logs and metrics
+	Name string `yaml:"Name"`
+	// When is bool expression selecting requests, all requests if empty
+	When string `yaml:"When"`
+	// Reject responds to selected requests with status, they don't reach
+	// storages, 0 doesn't reject
+	Reject int `yaml:"Reject"`
+	// Message of rejection, default message of status if empty
+	Message string `yaml:"Message"`
+	// Headers maps request header names to string expressions computing
+	// their values, header is removed if value is empty
+	Headers map[string]string `yaml:"Headers"`
+	// Region is string expression computing name of region request is
+	// routed to, regardless of its host and bucket
+	Region string `yaml:"Region"`
+}
+
+// Hooks are evaluated for each request
+type Hooks []Hook
@@ -0,0 +1,513 @@
+package hooks
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// kind is static type of expression, values are string, int64 or bool
+type kind int
+
+const (
+	stringKind kind = iota
+	intKind
+	boolKind
+)
+
+func (k kind) String() string {
+	switch k {
+	case stringKind:
+		return "string"
+	case intKind:
+		return "int"
+	}
+	return "bool"
+}
+
+// request is evaluated by expressions
+type request struct {
+	req    *http.Request
+	bucket string
+	key    string
+}
+
+func newRequest(req *http.Request) *request {
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	return &request{req: req, bucket: bucket, key: key}
+}
+
+// node of expression tree, types are checked when expression is compiled,
+// so evaluation can't fail
+type node interface {
+	kind() kind
+	eval(r *request) interface{}
+}
+
+type variable struct {
+	k   kind
+	get func(r *request) interface{}
+}
+
+var variables = map[string]variable{
+	"method":        {stringKind, func(r *request) interface{} { return r.req.Method }},
+	"host":          {stringKind, func(r *request) interface{} { return r.req.Host }},
+	"path":          {stringKind, func(r *request) interface{} { return r.req.URL.Path }},
+	"bucket":        {stringKind, func(r *request) interface{} { return r.bucket }},
+	"key":           {stringKind, func(r *request) interface{} { return r.key }},
+	"accessKey":     {stringKind, func(r *request) interface{} { return utils.ExtractAccessKey(r.req) }},
+	"clientIP":      {stringKind, func(r *request) interface{} { return types.ClientIP(r.req) }},
+	"contentLength": {intKind, func(r *request) interface{} { return r.req.ContentLength }},
+}
+
+type function struct {
+	args []kind
+	k    kind
+	call func(r *request, args []interface{}) interface{}
+}
+
+var functions = map[string]function{
+	"header": {[]kind{stringKind}, stringKind, func(r *request, args []interface{}) interface{} {
+		return r.req.Header.Get(args[0].(string))
+	}},
+	"query": {[]kind{stringKind}, stringKind, func(r *request, args []interface{}) interface{} {
+		return r.req.URL.Query().Get(args[0].(string))
+	}},
+	"hasPrefix": {[]kind{stringKind, stringKind}, boolKind, func(_ *request, args []interface{}) interface{} {
+		return strings.HasPrefix(args[0].(string), args[1].(string))
+	}},
+	"hasSuffix": {[]kind{stringKind, stringKind}, boolKind, func(_ *request, args []interface{}) interface{} {
+		return strings.HasSuffix(args[0].(string), args[1].(string))
+	}},
+	"contains": {[]kind{stringKind, stringKind}, boolKind, func(_ *request, args []interface{}) interface{} {
+		return strings.Contains(args[0].(string), args[1].(string))
+	}},
+	"lower": {[]kind{stringKind}, stringKind, func(_ *request, args []interface{}) interface{} {
+		return strings.ToLower(args[0].(string))
+	}},
+	"upper": {[]kind{stringKind}, stringKind, func(_ *request, args []interface{}) interface{} {
+		return strings.ToUpper(args[0].(string))
+	}},
+}
+
+type literal struct {
+	k     kind
+	value interface{}
+}
+
+func (l literal) kind() kind                { return l.k }
+func (l literal) eval(*request) interface{} { return l.value }
+
+type variableNode struct {
+	variable
+}
+
+func (v variableNode) kind() kind                  { return v.k }
+func (v variableNode) eval(r *request) interface{} { return v.get(r) }
+
+type callNode struct {
+	function
+	args []node
+}
+
+func (c callNode) kind() kind { return c.k }
+func (c callNode) eval(r *request) interface{} {
+	args := make([]interface{}, 0, len(c.args))
+	for _, arg := range c.args {
+		args = append(args, arg.eval(r))
+	}
+	return c.call(r, args)
+}
+
+// matchesNode matches string with regular expression compiled once
+type matchesNode struct {
+	value   node
+	pattern *regexp.Regexp
+}
+
+func (m matchesNode) kind() kind { return boolKind }
+func (m matchesNode) eval(r *request) interface{} {
+	return m.pattern.MatchString(m.value.eval(r).(string))
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) kind() kind                  { return boolKind }
+func (n notNode) eval(r *request) interface{} { return !n.operand.eval(r).(bool) }
+
+type binaryNode struct {
+	op          string
+	k           kind
+	left, right node
+}
+
+func (b binaryNode) kind() kind { return b.k }
+func (b binaryNode) eval(r *request) interface{} {
+	left := b.left.eval(r)
+	switch b.op {
+	case "&&":
+		return left.(bool) && b.right.eval(r).(bool)
+	case "||":
+		return left.(bool) || b.right.eval(r).(bool)
+	}
+	right := b.right.eval(r)
+	switch b.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "+":
+		if b.k == intKind {
+			return left.(int64) + right.(int64)
+		}
+		return left.(string) + right.(string)
+	}
+	var cmp int
+	if b.left.kind() == intKind {
+		switch leftInt, rightInt := left.(int64), right.(int64); {
+		case leftInt < rightInt:
+			cmp = -1
+		case leftInt > rightInt:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(left.(string), right.(string))
+	}
+	switch b.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// expression is compiled expression evaluated against requests
+type expression struct {
+	source string
+	root   node
+}
+
+// compile parses source and checks it evaluates to value of kind
+func compile(source string, k kind) (*expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %s", source, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != eofToken {
+		err = fmt.Errorf("unexpected %q at %d", p.peek().text, p.peek().pos)
+	}
+	if err == nil && root.kind() != k {
+		err = fmt.Errorf("evaluates to %s, %s expected", root.kind(), k)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %s", source, err)
+	}
+	return &expression{source: source, root: root}, nil
+}
+
+func (x *expression) bool(r *request) bool {
+	return x.root.eval(r).(bool)
+}
+
+func (x *expression) string(r *request) string {
+	return x.root.eval(r).(string)
+}
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	identToken
+	stringToken
+	intToken
+	opToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "(", ")", ","}
+
+func tokenize(source string) ([]token, error) {
+	tokens := make([]token, 0)
+	for pos := 0; pos < len(source); {
+		c := rune(source[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case c == '"':
+			end := pos + 1
+			for ; end < len(source) && source[end] != '"'; end++ {
+				if source[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("unterminated string at %d", pos)
+			}
+			text, err := strconv.Unquote(source[pos : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d", pos)
+			}
+			tokens = append(tokens, token{stringToken, text, pos})
+			pos = end + 1
+		case unicode.IsDigit(c):
+			end := pos
+			for end < len(source) && unicode.IsDigit(rune(source[end])) {
+				end++
+			}
+			tokens = append(tokens, token{intToken, source[pos:end], pos})
+			pos = end
+		case unicode.IsLetter(c) || c == '_':
+			end := pos
+			for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) || source[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, token{identToken, source[pos:end], pos})
+			pos = end
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, pos)
+			}
+			tokens = append(tokens, token{opToken, op, pos})
+			pos += len(op)
+		}
+	}
+	return append(tokens, token{eofToken, "end", len(source)}), nil
+}
+
+// parser builds expression tree with recursive descent, from the lowest
+// precedence: ||, &&, !, comparisons, +
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOp(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != opToken {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		return fmt.Errorf("%q expected at %d", op, p.peek().pos)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.acceptOp(op)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind() != boolKind || right.kind() != boolKind {
+			return nil, fmt.Errorf("%q needs bool operands at %d", op, t.pos)
+		}
+		left = binaryNode{op: op, k: boolKind, left: left, right: right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	t, ok := p.acceptOp("!")
+	if !ok {
+		return p.parseComparison()
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.kind() != boolKind {
+		return nil, fmt.Errorf("\"!\" needs bool operand at %d", t.pos)
+	}
+	return notNode{operand: operand}, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if left.kind() != right.kind() {
+		return nil, fmt.Errorf("cannot compare %s with %s at %d", left.kind(), right.kind(), t.pos)
+	}
+	if left.kind() == boolKind && t.text != "==" && t.text != "!=" {
+		return nil, fmt.Errorf("%q needs string or int operands at %d", t.text, t.pos)
+	}
+	return binaryNode{op: t.text, k: boolKind, left: left, right: right}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.acceptOp("+")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind() != right.kind() || left.kind() == boolKind {
+			return nil, fmt.Errorf("cannot add %s and %s at %d", left.kind(), right.kind(), t.pos)
+		}
+		left = binaryNode{op: "+", k: left.kind(), left: left, right: right}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case stringToken:
+		return literal{stringKind, t.text}, nil
+	case intToken:
+		value, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number at %d", t.pos)
+		}
+		return literal{intKind, value}, nil
+	case identToken:
+		if t.text == "true" || t.text == "false" {
+			return literal{boolKind, t.text == "true"}, nil
+		}
+		if _, call := p.acceptOp("("); call {
+			return p.parseCall(t)
+		}
+		v, ok := variables[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %q at %d", t.text, t.pos)
+		}
+		return variableNode{v}, nil
+	case opToken:
+		if t.text == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return inner, p.expectOp(")")
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	args := make([]node, 0)
+	if _, empty := p.acceptOp(")"); !empty {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, more := p.acceptOp(","); !more {
+				break
+			}
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if name.text == "matches" {
+		return newMatchesNode(name, args)
+	}
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+	if len(args) != len(fn.args) {
+		return nil, fmt.Errorf("%s takes %d argument(s) at %d", name.text, len(fn.args), name.pos)
+	}
+	for i, arg := range args {
+		if arg.kind() != fn.args[i] {
+			return nil, fmt.Errorf("argument %d of %s should be %s at %d", i+1, name.text, fn.args[i], name.pos)
+		}
+	}
+	return callNode{function: fn, args: args}, nil
+}
+
+// newMatchesNode creates matches(value, "pattern") call, pattern has to be
+// literal, so it's compiled once
+func newMatchesNode(name token, args []node) (node, error) {
+	if len(args) != 2 || args[0].kind() != stringKind {
+		return nil, fmt.Errorf("matches takes string and pattern at %d", name.pos)
+	}
+	pattern, ok := args[1].(literal)
+	if !ok || pattern.k != stringKind {
+		return nil, fmt.Errorf("pattern of matches should be string literal at %d", name.pos)
+	}
+	re, err := regexp.Compile(pattern.value.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern of matches at %d: %s", name.pos, err)
+	}
+	return matchesNode{value: args[0], pattern: re}, nil
+}
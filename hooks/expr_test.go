@@ -0,0 +1,59 @@
+package hooks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRequest() *request {
+	req := httptest.NewRequest(http.MethodPut, "http://s3.local/images/tmp/a.png?partNumber=2", nil)
+	req.Header.Set("User-Agent", "aws-cli/1.16")
+	req.ContentLength = 2048
+	return newRequest(req)
+}
+
+func TestExpressionsShouldEvaluateAgainstRequest(t *testing.T) {
+	for source, expected := range map[string]bool{
+		`method == "PUT" && bucket == "images"`:                       true,
+		`hasPrefix(key, "tmp/") && !hasSuffix(key, ".jpg")`:           true,
+		`contentLength > 1024 && contentLength <= 2048`:               true,
+		`contentLength + 1 == 2049`:                                   true,
+		`query("partNumber") == "2" || false`:                         true,
+		`matches(header("User-Agent"), "^aws-cli/1\\.")`:              true,
+		`lower("PUT") == "put" && upper(bucket) + "/" == "IMAGES/"`:   true,
+		`(method == "GET" || method == "HEAD") && bucket == "images"`: false,
+		`host != "s3.local" || contains(path, "//")`:                  false,
+		`"a" > "b"`: false,
+	} {
+		x, err := compile(source, boolKind)
+		require.NoError(t, err, source)
+		assert.Equal(t, expected, x.bool(testRequest()), source)
+	}
+	x, err := compile(`bucket + "-" + method`, stringKind)
+	require.NoError(t, err)
+	assert.Equal(t, "images-PUT", x.string(testRequest()))
+}
+
+func TestCompileShouldRejectInvalidExpressions(t *testing.T) {
+	for source, expected := range map[string]string{
+		`method == `:                  `expression "method == ": unexpected "end" at 10`,
+		`method == 1`:                 `expression "method == 1": cannot compare string with int at 7`,
+		`bucket`:                      `expression "bucket": evaluates to string, bool expected`,
+		`size > 1`:                    `expression "size > 1": unknown variable "size" at 0`,
+		`hasPrefix(key)`:              `expression "hasPrefix(key)": hasPrefix takes 2 argument(s) at 0`,
+		`exec("rm")`:                  `expression "exec(\"rm\")": unknown function "exec" at 0`,
+		`matches(key, bucket)`:        `expression "matches(key, bucket)": pattern of matches should be string literal at 0`,
+		`!key`:                        `expression "!key": "!" needs bool operand at 0`,
+		`"unterminated`:               `expression "\"unterminated": unterminated string at 0`,
+		`method == "PUT" method`:      `expression "method == \"PUT\" method": unexpected "method" at 16`,
+		`(method == "PUT"`:            `expression "(method == \"PUT\"": ")" expected at 16`,
+		`key == "a" && contentLength`: `expression "key == \"a\" && contentLength": "&&" needs bool operands at 11`,
+	} {
+		_, err := compile(source, boolKind)
+		assert.EqualError(t, err, expected, source)
+	}
+}
@@ -0,0 +1,126 @@
+package hooks
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/allegro/akubra/hooks/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+type headerHook struct {
+	name  string
+	value *expression
+}
+
+// hook is compiled config.Hook
+type hook struct {
+	name    string
+	when    *expression
+	reject  int
+	message string
+	headers []headerHook
+	region  *expression
+}
+
+func newHook(conf config.Hook) (hook, error) {
+	h := hook{name: conf.Name, reject: conf.Reject, message: conf.Message}
+	if conf.Reject != 0 && (conf.Reject < http.StatusBadRequest || conf.Reject > 599) {
+		return h, fmt.Errorf("Reject status %d is not error status", conf.Reject)
+	}
+	var err error
+	if conf.When != "" {
+		if h.when, err = compile(conf.When, boolKind); err != nil {
+			return h, err
+		}
+	}
+	if conf.Region != "" {
+		if h.region, err = compile(conf.Region, stringKind); err != nil {
+			return h, err
+		}
+	}
+	for name, source := range conf.Headers {
+		value, err := compile(source, stringKind)
+		if err != nil {
+			return h, fmt.Errorf("header %s: %s", name, err)
+		}
+		h.headers = append(h.headers, headerHook{name: http.CanonicalHeaderKey(name), value: value})
+	}
+	sort.Slice(h.headers, func(i, j int) bool { return h.headers[i].name < h.headers[j].name })
+	return h, nil
+}
+
+type hooksRoundTripper struct {
+	roundTripper http.RoundTripper
+	hooks        []hook
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (hrt *hooksRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := newRequest(req)
+	headersCopied := false
+	for _, h := range hrt.hooks {
+		if h.when != nil && !h.when.bool(r) {
+			continue
+		}
+		metrics.Mark("hooks." + metrics.Clean(h.name) + ".matched")
+		if h.reject != 0 {
+			log.Debugf("Request %s rejected by hook %s", utils.RequestID(req), h.name)
+			if h.message == "" {
+				return types.NewS3ErrorResponseForStatus(req, h.reject), nil
+			}
+			return types.NewS3ErrorResponseWithMessage(req, h.reject, h.message), nil
+		}
+		if len(h.headers) > 0 && !headersCopied {
+			req = withHeaderCopy(req)
+			r.req, headersCopied = req, true
+		}
+		for _, header := range h.headers {
+			if value := header.value.string(r); value != "" {
+				req.Header.Set(header.name, value)
+			} else {
+				req.Header.Del(header.name)
+			}
+		}
+		if h.region != nil {
+			if region := h.region.string(r); region != "" {
+				req = req.WithContext(types.WithRegionHint(req.Context(), region))
+				r.req = req
+			}
+		}
+	}
+	return hrt.roundTripper.RoundTrip(req)
+}
+
+func withHeaderCopy(req *http.Request) *http.Request {
+	copied := req.WithContext(req.Context())
+	copied.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		copied.Header[name] = append([]string(nil), values...)
+	}
+	return copied
+}
+
+// Decorator creates httphandler.Decorator applying hooks to requests, it
+// fails if any expression is invalid
+func Decorator(conf config.Hooks) (httphandler.Decorator, error) {
+	hooks := make([]hook, 0, len(conf))
+	for i, hookConf := range conf {
+		h, err := newHook(hookConf)
+		if err != nil {
+			return nil, fmt.Errorf("hook %d (%s): %s", i+1, hookConf.Name, err)
+		}
+		hooks = append(hooks, h)
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if len(hooks) == 0 {
+			return roundTripper
+		}
+		return &hooksRoundTripper{roundTripper: roundTripper, hooks: hooks}
+	}, nil
+}
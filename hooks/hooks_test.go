@@ -0,0 +1,74 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/hooks/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingRoundTripper struct {
+	req *http.Request
+}
+
+func (rrt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rrt.req = req
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func TestHooksShouldRejectMatchingRequests(t *testing.T) {
+	backend := &recordingRoundTripper{}
+	decorator, err := Decorator(config.Hooks{
+		{Name: "no-deletes", When: `method == "DELETE" && bucket == "archive"`, Reject: http.StatusForbidden, Message: "Archive is append only."},
+	})
+	require.NoError(t, err)
+	rt := decorator(backend)
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodDelete, "http://localhost/archive/key", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "<Code>AccessDenied</Code><Message>Archive is append only.</Message>")
+	assert.Nil(t, backend.req)
+
+	resp, err = rt.RoundTrip(httptest.NewRequest(http.MethodDelete, "http://localhost/other/key", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHooksShouldSetHeadersAndRegionHint(t *testing.T) {
+	backend := &recordingRoundTripper{}
+	decorator, err := Decorator(config.Hooks{
+		{Name: "class", When: `hasPrefix(key, "tmp/")`, Headers: map[string]string{
+			"x-amz-storage-class": `"REDUCED_REDUNDANCY"`,
+			"X-Debug":             `""`,
+		}},
+		{Name: "route", Region: `header("X-Amz-Storage-Class") + "-region"`},
+	})
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/images/tmp/a.png", nil)
+	req.Header.Set("X-Debug", "1")
+
+	_, err = decorator(backend).RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, "REDUCED_REDUNDANCY", backend.req.Header.Get("X-Amz-Storage-Class"))
+	assert.Empty(t, backend.req.Header.Get("X-Debug"))
+	assert.Equal(t, "1", req.Header.Get("X-Debug"))
+	region, hinted := types.RegionHint(backend.req.Context())
+	assert.True(t, hinted)
+	assert.Equal(t, "REDUCED_REDUNDANCY-region", region)
+}
+
+func TestDecoratorShouldFailOnInvalidHooks(t *testing.T) {
+	_, err := Decorator(config.Hooks{{Name: "bad", Headers: map[string]string{"X-Size": "contentLength"}}})
+	assert.EqualError(t, err, `hook 1 (bad): header X-Size: expression "contentLength": evaluates to int, string expected`)
+	_, err = Decorator(config.Hooks{{Name: "redirect", Reject: http.StatusFound}})
+	assert.EqualError(t, err, "hook 1 (redirect): Reject status 302 is not error status")
+}
@@ -0,0 +1,12 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// HotSpots configuration, buckets and keys are not tracked if Capacity is not
+// defined
+type HotSpots struct {
+	// Capacity is number of buckets and number of keys tracked at once
+	Capacity int `yaml:"Capacity"`
+	// Window after which counters are reset, default: 1m
+	Window metrics.Interval `yaml:"Window"`
+}
@@ -0,0 +1,168 @@
+package hotspots
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/hotspots/config"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	defaultWindow = time.Minute
+	defaultLimit  = 20
+)
+
+// Window lists most requested buckets and keys between Start and End
+type Window struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Buckets []Counter `json:"buckets"`
+	Keys    []Counter `json:"keys"`
+}
+
+// Report contains window in progress and the last complete one
+type Report struct {
+	Current  Window  `json:"current"`
+	Previous *Window `json:"previous,omitempty"`
+}
+
+// Tracker estimates most requested buckets and keys in fixed memory, so hot
+// spots can be found without metrics of every bucket
+type Tracker struct {
+	mx       sync.Mutex
+	capacity int
+	window   time.Duration
+	buckets  *spaceSaving
+	keys     *spaceSaving
+	since    time.Time
+	previous *Window
+	now      func() time.Time
+}
+
+// New creates Tracker, it returns nil if Capacity is not defined
+func New(conf config.HotSpots) *Tracker {
+	if conf.Capacity <= 0 {
+		return nil
+	}
+	window := conf.Window.Duration
+	if window <= 0 {
+		window = defaultWindow
+	}
+	t := &Tracker{capacity: conf.Capacity, window: window, now: time.Now}
+	t.reset(t.now())
+	return t
+}
+
+// Start resets counters every Window
+func (t *Tracker) Start() {
+	go func() {
+		for range time.Tick(t.window) {
+			t.Rotate()
+		}
+	}()
+}
+
+// Rotate closes current window and starts a new one
+func (t *Tracker) Rotate() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	now := t.now()
+	previous := t.windowLocked(now, 0)
+	t.previous = &previous
+	t.reset(now)
+}
+
+func (t *Tracker) reset(now time.Time) {
+	t.buckets = newSpaceSaving(t.capacity)
+	t.keys = newSpaceSaving(t.capacity)
+	t.since = now
+}
+
+// Record counts request to bucket and key, key may be empty
+func (t *Tracker) Record(bucket, key string) {
+	if bucket == "" {
+		return
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.buckets.add(bucket)
+	if key != "" {
+		t.keys.add(bucket + "/" + key)
+	}
+}
+
+// Report returns at most limit buckets and keys of each window, all
+// tracked ones if limit is not positive
+func (t *Tracker) Report(limit int) Report {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	report := Report{Current: t.windowLocked(t.now(), limit)}
+	if t.previous != nil {
+		previous := *t.previous
+		previous.Buckets = truncate(previous.Buckets, limit)
+		previous.Keys = truncate(previous.Keys, limit)
+		report.Previous = &previous
+	}
+	return report
+}
+
+func (t *Tracker) windowLocked(end time.Time, limit int) Window {
+	return Window{Start: t.since, End: end, Buckets: t.buckets.top(limit), Keys: t.keys.top(limit)}
+}
+
+func truncate(counters []Counter, limit int) []Counter {
+	if limit > 0 && limit < len(counters) {
+		return counters[:limit]
+	}
+	return counters
+}
+
+// ServeHTTP serves report as JSON, number of items is set with limit
+// query parameter, default: 20
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(t.Report(limit)); err != nil {
+		log.Printf("Cannot write hot spots report: %s", err)
+	}
+}
+
+type hotSpotsRoundTripper struct {
+	roundTripper http.RoundTripper
+	tracker      *Tracker
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (hrt *hotSpotsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	hrt.tracker.Record(utils.SplitBucketKey(req.URL.Path))
+	return hrt.roundTripper.RoundTrip(req)
+}
+
+// Decorator creates httphandler.Decorator counting requests of each bucket
+// and key
+func Decorator(tracker *Tracker) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if tracker == nil {
+			return roundTripper
+		}
+		return &hotSpotsRoundTripper{roundTripper: roundTripper, tracker: tracker}
+	}
+}
@@ -0,0 +1,76 @@
+package hotspots
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/hotspots/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpaceSavingShouldFindHeavyHittersInFixedCapacity(t *testing.T) {
+	counters := newSpaceSaving(10)
+	for i := 0; i < 100; i++ {
+		counters.add("hot")
+		counters.add(fmt.Sprintf("cold-%d", i))
+		if i%2 == 0 {
+			counters.add("warm")
+		}
+	}
+
+	top := counters.top(2)
+
+	assert.Len(t, counters.items, 10)
+	require.Len(t, top, 2)
+	assert.Equal(t, Counter{Item: "hot", Count: 100}, top[0])
+	assert.Equal(t, "warm", top[1].Item)
+	assert.True(t, top[1].Count-top[1].Error <= 50 && top[1].Count >= 50)
+}
+
+func TestTrackerShouldReportCurrentAndPreviousWindow(t *testing.T) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	tracker := New(config.HotSpots{Capacity: 10})
+	tracker.now = func() time.Time { return now }
+	tracker.reset(now)
+	rt := Decorator(tracker)(roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil }))
+	for _, path := range []string{"/images/a.png", "/images/a.png", "/images", "/docs/b.txt"} {
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil))
+		require.NoError(t, err)
+	}
+	now = now.Add(time.Minute)
+	tracker.Rotate()
+	tracker.Record("docs", "c.txt")
+
+	recorder := httptest.NewRecorder()
+	tracker.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/hotspots?limit=1", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	report := Report{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, []Counter{{Item: "docs", Count: 1}}, report.Current.Buckets)
+	assert.Equal(t, []Counter{{Item: "docs/c.txt", Count: 1}}, report.Current.Keys)
+	require.NotNil(t, report.Previous)
+	assert.Equal(t, now.Add(-time.Minute), report.Previous.Start)
+	assert.Equal(t, now, report.Previous.End)
+	assert.Equal(t, []Counter{{Item: "images", Count: 3}}, report.Previous.Buckets)
+	assert.Equal(t, []Counter{{Item: "images/a.png", Count: 2}}, report.Previous.Keys)
+}
+
+func TestTrackerShouldBeDisabledWithoutCapacity(t *testing.T) {
+	rt := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+
+	_, wrapped := Decorator(New(config.HotSpots{}))(rt).(*hotSpotsRoundTripper)
+
+	assert.False(t, wrapped)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (rtf roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rtf(req)
+}
@@ -0,0 +1,95 @@
+package hotspots
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Counter is estimated number of requests to item, actual number is between
+// Count-Error and Count
+type Counter struct {
+	Item  string `json:"item"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error"`
+}
+
+type entry struct {
+	Counter
+	index int
+}
+
+// entries is min heap of counters
+type entries []*entry
+
+func (e entries) Len() int           { return len(e) }
+func (e entries) Less(i, j int) bool { return e[i].Count < e[j].Count }
+func (e entries) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+	e[i].index = i
+	e[j].index = j
+}
+
+func (e *entries) Push(x interface{}) {
+	item := x.(*entry)
+	item.index = len(*e)
+	*e = append(*e, item)
+}
+
+func (e *entries) Pop() interface{} {
+	old := *e
+	item := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return item
+}
+
+// spaceSaving finds most frequent items with fixed number of counters. Once
+// all counters are taken, new item replaces the least frequent one and
+// inherits its count as possible error (Metwally et al., 2005)
+type spaceSaving struct {
+	capacity int
+	items    map[string]*entry
+	heap     entries
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, items: make(map[string]*entry, capacity),
+		heap: make(entries, 0, capacity)}
+}
+
+func (s *spaceSaving) add(item string) {
+	if e, ok := s.items[item]; ok {
+		e.Count++
+		heap.Fix(&s.heap, e.index)
+		return
+	}
+	if len(s.heap) < s.capacity {
+		e := &entry{Counter: Counter{Item: item, Count: 1}}
+		heap.Push(&s.heap, e)
+		s.items[item] = e
+		return
+	}
+	min := s.heap[0]
+	delete(s.items, min.Item)
+	min.Item, min.Error = item, min.Count
+	min.Count++
+	heap.Fix(&s.heap, 0)
+	s.items[item] = min
+}
+
+// top returns at most n counters in descending order
+func (s *spaceSaving) top(n int) []Counter {
+	counters := make([]Counter, 0, len(s.heap))
+	for _, e := range s.heap {
+		counters = append(counters, e.Counter)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Count != counters[j].Count {
+			return counters[i].Count > counters[j].Count
+		}
+		return counters[i].Item < counters[j].Item
+	})
+	if n > 0 && n < len(counters) {
+		counters = counters[:n]
+	}
+	return counters
+}
@@ -0,0 +1,82 @@
+package httphandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	logconfig "github.com/allegro/akubra/log/config"
+)
+
+// accessLogFilter decides if request is written to access log
+type accessLogFilter struct {
+	sampleRate uint64
+	sampled    uint64
+	methods    map[string]struct{}
+	statuses   []string
+	buckets    map[string]*accessLogFilter
+}
+
+func newAccessLogFilter(conf logconfig.AccessLogFilter) *accessLogFilter {
+	filter := &accessLogFilter{}
+	if conf.SampleRate > 1 {
+		filter.sampleRate = uint64(conf.SampleRate)
+	}
+	if len(conf.Methods) > 0 {
+		filter.methods = make(map[string]struct{}, len(conf.Methods))
+		for _, method := range conf.Methods {
+			filter.methods[strings.ToUpper(method)] = struct{}{}
+		}
+	}
+	for _, status := range conf.Statuses {
+		filter.statuses = append(filter.statuses, strings.ToLower(status))
+	}
+	if len(conf.Buckets) > 0 {
+		filter.buckets = make(map[string]*accessLogFilter, len(conf.Buckets))
+		for bucket, bucketConf := range conf.Buckets {
+			filter.buckets[bucket] = newAccessLogFilter(bucketConf)
+		}
+	}
+	return filter
+}
+
+// shouldLog reports if request answered with statusCode should be logged,
+// failed requests are never sampled
+func (alf *accessLogFilter) shouldLog(req *http.Request, statusCode int) bool {
+	if bucketFilter, ok := alf.buckets[bucketOf(req)]; ok {
+		return bucketFilter.shouldLog(req, statusCode)
+	}
+	if alf.methods != nil {
+		if _, ok := alf.methods[req.Method]; !ok {
+			return false
+		}
+	}
+	if len(alf.statuses) > 0 && !matchesStatus(alf.statuses, statusCode) {
+		return false
+	}
+	if alf.sampleRate == 0 || statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return true
+	}
+	return atomic.AddUint64(&alf.sampled, 1)%alf.sampleRate == 1
+}
+
+// matchesStatus checks status against codes and "Nxx" classes
+func matchesStatus(statuses []string, statusCode int) bool {
+	code := strconv.Itoa(statusCode)
+	for _, status := range statuses {
+		if status == code || (strings.HasSuffix(status, "xx") && len(status) == 3 && status[0] == code[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucketOf returns first segment of request path
+func bucketOf(req *http.Request) string {
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
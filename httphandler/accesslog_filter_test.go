@@ -0,0 +1,47 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logconfig "github.com/allegro/akubra/log/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func logged(filter *accessLogFilter, method, path string, statusCode int, times int) int {
+	count := 0
+	for i := 0; i < times; i++ {
+		if filter.shouldLog(httptest.NewRequest(method, path, nil), statusCode) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAccessLogFilterShouldSampleOnlySuccessfulRequests(t *testing.T) {
+	filter := newAccessLogFilter(logconfig.AccessLogFilter{SampleRate: 10})
+
+	assert.Equal(t, 3, logged(filter, http.MethodGet, "/bucket/key", http.StatusOK, 30))
+	assert.Equal(t, 30, logged(filter, http.MethodGet, "/bucket/key", http.StatusNotFound, 30))
+	assert.Equal(t, 30, logged(filter, http.MethodGet, "/bucket/key", http.StatusServiceUnavailable, 30))
+}
+
+func TestAccessLogFilterShouldMatchMethodsStatusesAndBuckets(t *testing.T) {
+	filter := newAccessLogFilter(logconfig.AccessLogFilter{
+		Methods:  []string{"put", "DELETE"},
+		Statuses: []string{"2xx", "404"},
+		Buckets: map[string]logconfig.AccessLogFilter{
+			"noisy": {SampleRate: 100},
+			"quiet": {Statuses: []string{"5xx"}},
+		},
+	})
+
+	assert.Equal(t, 1, logged(filter, http.MethodPut, "/bucket/key", http.StatusOK, 1))
+	assert.Equal(t, 1, logged(filter, http.MethodDelete, "/bucket/key", http.StatusNotFound, 1))
+	assert.Equal(t, 0, logged(filter, http.MethodDelete, "/bucket/key", http.StatusForbidden, 1))
+	assert.Equal(t, 0, logged(filter, http.MethodGet, "/bucket/key", http.StatusOK, 1))
+	assert.Equal(t, 2, logged(filter, http.MethodGet, "/noisy/key", http.StatusOK, 200))
+	assert.Equal(t, 0, logged(filter, http.MethodPut, "/quiet", http.StatusOK, 1))
+	assert.Equal(t, 1, logged(filter, http.MethodGet, "/quiet/key", http.StatusBadGateway, 1))
+}
@@ -27,6 +27,73 @@ type Server struct {
 	WriteTimeout metrics.Interval `yaml:"WriteTimeout" validate:"nonzero"`
 	// ShutdownTimeout is gracefull shoutdown duration limit
 	ShutdownTimeout metrics.Interval `yaml:"ShutdownTimeout" validate:"nonzero"`
+	// FlushInterval is max delay of response body data sent to client,
+	// negative value flushes after each write, 0 leaves it to http server
+	FlushInterval metrics.Interval `yaml:"FlushInterval"`
+	// ReusePort enables SO_REUSEPORT on listening sockets (linux only)
+	ReusePort bool `yaml:"ReusePort"`
+	// TLS enables HTTPS on Listen address if defined
+	TLS *TLS `yaml:"TLS,omitempty"`
+	// ServiceDomains enables virtual hosted style addressing, "bucket.<domain>"
+	// hosts are handled as "<domain>/bucket"
+	ServiceDomains []string `yaml:"ServiceDomains"`
+	// AuthServiceEndpoint names credentials store signatures of client
+	// requests are verified with before any backend request, signatures
+	// are verified by backends only if empty
+	AuthServiceEndpoint string `yaml:"AuthServiceEndpoint"`
+	// PublicBuckets accept anonymous GET and HEAD requests, which aren't
+	// authenticated nor signed for backends
+	PublicBuckets []string `yaml:"PublicBuckets"`
+	// SlowRequestThreshold logs requests which response took longer, with
+	// timings of each backend request, 0 disables
+	SlowRequestThreshold metrics.Interval `yaml:"SlowRequestThreshold"`
+	// RequestTimeout is hard limit of time to response, requests stuck
+	// longer get 504 Gateway Timeout, 0 disables
+	RequestTimeout metrics.Interval `yaml:"RequestTimeout"`
+	// Debug exposes net/http/pprof and expvar handlers on
+	// TechnicalEndpointListen
+	Debug bool `yaml:"Debug"`
+	// PluginFiles are Go plugins loaded on start, which register
+	// decorators in their init functions
+	PluginFiles []string `yaml:"PluginFiles"`
+	// Plugins are registered decorators applied to requests in order,
+	// around built in ones
+	Plugins []Plugin `yaml:"Plugins"`
+	// Pipeline names decorators of listener in order requests pass them,
+	// built in ones and Plugins, unlisted are not applied. Empty keeps
+	// default order
+	Pipeline []string `yaml:"Pipeline"`
+	// RoutingDebug attaches shard, region and backends request was routed to
+	// to responses
+	RoutingDebug RoutingDebug `yaml:"RoutingDebug"`
+}
+
+// RoutingDebug enables routing headers for all requests or only for requests
+// with header signed with Secret
+type RoutingDebug struct {
+	Enabled bool   `yaml:"Enabled"`
+	Secret  string `yaml:"Secret"`
+}
+
+// Plugin references decorator registered with httphandler.RegisterDecorator
+type Plugin struct {
+	Name string `yaml:"Name"`
+	// Properties passed to decorator factory
+	Properties map[string]string `yaml:"Properties,omitempty"`
+}
+
+// TLS defines frontend listener TLS termination options
+type TLS struct {
+	// CertFile is PEM encoded certificate (chain) path
+	CertFile string `yaml:"CertFile"`
+	// KeyFile is PEM encoded private key path
+	KeyFile string `yaml:"KeyFile"`
+	// MinVersion is minimal accepted protocol version, one of "1.0", "1.1", "1.2", "1.3"
+	MinVersion string `yaml:"MinVersion"`
+	// CipherSuites limits accepted cipher suites, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	CipherSuites []string `yaml:"CipherSuites"`
+	// ClientCAFile enables mutual TLS, client certificates are verified against CAs from this file
+	ClientCAFile string `yaml:"ClientCAFile"`
 }
 
 // AdditionalHeaders type fields in yaml configuration will parse list of special headers
@@ -63,6 +130,9 @@ type Client struct {
 	Transports transport.Transports `yaml:"Transports,omitempty"`
 	// DialTimeout limits wait period for connection dial
 	DialTimeout metrics.Interval `yaml:"DialTimeout"`
+	// Workers is number of goroutines calling backends, shared by all
+	// requests. Zero starts goroutine for each backend call
+	Workers int `yaml:"Workers" validate:"min=0"`
 }
 
 // HumanSizeUnits type for max. payload body size in bytes
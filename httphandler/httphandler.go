@@ -4,14 +4,19 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"io"
 	"net/http"
 	"sync/atomic"
+	"time"
 
 	"github.com/allegro/akubra/httphandler/config"
 	"github.com/allegro/akubra/log"
+	logconfig "github.com/allegro/akubra/log/config"
+	"github.com/allegro/akubra/types"
 )
 
+// logger logs entries of "httphandler" subsystem
+var logger = log.For("httphandler")
+
 func randomStr(length int) string {
 	randomID := make([]byte, length)
 	_, err := rand.Read(randomID)
@@ -27,42 +32,64 @@ type Handler struct {
 	bodyMaxSize           int64
 	maxConcurrentRequests int32
 	runningRequestCount   int32
+	flushInterval         time.Duration
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	canServe := true
-	log.Printf("handler url %s", req.URL)
-	log.Printf("url host %s, header host %s, req host %s", req.URL.Host, req.Header.Get("Host"), req.Host)
+	randomIDStr := randomStr(12)
+	randomIDContext := context.WithValue(req.Context(), log.ContextreqIDKey, randomIDStr)
+	req = req.WithContext(randomIDContext)
+	reqLog := logger.WithField("request_id", randomIDStr)
+	reqLog.Debugf("Handler url %s, url host %s, header host %s, req host %s", req.URL, req.URL.Host, req.Header.Get("Host"), req.Host)
 
 	if atomic.AddInt32(&h.runningRequestCount, 1) > h.maxConcurrentRequests {
 		canServe = false
 	}
 	defer atomic.AddInt32(&h.runningRequestCount, -1)
 	if !canServe {
-		log.Printf("Rejected request from %s - too many other requests in progress.", req.Host)
-		http.Error(w, "Too many requests in progress.", http.StatusServiceUnavailable)
+		reqLog.Warnf("Rejected request from %s - too many other requests in progress.", req.Host)
+		writeResponse(w, req, types.NewS3ErrorResponse(req, http.StatusServiceUnavailable, types.S3ErrSlowDown, "Too many requests in progress."), 0)
 		return
 	}
 
-	randomIDStr := randomStr(12)
 	validationCode := h.validateIncomingRequest(req)
 	if validationCode > 0 {
-		log.Printf("Rejected invalid incoming request from %s, code %d", req.RemoteAddr, validationCode)
-		w.WriteHeader(validationCode)
+		reqLog.Infof("Rejected invalid incoming request from %s, code %d", req.RemoteAddr, validationCode)
+		writeResponse(w, req, types.NewS3ErrorResponseForStatus(req, validationCode), 0)
 		return
 	}
 
-	randomIDContext := context.WithValue(req.Context(), log.ContextreqIDKey, randomIDStr)
-	log.Debugf("Request id %s", randomIDStr)
-
-	resp, err := h.roundTripper.RoundTrip(req.WithContext(randomIDContext))
+	resp, err := h.roundTripper.RoundTrip(req)
 
 	if err != nil || resp == nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("%s", err)
-		return
+		reqLog.Errorf("%s", err)
+		resp = types.NewS3ErrorResponseForStatus(req, http.StatusInternalServerError)
+	}
+	writeResponse(w, req, withS3ErrorBody(req, resp), h.flushInterval)
+}
+
+// withS3ErrorBody replaces empty error response body with S3 error, so S3
+// clients can handle errors generated by proxy
+func withS3ErrorBody(req *http.Request, resp *http.Response) *http.Response {
+	hasBody := resp.Body != nil && resp.Body != http.NoBody && resp.ContentLength != 0
+	if resp.StatusCode < http.StatusBadRequest || req.Method == http.MethodHead || hasBody {
+		return resp
+	}
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	respBodyCloserFactory(resp, reqID)()
+	errResp := types.NewS3ErrorResponseForStatus(req, resp.StatusCode)
+	for k, v := range resp.Header {
+		if _, ok := errResp.Header[k]; !ok {
+			errResp.Header[k] = v
+		}
 	}
-	defer respBodyCloserFactory(resp, randomIDStr)()
+	return errResp
+}
+
+func writeResponse(w http.ResponseWriter, req *http.Request, resp *http.Response, flushInterval time.Duration) {
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	defer respBodyCloserFactory(resp, reqID)()
 
 	wh := w.Header()
 	for k, v := range resp.Header {
@@ -70,17 +97,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.WriteHeader(resp.StatusCode)
-	if resp.Body == nil {
+	if resp.Body == nil || req.Method == http.MethodHead {
 		return
 	}
 
-	if _, copyErr := io.Copy(w, resp.Body); copyErr != nil {
-		log.Printf("Handler.ServeHTTP Cannot send response body %s reason: %q",
-			randomIDStr,
-			copyErr.Error())
+	if _, copyErr := copyResponseBody(w, resp.Body, flushInterval); copyErr != nil {
+		logger.WithField("request_id", reqID).Warnf("Handler.ServeHTTP Cannot send response body reason: %q", copyErr.Error())
 	} else {
-		log.Printf("Handler.ServeHTTP Sent response body %s",
-			randomIDStr)
+		logger.WithField("request_id", reqID).Debugf("Handler.ServeHTTP Sent response body")
 	}
 }
 
@@ -90,11 +114,11 @@ func respBodyCloserFactory(resp *http.Response, randomIDStr string) func() {
 			return
 		}
 		if resp.Body == nil {
-			log.Debugf("ResponseBody for request %s is nil - nothing to close (handler)", randomIDStr)
+			logger.WithField("request_id", randomIDStr).Debugf("ResponseBody is nil - nothing to close (handler)")
 			return
 		}
 		closeErr := resp.Body.Close()
-		log.Debugf("ResponseBody for request %s closed with %s error (handler)", randomIDStr, closeErr)
+		logger.WithField("request_id", randomIDStr).Debugf("ResponseBody closed with %s error (handler)", closeErr)
 	}
 }
 
@@ -103,14 +127,11 @@ func (h *Handler) validateIncomingRequest(req *http.Request) int {
 }
 
 // DecorateRoundTripper applies common http.RoundTripper decorators
-func DecorateRoundTripper(conf config.Client, accesslog log.Logger, healthCheckEndpoint string, rt http.RoundTripper) http.RoundTripper {
-	return Decorate(
-		rt,
-		HeadersSuplier(conf.AdditionalRequestHeaders, conf.AdditionalResponseHeaders),
-		AccessLogging(accesslog),
-		OptionsHandler,
-		HealthCheckHandler(healthCheckEndpoint),
-	)
+func DecorateRoundTripper(conf config.Service, accesslog log.Logger, rt http.RoundTripper) http.RoundTripper {
+	for _, named := range ServiceDecorators(conf, accesslog, logconfig.AccessLogFilter{}) {
+		rt = named.Decorator(rt)
+	}
+	return rt
 }
 
 // NewHandlerWithRoundTripper returns Handler, but will not construct transport.MultiTransport by itself
@@ -119,5 +140,6 @@ func NewHandlerWithRoundTripper(roundTripper http.RoundTripper, servConfig confi
 		roundTripper:          roundTripper,
 		bodyMaxSize:           servConfig.BodyMaxSize.SizeInBytes,
 		maxConcurrentRequests: servConfig.MaxConcurrentRequests,
+		flushInterval:         servConfig.FlushInterval.Duration,
 	}, nil
 }
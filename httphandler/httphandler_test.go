@@ -1,14 +1,31 @@
 package httphandler
 
 import (
+	"encoding/xml"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/allegro/akubra/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (rtf roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rtf(req)
+}
+
+func s3ErrorFromRecorder(t *testing.T, writer *httptest.ResponseRecorder) types.S3Error {
+	assert.Equal(t, "application/xml", writer.Header().Get("Content-Type"))
+	s3Error := types.S3Error{}
+	require.NoError(t, xml.Unmarshal(writer.Body.Bytes(), &s3Error))
+	assert.NotEmpty(t, s3Error.RequestID)
+	return s3Error
+}
+
 func TestShouldReturnEntityTooLargeCode(t *testing.T) {
 	request := httptest.NewRequest("POST", "http://somepath", nil)
 	request.Header.Set("Content-Length", "4096")
@@ -33,6 +50,54 @@ func TestShouldReturnServiceNotAvailableOnTooManyRequests(t *testing.T) {
 	writer := httptest.NewRecorder()
 	handler.ServeHTTP(writer, request)
 	assert.Equal(t, http.StatusServiceUnavailable, writer.Code)
+	assert.Equal(t, types.S3ErrSlowDown, s3ErrorFromRecorder(t, writer).Code)
+}
+
+func TestShouldReturnS3InternalErrorOnRoundTripError(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://localhost/bucket/key", nil)
+	handler := &Handler{bodyMaxSize: 1024, maxConcurrentRequests: 1}
+	handler.roundTripper = roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("backend unreachable")
+	})
+	writer := httptest.NewRecorder()
+
+	handler.ServeHTTP(writer, request)
+
+	assert.Equal(t, http.StatusInternalServerError, writer.Code)
+	s3Error := s3ErrorFromRecorder(t, writer)
+	assert.Equal(t, types.S3ErrInternalError, s3Error.Code)
+	assert.Equal(t, "/bucket/key", s3Error.Resource)
+}
+
+func TestShouldFillEmptyErrorResponseWithS3ErrorBody(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://localhost/bucket/key", nil)
+	handler := &Handler{bodyMaxSize: 1024, maxConcurrentRequests: 1}
+	handler.roundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("X-Custom", "value")
+		return &http.Response{StatusCode: http.StatusForbidden, Header: header, Request: req}, nil
+	})
+	writer := httptest.NewRecorder()
+
+	handler.ServeHTTP(writer, request)
+
+	assert.Equal(t, http.StatusForbidden, writer.Code)
+	assert.Equal(t, "value", writer.Header().Get("X-Custom"))
+	assert.Equal(t, types.S3ErrAccessDenied, s3ErrorFromRecorder(t, writer).Code)
+}
+
+func TestShouldNotAddS3ErrorBodyToHeadResponse(t *testing.T) {
+	request := httptest.NewRequest("HEAD", "http://localhost/bucket/key", nil)
+	handler := &Handler{bodyMaxSize: 1024, maxConcurrentRequests: 1}
+	handler.roundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Request: req}, nil
+	})
+	writer := httptest.NewRecorder()
+
+	handler.ServeHTTP(writer, request)
+
+	assert.Equal(t, http.StatusNotFound, writer.Code)
+	assert.Empty(t, writer.Body.Bytes())
 }
 
 func TestShouldReturnStatusOKOnHealthCheckEndpoint(t *testing.T) {
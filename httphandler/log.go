@@ -6,8 +6,13 @@ import (
 	"time"
 
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/types"
 )
 
+// ServedFromHeader names region which served request instead of region
+// owning object
+const ServedFromHeader = "X-Akubra-Served-From"
+
 // AccessMessageData holds all important informations
 // about http roundtrip
 type AccessMessageData struct {
@@ -17,9 +22,16 @@ type AccessMessageData struct {
 	UserAgent  string  `json:"useragent"`
 	StatusCode int     `json:"status"`
 	Duration   float64 `json:"duration_ms"`
-	RespErr    string  `json:"error"`
-	ReqID      string  `json:"reqID"`
-	Time       string  `json:"ts"`
+	// FirstByte is time to response headers, Duration includes sending body
+	FirstByte float64 `json:"first_byte_ms"`
+	RespErr   string  `json:"error"`
+	ReqID     string  `json:"reqID"`
+	Time      string  `json:"ts"`
+	// ServedFrom is failover region which served request, if any
+	ServedFrom string `json:"served_from,omitempty"`
+	// ClientIP is address of client, behind trusted proxies it's taken
+	// from X-Forwarded-For header
+	ClientIP string `json:"client_ip,omitempty"`
 }
 
 // String produces data in csv format with fields in following order:
@@ -40,8 +52,8 @@ func NewAccessLogMessage(req http.Request,
 		req.Host,
 		req.URL.Path,
 		req.Header.Get("User-Agent"),
-		statusCode, duration, respErr,
-		reqID, ts}
+		statusCode, duration, 0, respErr,
+		reqID, ts, "", types.ClientIP(&req)}
 }
 
 // ScanCSVAccessLogMessage will scan csv string and return AccessMessageData.
@@ -68,6 +80,11 @@ type SyncLogMessageData struct {
 	ErrorMsg      string `json:"error"`
 	ReqID         string `json:"reqID"`
 	Time          string `json:"ts"`
+	// Tombstone marks delete which failed on FailedHost only, object should
+	// not be copied back there from SuccessHost
+	Tombstone bool `json:"tombstone,omitempty"`
+	// Region FailedHost belongs to, set for cross-region replication only
+	Region string `json:"region,omitempty"`
 }
 
 // String produces data in csv format with fields in following order:
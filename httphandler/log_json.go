@@ -0,0 +1,118 @@
+package httphandler
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// accessLogBuffers has no New function, buffers grow to the longest message
+// encoded and are reused
+var accessLogBuffers = sync.Pool{}
+
+// AppendJSON appends message encoded the same way as json.Marshal does to
+// buf, it doesn't allocate if buf has enough capacity
+func (amd *AccessMessageData) AppendJSON(buf []byte) []byte {
+	buf = append(buf, `{"method":`...)
+	buf = appendJSONString(buf, amd.Method)
+	buf = append(buf, `,"host":`...)
+	buf = appendJSONString(buf, amd.Host)
+	buf = append(buf, `,"path":`...)
+	buf = appendJSONString(buf, amd.Path)
+	buf = append(buf, `,"useragent":`...)
+	buf = appendJSONString(buf, amd.UserAgent)
+	buf = append(buf, `,"status":`...)
+	buf = strconv.AppendInt(buf, int64(amd.StatusCode), 10)
+	buf = append(buf, `,"duration_ms":`...)
+	buf = appendJSONFloat(buf, amd.Duration)
+	buf = append(buf, `,"first_byte_ms":`...)
+	buf = appendJSONFloat(buf, amd.FirstByte)
+	buf = append(buf, `,"error":`...)
+	buf = appendJSONString(buf, amd.RespErr)
+	buf = append(buf, `,"reqID":`...)
+	buf = appendJSONString(buf, amd.ReqID)
+	buf = append(buf, `,"ts":`...)
+	buf = appendJSONString(buf, amd.Time)
+	if amd.ServedFrom != "" {
+		buf = append(buf, `,"served_from":`...)
+		buf = appendJSONString(buf, amd.ServedFrom)
+	}
+	if amd.ClientIP != "" {
+		buf = append(buf, `,"client_ip":`...)
+		buf = appendJSONString(buf, amd.ClientIP)
+	}
+	return append(buf, '}')
+}
+
+// appendJSONString escapes s like encoding/json with HTML escaping enabled
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				buf = append(buf, '\\', b)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
+
+// appendJSONFloat formats f like encoding/json, NaN and infinities, which
+// json.Marshal rejects, are written as 0
+func appendJSONFloat(buf []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(buf, '0')
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	buf = strconv.AppendFloat(buf, f, format, -1, 64)
+	if format == 'e' {
+		// e-09 is written as e-9
+		n := len(buf)
+		if n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf
+}
@@ -0,0 +1,46 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogMessageShouldBeEncodedAsByJSONMarshal(t *testing.T) {
+	messages := []AccessMessageData{
+		{},
+		{Method: "GET", Host: "s3.internal:8080", Path: "/bucket/key", UserAgent: "aws-cli/1.16",
+			StatusCode: 200, Duration: 12.345678, FirstByte: 0.0000001, ReqID: "abc", Time: "2018-01-01T00:00:00Z", ClientIP: "2001:db8::1"},
+		{Path: "/bucket/<a&b>\"quoted\"\\\n\r\t\x01", UserAgent: "zażółć \u2028\u2029", Duration: 1e21,
+			FirstByte: -3, RespErr: "Host in maintenance mode", ServedFrom: "us"},
+	}
+	for _, message := range messages {
+		expected, err := json.Marshal(message)
+		require.NoError(t, err)
+
+		assert.Equal(t, string(expected), string(message.AppendJSON(nil)))
+	}
+}
+
+func TestAccessLogMessageShouldReplaceInvalidUTF8(t *testing.T) {
+	message := AccessMessageData{Path: "/bucket/\xffkey"}
+	decoded := AccessMessageData{}
+
+	require.NoError(t, json.Unmarshal(message.AppendJSON(nil), &decoded))
+
+	assert.Equal(t, "/bucket/\ufffdkey", decoded.Path)
+}
+
+func TestAccessLogMessageEncodingShouldNotAllocate(t *testing.T) {
+	message := AccessMessageData{Method: "PUT", Host: "s3.internal", Path: "/bucket/<key>", UserAgent: "aws-cli/1.16",
+		StatusCode: 200, Duration: 12.3, FirstByte: 1.2, ReqID: "abc", Time: "2018-01-01T00:00:00Z", ServedFrom: "us", ClientIP: "192.0.2.1"}
+	buf := make([]byte, 0, 1024)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = message.AppendJSON(buf[:0])
+	})
+
+	assert.Equal(t, float64(0), allocs)
+}
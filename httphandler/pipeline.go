@@ -0,0 +1,84 @@
+package httphandler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/allegro/akubra/httphandler/config"
+	"github.com/allegro/akubra/log"
+	logconfig "github.com/allegro/akubra/log/config"
+)
+
+// NamedDecorator is Decorator which may be referenced in listener Pipeline
+type NamedDecorator struct {
+	Name      string
+	Decorator Decorator
+}
+
+// ServiceDecorators lists common decorators of service listener, innermost
+// first, as DecorateRoundTripper applies them
+func ServiceDecorators(conf config.Service, accesslog log.Logger, filter logconfig.AccessLogFilter) []NamedDecorator {
+	return []NamedDecorator{
+		{"routing-debug", RoutingDebug(conf.Server.RoutingDebug)},
+		{"virtual-hosted-style", VirtualHostedStyle(conf.Server.ServiceDomains)},
+		{"headers", HeadersSuplier(conf.Client.AdditionalRequestHeaders, conf.Client.AdditionalResponseHeaders)},
+		{"slow-requests", SlowRequests(conf.Server.SlowRequestThreshold.Duration, conf.Server.RequestTimeout.Duration)},
+		{"access-log", FilteredAccessLogging(accesslog, filter)},
+		{"health-check", HealthCheckHandler(conf.Server.HealthCheckEndpoint)},
+	}
+}
+
+// NamedPluginDecorators creates decorators of plugins named as plugins
+func NamedPluginDecorators(plugins []config.Plugin) ([]NamedDecorator, error) {
+	decorators, err := PluginDecorators(plugins)
+	if err != nil {
+		return nil, err
+	}
+	named := make([]NamedDecorator, 0, len(decorators))
+	for i, decorator := range decorators {
+		named = append(named, NamedDecorator{Name: plugins[i].Name, Decorator: decorator})
+	}
+	return named, nil
+}
+
+// Pipeline selects and orders available decorators, innermost first, so they
+// may be passed to Decorate. Names are listed in order requests pass
+// decorators, outermost first, decorators not listed are not applied. Empty
+// names keep all available decorators in given order
+func Pipeline(names []string, available []NamedDecorator) ([]Decorator, error) {
+	if len(names) == 0 {
+		decorators := make([]Decorator, 0, len(available))
+		for _, named := range available {
+			decorators = append(decorators, named.Decorator)
+		}
+		return decorators, nil
+	}
+	byName := make(map[string]Decorator, len(available))
+	ambiguous := make(map[string]struct{})
+	availableNames := make([]string, 0, len(available))
+	for _, named := range available {
+		if _, defined := byName[named.Name]; defined {
+			ambiguous[named.Name] = struct{}{}
+			continue
+		}
+		byName[named.Name] = named.Decorator
+		availableNames = append(availableNames, named.Name)
+	}
+	decorators := make([]Decorator, len(names))
+	used := make(map[string]struct{}, len(names))
+	for i, name := range names {
+		decorator, defined := byName[name]
+		if !defined {
+			return nil, fmt.Errorf("unknown decorator %q in Pipeline, available are: %s", name, strings.Join(availableNames, ", "))
+		}
+		if _, isAmbiguous := ambiguous[name]; isAmbiguous {
+			return nil, fmt.Errorf("decorator %q is defined more than once", name)
+		}
+		if _, duplicated := used[name]; duplicated {
+			return nil, fmt.Errorf("decorator %q is listed twice in Pipeline", name)
+		}
+		used[name] = struct{}{}
+		decorators[len(names)-1-i] = decorator
+	}
+	return decorators, nil
+}
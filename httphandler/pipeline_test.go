@@ -0,0 +1,51 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tracingDecorator(name string) NamedDecorator {
+	return NamedDecorator{Name: name, Decorator: func(roundTripper http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Add("X-Trace", name)
+			return roundTripper.RoundTrip(req)
+		})
+	}}
+}
+
+func trace(t *testing.T, decorators []Decorator) []string {
+	backend := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+	resp, err := Decorate(backend, decorators...).RoundTrip(httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+	require.NoError(t, err)
+	return resp.Request.Header["X-Trace"]
+}
+
+func TestPipelineShouldApplyListedDecoratorsInConfiguredOrder(t *testing.T) {
+	available := []NamedDecorator{tracingDecorator("auth"), tracingDecorator("cache"), tracingDecorator("access-log")}
+
+	decorators, err := Pipeline(nil, available)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"access-log", "cache", "auth"}, trace(t, decorators))
+
+	decorators, err = Pipeline([]string{"auth", "access-log"}, available)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"auth", "access-log"}, trace(t, decorators))
+}
+
+func TestPipelineShouldFailForUnknownDuplicatedOrAmbiguousDecorators(t *testing.T) {
+	available := []NamedDecorator{tracingDecorator("auth"), tracingDecorator("plugin"), tracingDecorator("plugin")}
+
+	_, err := Pipeline([]string{"cache"}, available)
+	assert.EqualError(t, err, `unknown decorator "cache" in Pipeline, available are: auth, plugin`)
+	_, err = Pipeline([]string{"auth", "auth"}, available)
+	assert.EqualError(t, err, `decorator "auth" is listed twice in Pipeline`)
+	_, err = Pipeline([]string{"plugin"}, available)
+	assert.EqualError(t, err, `decorator "plugin" is defined more than once`)
+}
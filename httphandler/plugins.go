@@ -0,0 +1,103 @@
+package httphandler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/allegro/akubra/httphandler/config"
+)
+
+// DecoratorFactory creates Decorator configured with plugin properties
+type DecoratorFactory func(properties map[string]string) (Decorator, error)
+
+// ResponseHandler may modify or replace response of request, it's called
+// for requests which got response
+type ResponseHandler func(req *http.Request, resp *http.Response) *http.Response
+
+// ResponseHandlerFactory creates ResponseHandler configured with plugin
+// properties
+type ResponseHandlerFactory func(properties map[string]string) (ResponseHandler, error)
+
+var (
+	pluginsMx          sync.RWMutex
+	decoratorFactories = make(map[string]DecoratorFactory)
+)
+
+// RegisterDecorator makes decorator available to configuration under name,
+// it's meant to be called from init function of plugin package. It panics
+// if name is already registered or factory is nil
+func RegisterDecorator(name string, factory DecoratorFactory) {
+	if factory == nil {
+		panic("httphandler: RegisterDecorator factory is nil")
+	}
+	pluginsMx.Lock()
+	defer pluginsMx.Unlock()
+	if _, registered := decoratorFactories[name]; registered {
+		panic(fmt.Sprintf("httphandler: RegisterDecorator called twice for %q", name))
+	}
+	decoratorFactories[name] = factory
+}
+
+// RegisterResponseHandler makes response handler available to configuration
+// under name, as decorator passing responses through it
+func RegisterResponseHandler(name string, factory ResponseHandlerFactory) {
+	if factory == nil {
+		panic("httphandler: RegisterResponseHandler factory is nil")
+	}
+	RegisterDecorator(name, func(properties map[string]string) (Decorator, error) {
+		handler, err := factory(properties)
+		if err != nil {
+			return nil, err
+		}
+		return func(roundTripper http.RoundTripper) http.RoundTripper {
+			return &responseHandlerRoundTripper{roundTripper: roundTripper, handler: handler}
+		}, nil
+	})
+}
+
+// RegisteredDecorators lists sorted names of registered decorators
+func RegisteredDecorators() []string {
+	pluginsMx.RLock()
+	defer pluginsMx.RUnlock()
+	names := make([]string, 0, len(decoratorFactories))
+	for name := range decoratorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PluginDecorators creates decorators of plugins in configured order
+func PluginDecorators(plugins []config.Plugin) ([]Decorator, error) {
+	pluginsMx.RLock()
+	defer pluginsMx.RUnlock()
+	decorators := make([]Decorator, 0, len(plugins))
+	for _, plugin := range plugins {
+		factory, registered := decoratorFactories[plugin.Name]
+		if !registered {
+			return nil, fmt.Errorf("plugin %q is not registered", plugin.Name)
+		}
+		decorator, err := factory(plugin.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %s", plugin.Name, err)
+		}
+		decorators = append(decorators, decorator)
+	}
+	return decorators, nil
+}
+
+type responseHandlerRoundTripper struct {
+	roundTripper http.RoundTripper
+	handler      ResponseHandler
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (rhrt *responseHandlerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rhrt.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	return rhrt.handler(req, resp), nil
+}
@@ -0,0 +1,60 @@
+package httphandler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/httphandler/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func headerDecorator(properties map[string]string) (Decorator, error) {
+	if properties["Value"] == "" {
+		return nil, errors.New("no Value defined")
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Add("X-Plugin", properties["Value"])
+			return roundTripper.RoundTrip(req)
+		})
+	}, nil
+}
+
+func TestPluginDecoratorsShouldBeAppliedInConfiguredOrder(t *testing.T) {
+	RegisterDecorator("test-header", headerDecorator)
+	RegisterResponseHandler("test-status", func(map[string]string) (ResponseHandler, error) {
+		return func(req *http.Request, resp *http.Response) *http.Response {
+			resp.Header.Set("X-Seen", req.Header.Get("X-Plugin"))
+			return resp
+		}, nil
+	})
+
+	decorators, err := PluginDecorators([]config.Plugin{
+		{Name: "test-status"},
+		{Name: "test-header", Properties: map[string]string{"Value": "inner"}},
+		{Name: "test-header", Properties: map[string]string{"Value": "outer"}},
+	})
+	require.NoError(t, err)
+	backend := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}, nil
+	})
+	resp, err := Decorate(backend, decorators...).RoundTrip(httptest.NewRequest(http.MethodGet, "/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, "outer", resp.Header.Get("X-Seen"))
+	assert.Equal(t, []string{"outer", "inner"}, resp.Request.Header["X-Plugin"])
+	assert.Contains(t, RegisteredDecorators(), "test-header")
+}
+
+func TestPluginDecoratorsShouldFailForUnknownOrMisconfiguredPlugins(t *testing.T) {
+	RegisterDecorator("test-misconfigured", headerDecorator)
+
+	_, err := PluginDecorators([]config.Plugin{{Name: "test-unknown"}})
+	assert.EqualError(t, err, `plugin "test-unknown" is not registered`)
+	_, err = PluginDecorators([]config.Plugin{{Name: "test-misconfigured"}})
+	assert.EqualError(t, err, `plugin "test-misconfigured": no Value defined`)
+	assert.Panics(t, func() { RegisterDecorator("test-misconfigured", headerDecorator) })
+}
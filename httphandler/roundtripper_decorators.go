@@ -1,15 +1,20 @@
 package httphandler
 
 import (
-	"encoding/json"
+	"io"
+	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"io/ioutil"
 
 	"github.com/allegro/akubra/httphandler/config"
 	"github.com/allegro/akubra/log"
+	logconfig "github.com/allegro/akubra/log/config"
+	"github.com/allegro/akubra/types"
 )
 
 // Decorator is http.RoundTripper interface wrapper
@@ -18,37 +23,70 @@ type Decorator func(http.RoundTripper) http.RoundTripper
 type loggingRoundTripper struct {
 	roundTripper http.RoundTripper
 	accessLog    log.Logger
+	// filter skips some requests, all are logged if nil
+	filter *accessLogFilter
 }
 
+// RoundTrip logs request when response body is closed, so Duration covers
+// sending whole body and FirstByte time to response headers
 func (lrt *loggingRoundTripper) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 
 	timeStart := time.Now()
 	resp, err = lrt.roundTripper.RoundTrip(req)
+	firstByte := time.Since(timeStart)
 
-	duration := time.Since(timeStart).Seconds() * 1000
 	statusCode := http.StatusServiceUnavailable
+	servedFrom := ""
 
 	if resp != nil {
 		statusCode = resp.StatusCode
+		servedFrom = resp.Header.Get(ServedFromHeader)
 	}
 
+	if lrt.filter != nil && !lrt.filter.shouldLog(req, statusCode) {
+		return
+	}
 	errStr := ""
 	if err != nil {
 		errStr = err.Error()
 	}
-	accessLogMessage := NewAccessLogMessage(*req,
-		statusCode,
-		duration,
-		errStr)
-	jsonb, almerr := json.Marshal(accessLogMessage)
-	if almerr != nil {
-		log.Printf("Cannot marshal access log message %s", almerr.Error())
+	logRequest := func() {
+		lrt.log(req, statusCode, timeStart, firstByte, errStr, servedFrom)
+	}
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		logRequest()
 		return
 	}
-	lrt.accessLog.Printf("%s", jsonb)
+	resp.Body = &loggingBody{ReadCloser: resp.Body, log: logRequest}
 	return
 }
 
+func (lrt *loggingRoundTripper) log(req *http.Request, statusCode int, timeStart time.Time, firstByte time.Duration, errStr, servedFrom string) {
+	accessLogMessage := NewAccessLogMessage(*req,
+		statusCode,
+		time.Since(timeStart).Seconds()*1000,
+		errStr)
+	accessLogMessage.FirstByte = firstByte.Seconds() * 1000
+	accessLogMessage.ServedFrom = servedFrom
+	buf, _ := accessLogBuffers.Get().([]byte)
+	buf = accessLogMessage.AppendJSON(buf[:0])
+	lrt.accessLog.Printf("%s", buf)
+	accessLogBuffers.Put(buf)
+}
+
+// loggingBody writes access log when response body is closed
+type loggingBody struct {
+	io.ReadCloser
+	once sync.Once
+	log  func()
+}
+
+func (lb *loggingBody) Close() error {
+	err := lb.ReadCloser.Close()
+	lb.once.Do(lb.log)
+	return err
+}
+
 // AccessLogging creares Decorator with access log collector
 func AccessLogging(logger log.Logger) Decorator {
 	return func(rt http.RoundTripper) http.RoundTripper {
@@ -56,6 +94,14 @@ func AccessLogging(logger log.Logger) Decorator {
 	}
 }
 
+// FilteredAccessLogging creates Decorator with access log collector writing
+// requests selected by filter
+func FilteredAccessLogging(logger log.Logger, filter logconfig.AccessLogFilter) Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &loggingRoundTripper{roundTripper: rt, accessLog: logger, filter: newAccessLogFilter(filter)}
+	}
+}
+
 type headersSuplier struct {
 	requestHeaders  config.AdditionalHeaders
 	responseHeaders config.AdditionalHeaders
@@ -63,8 +109,6 @@ type headersSuplier struct {
 }
 
 func (hs *headersSuplier) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-
-	req.URL.Scheme = "http"
 	for k, v := range hs.requestHeaders {
 		_, ok := req.Header[k]
 		if !ok {
@@ -72,15 +116,6 @@ func (hs *headersSuplier) RoundTrip(req *http.Request) (resp *http.Response, err
 		}
 	}
 
-	// While tcp host is rewritten we need to keep Host header
-	// intact for sake of s3 authorization
-	if strings.Contains(req.Host, ".s3.") {
-		prefix := strings.Split(req.Host, ".s3.")[0]
-		newhost := prefix + "." + req.URL.Host
-		req.Header.Set("Host", newhost)
-		req.Host = newhost
-	}
-
 	resp, err = hs.roundTripper.RoundTrip(req)
 
 	if err != nil || resp == nil {
@@ -108,13 +143,66 @@ func HeadersSuplier(requestHeaders, responseHeaders config.AdditionalHeaders) De
 	}
 }
 
+type virtualHostedStyle struct {
+	domains      []string
+	roundTripper http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (vhs *virtualHostedStyle) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, port, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		host = req.Host
+	}
+	bucket, domain, ok := vhs.split(strings.ToLower(host))
+	if !ok {
+		return vhs.roundTripper.RoundTrip(req)
+	}
+	if port != "" {
+		domain = net.JoinHostPort(domain, port)
+	}
+	vh := types.VirtualHost{Host: req.Host, Bucket: bucket}
+	return vhs.roundTripper.RoundTrip(types.ToPathStyle(req, vh, domain))
+}
+
+// split extracts bucket from host matching one of service domains
+func (vhs *virtualHostedStyle) split(host string) (bucket, domain string, ok bool) {
+	for _, domain := range vhs.domains {
+		if host == domain {
+			return "", "", false
+		}
+		if strings.HasSuffix(host, "."+domain) {
+			return host[:len(host)-len(domain)-1], domain, true
+		}
+	}
+	return "", "", false
+}
+
+// VirtualHostedStyle creates Decorator which rewrites virtual hosted style
+// requests ("bucket.domain") addressed to one of service domains to path style
+// ("domain/bucket"), original addressing is available with types.VirtualHostOf
+func VirtualHostedStyle(domains []string) Decorator {
+	sorted := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		sorted = append(sorted, strings.ToLower(domain))
+	}
+	// Longest domain wins, e.g. "s3.dc1.example.com" over "example.com"
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if len(sorted) == 0 {
+			return roundTripper
+		}
+		return &virtualHostedStyle{domains: sorted, roundTripper: roundTripper}
+	}
+}
+
 type optionsHandler struct {
 	roundTripper http.RoundTripper
 }
 
 func (os optionsHandler) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	isOptions := false
-	if req.Method == "OPTIONS" {
+	if req.Method == "OPTIONS" && !isPreflight(req) {
 		req.Method = "HEAD"
 		isOptions = true
 	}
@@ -128,11 +216,17 @@ func (os optionsHandler) RoundTrip(req *http.Request) (resp *http.Response, err
 }
 
 // OptionsHandler changes OPTIONS method it to HEAD and pass it to
-// decorated http.RoundTripper, also clears response content-length header
+// decorated http.RoundTripper, also clears response content-length header.
+// CORS preflight requests are passed unchanged
 func OptionsHandler(roundTripper http.RoundTripper) http.RoundTripper {
 	return optionsHandler{roundTripper: roundTripper}
 }
 
+// isPreflight reports if OPTIONS request is CORS preflight
+func isPreflight(req *http.Request) bool {
+	return req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != ""
+}
+
 type statusHandler struct {
 	healthCheckEndpoint string
 	roundTripper        http.RoundTripper
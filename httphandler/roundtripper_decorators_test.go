@@ -9,10 +9,12 @@ import (
 	"net/http/httptest"
 	"net/textproto"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -74,6 +76,42 @@ func TestHeadersSuplier(t *testing.T) {
 	assertIncludeHeaders(t, map[string][]string(res.Header), respHeaders)
 }
 
+type requestCapturingRoundTripper struct {
+	request *http.Request
+}
+
+func (rcrt *requestCapturingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rcrt.request = req
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func TestVirtualHostedStyleShouldRewriteRequestsToServiceDomains(t *testing.T) {
+	backend := &requestCapturingRoundTripper{}
+	rt := VirtualHostedStyle([]string{"example.com", "S3.dc1.example.com"})(backend)
+
+	for _, testCase := range []struct {
+		url, host, path, bucket string
+	}{
+		{"http://bucket.s3.dc1.example.com:8080/key", "s3.dc1.example.com:8080", "/bucket/key", "bucket"},
+		{"http://my.bucket.example.com/", "example.com", "/my.bucket/", "my.bucket"},
+		{"http://s3.dc1.example.com/bucket/key", "s3.dc1.example.com", "/bucket/key", ""},
+		{"http://other.domain/bucket/key", "other.domain", "/bucket/key", ""},
+	} {
+		_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, testCase.url, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.host, backend.request.Host, testCase.url)
+		assert.Equal(t, testCase.path, backend.request.URL.Path, testCase.url)
+		vh, ok := types.VirtualHostOf(backend.request)
+		assert.Equal(t, testCase.bucket != "", ok, testCase.url)
+		assert.Equal(t, testCase.bucket, vh.Bucket, testCase.url)
+	}
+}
+
+func TestVirtualHostedStyleShouldNotWrapWithoutDomains(t *testing.T) {
+	backend := &requestCapturingRoundTripper{}
+	assert.Equal(t, backend, VirtualHostedStyle(nil)(backend))
+}
+
 func TestOptionsHandler(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if assert.Equal(t, r.Method, "HEAD") {
@@ -88,6 +126,22 @@ func TestOptionsHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, res.StatusCode, "Should return ok")
 }
 
+func TestOptionsHandlerShouldPassPreflightUnchanged(t *testing.T) {
+	method := ""
+	rt := OptionsHandler(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		method = req.Method
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	}))
+	req := httptest.NewRequest(http.MethodOptions, "http://localhost/bucket/key", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+
+	_, err := rt.RoundTrip(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodOptions, method)
+}
+
 func TestAccessLogging(t *testing.T) {
 	var buf bytes.Buffer
 	logger := &logrus.Logger{
@@ -102,7 +156,8 @@ func TestAccessLogging(t *testing.T) {
 		assert.Nil(t, err)
 	}))
 
-	sendReq(t, srv, "PUT", nil, rt)
+	resp := sendReq(t, srv, "PUT", nil, rt)
+	assert.NoError(t, resp.Body.Close())
 
 	amddata := bytes.Trim(buf.Bytes(), "\n")
 	amd := &AccessMessageData{}
@@ -113,3 +168,29 @@ func TestAccessLogging(t *testing.T) {
 	}
 	assert.Equal(t, http.StatusOK, amd.StatusCode)
 }
+
+func TestAccessLoggingShouldMeasureFirstByteSeparately(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &logrus.Logger{
+		Out:       &buf,
+		Formatter: log.PlainTextFormatter{},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.DebugLevel,
+	}
+	rt := Decorate(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader([]byte("OK")))}, nil
+	}), AccessLogging(logger))
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String(), "access log should be written when body is closed")
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, resp.Body.Close())
+	assert.NoError(t, resp.Body.Close())
+
+	amd := &AccessMessageData{}
+	assert.NoError(t, json.Unmarshal(bytes.Trim(buf.Bytes(), "\n"), amd))
+	assert.True(t, amd.Duration >= 10, "duration should include body transfer, got %f", amd.Duration)
+	assert.True(t, amd.FirstByte < amd.Duration)
+}
@@ -0,0 +1,103 @@
+package httphandler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/httphandler/config"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+const (
+	// RoutingDebugHeader enables routing headers of request, its value is
+	// "<unix timestamp>:<hex HMAC-SHA256 of timestamp with secret>"
+	RoutingDebugHeader = "X-Akubra-Debug-Routing"
+	// ShardHeader names shard which served request, "*" if request was sent
+	// to all shards of region
+	ShardHeader = "X-Akubra-Shard"
+	// ClusterHeader names region which shard served request
+	ClusterHeader = "X-Akubra-Cluster"
+	// BackendsTriedHeader lists backends request was sent to, in order
+	BackendsTriedHeader = "X-Akubra-Backends-Tried"
+	// routingDebugMaxSkew limits age of signed routing debug header
+	routingDebugMaxSkew = 5 * time.Minute
+)
+
+type routingDebugRoundTripper struct {
+	roundTripper http.RoundTripper
+	conf         config.RoutingDebug
+	now          func() time.Time
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (rdrt *routingDebugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rdrt.conf.Enabled && !rdrt.signed(req.Header.Get(RoutingDebugHeader)) {
+		return rdrt.roundTripper.RoundTrip(req)
+	}
+	routing := &types.Routing{}
+	resp, err := rdrt.roundTripper.RoundTrip(req.WithContext(types.WithRouting(req.Context(), routing)))
+	if resp == nil {
+		return resp, err
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	region, shard := routing.Shard()
+	resp.Header.Set(ShardHeader, shard)
+	resp.Header.Set(ClusterHeader, region)
+	resp.Header.Set(BackendsTriedHeader, strings.Join(routing.Backends(), ","))
+	return resp, err
+}
+
+// signed reports if routing debug header is signed with Secret recently
+func (rdrt *routingDebugRoundTripper) signed(value string) bool {
+	if rdrt.conf.Secret == "" || value == "" {
+		return false
+	}
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := rdrt.now().Sub(time.Unix(timestamp, 0))
+	if skew > routingDebugMaxSkew || skew < -routingDebugMaxSkew {
+		return false
+	}
+	signature, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	valid := hmac.Equal(signature, RoutingDebugSignature(rdrt.conf.Secret, parts[0]))
+	if !valid {
+		metrics.Mark("routingdebug.invalid")
+	}
+	return valid
+}
+
+// RoutingDebugSignature signs timestamp of routing debug header with secret
+func RoutingDebugSignature(secret, timestamp string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(timestamp))
+	return mac.Sum(nil)
+}
+
+// RoutingDebug creates Decorator attaching shard, region and backends tried
+// to responses of all requests if enabled, or of requests with routing debug
+// header signed with secret
+func RoutingDebug(conf config.RoutingDebug) Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if !conf.Enabled && conf.Secret == "" {
+			return rt
+		}
+		return &routingDebugRoundTripper{roundTripper: rt, conf: conf, now: time.Now}
+	}
+}
@@ -0,0 +1,71 @@
+package httphandler
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/httphandler/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var routingDebugNow = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func routingRoundTripper(conf config.RoutingDebug) http.RoundTripper {
+	rt := RoutingDebug(conf)(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		routing := types.RoutingOf(req.Context())
+		routing.AddBackend("dc1-a")
+		routing.AddBackend("dc1-b")
+		routing.SetShard("eu", "shard1")
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}))
+	if rdrt, ok := rt.(*routingDebugRoundTripper); ok {
+		rdrt.now = func() time.Time { return routingDebugNow }
+	}
+	return rt
+}
+
+func signedRoutingDebugHeader(secret string, at time.Time) string {
+	timestamp := fmt.Sprintf("%d", at.Unix())
+	return timestamp + ":" + hex.EncodeToString(RoutingDebugSignature(secret, timestamp))
+}
+
+func TestRoutingDebugShouldAttachRoutingHeadersIfEnabled(t *testing.T) {
+	rt := routingRoundTripper(config.RoutingDebug{Enabled: true})
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, "shard1", resp.Header.Get(ShardHeader))
+	assert.Equal(t, "eu", resp.Header.Get(ClusterHeader))
+	assert.Equal(t, "dc1-a,dc1-b", resp.Header.Get(BackendsTriedHeader))
+}
+
+func TestRoutingDebugShouldAttachRoutingHeadersOfSignedRequestsOnly(t *testing.T) {
+	rt := routingRoundTripper(config.RoutingDebug{Secret: "secret"})
+	testCases := []struct {
+		header   string
+		attached bool
+	}{
+		{"", false},
+		{signedRoutingDebugHeader("secret", routingDebugNow), true},
+		{signedRoutingDebugHeader("secret", routingDebugNow.Add(-time.Minute)), true},
+		{signedRoutingDebugHeader("other", routingDebugNow), false},
+		{signedRoutingDebugHeader("secret", routingDebugNow.Add(-time.Hour)), false},
+		{"1514862245:zz", false},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+		req.Header.Set(RoutingDebugHeader, tc.header)
+
+		resp, err := rt.RoundTrip(req)
+
+		require.NoError(t, err)
+		assert.Equal(t, tc.attached, resp.Header.Get(ShardHeader) != "", tc.header)
+	}
+}
@@ -0,0 +1,125 @@
+package httphandler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+type roundTripResult struct {
+	resp *http.Response
+	err  error
+}
+
+type slowRequestsRoundTripper struct {
+	roundTripper http.RoundTripper
+	threshold    time.Duration
+	timeout      time.Duration
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (srt *slowRequestsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	timings := &types.Timings{}
+	ctx := types.WithTimings(req.Context(), timings)
+	start := time.Now()
+	if srt.timeout <= 0 {
+		resp, err := srt.roundTripper.RoundTrip(req.WithContext(ctx))
+		srt.logSlow(req, time.Since(start), timings)
+		return resp, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan roundTripResult, 1)
+	go func() {
+		resp, err := srt.roundTripper.RoundTrip(req.WithContext(ctx))
+		results <- roundTripResult{resp: resp, err: err}
+	}()
+	timer := time.NewTimer(srt.timeout)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		srt.logSlow(req, time.Since(start), timings)
+		if result.resp == nil || result.resp.Body == nil || result.resp.Body == http.NoBody {
+			cancel()
+			return result.resp, result.err
+		}
+		// Body may be streamed from backend, so request is canceled once
+		// it's sent
+		result.resp.Body = &cancelingBody{ReadCloser: result.resp.Body, cancel: cancel}
+		return result.resp, result.err
+	case <-timer.C:
+		cancel()
+		srt.logStuck(req, time.Since(start), timings)
+		go discardResult(req, results)
+		return types.NewS3ErrorResponseForStatus(req, http.StatusGatewayTimeout), nil
+	}
+}
+
+func (srt *slowRequestsRoundTripper) logSlow(req *http.Request, elapsed time.Duration, timings *types.Timings) {
+	if srt.threshold <= 0 || elapsed < srt.threshold {
+		return
+	}
+	metrics.Mark("reqs.slow")
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	logger.WithField("request_id", reqID).Warnf("Slow request %s %s took %s, backends: %s", req.Method, req.URL.Path, elapsed, timings)
+}
+
+// logStuck reports backends which didn't respond, requests which were already
+// replicated may still finish in background
+func (srt *slowRequestsRoundTripper) logStuck(req *http.Request, elapsed time.Duration, timings *types.Timings) {
+	metrics.Mark("reqs.stuck")
+	stuck := make([]string, 0)
+	for _, timing := range timings.Backends() {
+		if timing.InFlight {
+			stuck = append(stuck, timing.Backend)
+			metrics.Mark("reqs.stuck.backend." + metrics.Clean(timing.Backend))
+		}
+	}
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	logger.WithField("request_id", reqID).Warnf("Request %s %s canceled after %s, stuck backends: [%s], backends: %s", req.Method,
+		req.URL.Path, elapsed, strings.Join(stuck, ", "), timings)
+}
+
+// discardResult closes body of response which came after request was
+// canceled
+func discardResult(req *http.Request, results <-chan roundTripResult) {
+	result := <-results
+	if result.resp == nil || result.resp.Body == nil {
+		return
+	}
+	if err := result.resp.Body.Close(); err != nil {
+		reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+		logger.WithField("request_id", reqID).Debugf("Cannot close response body of canceled request: %s", err)
+	}
+}
+
+// cancelingBody cancels request context when body is closed
+type cancelingBody struct {
+	io.ReadCloser
+	once   sync.Once
+	cancel context.CancelFunc
+}
+
+func (cb *cancelingBody) Close() error {
+	err := cb.ReadCloser.Close()
+	cb.once.Do(cb.cancel)
+	return err
+}
+
+// SlowRequests creates Decorator which logs requests slower than threshold
+// with timings of each backend request and answers requests without
+// response in timeout with 504 Gateway Timeout
+func SlowRequests(threshold, timeout time.Duration) Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if threshold <= 0 && timeout <= 0 {
+			return rt
+		}
+		return &slowRequestsRoundTripper{roundTripper: rt, threshold: threshold, timeout: timeout}
+	}
+}
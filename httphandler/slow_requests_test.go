@@ -0,0 +1,80 @@
+package httphandler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStuckRequestShouldBeCanceledWithGatewayTimeout(t *testing.T) {
+	canceled := make(chan struct{})
+	stuck := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		types.TimingsOf(req.Context()).Start("dc1-storage")(http.StatusOK, nil)
+		done := types.TimingsOf(req.Context()).Start("dc2-storage")
+		<-req.Context().Done()
+		done(0, req.Context().Err())
+		close(canceled)
+		return nil, req.Context().Err()
+	})
+	rt := SlowRequests(0, 10*time.Millisecond)(stuck)
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("backend request should be canceled")
+	}
+}
+
+func TestRequestContextShouldBeCanceledAfterResponseBodyIsSent(t *testing.T) {
+	var request *http.Request
+	rt := SlowRequests(0, time.Minute)(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		request = req
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("content"))}, nil
+	}))
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NoError(t, request.Context().Err(), "body is still streamed")
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, "content", string(body))
+	assert.Error(t, request.Context().Err())
+}
+
+func TestTimingsShouldDescribeBackendRequests(t *testing.T) {
+	timings := &types.Timings{}
+	timings.Start("dc1-storage")(http.StatusOK, nil)
+	timings.Start("dc2-storage")(0, errors.New("connection refused"))
+	timings.Start("dc3-storage")
+
+	backends := timings.Backends()
+
+	require.Len(t, backends, 3)
+	assert.False(t, backends[0].InFlight)
+	assert.Equal(t, http.StatusOK, backends[0].Status)
+	assert.True(t, strings.HasPrefix(backends[1].String(), "dc2-storage failed in "))
+	assert.True(t, backends[2].InFlight)
+	assert.True(t, strings.HasPrefix(backends[2].String(), "dc3-storage in flight for "))
+}
+
+func TestSlowRequestsShouldNotWrapIfDisabled(t *testing.T) {
+	rt := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+
+	_, wrapped := SlowRequests(0, 0)(rt).(*slowRequestsRoundTripper)
+
+	assert.False(t, wrapped)
+}
@@ -0,0 +1,78 @@
+package httphandler
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// copyBuffers are reused by response body copies
+var copyBuffers = sync.Pool{New: func() interface{} { return make([]byte, 32*1024) }}
+
+// flushingWriter flushes data written to client at most flushInterval after
+// it was written, negative interval flushes after each write
+type flushingWriter struct {
+	mx            sync.Mutex
+	writer        io.Writer
+	flusher       http.Flusher
+	flushInterval time.Duration
+	flushPending  bool
+	timer         *time.Timer
+}
+
+func (fw *flushingWriter) Write(p []byte) (int, error) {
+	fw.mx.Lock()
+	defer fw.mx.Unlock()
+	n, err := fw.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if fw.flushInterval < 0 {
+		fw.flusher.Flush()
+		return n, nil
+	}
+	if fw.flushPending {
+		return n, nil
+	}
+	if fw.timer == nil {
+		fw.timer = time.AfterFunc(fw.flushInterval, fw.delayedFlush)
+	} else {
+		fw.timer.Reset(fw.flushInterval)
+	}
+	fw.flushPending = true
+	return n, nil
+}
+
+func (fw *flushingWriter) delayedFlush() {
+	fw.mx.Lock()
+	defer fw.mx.Unlock()
+	if !fw.flushPending {
+		return
+	}
+	fw.flusher.Flush()
+	fw.flushPending = false
+}
+
+func (fw *flushingWriter) stop() {
+	fw.mx.Lock()
+	defer fw.mx.Unlock()
+	fw.flushPending = false
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+}
+
+// copyResponseBody streams body to client without buffering whole response,
+// data is flushed according to flushInterval if writer supports it
+func copyResponseBody(w http.ResponseWriter, body io.Reader, flushInterval time.Duration) (int64, error) {
+	buf := copyBuffers.Get().([]byte)
+	defer copyBuffers.Put(buf)
+	flusher, ok := w.(http.Flusher)
+	if flushInterval == 0 || !ok {
+		return io.CopyBuffer(w, body, buf)
+	}
+	fw := &flushingWriter{writer: w, flusher: flusher, flushInterval: flushInterval}
+	defer fw.stop()
+	return io.CopyBuffer(fw, body, buf)
+}
@@ -0,0 +1,52 @@
+package httphandler
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyResponseBodyShouldFlushAfterEachWriteForNegativeInterval(t *testing.T) {
+	writer := httptest.NewRecorder()
+
+	written, err := copyResponseBody(writer, strings.NewReader("content"), -1)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("content")), written)
+	assert.Equal(t, "content", writer.Body.String())
+	assert.True(t, writer.Flushed)
+}
+
+func TestCopyResponseBodyShouldNotFlushWithoutInterval(t *testing.T) {
+	writer := httptest.NewRecorder()
+
+	_, err := copyResponseBody(writer, strings.NewReader("content"), 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, "content", writer.Body.String())
+	assert.False(t, writer.Flushed)
+}
+
+func TestCopyResponseBodyShouldFlushStalledStreamAfterInterval(t *testing.T) {
+	writer := httptest.NewRecorder()
+	reader, pipeWriter := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := copyResponseBody(writer, reader, 10*time.Millisecond)
+		done <- err
+	}()
+
+	_, err := pipeWriter.Write([]byte("first"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, pipeWriter.Close())
+
+	require.NoError(t, <-done)
+	assert.True(t, writer.Flushed)
+	assert.Equal(t, "first", writer.Body.String())
+}
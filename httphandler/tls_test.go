@@ -0,0 +1,114 @@
+package httphandler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/httphandler/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSelfSignedCertificate(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func loadedCommonName(t *testing.T, reloader *CertificateReloader) string {
+	certificate, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestShouldCreateTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeSelfSignedCertificate(t, dir, "akubra")
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	tlsConfig, err := NewTLSConfig(config.TLS{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		ClientCAFile: certFile,
+	}, reloader)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+}
+
+func TestShouldAcceptTLS13MinVersion(t *testing.T) {
+	tlsConfig, err := NewTLSConfig(config.TLS{MinVersion: "1.3"}, &CertificateReloader{})
+
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+}
+
+func TestShouldRejectUnsupportedTLSOptions(t *testing.T) {
+	reloader := &CertificateReloader{}
+
+	_, err := NewTLSConfig(config.TLS{MinVersion: "0.9"}, reloader)
+	assert.Error(t, err)
+
+	_, err = NewTLSConfig(config.TLS{CipherSuites: []string{"TLS_NULL"}}, reloader)
+	assert.Error(t, err)
+
+	_, err = NewTLSConfig(config.TLS{ClientCAFile: "/nonexistent/ca.pem"}, reloader)
+	assert.Error(t, err)
+}
+
+func TestCertificateReloaderShouldKeepPreviousCertificateOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeSelfSignedCertificate(t, dir, "first")
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", loadedCommonName(t, reloader))
+
+	writeSelfSignedCertificate(t, dir, "second")
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "second", loadedCommonName(t, reloader))
+
+	require.NoError(t, os.Remove(keyFile))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "second", loadedCommonName(t, reloader))
+}
@@ -0,0 +1,12 @@
+// Package integration holds end-to-end tests of Akubra served by Minio
+// backends started with docker-compose. Tests are built with integration tag:
+//
+//	make integration
+//
+// or with backends started by hand:
+//
+//	docker-compose -f integration/docker-compose.yml up -d
+//	go test -tags integration ./integration/
+//
+// Akubra binary is built from repository unless AKUBRA_BIN points to one.
+package integration
@@ -0,0 +1,123 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectsShouldBeReplicatedToAllStoragesOfShard(t *testing.T) {
+	key := uniquePrefix(t) + "object"
+
+	status, body := mustRequest(t, http.MethodPut, akubraEndpoint, "/"+bucket+"/"+key, []byte("data"))
+	require.Equal(t, http.StatusOK, status, string(body))
+
+	for _, backend := range []string{"minio1", "minio2"} {
+		assert.True(t, eventually(func() bool {
+			data, found := objectOn(t, backend, key)
+			return found && string(data) == "data"
+		}), "object should be replicated to %s", backend)
+	}
+	for _, backend := range []string{"minio3", "minio4"} {
+		_, found := objectOn(t, backend, key)
+		assert.False(t, found, "shard2 has no weight, object shouldn't be written to %s", backend)
+	}
+
+	status, body = mustRequest(t, http.MethodDelete, akubraEndpoint, "/"+bucket+"/"+key, nil)
+	require.Equal(t, http.StatusNoContent, status, string(body))
+	for _, backend := range []string{"minio1", "minio2"} {
+		_, found := objectOn(t, backend, key)
+		assert.False(t, found, "object should be deleted from %s", backend)
+	}
+}
+
+func TestListingShouldMergeObjectsOfAllStorages(t *testing.T) {
+	prefix := uniquePrefix(t)
+	written := map[string]string{"minio1": prefix + "a", "minio2": prefix + "b", "minio3": prefix + "c"}
+	for backend, key := range written {
+		status, body := mustRequest(t, http.MethodPut, backends[backend], "/"+bucket+"/"+key, []byte(key))
+		require.Equal(t, http.StatusOK, status, string(body))
+	}
+	// duplicates are listed once
+	status, body := mustRequest(t, http.MethodPut, backends["minio4"], "/"+bucket+"/"+prefix+"a", []byte("a"))
+	require.Equal(t, http.StatusOK, status, string(body))
+
+	assert.Equal(t, []string{prefix + "a", prefix + "b", prefix + "c"}, listKeys(t, prefix))
+}
+
+func TestRequestsShouldBeServedWhenStorageIsDown(t *testing.T) {
+	compose(t, "stop", "minio2")
+	defer func() {
+		compose(t, "start", "minio2")
+		require.NoError(t, waitUntilLive(backends["minio2"]+"/minio/health/live"))
+	}()
+	key := uniquePrefix(t) + "object"
+
+	status, body := mustRequest(t, http.MethodPut, akubraEndpoint, "/"+bucket+"/"+key, []byte("data"))
+	require.Equal(t, http.StatusOK, status, string(body))
+	status, body = mustRequest(t, http.MethodGet, akubraEndpoint, "/"+bucket+"/"+key, nil)
+	require.Equal(t, http.StatusOK, status, string(body))
+	assert.Equal(t, "data", string(body))
+	data, found := objectOn(t, "minio1", key)
+	assert.True(t, found)
+	assert.Equal(t, "data", string(data))
+
+	assert.True(t, eventually(func() bool {
+		syncLog, err := ioutil.ReadFile(syncLogPath)
+		return err == nil && strings.Contains(string(syncLog), key) && strings.Contains(string(syncLog), "127.0.0.1:9002")
+	}), "missing replica of minio2 should be written to synclog")
+}
+
+func TestKeysShouldBeReadableAfterResharding(t *testing.T) {
+	prefix := uniquePrefix(t)
+	keys := make([]string, 0, 20)
+	for i := 0; i < cap(keys); i++ {
+		keys = append(keys, fmt.Sprintf("%sbefore-%d", prefix, i))
+		status, body := mustRequest(t, http.MethodPut, akubraEndpoint, "/"+bucket+"/"+keys[i], []byte(keys[i]))
+		require.Equal(t, http.StatusOK, status, string(body))
+	}
+
+	setShard2Weight(t, 1)
+	defer setShard2Weight(t, 0)
+
+	for _, key := range keys {
+		status, body := mustRequest(t, http.MethodGet, akubraEndpoint, "/"+bucket+"/"+key, nil)
+		assert.Equal(t, http.StatusOK, status, "%s should be read from its previous shard", key)
+		assert.Equal(t, key, string(body))
+	}
+	written := make([]string, 0, 20)
+	for i := 0; i < cap(written); i++ {
+		written = append(written, fmt.Sprintf("%safter-%d", prefix, i))
+		status, body := mustRequest(t, http.MethodPut, akubraEndpoint, "/"+bucket+"/"+written[i], []byte(written[i]))
+		require.Equal(t, http.StatusOK, status, string(body))
+	}
+	assert.True(t, eventually(func() bool {
+		for _, key := range written {
+			if _, found := objectOn(t, "minio3", key); found {
+				return true
+			}
+		}
+		return false
+	}), "keys should be written to shard2 after its weight is raised")
+}
+
+// setShard2Weight changes weight of shard2 on technical endpoint
+func setShard2Weight(t *testing.T, weight float64) {
+	weights := fmt.Sprintf(`{"integration":{"shard2":%g}}`, weight)
+	req, err := http.NewRequest(http.MethodPut, technicalEndpoint+"/regions/weights", strings.NewReader(weights))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+}
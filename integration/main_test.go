@@ -0,0 +1,131 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const (
+	akubraEndpoint    = "http://127.0.0.1:18080"
+	technicalEndpoint = "http://127.0.0.1:18071"
+	bucket            = "integration"
+	// startTimeout limits wait for Minio and Akubra to serve requests
+	startTimeout = time.Minute
+)
+
+var (
+	// backends maps storages of akubra.yaml to Minio endpoints and
+	// docker-compose services
+	backends = map[string]string{
+		"minio1": "http://127.0.0.1:9001",
+		"minio2": "http://127.0.0.1:9002",
+		"minio3": "http://127.0.0.1:9003",
+		"minio4": "http://127.0.0.1:9004",
+	}
+	// syncLogPath is Synclog file of started Akubra
+	syncLogPath string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := ioutil.TempDir("", "akubra-integration")
+	if err != nil {
+		return failed(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = waitUntilLive(backends[name] + "/minio/health/live"); err != nil {
+			return failed(fmt.Errorf("backend %s is not ready, are docker-compose services up? %s", name, err))
+		}
+		status, _, err := s3Request(http.MethodPut, backends[name], "/"+bucket, nil)
+		if err != nil {
+			return failed(err)
+		}
+		if status != http.StatusOK && status != http.StatusConflict {
+			return failed(fmt.Errorf("cannot create bucket on %s, status %d", name, status))
+		}
+	}
+
+	binary, err := akubraBinary(dir)
+	if err != nil {
+		return failed(err)
+	}
+	syncLogPath = filepath.Join(dir, "sync.log")
+	akubra := exec.Command(binary, "-c", "akubra.yaml", "--set", "Logging.Synclog.file="+syncLogPath)
+	akubra.Stdout, akubra.Stderr = os.Stdout, os.Stderr
+	if err = akubra.Start(); err != nil {
+		return failed(err)
+	}
+	defer func() {
+		_ = akubra.Process.Kill()
+		_ = akubra.Wait()
+	}()
+	if err = waitUntilLive(akubraEndpoint + "/status/ping"); err != nil {
+		return failed(fmt.Errorf("akubra is not ready: %s", err))
+	}
+	return m.Run()
+}
+
+// akubraBinary returns AKUBRA_BIN or binary built from repository
+func akubraBinary(dir string) (string, error) {
+	if binary := os.Getenv("AKUBRA_BIN"); binary != "" {
+		return binary, nil
+	}
+	binary := filepath.Join(dir, "akubra")
+	build := exec.Command("go", "build", "-o", binary, "..")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err := build.Run(); err != nil {
+		return "", fmt.Errorf("cannot build akubra: %s", err)
+	}
+	return binary, nil
+}
+
+// waitUntilLive polls url until it responds with 200
+func waitUntilLive(url string) error {
+	client := &http.Client{Timeout: time.Second}
+	for deadline := time.Now().Add(startTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		resp, err := client.Get(url)
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil
+		}
+	}
+	return errors.New("timed out")
+}
+
+// compose runs docker-compose command on backends of tests
+func compose(t *testing.T, args ...string) {
+	cmd := exec.Command("docker-compose", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker-compose %v failed: %s\n%s", args, err, output)
+	}
+}
+
+func failed(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
@@ -0,0 +1,84 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/stretchr/testify/require"
+)
+
+// Minio credentials, Akubra re-signs requests with them as S3FixedKey
+// storages, so clients may sign with them as well
+const (
+	accessKey = "akubra"
+	secret    = "akubrasecret"
+	region    = "us-east-1"
+)
+
+// s3Request sends signed request to endpoint
+func s3Request(method, endpoint, path string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(method, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	req = s3signer.SignV4(*req, accessKey, secret, "", region)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, respBody, err
+}
+
+func mustRequest(t *testing.T, method, endpoint, path string, body []byte) (int, []byte) {
+	status, respBody, err := s3Request(method, endpoint, path, body)
+	require.NoError(t, err, "%s %s%s", method, endpoint, path)
+	return status, respBody
+}
+
+// objectOn returns data of object stored on backend
+func objectOn(t *testing.T, backend, key string) ([]byte, bool) {
+	status, body := mustRequest(t, http.MethodGet, backends[backend], "/"+bucket+"/"+key, nil)
+	return body, status == http.StatusOK
+}
+
+// listKeys lists keys of prefix through Akubra
+func listKeys(t *testing.T, prefix string) []string {
+	status, body := mustRequest(t, http.MethodGet, akubraEndpoint, "/"+bucket+"?prefix="+prefix, nil)
+	require.Equal(t, http.StatusOK, status, string(body))
+	result := s3datatypes.ListBucketResult{}
+	require.NoError(t, xml.Unmarshal(body, &result))
+	keys := make([]string, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+// uniquePrefix keeps keys of test runs apart, backends aren't cleaned
+func uniquePrefix(t *testing.T) string {
+	return fmt.Sprintf("%s/%d/", t.Name(), time.Now().UnixNano())
+}
+
+// eventually polls condition, replicas may be written after response of the
+// first one is returned
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
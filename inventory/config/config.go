@@ -0,0 +1,22 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// CSV is the only supported report format
+const CSV = "csv"
+
+// Inventory configuration, reports are not generated if Shard is not defined
+type Inventory struct {
+	// Shard which storages are listed
+	Shard string `yaml:"Shard"`
+	// Buckets listed in reports
+	Buckets []string `yaml:"Buckets"`
+	// Interval between reports
+	Interval metrics.Interval `yaml:"Interval"`
+	// Format of reports, default: csv
+	Format string `yaml:"Format"`
+	// Path is local directory reports are written to
+	Path string `yaml:"Path"`
+	// Bucket of Shard reports are uploaded to
+	Bucket string `yaml:"Bucket"`
+}
@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/inventory/config"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/migrate"
+	"github.com/allegro/akubra/storages"
+)
+
+// entry describes object in report
+type entry struct {
+	size    int64
+	etag    string
+	present []bool
+}
+
+// Generator writes reports listing objects of buckets with their presence on
+// each storage of shard
+type Generator struct {
+	shard storages.NamedShardClient
+	conf  config.Inventory
+	now   func() time.Time
+}
+
+// New creates Generator
+func New(shard storages.NamedShardClient, conf config.Inventory) *Generator {
+	return &Generator{shard: shard, conf: conf, now: time.Now}
+}
+
+// Start generates reports every Interval
+func (g *Generator) Start() {
+	go func() {
+		for range time.Tick(g.conf.Interval.Duration) {
+			if err := g.Generate(); err != nil {
+				log.Printf("Inventory failed: %s", err)
+			}
+		}
+	}()
+}
+
+// Generate writes report of each bucket, failure of one bucket doesn't stop
+// reports of others
+func (g *Generator) Generate() error {
+	failed := make([]string, 0)
+	for _, bucket := range g.conf.Buckets {
+		since := time.Now()
+		err := g.generate(bucket)
+		if err != nil {
+			log.Printf("Inventory of bucket %s failed: %s", bucket, err)
+			metrics.UpdateSince("inventory.err", since)
+			failed = append(failed, bucket)
+			continue
+		}
+		metrics.UpdateSince("inventory.success", since)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("inventory of buckets %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (g *Generator) generate(bucket string) error {
+	report, err := g.report(bucket)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.%s", bucket, g.now().UTC().Format("20060102T150405Z"), config.CSV)
+	if g.conf.Path != "" {
+		if err := ioutil.WriteFile(filepath.Join(g.conf.Path, name), report, 0644); err != nil {
+			return err
+		}
+	}
+	if g.conf.Bucket != "" {
+		return g.upload(name, report)
+	}
+	return nil
+}
+
+// report lists bucket on each storage separately, so missing replicas are
+// visible
+func (g *Generator) report(bucket string) ([]byte, error) {
+	backends := g.shard.Backends()
+	entries := make(map[string]*entry)
+	for i, backend := range backends {
+		objects, err := migrate.ListObjects(backend, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list storage %s: %s", backend.Name, err)
+		}
+		for _, object := range objects {
+			objectEntry, ok := entries[object.Key]
+			if !ok {
+				objectEntry = &entry{size: object.Size, etag: strings.Trim(object.ETag, `"`), present: make([]bool, len(backends))}
+				entries[object.Key] = objectEntry
+			}
+			objectEntry.present[i] = true
+		}
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	header := []string{"key", "size", "etag"}
+	for _, backend := range backends {
+		header = append(header, backend.Name)
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		objectEntry := entries[key]
+		record := []string{key, strconv.FormatInt(objectEntry.size, 10), objectEntry.etag}
+		for _, present := range objectEntry.present {
+			record = append(record, strconv.FormatBool(present))
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func (g *Generator) upload(name string, report []byte) error {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost/%s/inventory/%s", g.conf.Bucket, name), bytes.NewReader(report))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	req = req.WithContext(context.WithValue(req.Context(), log.ContextreqIDKey, "inventory-"+name))
+	resp, err := g.shard.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	if resp.Body != nil {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Debugf("Cannot close inventory upload response body: %s", closeErr)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload of %s responded with status %d", name, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/inventory/config"
+	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listingStub struct {
+	objects []s3datatypes.ObjectInfo
+}
+
+func (ls *listingStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := xml.Marshal(s3datatypes.ListBucketResult{Name: "bucket", Contents: ls.objects})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func storage(name string, objects ...s3datatypes.ObjectInfo) *storages.StorageClient {
+	return &storages.StorageClient{
+		RoundTripper: &listingStub{objects: objects},
+		Endpoint:     url.URL{Scheme: "http", Host: name + ":8080"},
+		Name:         name,
+	}
+}
+
+type shardStub struct {
+	backends []*storages.StorageClient
+	uploads  map[string][]byte
+}
+
+func (ss *shardStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	ss.uploads[req.URL.Path] = body
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func (ss *shardStub) Name() string {
+	return "shard"
+}
+
+func (ss *shardStub) Backends() []*storages.StorageClient {
+	return ss.backends
+}
+
+func (ss *shardStub) StreamsBody() bool {
+	return false
+}
+
+func newGenerator(conf config.Inventory) (*Generator, *shardStub) {
+	shard := &shardStub{
+		backends: []*storages.StorageClient{
+			storage("dc1", s3datatypes.ObjectInfo{Key: "a", Size: 1, ETag: `"etag-a"`}, s3datatypes.ObjectInfo{Key: "b,c", Size: 2, ETag: `"etag-b"`}),
+			storage("dc2", s3datatypes.ObjectInfo{Key: "a", Size: 1, ETag: `"etag-a"`}),
+		},
+		uploads: make(map[string][]byte),
+	}
+	generator := New(shard, conf)
+	generator.now = func() time.Time { return time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC) }
+	return generator, shard
+}
+
+const expectedReport = `key,size,etag,dc1,dc2
+a,1,etag-a,true,true
+"b,c",2,etag-b,true,false
+`
+
+func TestGeneratorShouldWriteReplicaPresenceToLocalPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	generator, _ := newGenerator(config.Inventory{Buckets: []string{"bucket"}, Path: dir})
+
+	require.NoError(t, generator.Generate())
+
+	report, err := ioutil.ReadFile(filepath.Join(dir, "bucket-20180102T030405Z.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, expectedReport, string(report))
+}
+
+func TestGeneratorShouldUploadReportToBucket(t *testing.T) {
+	generator, shard := newGenerator(config.Inventory{Buckets: []string{"bucket"}, Bucket: "reports"})
+
+	require.NoError(t, generator.Generate())
+
+	assert.Equal(t, expectedReport, string(shard.uploads["/reports/inventory/bucket-20180102T030405Z.csv"]))
+}
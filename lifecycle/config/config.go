@@ -0,0 +1,26 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// Lifecycle configuration, objects don't expire if Shard is not defined
+type Lifecycle struct {
+	// Shard which buckets are scanned, deletes are replicated to all its
+	// storages
+	Shard string `yaml:"Shard"`
+	// Interval between scans
+	Interval metrics.Interval `yaml:"Interval"`
+	// Rules of expiration
+	Rules []Rule `yaml:"Rules"`
+}
+
+// Rule expires objects of Bucket which keys start with Prefix
+type Rule struct {
+	Bucket string `yaml:"Bucket"`
+	// Prefix of keys, all keys match if empty
+	Prefix string `yaml:"Prefix"`
+	// Days since last modification objects expire after
+	Days int `yaml:"Days"`
+	// Tags objects need to have all of to expire, tags are read from shard
+	// for objects old enough only
+	Tags map[string]string `yaml:"Tags"`
+}
@@ -0,0 +1,184 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/lifecycle/config"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/migrate"
+)
+
+// day is unit of expiration rules
+const day = 24 * time.Hour
+
+// Expirer deletes objects matching expiration rules, deletes are replicated
+// to all storages of shard
+type Expirer struct {
+	shard http.RoundTripper
+	conf  config.Lifecycle
+	now   func() time.Time
+}
+
+// New creates Expirer
+func New(shard http.RoundTripper, conf config.Lifecycle) *Expirer {
+	return &Expirer{shard: shard, conf: conf, now: time.Now}
+}
+
+// Start applies rules every Interval
+func (e *Expirer) Start() {
+	go func() {
+		for range time.Tick(e.conf.Interval.Duration) {
+			if err := e.Run(); err != nil {
+				log.Printf("Lifecycle expiration failed: %s", err)
+			}
+		}
+	}()
+}
+
+// Run applies each rule, failure of one rule doesn't stop others
+func (e *Expirer) Run() error {
+	failed := make([]string, 0)
+	for _, rule := range e.conf.Rules {
+		since := time.Now()
+		expired, err := e.apply(rule)
+		metrics.UpdateGauge(fmt.Sprintf("lifecycle.%s.expired", metrics.Clean(rule.Bucket)), int64(expired))
+		if err != nil {
+			log.Printf("Lifecycle rule of %s/%s failed: %s", rule.Bucket, rule.Prefix, err)
+			metrics.UpdateSince("lifecycle.err", since)
+			failed = append(failed, rule.Bucket+"/"+rule.Prefix)
+			continue
+		}
+		metrics.UpdateSince("lifecycle.success", since)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("lifecycle rules of %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// apply deletes objects of rule modified before expiration date, it returns
+// number of deleted objects. Deletes are continued after failure, first
+// error is returned
+func (e *Expirer) apply(rule config.Rule) (int, error) {
+	objects, err := migrate.ListPrefix(e.shard, rule.Bucket, rule.Prefix)
+	if err != nil {
+		return 0, err
+	}
+	expiration := e.now().Add(-time.Duration(rule.Days) * day)
+	expired := 0
+	var firstErr error
+	for _, object := range objects {
+		if !object.LastModified.Before(expiration) {
+			continue
+		}
+		if len(rule.Tags) > 0 {
+			matches, err := e.hasTags(rule.Bucket, object.Key, rule.Tags)
+			if err != nil {
+				metrics.Mark("lifecycle.tagging.err")
+				log.Printf("Lifecycle cannot read tags of %s/%s: %s", rule.Bucket, object.Key, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if !matches {
+				continue
+			}
+		}
+		if err := e.delete(rule.Bucket, object.Key); err != nil {
+			metrics.Mark("lifecycle.delete.err")
+			log.Printf("Lifecycle cannot delete %s/%s: %s", rule.Bucket, object.Key, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		metrics.Mark("lifecycle.delete.success")
+		log.Debugf("Lifecycle deleted %s/%s modified %s", rule.Bucket, object.Key, object.LastModified)
+		expired++
+	}
+	return expired, firstErr
+}
+
+// tagging is S3 object tagging document
+type tagging struct {
+	Tags []struct {
+		Key   string `xml:"Key"`
+		Value string `xml:"Value"`
+	} `xml:"TagSet>Tag"`
+}
+
+// hasTags reports if object has all tags
+func (e *Expirer) hasTags(bucket, key string, tags map[string]string) (bool, error) {
+	req, err := newRequest(http.MethodGet, bucket, key)
+	if err != nil {
+		return false, err
+	}
+	req.URL.RawQuery = "tagging"
+	resp, err := e.shard.RoundTrip(req)
+	if err != nil {
+		return false, err
+	}
+	defer discardBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("tagging responded with status %d", resp.StatusCode)
+	}
+	objectTagging := tagging{}
+	if err = xml.NewDecoder(resp.Body).Decode(&objectTagging); err != nil {
+		return false, err
+	}
+	matched := 0
+	for _, tag := range objectTagging.Tags {
+		if value, ok := tags[tag.Key]; ok && value == tag.Value {
+			matched++
+		}
+	}
+	return matched == len(tags), nil
+}
+
+func (e *Expirer) delete(bucket, key string) error {
+	req, err := newRequest(http.MethodDelete, bucket, key)
+	if err != nil {
+		return err
+	}
+	resp, err := e.shard.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer discardBody(resp)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("delete responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func newRequest(method, bucket, key string) (*http.Request, error) {
+	path := "/" + bucket + "/" + key
+	req, err := http.NewRequest(method, "http://localhost"+(&url.URL{Path: path}).EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.WithValue(req.Context(), log.ContextreqIDKey, fmt.Sprintf("lifecycle-%s", path))
+	return req.WithContext(ctx), nil
+}
+
+func discardBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.Debugf("Cannot discard response body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Cannot close response body: %s", err)
+	}
+}
@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/lifecycle/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)
+
+// shardStub lists objects of buckets honouring prefix and records deletes
+type shardStub struct {
+	buckets map[string][]s3datatypes.ObjectInfo
+	failing map[string]bool
+	tags    map[string]string
+	deleted []string
+}
+
+func (ss *shardStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodDelete {
+		if ss.failing[req.URL.Path] {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Request: req}, nil
+		}
+		ss.deleted = append(ss.deleted, req.URL.Path)
+		return &http.Response{StatusCode: http.StatusNoContent, Request: req}, nil
+	}
+	if _, ok := req.URL.Query()["tagging"]; ok {
+		tagging := "<Tagging><TagSet>" + ss.tags[req.URL.Path] + "</TagSet></Tagging>"
+		return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(strings.NewReader(tagging))}, nil
+	}
+	bucket := strings.TrimPrefix(req.URL.Path, "/")
+	objects, ok := ss.buckets[bucket]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Request: req, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	}
+	prefix := req.URL.Query().Get("prefix")
+	listed := make([]s3datatypes.ObjectInfo, 0)
+	for _, object := range objects {
+		if strings.HasPrefix(object.Key, prefix) {
+			listed = append(listed, object)
+		}
+	}
+	body, err := xml.Marshal(s3datatypes.ListBucketResult{Name: bucket, Contents: listed})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func object(key string, age time.Duration) s3datatypes.ObjectInfo {
+	return s3datatypes.ObjectInfo{Key: key, LastModified: now.Add(-age)}
+}
+
+func newExpirer(shard *shardStub, rules ...config.Rule) *Expirer {
+	expirer := New(shard, config.Lifecycle{Shard: "shard", Rules: rules})
+	expirer.now = func() time.Time { return now }
+	return expirer
+}
+
+func TestShouldDeleteObjectsOlderThanRuleDaysMatchingPrefix(t *testing.T) {
+	shard := &shardStub{buckets: map[string][]s3datatypes.ObjectInfo{
+		"logs": {
+			object("tmp/old", 8*day),
+			object("tmp/new", 6*day),
+			object("keep/old", 30*day),
+			object("tmp/with space", 8*day),
+		},
+	}}
+
+	err := newExpirer(shard, config.Rule{Bucket: "logs", Prefix: "tmp/", Days: 7}).Run()
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/logs/tmp/old", "/logs/tmp/with space"}, shard.deleted)
+}
+
+func TestShouldApplyOtherRulesAfterFailure(t *testing.T) {
+	shard := &shardStub{
+		buckets: map[string][]s3datatypes.ObjectInfo{
+			"first":  {object("a", 2*day), object("b", 2*day)},
+			"second": {object("c", 2*day)},
+		},
+		failing: map[string]bool{"/first/a": true},
+	}
+
+	err := newExpirer(shard,
+		config.Rule{Bucket: "missing", Days: 1},
+		config.Rule{Bucket: "first", Days: 1},
+		config.Rule{Bucket: "second", Days: 1}).Run()
+
+	assert.EqualError(t, err, "lifecycle rules of missing/, first/ failed")
+	assert.Equal(t, []string{"/first/b", "/second/c"}, shard.deleted)
+}
+
+func TestShouldDeleteObjectsHavingAllRuleTags(t *testing.T) {
+	shard := &shardStub{
+		buckets: map[string][]s3datatypes.ObjectInfo{
+			"uploads": {object("a", 2*day), object("b", 2*day), object("c", 2*day)},
+		},
+		tags: map[string]string{
+			"/uploads/a": "<Tag><Key>temporary</Key><Value>true</Value></Tag><Tag><Key>team</Key><Value>img</Value></Tag>",
+			"/uploads/b": "<Tag><Key>temporary</Key><Value>false</Value></Tag>",
+		},
+	}
+
+	err := newExpirer(shard, config.Rule{Bucket: "uploads", Days: 1, Tags: map[string]string{"temporary": "true"}}).Run()
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/uploads/a"}, shard.deleted)
+}
@@ -0,0 +1,143 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/allegro/akubra/log"
+)
+
+// inheritedListenersEnv holds comma separated name=fd pairs of listeners passed by parent process
+const inheritedListenersEnv = "AKUBRA_INHERITED_LISTENERS"
+
+// ErrNotTCPListener is returned if listener can't be passed to child process
+var ErrNotTCPListener = errors.New("only TCP listeners can be passed to new process")
+
+var (
+	mx        sync.Mutex
+	active    = make(map[string]*net.TCPListener)
+	inherited map[string]int
+)
+
+// Listen returns listener with given name inherited from parent process, or
+// creates new one on addr if there is none. With reusePort set SO_REUSEPORT
+// option is enabled, so independently started process may bind the same addr.
+func Listen(name, addr string, reusePort bool) (net.Listener, error) {
+	mx.Lock()
+	defer mx.Unlock()
+	if inherited == nil {
+		inherited = parseInherited(os.Getenv(inheritedListenersEnv))
+	}
+	var l net.Listener
+	var err error
+	if fd, ok := inherited[name]; ok {
+		log.Printf("Inheriting %s listener from parent process (fd %d)", name, fd)
+		l, err = fileListener(os.NewFile(uintptr(fd), name))
+		delete(inherited, name)
+	} else if reusePort {
+		l, err = listenReusePort(addr)
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tcpListener, ok := l.(*net.TCPListener); ok {
+		active[name] = tcpListener
+	}
+	return l, nil
+}
+
+// Inherited reports if any listener was passed by parent process
+func Inherited() bool {
+	return os.Getenv(inheritedListenersEnv) != ""
+}
+
+// ReleaseParent asks parent process to shut down gracefully, it should be
+// called once the new process is ready to serve inherited listeners
+func ReleaseParent() error {
+	if !Inherited() {
+		return nil
+	}
+	return syscall.Kill(os.Getppid(), syscall.SIGTERM)
+}
+
+// Upgrade starts new instance of current binary with the same arguments
+// passing it all listeners created by Listen
+func Upgrade() (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	pairs := make([]string, 0)
+	mx.Lock()
+	for name, l := range active {
+		file, fileErr := l.File()
+		if fileErr != nil {
+			mx.Unlock()
+			closeFiles(files[3:])
+			return nil, fmt.Errorf("cannot pass %s listener: %s", name, fileErr)
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, len(files)))
+		files = append(files, file)
+	}
+	mx.Unlock()
+	defer closeFiles(files[3:])
+
+	env := make([]string, 0)
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, inheritedListenersEnv+"=") {
+			env = append(env, variable)
+		}
+	}
+	env = append(env, fmt.Sprintf("%s=%s", inheritedListenersEnv, strings.Join(pairs, ",")))
+	return os.StartProcess(executable, os.Args, &os.ProcAttr{Env: env, Files: files})
+}
+
+func fileListener(file *os.File) (net.Listener, error) {
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Debugf("Cannot close listener file %s: %s", file.Name(), err)
+		}
+	}()
+	l, err := net.FileListener(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.(*net.TCPListener); !ok {
+		return nil, ErrNotTCPListener
+	}
+	return l, nil
+}
+
+func parseInherited(value string) map[string]int {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fd, err := strconv.Atoi(parts[1])
+		if err != nil {
+			log.Printf("Invalid inherited listener fd %q: %s", pair, err)
+			continue
+		}
+		result[parts[0]] = fd
+	}
+	return result
+}
+
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			log.Debugf("Cannot close listener file %s: %s", file.Name(), err)
+		}
+	}
+}
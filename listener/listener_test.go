@@ -0,0 +1,69 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resetState() {
+	mx.Lock()
+	defer mx.Unlock()
+	active = make(map[string]*net.TCPListener)
+	inherited = nil
+}
+
+func TestParseInheritedShouldSkipMalformedPairs(t *testing.T) {
+	result := parseInherited("main=3,technical=4,broken,invalid=x")
+	assert.Equal(t, map[string]int{"main": 3, "technical": 4}, result)
+}
+
+func TestListenShouldRegisterActiveListener(t *testing.T) {
+	resetState()
+	l, err := Listen("main", "127.0.0.1:0", false)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.Contains(t, active, "main")
+	assert.False(t, Inherited())
+}
+
+func TestListenShouldInheritListenerFromEnvironment(t *testing.T) {
+	resetState()
+	original, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer original.Close()
+	file, err := original.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Setenv(inheritedListenersEnv, "main="+strconv.Itoa(int(file.Fd()))))
+	defer os.Unsetenv(inheritedListenersEnv)
+
+	l, err := Listen("main", "127.0.0.1:1", false)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.True(t, Inherited())
+	assert.Equal(t, original.Addr().String(), l.Addr().String())
+}
+
+func TestListenWithReusePortShouldAllowSharingAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT listeners are supported on linux only")
+	}
+	resetState()
+	first, err := Listen("first", "127.0.0.1:0", true)
+	require.NoError(t, err)
+	defer first.Close()
+
+	second, err := Listen("second", first.Addr().String(), true)
+	require.NoError(t, err)
+	defer second.Close()
+
+	assert.Equal(t, first.Addr().String(), second.Addr().String())
+}
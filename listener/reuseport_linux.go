@@ -0,0 +1,58 @@
+package listener
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func listenReusePort(addr string) (net.Listener, error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	family, sockaddr := socketAddress(tcpAddr)
+	fd, err := unix.Socket(family, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, unix.IPPROTO_TCP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	file := os.NewFile(uintptr(fd), addr)
+	if err = setupReusePortSocket(fd, family, sockaddr); err != nil {
+		closeFiles([]*os.File{file})
+		return nil, err
+	}
+	return fileListener(file)
+}
+
+func setupReusePortSocket(fd, family int, sockaddr unix.Sockaddr) error {
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if family == unix.AF_INET6 {
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 0); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if err := unix.Bind(fd, sockaddr); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		return os.NewSyscallError("listen", err)
+	}
+	return nil
+}
+
+func socketAddress(tcpAddr *net.TCPAddr) (int, unix.Sockaddr) {
+	if ip4 := tcpAddr.IP.To4(); ip4 != nil {
+		sockaddr := &unix.SockaddrInet4{Port: tcpAddr.Port}
+		copy(sockaddr.Addr[:], ip4)
+		return unix.AF_INET, sockaddr
+	}
+	sockaddr := &unix.SockaddrInet6{Port: tcpAddr.Port}
+	copy(sockaddr.Addr[:], tcpAddr.IP.To16())
+	return unix.AF_INET6, sockaddr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package listener
+
+import (
+	"errors"
+	"net"
+)
+
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errors.New("SO_REUSEPORT listeners are supported on linux only")
+}
@@ -1,6 +1,9 @@
 package config
 
-import "github.com/allegro/akubra/log"
+import (
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+)
 
 // LoggingConfig contains Loggers configuration
 type LoggingConfig struct {
@@ -9,4 +12,29 @@ type LoggingConfig struct {
 	Mainlog        log.LoggerConfig `yaml:"Mainlog,omitempty"`
 	ClusterSyncLog log.LoggerConfig `yaml:"ClusterSynclog,omitempty"`
 	SyncLogMethods []string         `yaml:"SyncLogMethods,omitempty"`
+	// TombstonesTTL limits how long reads of objects deleted on part of
+	// backends are suppressed, defaults to 1h
+	TombstonesTTL metrics.Interval `yaml:"TombstonesTTL,omitempty"`
+	// ReadRepair writes objects with ETag or Last-Modified differing among
+	// backends to synclog, so they are synced from the newest copy
+	ReadRepair bool `yaml:"ReadRepair,omitempty"`
+	// AccesslogFilter limits which requests are written to Accesslog
+	AccesslogFilter AccessLogFilter `yaml:"AccesslogFilter,omitempty"`
+	// Levels of subsystems (e.g. sharding, crdstore, httphandler) Mainlog
+	// entries, Mainlog level is used for subsystems not listed
+	Levels map[string]string `yaml:"Levels,omitempty"`
+}
+
+// AccessLogFilter selects logged requests, all are logged by default
+type AccessLogFilter struct {
+	// SampleRate logs one of SampleRate successful (2xx) requests, other
+	// requests are not sampled
+	SampleRate int `yaml:"SampleRate,omitempty"`
+	// Methods of logged requests, all if empty
+	Methods []string `yaml:"Methods,omitempty"`
+	// Statuses of logged responses, codes (e.g. "404") or classes (e.g.
+	// "5xx"), all if empty
+	Statuses []string `yaml:"Statuses,omitempty"`
+	// Buckets replace filter for requests of given buckets
+	Buckets map[string]AccessLogFilter `yaml:"Buckets,omitempty"`
 }
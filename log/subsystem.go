@@ -0,0 +1,215 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields are structured context of log entries
+type Fields map[string]interface{}
+
+// LeveledLogger logs structured entries of subsystem at levels configured
+// for it
+type LeveledLogger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+
+	WithField(key string, value interface{}) LeveledLogger
+	WithFields(fields Fields) LeveledLogger
+}
+
+// subsystemLevels overrides DefaultLogger level for subsystems
+var subsystemLevels = struct {
+	sync.RWMutex
+	levels map[string]logrus.Level
+}{levels: make(map[string]logrus.Level)}
+
+// verbose is DefaultLogger copy logging entries of subsystems which level is
+// lower than DefaultLogger one
+var verbose = struct {
+	sync.Mutex
+	base   *logrus.Logger
+	logger *logrus.Logger
+}{}
+
+// For returns logger of subsystem, entries are written to DefaultLogger with
+// "subsystem" field, at level set for subsystem or at DefaultLogger level
+func For(subsystem string) LeveledLogger {
+	return &subsystemLogger{subsystem: subsystem, fields: Fields{"subsystem": subsystem}}
+}
+
+// SetLevels replaces levels of subsystems, subsystems not listed log at
+// DefaultLogger level
+func SetLevels(levels map[string]string) error {
+	parsed := make(map[string]logrus.Level, len(levels))
+	for subsystem, name := range levels {
+		level, ok := LogLevelMap[name]
+		if !ok {
+			return fmt.Errorf("unknown level %q of subsystem %q", name, subsystem)
+		}
+		parsed[subsystem] = level
+	}
+	subsystemLevels.Lock()
+	subsystemLevels.levels = parsed
+	subsystemLevels.Unlock()
+	return nil
+}
+
+// Levels returns levels set for subsystems
+func Levels() map[string]string {
+	subsystemLevels.RLock()
+	defer subsystemLevels.RUnlock()
+	levels := make(map[string]string, len(subsystemLevels.levels))
+	for subsystem, level := range subsystemLevels.levels {
+		for name, mapped := range LogLevelMap {
+			if mapped == level {
+				levels[subsystem] = name
+			}
+		}
+	}
+	return levels
+}
+
+// ServeLevels shows levels of subsystems on GET and replaces them with JSON
+// body of PUT
+func ServeLevels(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		levels := make(map[string]string)
+		if err := json.NewDecoder(r.Body).Decode(&levels); err != nil {
+			http.Error(w, fmt.Sprintf("Cannot decode levels: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := SetLevels(levels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Printf("Subsystems log levels changed: %v", levels)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(Levels()); err != nil {
+		Printf("Cannot write log levels: %s", err)
+	}
+}
+
+type subsystemLogger struct {
+	subsystem string
+	fields    Fields
+}
+
+// Debugf logs entry at Debug level
+func (sl *subsystemLogger) Debugf(format string, v ...interface{}) {
+	sl.log(logrus.DebugLevel, format, v)
+}
+
+// Infof logs entry at Info level
+func (sl *subsystemLogger) Infof(format string, v ...interface{}) {
+	sl.log(logrus.InfoLevel, format, v)
+}
+
+// Warnf logs entry at Warn level
+func (sl *subsystemLogger) Warnf(format string, v ...interface{}) {
+	sl.log(logrus.WarnLevel, format, v)
+}
+
+// Errorf logs entry at Error level
+func (sl *subsystemLogger) Errorf(format string, v ...interface{}) {
+	sl.log(logrus.ErrorLevel, format, v)
+}
+
+// WithField returns logger adding field to entries
+func (sl *subsystemLogger) WithField(key string, value interface{}) LeveledLogger {
+	return sl.WithFields(Fields{key: value})
+}
+
+// WithFields returns logger adding fields to entries
+func (sl *subsystemLogger) WithFields(fields Fields) LeveledLogger {
+	merged := make(Fields, len(sl.fields)+len(fields))
+	for key, value := range sl.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &subsystemLogger{subsystem: sl.subsystem, fields: merged}
+}
+
+func (sl *subsystemLogger) log(level logrus.Level, format string, v []interface{}) {
+	base, ok := DefaultLogger.(*logrus.Logger)
+	if !ok {
+		sl.logPlain(level, format, v)
+		return
+	}
+	threshold := base.Level
+	subsystemLevels.RLock()
+	if subsystemLevel, ok := subsystemLevels.levels[sl.subsystem]; ok {
+		threshold = subsystemLevel
+	}
+	subsystemLevels.RUnlock()
+	if level > threshold {
+		return
+	}
+	logger := base
+	if level > base.Level {
+		logger = verboseLogger(base)
+	}
+	entry := logger.WithFields(logrus.Fields(sl.fields))
+	switch level {
+	case logrus.DebugLevel:
+		entry.Debugf(format, v...)
+	case logrus.InfoLevel:
+		entry.Infof(format, v...)
+	case logrus.WarnLevel:
+		entry.Warnf(format, v...)
+	default:
+		entry.Errorf(format, v...)
+	}
+}
+
+// logPlain writes entry to DefaultLogger which doesn't support fields, they
+// are appended to message
+func (sl *subsystemLogger) logPlain(level logrus.Level, format string, v []interface{}) {
+	keys := make([]string, 0, len(sl.fields))
+	for key := range sl.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, sl.fields[key]))
+	}
+	message := fmt.Sprintf(format, v...) + " " + strings.Join(pairs, " ")
+	if level == logrus.DebugLevel {
+		DefaultLogger.Debug(message)
+		return
+	}
+	DefaultLogger.Print(message)
+}
+
+// verboseLogger returns copy of base logging at Debug level
+func verboseLogger(base *logrus.Logger) *logrus.Logger {
+	verbose.Lock()
+	defer verbose.Unlock()
+	if verbose.base != base {
+		verbose.base = base
+		verbose.logger = &logrus.Logger{
+			Out:       base.Out,
+			Formatter: base.Formatter,
+			Hooks:     base.Hooks,
+			Level:     logrus.DebugLevel,
+		}
+	}
+	return verbose.logger
+}
@@ -0,0 +1,68 @@
+package log
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withBufferedDefaultLogger replaces DefaultLogger, returned function restores
+// it and resets levels of subsystems
+func withBufferedDefaultLogger(level logrus.Level) (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	previous := DefaultLogger
+	DefaultLogger = &logrus.Logger{
+		Out:       buf,
+		Formatter: &logrus.TextFormatter{DisableTimestamp: true},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     level,
+	}
+	return buf, func() {
+		DefaultLogger = previous
+		_ = SetLevels(nil)
+	}
+}
+
+func TestSubsystemLoggerShouldLogAtLevelSetForSubsystem(t *testing.T) {
+	buf, restore := withBufferedDefaultLogger(logrus.InfoLevel)
+	defer restore()
+	require.NoError(t, SetLevels(map[string]string{"sharding": "Debug", "crdstore": "Error"}))
+
+	For("sharding").WithField("shard", "a").Debugf("Key picked shard %s", "a")
+	For("crdstore").Warnf("Endpoint unavailable")
+	For("httphandler").Debugf("Request id")
+	For("httphandler").Infof("Rejected request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, `level=debug msg="Key picked shard a" shard=a subsystem=sharding`, lines[0])
+	assert.Equal(t, `level=info msg="Rejected request" subsystem=httphandler`, lines[1])
+}
+
+func TestSetLevelsShouldRejectUnknownLevel(t *testing.T) {
+	_, restore := withBufferedDefaultLogger(logrus.InfoLevel)
+	defer restore()
+	require.NoError(t, SetLevels(map[string]string{"sharding": "Debug"}))
+
+	assert.EqualError(t, SetLevels(map[string]string{"sharding": "Verbose"}), `unknown level "Verbose" of subsystem "sharding"`)
+	assert.Equal(t, map[string]string{"sharding": "Debug"}, Levels())
+}
+
+func TestServeLevelsShouldReplaceLevels(t *testing.T) {
+	_, restore := withBufferedDefaultLogger(logrus.InfoLevel)
+	defer restore()
+	require.NoError(t, SetLevels(map[string]string{"sharding": "Debug"}))
+
+	w := httptest.NewRecorder()
+	ServeLevels(w, httptest.NewRequest(http.MethodPut, "/logging/levels", strings.NewReader(`{"crdstore":"Warn"}`)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"crdstore":"Warn"}`, w.Body.String())
+	assert.Equal(t, map[string]string{"crdstore": "Warn"}, Levels())
+}
@@ -2,25 +2,61 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
+	"plugin"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/allegro/akubra/audit"
+	"github.com/allegro/akubra/bench"
+	"github.com/allegro/akubra/bodylimit"
+	"github.com/allegro/akubra/cache"
+	"github.com/allegro/akubra/compression"
+	"github.com/allegro/akubra/concurrency"
+	"github.com/allegro/akubra/cors"
 	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/encryption"
+	"github.com/allegro/akubra/hooks"
+	"github.com/allegro/akubra/hotspots"
 	"github.com/allegro/akubra/httphandler"
+	httphandlerconfig "github.com/allegro/akubra/httphandler/config"
+	"github.com/allegro/akubra/inventory"
+	"github.com/allegro/akubra/lifecycle"
+	"github.com/allegro/akubra/listener"
 	"github.com/allegro/akubra/log"
 	logconfig "github.com/allegro/akubra/log/config"
 	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/migrate"
+	"github.com/allegro/akubra/mirror"
+	"github.com/allegro/akubra/netacl"
+	"github.com/allegro/akubra/notifications"
+	"github.com/allegro/akubra/ratelimit"
+	"github.com/allegro/akubra/readonly"
 	"github.com/allegro/akubra/regions"
+	"github.com/allegro/akubra/sharding"
+	"github.com/allegro/akubra/spool"
+	"github.com/allegro/akubra/status"
 	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/storages/auth"
 	"github.com/allegro/akubra/transport"
+	"github.com/allegro/akubra/usage"
+	"github.com/allegro/akubra/watchdog"
+	"github.com/allegro/akubra/worm"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/allegro/akubra/config"
+	units "github.com/docker/go-units"
 
 	_ "github.com/lib/pq"
 )
@@ -28,27 +64,155 @@ import (
 // TechnicalEndpointGeneralTimeout for /configuration/validate endpoint
 const TechnicalEndpointGeneralTimeout = 5 * time.Second
 
+// TechnicalEndpointDebugTimeout allows CPU profiles and traces of default
+// 30 seconds to be written
+const TechnicalEndpointDebugTimeout = 2 * time.Minute
+
 var (
 	// filled by linker
 	version = "development"
 
 	// CLI flags
 	configFile = kingpin.
-			Flag("config", "Configuration file path e.g.: \"conf/dev.yaml\"").
+			Flag("config", "Configuration file path e.g.: \"conf/dev.yaml\" or remote location e.g.: \"consul://localhost:8500/akubra/config\"").
 			Short('c').
-			Required().
-			ExistingFile()
+			String()
+	configWatchInterval = kingpin.
+				Flag("config-watch-interval", "Reload configuration when it changes, checked at given interval e.g.: \"30s\" (disabled by default).").
+				Duration()
+	configWatchDirs = kingpin.
+			Flag("config-watch-dir", "Reload configuration when files in given directory change, e.g. mounted Kubernetes ConfigMap or Secret, may be repeated.").
+			Strings()
+	listenOverride = kingpin.
+			Flag("listen", "Overrides Service.Server.Listen of configuration e.g.: \":8080\".").
+			Envar("AKUBRA_LISTEN").
+			String()
+	technicalListenOverride = kingpin.
+				Flag("technical-endpoint-listen", "Overrides Service.Server.TechnicalEndpointListen of configuration.").
+				Envar("AKUBRA_TECHNICAL_ENDPOINT_LISTEN").
+				String()
+	setOverrides = kingpin.
+			Flag("set", "Overrides configuration value under dotted key path with YAML value e.g.: \"Shards.cluster1.Storages.0.Weight=2\", may be repeated.").
+			Envar("AKUBRA_SET").
+			Strings()
 	testConfig = kingpin.
 			Flag("test-config", "Testing only configuration file from 'config' arg. (app. not starting).").
 			Short('t').
 			Bool()
+	validateConfig = kingpin.
+			Flag("validate-config", "Validate configuration from 'config' arg. reporting all found problems (app. not starting).").
+			Bool()
+	validateEndpoints = kingpin.
+				Flag("validate-endpoints", "Check if storages and credentials stores endpoints are reachable, used with 'validate-config'.").
+				Bool()
+	migrateFrom = kingpin.
+			Flag("migrate-from", "Copy objects of 'migrate-bucket' buckets from given shard to 'migrate-to' shard (app. not starting).").
+			String()
+	migrateTo = kingpin.
+			Flag("migrate-to", "Shard objects are copied to, used with 'migrate-from'.").
+			String()
+	migrateBuckets = kingpin.
+			Flag("migrate-bucket", "Bucket to migrate, may be repeated, used with 'migrate-from'.").
+			Strings()
+	migrateConcurrency = kingpin.
+				Flag("migrate-concurrency", "Number of objects copied at once, used with 'migrate-from'.").
+				Default("4").
+				Int()
+	migrateCheckpoint = kingpin.
+				Flag("migrate-checkpoint", "File listing copied objects, they're skipped when migration is run again, used with 'migrate-from'.").
+				String()
+	verifyAuditLog = kingpin.
+			Flag("verify-audit-log", "Check chain of records of given audit log file (app. not starting).").
+			String()
+
+	// CLI commands, proxy is served if no command is given
+	serveCommand = kingpin.Command("serve", "Serve proxy with configuration from 'config' flag (default).").Default()
+	benchCommand = kingpin.Command("bench", "Send PUT and GET requests to proxy and report latency percentiles.")
+
+	benchEndpoint = benchCommand.
+			Flag("endpoint", "Proxy address.").
+			Default("http://localhost:8080").
+			String()
+	benchBucket = benchCommand.
+			Flag("bucket", "Bucket objects are put to and got from.").
+			Required().
+			String()
+	benchPrefix = benchCommand.
+			Flag("prefix", "Prefix of object keys.").
+			Default("akubra-bench/").
+			String()
+	benchAccessKey = benchCommand.
+			Flag("access-key", "Access key signing requests, requests are anonymous if empty.").
+			Envar("AKUBRA_BENCH_ACCESS_KEY").
+			String()
+	benchSecret = benchCommand.
+			Flag("secret", "Secret key signing requests.").
+			Envar("AKUBRA_BENCH_SECRET").
+			String()
+	benchRegion = benchCommand.
+			Flag("region", "Region of V4 signature.").
+			Default("us-east-1").
+			String()
+	benchConcurrency = benchCommand.
+				Flag("concurrency", "Number of requests sent at once.").
+				Default("16").
+				Int()
+	benchDuration = benchCommand.
+			Flag("duration", "Duration of load.").
+			Default("30s").
+			Duration()
+	benchRequests = benchCommand.
+			Flag("requests", "Number of requests, load ends earlier if they're sent (unlimited by default).").
+			Int64()
+	benchKeys = benchCommand.
+			Flag("keys", "Number of distinct object keys.").
+			Default("1000").
+			Int()
+	benchDistribution = benchCommand.
+				Flag("distribution", "Distribution of requested keys.").
+				Default(bench.Uniform).
+				Enum(bench.Uniform, bench.Zipf, bench.Sequential)
+	benchSizes = benchCommand.
+			Flag("size", "Size of put objects e.g.: \"64KiB\", may be repeated, sizes are picked at random.").
+			Default("64KiB").
+			Strings()
+	benchReadRatio = benchCommand.
+			Flag("read-ratio", "Part of GET requests, the rest are PUTs.").
+			Default("0.5").
+			Float64()
+	benchPrefill = benchCommand.
+			Flag("prefill", "Put all keys before load is measured, so GET requests find objects.").
+			Bool()
+	benchTimeout = benchCommand.
+			Flag("timeout", "Timeout of single request.").
+			Default("30s").
+			Duration()
+
+	// overrides of configuration values given with flags and environment,
+	// they're applied on each configuration load
+	overrides []config.Override
 )
 
 func main() {
 
 	versionString := fmt.Sprintf("Akubra (%s version)", version)
 	kingpin.Version(versionString)
-	kingpin.Parse()
+	if kingpin.Parse() == benchCommand.FullCommand() {
+		os.Exit(runBench())
+	}
+	if *configFile == "" {
+		kingpin.Fatalf("required flag --config not provided, try --help")
+	}
+	var err error
+	if overrides, err = configOverrides(); err != nil {
+		log.Fatalf("Invalid configuration override: %s", err)
+	}
+	if *validateConfig {
+		os.Exit(validateConfigFile(*configFile, *validateEndpoints))
+	}
+	if *verifyAuditLog != "" {
+		os.Exit(verifyAuditLogFile(*configFile, *verifyAuditLog))
+	}
 	conf, err := parseConfig(*configFile)
 	if err != nil {
 		log.Fatalf("Configuration corrupted: %s", err)
@@ -58,30 +222,135 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *migrateFrom != "" {
+		os.Exit(migrateShards(conf))
+	}
+
 	mainlog, err := log.NewDefaultLogger(conf.Logging.Mainlog, "LOG_LOCAL2", false)
 	if err != nil {
 		log.Fatalf("Could not set up main logger: %q", err)
 	}
 	log.DefaultLogger = mainlog
+	if err := log.SetLevels(conf.Logging.Levels); err != nil {
+		log.Fatalf("Could not set subsystems log levels: %q", err)
+	}
 
 	log.Printf("Health check endpoint: %s", conf.Service.Server.HealthCheckEndpoint)
 	mainlog.Printf("starting on port %s", conf.Service.Server.Listen)
+	storages.StartWorkers(conf.Service.Client.Workers)
+
+	if err := loadPlugins(conf.Service.Server.PluginFiles); err != nil {
+		mainlog.Fatalf("Could not load plugins, reason: %q", err)
+	}
+
+	jobStorages := sharedStorages(conf)
+	if conf.Inventory.Shard != "" {
+		if err := startInventory(conf, jobStorages); err != nil {
+			mainlog.Fatalf("Could not start inventory, reason: %q", err)
+		}
+	}
+
+	if conf.Lifecycle.Shard != "" {
+		if err := startLifecycle(conf, jobStorages); err != nil {
+			mainlog.Fatalf("Could not start lifecycle expiration, reason: %q", err)
+		}
+	}
+
+	if conf.Watchdog.Interval.Duration > 0 {
+		log.Printf("Watchdog sampling resources every %s", conf.Watchdog.Interval.Duration)
+		watchdog.New(conf.Watchdog, watchdog.Resources{
+			Connections: transport.OpenConnections,
+			SpoolFiles:  spool.OpenFiles,
+		}).Start()
+	}
+
+	usageAccounting, err := usage.New(conf.Usage)
+	if err != nil {
+		mainlog.Fatalf("Could not start usage accounting, reason: %q", err)
+	}
+	if usageAccounting != nil {
+		log.Printf("Usage accounting flushed to %s sink", conf.Usage.Sink)
+		usageAccounting.Start()
+	}
+
+	hotSpots := hotspots.New(conf.HotSpots)
+	if hotSpots != nil {
+		log.Printf("Tracking %d hot buckets and keys", conf.HotSpots.Capacity)
+		hotSpots.Start()
+	}
+
+	auditLog, err := audit.New(conf.Audit)
+	if err != nil {
+		mainlog.Fatalf("Could not open audit log, reason: %q", err)
+	}
+
+	notifier, err := notifications.New(conf.Notifications)
+	if err != nil {
+		mainlog.Fatalf("Could not start event notifications, reason: %q", err)
+	}
+	if notifier != nil {
+		log.Printf("Event notifications published to %d target(s)", len(conf.Notifications.Targets))
+		notifier.Start()
+	}
+
+	drains, err := startDrains(conf, jobStorages)
+	if err != nil {
+		mainlog.Fatalf("Could not start drain, reason: %q", err)
+	}
+
+	probes := status.New(conf.Status)
+	probes.Start()
 
 	srv := newService(conf, *configFile)
+	srv.status = probes
+	srv.usage = usageAccounting
+	srv.hotSpots = hotSpots
+	srv.audit = auditLog
+	srv.notifier = notifier
+	srv.drains = drains
 	srv.startTechnicalEndpoint()
+	srv.watchConfig(*configWatchInterval)
+	srv.watchConfigDirs(*configWatchDirs)
 	startErr := srv.start()
 	if startErr != nil {
 		mainlog.Fatalf("Could not start service, reason: %q", startErr.Error())
 	}
 }
+
+// configOverrides collects overrides of flags, shortcuts go first, so --set
+// may replace them
+func configOverrides() ([]config.Override, error) {
+	result := make([]config.Override, 0, len(*setOverrides)+2)
+	for _, shortcut := range []struct{ path, value string }{
+		{"Service.Server.Listen", *listenOverride},
+		{"Service.Server.TechnicalEndpointListen", *technicalListenOverride},
+	} {
+		if shortcut.value == "" {
+			continue
+		}
+		override, err := config.NewOverride(shortcut.path, shortcut.value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, override)
+	}
+	for _, expression := range *setOverrides {
+		override, err := config.ParseOverride(expression)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, override)
+	}
+	return result, nil
+}
+
 func parseConfig(path string) (config.Config, error) {
-	conf, err := config.Configure(*configFile)
+	conf, err := config.Configure(path, overrides...)
 	if err != nil {
 		return config.Config{}, fmt.Errorf("Improperly configured %s", err)
 	}
 
-	valid, errs := config.ValidateConf(conf.YamlConfig, true)
-	if !valid {
+	if errs := config.Validate(conf.YamlConfig, false); len(errs) > 0 {
 		return config.Config{}, fmt.Errorf("YAML validation - errors: %q", errs)
 	}
 	log.Println("Configuration checked - OK.")
@@ -89,6 +358,246 @@ func parseConfig(path string) (config.Config, error) {
 	return conf, nil
 }
 
+func validateConfigFile(path string, checkEndpoints bool) int {
+	conf, err := config.Configure(path, overrides...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Improperly configured %s\n", err)
+		return 1
+	}
+	errs := config.Validate(conf.YamlConfig, checkEndpoints)
+	for _, validationErr := range errs {
+		fmt.Fprintln(os.Stderr, validationErr)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Configuration invalid, %d problem(s) found\n", len(errs))
+		return 1
+	}
+	fmt.Println("Configuration checked - OK.")
+	return 0
+}
+
+func verifyAuditLogFile(configPath, path string) int {
+	conf, err := config.Configure(configPath, overrides...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Improperly configured %s\n", err)
+		return 1
+	}
+	key, err := audit.LoadKey(conf.Audit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open audit log: %s\n", err)
+		return 1
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	verified, err := audit.Verify(file, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit log invalid, %d record(s) verified before problem found: %s\n", verified, err)
+		return 1
+	}
+	fmt.Printf("Audit log checked - %d record(s) OK.\n", verified)
+	return 0
+}
+
+// standaloneStorages initializes storages used by jobs apart from request
+// handling, they don't write synclog. Their credentials stores are used as
+// long as jobs run, so they're never closed
+func standaloneStorages(conf config.Config) (*storages.Storages, error) {
+	transportMatcher, err := transport.ConfigureHTTPTransports(conf.Service.Client)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't set up client Transports - err: %q", err)
+	}
+	credentialsStores, err := crdstore.NewStores(conf.CredentialsStore)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := storages.InitStorages(transportMatcher, conf.Shards, conf.Storages, credentialsStores, &storages.SyncSender{})
+	if err != nil {
+		credentialsStores.Close()
+		return nil, fmt.Errorf("Storages initialization problem: %q", err)
+	}
+	return storage, nil
+}
+
+// sharedStorages returns function initializing standalone storages on first
+// call, background jobs share them
+func sharedStorages(conf config.Config) func() (*storages.Storages, error) {
+	var storage *storages.Storages
+	return func() (*storages.Storages, error) {
+		if storage != nil {
+			return storage, nil
+		}
+		var err error
+		storage, err = standaloneStorages(conf)
+		return storage, err
+	}
+}
+
+func startInventory(conf config.Config, jobStorages func() (*storages.Storages, error)) error {
+	storage, err := jobStorages()
+	if err != nil {
+		return err
+	}
+	shard, err := storage.GetShard(conf.Inventory.Shard)
+	if err != nil {
+		return err
+	}
+	log.Printf("Inventory of shard %s every %s", conf.Inventory.Shard, conf.Inventory.Interval.Duration)
+	inventory.New(shard, conf.Inventory).Start()
+	return nil
+}
+
+// loadPlugins opens Go plugins, which register decorators in their init
+// functions
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return err
+		}
+		log.Printf("Plugin %s loaded", path)
+	}
+	if len(paths) > 0 {
+		log.Printf("Registered decorators: %v", httphandler.RegisteredDecorators())
+	}
+	return nil
+}
+
+func startLifecycle(conf config.Config, jobStorages func() (*storages.Storages, error)) error {
+	storage, err := jobStorages()
+	if err != nil {
+		return err
+	}
+	shard, err := storage.GetShard(conf.Lifecycle.Shard)
+	if err != nil {
+		return err
+	}
+	log.Printf("Lifecycle expiration of shard %s every %s", conf.Lifecycle.Shard, conf.Lifecycle.Interval.Duration)
+	lifecycle.New(shard, conf.Lifecycle).Start()
+	return nil
+}
+
+// startDrains moves objects of drained shards of regions in background
+func startDrains(conf config.Config, jobStorages func() (*storages.Storages, error)) (migrate.Drains, error) {
+	var drains migrate.Drains
+	for name, regionConfig := range conf.ShardingPolicies {
+		for _, policy := range regionConfig.Shards {
+			if !policy.Drained {
+				continue
+			}
+			storage, err := jobStorages()
+			if err != nil {
+				return nil, err
+			}
+			ring, err := sharding.NewRingFactory(conf.ShardingPolicies, storage, log.DefaultLogger).RegionRing(name, regionConfig)
+			if err != nil {
+				return nil, err
+			}
+			shard, err := storage.GetShard(policy.ShardName)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Draining shard %s of region %s", policy.ShardName, name)
+			drain := migrate.NewDrain(name, shard, ring, regionConfig.DrainConcurrency)
+			drain.Start()
+			drains = append(drains, drain)
+		}
+	}
+	return drains, nil
+}
+
+func migrateShards(conf config.Config) int {
+	storage, err := standaloneStorages(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	source, err := storage.GetShard(*migrateFrom)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	target, err := storage.GetShard(*migrateTo)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	migrator, err := migrate.New(source, target, migrate.Config{
+		Buckets:        *migrateBuckets,
+		Concurrency:    *migrateConcurrency,
+		CheckpointFile: *migrateCheckpoint,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot start migration: %s\n", err)
+		return 1
+	}
+	report, err := migrator.Run()
+	if report != nil {
+		_ = report.Write(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration interrupted: %s\n", err)
+		return 1
+	}
+	if !report.Consistent() {
+		return 1
+	}
+	return 0
+}
+
+func runBench() int {
+	sizes := make([]int64, 0, len(*benchSizes))
+	for _, size := range *benchSizes {
+		value, err := units.RAMInBytes(size)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid size %q: %s\n", size, err)
+			return 1
+		}
+		sizes = append(sizes, value)
+	}
+	b, err := bench.New(bench.Config{
+		Endpoint:     *benchEndpoint,
+		Bucket:       *benchBucket,
+		Prefix:       *benchPrefix,
+		AccessKey:    *benchAccessKey,
+		Secret:       *benchSecret,
+		Region:       *benchRegion,
+		Concurrency:  *benchConcurrency,
+		Duration:     *benchDuration,
+		Requests:     *benchRequests,
+		Keys:         *benchKeys,
+		Distribution: *benchDistribution,
+		Sizes:        sizes,
+		ReadRatio:    *benchReadRatio,
+		Prefill:      *benchPrefill,
+	}, &http.Client{
+		Timeout:   *benchTimeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: *benchConcurrency},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot start benchmark: %s\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		cancel()
+	}()
+	report, err := b.Run(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Benchmark failed: %s\n", err)
+		return 1
+	}
+	_ = report.Write(os.Stdout)
+	return 0
+}
+
 func mkServiceLogs(logConf logconfig.LoggingConfig) (syncLog, clusterSyncLog, accessLog log.Logger, err error) {
 	syncLog, err = log.NewDefaultLogger(logConf.Synclog, "LOG_LOCAL1", true)
 	if err != nil {
@@ -108,140 +617,485 @@ func mkServiceLogs(logConf logconfig.LoggingConfig) (syncLog, clusterSyncLog, ac
 
 func newService(cfg config.Config, configPath string) *service {
 	hh := func(rw http.ResponseWriter, r *http.Request) {}
-	var h = http.HandlerFunc(hh)
-	return &service{config: cfg, configPath: configPath, handler: h}
+	srv := &service{configPath: configPath, shutdownDone: make(chan struct{}), readOnly: readonly.New(cfg.ReadOnly)}
+	srv.handler.Store(handlerHolder{Handler: http.HandlerFunc(hh), config: cfg})
+	return srv
+}
+
+// handlerHolder keeps atomic.Value stored type consistent
+type handlerHolder struct {
+	http.Handler
+	// config handler was created from, it's replaced with handler on reload
+	config config.Config
+	// regions of handler, weights of their shards may be changed on
+	// technical endpoint
+	regions *regions.Regions
+	// statusTargets are backends and credentials stores of handler
+	statusTargets status.Targets
+	// credentialsStores of handler are closed when it's replaced
+	credentialsStores crdstore.Stores
+	// spooler of handler keeps idle files until handler is replaced
+	spooler *spool.Spooler
 }
 
 type service struct {
-	config     config.Config
-	configPath string
-	handler    http.Handler
-	srv        *http.Server
-	ctx        context.Context
+	configPath   string
+	handler      atomic.Value
+	reloadMx     sync.Mutex
+	srv          *http.Server
+	shutdownDone chan struct{}
+	certificates *httphandler.CertificateReloader
+	// usage, hotSpots, audit, notifier and drains outlive handlers, they're
+	// not reconfigured on reload
+	usage    *usage.Accounting
+	hotSpots *hotspots.Tracker
+	audit    *audit.Log
+	notifier *notifications.Notifier
+	drains   migrate.Drains
+	// readOnly mode outlives handlers as well, so state changed on technical
+	// endpoint is kept on reload unless ReadOnly configuration changed
+	readOnly *readonly.Mode
+	// status follows backends and credentials stores of current handler
+	status *status.Status
+}
+
+// currentConfig returns configuration of the current handler
+func (s *service) currentConfig() config.Config {
+	return s.handler.Load().(handlerHolder).config
 }
 
 func (s *service) start() (err error) {
-	s.ctx = context.Background()
-	s.handler, err = s.createHandler(s.config)
+	conf := s.currentConfig()
+	holder, err := s.createHandler(conf)
 	if err != nil {
 		log.Fatalf("Handler creation error: %s", err)
 	}
+	s.handler.Store(holder)
+	s.status.SetTargets(holder.statusTargets)
+
+	err = metrics.Init(conf.Metrics)
+	if err != nil {
+		log.Printf("Metrics initialization error: %s", err)
+	}
 	srv := &http.Server{
-		Addr:         s.config.Service.Server.Listen,
+		Addr:         conf.Service.Server.Listen,
 		Handler:      s,
-		ReadTimeout:  s.config.Service.Server.ReadTimeout.Duration,
-		WriteTimeout: s.config.Service.Server.WriteTimeout.Duration,
+		ReadTimeout:  conf.Service.Server.ReadTimeout.Duration,
+		WriteTimeout: conf.Service.Server.WriteTimeout.Duration,
 	}
 
 	srv.SetKeepAlivesEnabled(true)
 	s.srv = srv
-	listener, err := net.Listen("tcp", s.config.Service.Server.Listen)
+	l, err := listener.Listen("main", conf.Service.Server.Listen, conf.Service.Server.ReusePort)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	acl := conf.NetworkACL
+	l, err = netacl.Listener("service", l, acl.Service, acl.TrustedProxies, acl.ProxyProtocol)
+	if err != nil {
+		log.Fatalf("Network ACL initialization error: %s", err)
+	}
+	if tlsConf := conf.Service.Server.TLS; tlsConf != nil {
+		l, err = s.tlsListener(l, *tlsConf)
+		if err != nil {
+			log.Fatalf("TLS initialization error: %s", err)
+		}
+	}
 	go s.signalsHandler()
-	return srv.Serve(listener)
+	if err = listener.ReleaseParent(); err != nil {
+		log.Printf("Cannot release parent process: %s", err)
+	}
+	if err = srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	<-s.shutdownDone
+	return nil
 }
 
-func (s *service) signalsHandler() {
+func (s *service) tlsListener(l net.Listener, tlsConf httphandlerconfig.TLS) (net.Listener, error) {
+	certificates, err := httphandler.NewCertificateReloader(tlsConf.CertFile, tlsConf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := httphandler.NewTLSConfig(tlsConf, certificates)
+	if err != nil {
+		return nil, err
+	}
+	s.certificates = certificates
+	log.Printf("TLS enabled on %s", s.currentConfig().Service.Server.Listen)
+	return tls.NewListener(l, tlsConfig), nil
+}
 
+func (s *service) signalsHandler() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	intr := make(chan os.Signal, 1)
+	signal.Notify(intr, syscall.SIGINT, syscall.SIGTERM)
 	for {
-		hup := make(chan os.Signal, 1)
-		signal.Notify(hup, syscall.SIGHUP)
-		intr := make(chan os.Signal, 1)
-		signal.Notify(intr, syscall.SIGINT)
 		select {
 		case <-hup:
-			conf, err := parseConfig(s.configPath)
-			if err != nil {
-				log.Printf("New config is corrupted %s", err)
-				continue
-			}
-			handler, err := s.createHandler(conf)
-			if err != nil {
-				log.Printf("Handler initialization failure %s", err)
-			}
-			s.handler = handler
-			log.Println("Handler replaced")
+			go s.reload()
+		case <-usr2:
+			go s.upgrade()
 		case <-intr:
-			log.Println("Shutting down")
-			err := s.srv.Shutdown(s.ctx)
-			if err != nil {
-				log.Printf("Server shutsown error: %s", err)
-			}
-			log.Println("Fin")
+			s.shutdown()
+			return
 		}
 	}
 }
 
+func (s *service) shutdown() {
+	log.Println("Shutting down")
+	s.status.ShutDown()
+	ctx, cancel := context.WithTimeout(context.Background(), s.currentConfig().Service.Server.ShutdownTimeout.Duration)
+	defer cancel()
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		log.Printf("Server shutsown error: %s", err)
+	}
+	if s.usage != nil {
+		if err = s.usage.Stop(); err != nil {
+			log.Printf("Usage flush failed: %s", err)
+		}
+	}
+	if err = s.audit.Close(); err != nil {
+		log.Printf("Audit log close failed: %s", err)
+	}
+	if s.notifier != nil {
+		s.notifier.Stop()
+	}
+	log.Println("Fin")
+	close(s.shutdownDone)
+}
+
+// upgrade starts new binary passing it listening sockets, the new process
+// shuts this one down gracefully once it's ready to serve requests
+func (s *service) upgrade() {
+	process, err := listener.Upgrade()
+	if err != nil {
+		log.Printf("Binary upgrade failure: %s", err)
+		metrics.Mark("upgrade.failure")
+		return
+	}
+	metrics.Mark("upgrade.started")
+	log.Printf("Started new process %d, waiting for it to take over", process.Pid)
+}
+
+// reload builds new handler from configuration file in background and swaps it
+// with the current one. Requests in flight are finished by the previous handler.
+// If configuration or handler initialization fails the old handler is kept.
+func (s *service) reload() {
+	s.reloadMx.Lock()
+	defer s.reloadMx.Unlock()
+	log.Printf("Reloading configuration from %s", s.configPath)
+	conf, err := parseConfig(s.configPath)
+	if err != nil {
+		log.Printf("New config is corrupted, keeping previous one: %s", err)
+		metrics.Mark("reload.failure")
+		return
+	}
+	holder, err := s.createHandler(conf)
+	if err != nil {
+		log.Printf("Handler initialization failure, keeping previous one: %s", err)
+		metrics.Mark("reload.failure")
+		return
+	}
+	previous := s.handler.Load().(handlerHolder)
+	s.handler.Store(holder)
+	s.status.SetTargets(holder.statusTargets)
+	previous.credentialsStores.Close()
+	previous.spooler.Close()
+	if !reflect.DeepEqual(previous.config.ReadOnly, conf.ReadOnly) {
+		s.readOnly.Set(conf.ReadOnly)
+		log.Printf("Read only state replaced by configured one: enabled %t, access keys %q",
+			conf.ReadOnly.Enabled, conf.ReadOnly.AccessKeys)
+	}
+	if err = log.SetLevels(conf.Logging.Levels); err != nil {
+		log.Printf("Keeping previous subsystems log levels: %s", err)
+	}
+	if s.certificates != nil {
+		if err = s.certificates.Reload(); err != nil {
+			log.Printf("Keeping previous TLS certificate: %s", err)
+		}
+	}
+	metrics.Mark("reload.success")
+	log.Println("Handler replaced")
+}
+
+func (s *service) watchConfig(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	source, err := config.NewSource(s.configPath)
+	if err != nil {
+		log.Printf("Configuration watch disabled: %s", err)
+		return
+	}
+	log.Printf("Watching configuration %s for changes every %s", source, interval)
+	config.WatchSource(source, interval, s.reload)
+}
+
+// watchConfigDirs reloads configuration on changes of files in dirs, so
+// updates of mounted ConfigMaps and Secrets are applied without signals
+func (s *service) watchConfigDirs(dirs []string) {
+	if len(dirs) == 0 {
+		return
+	}
+	if err := config.WatchDirs(dirs, s.reload); err != nil {
+		log.Printf("Configuration directories watch disabled: %s", err)
+		return
+	}
+	log.Printf("Watching configuration directories %s for changes", strings.Join(dirs, ", "))
+}
+
 func (s *service) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	handler := s.handler
-	handler.ServeHTTP(rw, r)
+	holder := s.handler.Load().(handlerHolder)
+	holder.ServeHTTP(rw, r)
 }
-func (s *service) createHandler(conf config.Config) (http.Handler, error) {
+func (s *service) createHandler(conf config.Config) (_ handlerHolder, err error) {
 	transportMatcher, err := transport.ConfigureHTTPTransports(conf.Service.Client)
 	if err != nil {
-		return nil, fmt.Errorf("Couldn't set up client Transports - err: %q", err)
+		return handlerHolder{}, fmt.Errorf("Couldn't set up client Transports - err: %q", err)
 	}
 	syncLog, clusterSyncLog, accessLog, err := mkServiceLogs(conf.Logging)
 	if err != nil {
-		return nil, err
+		return handlerHolder{}, err
 	}
 	methods := make(map[string]struct{})
 	for _, method := range conf.Logging.SyncLogMethods {
 		methods[method] = struct{}{}
 	}
 
-	crdstore.InitializeCredentialsStore(conf.CredentialsStore)
-	syncSender := &storages.SyncSender{SyncLog: syncLog, AllowedMethods: methods}
+	credentialsStores, err := crdstore.NewStores(conf.CredentialsStore)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	spooler := spool.New(conf.Spooling)
+	defer func() {
+		if err != nil {
+			credentialsStores.Close()
+			spooler.Close()
+		}
+	}()
+	syncSender := &storages.SyncSender{
+		SyncLog:        syncLog,
+		AllowedMethods: methods,
+		Tombstones:     storages.NewTombstones(conf.Logging.TombstonesTTL.Duration),
+		ReadRepair:     conf.Logging.ReadRepair,
+		Audit:          s.audit,
+	}
 	storage, err := storages.InitStorages(
 		transportMatcher,
-		s.config.Shards,
-		s.config.Storages,
+		conf.Shards,
+		conf.Storages,
+		credentialsStores,
 		syncSender)
 
 	if err != nil {
-		log.Fatalf("Storages initialization problem: %q", err)
-		return nil, err
+		return handlerHolder{}, fmt.Errorf("Storages initialization problem: %q", err)
+	}
+
+	if err = concurrency.LimitShards(storage.ShardClients, conf.ConcurrencyLimits.Shards); err != nil {
+		return handlerHolder{}, err
 	}
 
-	regionsRT, err := regions.NewRegions(s.config.ShardingPolicies, storage, clusterSyncLog)
+	regionsRT, err := regions.NewRegions(conf.ShardingPolicies, storage, clusterSyncLog, syncLog)
 	if err != nil {
-		return nil, err
+		return handlerHolder{}, err
 	}
 
-	regionsDecoratedRT := httphandler.DecorateRoundTripper(conf.Service.Client,
-		accessLog, conf.Service.Server.HealthCheckEndpoint, regionsRT)
+	edgeAuth, err := auth.EdgeDecorator(conf.Service.Server.AuthServiceEndpoint, credentialsStores)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	encryptionDecorator, err := encryption.Decorator(conf.Encryption)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	var mirrorTarget http.RoundTripper
+	if conf.Mirroring.Shard != "" {
+		if mirrorTarget, err = storage.GetShard(conf.Mirroring.Shard); err != nil {
+			return handlerHolder{}, err
+		}
+	}
+	hooksDecorator, err := hooks.Decorator(conf.Hooks)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	builtin := []httphandler.NamedDecorator{
+		{Name: "mirror", Decorator: mirror.Decorator(conf.Mirroring, mirrorTarget)},
+		{Name: "spool", Decorator: spool.Decorator(spooler)},
+		{Name: "worm", Decorator: worm.Decorator(conf.WORM, s.audit)},
+		{Name: "encryption", Decorator: encryptionDecorator},
+		{Name: "concurrency", Decorator: concurrency.Decorator(conf.ConcurrencyLimits.Global)},
+		{Name: "cache", Decorator: cache.Decorator(conf.Cache)},
+		// rate-limit is applied after edge-auth, so access keys are verified
+		{Name: "rate-limit", Decorator: ratelimit.Decorator(conf.RateLimits)},
+		{Name: "edge-auth", Decorator: edgeAuth},
+		{Name: "public-buckets", Decorator: auth.PublicBucketsDecorator(conf.Service.Server.PublicBuckets)},
+		{Name: "body-limit", Decorator: bodylimit.Decorator(conf.BodyLimits)},
+		{Name: "hooks", Decorator: hooksDecorator},
+		{Name: "read-only", Decorator: readonly.Decorator(s.readOnly)},
+		{Name: "compression", Decorator: compression.Decorator(conf.Compression)},
+		{Name: "options", Decorator: httphandler.OptionsHandler},
+		{Name: "cors", Decorator: cors.Decorator(conf.CORS)},
+		{Name: "usage", Decorator: usage.Decorator(s.usage)},
+		{Name: "hot-spots", Decorator: hotspots.Decorator(s.hotSpots)},
+		{Name: "notifications", Decorator: notifications.Decorator(s.notifier)},
+	}
+	pluginDecorators, err := httphandler.NamedPluginDecorators(conf.Service.Server.Plugins)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	available := append(builtin, pluginDecorators...)
+	available = append(available, httphandler.ServiceDecorators(conf.Service, accessLog, conf.Logging.AccesslogFilter)...)
+	pipeline, err := httphandler.Pipeline(conf.Service.Server.Pipeline, available)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	regionsDecoratedRT := httphandler.Decorate(regionsRT, pipeline...)
+	networkACL, err := netacl.Decorator(conf.NetworkACL)
+	if err != nil {
+		return handlerHolder{}, err
+	}
+	regionsDecoratedRT = networkACL(regionsDecoratedRT)
 
 	handler, err := httphandler.NewHandlerWithRoundTripper(regionsDecoratedRT, conf.Service.Server)
 	if err != nil {
-		return nil, err
+		return handlerHolder{}, err
 	}
+	return handlerHolder{Handler: handler, config: conf, regions: regionsRT,
+		statusTargets: statusTargets(conf, storage, credentialsStores), credentialsStores: credentialsStores,
+		spooler: spooler}, nil
+}
 
-	err = metrics.Init(conf.Metrics)
-	if err != nil {
-		log.Printf("Metrics initialization error: %s", err)
+// statusTargets lists backends of shards, without shadows, and credentials
+// stores checked by status probes
+func statusTargets(conf config.Config, storage *storages.Storages, credentialsStores crdstore.Stores) status.Targets {
+	targets := status.Targets{
+		Backends:          make(map[string]http.RoundTripper),
+		Shards:            make(map[string][]string),
+		CredentialsStores: make(map[string]status.Checkable),
+	}
+	for name, shard := range conf.Shards {
+		for _, storageConf := range shard.Storages {
+			backend, ok := storage.Backends[storageConf.Name]
+			if !ok || backend.Shadow {
+				continue
+			}
+			targets.Backends[storageConf.Name] = backend
+			targets.Shards[name] = append(targets.Shards[name], storageConf.Name)
+		}
 	}
-	return handler, nil
+	for name, instance := range credentialsStores {
+		targets.CredentialsStores[name] = instance
+	}
+	return targets
 }
 
 func (s *service) startTechnicalEndpoint() {
-	port := s.config.Service.Server.TechnicalEndpointListen
+	conf := s.currentConfig()
+	port := conf.Service.Server.TechnicalEndpointListen
 	log.Printf("Starting technical HTTP endpoint on port: %q", port)
+	serveMuxHandler, writeTimeout := s.technicalEndpointHandler(conf)
+	l, err := listener.Listen("technical", port, conf.Service.Server.ReusePort)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l, err = netacl.Listener("technical", l, conf.NetworkACL.TechnicalEndpoint, nil, false)
+	if err != nil {
+		log.Fatalf("Network ACL initialization error: %s", err)
+	}
+	go func() {
+		srv := &http.Server{
+			Addr:           port,
+			Handler:        serveMuxHandler,
+			MaxHeaderBytes: 512,
+			WriteTimeout:   writeTimeout,
+			ReadTimeout:    TechnicalEndpointGeneralTimeout,
+		}
+		log.Fatal(srv.Serve(l))
+	}()
+	log.Println("Technical HTTP endpoint is running.")
+	if conf.Status.Listen != "" {
+		s.startStatusEndpoint(conf.Status.Listen, conf.Service.Server.ReusePort)
+	}
+}
+
+// technicalEndpointHandler routes technical endpoint requests, debug handlers
+// are registered and write timeout is extended only in debug mode
+func (s *service) technicalEndpointHandler(conf config.Config) (*http.ServeMux, time.Duration) {
 	serveMuxHandler := http.NewServeMux()
 	serveMuxHandler.HandleFunc(
 		"/configuration/validate",
 		config.ValidateConfigurationHTTPHandler,
 	)
+	if s.hotSpots != nil {
+		serveMuxHandler.Handle("/hotspots", s.hotSpots)
+	}
+	serveMuxHandler.HandleFunc("/regions/weights", s.serveWeights)
+	serveMuxHandler.Handle("/regions/drain", s.drains)
+	serveMuxHandler.HandleFunc("/readonly", s.serveReadOnly)
+	serveMuxHandler.HandleFunc("/logging/levels", log.ServeLevels)
+	s.status.Register(serveMuxHandler)
+	writeTimeout := TechnicalEndpointGeneralTimeout
+	if conf.Service.Server.Debug {
+		log.Printf("Debug handlers enabled on technical endpoint: /debug/pprof/, /debug/vars")
+		registerDebugHandlers(serveMuxHandler)
+		writeTimeout = TechnicalEndpointDebugTimeout
+	}
+	return serveMuxHandler, writeTimeout
+}
+
+// startStatusEndpoint serves probes on dedicated listener, so they're
+// reachable when technical endpoint isn't exposed
+func (s *service) startStatusEndpoint(address string, reusePort bool) {
+	serveMuxHandler := http.NewServeMux()
+	s.status.Register(serveMuxHandler)
+	l, err := listener.Listen("status", address, reusePort)
+	if err != nil {
+		log.Fatal(err)
+	}
 	go func() {
 		srv := &http.Server{
-			Addr:           port,
+			Addr:           address,
 			Handler:        serveMuxHandler,
 			MaxHeaderBytes: 512,
 			WriteTimeout:   TechnicalEndpointGeneralTimeout,
 			ReadTimeout:    TechnicalEndpointGeneralTimeout,
 		}
-		log.Fatal(srv.ListenAndServe())
+		log.Fatal(srv.Serve(l))
 	}()
-	log.Println("Technical HTTP endpoint is running.")
+	log.Printf("Status probes endpoint is running on %s", address)
+}
+
+// serveWeights delegates to regions of the current handler, weights changed
+// at runtime are replaced by configured ones on reload
+func (s *service) serveWeights(w http.ResponseWriter, r *http.Request) {
+	holder := s.handler.Load().(handlerHolder)
+	if holder.regions == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	holder.regions.ServeHTTP(w, r)
+}
+
+// serveReadOnly delegates to read only mode of the service, state changed at
+// runtime is replaced on reload only if ReadOnly configuration changed
+func (s *service) serveReadOnly(w http.ResponseWriter, r *http.Request) {
+	s.readOnly.ServeHTTP(w, r)
+}
+
+// registerDebugHandlers exposes profiles, goroutine dumps and expvar
+// variables on technical endpoint. Default mux, which net/http/pprof
+// registers to as well, is not served
+func registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/config"
+	"github.com/allegro/akubra/status"
+	statusconfig "github.com/allegro/akubra/status/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigTemplate = `
+Service:
+  Server:
+    Listen: "127.0.0.1:18080"
+    TechnicalEndpointListen: "127.0.0.1:18071"
+    HealthCheckEndpoint: "/status/ping"
+    MaxConcurrentRequests: 100
+    BodyMaxSize: 10M
+    ReadTimeout: 30s
+    WriteTimeout: 30s
+    ShutdownTimeout: 5s
+  Client:
+    Transports:
+      - Name: DefaultTransport
+        Rules:
+        Properties:
+          MaxIdleConnsPerHost: 100
+          ResponseHeaderTimeout: 5s
+Storages:
+  default:
+    Backend: %s
+    Type: passthrough
+Shards:
+  shard:
+    Storages:
+      - Name: default
+        BreakerProbeSize: 10
+        BreakerErrorRate: 0.1
+        BreakerCallTimeLimit: 5s
+        BreakerCallTimeLimitPercentile: 0.9
+        BreakerBasicCutOutDuration: 1s
+        BreakerMaxCutOutDuration: 10s
+        MeterResolution: 5s
+        MeterRetention: 10s
+ShardingPolicies:
+  region:
+    Shards:
+      - ShardName: shard
+        Weight: 1
+    Domains:
+      - akubra.local
+    Default: true
+Logging:
+  Synclog:
+    file: %[2]s
+  ClusterSynclog:
+    file: %[2]s
+  Accesslog:
+    file: %[2]s
+`
+
+// backendStub answers all requests with its name header
+func backendStub(t *testing.T, name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func writeTestConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "akubra.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func servedBy(t *testing.T, srv *service) string {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Header().Get("X-Backend")
+}
+
+func TestReloadShouldReplaceHandlerAndConfigOnlyIfNewConfigIsValid(t *testing.T) {
+	first := backendStub(t, "first")
+	defer first.Close()
+	second := backendStub(t, "second")
+	defer second.Close()
+	dir, err := ioutil.TempDir("", "akubra-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "akubra.log")
+
+	path := writeTestConfig(t, dir, fmt.Sprintf(testConfigTemplate, first.URL, logFile))
+	conf, err := parseConfig(path)
+	require.NoError(t, err)
+	srv := newService(conf, path)
+	srv.status = status.New(statusconfig.Status{})
+	holder, err := srv.createHandler(conf)
+	require.NoError(t, err)
+	srv.handler.Store(holder)
+	require.Equal(t, "first", servedBy(t, srv))
+
+	writeTestConfig(t, dir, "Storages: [corrupted")
+	srv.reload()
+	assert.Equal(t, "first", servedBy(t, srv))
+	assert.Equal(t, first.URL, srv.currentConfig().Storages["default"].Backend.String())
+
+	writeTestConfig(t, dir, fmt.Sprintf(testConfigTemplate, second.URL, logFile))
+	done := make(chan struct{})
+	go func() {
+		// configuration is read by technical endpoint while reloading
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = srv.currentConfig().Service.Server.TechnicalEndpointListen
+		}
+	}()
+	srv.reload()
+	<-done
+	assert.Equal(t, "second", servedBy(t, srv))
+	assert.Equal(t, second.URL, srv.currentConfig().Storages["default"].Backend.String())
+}
+
+func TestReloadShouldKeepReadOnlyStateUnlessItsConfigChanged(t *testing.T) {
+	backend := backendStub(t, "backend")
+	defer backend.Close()
+	dir, err := ioutil.TempDir("", "akubra-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	content := fmt.Sprintf(testConfigTemplate, backend.URL, filepath.Join(dir, "akubra.log"))
+
+	path := writeTestConfig(t, dir, content)
+	conf, err := parseConfig(path)
+	require.NoError(t, err)
+	srv := newService(conf, path)
+	srv.status = status.New(statusconfig.Status{})
+	holder, err := srv.createHandler(conf)
+	require.NoError(t, err)
+	srv.handler.Store(holder)
+	rec := httptest.NewRecorder()
+	srv.serveReadOnly(rec, httptest.NewRequest(http.MethodPut, "http://localhost/readonly", strings.NewReader(`{"Enabled": true}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	srv.reload()
+	assert.True(t, srv.readOnly.State().Enabled)
+
+	writeTestConfig(t, dir, content+`
+ReadOnly:
+  AccessKeys:
+    - batch-job
+`)
+	srv.reload()
+	assert.False(t, srv.readOnly.State().Enabled)
+	assert.Equal(t, []string{"batch-job"}, srv.readOnly.State().AccessKeys)
+}
+
+func TestParseConfigShouldRunAllValidators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	content := fmt.Sprintf(testConfigTemplate, "http://127.0.0.1:8080", filepath.Join(dir, "akubra.log")) + `
+ConcurrencyLimits:
+  Global:
+    MaxInFlight: 0
+`
+
+	_, err = parseConfig(writeTestConfig(t, dir, content))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MaxInFlight of global concurrency limit should be positive")
+}
+
+func TestTechnicalEndpointShouldServeDebugHandlersOnlyInDebugMode(t *testing.T) {
+	srv := newService(config.Config{}, "")
+	srv.status = status.New(statusconfig.Status{})
+
+	for _, debug := range []bool{false, true} {
+		conf := config.Config{}
+		conf.Service.Server.Debug = debug
+		mux, writeTimeout := srv.technicalEndpointHandler(conf)
+
+		expectedStatus := http.StatusNotFound
+		expectedTimeout := TechnicalEndpointGeneralTimeout
+		if debug {
+			expectedStatus = http.StatusOK
+			expectedTimeout = TechnicalEndpointDebugTimeout
+		}
+		for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost"+path, nil))
+			assert.Equal(t, expectedStatus, rec.Code, "%s with debug %t", path, debug)
+		}
+		assert.Equal(t, expectedTimeout, writeTimeout)
+	}
+	assert.True(t, TechnicalEndpointDebugTimeout > TechnicalEndpointGeneralTimeout)
+}
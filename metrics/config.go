@@ -26,18 +26,20 @@ func (interval *Interval) UnmarshalYAML(unmarshal func(interface{}) error) error
 
 // Config defines metrics publication details
 type Config struct {
-	// Target, possible values: "graphite", "expvar", "stdout"
+	// Target, possible values: "graphite", "statsd", "expvar", "stdout"
 	Target string `yaml:"Target,omitempty"`
-	// Interval determines how often metrics should be released, applicable for "graphite" and "stdout"
+	// Interval determines how often metrics should be released, applicable for "graphite", "statsd" and "stdout"
 	Interval Interval `yaml:"Interval,omitempty"`
-	// Addr points graphite collector address
+	// Addr points graphite collector or statsd daemon address
 	Addr string `yaml:"Addr,omitempty"`
 	// ExpAddr is expvar server adress
 	ExpAddr string `yaml:"ExpAddr,omitempty"`
 	// Prefix graphite metrics
 	Prefix string `yaml:"Prefix,omitempty"`
-	// Percentiles customizes metrics sent to graphite default: 0.75, 0.95, 0.99, 0.999
+	// Percentiles customizes metrics sent to graphite and statsd default: 0.75, 0.95, 0.99, 0.999
 	Percentiles []float64 `yaml:"Percentiles"`
+	// Tags are appended to metrics sent to statsd in DogStatsD format, e.g. "env:prod"
+	Tags []string `yaml:"Tags,omitempty"`
 	// Debug includes runtime.MemStats metrics
 	Debug bool `yaml:"Debug"`
 	// AppendDefaults adds "<hostname>.<process>"  suffix
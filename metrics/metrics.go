@@ -86,11 +86,13 @@ func Init(cfg Config) (err error) {
 			return errors.New("metrics: graphite addr missing")
 		}
 		log.Printf("Sending metrics to Graphite on %s as %q", cfg.Addr, pfx)
-		percentiles := cfg.Percentiles
-		if len(percentiles) == 0 {
-			percentiles = append(percentiles, []float64{0.75, 0.95, 0.99, 0.999}...)
+		return initGraphite(cfg.Addr, cfg.Interval.Duration, percentiles(cfg))
+	case "statsd":
+		if cfg.Addr == "" {
+			return errors.New("metrics: statsd addr missing")
 		}
-		return initGraphite(cfg.Addr, cfg.Interval.Duration, percentiles)
+		log.Printf("Sending metrics to statsd on %s as %q", cfg.Addr, pfx)
+		return initStatsd(cfg.Addr, cfg.Interval.Duration, percentiles(cfg), cfg.Tags)
 	case "expvar":
 		log.Printf("Sending metrics to ExpVarService on %s", cfg.ExpAddr)
 		handler := exp.ExpHandler(metrics.DefaultRegistry)
@@ -104,6 +106,13 @@ func Init(cfg Config) (err error) {
 	}
 }
 
+func percentiles(cfg Config) []float64 {
+	if len(cfg.Percentiles) == 0 {
+		return []float64{0.75, 0.95, 0.99, 0.999}
+	}
+	return cfg.Percentiles
+}
+
 func startExpvar(cfg Config, handler http.Handler) {
 	err := http.ListenAndServe(cfg.ExpAddr, handler)
 	if err != nil {
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	defaultStatsdInterval = 10 * time.Second
+	// statsdPacketSize keeps packets below common MTU
+	statsdPacketSize = 1432
+)
+
+// statsdReporter sends registry to statsd daemon. Meters, counters and
+// timer counts are sent as counters incremented since previous flush, timer
+// and histogram statistics as gauges, durations in milliseconds
+type statsdReporter struct {
+	registry    metrics.Registry
+	addr        string
+	prefix      string
+	percentiles []float64
+	// tags are appended in DogStatsD format
+	tags   string
+	counts map[string]int64
+}
+
+func newStatsdReporter(registry metrics.Registry, addr, prefix string, percentiles []float64, tags []string) *statsdReporter {
+	if prefix != "" {
+		prefix += "."
+	}
+	reporter := &statsdReporter{registry: registry, addr: addr, prefix: prefix, percentiles: percentiles,
+		counts: make(map[string]int64)}
+	if len(tags) > 0 {
+		reporter.tags = "|#" + strings.Join(tags, ",")
+	}
+	return reporter
+}
+
+func initStatsd(addr string, interval time.Duration, percentiles []float64, tags []string) error {
+	if _, err := net.ResolveUDPAddr("udp", addr); err != nil {
+		return fmt.Errorf("metrics: cannot resolve statsd address: %s", err)
+	}
+	if interval <= 0 {
+		interval = defaultStatsdInterval
+	}
+	reporter := newStatsdReporter(metrics.DefaultRegistry, addr, pfx, percentiles, tags)
+	go func() {
+		for range time.Tick(interval) {
+			if err := reporter.flush(); err != nil {
+				log.Printf("metrics: cannot send metrics to statsd: %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (sr *statsdReporter) flush() error {
+	conn, err := net.Dial("udp", sr.addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Printf("metrics: cannot close statsd connection: %s", closeErr)
+		}
+	}()
+	packet := &bytes.Buffer{}
+	for _, line := range sr.lines() {
+		if packet.Len()+len(line) > statsdPacketSize && packet.Len() > 0 {
+			if _, err = conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	_, err = conn.Write(packet.Bytes())
+	return err
+}
+
+// lines returns sorted statsd lines of all metrics in registry
+func (sr *statsdReporter) lines() []string {
+	lines := make([]string, 0)
+	sr.registry.Each(func(name string, i interface{}) {
+		name = sr.prefix + name
+		switch metric := i.(type) {
+		case metrics.Counter:
+			lines = append(lines, sr.counter(name, metric.Count()))
+		case metrics.Gauge:
+			lines = append(lines, sr.line(name, strconv.FormatInt(metric.Value(), 10), "g"))
+		case metrics.GaugeFloat64:
+			lines = append(lines, sr.line(name, formatFloat(metric.Value()), "g"))
+		case metrics.Meter:
+			lines = append(lines, sr.counter(name+".count", metric.Snapshot().Count()))
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			lines = append(lines, sr.counter(name+".count", h.Count()))
+			lines = append(lines, sr.statistics(name, float64(h.Min()), float64(h.Max()), h.Mean(), h.Percentiles(sr.percentiles))...)
+		case metrics.Timer:
+			t := metric.Snapshot()
+			ms := float64(time.Millisecond)
+			percentiles := t.Percentiles(sr.percentiles)
+			for i := range percentiles {
+				percentiles[i] /= ms
+			}
+			lines = append(lines, sr.counter(name+".count", t.Count()))
+			lines = append(lines, sr.statistics(name, float64(t.Min())/ms, float64(t.Max())/ms, t.Mean()/ms, percentiles)...)
+		}
+	})
+	sort.Strings(lines)
+	return lines
+}
+
+// counter returns increment of count since previous flush
+func (sr *statsdReporter) counter(name string, count int64) string {
+	delta := count - sr.counts[name]
+	sr.counts[name] = count
+	return sr.line(name, strconv.FormatInt(delta, 10), "c")
+}
+
+func (sr *statsdReporter) statistics(name string, min, max, mean float64, percentiles []float64) []string {
+	lines := []string{
+		sr.line(name+".min", formatFloat(min), "g"),
+		sr.line(name+".max", formatFloat(max), "g"),
+		sr.line(name+".mean", formatFloat(mean), "g"),
+	}
+	for i, percentile := range sr.percentiles {
+		suffix := strings.Replace(strconv.FormatFloat(percentile*100, 'f', -1, 64), ".", "", 1)
+		lines = append(lines, sr.line(name+".p"+suffix, formatFloat(percentiles[i]), "g"))
+	}
+	return lines
+}
+
+func (sr *statsdReporter) line(name, value, kind string) string {
+	return name + ":" + value + "|" + kind + sr.tags + "\n"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsdReporterShouldSendCountIncrements(t *testing.T) {
+	registry := metrics.NewRegistry()
+	meter := metrics.GetOrRegisterMeter("reqs.global.all", registry)
+	metrics.GetOrRegisterGauge("spool.files", registry).Update(3)
+	reporter := newStatsdReporter(registry, "localhost:8125", "akubra", nil, []string{"env:test"})
+
+	meter.Mark(5)
+	first := reporter.lines()
+	meter.Mark(2)
+	second := reporter.lines()
+
+	assert.Equal(t, []string{"akubra.reqs.global.all.count:5|c|#env:test\n", "akubra.spool.files:3|g|#env:test\n"}, first)
+	assert.Equal(t, []string{"akubra.reqs.global.all.count:2|c|#env:test\n", "akubra.spool.files:3|g|#env:test\n"}, second)
+}
+
+func TestStatsdReporterShouldSendTimerStatisticsInMilliseconds(t *testing.T) {
+	registry := metrics.NewRegistry()
+	timer := metrics.GetOrRegisterTimer("reqs.backend.all", registry)
+	timer.Update(10 * time.Millisecond)
+	timer.Update(30 * time.Millisecond)
+	reporter := newStatsdReporter(registry, "localhost:8125", "", []float64{0.5}, nil)
+
+	assert.Equal(t, []string{
+		"reqs.backend.all.count:2|c\n",
+		"reqs.backend.all.max:30.00|g\n",
+		"reqs.backend.all.mean:20.00|g\n",
+		"reqs.backend.all.min:10.00|g\n",
+		"reqs.backend.all.p50:20.00|g\n",
+	}, reporter.lines())
+}
+
+func TestStatsdReporterShouldFlushOverUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("reload.success", registry).Inc(1)
+	reporter := newStatsdReporter(registry, conn.LocalAddr().String(), "", nil, nil)
+
+	require.NoError(t, reporter.flush())
+
+	packet := make([]byte, statsdPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(packet)
+	require.NoError(t, err)
+	assert.Equal(t, "reload.success:1|c\n", string(packet[:n]))
+}
+
+func TestMetricsInit_ForStatsdWithNoAddress(t *testing.T) {
+	err := Init(Config{Target: "statsd", Addr: ""})
+	assert.Error(t, err)
+	Clear()
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// checkpoint records copied objects in file, one escaped path per line
+type checkpoint struct {
+	mx     sync.Mutex
+	file   *os.File
+	copied map[string]struct{}
+}
+
+// openCheckpoint loads objects copied by previous runs, empty path disables
+// checkpoints
+func openCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{copied: make(map[string]struct{})}
+	if path == "" {
+		return cp, nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		objectPath, err := url.PathUnescape(scanner.Text())
+		if err != nil {
+			continue
+		}
+		cp.copied[objectPath] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	cp.file = file
+	return cp, nil
+}
+
+// Has reports if object was already copied
+func (cp *checkpoint) Has(objectPath string) bool {
+	cp.mx.Lock()
+	defer cp.mx.Unlock()
+	_, copied := cp.copied[objectPath]
+	return copied
+}
+
+// Add records copied object
+func (cp *checkpoint) Add(objectPath string) error {
+	cp.mx.Lock()
+	defer cp.mx.Unlock()
+	cp.copied[objectPath] = struct{}{}
+	if cp.file == nil {
+		return nil
+	}
+	_, err := cp.file.WriteString(url.PathEscape(objectPath) + "\n")
+	return err
+}
+
+// Close releases checkpoint file
+func (cp *checkpoint) Close() error {
+	if cp.file == nil {
+		return nil
+	}
+	return cp.file.Close()
+}
@@ -0,0 +1,257 @@
+package migrate
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+)
+
+// Picker finds shard key belongs to
+type Picker interface {
+	Pick(key string) (storages.NamedShardClient, error)
+}
+
+// DrainProgress describes objects moved from drained shard so far
+type DrainProgress struct {
+	Region string `json:"region"`
+	Shard  string `json:"shard"`
+	// Listed is number of objects found in listed buckets
+	Listed int `json:"listed"`
+	Moved  int `json:"moved"`
+	// Skipped objects had newer version in target already, they're only
+	// removed from drained shard
+	Skipped int `json:"skipped"`
+	// Failed maps objects which couldn't be moved to the reason
+	Failed   map[string]string `json:"failed"`
+	Started  time.Time         `json:"started"`
+	Finished *time.Time        `json:"finished,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Drain moves all objects of drained shard to shards they belong to in ring
+// without it
+type Drain struct {
+	source      storages.NamedShardClient
+	ring        Picker
+	concurrency int
+	mx          sync.Mutex
+	progress    DrainProgress
+}
+
+// NewDrain creates Drain of source shard in region
+func NewDrain(region string, source storages.NamedShardClient, ring Picker, concurrency int) *Drain {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Drain{source: source, ring: ring, concurrency: concurrency,
+		progress: DrainProgress{Region: region, Shard: source.Name(), Failed: make(map[string]string)}}
+}
+
+// Start runs drain in background
+func (d *Drain) Start() {
+	go func() {
+		if err := d.Run(); err != nil {
+			log.Printf("Drain of shard %s interrupted: %s", d.source.Name(), err)
+			return
+		}
+		log.Printf("Drain of shard %s finished", d.source.Name())
+	}()
+}
+
+// Run moves objects of all buckets of source shard
+func (d *Drain) Run() error {
+	d.record(func(p *DrainProgress) { p.Started = time.Now() })
+	err := d.run()
+	d.record(func(p *DrainProgress) {
+		finished := time.Now()
+		p.Finished = &finished
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+	return err
+}
+
+func (d *Drain) run() error {
+	buckets, err := listBuckets(d.source)
+	if err != nil {
+		return fmt.Errorf("cannot list buckets: %s", err)
+	}
+	for _, bucket := range buckets {
+		objects, err := ListObjects(d.source, bucket)
+		if err != nil {
+			return fmt.Errorf("cannot list bucket %s: %s", bucket, err)
+		}
+		d.record(func(p *DrainProgress) { p.Listed += len(objects) })
+		d.moveObjects(bucket, objects)
+	}
+	return nil
+}
+
+func (d *Drain) moveObjects(bucket string, objects []s3datatypes.ObjectInfo) {
+	queue := make(chan s3datatypes.ObjectInfo)
+	wg := sync.WaitGroup{}
+	for i := 0; i < d.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range queue {
+				d.moveObject(bucket, object)
+			}
+		}()
+	}
+	for _, object := range objects {
+		queue <- object
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (d *Drain) moveObject(bucket string, object s3datatypes.ObjectInfo) {
+	path := objectPath(bucket, object.Key)
+	skipped, err := d.copyToRing(path, object)
+	if err == nil {
+		err = deleteObject(d.source, path)
+	}
+	if err != nil {
+		log.Printf("Drain of %s from shard %s failed: %s", path, d.source.Name(), err)
+		metrics.Mark("drain.failure")
+		d.record(func(p *DrainProgress) { p.Failed[path] = err.Error() })
+		return
+	}
+	metrics.Mark("drain.success")
+	d.record(func(p *DrainProgress) {
+		if skipped {
+			p.Skipped++
+			return
+		}
+		p.Moved++
+	})
+}
+
+// copyToRing copies object to its shard unless it was written there
+// already, object in target is newer as drained shard gets no new keys
+func (d *Drain) copyToRing(path string, object s3datatypes.ObjectInfo) (bool, error) {
+	target, err := d.ring.Pick(path)
+	if err != nil {
+		return false, err
+	}
+	if target.Name() == d.source.Name() {
+		return false, fmt.Errorf("object still belongs to drained shard")
+	}
+	exists, err := objectExists(target, path)
+	if err != nil || exists {
+		return exists, err
+	}
+	return false, copyObject(d.source, target, path, object)
+}
+
+// Progress returns progress of drain
+func (d *Drain) Progress() DrainProgress {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	progress := d.progress
+	progress.Failed = make(map[string]string, len(d.progress.Failed))
+	for path, reason := range d.progress.Failed {
+		progress.Failed[path] = reason
+	}
+	return progress
+}
+
+func (d *Drain) record(update func(*DrainProgress)) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	update(&d.progress)
+}
+
+// Drains serves progress of drains as JSON
+type Drains []*Drain
+
+// ServeHTTP implements http.Handler interface
+func (ds Drains) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	progress := make([]DrainProgress, 0, len(ds))
+	for _, drain := range ds {
+		progress = append(progress, drain.Progress())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		log.Printf("Cannot write drain progress: %s", err)
+	}
+}
+
+type listAllMyBucketsResult struct {
+	Buckets []struct {
+		Name string
+	} `xml:"Buckets>Bucket"`
+}
+
+func listBuckets(roundTripper http.RoundTripper) ([]string, error) {
+	req, err := newRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer discardBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing responded with status %d", resp.StatusCode)
+	}
+	result := listAllMyBucketsResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	buckets := make([]string, 0, len(result.Buckets))
+	for _, bucket := range result.Buckets {
+		buckets = append(buckets, bucket.Name)
+	}
+	return buckets, nil
+}
+
+func objectExists(roundTripper http.RoundTripper, path string) (bool, error) {
+	req, err := newRequest(http.MethodHead, path, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := roundTripper.RoundTrip(req)
+	if err != nil {
+		return false, err
+	}
+	defer discardBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("target responded with status %d", resp.StatusCode)
+}
+
+func deleteObject(roundTripper http.RoundTripper, path string) error {
+	req, err := newRequest(http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := roundTripper.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer discardBody(resp)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("source responded with status %d to delete", resp.StatusCode)
+	}
+	return nil
+}
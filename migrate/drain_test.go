@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/storages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedShard names shardStub as shard of ring
+type namedShard struct {
+	*shardStub
+	name string
+}
+
+func (ns namedShard) Name() string {
+	return ns.name
+}
+
+func (ns namedShard) Backends() []*storages.StorageClient {
+	return nil
+}
+
+func (ns namedShard) StreamsBody() bool {
+	return false
+}
+
+type ringStub struct {
+	shard storages.NamedShardClient
+}
+
+func (rs ringStub) Pick(string) (storages.NamedShardClient, error) {
+	return rs.shard, nil
+}
+
+func TestDrainShouldMoveObjectsWithoutOverwritingNewerOnes(t *testing.T) {
+	source := newShardStub(map[string]string{"a": "first", "b": "second", "c d": "third"})
+	target := newShardStub(map[string]string{"b": "newer"})
+	drain := NewDrain("region", namedShard{source, "drained"}, ringStub{namedShard{target, "remaining"}}, 2)
+
+	require.NoError(t, drain.Run())
+
+	assert.Empty(t, source.objects)
+	require.Len(t, target.objects, 3)
+	assert.Equal(t, "newer", string(target.objects["b"].content))
+	assert.Equal(t, "third", string(target.objects["c d"].content))
+	recorder := httptest.NewRecorder()
+	Drains{drain}.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/regions/drain", nil))
+	progress := make([]DrainProgress, 0)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &progress))
+	require.Len(t, progress, 1)
+	assert.Equal(t, "drained", progress[0].Shard)
+	assert.Equal(t, 3, progress[0].Listed)
+	assert.Equal(t, 2, progress[0].Moved)
+	assert.Equal(t, 1, progress[0].Skipped)
+	assert.Empty(t, progress[0].Failed)
+	assert.NotNil(t, progress[0].Finished)
+}
+
+func TestDrainShouldNotMoveObjectsToDrainedShard(t *testing.T) {
+	source := namedShard{newShardStub(map[string]string{"a": "first"}), "drained"}
+	drain := NewDrain("region", source, ringStub{source}, 1)
+
+	require.NoError(t, drain.Run())
+
+	progress := drain.Progress()
+	assert.Equal(t, "object still belongs to drained shard", progress.Failed["/bucket/a"])
+	assert.Len(t, source.objects, 1)
+}
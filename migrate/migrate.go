@@ -0,0 +1,312 @@
+package migrate
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+)
+
+// copiedHeaders are object headers preserved by migration
+var copiedHeaders = []string{"Content-Type", "Content-Encoding", "Content-Disposition", "Content-Language", "Cache-Control", "Expires"}
+
+// Config of buckets migration
+type Config struct {
+	Buckets []string
+	// Concurrency is number of objects copied at once, default: 1
+	Concurrency int
+	// CheckpointFile lists copied objects, objects listed there are
+	// skipped when migration is started again
+	CheckpointFile string
+}
+
+// Report summarizes migration
+type Report struct {
+	Copied  int
+	Skipped int
+	// Failed maps objects which couldn't be copied to the reason
+	Failed map[string]string
+	// Missing are source objects absent in target after migration
+	Missing []string
+	// Different are objects which size or ETag differs in target
+	Different []string
+}
+
+// Consistent reports if all objects were copied and target matches source
+func (r *Report) Consistent() bool {
+	return len(r.Failed) == 0 && len(r.Missing) == 0 && len(r.Different) == 0
+}
+
+// Write prints report in human readable form
+func (r *Report) Write(w io.Writer) error {
+	lines := []string{fmt.Sprintf("Copied: %d, skipped: %d, failed: %d, missing: %d, different: %d",
+		r.Copied, r.Skipped, len(r.Failed), len(r.Missing), len(r.Different))}
+	failed := make([]string, 0, len(r.Failed))
+	for path := range r.Failed {
+		failed = append(failed, path)
+	}
+	sort.Strings(failed)
+	for _, path := range failed {
+		lines = append(lines, fmt.Sprintf("failed %s: %s", path, r.Failed[path]))
+	}
+	for _, path := range r.Missing {
+		lines = append(lines, fmt.Sprintf("missing %s", path))
+	}
+	for _, path := range r.Different {
+		lines = append(lines, fmt.Sprintf("different %s", path))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// Migrator copies objects of buckets from source shard to target shard
+type Migrator struct {
+	source     http.RoundTripper
+	target     http.RoundTripper
+	conf       Config
+	checkpoint *checkpoint
+	mx         sync.Mutex
+	report     *Report
+}
+
+// New creates Migrator, objects listed in checkpoint file are not copied again
+func New(source, target http.RoundTripper, conf Config) (*Migrator, error) {
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	cp, err := openCheckpoint(conf.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{source: source, target: target, conf: conf, checkpoint: cp}, nil
+}
+
+// Run copies objects of all configured buckets and compares listings of
+// source and target afterwards
+func (m *Migrator) Run() (*Report, error) {
+	defer m.checkpoint.Close()
+	m.report = &Report{Failed: make(map[string]string)}
+	for _, bucket := range m.conf.Buckets {
+		objects, err := ListObjects(m.source, bucket)
+		if err != nil {
+			return m.report, fmt.Errorf("cannot list bucket %s on source: %s", bucket, err)
+		}
+		m.copyObjects(bucket, objects)
+		copied, err := ListObjects(m.target, bucket)
+		if err != nil {
+			return m.report, fmt.Errorf("cannot list bucket %s on target: %s", bucket, err)
+		}
+		m.diff(bucket, objects, copied)
+	}
+	return m.report, nil
+}
+
+func (m *Migrator) copyObjects(bucket string, objects []s3datatypes.ObjectInfo) {
+	queue := make(chan s3datatypes.ObjectInfo)
+	wg := sync.WaitGroup{}
+	for i := 0; i < m.conf.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range queue {
+				m.copyObject(bucket, object)
+			}
+		}()
+	}
+	for _, object := range objects {
+		queue <- object
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (m *Migrator) copyObject(bucket string, object s3datatypes.ObjectInfo) {
+	path := objectPath(bucket, object.Key)
+	if m.checkpoint.Has(path) {
+		m.record(func(r *Report) { r.Skipped++ })
+		return
+	}
+	if err := copyObject(m.source, m.target, path, object); err != nil {
+		log.Printf("Migration of %s failed: %s", path, err)
+		m.record(func(r *Report) { r.Failed[path] = err.Error() })
+		return
+	}
+	if err := m.checkpoint.Add(path); err != nil {
+		log.Printf("Cannot write checkpoint of %s: %s", path, err)
+	}
+	m.record(func(r *Report) { r.Copied++ })
+}
+
+func (m *Migrator) record(update func(*Report)) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	update(m.report)
+}
+
+// diff records source objects which are missing or differ in target
+func (m *Migrator) diff(bucket string, objects, copied []s3datatypes.ObjectInfo) {
+	targetObjects := make(map[string]s3datatypes.ObjectInfo, len(copied))
+	for _, object := range copied {
+		targetObjects[object.Key] = object
+	}
+	for _, object := range objects {
+		path := objectPath(bucket, object.Key)
+		targetObject, exists := targetObjects[object.Key]
+		switch {
+		case !exists:
+			m.report.Missing = append(m.report.Missing, path)
+		case targetObject.Size != object.Size || !sameETag(targetObject.ETag, object.ETag):
+			m.report.Different = append(m.report.Different, path)
+		}
+	}
+}
+
+// copyObject streams object from source to target verifying its MD5
+func copyObject(source, target http.RoundTripper, path string, object s3datatypes.ObjectInfo) error {
+	getReq, err := newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	getResp, err := source.RoundTrip(getReq)
+	if err != nil {
+		return err
+	}
+	defer discardBody(getResp)
+	if getResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("source responded with status %d", getResp.StatusCode)
+	}
+
+	hash := md5.New()
+	putReq, err := newRequest(http.MethodPut, path, ioutil.NopCloser(io.TeeReader(getResp.Body, hash)))
+	if err != nil {
+		return err
+	}
+	putReq.ContentLength = getResp.ContentLength
+	for _, header := range copiedHeaders {
+		if value := getResp.Header.Get(header); value != "" {
+			putReq.Header.Set(header, value)
+		}
+	}
+	for header, values := range getResp.Header {
+		if strings.HasPrefix(strings.ToLower(header), "x-amz-meta-") {
+			putReq.Header[header] = values
+		}
+	}
+	putResp, err := target.RoundTrip(putReq)
+	if err != nil {
+		return err
+	}
+	defer discardBody(putResp)
+	if putResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("target responded with status %d", putResp.StatusCode)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !sameETag(sum, getResp.Header.Get("ETag")) || !sameETag(sum, object.ETag) {
+		return fmt.Errorf("checksum %s doesn't match source ETag %s", sum, getResp.Header.Get("ETag"))
+	}
+	if !sameETag(sum, putResp.Header.Get("ETag")) {
+		return fmt.Errorf("checksum %s doesn't match target ETag %s", sum, putResp.Header.Get("ETag"))
+	}
+	return nil
+}
+
+// sameETag compares ETags, multipart upload ETags (MD5SUM-N) aren't MD5 of
+// object, so they're not compared
+func sameETag(first, other string) bool {
+	first, other = strings.Trim(first, `"`), strings.Trim(other, `"`)
+	if first == "" || other == "" || strings.Contains(first, "-") || strings.Contains(other, "-") {
+		return true
+	}
+	return first == other
+}
+
+// ListObjects lists all objects of bucket following truncated listings
+func ListObjects(roundTripper http.RoundTripper, bucket string) ([]s3datatypes.ObjectInfo, error) {
+	return ListPrefix(roundTripper, bucket, "")
+}
+
+// ListPrefix lists objects of bucket which keys start with prefix following
+// truncated listings
+func ListPrefix(roundTripper http.RoundTripper, bucket, prefix string) ([]s3datatypes.ObjectInfo, error) {
+	objects := make([]s3datatypes.ObjectInfo, 0)
+	marker := ""
+	for {
+		query := url.Values{}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		req, err := newRequest(http.MethodGet, "/"+bucket, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.URL.RawQuery = query.Encode()
+		resp, err := roundTripper.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		result := s3datatypes.ListBucketResult{}
+		err = decodeListing(resp, &result)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || len(result.Contents) == 0 {
+			return objects, nil
+		}
+		marker = result.NextMarker
+		if marker == "" {
+			marker = result.Contents[len(result.Contents)-1].Key
+		}
+	}
+}
+
+func decodeListing(resp *http.Response, result *s3datatypes.ListBucketResult) error {
+	defer discardBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("listing responded with status %d", resp.StatusCode)
+	}
+	return xml.NewDecoder(resp.Body).Decode(result)
+}
+
+func newRequest(method, path string, body io.ReadCloser) (*http.Request, error) {
+	req, err := http.NewRequest(method, "http://localhost"+(&url.URL{Path: path}).EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+	}
+	ctx := context.WithValue(req.Context(), log.ContextreqIDKey, fmt.Sprintf("migrate-%s", path))
+	return req.WithContext(ctx), nil
+}
+
+func objectPath(bucket, key string) string {
+	return "/" + bucket + "/" + key
+}
+
+func discardBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.Debugf("Cannot discard response body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Cannot close response body: %s", err)
+	}
+}
@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type storedObject struct {
+	content []byte
+	etag    string
+	header  http.Header
+}
+
+// shardStub is in memory storage of single bucket
+type shardStub struct {
+	mx       sync.Mutex
+	objects  map[string]storedObject
+	puts     int
+	pageSize int
+}
+
+func newShardStub(contents map[string]string) *shardStub {
+	stub := &shardStub{objects: make(map[string]storedObject), pageSize: 2}
+	for key, content := range contents {
+		stub.store(key, []byte(content), http.Header{})
+	}
+	return stub
+}
+
+func (ss *shardStub) store(key string, content []byte, header http.Header) {
+	sum := md5.Sum(content)
+	ss.objects[key] = storedObject{content: content, etag: `"` + hex.EncodeToString(sum[:]) + `"`, header: header}
+}
+
+func (ss *shardStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	if req.URL.Path == "/" {
+		body := `<ListAllMyBucketsResult><Buckets><Bucket><Name>bucket</Name></Bucket></Buckets></ListAllMyBucketsResult>`
+		return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	}
+	path := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if len(path) == 1 {
+		return ss.list(req, req.URL.Query().Get("marker"))
+	}
+	switch req.Method {
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		ss.puts++
+		ss.store(path[1], content, req.Header)
+		return &http.Response{StatusCode: http.StatusOK, Request: req,
+			Header: http.Header{"Etag": []string{ss.objects[path[1]].etag}}, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	case http.MethodHead:
+		status := http.StatusNotFound
+		if _, ok := ss.objects[path[1]]; ok {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Request: req, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	case http.MethodDelete:
+		delete(ss.objects, path[1])
+		return &http.Response{StatusCode: http.StatusNoContent, Request: req, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	case http.MethodGet:
+		object, ok := ss.objects[path[1]]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Request: req, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+		}
+		header := http.Header{"Etag": []string{object.etag}, "Content-Type": []string{"text/plain"}, "X-Amz-Meta-Owner": []string{"tester"}}
+		return &http.Response{StatusCode: http.StatusOK, Request: req, Header: header,
+			ContentLength: int64(len(object.content)), Body: ioutil.NopCloser(bytes.NewReader(object.content))}, nil
+	}
+	return nil, fmt.Errorf("unexpected request %s %s", req.Method, req.URL)
+}
+
+func (ss *shardStub) list(req *http.Request, marker string) (*http.Response, error) {
+	keys := make([]string, 0, len(ss.objects))
+	for key := range ss.objects {
+		if key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := s3datatypes.ListBucketResult{Name: "bucket", Marker: marker}
+	if len(keys) > ss.pageSize {
+		keys = keys[:ss.pageSize]
+		result.IsTruncated = true
+	}
+	for _, key := range keys {
+		object := ss.objects[key]
+		result.Contents = append(result.Contents, s3datatypes.ObjectInfo{Key: key, ETag: object.etag, Size: int64(len(object.content))})
+	}
+	body, err := xml.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func TestMigratorShouldCopyAllObjectsWithMetadata(t *testing.T) {
+	source := newShardStub(map[string]string{"a": "first", "b": "second", "c/d": "third", "e f": "fourth", "g": ""})
+	target := newShardStub(nil)
+	migrator, err := New(source, target, Config{Buckets: []string{"bucket"}, Concurrency: 3})
+	require.NoError(t, err)
+
+	report, err := migrator.Run()
+
+	require.NoError(t, err)
+	assert.True(t, report.Consistent())
+	assert.Equal(t, 5, report.Copied)
+	require.Len(t, target.objects, 5)
+	for key, object := range source.objects {
+		assert.Equal(t, object.content, target.objects[key].content)
+	}
+	assert.Equal(t, "text/plain", target.objects["a"].header.Get("Content-Type"))
+	assert.Equal(t, "tester", target.objects["a"].header.Get("X-Amz-Meta-Owner"))
+}
+
+func TestMigratorShouldSkipObjectsFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	checkpointFile := filepath.Join(dir, "checkpoint")
+	source := newShardStub(map[string]string{"a": "first", "b b": "second"})
+	target := newShardStub(nil)
+	conf := Config{Buckets: []string{"bucket"}, CheckpointFile: checkpointFile}
+
+	migrator, err := New(source, target, conf)
+	require.NoError(t, err)
+	_, err = migrator.Run()
+	require.NoError(t, err)
+	source.store("c", []byte("third"), http.Header{})
+	migrator, err = New(source, target, conf)
+	require.NoError(t, err)
+	report, err := migrator.Run()
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Copied)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Equal(t, 3, target.puts)
+}
+
+func TestMigratorShouldReportChecksumMismatchAndDifferentObjects(t *testing.T) {
+	source := newShardStub(map[string]string{"a": "first", "b": "second"})
+	corrupted := source.objects["b"]
+	corrupted.etag = `"0123456789abcdef0123456789abcdef"`
+	source.objects["b"] = corrupted
+	target := newShardStub(nil)
+	migrator, err := New(source, target, Config{Buckets: []string{"bucket"}})
+	require.NoError(t, err)
+
+	report, err := migrator.Run()
+
+	require.NoError(t, err)
+	assert.False(t, report.Consistent())
+	assert.Equal(t, 1, report.Copied)
+	assert.Contains(t, report.Failed["/bucket/b"], "doesn't match source ETag")
+	assert.Equal(t, []string{"/bucket/b"}, report.Different)
+	buf := &bytes.Buffer{}
+	require.NoError(t, report.Write(buf))
+	assert.Contains(t, buf.String(), "Copied: 1, skipped: 0, failed: 1, missing: 0, different: 1")
+}
+
+func TestSameETagShouldIgnoreMultipartETags(t *testing.T) {
+	assert.True(t, sameETag(`"abc"`, "abc"))
+	assert.False(t, sameETag(`"abc"`, `"abd"`))
+	assert.True(t, sameETag(`"abc-2"`, `"abd"`))
+}
@@ -0,0 +1,13 @@
+package config
+
+// Mirroring configuration, requests are not mirrored if Shard is not defined
+type Mirroring struct {
+	// Shard receives copies of sampled requests
+	Shard string `yaml:"Shard"`
+	// Percentage of matching requests which are mirrored, (0, 100]
+	Percentage float64 `yaml:"Percentage"`
+	// AccessKeys limits mirroring to requests of given access keys
+	AccessKeys []string `yaml:"AccessKeys"`
+	// Buckets limits mirroring to requests to given buckets
+	Buckets []string `yaml:"Buckets"`
+}
@@ -0,0 +1,115 @@
+package mirror
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/mirror/config"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+type mirrorRoundTripper struct {
+	roundTripper http.RoundTripper
+	target       http.RoundTripper
+	percentage   float64
+	accessKeys   map[string]struct{}
+	buckets      map[string]struct{}
+	// sample returns number in [0, 100)
+	sample func() float64
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (mrt *mirrorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if mrt.matches(req) && mrt.sample() < mrt.percentage {
+		mrt.mirror(req)
+	}
+	return mrt.roundTripper.RoundTrip(req)
+}
+
+func (mrt *mirrorRoundTripper) matches(req *http.Request) bool {
+	if len(mrt.accessKeys) > 0 {
+		if _, ok := mrt.accessKeys[utils.ExtractAccessKey(req)]; !ok {
+			return false
+		}
+	}
+	if len(mrt.buckets) > 0 {
+		bucket, _ := utils.SplitBucketKey(req.URL.Path)
+		if _, ok := mrt.buckets[bucket]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mirror sends copy of request to target asynchronously, body copy is read
+// from spool
+func (mrt *mirrorRoundTripper) mirror(req *http.Request) {
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	resetter, resettable := req.Body.(types.Resetter)
+	if !resettable && req.Body != nil && req.Body != http.NoBody {
+		log.Debugf("Request %s not mirrored, body is not spooled", reqID)
+		metrics.Mark("mirror.skipped")
+		return
+	}
+	mirrored := copyRequest(context.WithValue(context.Background(), log.ContextreqIDKey, reqID), req)
+	if resettable {
+		mirrored.Body = resetter.Reset()
+	}
+	metrics.Mark("mirror.sent")
+	go func() {
+		resp, err := mrt.target.RoundTrip(mirrored)
+		if err != nil {
+			log.Printf("Mirrored request %s %s failed: %s", reqID, mirrored.URL.Path, err)
+			metrics.Mark("mirror.err")
+			return
+		}
+		if resp.Body != nil {
+			if err := resp.Body.Close(); err != nil {
+				log.Debugf("Could not close mirrored request %s response body: %s", reqID, err)
+			}
+		}
+	}()
+}
+
+func copyRequest(ctx context.Context, req *http.Request) *http.Request {
+	mirrored := req.WithContext(ctx)
+	mirrored.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		mirrored.Header[name] = append([]string(nil), values...)
+	}
+	mirroredURL := *req.URL
+	mirrored.URL = &mirroredURL
+	return mirrored
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
+
+// Decorator creates httphandler.Decorator sending copy of sampled requests
+// to target shard. Mirrored responses are discarded, they never affect
+// client response
+func Decorator(conf config.Mirroring, target http.RoundTripper) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if target == nil || conf.Percentage <= 0 {
+			return roundTripper
+		}
+		return &mirrorRoundTripper{
+			roundTripper: roundTripper,
+			target:       target,
+			percentage:   conf.Percentage,
+			accessKeys:   toSet(conf.AccessKeys),
+			buckets:      toSet(conf.Buckets),
+			sample:       func() float64 { return rand.Float64() * 100 },
+		}
+	}
+}
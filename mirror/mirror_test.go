@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/mirror/config"
+	"github.com/allegro/akubra/spool"
+	spoolconfig "github.com/allegro/akubra/spool/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	requests chan *http.Request
+	status   int
+}
+
+func newRoundTripperStub(status int) *roundTripperStub {
+	return &roundTripperStub{requests: make(chan *http.Request, 10), status: status}
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rts.requests <- req
+	return &http.Response{StatusCode: rts.status, Request: req, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func s3Request(method, path, accessKey string) *http.Request {
+	req := httptest.NewRequest(method, "http://localhost"+path, nil)
+	if accessKey != "" {
+		req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	}
+	return req
+}
+
+func newMirror(conf config.Mirroring, sample float64) (http.RoundTripper, *roundTripperStub, *roundTripperStub) {
+	primary := newRoundTripperStub(http.StatusOK)
+	target := newRoundTripperStub(http.StatusInternalServerError)
+	mrt := Decorator(conf, target)(primary).(*mirrorRoundTripper)
+	mrt.sample = func() float64 { return sample }
+	return mrt, primary, target
+}
+
+func mirrored(t *testing.T, target *roundTripperStub) *http.Request {
+	select {
+	case req := <-target.requests:
+		return req
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored")
+	}
+	return nil
+}
+
+func TestDecoratorShouldNotWrapWithoutTarget(t *testing.T) {
+	stub := newRoundTripperStub(http.StatusOK)
+	assert.Equal(t, stub, Decorator(config.Mirroring{Percentage: 100}, nil)(stub))
+	assert.Equal(t, stub, Decorator(config.Mirroring{}, newRoundTripperStub(http.StatusOK))(stub))
+}
+
+func TestShouldMirrorSampledRequestsWithoutAffectingResponse(t *testing.T) {
+	mrt, primary, target := newMirror(config.Mirroring{Percentage: 10}, 5)
+	req := s3Request(http.MethodGet, "/bucket/key", "")
+
+	resp, err := mrt.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, req, <-primary.requests)
+	assert.Equal(t, "/bucket/key", mirrored(t, target).URL.Path)
+}
+
+func TestShouldNotMirrorRequestsOutOfSample(t *testing.T) {
+	mrt, _, target := newMirror(config.Mirroring{Percentage: 10}, 10)
+
+	_, err := mrt.RoundTrip(s3Request(http.MethodGet, "/bucket/key", ""))
+
+	require.NoError(t, err)
+	assert.Empty(t, target.requests)
+}
+
+func TestShouldMirrorRequestsOfSelectedAccessKeysAndBuckets(t *testing.T) {
+	mrt, _, target := newMirror(config.Mirroring{Percentage: 100, AccessKeys: []string{"tester"}, Buckets: []string{"bucket"}}, 0)
+
+	for _, req := range []*http.Request{
+		s3Request(http.MethodGet, "/bucket/key", "other"),
+		s3Request(http.MethodGet, "/other/key", "tester"),
+		s3Request(http.MethodGet, "/bucket/key", "tester"),
+	} {
+		_, err := mrt.RoundTrip(req)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "AWS tester:signature", mirrored(t, target).Header.Get("Authorization"))
+	assert.Empty(t, target.requests)
+}
+
+func TestShouldMirrorSpooledBody(t *testing.T) {
+	mrt, primary, target := newMirror(config.Mirroring{Percentage: 100}, 0)
+	body, err := spool.New(spoolconfig.Spooling{}).Spool(strings.NewReader("content"))
+	require.NoError(t, err)
+	req := s3Request(http.MethodPut, "/bucket/key", "")
+	req.Body = body
+
+	_, err = mrt.RoundTrip(req)
+	require.NoError(t, err)
+
+	mirroredBody, err := ioutil.ReadAll(mirrored(t, target).Body)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(mirroredBody))
+	primaryBody, err := ioutil.ReadAll((<-primary.requests).Body)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(primaryBody))
+}
+
+func TestShouldNotMirrorStreamedBody(t *testing.T) {
+	mrt, _, target := newMirror(config.Mirroring{Percentage: 100}, 0)
+	req := s3Request(http.MethodPut, "/bucket/key", "")
+	req.Body = ioutil.NopCloser(strings.NewReader("content"))
+
+	_, err := mrt.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Empty(t, target.requests)
+}
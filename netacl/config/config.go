@@ -0,0 +1,24 @@
+package config
+
+// ACL lists networks in CIDR notation, single addresses are accepted too
+type ACL struct {
+	// Allow lists networks allowed to connect, all if empty
+	Allow []string `yaml:"Allow"`
+	// Deny lists networks denied to connect, it takes precedence over Allow
+	Deny []string `yaml:"Deny"`
+}
+
+// NetworkACL configuration, connections are not filtered if ACL is not defined
+type NetworkACL struct {
+	// Service ACL filters clients of Listen address
+	Service *ACL `yaml:"Service"`
+	// TechnicalEndpoint ACL filters clients of TechnicalEndpointListen address
+	TechnicalEndpoint *ACL `yaml:"TechnicalEndpoint"`
+	// TrustedProxies are networks of balancers in front of service, address
+	// of client is taken from X-Forwarded-For header or PROXY protocol
+	// header of their connections
+	TrustedProxies []string `yaml:"TrustedProxies"`
+	// ProxyProtocol expects PROXY protocol v1 header on each connection of
+	// TrustedProxies to service
+	ProxyProtocol bool `yaml:"ProxyProtocol"`
+}
@@ -0,0 +1,172 @@
+package netacl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/netacl/config"
+)
+
+const (
+	// proxyHeaderTimeout limits wait for PROXY protocol header
+	proxyHeaderTimeout = 5 * time.Second
+	// maxProxyHeaderLength of PROXY protocol v1 header
+	maxProxyHeaderLength = 107
+)
+
+// ErrDenied is returned by connections of clients denied by ACL
+var ErrDenied = errors.New("client denied by network ACL")
+
+type aclListener struct {
+	net.Listener
+	name          string
+	filter        *Filter
+	trusted       Networks
+	proxyProtocol bool
+}
+
+// Listener filters connections of l by acl. Connections of trusted proxies
+// are filtered by client address of PROXY protocol header, if proxyProtocol
+// is set, otherwise they are left to Decorator, which checks address from
+// X-Forwarded-For header
+func Listener(name string, l net.Listener, acl *config.ACL, trustedProxies []string, proxyProtocol bool) (net.Listener, error) {
+	filter, err := NewFilter(acl)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := ParseNetworks(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TrustedProxies network: %s", err)
+	}
+	if filter == nil && !proxyProtocol {
+		return l, nil
+	}
+	return &aclListener{Listener: l, name: name, filter: filter, trusted: trusted, proxyProtocol: proxyProtocol}, nil
+}
+
+// Accept returns next connection of allowed client
+func (al *aclListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := al.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := addrIP(conn.RemoteAddr())
+		if al.trusted.Contains(ip) {
+			if al.proxyProtocol {
+				return &proxyConn{Conn: conn, listener: al}, nil
+			}
+			return conn, nil
+		}
+		if al.filter.Allows(ip) {
+			return conn, nil
+		}
+		al.deny(conn, conn.RemoteAddr())
+	}
+}
+
+func (al *aclListener) deny(conn net.Conn, client net.Addr) {
+	metrics.Mark("netacl." + al.name + ".denied")
+	log.Debugf("Connection of %s to %s listener denied by network ACL", client, al.name)
+	if err := conn.Close(); err != nil {
+		log.Debugf("Cannot close connection of %s: %s", client, err)
+	}
+}
+
+// proxyConn reads PROXY protocol header on first use, connection
+// RemoteAddr is address of client afterwards
+type proxyConn struct {
+	net.Conn
+	listener *aclListener
+	once     sync.Once
+	reader   *bufio.Reader
+	client   net.Addr
+	err      error
+}
+
+func (pc *proxyConn) init() {
+	pc.once.Do(func() {
+		pc.client = pc.Conn.RemoteAddr()
+		pc.reader = bufio.NewReaderSize(pc.Conn, maxProxyHeaderLength)
+		if err := pc.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); err != nil {
+			pc.err = err
+			return
+		}
+		client, err := readProxyHeader(pc.reader)
+		if err == nil {
+			err = pc.SetReadDeadline(time.Time{})
+		}
+		if err != nil {
+			log.Printf("Invalid PROXY protocol header from %s: %s", pc.client, err)
+			pc.err = err
+			_ = pc.Conn.Close()
+			return
+		}
+		if client != nil {
+			pc.client = client
+		}
+		if !pc.listener.filter.Allows(addrIP(pc.client)) {
+			pc.err = ErrDenied
+			pc.listener.deny(pc.Conn, pc.client)
+		}
+	})
+}
+
+// Read implements net.Conn interface
+func (pc *proxyConn) Read(p []byte) (int, error) {
+	pc.init()
+	if pc.err != nil {
+		return 0, pc.err
+	}
+	return pc.reader.Read(p)
+}
+
+// RemoteAddr returns address of client
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.init()
+	return pc.client
+}
+
+// readProxyHeader parses PROXY protocol v1 header, nil address is returned
+// for UNKNOWN protocol
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errors.New("PROXY protocol header expected")
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed header %q", strings.TrimSpace(string(line)))
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("malformed source address in header %q", strings.TrimSpace(string(line)))
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func addrIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
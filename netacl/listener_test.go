@@ -0,0 +1,128 @@
+package netacl
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/netacl/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listenerStub struct {
+	net.Listener
+	conns chan net.Conn
+}
+
+func (ls *listenerStub) Accept() (net.Conn, error) {
+	return <-ls.conns, nil
+}
+
+type connStub struct {
+	net.Conn
+	reader *strings.Reader
+	remote net.Addr
+	closed bool
+}
+
+func newConnStub(remote, data string) *connStub {
+	addr, _ := net.ResolveTCPAddr("tcp", remote)
+	return &connStub{reader: strings.NewReader(data), remote: addr}
+}
+
+func (cs *connStub) Read(p []byte) (int, error) {
+	return cs.reader.Read(p)
+}
+
+func (cs *connStub) RemoteAddr() net.Addr {
+	return cs.remote
+}
+
+func (cs *connStub) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (cs *connStub) Close() error {
+	cs.closed = true
+	return nil
+}
+
+func TestListenerShouldCloseConnectionsOfDeniedClients(t *testing.T) {
+	denied := newConnStub("192.0.2.1:1234", "")
+	allowed := newConnStub("10.0.0.1:1234", "")
+	stub := &listenerStub{conns: make(chan net.Conn, 2)}
+	stub.conns <- denied
+	stub.conns <- allowed
+	listener, err := Listener("test", stub, &config.ACL{Allow: []string{"10.0.0.0/8"}}, nil, false)
+	require.NoError(t, err)
+
+	conn, err := listener.Accept()
+
+	require.NoError(t, err)
+	assert.Equal(t, allowed, conn)
+	assert.True(t, denied.closed)
+}
+
+func TestListenerShouldReplaceRemoteAddrWithProxyProtocolSource(t *testing.T) {
+	stub := &listenerStub{conns: make(chan net.Conn, 1)}
+	stub.conns <- newConnStub("10.0.0.1:1234", "PROXY TCP4 203.0.113.1 10.0.0.1 56324 443\r\nGET / HTTP/1.1\r\n")
+	listener, err := Listener("test", stub, nil, []string{"10.0.0.0/8"}, true)
+	require.NoError(t, err)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(conn)
+
+	require.NoError(t, err)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(data))
+	assert.Equal(t, "203.0.113.1:56324", conn.RemoteAddr().String())
+}
+
+func TestListenerShouldDenyClientFromProxyProtocolHeader(t *testing.T) {
+	proxied := newConnStub("10.0.0.1:1234", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET / HTTP/1.1\r\n")
+	stub := &listenerStub{conns: make(chan net.Conn, 1)}
+	stub.conns <- proxied
+	listener, err := Listener("test", stub, &config.ACL{Deny: []string{"2001:db8::/32"}}, []string{"10.0.0.0/8"}, true)
+	require.NoError(t, err)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 16))
+
+	assert.Equal(t, ErrDenied, err)
+	assert.True(t, proxied.closed)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	testCases := []struct {
+		header   string
+		expected string
+		err      bool
+	}{
+		{"PROXY TCP4 192.0.2.1 10.0.0.1 1234 80\r\n", "192.0.2.1:1234", false},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 1234 80\r\n", "[2001:db8::1]:1234", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{"PROXY TCP4 192.0.2.1 10.0.0.1 1234\r\n", "", true},
+		{"PROXY UDP4 192.0.2.1 10.0.0.1 1234 80\r\n", "", true},
+		{"PROXY TCP4 garbage 10.0.0.1 1234 80\r\n", "", true},
+		{"GET / HTTP/1.1\r\n", "", true},
+		{"PROXY TCP4 192.0.2.1", "", true},
+	}
+	for _, testCase := range testCases {
+		addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(testCase.header)))
+		if testCase.err {
+			assert.Error(t, err, testCase.header)
+			continue
+		}
+		require.NoError(t, err, testCase.header)
+		if testCase.expected == "" {
+			assert.Nil(t, addr)
+		} else {
+			assert.Equal(t, testCase.expected, addr.String())
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package netacl
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/netacl/config"
+	"github.com/allegro/akubra/types"
+)
+
+// Networks is list of IP networks
+type Networks []*net.IPNet
+
+// ParseNetworks parses networks in CIDR notation, single addresses are
+// accepted too
+func ParseNetworks(cidrs []string) (Networks, error) {
+	networks := make(Networks, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Contains reports if ip belongs to any of networks
+func (n Networks) Contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter allows addresses of Allow networks, all if empty, which don't
+// belong to Deny networks
+type Filter struct {
+	allow Networks
+	deny  Networks
+}
+
+// NewFilter creates Filter, nil Filter allows all addresses
+func NewFilter(acl *config.ACL) (*Filter, error) {
+	if acl == nil {
+		return nil, nil
+	}
+	allow, err := ParseNetworks(acl.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Allow network: %s", err)
+	}
+	deny, err := ParseNetworks(acl.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Deny network: %s", err)
+	}
+	return &Filter{allow: allow, deny: deny}, nil
+}
+
+// Allows reports if ip may connect
+func (f *Filter) Allows(ip net.IP) bool {
+	if f == nil {
+		return true
+	}
+	if ip == nil || f.deny.Contains(ip) {
+		return false
+	}
+	return len(f.allow) == 0 || f.allow.Contains(ip)
+}
+
+// ClientIP returns address of client which connected from remoteAddr. If it
+// is address of trusted proxy, X-Forwarded-For entries are checked from the
+// last one, first address which isn't trusted proxy is client address
+func ClientIP(remoteAddr string, forwardedFor []string, trusted Networks) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted.Contains(ip) {
+		return ip
+	}
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		entries := strings.Split(forwardedFor[i], ",")
+		for j := len(entries) - 1; j >= 0; j-- {
+			forwarded := net.ParseIP(strings.TrimSpace(entries[j]))
+			if forwarded == nil {
+				return ip
+			}
+			ip = forwarded
+			if !trusted.Contains(ip) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
+
+type aclRoundTripper struct {
+	roundTripper http.RoundTripper
+	filter       *Filter
+	trusted      Networks
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (art *aclRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ip := ClientIP(req.RemoteAddr, req.Header["X-Forwarded-For"], art.trusted)
+	if ip != nil && ip.String() != types.ClientIP(req) {
+		req = req.WithContext(req.Context())
+		req.RemoteAddr = ip.String()
+	}
+	if !art.filter.Allows(ip) {
+		metrics.Mark("netacl.service.denied")
+		log.Debugf("Request %s of %s denied by network ACL", req.Context().Value(log.ContextreqIDKey), req.RemoteAddr)
+		return types.NewS3ErrorResponseForStatus(req, http.StatusForbidden), nil
+	}
+	return art.roundTripper.RoundTrip(req)
+}
+
+// Decorator creates httphandler.Decorator replacing RemoteAddr of requests
+// forwarded by trusted proxies with client address from X-Forwarded-For
+// header and rejecting requests of clients not allowed by Service ACL
+func Decorator(conf config.NetworkACL) (httphandler.Decorator, error) {
+	filter, err := NewFilter(conf.Service)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := ParseNetworks(conf.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TrustedProxies network: %s", err)
+	}
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if filter == nil && len(trusted) == 0 {
+			return roundTripper
+		}
+		return &aclRoundTripper{roundTripper: roundTripper, filter: filter, trusted: trusted}
+	}, nil
+}
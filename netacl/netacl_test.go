@@ -0,0 +1,101 @@
+package netacl
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/netacl/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	remoteAddrs []string
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rts.remoteAddrs = append(rts.remoteAddrs, req.RemoteAddr)
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func TestFilterShouldAllowNetworksNotDenied(t *testing.T) {
+	filter, err := NewFilter(&config.ACL{Allow: []string{"10.0.0.0/8", "2001:db8::/32"}, Deny: []string{"10.1.0.0/16", "10.2.0.1"}})
+	require.NoError(t, err)
+
+	assert.True(t, filter.Allows(net.ParseIP("10.0.0.1")))
+	assert.True(t, filter.Allows(net.ParseIP("2001:db8::1")))
+	assert.True(t, filter.Allows(net.ParseIP("10.2.0.2")))
+	assert.False(t, filter.Allows(net.ParseIP("10.1.0.1")))
+	assert.False(t, filter.Allows(net.ParseIP("10.2.0.1")))
+	assert.False(t, filter.Allows(net.ParseIP("192.0.2.1")))
+	assert.False(t, filter.Allows(nil))
+}
+
+func TestNilFilterShouldAllowAll(t *testing.T) {
+	filter, err := NewFilter(nil)
+	require.NoError(t, err)
+
+	assert.True(t, filter.Allows(net.ParseIP("192.0.2.1")))
+}
+
+func TestNewFilterShouldRejectInvalidNetworks(t *testing.T) {
+	_, err := NewFilter(&config.ACL{Deny: []string{"10.0.0"}})
+
+	assert.EqualError(t, err, `invalid Deny network: invalid address "10.0.0"`)
+}
+
+func TestClientIPShouldSkipTrustedProxiesInForwardedFor(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1", "10.0.0.3, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"198.51.100.1, garbage"}, "10.0.0.1"},
+	}
+	for _, testCase := range testCases {
+		ip := ClientIP(testCase.remoteAddr, testCase.forwardedFor, trusted)
+		assert.Equal(t, testCase.expected, ip.String(), "%s %v", testCase.remoteAddr, testCase.forwardedFor)
+	}
+}
+
+func TestDecoratorShouldNotWrapWithoutACL(t *testing.T) {
+	stub := &roundTripperStub{}
+	decorator, err := Decorator(config.NetworkACL{TechnicalEndpoint: &config.ACL{}})
+	require.NoError(t, err)
+
+	assert.Equal(t, stub, decorator(stub))
+}
+
+func TestDecoratorShouldRejectDeniedClientsAndRewriteRemoteAddr(t *testing.T) {
+	stub := &roundTripperStub{}
+	decorator, err := Decorator(config.NetworkACL{
+		Service:        &config.ACL{Deny: []string{"198.51.100.0/24"}},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	require.NoError(t, err)
+	roundTripper := decorator(stub)
+
+	statuses := make([]int, 0)
+	for _, forwardedFor := range []string{"203.0.113.1", "198.51.100.1"} {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := roundTripper.RoundTrip(req)
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusForbidden}, statuses)
+	assert.Equal(t, []string{"203.0.113.1"}, stub.remoteAddrs)
+}
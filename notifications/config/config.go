@@ -0,0 +1,56 @@
+package config
+
+import (
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+// Target types
+const (
+	// Webhook target POSTs events as JSON to Endpoint
+	Webhook = "webhook"
+	// KafkaREST target produces events to Kafka topic through REST Proxy
+	KafkaREST = "kafka-rest"
+	// SQS target sends events to SQS compatible queue
+	SQS = "sqs"
+)
+
+// Event names filters may match
+const (
+	ObjectCreated = "ObjectCreated"
+	ObjectRemoved = "ObjectRemoved"
+)
+
+// Notifications configuration, events are not emitted if Targets are empty
+type Notifications struct {
+	// QueueSize is number of events waiting for delivery, events are dropped
+	// if queue is full, default: 1000
+	QueueSize int `yaml:"QueueSize"`
+	// Targets events are published to
+	Targets []Target `yaml:"Targets"`
+}
+
+// Target publishes events of writes matching its filters
+type Target struct {
+	Name string `yaml:"Name"`
+	// Type of target: "webhook", "kafka-rest" or "sqs"
+	Type string `yaml:"Type"`
+	// Endpoint of webhook, Kafka REST Proxy or URL of SQS queue
+	Endpoint types.YAMLUrl `yaml:"Endpoint"`
+	// Topic events are produced to by kafka-rest target
+	Topic string `yaml:"Topic"`
+	// Region, AccessKey and Secret sign requests of sqs target, requests
+	// are not signed if AccessKey is empty
+	Region    string `yaml:"Region"`
+	AccessKey string `yaml:"AccessKey"`
+	Secret    string `yaml:"Secret"`
+	// Timeout of delivery, default: 10s
+	Timeout metrics.Interval `yaml:"Timeout"`
+	// Events published: "ObjectCreated", "ObjectRemoved", all if empty
+	Events []string `yaml:"Events,omitempty"`
+	// Buckets events are published for, all if empty
+	Buckets []string `yaml:"Buckets,omitempty"`
+	// Prefix and Suffix of keys events are published for
+	Prefix string `yaml:"Prefix,omitempty"`
+	Suffix string `yaml:"Suffix,omitempty"`
+}
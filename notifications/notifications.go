@@ -0,0 +1,256 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/notifications/config"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	defaultQueueSize = 1000
+	defaultTimeout   = 10 * time.Second
+)
+
+// Identity of request author
+type Identity struct {
+	PrincipalID string `json:"principalId"`
+}
+
+// Bucket of event
+type Bucket struct {
+	Name string `json:"name"`
+}
+
+// Object of event, Key is URL encoded
+type Object struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size,omitempty"`
+	ETag      string `json:"eTag,omitempty"`
+	VersionID string `json:"versionId,omitempty"`
+	Sequencer string `json:"sequencer"`
+}
+
+// Entity describes object event concerns
+type Entity struct {
+	SchemaVersion   string `json:"s3SchemaVersion"`
+	ConfigurationID string `json:"configurationId"`
+	Bucket          Bucket `json:"bucket"`
+	Object          Object `json:"object"`
+}
+
+// Event is S3 event notification record
+type Event struct {
+	EventVersion     string            `json:"eventVersion"`
+	EventSource      string            `json:"eventSource"`
+	EventTime        string            `json:"eventTime"`
+	EventName        string            `json:"eventName"`
+	UserIdentity     Identity          `json:"userIdentity"`
+	ResponseElements map[string]string `json:"responseElements"`
+	S3               Entity            `json:"s3"`
+	key              string
+}
+
+// Message is body of published notification
+type Message struct {
+	Records []Event `json:"Records"`
+}
+
+// publisher delivers message to target
+type publisher interface {
+	publish(event Event, body []byte) error
+}
+
+// target delivers queued events matching its filters
+type target struct {
+	conf      config.Target
+	queue     chan Event
+	publisher publisher
+}
+
+// matches reports if event of object should be published to target
+func (t *target) matches(event Event) bool {
+	if len(t.conf.Events) > 0 && !contains(t.conf.Events, strings.SplitN(event.EventName, ":", 2)[0]) {
+		return false
+	}
+	if len(t.conf.Buckets) > 0 && !contains(t.conf.Buckets, event.S3.Bucket.Name) {
+		return false
+	}
+	return strings.HasPrefix(event.key, t.conf.Prefix) && strings.HasSuffix(event.key, t.conf.Suffix)
+}
+
+func (t *target) deliver(event Event) {
+	event.S3.ConfigurationID = t.conf.Name
+	body, err := json.Marshal(Message{Records: []Event{event}})
+	if err == nil {
+		err = t.publisher.publish(event, body)
+	}
+	if err != nil {
+		metrics.Mark("notifications." + metrics.Clean(t.conf.Name) + ".failure")
+		log.Printf("Event %s of %s/%s not published to %s: %s", event.EventName, event.S3.Bucket.Name, event.key, t.conf.Name, err)
+		return
+	}
+	metrics.Mark("notifications." + metrics.Clean(t.conf.Name) + ".success")
+}
+
+// Notifier publishes events of successful object writes and deletes, each
+// target has own queue, so slow target doesn't delay others
+type Notifier struct {
+	targets []*target
+	stopped sync.WaitGroup
+}
+
+// New creates Notifier, it returns nil if no targets are configured
+func New(conf config.Notifications) (*Notifier, error) {
+	if len(conf.Targets) == 0 {
+		return nil, nil
+	}
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	notifier := &Notifier{}
+	for _, targetConf := range conf.Targets {
+		publisher, err := newPublisher(targetConf)
+		if err != nil {
+			return nil, fmt.Errorf("notification target %q: %s", targetConf.Name, err)
+		}
+		notifier.targets = append(notifier.targets, &target{conf: targetConf, queue: make(chan Event, queueSize), publisher: publisher})
+	}
+	return notifier, nil
+}
+
+// Start delivers queued events until Stop is called
+func (n *Notifier) Start() {
+	for _, t := range n.targets {
+		n.stopped.Add(1)
+		go func(t *target) {
+			defer n.stopped.Done()
+			for event := range t.queue {
+				t.deliver(event)
+			}
+		}(t)
+	}
+}
+
+// Stop delivers events queued so far, events can't be emitted afterwards
+func (n *Notifier) Stop() {
+	for _, t := range n.targets {
+		close(t.queue)
+	}
+	n.stopped.Wait()
+}
+
+// Emit queues event for targets it matches, it's dropped for targets which
+// queue is full
+func (n *Notifier) Emit(event Event) {
+	for _, t := range n.targets {
+		if !t.matches(event) {
+			continue
+		}
+		select {
+		case t.queue <- event:
+		default:
+			metrics.Mark("notifications." + metrics.Clean(t.conf.Name) + ".dropped")
+		}
+	}
+}
+
+// eventName names event of successful request, it returns false for
+// requests not changing objects
+func eventName(req *http.Request) (string, bool) {
+	if _, key := utils.SplitBucketKey(req.URL.Path); key == "" {
+		return "", false
+	}
+	_, hasUploadID := req.URL.Query()["uploadId"]
+	switch {
+	case req.Method == http.MethodPut && req.URL.RawQuery == "" && req.Header.Get("X-Amz-Copy-Source") != "":
+		return config.ObjectCreated + ":Copy", true
+	case req.Method == http.MethodPut && req.URL.RawQuery == "":
+		return config.ObjectCreated + ":Put", true
+	case req.Method == http.MethodPost && hasUploadID:
+		return config.ObjectCreated + ":CompleteMultipartUpload", true
+	case req.Method == http.MethodDelete && req.URL.RawQuery == "":
+		return config.ObjectRemoved + ":Delete", true
+	}
+	return "", false
+}
+
+// newEvent creates event of request answered with resp
+func newEvent(name string, req *http.Request, resp *http.Response, now time.Time) Event {
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	object := Object{
+		Key:       url.QueryEscape(key),
+		ETag:      strings.Trim(resp.Header.Get("ETag"), `"`),
+		VersionID: resp.Header.Get("X-Amz-Version-Id"),
+		Sequencer: fmt.Sprintf("%016X", now.UnixNano()),
+	}
+	if req.Method == http.MethodPut && req.Header.Get("X-Amz-Copy-Source") == "" {
+		object.Size = req.ContentLength
+		if decoded, err := strconv.ParseInt(req.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+			object.Size = decoded
+		}
+	}
+	return Event{
+		EventVersion:     "2.1",
+		EventSource:      "aws:s3",
+		EventTime:        now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		EventName:        name,
+		UserIdentity:     Identity{PrincipalID: utils.ExtractAccessKey(req)},
+		ResponseElements: map[string]string{"x-amz-request-id": utils.RequestID(req)},
+		S3: Entity{
+			SchemaVersion: "1.0",
+			Bucket:        Bucket{Name: bucket},
+			Object:        object,
+		},
+		key: key,
+	}
+}
+
+type notifyingRoundTripper struct {
+	roundTripper http.RoundTripper
+	notifier     *Notifier
+	now          func() time.Time
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (nrt *notifyingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := nrt.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, err
+	}
+	if name, ok := eventName(req); ok {
+		nrt.notifier.Emit(newEvent(name, req, resp, nrt.now()))
+	}
+	return resp, err
+}
+
+// Decorator creates httphandler.Decorator emitting events of successful
+// object writes and deletes
+func Decorator(notifier *Notifier) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if notifier == nil {
+			return roundTripper
+		}
+		return &notifyingRoundTripper{roundTripper: roundTripper, notifier: notifier, now: time.Now}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
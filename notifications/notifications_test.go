@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/notifications/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+type roundTripperStub struct {
+	status int
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	return &http.Response{StatusCode: rts.status, Header: header, Request: req}, nil
+}
+
+type publisherStub struct {
+	bodies [][]byte
+}
+
+func (ps *publisherStub) publish(_ Event, body []byte) error {
+	ps.bodies = append(ps.bodies, body)
+	return nil
+}
+
+func newNotifyingRoundTripper(status int, targets ...config.Target) (http.RoundTripper, map[string]*publisherStub) {
+	notifier := &Notifier{}
+	publishers := make(map[string]*publisherStub)
+	for _, targetConf := range targets {
+		publishers[targetConf.Name] = &publisherStub{}
+		notifier.targets = append(notifier.targets, &target{conf: targetConf, queue: make(chan Event, 10), publisher: publishers[targetConf.Name]})
+	}
+	notifier.Start()
+	rt := Decorator(notifier)(&roundTripperStub{status: status})
+	rt.(*notifyingRoundTripper).now = func() time.Time { return now }
+	return &stoppingRoundTripper{RoundTripper: rt, notifier: notifier}, publishers
+}
+
+// stoppingRoundTripper lets tests flush queues before assertions
+type stoppingRoundTripper struct {
+	http.RoundTripper
+	notifier *Notifier
+}
+
+func do(t *testing.T, rt http.RoundTripper, method, path string) {
+	req := httptest.NewRequest(method, "http://localhost"+path, strings.NewReader("body"))
+	_, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+}
+
+func TestShouldPublishEventsOfObjectWritesAndDeletesMatchingFilters(t *testing.T) {
+	rt, publishers := newNotifyingRoundTripper(http.StatusOK,
+		config.Target{Name: "all"},
+		config.Target{Name: "images", Buckets: []string{"images"}, Prefix: "public/", Suffix: ".png", Events: []string{config.ObjectCreated}})
+
+	do(t, rt, http.MethodPut, "/images/public/a%20b.png")
+	do(t, rt, http.MethodPut, "/images/public/a.jpg")
+	do(t, rt, http.MethodDelete, "/images/public/a.png")
+	do(t, rt, http.MethodPut, "/images/public/a.png?acl")
+	do(t, rt, http.MethodPut, "/images")
+	rt.(*stoppingRoundTripper).notifier.Stop()
+
+	require.Len(t, publishers["all"].bodies, 3)
+	require.Len(t, publishers["images"].bodies, 1)
+	message := Message{}
+	require.NoError(t, json.Unmarshal(publishers["images"].bodies[0], &message))
+	require.Len(t, message.Records, 1)
+	event := message.Records[0]
+	assert.Equal(t, "ObjectCreated:Put", event.EventName)
+	assert.Equal(t, "2018-01-02T03:04:05.000Z", event.EventTime)
+	assert.Equal(t, "images", event.S3.ConfigurationID)
+	assert.Equal(t, "images", event.S3.Bucket.Name)
+	assert.Equal(t, "public%2Fa+b.png", event.S3.Object.Key)
+	assert.Equal(t, int64(4), event.S3.Object.Size)
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", event.S3.Object.ETag)
+	assert.Contains(t, string(publishers["all"].bodies[2]), `"eventName":"ObjectRemoved:Delete"`)
+}
+
+func TestShouldNotPublishEventsOfFailedRequests(t *testing.T) {
+	rt, publishers := newNotifyingRoundTripper(http.StatusServiceUnavailable, config.Target{Name: "all"})
+
+	do(t, rt, http.MethodPut, "/images/a.png")
+	rt.(*stoppingRoundTripper).notifier.Stop()
+
+	assert.Empty(t, publishers["all"].bodies)
+}
+
+func TestShouldDropEventsIfQueueIsFull(t *testing.T) {
+	publisher := &publisherStub{}
+	notifier := &Notifier{targets: []*target{{conf: config.Target{Name: "slow"}, queue: make(chan Event, 1), publisher: publisher}}}
+	rt := Decorator(notifier)(&roundTripperStub{status: http.StatusOK})
+
+	do(t, rt, http.MethodPut, "/images/a.png")
+	do(t, rt, http.MethodPut, "/images/b.png")
+	notifier.Start()
+	notifier.Stop()
+
+	require.Len(t, publisher.bodies, 1)
+	assert.Contains(t, string(publisher.bodies[0]), `"key":"a.png"`)
+}
+
+func TestSQSPublisherShouldSendSignedMessage(t *testing.T) {
+	var req *http.Request
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		form, err = url.ParseQuery(string(body))
+		require.NoError(t, err)
+		req = r
+	}))
+	defer server.Close()
+	endpoint, err := url.Parse(server.URL + "/123456789012/events")
+	require.NoError(t, err)
+	p, err := newPublisher(config.Target{Name: "queue", Type: config.SQS, Endpoint: types.YAMLUrl{URL: endpoint},
+		Region: "eu-west-1", AccessKey: "AKIAEXAMPLE", Secret: "secret"})
+	require.NoError(t, err)
+	p.(*sqsPublisher).now = func() time.Time { return now }
+
+	require.NoError(t, p.publish(Event{}, []byte(`{"Records":[]}`)))
+
+	assert.Equal(t, "/123456789012/events", req.URL.Path)
+	assert.Equal(t, "SendMessage", form.Get("Action"))
+	assert.Equal(t, `{"Records":[]}`, form.Get("MessageBody"))
+	assert.Equal(t, "20180102T030405Z", req.Header.Get("X-Amz-Date"))
+	assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/20180102/eu-west-1/sqs/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature="))
+}
+
+func TestKafkaRESTPublisherShouldFailOnErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/events", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	endpoint, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	p, err := newPublisher(config.Target{Name: "kafka", Type: config.KafkaREST, Endpoint: types.YAMLUrl{URL: endpoint}, Topic: "events"})
+	require.NoError(t, err)
+
+	assert.EqualError(t, p.publish(Event{key: "a.png"}, []byte(`{}`)), "target responded with status 500: ")
+}
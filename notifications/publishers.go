@@ -0,0 +1,168 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/notifications/config"
+)
+
+func newPublisher(conf config.Target) (publisher, error) {
+	if conf.Endpoint.URL == nil {
+		return nil, errors.New("no Endpoint defined")
+	}
+	timeout := conf.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	switch conf.Type {
+	case config.Webhook:
+		return &webhookPublisher{client: client, url: conf.Endpoint.String()}, nil
+	case config.KafkaREST:
+		if conf.Topic == "" {
+			return nil, errors.New("no Topic defined")
+		}
+		topicURL := strings.TrimSuffix(conf.Endpoint.String(), "/") + "/topics/" + conf.Topic
+		return &kafkaRESTPublisher{client: client, url: topicURL}, nil
+	case config.SQS:
+		return &sqsPublisher{client: client, url: conf.Endpoint.String(), region: conf.Region,
+			accessKey: conf.AccessKey, secret: conf.Secret, now: time.Now}, nil
+	}
+	return nil, fmt.Errorf("unsupported notification target Type %q", conf.Type)
+}
+
+// webhookPublisher POSTs message to URL
+type webhookPublisher struct {
+	client *http.Client
+	url    string
+}
+
+func (wp *webhookPublisher) publish(_ Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, wp.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(wp.client, req)
+}
+
+// kafkaRESTPublisher produces messages keyed by bucket and key with Kafka
+// REST Proxy v2 API
+type kafkaRESTPublisher struct {
+	client *http.Client
+	url    string
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (kp *kafkaRESTPublisher) publish(event Event, body []byte) error {
+	payload, err := json.Marshal(struct {
+		Records []kafkaRecord `json:"records"`
+	}{[]kafkaRecord{{Key: event.S3.Bucket.Name + "/" + event.key, Value: body}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, kp.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	return send(kp.client, req)
+}
+
+// sqsPublisher sends messages with SendMessage action of SQS query API,
+// requests are signed with V4 signature if access key is set
+type sqsPublisher struct {
+	client    *http.Client
+	url       string
+	region    string
+	accessKey string
+	secret    string
+	now       func() time.Time
+}
+
+func (sp *sqsPublisher) publish(_ Event, body []byte) error {
+	form := url.Values{}
+	form.Set("Action", "SendMessage")
+	form.Set("Version", "2012-11-05")
+	form.Set("MessageBody", string(body))
+	payload := []byte(form.Encode())
+	req, err := http.NewRequest(http.MethodPost, sp.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if sp.accessKey != "" {
+		sp.sign(req, payload)
+	}
+	return send(sp.client, req)
+}
+
+// sign adds V4 signature of sqs service to request
+func (sp *sqsPublisher) sign(req *http.Request, payload []byte) {
+	now := sp.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type") + "\nhost:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n",
+		"content-type;host;x-amz-date",
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + sp.region + "/sqs/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := []byte("AWS4" + sp.secret)
+	for _, part := range []string{date, sp.region, "sqs", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=content-type;host;x-amz-date, Signature=%s",
+		sp.accessKey, scope, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// send makes request and expects 2xx response
+func send(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Debugf("Cannot close notification response body: %s", closeErr)
+		}
+	}()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("target responded with status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
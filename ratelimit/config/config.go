@@ -0,0 +1,26 @@
+package config
+
+// Limit defines token bucket parameters
+type Limit struct {
+	// Rate is number of requests per second
+	Rate float64 `yaml:"Rate"`
+	// Burst is number of requests allowed over Rate at once
+	Burst int `yaml:"Burst"`
+}
+
+// RateLimits configuration, limits are not applied if not defined
+type RateLimits struct {
+	// Global limits all requests
+	Global *Limit `yaml:"Global"`
+	// PerAccessKey is default limit for each access key
+	PerAccessKey *Limit `yaml:"PerAccessKey"`
+	// PerBucket is default limit for each bucket
+	PerBucket *Limit `yaml:"PerBucket"`
+	// PerClientIP is limit for each client address, behind trusted proxies
+	// it's address from X-Forwarded-For header or PROXY protocol
+	PerClientIP *Limit `yaml:"PerClientIP"`
+	// AccessKeys overrides PerAccessKey for given access keys
+	AccessKeys map[string]Limit `yaml:"AccessKeys"`
+	// Buckets overrides PerBucket for given buckets
+	Buckets map[string]Limit `yaml:"Buckets"`
+}
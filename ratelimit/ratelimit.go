@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/ratelimit/config"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	// maxTrackedKeys triggers removal of idle buckets
+	maxTrackedKeys = 10000
+	// evictedKeys is number of least recently used buckets removed if there
+	// are too many buckets in use
+	evictedKeys = maxTrackedKeys / 10
+)
+
+type tokenBucket struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// used is time of the last take
+	used time.Time
+}
+
+func newTokenBucket(limit config.Limit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: now, used: now}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// take consumes single token if available
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+	tb.refill(now)
+	tb.used = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// refund returns token taken by request rejected by another limit
+func (tb *tokenBucket) refund() {
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+	if tb.tokens++; tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+}
+
+func (tb *tokenBucket) lastUse() time.Time {
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+	return tb.used
+}
+
+// full reports if bucket is in the same state as a new one
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.mx.Lock()
+	defer tb.mx.Unlock()
+	tb.refill(now)
+	return tb.tokens >= tb.burst
+}
+
+// keyedBuckets keeps token bucket per key
+type keyedBuckets struct {
+	mx           sync.Mutex
+	defaultLimit *config.Limit
+	limits       map[string]config.Limit
+	buckets      map[string]*tokenBucket
+}
+
+func newKeyedBuckets(defaultLimit *config.Limit, limits map[string]config.Limit) *keyedBuckets {
+	return &keyedBuckets{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		buckets:      make(map[string]*tokenBucket),
+	}
+}
+
+// bucket returns token bucket of key, nil if key isn't limited
+func (kb *keyedBuckets) bucket(key string, now time.Time) *tokenBucket {
+	if key == "" {
+		return nil
+	}
+	kb.mx.Lock()
+	defer kb.mx.Unlock()
+	if bucket, ok := kb.buckets[key]; ok {
+		return bucket
+	}
+	limit, ok := kb.limits[key]
+	if !ok {
+		if kb.defaultLimit == nil {
+			return nil
+		}
+		limit = *kb.defaultLimit
+	}
+	if len(kb.buckets) >= maxTrackedKeys {
+		kb.removeFull(now)
+	}
+	if len(kb.buckets) >= maxTrackedKeys {
+		kb.removeLeastRecentlyUsed()
+	}
+	bucket := newTokenBucket(limit, now)
+	kb.buckets[key] = bucket
+	return bucket
+}
+
+// removeFull drops buckets which would be recreated in the same state
+func (kb *keyedBuckets) removeFull(now time.Time) {
+	for key, bucket := range kb.buckets {
+		if bucket.full(now) {
+			delete(kb.buckets, key)
+		}
+	}
+}
+
+// removeLeastRecentlyUsed bounds number of buckets when keys, which are
+// supplied by clients, are used faster than their buckets refill
+func (kb *keyedBuckets) removeLeastRecentlyUsed() {
+	keys := make([]string, 0, len(kb.buckets))
+	lastUse := make(map[string]time.Time, len(kb.buckets))
+	for key, bucket := range kb.buckets {
+		keys = append(keys, key)
+		lastUse[key] = bucket.lastUse()
+	}
+	sort.Slice(keys, func(i, j int) bool { return lastUse[keys[i]].Before(lastUse[keys[j]]) })
+	for _, key := range keys[:len(keys)-maxTrackedKeys+evictedKeys] {
+		delete(kb.buckets, key)
+	}
+}
+
+type rateLimitRoundTripper struct {
+	roundTripper http.RoundTripper
+	global       *tokenBucket
+	accessKeys   *keyedBuckets
+	buckets      *keyedBuckets
+	clientIPs    *keyedBuckets
+	now          func() time.Time
+}
+
+type namedBucket struct {
+	name   string
+	bucket *tokenBucket
+}
+
+// RoundTrip implements http.RoundTripper interface. Request takes token of
+// each limit applied to it, or none of them if any limit is exceeded
+func (rl *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	now := rl.now()
+	bucket, _ := utils.SplitBucketKey(req.URL.Path)
+	limits := []namedBucket{
+		{"global", rl.global},
+		{"access_key", rl.accessKeys.bucket(utils.ExtractAccessKey(req), now)},
+		{"bucket", rl.buckets.bucket(bucket, now)},
+		{"client_ip", rl.clientIPs.bucket(types.ClientIP(req), now)},
+	}
+	taken := make([]*tokenBucket, 0, len(limits))
+	for _, limit := range limits {
+		if limit.bucket == nil {
+			continue
+		}
+		if !limit.bucket.take(now) {
+			for _, tokenBucket := range taken {
+				tokenBucket.refund()
+			}
+			return rl.slowDown(req, limit.name)
+		}
+		taken = append(taken, limit.bucket)
+	}
+	return rl.roundTripper.RoundTrip(req)
+}
+
+func (rl *rateLimitRoundTripper) slowDown(req *http.Request, limitName string) (*http.Response, error) {
+	metrics.Mark("ratelimit." + limitName + ".rejected")
+	log.Debugf("Request %s rejected by %s rate limit", req.Context().Value(log.ContextreqIDKey), limitName)
+	return types.NewS3ErrorResponse(req, http.StatusServiceUnavailable, types.S3ErrSlowDown, "Please reduce your request rate."), nil
+}
+
+// Decorator creates httphandler.Decorator limiting requests rate with token
+// buckets, exceeding requests get 503 SlowDown response
+func Decorator(conf config.RateLimits) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if conf.Global == nil && conf.PerAccessKey == nil && conf.PerBucket == nil && conf.PerClientIP == nil &&
+			len(conf.AccessKeys) == 0 && len(conf.Buckets) == 0 {
+			return roundTripper
+		}
+		rl := &rateLimitRoundTripper{
+			roundTripper: roundTripper,
+			accessKeys:   newKeyedBuckets(conf.PerAccessKey, conf.AccessKeys),
+			buckets:      newKeyedBuckets(conf.PerBucket, conf.Buckets),
+			clientIPs:    newKeyedBuckets(conf.PerClientIP, nil),
+			now:          time.Now,
+		}
+		if conf.Global != nil {
+			rl.global = newTokenBucket(*conf.Global, rl.now())
+		}
+		return rl
+	}
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/ratelimit/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	calls int
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rts.calls++
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+type clock struct {
+	current time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.current
+}
+
+func newLimitedRoundTripper(conf config.RateLimits) (*rateLimitRoundTripper, *roundTripperStub, *clock) {
+	stub := &roundTripperStub{}
+	testClock := &clock{current: time.Now()}
+	rl := Decorator(conf)(stub).(*rateLimitRoundTripper)
+	rl.now = testClock.now
+	if conf.Global != nil {
+		rl.global = newTokenBucket(*conf.Global, testClock.now())
+	}
+	return rl, stub, testClock
+}
+
+func s3Request(host, path, accessKey string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	if accessKey != "" {
+		req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	}
+	return req
+}
+
+func TestDecoratorShouldNotWrapWithoutLimits(t *testing.T) {
+	stub := &roundTripperStub{}
+	assert.Equal(t, stub, Decorator(config.RateLimits{})(stub))
+}
+
+func TestShouldRejectRequestsOverGlobalLimitWithSlowDown(t *testing.T) {
+	rl, stub, testClock := newLimitedRoundTripper(config.RateLimits{Global: &config.Limit{Rate: 1, Burst: 2}})
+
+	for i := 0; i < 2; i++ {
+		resp, err := rl.RoundTrip(s3Request("localhost", "/bucket/key", ""))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp, err := rl.RoundTrip(s3Request("localhost", "/bucket/key", ""))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 2, stub.calls)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	s3Error := types.S3Error{}
+	require.NoError(t, xml.Unmarshal(body, &s3Error))
+	assert.Equal(t, "SlowDown", s3Error.Code)
+	assert.Equal(t, "/bucket/key", s3Error.Resource)
+
+	testClock.current = testClock.current.Add(time.Second)
+	resp, err = rl.RoundTrip(s3Request("localhost", "/bucket/key", ""))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestShouldLimitEachAccessKeySeparately(t *testing.T) {
+	rl, stub, _ := newLimitedRoundTripper(config.RateLimits{
+		PerAccessKey: &config.Limit{Rate: 1, Burst: 1},
+		AccessKeys:   map[string]config.Limit{"vip": {Rate: 1, Burst: 2}},
+	})
+
+	statuses := make([]int, 0)
+	for _, accessKey := range []string{"first", "first", "second", "vip", "vip", "vip", "", ""} {
+		resp, err := rl.RoundTrip(s3Request("localhost", "/bucket/key", accessKey))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{200, 503, 200, 200, 200, 503, 200, 200}, statuses)
+	assert.Equal(t, 6, stub.calls)
+}
+
+func TestShouldLimitEachClientIPSeparately(t *testing.T) {
+	rl, stub, _ := newLimitedRoundTripper(config.RateLimits{PerClientIP: &config.Limit{Rate: 1, Burst: 1}})
+
+	statuses := make([]int, 0)
+	for _, remoteAddr := range []string{"192.0.2.1:1234", "192.0.2.1:1235", "192.0.2.2:1234", "[2001:db8::1]:80"} {
+		req := s3Request("localhost", "/bucket/key", "")
+		req.RemoteAddr = remoteAddr
+		resp, err := rl.RoundTrip(req)
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{200, 503, 200, 200}, statuses)
+	assert.Equal(t, 3, stub.calls)
+}
+
+func TestShouldLimitBucketsFromPathAndHost(t *testing.T) {
+	rl, _, _ := newLimitedRoundTripper(config.RateLimits{
+		Buckets: map[string]config.Limit{"hot": {Rate: 1, Burst: 1}},
+	})
+
+	statuses := make([]int, 0)
+	for _, req := range []*http.Request{
+		s3Request("localhost", "/hot/key", ""),
+		types.ToPathStyle(s3Request("hot.s3.localhost", "/key", ""),
+			types.VirtualHost{Host: "hot.s3.localhost", Bucket: "hot"}, "s3.localhost"),
+		s3Request("localhost", "/cold/key", ""),
+		s3Request("localhost", "/cold/key", ""),
+	} {
+		resp, err := rl.RoundTrip(req)
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{200, 503, 200, 200}, statuses)
+}
+
+func TestKeyedBucketsShouldRemoveFullBuckets(t *testing.T) {
+	now := time.Now()
+	kb := newKeyedBuckets(&config.Limit{Rate: 1, Burst: 1}, nil)
+	for i := 0; i < maxTrackedKeys; i++ {
+		kb.buckets[string(rune(i))] = newTokenBucket(config.Limit{Rate: 1, Burst: 1}, now)
+	}
+	require.NotNil(t, kb.bucket("used", now))
+
+	assert.Len(t, kb.buckets, 1)
+}
+
+func TestKeyedBucketsShouldRemoveLeastRecentlyUsedBucketsOfUnlimitedKeys(t *testing.T) {
+	now := time.Now()
+	limit := config.Limit{Rate: 0.001, Burst: 1}
+	kb := newKeyedBuckets(&limit, nil)
+	for i := 0; i < maxTrackedKeys; i++ {
+		bucket := newTokenBucket(limit, now.Add(time.Duration(i)*time.Millisecond))
+		require.True(t, bucket.take(bucket.last))
+		kb.buckets[string(rune(i))] = bucket
+	}
+
+	require.NotNil(t, kb.bucket("new", now.Add(maxTrackedKeys*time.Millisecond)))
+
+	assert.Len(t, kb.buckets, maxTrackedKeys-evictedKeys+1)
+	assert.NotContains(t, kb.buckets, string(rune(evictedKeys-1)))
+	assert.Contains(t, kb.buckets, string(rune(evictedKeys)))
+}
+
+func TestRequestRejectedByLimitShouldNotTakeTokensOfOtherLimits(t *testing.T) {
+	rl, stub, _ := newLimitedRoundTripper(config.RateLimits{
+		Global:  &config.Limit{Rate: 1, Burst: 2},
+		Buckets: map[string]config.Limit{"hot": {Rate: 1, Burst: 1}},
+	})
+
+	statuses := make([]int, 0)
+	for _, path := range []string{"/hot/key", "/hot/key", "/hot/key", "/cold/key", "/cold/key"} {
+		resp, err := rl.RoundTrip(s3Request("localhost", path, ""))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{200, 503, 503, 200, 503}, statuses)
+	assert.Equal(t, 2, stub.calls)
+}
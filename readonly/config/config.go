@@ -0,0 +1,12 @@
+package config
+
+// ReadOnly configuration, mutating requests of all clients are rejected if
+// Enabled, otherwise only requests of listed AccessKeys
+type ReadOnly struct {
+	// Enabled puts whole proxy into read only mode
+	Enabled bool `yaml:"Enabled" json:"Enabled"`
+	// AccessKeys put into read only mode
+	AccessKeys []string `yaml:"AccessKeys" json:"AccessKeys"`
+	// Message of S3 error response, explaining rejection
+	Message string `yaml:"Message" json:"Message"`
+}
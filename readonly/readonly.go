@@ -0,0 +1,122 @@
+package readonly
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/allegro/akubra/audit"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/readonly/config"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// defaultMessage of S3 error response
+const defaultMessage = "Service is in read only mode due to storage maintenance, please retry later."
+
+// Mode keeps read only state, which may be changed at runtime
+type Mode struct {
+	mx         sync.RWMutex
+	enabled    bool
+	accessKeys map[string]struct{}
+	message    string
+}
+
+// New creates Mode with configured state
+func New(conf config.ReadOnly) *Mode {
+	mode := &Mode{}
+	mode.Set(conf)
+	return mode
+}
+
+// Set replaces state
+func (m *Mode) Set(conf config.ReadOnly) {
+	accessKeys := make(map[string]struct{}, len(conf.AccessKeys))
+	for _, accessKey := range conf.AccessKeys {
+		accessKeys[accessKey] = struct{}{}
+	}
+	message := conf.Message
+	if message == "" {
+		message = defaultMessage
+	}
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.enabled, m.accessKeys, m.message = conf.Enabled, accessKeys, message
+}
+
+// State returns current state
+func (m *Mode) State() config.ReadOnly {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	accessKeys := make([]string, 0, len(m.accessKeys))
+	for accessKey := range m.accessKeys {
+		accessKeys = append(accessKeys, accessKey)
+	}
+	sort.Strings(accessKeys)
+	return config.ReadOnly{Enabled: m.enabled, AccessKeys: accessKeys, Message: m.message}
+}
+
+// rejects reports if mutations of access key are rejected, with message
+// explaining why
+func (m *Mode) rejects(accessKey string) (bool, string) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+	if m.enabled {
+		return true, m.message
+	}
+	_, listed := m.accessKeys[accessKey]
+	return listed && accessKey != "", m.message
+}
+
+// ServeHTTP shows state on GET and replaces it with JSON body of PUT
+func (m *Mode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		state := config.ReadOnly{}
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("Cannot decode read only state: %s", err), http.StatusBadRequest)
+			return
+		}
+		m.Set(state)
+		log.Printf("Read only state changed: enabled %t, access keys %q", state.Enabled, state.AccessKeys)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.State()); err != nil {
+		log.Printf("Cannot write read only state: %s", err)
+	}
+}
+
+type readOnlyRoundTripper struct {
+	roundTripper http.RoundTripper
+	mode         *Mode
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (ro *readOnlyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !audit.IsMutation(req) {
+		return ro.roundTripper.RoundTrip(req)
+	}
+	if rejected, message := ro.mode.rejects(utils.ExtractAccessKey(req)); rejected {
+		metrics.Mark("readonly.rejected")
+		log.Debugf("Request %s rejected in read only mode", utils.RequestID(req))
+		return types.NewS3ErrorResponse(req, http.StatusServiceUnavailable, types.S3ErrServiceUnavailable, message), nil
+	}
+	return ro.roundTripper.RoundTrip(req)
+}
+
+// Decorator creates httphandler.Decorator rejecting mutating requests with
+// 503 ServiceUnavailable response while mode is enabled for their client
+func Decorator(mode *Mode) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return &readOnlyRoundTripper{roundTripper: roundTripper, mode: mode}
+	}
+}
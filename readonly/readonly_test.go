@@ -0,0 +1,84 @@
+package readonly
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/readonly/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperStub struct {
+	calls int
+}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	rts.calls++
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func s3Request(method, accessKey string) *http.Request {
+	req := httptest.NewRequest(method, "http://localhost/bucket/key", nil)
+	if accessKey != "" {
+		req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	}
+	return req
+}
+
+func TestShouldRejectMutationsOfAllClientsWhenEnabled(t *testing.T) {
+	stub := &roundTripperStub{}
+	roundTripper := Decorator(New(config.ReadOnly{Enabled: true, Message: "Maintenance until 10:00"}))(stub)
+
+	statuses := make([]int, 0)
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPost, http.MethodDelete} {
+		resp, err := roundTripper.RoundTrip(s3Request(method, "tenant"))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), "<Code>ServiceUnavailable</Code><Message>Maintenance until 10:00</Message>")
+		}
+	}
+
+	assert.Equal(t, []int{200, 200, 503, 503, 503}, statuses)
+	assert.Equal(t, 2, stub.calls)
+}
+
+func TestShouldRejectMutationsOfListedAccessKeys(t *testing.T) {
+	stub := &roundTripperStub{}
+	roundTripper := Decorator(New(config.ReadOnly{AccessKeys: []string{"batch"}}))(stub)
+
+	statuses := make([]int, 0)
+	for _, accessKey := range []string{"batch", "tenant", ""} {
+		resp, err := roundTripper.RoundTrip(s3Request(http.MethodPut, accessKey))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{503, 200, 200}, statuses)
+}
+
+func TestModeShouldBeChangedOnTechnicalEndpoint(t *testing.T) {
+	mode := New(config.ReadOnly{})
+	recorder := httptest.NewRecorder()
+
+	mode.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/readonly", strings.NewReader(`{"Enabled":true,"AccessKeys":["b","a"]}`)))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	state := config.ReadOnly{}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&state))
+	assert.Equal(t, config.ReadOnly{Enabled: true, AccessKeys: []string{"a", "b"}, Message: defaultMessage}, state)
+	rejected, _ := mode.rejects("c")
+	assert.True(t, rejected)
+
+	recorder = httptest.NewRecorder()
+	mode.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/readonly", strings.NewReader(`{"Enabled":`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.True(t, mode.State().Enabled)
+}
@@ -4,6 +4,46 @@ package config
 type Policy struct {
 	ShardName string  `yaml:"ShardName"`
 	Weight    float64 `yaml:"Weight"`
+	// Drained shard gets no new keys, its objects are moved to other shards
+	Drained bool `yaml:"Drained,omitempty"`
+}
+
+// Canary defines shard which takes over part of region keyspace
+type Canary struct {
+	ShardName string `yaml:"ShardName"`
+	// Percentage of keys served by canary shard, keys are selected by hash,
+	// so raising it only moves more keys to canary shard
+	Percentage float64 `yaml:"Percentage"`
+}
+
+// KeyPrefix defines shard serving keys of bucket which start with prefix
+type KeyPrefix struct {
+	Bucket    string `yaml:"Bucket"`
+	Prefix    string `yaml:"Prefix"`
+	ShardName string `yaml:"ShardName"`
+}
+
+// BoundedLoad lets keys spill from shard, which in flight requests exceed
+// Factor times average load of region shards, to next shards on ring
+type BoundedLoad struct {
+	// Factor of average load shard may take, should be greater than 1
+	Factor float64 `yaml:"Factor"`
+}
+
+// ReplicationRule copies writes of region to other region asynchronously,
+// through synclog
+type ReplicationRule struct {
+	// Region writes are copied to
+	Region string `yaml:"Region"`
+	// Buckets replicated, all if empty
+	Buckets []string `yaml:"Buckets,omitempty"`
+	// Prefix of replicated keys
+	Prefix string `yaml:"Prefix,omitempty"`
+	// Deletes are propagated to Region if set
+	Deletes bool `yaml:"Deletes,omitempty"`
+	// Tags objects need to have all of to be replicated, tags are taken from
+	// X-Amz-Tagging header of PUT, deletes are not filtered by tags
+	Tags map[string]string `yaml:"Tags,omitempty"`
 }
 
 // Policies region configuration
@@ -12,8 +52,25 @@ type Policies struct {
 	Shards []Policy `yaml:"Shards"`
 	// Domains used for region matching
 	Domains []string `yaml:"Domains"`
+	// Buckets served by region regardless of Host header
+	Buckets []string `yaml:"Buckets,omitempty"`
 	// Default region will be applied if Host header would not match any other region
 	Default bool `yaml:"Default"`
+	// Canary shard serves part of keys instead of Shards
+	Canary *Canary `yaml:"Canary,omitempty"`
+	// KeyPrefixes split buckets across shards by key prefix, they take
+	// precedence over Canary and Shards
+	KeyPrefixes []KeyPrefix `yaml:"KeyPrefixes,omitempty"`
+	// BoundedLoad enables consistent hashing with bounded loads
+	BoundedLoad *BoundedLoad `yaml:"BoundedLoad,omitempty"`
+	// DrainConcurrency is number of objects moved at once from drained
+	// shards, default: 1
+	DrainConcurrency int `yaml:"DrainConcurrency,omitempty"`
+	// Replication rules of writes to other regions
+	Replication []ReplicationRule `yaml:"Replication,omitempty"`
+	// FailoverRegion serves reads of objects which shard of region fails
+	// to serve
+	FailoverRegion string `yaml:"FailoverRegion,omitempty"`
 }
 
 // ShardingPolicies maps name with Region definition
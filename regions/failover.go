@@ -0,0 +1,84 @@
+package regions
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/sharding"
+	"github.com/allegro/akubra/utils"
+)
+
+// failoverRing reads objects from failover region if shard owning them in
+// region is unhealthy, responses are marked with httphandler.ServedFromHeader
+type failoverRing struct {
+	sharding.ShardsRingAPI
+	owner    shardPicker
+	name     string
+	failover sharding.ShardsRingAPI
+}
+
+// DoRequest implements sharding.ShardsRingAPI interface
+func (fr *failoverRing) DoRequest(req *http.Request) (*http.Response, error) {
+	if !isObjectRead(req) {
+		return fr.ShardsRingAPI.DoRequest(req)
+	}
+	if fr.ownerAvailable(req.URL.Path) {
+		resp, err := fr.ShardsRingAPI.DoRequest(req)
+		if err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, err
+		}
+		discardBody(resp)
+	}
+	log.Printf("Request %s of %s served from failover region %s", utils.RequestID(req), req.URL.Path, fr.name)
+	metrics.Mark("failover." + metrics.Clean(fr.name))
+	resp, err := fr.failover.DoRequest(req)
+	if resp != nil {
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		resp.Header.Set(httphandler.ServedFromHeader, fr.name)
+	}
+	return resp, err
+}
+
+// ownerAvailable reports if any backend of shard owning key is not in
+// maintenance
+func (fr *failoverRing) ownerAvailable(key string) bool {
+	if fr.owner == nil {
+		return true
+	}
+	shard, err := fr.owner.Pick(key)
+	if err != nil {
+		return true
+	}
+	for _, backend := range shard.Backends() {
+		if !backend.Maintenance {
+			return true
+		}
+	}
+	return false
+}
+
+func isObjectRead(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	_, key := utils.SplitBucketKey(req.URL.Path)
+	return key != ""
+}
+
+func discardBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.Debugf("Cannot discard response body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Cannot close response body: %s", err)
+	}
+}
@@ -0,0 +1,79 @@
+package regions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/httphandler"
+	storage "github.com/allegro/akubra/storages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type failingRingMock struct {
+	ShardsRingMock
+}
+
+func (frm *failingRingMock) DoRequest(req *http.Request) (*http.Response, error) {
+	args := frm.Called(req)
+	return nil, args.Error(0)
+}
+
+func TestFailoverShouldServeReadFromFailoverRegionIfOwnerFails(t *testing.T) {
+	owner := &failingRingMock{}
+	owner.On("DoRequest", mock.Anything).Return(errors.New("all backends failed"))
+	failover := &ShardsRingMock{}
+	failover.On("DoRequest", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK})
+	ring := &failoverRing{ShardsRingAPI: owner, name: "us", failover: failover}
+
+	resp, err := ring.DoRequest(httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "us", resp.Header.Get(httphandler.ServedFromHeader))
+}
+
+func TestFailoverShouldSkipOwnerWithAllBackendsInMaintenance(t *testing.T) {
+	owner := &ShardsRingMock{}
+	failover := &ShardsRingMock{}
+	failover.On("DoRequest", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK})
+	shard := &maintenanceShardStub{shardStub{name: "eu-cluster", hosts: []string{"eu1:8080"}}}
+	ring := &failoverRing{ShardsRingAPI: owner, owner: pickerStub{shard}, name: "us", failover: failover}
+
+	resp, err := ring.DoRequest(httptest.NewRequest(http.MethodHead, "http://localhost/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, "us", resp.Header.Get(httphandler.ServedFromHeader))
+	owner.AssertNotCalled(t, "DoRequest", mock.Anything)
+}
+
+func TestFailoverShouldNotApplyToWritesAndHealthyReads(t *testing.T) {
+	owner := &ShardsRingMock{}
+	owner.On("DoRequest", mock.Anything).Return(&http.Response{StatusCode: http.StatusNotFound})
+	failover := &ShardsRingMock{}
+	ring := &failoverRing{ShardsRingAPI: owner, name: "us", failover: failover}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		resp, err := ring.DoRequest(httptest.NewRequest(method, "http://localhost/bucket/key", nil))
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get(httphandler.ServedFromHeader))
+	}
+	failover.AssertNotCalled(t, "DoRequest", mock.Anything)
+}
+
+type maintenanceShardStub struct {
+	shardStub
+}
+
+func (mss *maintenanceShardStub) Backends() []*storage.StorageClient {
+	backends := mss.shardStub.Backends()
+	for _, backend := range backends {
+		backend.Maintenance = true
+	}
+	return backends
+}
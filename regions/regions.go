@@ -1,22 +1,30 @@
 package regions
 
 import (
-	"bytes"
-	"io/ioutil"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/types"
 
 	"github.com/allegro/akubra/regions/config"
 	"github.com/allegro/akubra/sharding"
 	storage "github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/utils"
 )
 
 // Regions container for multiclusters
 type Regions struct {
 	multiCluters map[string]sharding.ShardsRingAPI
 	defaultRing  sharding.ShardsRingAPI
+	// rings by region name
+	rings map[string]sharding.ShardsRing
+	// buckets mapped to regions, they take precedence over domains
+	buckets map[string]sharding.ShardsRingAPI
+	// routed rings by region name, used for requests with region hint
+	routed map[string]sharding.ShardsRingAPI
 }
 
 func (rg Regions) assignShardsRing(domain string, shardRing sharding.ShardsRingAPI) {
@@ -24,16 +32,7 @@ func (rg Regions) assignShardsRing(domain string, shardRing sharding.ShardsRingA
 }
 
 func (rg Regions) getNoSuchDomainResponse(req *http.Request) *http.Response {
-	body := "No region found for this domain."
-	return &http.Response{
-		Status:        "404 Not found",
-		StatusCode:    404,
-		Proto:         req.Proto,
-		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
-		ContentLength: int64(len(body)),
-		Request:       req,
-		Header:        make(http.Header),
-	}
+	return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNotFound, "No region found for this domain.")
 }
 
 // RoundTrip performs round trip to target
@@ -42,6 +41,15 @@ func (rg Regions) RoundTrip(req *http.Request) (*http.Response, error) {
 	if err != nil {
 		reqHost = req.Host
 	}
+	if region, hinted := types.RegionHint(req.Context()); hinted {
+		if shardsRing, ok := rg.routed[region]; ok {
+			return shardsRing.DoRequest(req)
+		}
+		log.Debugf("Region hint %q of request %s names unknown region", region, req.URL.Path)
+	}
+	if shardsRing, ok := rg.buckets[bucketName(req)]; ok {
+		return shardsRing.DoRequest(req)
+	}
 	shardsRing, ok := rg.multiCluters[reqHost]
 	if ok {
 		return shardsRing.DoRequest(req)
@@ -53,12 +61,24 @@ func (rg Regions) RoundTrip(req *http.Request) (*http.Response, error) {
 	return rg.getNoSuchDomainResponse(req), nil
 }
 
-// NewRegions build new region http.RoundTripper
-func NewRegions(conf config.ShardingPolicies, storages storage.ClusterStorage, syncLogger log.Logger) (http.RoundTripper, error) {
+func bucketName(req *http.Request) string {
+	if req.URL == nil {
+		return ""
+	}
+	bucket, _ := utils.SplitBucketKey(req.URL.Path)
+	return bucket
+}
+
+// NewRegions build new region http.RoundTripper, writes replicated to other
+// regions are written to syncLog
+func NewRegions(conf config.ShardingPolicies, storages storage.ClusterStorage, clusterSyncLog, syncLog log.Logger) (*Regions, error) {
 
-	ringFactory := sharding.NewRingFactory(conf, storages, syncLogger)
+	ringFactory := sharding.NewRingFactory(conf, storages, clusterSyncLog)
 	regions := &Regions{
 		multiCluters: make(map[string]sharding.ShardsRingAPI),
+		rings:        make(map[string]sharding.ShardsRing),
+		buckets:      make(map[string]sharding.ShardsRingAPI),
+		routed:       make(map[string]sharding.ShardsRingAPI),
 	}
 
 	for name, regionConfig := range conf {
@@ -66,12 +86,109 @@ func NewRegions(conf config.ShardingPolicies, storages storage.ClusterStorage, s
 		if err != nil {
 			return nil, err
 		}
+		regions.rings[name] = regionRing
+	}
+	for name, regionConfig := range conf {
+		regionRing, err := regions.replicating(name, regionConfig.Replication, syncLog)
+		if err != nil {
+			return nil, err
+		}
+		if regionRing, err = regions.failingOver(name, regionConfig.FailoverRegion, regionRing); err != nil {
+			return nil, err
+		}
+		regions.routed[name] = regionRing
 		for _, domain := range regionConfig.Domains {
 			regions.assignShardsRing(domain, regionRing)
 		}
+		for _, bucket := range regionConfig.Buckets {
+			regions.buckets[bucket] = regionRing
+		}
 		if regionConfig.Default {
 			regions.defaultRing = regionRing
 		}
 	}
 	return regions, nil
 }
+
+// replicating wraps ring of region if its writes are replicated
+func (rg Regions) replicating(name string, rules []config.ReplicationRule, syncLog log.Logger) (sharding.ShardsRingAPI, error) {
+	ring := rg.rings[name]
+	if len(rules) == 0 {
+		return ring, nil
+	}
+	if syncLog == nil {
+		return nil, fmt.Errorf("synclog is required for replication of region %q", name)
+	}
+	targets := make([]replicationTarget, 0, len(rules))
+	for _, rule := range rules {
+		targetRing, ok := rg.rings[rule.Region]
+		if !ok {
+			return nil, fmt.Errorf("replication target region %q of region %q is not defined", rule.Region, name)
+		}
+		targets = append(targets, replicationTarget{name: rule.Region, ring: targetRing, rule: rule})
+	}
+	return &replicatingRing{ShardsRingAPI: ring, source: ring, targets: targets, syncLog: syncLog}, nil
+}
+
+// failingOver wraps ring of region if its reads fail over to other region
+func (rg Regions) failingOver(name, failover string, ring sharding.ShardsRingAPI) (sharding.ShardsRingAPI, error) {
+	if failover == "" {
+		return ring, nil
+	}
+	target, ok := rg.rings[failover]
+	if !ok {
+		return nil, fmt.Errorf("failover region %q of region %q is not defined", failover, name)
+	}
+	return &failoverRing{ShardsRingAPI: ring, owner: rg.rings[name], name: failover, failover: target}, nil
+}
+
+// Weights returns current shards weights of each region
+func (rg Regions) Weights() map[string]map[string]float64 {
+	weights := make(map[string]map[string]float64, len(rg.rings))
+	for name, ring := range rg.rings {
+		weights[name] = ring.Weights()
+	}
+	return weights
+}
+
+// SetWeights changes shards weights of regions, changes of each region are
+// applied separately
+func (rg Regions) SetWeights(changes map[string]map[string]float64) error {
+	for name := range changes {
+		if _, ok := rg.rings[name]; !ok {
+			return fmt.Errorf("region %q is not defined", name)
+		}
+	}
+	for name, weights := range changes {
+		if err := rg.rings[name].SetWeights(weights); err != nil {
+			return fmt.Errorf("cannot change weights of region %q: %s", name, err)
+		}
+		log.Printf("Weights of region %q changed: %v", name, weights)
+	}
+	return nil
+}
+
+// ServeHTTP serves shards weights of regions as JSON on GET and changes
+// weights given in body of PUT, in the same format
+func (rg Regions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		changes := make(map[string]map[string]float64)
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			http.Error(w, fmt.Sprintf("Cannot decode weights: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := rg.SetWeights(changes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rg.Weights()); err != nil {
+		log.Printf("Cannot write weights: %s", err)
+	}
+}
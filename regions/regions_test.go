@@ -2,9 +2,12 @@ package regions
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/allegro/akubra/sharding"
+	"github.com/allegro/akubra/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -78,3 +81,60 @@ func TestShouldReturnResponseFromShardsRingOnHostWithPort(t *testing.T) {
 
 	assert.Equal(t, 200, response.StatusCode)
 }
+
+func TestShouldRejectWeightsOfUnknownRegion(t *testing.T) {
+	regions := &Regions{
+		multiCluters: make(map[string]sharding.ShardsRingAPI),
+		rings:        map[string]sharding.ShardsRing{"known": {}},
+	}
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPut, "http://localhost/regions/weights", strings.NewReader(`{"other":{"cluster":1}}`))
+
+	regions.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "region \"other\" is not defined\n", recorder.Body.String())
+}
+
+func TestBucketMappingShouldTakePrecedenceOverDomain(t *testing.T) {
+	domainRing, bucketRing := &ShardsRingMock{}, &ShardsRingMock{}
+	regions := &Regions{
+		multiCluters: map[string]sharding.ShardsRingAPI{"test1.qxlint": domainRing},
+		buckets:      map[string]sharding.ShardsRingAPI{"images": bucketRing},
+	}
+	mapped := httptest.NewRequest(http.MethodGet, "http://test1.qxlint/images/key", nil)
+	other := httptest.NewRequest(http.MethodGet, "http://test1.qxlint/docs/key", nil)
+	bucketRing.On("DoRequest", mapped).Return(&http.Response{StatusCode: http.StatusOK})
+	domainRing.On("DoRequest", other).Return(&http.Response{StatusCode: http.StatusOK})
+
+	_, err := regions.RoundTrip(mapped)
+	assert.NoError(t, err)
+	_, err = regions.RoundTrip(other)
+	assert.NoError(t, err)
+
+	bucketRing.AssertCalled(t, "DoRequest", mapped)
+	domainRing.AssertCalled(t, "DoRequest", other)
+	domainRing.AssertNotCalled(t, "DoRequest", mapped)
+}
+
+func TestRegionHintShouldTakePrecedenceOverBucketMapping(t *testing.T) {
+	bucketRing, hintedRing := &ShardsRingMock{}, &ShardsRingMock{}
+	regions := &Regions{
+		buckets: map[string]sharding.ShardsRingAPI{"images": bucketRing},
+		routed:  map[string]sharding.ShardsRingAPI{"us": hintedRing},
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://test1.qxlint/images/key", nil)
+	hinted := req.WithContext(types.WithRegionHint(req.Context(), "us"))
+	unknown := req.WithContext(types.WithRegionHint(req.Context(), "asia"))
+	hintedRing.On("DoRequest", hinted).Return(&http.Response{StatusCode: http.StatusOK})
+	bucketRing.On("DoRequest", unknown).Return(&http.Response{StatusCode: http.StatusOK})
+
+	_, err := regions.RoundTrip(hinted)
+	assert.NoError(t, err)
+	_, err = regions.RoundTrip(unknown)
+	assert.NoError(t, err)
+
+	hintedRing.AssertCalled(t, "DoRequest", hinted)
+	bucketRing.AssertCalled(t, "DoRequest", unknown)
+	bucketRing.AssertNotCalled(t, "DoRequest", hinted)
+}
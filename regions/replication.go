@@ -0,0 +1,149 @@
+package regions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/regions/config"
+	"github.com/allegro/akubra/sharding"
+	storage "github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/utils"
+)
+
+// shardPicker finds shard of key
+type shardPicker interface {
+	Pick(key string) (storage.NamedShardClient, error)
+}
+
+// replicationTarget is ring of region writes are copied to
+type replicationTarget struct {
+	name string
+	ring shardPicker
+	rule config.ReplicationRule
+}
+
+// matches reports if rule applies to object write
+func (rt replicationTarget) matches(req *http.Request, isDelete bool) bool {
+	if isDelete && !rt.rule.Deletes {
+		return false
+	}
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	if len(rt.rule.Buckets) > 0 && !contains(rt.rule.Buckets, bucket) {
+		return false
+	}
+	if !isDelete && !hasTags(req, rt.rule.Tags) {
+		return false
+	}
+	return strings.HasPrefix(key, rt.rule.Prefix)
+}
+
+// hasTags reports if X-Amz-Tagging header of request contains all tags
+func hasTags(req *http.Request, tags map[string]string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	objectTags, err := url.ParseQuery(req.Header.Get("X-Amz-Tagging"))
+	if err != nil {
+		return false
+	}
+	for key, value := range tags {
+		if objectTags.Get(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// replicatingRing writes successful writes of region to synclog for shards
+// of other regions key belongs to, so replayer copies them asynchronously
+type replicatingRing struct {
+	sharding.ShardsRingAPI
+	source  shardPicker
+	targets []replicationTarget
+	syncLog log.Logger
+}
+
+// DoRequest implements sharding.ShardsRingAPI interface
+func (rr *replicatingRing) DoRequest(req *http.Request) (*http.Response, error) {
+	resp, err := rr.ShardsRingAPI.DoRequest(req)
+	if err != nil || resp == nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, err
+	}
+	method, replicated := replicatedMethod(req)
+	if !replicated {
+		return resp, err
+	}
+	for _, target := range rr.targets {
+		if target.matches(req, method == http.MethodDelete) {
+			rr.replicate(target, method, req, resp)
+		}
+	}
+	return resp, err
+}
+
+func (rr *replicatingRing) replicate(target replicationTarget, method string, req *http.Request, resp *http.Response) {
+	source, err := rr.source.Pick(req.URL.Path)
+	if err != nil || len(source.Backends()) == 0 {
+		log.Printf("Cannot replicate %s to region %s, no source shard: %s", req.URL.Path, target.name, err)
+		return
+	}
+	shard, err := target.ring.Pick(req.URL.Path)
+	if err != nil {
+		log.Printf("Cannot replicate %s to region %s: %s", req.URL.Path, target.name, err)
+		return
+	}
+	for _, backend := range shard.Backends() {
+		msg := &httphandler.SyncLogMessageData{
+			Method:        method,
+			FailedHost:    backend.Endpoint.Host,
+			SuccessHost:   source.Backends()[0].Endpoint.Host,
+			Path:          req.URL.Path,
+			AccessKey:     utils.ExtractAccessKey(req),
+			UserAgent:     req.Header.Get("User-Agent"),
+			ContentLength: resp.ContentLength,
+			ReqID:         utils.RequestID(req),
+			Time:          time.Now().Format(time.RFC3339Nano),
+			Region:        target.name,
+		}
+		logMsg, err := json.Marshal(msg)
+		if err != nil {
+			log.Debugf("Marshall synclog error %s", err)
+			return
+		}
+		rr.syncLog.Println(string(logMsg))
+		metrics.Mark("replication." + metrics.Clean(target.name) + "." + strings.ToLower(method))
+	}
+}
+
+// replicatedMethod returns method replayer should use to copy write of
+// object, completed multipart upload is copied as whole object
+func replicatedMethod(req *http.Request) (string, bool) {
+	if _, key := utils.SplitBucketKey(req.URL.Path); key == "" {
+		return "", false
+	}
+	_, hasUploadID := req.URL.Query()["uploadId"]
+	switch {
+	case req.Method == http.MethodPut && req.URL.RawQuery == "":
+		return http.MethodPut, true
+	case req.Method == http.MethodPost && hasUploadID:
+		return http.MethodPut, true
+	case req.Method == http.MethodDelete && req.URL.RawQuery == "":
+		return http.MethodDelete, true
+	}
+	return "", false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package regions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/regions/config"
+	storage "github.com/allegro/akubra/storages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type syncLogRecorder struct {
+	log.Logger
+	lines []string
+}
+
+func (slr *syncLogRecorder) Println(v ...interface{}) {
+	slr.lines = append(slr.lines, fmt.Sprint(v...))
+}
+
+type shardStub struct {
+	name  string
+	hosts []string
+}
+
+func (ss shardStub) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, nil
+}
+
+func (ss shardStub) Name() string {
+	return ss.name
+}
+
+func (ss shardStub) Backends() []*storage.StorageClient {
+	backends := make([]*storage.StorageClient, 0, len(ss.hosts))
+	for _, host := range ss.hosts {
+		backends = append(backends, &storage.StorageClient{Endpoint: url.URL{Scheme: "http", Host: host}})
+	}
+	return backends
+}
+
+func (ss shardStub) StreamsBody() bool {
+	return false
+}
+
+type pickerStub struct {
+	shard storage.NamedShardClient
+}
+
+func (ps pickerStub) Pick(string) (storage.NamedShardClient, error) {
+	return ps.shard, nil
+}
+
+func replicatingRingStub(recorder *syncLogRecorder, rule config.ReplicationRule) *replicatingRing {
+	ring := &ShardsRingMock{}
+	ring.On("DoRequest", mock.Anything).Return(&http.Response{StatusCode: http.StatusOK})
+	return &replicatingRing{
+		ShardsRingAPI: ring,
+		source:        pickerStub{shardStub{name: "eu-cluster", hosts: []string{"eu1:8080", "eu2:8080"}}},
+		targets:       []replicationTarget{{name: "us", ring: pickerStub{shardStub{name: "us-cluster", hosts: []string{"us1:8080", "us2:8080"}}}, rule: rule}},
+		syncLog:       recorder,
+	}
+}
+
+func TestReplicationShouldWriteSyncLogForEachBackendOfTargetShard(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	ring := replicatingRingStub(recorder, config.ReplicationRule{Region: "us", Buckets: []string{"images"}, Prefix: "public/"})
+
+	for _, path := range []string{"/images/public/a.png", "/images/private/b.png", "/docs/public/c.txt", "/images/public/?acl"} {
+		_, err := ring.DoRequest(httptest.NewRequest(http.MethodPut, "http://localhost"+path, nil))
+		require.NoError(t, err)
+	}
+	_, err := ring.DoRequest(httptest.NewRequest(http.MethodDelete, "http://localhost/images/public/a.png", nil))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.lines, 2)
+	for i, host := range []string{"us1:8080", "us2:8080"} {
+		msg := httphandler.SyncLogMessageData{}
+		require.NoError(t, json.Unmarshal([]byte(recorder.lines[i]), &msg))
+		assert.Equal(t, http.MethodPut, msg.Method)
+		assert.Equal(t, "/images/public/a.png", msg.Path)
+		assert.Equal(t, "eu1:8080", msg.SuccessHost)
+		assert.Equal(t, host, msg.FailedHost)
+		assert.Equal(t, "us", msg.Region)
+	}
+}
+
+func TestReplicationShouldPropagateDeletesIfEnabled(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	ring := replicatingRingStub(recorder, config.ReplicationRule{Region: "us", Deletes: true})
+
+	_, err := ring.DoRequest(httptest.NewRequest(http.MethodDelete, "http://localhost/images/a.png", nil))
+	require.NoError(t, err)
+	_, err = ring.DoRequest(httptest.NewRequest(http.MethodPost, "http://localhost/images/b.png?uploadId=1", nil))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.lines, 4)
+	assert.Contains(t, recorder.lines[0], `"method":"DELETE"`)
+	assert.Contains(t, recorder.lines[2], `"method":"PUT"`)
+	assert.Contains(t, recorder.lines[2], `"path":"/images/b.png"`)
+}
+
+func TestReplicationShouldCopyOnlyWritesTaggedWithRuleTags(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	ring := replicatingRingStub(recorder, config.ReplicationRule{Region: "us", Deletes: true, Tags: map[string]string{"replicate": "us"}})
+
+	for path, tagging := range map[string]string{"/images/a.png": "replicate=us&team=img", "/images/b.png": "replicate=eu", "/images/c.png": ""} {
+		req := httptest.NewRequest(http.MethodPut, "http://localhost"+path, nil)
+		req.Header.Set("X-Amz-Tagging", tagging)
+		_, err := ring.DoRequest(req)
+		require.NoError(t, err)
+	}
+	_, err := ring.DoRequest(httptest.NewRequest(http.MethodDelete, "http://localhost/images/b.png", nil))
+	require.NoError(t, err)
+
+	require.Len(t, recorder.lines, 4)
+	assert.Contains(t, recorder.lines[0], `"path":"/images/a.png"`)
+	assert.Contains(t, recorder.lines[2], `"method":"DELETE"`)
+}
@@ -0,0 +1,476 @@
+package s3mem
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	// defaultMaxKeys is number of keys listed if client didn't set max-keys,
+	// it's also the limit of keys listed at once
+	defaultMaxKeys = 1000
+	// defaultContentType is returned for objects stored without Content-Type
+	defaultContentType = "binary/octet-stream"
+)
+
+// storedHeaders are object headers returned with object
+var storedHeaders = []string{
+	"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type",
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+}
+
+// Server is in-memory S3 storage for tests of sharding and replication. It
+// serves path style bucket creation, deletion and listing (V1 and V2), object
+// PUT, GET, HEAD, DELETE and copy, and Multi-Object Delete. Other operations
+// are answered with NotImplemented error. Requests aren't authenticated.
+// Server is http.RoundTripper, so it may replace transport of storages, and
+// http.Handler for httptest servers
+type Server struct {
+	mx          sync.Mutex
+	buckets     map[string]map[string]*object
+	unavailable bool
+	requests    int
+}
+
+// New creates Server without buckets
+func New() *Server {
+	return &Server{buckets: make(map[string]map[string]*object)}
+}
+
+// CreateBucket creates bucket if it doesn't exist
+func (s *Server) CreateBucket(bucket string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]*object)
+	}
+}
+
+// PutObject stores object, creating its bucket if needed
+func (s *Server) PutObject(bucket, key string, data []byte) {
+	s.CreateBucket(bucket)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.buckets[bucket][key] = newObject(data, nil)
+}
+
+// Object returns data of stored object
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	obj, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return obj.data, true
+}
+
+// Keys returns sorted keys of bucket objects
+func (s *Server) Keys(bucket string) []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetUnavailable makes Server answer all requests with ServiceUnavailable
+// error, as storage under maintenance would
+func (s *Server) SetUnavailable(unavailable bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.unavailable = unavailable
+}
+
+// Requests returns number of served requests
+func (s *Server) Requests() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (s *Server) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if closeErr := req.Body.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.requests++
+	if s.unavailable {
+		return types.NewS3ErrorResponseForStatus(req, http.StatusServiceUnavailable), nil
+	}
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	query := req.URL.Query()
+	switch {
+	case bucket == "":
+	case key != "" && req.URL.RawQuery == "":
+		return s.objectRequest(req, bucket, key, body)
+	case key == "" && req.Method == http.MethodPost && hasQuery(query, "delete"):
+		return s.deleteObjects(req, bucket, body)
+	case key == "" && req.Method == http.MethodGet && isListingQuery(query):
+		return s.listObjects(req, bucket)
+	case key == "" && req.URL.RawQuery == "":
+		return s.bucketRequest(req, bucket)
+	}
+	return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+		"Operation is not supported by s3mem storage."), nil
+}
+
+// ServeHTTP implements http.Handler interface
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	resp, err := s.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (s *Server) objectRequest(req *http.Request, bucket, key string, body []byte) (*http.Response, error) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return noSuchBucket(req), nil
+	}
+	switch req.Method {
+	case http.MethodPut:
+		if source := req.Header.Get("X-Amz-Copy-Source"); source != "" {
+			return s.copyObject(req, objects, key, source)
+		}
+		obj := newObject(body, req.Header)
+		objects[key] = obj
+		resp := emptyResponse(req, http.StatusOK)
+		resp.Header.Set("ETag", obj.etag)
+		return resp, nil
+	case http.MethodDelete:
+		delete(objects, key)
+		return emptyResponse(req, http.StatusNoContent), nil
+	case http.MethodGet, http.MethodHead:
+		obj, ok := objects[key]
+		if !ok {
+			return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchKey,
+				"The specified key does not exist."), nil
+		}
+		return objectResponse(req, obj), nil
+	}
+	return types.NewS3ErrorResponseForStatus(req, http.StatusMethodNotAllowed), nil
+}
+
+func (s *Server) copyObject(req *http.Request, objects map[string]*object, key, source string) (*http.Response, error) {
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return types.NewS3ErrorResponseWithMessage(req, http.StatusBadRequest, "Copy source is not valid."), nil
+	}
+	sourceBucket, sourceKey := utils.SplitBucketKey(source)
+	sourceObj, ok := s.buckets[sourceBucket][sourceKey]
+	if !ok {
+		return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchKey,
+			"The specified key does not exist."), nil
+	}
+	header := sourceObj.header
+	if req.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		header = req.Header
+	}
+	obj := newObject(sourceObj.data, header)
+	objects[key] = obj
+	return marshalResponse(req, types.CopyObjectResult{
+		LastModified: obj.lastModified.Format(time.RFC3339),
+		ETag:         obj.etag,
+	})
+}
+
+func (s *Server) bucketRequest(req *http.Request, bucket string) (*http.Response, error) {
+	objects, ok := s.buckets[bucket]
+	switch {
+	case req.Method == http.MethodPut:
+		if !ok {
+			s.buckets[bucket] = make(map[string]*object)
+		}
+		return emptyResponse(req, http.StatusOK), nil
+	case !ok:
+		return noSuchBucket(req), nil
+	case req.Method == http.MethodHead:
+		return emptyResponse(req, http.StatusOK), nil
+	case req.Method == http.MethodDelete:
+		if len(objects) > 0 {
+			return types.NewS3ErrorResponse(req, http.StatusConflict, types.S3ErrBucketNotEmpty,
+				"The bucket you tried to delete is not empty."), nil
+		}
+		delete(s.buckets, bucket)
+		return emptyResponse(req, http.StatusNoContent), nil
+	}
+	return types.NewS3ErrorResponseForStatus(req, http.StatusMethodNotAllowed), nil
+}
+
+func (s *Server) deleteObjects(req *http.Request, bucket string, body []byte) (*http.Response, error) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return noSuchBucket(req), nil
+	}
+	deleteReq := types.DeleteObjectsRequest{}
+	if err := xml.Unmarshal(body, &deleteReq); err != nil {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrMalformedXML,
+			"The XML you provided was not well-formed."), nil
+	}
+	result := types.DeleteObjectsResult{Xmlns: types.S3Namespace}
+	for _, identifier := range deleteReq.Objects {
+		delete(objects, identifier.Key)
+		if !deleteReq.Quiet {
+			result.Deleted = append(result.Deleted, types.DeletedObject{Key: identifier.Key})
+		}
+	}
+	return marshalResponse(req, result)
+}
+
+// listObjects serves ListObjects and ListObjectsV2, continuation token of V2
+// listing is the last listed key, keys are url encoded if client asked for it
+func (s *Server) listObjects(req *http.Request, bucket string) (*http.Response, error) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return noSuchBucket(req), nil
+	}
+	query := req.URL.Query()
+	listV2 := query.Get("list-type") == "2"
+	prefix, delimiter, marker := query.Get("prefix"), query.Get("delimiter"), query.Get("marker")
+	if listV2 {
+		marker = query.Get("continuation-token")
+		if marker == "" {
+			marker = query.Get("start-after")
+		}
+	}
+	maxKeys := int64(defaultMaxKeys)
+	if value := query.Get("max-keys"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidArgument,
+				"Provided max-keys is not valid."), nil
+		}
+		if parsed < maxKeys {
+			maxKeys = parsed
+		}
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	contents := make(s3datatypes.ObjectInfos, 0)
+	prefixes := make(s3datatypes.CommonPrefixes, 0)
+	lastListed, nextMarker := "", ""
+	for _, key := range keys {
+		commonPrefix := ""
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			if commonPrefix == lastListed || strings.HasPrefix(marker, commonPrefix) {
+				continue
+			}
+		}
+		if int64(len(contents)+len(prefixes)) == maxKeys {
+			nextMarker = lastListed
+			break
+		}
+		if commonPrefix != "" {
+			prefixes = append(prefixes, s3datatypes.CommonPrefix{Prefix: commonPrefix})
+			lastListed = commonPrefix
+			continue
+		}
+		obj := objects[key]
+		contents = append(contents, s3datatypes.ObjectInfo{
+			Key:          key,
+			ETag:         obj.etag,
+			LastModified: obj.lastModified,
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+		lastListed = key
+	}
+	encodingType := query.Get("encoding-type")
+	encode := func(value string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(value)
+		}
+		return value
+	}
+	for i := range contents {
+		contents[i].Key = encode(contents[i].Key)
+	}
+	for i := range prefixes {
+		prefixes[i].Prefix = encode(prefixes[i].Prefix)
+	}
+	if listV2 {
+		return marshalResponse(req, s3datatypes.ListBucketV2Result{
+			Name:                  bucket,
+			Prefix:                encode(prefix),
+			Delimiter:             encode(delimiter),
+			EncodingType:          encodingType,
+			MaxKeys:               maxKeys,
+			ContinuationToken:     query.Get("continuation-token"),
+			StartAfter:            encode(query.Get("start-after")),
+			NextContinuationToken: nextMarker,
+			IsTruncated:           nextMarker != "",
+			Contents:              contents,
+			CommonPrefixes:        prefixes,
+		})
+	}
+	return marshalResponse(req, s3datatypes.ListBucketResult{
+		Name:           bucket,
+		Prefix:         encode(prefix),
+		Delimiter:      encode(delimiter),
+		EncodingType:   encodingType,
+		MaxKeys:        maxKeys,
+		Marker:         encode(marker),
+		NextMarker:     encode(nextMarker),
+		IsTruncated:    nextMarker != "",
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	})
+}
+
+// Transport routes requests to Server of request host, so storages of many
+// backends may be served from memory
+type Transport map[string]*Server
+
+// RoundTrip implements http.RoundTripper interface
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	server, ok := t[req.URL.Host]
+	if !ok {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("no s3mem server of host %q", req.URL.Host)
+	}
+	return server.RoundTrip(req)
+}
+
+func newObject(data []byte, header http.Header) *object {
+	md5Sum := md5.Sum(data)
+	obj := &object{
+		data:         data,
+		etag:         strconv.Quote(hex.EncodeToString(md5Sum[:])),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		header:       make(http.Header),
+	}
+	for _, name := range storedHeaders {
+		if values, ok := header[name]; ok {
+			obj.header[name] = values
+		}
+	}
+	for name, values := range header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			obj.header[name] = values
+		}
+	}
+	if obj.header.Get("Content-Type") == "" {
+		obj.header.Set("Content-Type", defaultContentType)
+	}
+	return obj
+}
+
+func objectResponse(req *http.Request, obj *object) *http.Response {
+	resp := emptyResponse(req, http.StatusOK)
+	for name, values := range obj.header {
+		resp.Header[name] = values
+	}
+	resp.Header.Set("ETag", obj.etag)
+	resp.Header.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(obj.data)))
+	resp.ContentLength = int64(len(obj.data))
+	if req.Method == http.MethodGet {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(obj.data))
+	}
+	return resp
+}
+
+func marshalResponse(req *http.Request, document interface{}) (*http.Response, error) {
+	body, err := xml.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	body = append([]byte(xml.Header), body...)
+	resp := emptyResponse(req, http.StatusOK)
+	resp.Header.Set("Content-Type", "application/xml")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+func emptyResponse(req *http.Request, statusCode int) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Length", "0")
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+func noSuchBucket(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchBucket,
+		"The specified bucket does not exist.")
+}
+
+func hasQuery(query url.Values, name string) bool {
+	_, ok := query[name]
+	return ok
+}
+
+// isListingQuery reports if query has listing parameters only
+func isListingQuery(query url.Values) bool {
+	for name := range query {
+		switch name {
+		case "list-type", "prefix", "delimiter", "marker", "max-keys", "continuation-token",
+			"start-after", "encoding-type", "fetch-owner":
+		default:
+			return false
+		}
+	}
+	listType := query.Get("list-type")
+	return listType == "" || listType == "2"
+}
@@ -0,0 +1,155 @@
+package s3mem
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(t *testing.T, rt http.RoundTripper, method, url, body string) (*http.Response, string) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(respBody)
+}
+
+func TestServerShouldStoreObjects(t *testing.T) {
+	server := New()
+
+	resp, _ := do(t, server, http.MethodPut, "http://s3/bucket/key", "data")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = do(t, server, http.MethodPut, "http://s3/bucket", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = do(t, server, http.MethodPut, "http://s3/bucket/dir/key", "data")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"8d777f385d3dfec8815d20f7496026dc"`, resp.Header.Get("ETag"))
+
+	resp, body := do(t, server, http.MethodGet, "http://s3/bucket/dir/key", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "data", body)
+	resp, body = do(t, server, http.MethodHead, "http://s3/bucket/dir/key", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "4", resp.Header.Get("Content-Length"))
+	assert.Empty(t, body)
+
+	resp, _ = do(t, server, http.MethodDelete, "http://s3/bucket", "")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp, _ = do(t, server, http.MethodDelete, "http://s3/bucket/dir/key", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = do(t, server, http.MethodGet, "http://s3/bucket/dir/key", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = do(t, server, http.MethodDelete, "http://s3/bucket", "")
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestServerShouldCopyObjects(t *testing.T) {
+	server := New()
+	server.PutObject("bucket", "source", []byte("data"))
+	req := httptest.NewRequest(http.MethodPut, "http://s3/bucket/copy", nil)
+	req.Header.Set("X-Amz-Copy-Source", "/bucket/source")
+
+	resp, err := server.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data, ok := server.Object("bucket", "copy")
+	assert.True(t, ok)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestServerShouldListObjectsPageByPage(t *testing.T) {
+	server := New()
+	for _, key := range []string{"a/1", "a/2", "b", "c/1", "d"} {
+		server.PutObject("bucket", key, []byte(key))
+	}
+	listed := []string{}
+	marker := ""
+	for {
+		_, body := do(t, server, http.MethodGet, "http://s3/bucket?delimiter=/&max-keys=2&marker="+marker, "")
+		result := s3datatypes.ListBucketResult{}
+		require.NoError(t, xml.Unmarshal([]byte(body), &result))
+		for _, prefix := range result.CommonPrefixes {
+			listed = append(listed, prefix.Prefix)
+		}
+		for _, object := range result.Contents {
+			listed = append(listed, object.Key)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+
+	assert.Equal(t, []string{"a/", "b", "c/", "d"}, listed)
+
+	_, body := do(t, server, http.MethodGet, "http://s3/bucket?list-type=2&prefix=a/", "")
+	result := s3datatypes.ListBucketV2Result{}
+	require.NoError(t, xml.Unmarshal([]byte(body), &result))
+	require.Len(t, result.Contents, 2)
+	assert.Equal(t, "a/1", result.Contents[0].Key)
+	assert.Equal(t, int64(3), result.Contents[0].Size)
+}
+
+func TestServerShouldDeleteManyObjects(t *testing.T) {
+	server := New()
+	server.PutObject("bucket", "a", nil)
+	server.PutObject("bucket", "b", nil)
+	server.PutObject("bucket", "c", nil)
+	body, err := xml.Marshal(types.DeleteObjectsRequest{Objects: []types.ObjectIdentifier{{Key: "a"}, {Key: "c"}}})
+	require.NoError(t, err)
+
+	resp, respBody := do(t, server, http.MethodPost, "http://s3/bucket?delete", string(body))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	result := types.DeleteObjectsResult{}
+	require.NoError(t, xml.Unmarshal([]byte(respBody), &result))
+	assert.Len(t, result.Deleted, 2)
+	assert.Equal(t, []string{"b"}, server.Keys("bucket"))
+}
+
+func TestTransportShouldRouteRequestsByHost(t *testing.T) {
+	first, second := New(), New()
+	second.SetUnavailable(true)
+	transport := Transport{"first:9000": first, "second:9000": second}
+
+	resp, _ := do(t, transport, http.MethodPut, "http://first:9000/bucket", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = do(t, transport, http.MethodPut, "http://second:9000/bucket", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://third:9000/bucket", nil))
+	assert.Error(t, err)
+	assert.Equal(t, 1, first.Requests())
+	assert.Equal(t, 1, second.Requests())
+}
+
+func TestServerShouldServeHTTP(t *testing.T) {
+	ts := httptest.NewServer(New())
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/bucket", nil)
+	require.NoError(t, err)
+	_, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	req, err = http.NewRequest(http.MethodPut, ts.URL+"/bucket/key", bytes.NewReader([]byte("data")))
+	require.NoError(t, err)
+	_, err = ts.Client().Do(req)
+	require.NoError(t, err)
+
+	resp, err := ts.Client().Get(ts.URL + "/bucket/key")
+
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(body))
+}
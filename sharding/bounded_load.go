@@ -0,0 +1,73 @@
+package sharding
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"sync"
+)
+
+// shardsLoad counts requests in flight of each shard of region, so keys of
+// overloaded shard may be sent to next shard on ring (Mirrokni et al.,
+// Consistent Hashing with Bounded Loads, 2017)
+type shardsLoad struct {
+	mx       sync.Mutex
+	factor   float64
+	inFlight map[string]int64
+	total    int64
+}
+
+func newShardsLoad(factor float64) *shardsLoad {
+	return &shardsLoad{factor: factor, inFlight: make(map[string]int64)}
+}
+
+// acquire takes the first of candidates which load stays within factor of
+// average with one more request, returned function releases it
+func (sl *shardsLoad) acquire(candidates []string) (string, func()) {
+	sl.mx.Lock()
+	defer sl.mx.Unlock()
+	limit := int64(math.Ceil(sl.factor * float64(sl.total+1) / float64(len(candidates))))
+	picked := candidates[0]
+	for _, name := range candidates {
+		if sl.inFlight[name]+1 <= limit {
+			picked = name
+			break
+		}
+	}
+	sl.inFlight[picked]++
+	sl.total++
+	var once sync.Once
+	return picked, func() {
+		once.Do(func() { sl.release(picked) })
+	}
+}
+
+func (sl *shardsLoad) release(name string) {
+	sl.mx.Lock()
+	defer sl.mx.Unlock()
+	sl.inFlight[name]--
+	sl.total--
+}
+
+// releasingBody releases shard load once response body is sent
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer interface
+func (rb *releasingBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.release()
+	return err
+}
+
+// releaseOnClose keeps shard load until response body is closed
+func releaseOnClose(resp *http.Response, release func()) *http.Response {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		release()
+		return resp
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp
+}
@@ -0,0 +1,266 @@
+package sharding
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// deleteObjectsBatch is part of Multi-Object Delete request owned by one shard
+type deleteObjectsBatch struct {
+	owner   storages.NamedShardClient
+	request types.DeleteObjectsRequest
+}
+
+// deleteObjectsResult is response of one shard for its batch
+type deleteObjectsResult struct {
+	shard   string
+	objects []types.ObjectIdentifier
+	result  types.DeleteObjectsResult
+	err     error
+}
+
+func isDeleteObjectsRequest(req *http.Request) bool {
+	_, ok := req.URL.Query()["delete"]
+	return ok && req.Method == http.MethodPost
+}
+
+// deleteObjects splits keys of Multi-Object Delete request among shards owning
+// them, sends each shard (and its regression shards) its part of keys and
+// merges results into single response
+func (sr ShardsRing) deleteObjects(req *http.Request) (*http.Response, error) {
+	resetter, ok := req.Body.(types.Resetter)
+	if !ok {
+		return sr.allClustersRoundTripper.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(resetter.Reset())
+	if err != nil {
+		return nil, err
+	}
+	deleteRequest := types.DeleteObjectsRequest{}
+	if err := xml.Unmarshal(body, &deleteRequest); err != nil {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrMalformedXML,
+			"The XML you provided was not well-formed or did not validate against our published schema."), nil
+	}
+
+	batches, err := sr.splitDeleteObjects(req, deleteRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(batches) == 1 {
+		// Whole request belongs to one shard, original body keeps client signature valid
+		return sr.sendDeleteObjects(batches[0].owner, req)
+	}
+
+	type subRequest struct {
+		cl      storages.NamedShardClient
+		req     *http.Request
+		objects []types.ObjectIdentifier
+	}
+	subRequests := make([]subRequest, 0, len(batches))
+	for _, batch := range batches {
+		for _, cl := range sr.deleteTargets(batch.owner) {
+			batchReq, err := newDeleteObjectsRequest(req, batch.request)
+			if err != nil {
+				return nil, err
+			}
+			subRequests = append(subRequests, subRequest{cl: cl, req: batchReq, objects: batch.request.Objects})
+		}
+	}
+
+	results := make(chan deleteObjectsResult)
+	wg := sync.WaitGroup{}
+	for _, sub := range subRequests {
+		wg.Add(1)
+		go func(sub subRequest) {
+			defer wg.Done()
+			result, err := sr.sendDeleteObjectsBatch(sub.cl, sub.req)
+			results <- deleteObjectsResult{shard: sub.cl.Name(), objects: sub.objects, result: result, err: err}
+		}(sub)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return mergeDeleteObjectsResults(req, deleteRequest, results)
+}
+
+// splitDeleteObjects groups objects by owning shard
+func (sr ShardsRing) splitDeleteObjects(req *http.Request, deleteRequest types.DeleteObjectsRequest) ([]*deleteObjectsBatch, error) {
+	bucket := strings.Trim(req.URL.Path, "/")
+	batches := make(map[string]*deleteObjectsBatch)
+	ordered := make([]*deleteObjectsBatch, 0)
+	for _, object := range deleteRequest.Objects {
+		cl, err := sr.Pick("/" + bucket + "/" + object.Key)
+		if err != nil {
+			return nil, err
+		}
+		batch, ok := batches[cl.Name()]
+		if !ok {
+			batch = &deleteObjectsBatch{owner: cl, request: types.DeleteObjectsRequest{Quiet: deleteRequest.Quiet}}
+			batches[cl.Name()] = batch
+			ordered = append(ordered, batch)
+		}
+		batch.request.Objects = append(batch.request.Objects, object)
+	}
+	if len(ordered) == 0 {
+		// Empty request is rejected by backends, let one of them respond
+		cl, err := sr.Pick(req.URL.Path)
+		if err != nil {
+			return nil, err
+		}
+		ordered = append(ordered, &deleteObjectsBatch{owner: cl, request: deleteRequest})
+	}
+	return ordered, nil
+}
+
+// deleteTargets returns owner shard followed by its regression shards, objects
+// may still be stored there as reads fall back to them
+func (sr ShardsRing) deleteTargets(owner storages.NamedShardClient) []storages.NamedShardClient {
+	targets := []storages.NamedShardClient{owner}
+	visited := map[string]struct{}{owner.Name(): {}}
+	for cl, ok := sr.clusterRegressionMap[owner.Name()]; ok; cl, ok = sr.clusterRegressionMap[cl.Name()] {
+		if _, seen := visited[cl.Name()]; seen {
+			break
+		}
+		visited[cl.Name()] = struct{}{}
+		targets = append(targets, cl)
+	}
+	return targets
+}
+
+// sendDeleteObjects sends unsplit request to owner shard and its regression
+// shards, response of owner is returned
+func (sr ShardsRing) sendDeleteObjects(owner storages.NamedShardClient, req *http.Request) (*http.Response, error) {
+	reqID := utils.RequestID(req)
+	for _, cl := range sr.deleteTargets(owner)[1:] {
+		regressionReq := *req
+		resp, err := sr.send(cl, &regressionReq)
+		if err != nil {
+			logger.WithFields(log.Fields{"request_id": reqID, "shard": cl.Name()}).Warnf("DeleteObjects request to regression shard failed: %s", err)
+			continue
+		}
+		closeBody(resp, reqID)
+	}
+	return sr.send(owner, req)
+}
+
+func (sr ShardsRing) sendDeleteObjectsBatch(cl storages.NamedShardClient, req *http.Request) (types.DeleteObjectsResult, error) {
+	result := types.DeleteObjectsResult{}
+	resp, err := sr.send(cl, req)
+	if err != nil {
+		return result, err
+	}
+	defer closeBody(resp, utils.RequestID(req))
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return result, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		s3Error := types.S3Error{}
+		if xmlErr := xml.Unmarshal(body, &s3Error); xmlErr != nil || s3Error.Code == "" {
+			s3Error = types.S3Error{Code: strings.Replace(http.StatusText(resp.StatusCode), " ", "", -1), Message: http.StatusText(resp.StatusCode)}
+		}
+		return result, fmt.Errorf("%s: %s", s3Error.Code, s3Error.Message)
+	}
+	err = xml.Unmarshal(body, &result)
+	return result, err
+}
+
+// newDeleteObjectsRequest creates request with body listing given objects only
+func newDeleteObjectsRequest(origReq *http.Request, deleteRequest types.DeleteObjectsRequest) (*http.Request, error) {
+	body, err := xml.Marshal(deleteRequest)
+	if err != nil {
+		return nil, err
+	}
+	req, err := copyRequest(origReq)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = &reqBody{bytes: body}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	md5Sum := md5.Sum(body)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]))
+	if _, err := hex.DecodeString(req.Header.Get("X-Amz-Content-Sha256")); err == nil && req.Header.Get("X-Amz-Content-Sha256") != "" {
+		sha256Sum := sha256.Sum256(body)
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sha256Sum[:]))
+	}
+	return req, nil
+}
+
+// mergeDeleteObjectsResults combines shards results in order of requested
+// objects. Object is reported as deleted only if no shard failed to delete it
+func mergeDeleteObjectsResults(req *http.Request, deleteRequest types.DeleteObjectsRequest, results <-chan deleteObjectsResult) (*http.Response, error) {
+	deleted := make(map[types.ObjectIdentifier]types.DeletedObject)
+	failed := make(map[types.ObjectIdentifier]types.DeleteError)
+	for result := range results {
+		if result.err != nil {
+			logger.WithFields(log.Fields{"request_id": utils.RequestID(req), "shard": result.shard}).Warnf("DeleteObjects request failed: %s", result.err)
+			for _, object := range result.objects {
+				if _, ok := failed[object]; !ok {
+					failed[object] = types.DeleteError{Key: object.Key, VersionID: object.VersionID,
+						Code: types.S3ErrInternalError, Message: result.err.Error()}
+				}
+			}
+			continue
+		}
+		for _, deleteError := range result.result.Errors {
+			object := types.ObjectIdentifier{Key: deleteError.Key, VersionID: deleteError.VersionID}
+			if _, ok := failed[object]; !ok {
+				failed[object] = deleteError
+			}
+		}
+		for _, deletedObject := range result.result.Deleted {
+			object := types.ObjectIdentifier{Key: deletedObject.Key, VersionID: deletedObject.VersionID}
+			if _, ok := deleted[object]; !ok {
+				deleted[object] = deletedObject
+			}
+		}
+	}
+
+	merged := types.DeleteObjectsResult{Xmlns: types.S3Namespace}
+	for _, object := range deleteRequest.Objects {
+		if deleteError, ok := failed[object]; ok {
+			merged.Errors = append(merged.Errors, deleteError)
+			delete(failed, object)
+			continue
+		}
+		if deletedObject, ok := deleted[object]; ok {
+			merged.Deleted = append(merged.Deleted, deletedObject)
+			delete(deleted, object)
+		}
+	}
+	body, err := xml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	body = append([]byte(xml.Header), body...)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package sharding
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDeleteObjectsRequestShouldListGivenObjectsOnly(t *testing.T) {
+	origReq, err := http.NewRequest(http.MethodPost, "http://localhost/bucket?delete", bytes.NewBufferString("<Delete></Delete>"))
+	require.NoError(t, err)
+	origReq.Header.Set("Content-MD5", "stale")
+
+	req, err := newDeleteObjectsRequest(origReq, types.DeleteObjectsRequest{
+		Quiet:   true,
+		Objects: []types.ObjectIdentifier{{Key: "a"}, {Key: "b", VersionID: "v1"}},
+	})
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(body)), req.ContentLength)
+	md5Sum := md5.Sum(body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(md5Sum[:]), req.Header.Get("Content-MD5"))
+	assert.Equal(t, "stale", origReq.Header.Get("Content-MD5"))
+	deleteRequest := types.DeleteObjectsRequest{}
+	require.NoError(t, xml.Unmarshal(body, &deleteRequest))
+	assert.True(t, deleteRequest.Quiet)
+	assert.Equal(t, []types.ObjectIdentifier{{Key: "a"}, {Key: "b", VersionID: "v1"}}, deleteRequest.Objects)
+}
+
+func TestMergeDeleteObjectsResultsShouldKeepRequestOrderAndReportFailures(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/bucket?delete", nil)
+	require.NoError(t, err)
+	deleteRequest := types.DeleteObjectsRequest{
+		Objects: []types.ObjectIdentifier{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}},
+	}
+	results := make(chan deleteObjectsResult, 4)
+	results <- deleteObjectsResult{
+		shard:   "shard1",
+		objects: []types.ObjectIdentifier{{Key: "a"}, {Key: "c"}},
+		result: types.DeleteObjectsResult{
+			Deleted: []types.DeletedObject{{Key: "c"}},
+			Errors:  []types.DeleteError{{Key: "a", Code: "AccessDenied", Message: "Access Denied"}},
+		},
+	}
+	results <- deleteObjectsResult{
+		shard:   "shard2",
+		objects: []types.ObjectIdentifier{{Key: "b"}, {Key: "d"}},
+		result:  types.DeleteObjectsResult{Deleted: []types.DeletedObject{{Key: "b"}, {Key: "d"}}},
+	}
+	results <- deleteObjectsResult{
+		shard:   "shard2-regression",
+		objects: []types.ObjectIdentifier{{Key: "b"}, {Key: "d"}},
+		err:     errors.New("InternalError: We encountered an internal error"),
+	}
+	results <- deleteObjectsResult{
+		shard:   "shard1-regression",
+		objects: []types.ObjectIdentifier{{Key: "a"}, {Key: "c"}},
+		result:  types.DeleteObjectsResult{Deleted: []types.DeletedObject{{Key: "a"}, {Key: "c"}}},
+	}
+	close(results)
+
+	resp, err := mergeDeleteObjectsResults(req, deleteRequest, results)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<DeleteResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	merged := types.DeleteObjectsResult{}
+	require.NoError(t, xml.Unmarshal(body, &merged))
+	assert.Equal(t, []types.DeletedObject{{Key: "c"}}, merged.Deleted)
+	require.Len(t, merged.Errors, 3)
+	assert.Equal(t, "a", merged.Errors[0].Key)
+	assert.Equal(t, "AccessDenied", merged.Errors[0].Code)
+	assert.Equal(t, "b", merged.Errors[1].Key)
+	assert.Equal(t, types.S3ErrInternalError, merged.Errors[1].Code)
+	assert.Equal(t, "d", merged.Errors[2].Key)
+}
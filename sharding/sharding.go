@@ -3,13 +3,17 @@ package sharding
 import (
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/regions/config"
 	"github.com/allegro/akubra/storages"
-	"github.com/serialx/hashring"
 )
 
+// logger logs ring decisions, enable Debug level of "sharding" subsystem to
+// trace them
+var logger = log.For("sharding")
+
 // RingFactory produces clients ShardsRing
 type RingFactory struct {
 	conf     config.ShardingPolicies
@@ -22,7 +26,7 @@ func (rf RingFactory) createRegressionMap(config config.Policies) (map[string]st
 	lastClusterName := config.Shards[len(config.Shards)-1].ShardName
 	previousCluster, err := rf.storages.GetShard(lastClusterName)
 	if err != nil {
-		log.Printf("Last cluster in region not defined in storages")
+		logger.WithField("shard", lastClusterName).Warnf("Last cluster in region not defined in storages")
 	}
 	for _, cluster := range config.Shards {
 		clientCluster, err := rf.storages.GetShard(cluster.ShardName)
@@ -35,15 +39,15 @@ func (rf RingFactory) createRegressionMap(config config.Policies) (map[string]st
 	return regressionMap, nil
 }
 
-func (rf RingFactory) getRegionClustersWeights(regionCfg config.Policies) map[string]int {
-	res := make(map[string]int)
+func (rf RingFactory) getRegionClustersWeights(regionCfg config.Policies) map[string]float64 {
+	res := make(map[string]float64)
 	for _, clusterConfig := range regionCfg.Shards {
-		res[clusterConfig.ShardName] = int(math.Floor(clusterConfig.Weight * 100))
+		res[clusterConfig.ShardName] = clusterConfig.Weight
 	}
 	return res
 }
 
-func (rf RingFactory) makeRegionClusterMap(clientClusters map[string]int) (map[string]storages.NamedShardClient, error) {
+func (rf RingFactory) makeRegionClusterMap(clientClusters map[string]float64) (map[string]storages.NamedShardClient, error) {
 	res := make(map[string]storages.NamedShardClient, len(clientClusters))
 	for name := range clientClusters {
 		cl, err := rf.storages.GetShard(name)
@@ -61,15 +65,37 @@ func (rf RingFactory) RegionRing(name string, regionCfg config.Policies) (Shards
 
 	shardClusterMap, err := rf.makeRegionClusterMap(clustersWeights)
 	if err != nil {
-		log.Debugf("cluster map creation error %s\n", err)
+		logger.WithField("region", name).Debugf("Cluster map creation error %s", err)
 		return ShardsRing{}, err
 	}
 	var regionShards []storages.NamedShardClient
 	for _, cluster := range shardClusterMap {
 		regionShards = append(regionShards, cluster)
 	}
+	var canary storages.NamedShardClient
+	var canaryThreshold uint32
+	if regionCfg.Canary != nil {
+		canary, err = rf.storages.GetShard(regionCfg.Canary.ShardName)
+		if err != nil {
+			return ShardsRing{}, err
+		}
+		regionShards = append(regionShards, canary)
+		canaryThreshold = uint32(math.Floor(regionCfg.Canary.Percentage * canaryResolution / 100))
+	}
+
+	keyPrefixes, prefixShards, err := rf.keyPrefixes(regionCfg, regionShards)
+	if err != nil {
+		return ShardsRing{}, err
+	}
+	regionShards = append(regionShards, prefixShards...)
 
-	cHashMap := hashring.NewWithWeights(clustersWeights)
+	drainedShards := make(map[string]bool)
+	for _, clusterConfig := range regionCfg.Shards {
+		if clusterConfig.Drained {
+			drainedShards[clusterConfig.ShardName] = true
+		}
+	}
+	ringLayouts := newLayouts(clustersWeights, drainedShards)
 
 	allBackendsRoundTripper := rf.storages.MergeShards(fmt.Sprintf("region-%s", name), regionShards...)
 	regressionMap, err := rf.createRegressionMap(regionCfg)
@@ -77,12 +103,49 @@ func (rf RingFactory) RegionRing(name string, regionCfg config.Policies) (Shards
 		return ShardsRing{}, err
 	}
 
+	var load *shardsLoad
+	if regionCfg.BoundedLoad != nil {
+		load = newShardsLoad(regionCfg.BoundedLoad.Factor)
+	}
+
 	return ShardsRing{
-		ring:                    cHashMap,
+		name:                    name,
+		ring:                    ringLayouts.current.ring,
+		layouts:                 ringLayouts,
 		shardClusterMap:         shardClusterMap,
 		allClustersRoundTripper: allBackendsRoundTripper,
 		clusterRegressionMap:    regressionMap,
-		inconsistencyLog:        rf.syncLog}, nil
+		inconsistencyLog:        rf.syncLog,
+		canary:                  canary,
+		canaryThreshold:         canaryThreshold,
+		keyPrefixes:             keyPrefixes,
+		load:                    load}, nil
+}
+
+// keyPrefixes resolves shards of region key prefixes, shards not already in
+// region are returned too, so bucket listings include their keys
+func (rf RingFactory) keyPrefixes(regionCfg config.Policies, regionShards []storages.NamedShardClient) ([]keyPrefix, []storages.NamedShardClient, error) {
+	known := make(map[string]bool, len(regionShards))
+	for _, shard := range regionShards {
+		known[shard.Name()] = true
+	}
+	keyPrefixes := make([]keyPrefix, 0, len(regionCfg.KeyPrefixes))
+	var newShards []storages.NamedShardClient
+	for _, prefixCfg := range regionCfg.KeyPrefixes {
+		shard, err := rf.storages.GetShard(prefixCfg.ShardName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !known[shard.Name()] {
+			known[shard.Name()] = true
+			newShards = append(newShards, shard)
+		}
+		keyPrefixes = append(keyPrefixes, keyPrefix{path: prefixCfg.Bucket + "/" + prefixCfg.Prefix, shard: shard})
+	}
+	sort.SliceStable(keyPrefixes, func(i, j int) bool {
+		return len(keyPrefixes[i].path) > len(keyPrefixes[j].path)
+	})
+	return keyPrefixes, newShards, nil
 }
 
 // NewRingFactory creates ring factory
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -15,11 +16,17 @@ import (
 	"github.com/allegro/akubra/metrics"
 	"github.com/allegro/akubra/storages"
 	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
 	"github.com/serialx/hashring"
 )
 
 const (
 	noTimeoutRegressionHeader = "X-Akubra-No-Regression-On-Failure"
+	// allShards is routing shard of requests sent to all shards of region
+	allShards = "*"
+	// canaryResolution is number of keyspace slices canary percentage is
+	// applied to
+	canaryResolution = 10000
 )
 
 // ShardsRingAPI interface
@@ -30,11 +37,28 @@ type ShardsRingAPI interface {
 // ShardsRing implements http.RoundTripper interface,
 // and directs requests to determined shard
 type ShardsRing struct {
+	// name of region
+	name                    string
 	ring                    *hashring.HashRing
 	shardClusterMap         map[string]storages.NamedShardClient
 	allClustersRoundTripper http.RoundTripper
 	clusterRegressionMap    map[string]storages.NamedShardClient
 	inconsistencyLog        log.Logger
+	// canary serves keys which hash falls below canaryThreshold
+	canary          storages.NamedShardClient
+	canaryThreshold uint32
+	// keyPrefixes are sorted from longest, so the most specific prefix wins
+	keyPrefixes []keyPrefix
+	// load of shards, keys are picked from ring only if it's nil
+	load *shardsLoad
+	// layouts replace ring if weights may be changed at runtime
+	layouts *layouts
+}
+
+// keyPrefix routes keys starting with path ("bucket/prefix") to shard
+type keyPrefix struct {
+	path  string
+	shard storages.NamedShardClient
 }
 
 func (sr ShardsRing) isBucketPath(path string) bool {
@@ -44,9 +68,40 @@ func (sr ShardsRing) isBucketPath(path string) bool {
 
 // Pick finds cluster for given relative uri
 func (sr ShardsRing) Pick(key string) (storages.NamedShardClient, error) {
+	if shard, ok := sr.prefixShard(key); ok {
+		return shard, nil
+	}
+	if sr.inCanary(key) {
+		return sr.canary, nil
+	}
+	return sr.pickFromRing(key)
+}
+
+// inCanary reports if key belongs to keyspace part served by canary shard
+func (sr ShardsRing) inCanary(key string) bool {
+	if sr.canary == nil {
+		return false
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return hash.Sum32()%canaryResolution < sr.canaryThreshold
+}
+
+// prefixShard returns shard of the longest key prefix matching key
+func (sr ShardsRing) prefixShard(key string) (storages.NamedShardClient, bool) {
+	trimmedKey := strings.TrimPrefix(key, "/")
+	for _, prefix := range sr.keyPrefixes {
+		if strings.HasPrefix(trimmedKey, prefix.path) {
+			return prefix.shard, true
+		}
+	}
+	return nil, false
+}
+
+func (sr ShardsRing) pickFromRing(key string) (storages.NamedShardClient, error) {
 	var shardName string
 
-	shardName, ok := sr.ring.GetNode(key)
+	shardName, ok := sr.currentRing().GetNode(key)
 	if !ok {
 		return &storages.ShardClient{}, fmt.Errorf("no shard for key %s", key)
 	}
@@ -58,6 +113,36 @@ func (sr ShardsRing) Pick(key string) (storages.NamedShardClient, error) {
 	return shardCluster, nil
 }
 
+// pickWithLoad finds cluster for given relative uri, with bounded load it may
+// be a next shard on ring if shard of key is overloaded. Name of shard key
+// belongs to and function releasing load are returned too
+func (sr ShardsRing) pickWithLoad(key string) (storages.NamedShardClient, string, func(), error) {
+	_, prefixed := sr.prefixShard(key)
+	if sr.load == nil || prefixed || sr.inCanary(key) {
+		cl, err := sr.Pick(key)
+		if err != nil {
+			return cl, "", nil, err
+		}
+		return cl, cl.Name(), func() {}, nil
+	}
+	// Shards with zero weight aren't on ring, so not all shards may be found
+	candidates, _ := sr.currentRing().GetNodes(key, len(sr.shardClusterMap))
+	if len(candidates) == 0 {
+		return &storages.ShardClient{}, "", nil, fmt.Errorf("no shard for key %s", key)
+	}
+	name, release := sr.load.acquire(candidates)
+	shardCluster, ok := sr.shardClusterMap[name]
+	if !ok {
+		release()
+		return &storages.ShardClient{}, "", nil, fmt.Errorf("no cluster for shard %s, cannot handle key %s", name, key)
+	}
+	if name != candidates[0] {
+		metrics.Mark("reqs.spill." + metrics.Clean(candidates[0]))
+		logger.WithFields(log.Fields{"key": key, "shard": name}).Debugf("Key spilled from overloaded shard %s", candidates[0])
+	}
+	return shardCluster, candidates[0], release, nil
+}
+
 type reqBody struct {
 	bytes []byte
 	r     io.Reader
@@ -90,12 +175,15 @@ func copyRequest(origReq *http.Request) (*http.Request, error) {
 		}
 	}
 
+	if _, ok := origReq.Body.(types.Resetter); ok {
+		return newReq, nil
+	}
 	if origReq.Body != nil {
 		buf := &bytes.Buffer{}
 		defer func() {
 			err := origReq.Body.Close()
 			if err != nil {
-				log.Printf("Request body close error: %s", err)
+				logger.Warnf("Request body close error: %s", err)
 			}
 		}()
 		n, err := io.Copy(buf, origReq.Body)
@@ -113,6 +201,24 @@ func copyRequest(origReq *http.Request) (*http.Request, error) {
 	return newReq, nil
 }
 
+// streamRequest replaces buffered body with its source if shard streams bodies
+func streamRequest(cl storages.NamedShardClient, req *http.Request) (*http.Request, bool) {
+	if !cl.StreamsBody() {
+		return nil, false
+	}
+	streamer, ok := req.Body.(types.Streamer)
+	if !ok {
+		return nil, false
+	}
+	source, ok := streamer.Stream()
+	if !ok {
+		return nil, false
+	}
+	streamedReq := *req
+	streamedReq.Body = ioutil.NopCloser(source)
+	return &streamedReq, true
+}
+
 func (sr ShardsRing) send(roundTripper http.RoundTripper, req *http.Request) (*http.Response, error) {
 	// Rewind request body
 	bodyResetter, ok := req.Body.(types.Resetter)
@@ -126,23 +232,49 @@ func (sr ShardsRing) send(roundTripper http.RoundTripper, req *http.Request) (*h
 func closeBody(resp *http.Response, reqID string) {
 	_, discardErr := io.Copy(ioutil.Discard, resp.Body)
 	if discardErr != nil {
-		log.Printf("Cannot discard response body for req %s, reason: %q",
-			reqID, discardErr.Error())
+		logger.WithField("request_id", reqID).Warnf("Cannot discard response body, reason: %q", discardErr.Error())
 	}
 	closeErr := resp.Body.Close()
 	if closeErr != nil {
-		log.Printf("Cannot close response body for req %s, reason: %q",
-			reqID, closeErr.Error())
+		logger.WithField("request_id", reqID).Warnf("Cannot close response body, reason: %q", closeErr.Error())
 	}
-	log.Debugf("ResponseBody for request %s closed with %s error (regression)", reqID, closeErr)
+	logger.WithField("request_id", reqID).Debugf("ResponseBody closed with %s error (regression)", closeErr)
 }
 
 func (sr ShardsRing) regressionCall(cl storages.NamedShardClient, origClusterName string, req *http.Request) (string, *http.Response, error) {
 	resp, err := sr.send(cl, req)
 	// Do regression call if response status is > 400
 	if shouldCallRegression(req, resp, err) {
+		if sr.overridesRing(cl, req.URL.Path) {
+			// Keys not migrated to canary or prefix shard yet are read from shard they'd have without it
+			if rcl, pickErr := sr.pickFromRing(req.URL.Path); pickErr == nil && rcl.Name() != cl.Name() {
+				regressionLog(req, cl).Debugf("Key not found on overriding shard, trying ring shard %s", rcl.Name())
+				if resp != nil && resp.Body != nil {
+					reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+					closeBody(resp, reqID)
+				}
+				return sr.regressionCall(rcl, rcl.Name(), req)
+			}
+			return cl.Name(), resp, err
+		}
+		// Keys not moved yet after weights change or drain are read from
+		// shards they belonged to first
+		if cl.Name() == origClusterName && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+			for _, fcl := range sr.fallbackShards(req.URL.Path, cl) {
+				regressionLog(req, cl).Debugf("Key not found, trying shard %s of previous ring layout", fcl.Name())
+				if resp != nil && resp.Body != nil {
+					reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+					closeBody(resp, reqID)
+				}
+				resp, err = sr.send(fcl, req)
+				if !shouldCallRegression(req, resp, err) {
+					return fcl.Name(), resp, err
+				}
+			}
+		}
 		rcl, ok := sr.clusterRegressionMap[cl.Name()]
 		if ok && rcl.Name() != origClusterName {
+			regressionLog(req, cl).Debugf("Key not found, trying regression shard %s", rcl.Name())
 			if resp != nil && resp.Body != nil {
 				reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
 				closeBody(resp, reqID)
@@ -153,6 +285,23 @@ func (sr ShardsRing) regressionCall(cl storages.NamedShardClient, origClusterNam
 	return cl.Name(), resp, err
 }
 
+// regressionLog returns logger of regression call to shard cl
+func regressionLog(req *http.Request, cl storages.NamedShardClient) log.LeveledLogger {
+	return logger.WithFields(log.Fields{"request_id": utils.RequestID(req), "key": req.URL.Path, "shard": cl.Name()})
+}
+
+func (sr ShardsRing) isCanary(cl storages.NamedShardClient) bool {
+	return sr.canary != nil && cl.Name() == sr.canary.Name()
+}
+
+// overridesRing reports if cl serves key instead of shard picked from ring
+func (sr ShardsRing) overridesRing(cl storages.NamedShardClient, key string) bool {
+	if shard, ok := sr.prefixShard(key); ok {
+		return shard.Name() == cl.Name()
+	}
+	return sr.isCanary(cl)
+}
+
 func shouldCallRegression(request *http.Request, response *http.Response, err error) bool {
 	if err == nil && response != nil {
 		return (response.StatusCode > 400) && (response.StatusCode < 500)
@@ -200,19 +349,43 @@ func (sr ShardsRing) DoRequest(req *http.Request) (resp *http.Response, rerr err
 
 	isBucketReq := sr.isBucketPath(reqCopy.URL.Path)
 
+	routing := types.RoutingOf(reqCopy.Context())
+	if isBucketReq && isDeleteObjectsRequest(reqCopy) {
+		routing.SetShard(sr.name, allShards)
+		return sr.deleteObjects(reqCopy)
+	}
+
+	decisionLog := logger.WithFields(log.Fields{"request_id": utils.RequestID(reqCopy), "key": reqCopy.URL.Path})
 	if reqCopy.Method == http.MethodDelete || isBucketReq {
+		routing.SetShard(sr.name, allShards)
+		decisionLog.Debugf("%s request sent to all shards of region", reqCopy.Method)
 		return sr.allClustersRoundTripper.RoundTrip(reqCopy)
 	}
 
-	cl, err := sr.Pick(reqCopy.URL.Path)
+	cl, home, release, err := sr.pickWithLoad(reqCopy.URL.Path)
 	if err != nil {
+		decisionLog.Debugf("No shard picked: %s", err)
 		return nil, err
 	}
+	decisionLog.WithField("shard", cl.Name()).Debugf("Key picked shard, ring shard of key is %s", home)
+
+	if streamedReq, ok := streamRequest(cl, reqCopy); ok {
+		// Streamed body cannot be replayed, so there is no regression call
+		routing.SetShard(sr.name, cl.Name())
+		resp, err = cl.RoundTrip(streamedReq)
+		if (cl.Name() != home) && (reqCopy.Method == http.MethodPut) {
+			sr.logInconsistency(reqCopy.URL.Path, home, cl.Name())
+		}
+		return releaseOnClose(resp, release), err
+	}
 
+	// Regression walks all shards of region, so keys written to shard they
+	// spilled to are found as well
 	clusterName, resp, err := sr.regressionCall(cl, cl.Name(), reqCopy)
-	if (clusterName != cl.Name()) && (reqCopy.Method == http.MethodPut) {
-		sr.logInconsistency(reqCopy.URL.Path, cl.Name(), clusterName)
+	routing.SetShard(sr.name, clusterName)
+	if (clusterName != home) && (reqCopy.Method == http.MethodPut) {
+		sr.logInconsistency(reqCopy.URL.Path, home, clusterName)
 	}
 
-	return resp, err
+	return releaseOnClose(resp, release), err
 }
@@ -0,0 +1,256 @@
+package sharding
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/storages"
+	"github.com/allegro/akubra/types"
+	"github.com/serialx/hashring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shardStub struct {
+	name   string
+	status int
+	calls  int
+}
+
+func (ss *shardStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	ss.calls++
+	return &http.Response{StatusCode: ss.status, Request: req}, nil
+}
+
+func (ss *shardStub) Name() string {
+	return ss.name
+}
+
+func (ss *shardStub) Backends() []*storages.StorageClient {
+	return nil
+}
+
+func (ss *shardStub) StreamsBody() bool {
+	return false
+}
+
+func canaryRing(old, canary *shardStub, percentage float64) ShardsRing {
+	return ShardsRing{
+		ring:                 hashring.New([]string{old.name}),
+		shardClusterMap:      map[string]storages.NamedShardClient{old.name: old},
+		clusterRegressionMap: map[string]storages.NamedShardClient{old.name: old},
+		canary:               canary,
+		canaryThreshold:      uint32(percentage * canaryResolution / 100),
+	}
+}
+
+func canaryKeys(ring ShardsRing) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("/bucket/key%d", i)
+		shard, err := ring.Pick(key)
+		if err == nil && shard.Name() == "canary" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+func TestCanaryShouldServePercentageOfKeys(t *testing.T) {
+	old, canary := &shardStub{name: "old"}, &shardStub{name: "canary"}
+
+	assert.Empty(t, canaryKeys(canaryRing(old, canary, 0)))
+	assert.Len(t, canaryKeys(canaryRing(old, canary, 100)), 1000)
+	tenPercent := canaryKeys(canaryRing(old, canary, 10))
+	assert.InDelta(t, 100, len(tenPercent), 40)
+	thirtyPercent := canaryKeys(canaryRing(old, canary, 30))
+	for key := range tenPercent {
+		assert.True(t, thirtyPercent[key], "key %s should stay on canary", key)
+	}
+}
+
+func TestCanaryShouldFallBackToShardFromRing(t *testing.T) {
+	old := &shardStub{name: "old", status: http.StatusOK}
+	canary := &shardStub{name: "canary", status: http.StatusNotFound}
+	ring := canaryRing(old, canary, 100)
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+
+	resp, err := ring.DoRequest(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, canary.calls)
+	assert.Equal(t, 1, old.calls)
+}
+
+func TestRoutingShouldRecordShardWhichServedRequest(t *testing.T) {
+	old := &shardStub{name: "old", status: http.StatusOK}
+	canary := &shardStub{name: "canary", status: http.StatusNotFound}
+	ring := canaryRing(old, canary, 100)
+	ring.name = "eu"
+	routing := &types.Routing{}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+
+	_, err = ring.DoRequest(req.WithContext(types.WithRouting(req.Context(), routing)))
+
+	require.NoError(t, err)
+	region, shard := routing.Shard()
+	assert.Equal(t, "eu", region)
+	assert.Equal(t, "old", shard)
+}
+
+func TestKeyPrefixShouldRouteKeysToPrefixShard(t *testing.T) {
+	old, canary := &shardStub{name: "old"}, &shardStub{name: "canary"}
+	media, thumbs := &shardStub{name: "media"}, &shardStub{name: "thumbs"}
+	ring := canaryRing(old, canary, 100)
+	ring.keyPrefixes = []keyPrefix{{path: "giant/media/thumbs/", shard: thumbs}, {path: "giant/media/", shard: media}}
+
+	testCases := map[string]string{
+		"/giant/media/video.mp4":      "media",
+		"/giant/media/thumbs/img.png": "thumbs",
+		"/giant/other/key":            "canary",
+		"/other/media/key":            "canary",
+	}
+	for key, expected := range testCases {
+		shard, err := ring.Pick(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, shard.Name(), key)
+	}
+}
+
+func TestKeyPrefixShouldFallBackToShardFromRing(t *testing.T) {
+	old := &shardStub{name: "old", status: http.StatusOK}
+	media := &shardStub{name: "media", status: http.StatusNotFound}
+	ring := canaryRing(old, &shardStub{name: "canary"}, 0)
+	ring.keyPrefixes = []keyPrefix{{path: "giant/media/", shard: media}}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/giant/media/key", nil)
+	require.NoError(t, err)
+
+	resp, err := ring.DoRequest(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, media.calls)
+	assert.Equal(t, 1, old.calls)
+}
+
+func boundedLoadRing(shards ...*shardStub) ShardsRing {
+	names := make([]string, 0, len(shards))
+	clusters := make(map[string]storages.NamedShardClient, len(shards))
+	for _, shard := range shards {
+		names = append(names, shard.name)
+		clusters[shard.name] = shard
+	}
+	return ShardsRing{
+		ring:            hashring.New(names),
+		shardClusterMap: clusters,
+		load:            newShardsLoad(1.25),
+	}
+}
+
+func TestBoundedLoadShouldSpillKeysOfOverloadedShard(t *testing.T) {
+	ring := boundedLoadRing(&shardStub{name: "first"}, &shardStub{name: "second"}, &shardStub{name: "third"})
+	owner, ok := ring.ring.GetNode("/bucket/key")
+	require.True(t, ok)
+
+	cl, home, release, err := ring.pickWithLoad("/bucket/key")
+	require.NoError(t, err)
+	spilled, spilledHome, releaseSpilled, err := ring.pickWithLoad("/bucket/key")
+	require.NoError(t, err)
+
+	assert.Equal(t, owner, cl.Name())
+	assert.Equal(t, owner, home)
+	assert.NotEqual(t, owner, spilled.Name())
+	assert.Equal(t, owner, spilledHome)
+	release()
+	releaseSpilled()
+	cl, _, release, err = ring.pickWithLoad("/bucket/key")
+	require.NoError(t, err)
+	assert.Equal(t, owner, cl.Name())
+	release()
+	assert.Equal(t, int64(0), ring.load.total)
+}
+
+func TestBoundedLoadShouldBeReleasedWhenResponseBodyIsClosed(t *testing.T) {
+	load := newShardsLoad(1.25)
+	_, release := load.acquire([]string{"first", "second"})
+	resp := releaseOnClose(&http.Response{Body: ioutil.NopCloser(strings.NewReader("content"))}, release)
+
+	assert.Equal(t, int64(1), load.inFlight["first"])
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, int64(0), load.inFlight["first"])
+	assert.Equal(t, int64(0), load.total)
+}
+
+func weightedRing(weights map[string]float64, drained map[string]bool, shards ...*shardStub) ShardsRing {
+	clusters := make(map[string]storages.NamedShardClient, len(shards))
+	for _, shard := range shards {
+		clusters[shard.name] = shard
+	}
+	ringLayouts := newLayouts(weights, drained)
+	return ShardsRing{
+		ring:                 ringLayouts.current.ring,
+		layouts:              ringLayouts,
+		shardClusterMap:      clusters,
+		clusterRegressionMap: map[string]storages.NamedShardClient{},
+	}
+}
+
+func TestWeightsChangeShouldKeepPreviousRingForRegression(t *testing.T) {
+	old := &shardStub{name: "old", status: http.StatusOK}
+	recent := &shardStub{name: "recent", status: http.StatusNotFound}
+	ring := weightedRing(map[string]float64{"old": 1, "recent": 0}, nil, old, recent)
+	require.NoError(t, ring.SetWeights(map[string]float64{"old": 0, "recent": 1}))
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+
+	resp, err := ring.DoRequest(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, recent.calls)
+	assert.Equal(t, 1, old.calls)
+	assert.Equal(t, map[string]float64{"old": 0, "recent": 1}, ring.Weights())
+}
+
+func TestWeightsChangeShouldBeValidated(t *testing.T) {
+	ring := weightedRing(map[string]float64{"old": 1, "recent": 0}, nil, &shardStub{name: "old"}, &shardStub{name: "recent"})
+
+	assert.EqualError(t, ring.SetWeights(map[string]float64{"other": 1}), `shard "other" is not in ring`)
+	assert.EqualError(t, ring.SetWeights(map[string]float64{"recent": 2}), `weight 2 of shard "recent" should be in range [0, 1]`)
+	assert.EqualError(t, ring.SetWeights(map[string]float64{"old": 0}), "weights sum is zero")
+	assert.Equal(t, map[string]float64{"old": 1, "recent": 0}, ring.Weights())
+}
+
+func TestDrainedShardShouldServeOnlyReadsOfKeysNotMovedYet(t *testing.T) {
+	drained := &shardStub{name: "drained", status: http.StatusOK}
+	remaining := &shardStub{name: "remaining", status: http.StatusNotFound}
+	ring := weightedRing(map[string]float64{"drained": 1, "remaining": 1}, map[string]bool{"drained": true}, drained, remaining)
+	key := ""
+	for i := 0; key == ""; i++ {
+		if owner, _ := ring.layouts.drained.ring.GetNode(fmt.Sprintf("/bucket/key%d", i)); owner == "drained" {
+			key = fmt.Sprintf("/bucket/key%d", i)
+		}
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		req, err := http.NewRequest(method, "http://localhost"+key, nil)
+		require.NoError(t, err)
+		resp, err := ring.DoRequest(req)
+		require.NoError(t, err)
+		if method == http.MethodGet {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	assert.Equal(t, 2, remaining.calls)
+	assert.Equal(t, 1, drained.calls)
+	assert.Equal(t, map[string]float64{"drained": 0, "remaining": 1}, ring.Weights())
+	assert.EqualError(t, ring.SetWeights(map[string]float64{"drained": 1}), `shard "drained" is drained`)
+}
@@ -0,0 +1,158 @@
+package sharding
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/allegro/akubra/storages"
+	"github.com/serialx/hashring"
+)
+
+// ringLayout is ring built from shards weights
+type ringLayout struct {
+	ring    *hashring.HashRing
+	weights map[string]float64
+}
+
+func newRingLayout(weights map[string]float64) *ringLayout {
+	ringWeights := make(map[string]int, len(weights))
+	for name, weight := range weights {
+		ringWeights[name] = int(math.Floor(weight * 100))
+	}
+	return &ringLayout{ring: hashring.NewWithWeights(ringWeights), weights: weights}
+}
+
+// layouts keeps current ring of region and the one it replaced, so keys
+// not moved yet after weights change are read from shard of previous ring.
+// Drained shards are not in current ring, keys are read from them with ring
+// built from configured weights until they're moved
+type layouts struct {
+	mx       sync.RWMutex
+	current  *ringLayout
+	previous *ringLayout
+	drained  *ringLayout
+	// drainedShards can't get weight
+	drainedShards map[string]bool
+}
+
+func newLayouts(weights map[string]float64, drainedShards map[string]bool) *layouts {
+	l := &layouts{drainedShards: drainedShards}
+	if len(drainedShards) == 0 {
+		l.current = newRingLayout(weights)
+		return l
+	}
+	l.drained = newRingLayout(weights)
+	current := make(map[string]float64, len(weights))
+	for name, weight := range weights {
+		if drainedShards[name] {
+			weight = 0
+		}
+		current[name] = weight
+	}
+	l.current = newRingLayout(current)
+	return l
+}
+
+// rings returns current ring and rings keys are read from if they're not
+// found in shard of current one
+func (l *layouts) rings() (*hashring.HashRing, []*hashring.HashRing) {
+	l.mx.RLock()
+	defer l.mx.RUnlock()
+	fallbacks := make([]*hashring.HashRing, 0, 2)
+	for _, layout := range []*ringLayout{l.previous, l.drained} {
+		if layout != nil {
+			fallbacks = append(fallbacks, layout.ring)
+		}
+	}
+	return l.current.ring, fallbacks
+}
+
+// currentRing returns ring keys are picked from
+func (sr ShardsRing) currentRing() *hashring.HashRing {
+	if sr.layouts == nil {
+		return sr.ring
+	}
+	current, _ := sr.layouts.rings()
+	return current
+}
+
+// fallbackShards returns shards key belonged to before the last weights
+// change and before shards were drained, other than cl
+func (sr ShardsRing) fallbackShards(key string, cl storages.NamedShardClient) []storages.NamedShardClient {
+	if sr.layouts == nil {
+		return nil
+	}
+	_, rings := sr.layouts.rings()
+	seen := map[string]bool{cl.Name(): true}
+	shards := make([]storages.NamedShardClient, 0, len(rings))
+	for _, ring := range rings {
+		name, ok := ring.GetNode(key)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if shard, ok := sr.shardClusterMap[name]; ok {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// Weights returns current weights of region shards
+func (sr ShardsRing) Weights() map[string]float64 {
+	weights := make(map[string]float64)
+	if sr.layouts == nil {
+		return weights
+	}
+	sr.layouts.mx.RLock()
+	defer sr.layouts.mx.RUnlock()
+	for name, weight := range sr.layouts.current.weights {
+		weights[name] = weight
+	}
+	return weights
+}
+
+// SetWeights changes weights of given shards and rebuilds ring, the current
+// ring is kept as previous one for regression. Weights of drained shards
+// can't be changed
+func (sr ShardsRing) SetWeights(changes map[string]float64) error {
+	if sr.layouts == nil {
+		return fmt.Errorf("weights of ring cannot be changed")
+	}
+	sr.layouts.mx.Lock()
+	defer sr.layouts.mx.Unlock()
+	weights := make(map[string]float64, len(sr.layouts.current.weights))
+	for name, weight := range sr.layouts.current.weights {
+		weights[name] = weight
+	}
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		weight := changes[name]
+		if _, ok := weights[name]; !ok {
+			return fmt.Errorf("shard %q is not in ring", name)
+		}
+		if sr.layouts.drainedShards[name] {
+			return fmt.Errorf("shard %q is drained", name)
+		}
+		if weight < 0 || weight > 1 {
+			return fmt.Errorf("weight %v of shard %q should be in range [0, 1]", weight, name)
+		}
+		weights[name] = weight
+	}
+	sum := 0
+	for _, weight := range weights {
+		sum += int(math.Floor(weight * 100))
+	}
+	if sum == 0 {
+		return fmt.Errorf("weights sum is zero")
+	}
+	sr.layouts.previous = sr.layouts.current
+	sr.layouts.current = newRingLayout(weights)
+	return nil
+}
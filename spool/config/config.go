@@ -0,0 +1,16 @@
+package config
+
+import "github.com/allegro/akubra/types"
+
+// Spooling configures request bodies buffering, bodies are buffered so they
+// can be sent to many backends
+type Spooling struct {
+	// MemoryLimit is maximal part of single body kept in memory, rest is written
+	// to temporary file, default: 8MB
+	MemoryLimit types.HumanSizeUnits `yaml:"MemoryLimit"`
+	// TempDir is directory for temporary files, default: os.TempDir()
+	TempDir string `yaml:"TempDir"`
+	// IdleFiles is number of temporary files of released bodies kept open
+	// for reuse, default: 0
+	IdleFiles int `yaml:"IdleFiles"`
+}
@@ -0,0 +1,434 @@
+package spool
+
+import (
+	"crypto/md5"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/spool/config"
+)
+
+const (
+	chunkSize          = 64 * 1024
+	defaultMemoryLimit = 8 * 1024 * 1024
+)
+
+// chunkPool has no New function, so misses can be counted
+var chunkPool = sync.Pool{}
+
+// getChunk takes chunk from pool, hits and misses are counted in
+// spool.chunks.hit and spool.chunks.miss meters
+func getChunk() []byte {
+	if chunk, ok := chunkPool.Get().([]byte); ok {
+		metrics.Mark("spool.chunks.hit")
+		return chunk
+	}
+	metrics.Mark("spool.chunks.miss")
+	return make([]byte, chunkSize)
+}
+
+// openFiles counts temporary files of spooled bodies
+var openFiles int64
+
+// OpenFiles returns number of temporary files of bodies not released yet
+func OpenFiles() int64 {
+	return atomic.LoadInt64(&openFiles)
+}
+
+// ErrBodyReleased is returned by readers created after body was released
+var ErrBodyReleased = errors.New("spooled body already released")
+
+// ErrBodyStreamed is returned by readers of body which source was streamed
+var ErrBodyStreamed = errors.New("body was streamed, it cannot be replayed")
+
+// Spooler buffers bodies in memory chunks and temporary files
+type Spooler struct {
+	memoryLimit int64
+	tempDir     string
+	// idleFiles are truncated files of released bodies, ready for reuse
+	idleFiles chan *os.File
+	// closed Spooler keeps no idle files, mx guards it
+	closed bool
+	mx     sync.Mutex
+}
+
+// New creates Spooler
+func New(conf config.Spooling) *Spooler {
+	memoryLimit := conf.MemoryLimit.SizeInBytes
+	if memoryLimit <= 0 {
+		memoryLimit = defaultMemoryLimit
+	}
+	return &Spooler{memoryLimit: memoryLimit, tempDir: conf.TempDir, idleFiles: make(chan *os.File, conf.IdleFiles)}
+}
+
+// tempFile returns idle file or creates new one, file is removed from
+// directory at once, so it never outlives process. Reuses are counted in
+// spool.files.hit and spool.files.miss meters
+func (s *Spooler) tempFile() (*os.File, error) {
+	select {
+	case file := <-s.idleFiles:
+		metrics.Mark("spool.files.hit")
+		return file, nil
+	default:
+	}
+	metrics.Mark("spool.files.miss")
+	file, err := ioutil.TempFile(s.tempDir, "akubra-spool-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(file.Name()); err != nil {
+		log.Printf("Cannot remove spool file %s: %s", file.Name(), err)
+	}
+	return file, nil
+}
+
+// releaseFile keeps file for reuse if there is room for it and Spooler
+// isn't closed, otherwise file is closed
+func (s *Spooler) releaseFile(file *os.File) {
+	if err := file.Truncate(0); err == nil {
+		if _, err = file.Seek(0, io.SeekStart); err == nil && s.keepIdle(file) {
+			return
+		}
+	}
+	closeFile(file)
+}
+
+func (s *Spooler) keepIdle(file *os.File) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.idleFiles <- file:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes idle files, files of bodies released later are closed at once.
+// Spooler may still be used to spool bodies
+func (s *Spooler) Close() {
+	if s == nil {
+		return
+	}
+	s.mx.Lock()
+	s.closed = true
+	s.mx.Unlock()
+	for {
+		select {
+		case file := <-s.idleFiles:
+			closeFile(file)
+		default:
+			return
+		}
+	}
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Printf("Cannot close spool file %s: %s", file.Name(), err)
+	}
+}
+
+// Spool reads whole r. Up to memory limit (rounded up to 64KB) is kept in
+// memory, rest is written to temporary file.
+func (s *Spooler) Spool(r io.Reader) (*Body, error) {
+	body := s.Lazy(r)
+	if err := body.spoolSource(); err != nil {
+		body.release()
+		return nil, err
+	}
+	return body, nil
+}
+
+// Lazy creates Body which reads r on first Read or Reset call, until then r
+// may be streamed instead
+func (s *Spooler) Lazy(r io.Reader) *Body {
+	return &Body{refs: 1, source: r, spooler: s}
+}
+
+// spoolSource reads source once, it returns error if reading failed or
+// source was streamed
+func (b *Body) spoolSource() error {
+	b.spoolOnce.Do(b.spool)
+	return b.err
+}
+
+func (b *Body) spool() {
+	hash := md5.New()
+	source := io.TeeReader(b.source, hash)
+	defer func() {
+		if b.err == nil {
+			b.md5 = hash.Sum(nil)
+		}
+	}()
+	for b.memSize < b.spooler.memoryLimit {
+		chunk := getChunk()
+		n, err := io.ReadFull(source, chunk)
+		if n > 0 {
+			b.chunks = append(b.chunks, chunk)
+			b.memSize += int64(n)
+		} else {
+			chunkPool.Put(chunk)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			b.size = b.memSize
+			return
+		}
+		if err != nil {
+			b.err = err
+			return
+		}
+	}
+	b.err = b.spooler.spill(b, source)
+}
+
+// spill writes rest of r to temporary file
+func (s *Spooler) spill(body *Body, r io.Reader) error {
+	chunk := getChunk()
+	defer chunkPool.Put(chunk)
+	n, err := io.ReadFull(r, chunk)
+	if n == 0 {
+		body.size = body.memSize
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	file, err := s.tempFile()
+	if err != nil {
+		return err
+	}
+	body.file = file
+	atomic.AddInt64(&openFiles, 1)
+	metrics.Mark("spool.spilled")
+	written, err := file.Write(chunk[:n])
+	if err != nil {
+		return err
+	}
+	copied, err := io.Copy(file, r)
+	if err != nil {
+		return err
+	}
+	body.size = body.memSize + int64(written) + copied
+	return nil
+}
+
+// Body is spooled content, it implements types.Resetter, each reset returns
+// independent reader. Memory and temporary file are released when Body and
+// all readers are closed.
+type Body struct {
+	source    io.Reader
+	spooler   *Spooler
+	spoolOnce sync.Once
+	err       error
+	chunks    [][]byte
+	memSize   int64
+	file      *os.File
+	size      int64
+	md5       []byte
+	refs      int32
+	reader    *reader
+	once      sync.Once
+	// deferred body is spooled on first read of reader returned by Reset,
+	// so source isn't read until backend accepts body
+	deferred bool
+}
+
+// Size returns body length, it is known after body is spooled
+func (b *Body) Size() int64 {
+	return b.size
+}
+
+// MD5 returns checksum of body computed while spooling, it's known after
+// body is spooled
+func (b *Body) MD5() ([]byte, bool) {
+	return b.md5, b.md5 != nil
+}
+
+// Stream returns source reader if body wasn't spooled yet, afterwards body
+// cannot be read nor reset
+func (b *Body) Stream() (io.Reader, bool) {
+	streamed := false
+	b.spoolOnce.Do(func() {
+		streamed = true
+		b.err = ErrBodyStreamed
+	})
+	return b.source, streamed
+}
+
+// Read reads body from beginning, it doesn't affect readers returned by Reset
+func (b *Body) Read(p []byte) (int, error) {
+	if err := b.spoolSource(); err != nil {
+		return 0, err
+	}
+	if b.reader == nil {
+		b.reader = &reader{body: b}
+	}
+	return b.reader.read(p)
+}
+
+// Close releases body, readers returned by Reset remain valid until closed
+func (b *Body) Close() error {
+	b.once.Do(b.release)
+	return nil
+}
+
+// Reset returns new reader of whole body
+func (b *Body) Reset() io.ReadCloser {
+	if b.deferred {
+		return b.newReader()
+	}
+	if err := b.spoolSource(); err != nil {
+		return ioutil.NopCloser(errReader{err})
+	}
+	return b.newReader()
+}
+
+func (b *Body) newReader() io.ReadCloser {
+	for {
+		refs := atomic.LoadInt32(&b.refs)
+		if refs <= 0 {
+			return ioutil.NopCloser(errReader{ErrBodyReleased})
+		}
+		if atomic.CompareAndSwapInt32(&b.refs, refs, refs+1) {
+			return &reader{body: b}
+		}
+	}
+}
+
+func (b *Body) release() {
+	if atomic.AddInt32(&b.refs, -1) > 0 {
+		return
+	}
+	for _, chunk := range b.chunks {
+		chunkPool.Put(chunk)
+	}
+	b.chunks = nil
+	if b.file == nil {
+		return
+	}
+	atomic.AddInt64(&openFiles, -1)
+	b.spooler.releaseFile(b.file)
+}
+
+func (b *Body) readAt(p []byte, offset int64) (int, error) {
+	if offset >= b.size {
+		return 0, io.EOF
+	}
+	if offset < b.memSize {
+		chunk := b.chunks[offset/chunkSize]
+		end := b.memSize - offset/chunkSize*chunkSize
+		if end > chunkSize {
+			end = chunkSize
+		}
+		return copy(p, chunk[offset%chunkSize:end]), nil
+	}
+	n, err := b.file.ReadAt(p, offset-b.memSize)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+type reader struct {
+	body   *Body
+	offset int64
+	once   sync.Once
+}
+
+func (r *reader) read(p []byte) (int, error) {
+	if err := r.body.spoolSource(); err != nil {
+		return 0, err
+	}
+	n, err := r.body.readAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Read implements io.Reader
+func (r *reader) Read(p []byte) (int, error) {
+	return r.read(p)
+}
+
+// Close releases reader reference to body
+func (r *reader) Close() error {
+	r.once.Do(r.body.release)
+	return nil
+}
+
+// MD5 returns checksum of body
+func (r *reader) MD5() ([]byte, bool) {
+	return r.body.MD5()
+}
+
+// Reset returns new reader of whole body
+func (r *reader) Reset() io.ReadCloser {
+	return r.body.Reset()
+}
+
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read([]byte) (int, error) {
+	return 0, er.err
+}
+
+type spoolingRoundTripper struct {
+	roundTripper http.RoundTripper
+	spooler      *Spooler
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (srt *spoolingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return srt.roundTripper.RoundTrip(req)
+	}
+	body := srt.spooler.Lazy(req.Body)
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil {
+			log.Debugf("Cannot close spooled body: %s", closeErr)
+		}
+	}()
+	spooledReq := *req
+	spooledReq.Body = body
+	// Client waits for 100 Continue, which is sent on first read of body,
+	// so body is read after first backend accepts it
+	body.deferred = expectsContinue(req)
+	if req.ContentLength < 0 {
+		// Backends need body length, so body of unknown size is spooled at once
+		if err := body.spoolSource(); err != nil {
+			return nil, err
+		}
+		spooledReq.ContentLength = body.Size()
+	}
+	if spooledReq.ContentLength == 0 {
+		spooledReq.Body = http.NoBody
+	}
+	return srt.roundTripper.RoundTrip(&spooledReq)
+}
+
+func expectsContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+}
+
+// Decorator creates httphandler.Decorator buffering request bodies with
+// spooler, so they can be replayed for each backend. Bodies of known length are
+// spooled on first use, so they may be streamed instead.
+func Decorator(spooler *Spooler) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return &spoolingRoundTripper{roundTripper: roundTripper, spooler: spooler}
+	}
+}
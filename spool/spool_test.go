@@ -0,0 +1,266 @@
+package spool
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/allegro/akubra/spool/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	return content
+}
+
+func readAll(t *testing.T, body interface {
+	Read([]byte) (int, error)
+	Close() error
+}) []byte {
+	content, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	return content
+}
+
+func TestShouldKeepSmallBodyInMemory(t *testing.T) {
+	content := randomContent(100 * 1024)
+	body, err := New(config.Spooling{}).Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+
+	assert.Nil(t, body.file)
+	assert.Equal(t, int64(len(content)), body.Size())
+	assert.Equal(t, content, readAll(t, body.Reset()))
+	assert.Equal(t, content, readAll(t, body.Reset()))
+	assert.Equal(t, content, readAll(t, body))
+}
+
+func TestShouldSpillBodyOverMemoryLimitToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-spool")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	content := randomContent(300*1024 + 17)
+	spooler := New(config.Spooling{MemoryLimit: types.HumanSizeUnits{SizeInBytes: 1}, TempDir: dir})
+
+	body, err := spooler.Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.NotNil(t, body.file)
+	assert.Equal(t, int64(chunkSize), body.memSize)
+	assert.Equal(t, int64(1), OpenFiles())
+
+	readers := []*reader{body.Reset().(*reader), body.Reset().(*reader), body.Reset().(*reader)}
+	require.NoError(t, body.Close())
+	wg := sync.WaitGroup{}
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r *reader) {
+			defer wg.Done()
+			assert.Equal(t, content, readAll(t, r))
+		}(r)
+	}
+	wg.Wait()
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Equal(t, int64(0), OpenFiles())
+}
+
+func TestShouldNotCreateFileForBodyOfMemoryLimitSize(t *testing.T) {
+	content := randomContent(chunkSize)
+	spooler := New(config.Spooling{MemoryLimit: types.HumanSizeUnits{SizeInBytes: chunkSize}})
+
+	body, err := spooler.Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+
+	assert.Nil(t, body.file)
+	assert.Equal(t, content, readAll(t, body.Reset()))
+	require.NoError(t, body.Close())
+}
+
+func TestShouldReuseFileOfReleasedBody(t *testing.T) {
+	spooler := New(config.Spooling{MemoryLimit: types.HumanSizeUnits{SizeInBytes: 1}, IdleFiles: 1})
+	longer := randomContent(300*1024 + 17)
+	shorter := randomContent(100*1024 + 3)
+
+	first, err := spooler.Spool(bytes.NewReader(longer))
+	require.NoError(t, err)
+	file := first.file
+	require.NoError(t, first.Close())
+
+	second, err := spooler.Spool(bytes.NewReader(shorter))
+	require.NoError(t, err)
+	assert.Equal(t, file, second.file)
+	assert.Equal(t, shorter, readAll(t, second.Reset()))
+	require.NoError(t, second.Close())
+	assert.Equal(t, int64(0), OpenFiles())
+}
+
+func TestCloseShouldCloseIdleFiles(t *testing.T) {
+	spooler := New(config.Spooling{MemoryLimit: types.HumanSizeUnits{SizeInBytes: 1}, IdleFiles: 1})
+	content := randomContent(100 * 1024)
+	idle, err := spooler.Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+	inFlight, err := spooler.Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+	idleFile, inFlightFile := idle.file, inFlight.file
+	require.NoError(t, idle.Close())
+
+	spooler.Close()
+	require.NoError(t, inFlight.Close())
+
+	assert.Empty(t, spooler.idleFiles)
+	for _, file := range []*os.File{idleFile, inFlightFile} {
+		_, err = file.Stat()
+		assert.Error(t, err, "file should be closed")
+	}
+}
+
+func TestShouldComputeChecksumWhileSpooling(t *testing.T) {
+	content := randomContent(300*1024 + 17)
+	spooler := New(config.Spooling{MemoryLimit: types.HumanSizeUnits{SizeInBytes: 1}})
+	lazy := spooler.Lazy(bytes.NewReader(content))
+	_, ok := lazy.MD5()
+	require.False(t, ok, "checksum is unknown before spooling")
+
+	body, err := spooler.Spool(bytes.NewReader(content))
+	require.NoError(t, err)
+	digester := body.Reset().(types.Digester)
+	expected := md5.Sum(content)
+
+	digest, ok := digester.MD5()
+	require.True(t, ok)
+	assert.Equal(t, expected[:], digest)
+	require.NoError(t, digester.(*reader).Close())
+	require.NoError(t, body.Close())
+	require.NoError(t, lazy.Close())
+}
+
+func TestResetAfterReleaseShouldFail(t *testing.T) {
+	body, err := New(config.Spooling{}).Spool(bytes.NewBufferString("content"))
+	require.NoError(t, err)
+	require.NoError(t, body.Close())
+	require.NoError(t, body.Close())
+
+	_, err = ioutil.ReadAll(body.Reset())
+	assert.Equal(t, ErrBodyReleased, err)
+}
+
+func TestLazyBodyShouldBeStreamedOnlyBeforeFirstRead(t *testing.T) {
+	spooler := New(config.Spooling{})
+	source := bytes.NewBufferString("content")
+
+	streamed := spooler.Lazy(source)
+	reader, ok := streamed.Stream()
+	require.True(t, ok)
+	assert.Equal(t, source, reader)
+	_, err := ioutil.ReadAll(streamed.Reset())
+	assert.Equal(t, ErrBodyStreamed, err)
+
+	spooled := spooler.Lazy(bytes.NewBufferString("content"))
+	assert.Equal(t, "content", string(readAll(t, spooled.Reset())))
+	_, ok = spooled.Stream()
+	assert.False(t, ok)
+	require.NoError(t, spooled.Close())
+}
+
+type bodyCapturingRoundTripper struct {
+	request *http.Request
+	body    []byte
+}
+
+func (bcrt *bodyCapturingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bcrt.request = req
+	resetter, ok := req.Body.(types.Resetter)
+	if !ok {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	reset := resetter.Reset()
+	defer reset.Close()
+	body, err := ioutil.ReadAll(reset)
+	bcrt.body = body
+	return &http.Response{StatusCode: http.StatusOK}, err
+}
+
+func TestDecoratorShouldReplaceBodyWithSpooledOne(t *testing.T) {
+	backend := &bodyCapturingRoundTripper{}
+	spooling := Decorator(New(config.Spooling{}))(backend)
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewBufferString("content"))
+	req.ContentLength = -1
+	_, err := spooling.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(backend.body))
+	assert.Equal(t, int64(len("content")), backend.request.ContentLength)
+}
+
+func TestDecoratorShouldNotSpoolBodyOfKnownLengthUpfront(t *testing.T) {
+	backend := &bodyStreamingRoundTripper{}
+	spooling := Decorator(New(config.Spooling{}))(backend)
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewBufferString("content"))
+	_, err := spooling.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.True(t, backend.streamed)
+}
+
+type bodyStreamingRoundTripper struct {
+	streamed bool
+}
+
+func (bsrt *bodyStreamingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, bsrt.streamed = req.Body.(types.Streamer).Stream()
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestDecoratorShouldPassEmptyBodyAsNoBody(t *testing.T) {
+	backend := &bodyCapturingRoundTripper{}
+	spooling := Decorator(New(config.Spooling{}))(backend)
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewBuffer(nil))
+	_, err := spooling.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.NoBody, backend.request.Body)
+}
+
+func TestDecoratorShouldReadBodyExpectingContinueOnFirstReadOfReset(t *testing.T) {
+	source := bytes.NewBufferString("content")
+	var unreadBeforeRead int
+	var content []byte
+	backend := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		rejected := req.Body.(types.Resetter).Reset()
+		require.NoError(t, rejected.Close())
+		accepted := req.Body.(types.Resetter).Reset()
+		unreadBeforeRead = source.Len()
+		content = readAll(t, accepted)
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	spooling := Decorator(New(config.Spooling{}))(backend)
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", source)
+	req.Header.Set("Expect", "100-continue")
+	_, err := spooling.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, len("content"), unreadBeforeRead)
+	assert.Equal(t, "content", string(content))
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
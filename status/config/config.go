@@ -0,0 +1,25 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// Status configures probes served on technical endpoint under /status/
+type Status struct {
+	// Listen is address of dedicated probes listener, optional
+	Listen string `yaml:"Listen"`
+	// CheckInterval of backends and credentials stores, default: 5s
+	CheckInterval metrics.Interval `yaml:"CheckInterval"`
+	// CheckTimeout of single backend or credentials store check, default: 2s
+	CheckTimeout metrics.Interval `yaml:"CheckTimeout"`
+	// Readiness criteria of /status/ready
+	Readiness Readiness `yaml:"Readiness"`
+}
+
+// Readiness defines what has to be healthy for proxy to accept traffic
+type Readiness struct {
+	// MinHealthyBackends of each required shard, default: 1
+	MinHealthyBackends int `yaml:"MinHealthyBackends"`
+	// Shards required to be ready, all if empty
+	Shards []string `yaml:"Shards"`
+	// CredentialsStores required to be reachable
+	CredentialsStores []string `yaml:"CredentialsStores"`
+}
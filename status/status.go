@@ -0,0 +1,289 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/status/config"
+)
+
+const (
+	defaultCheckInterval = 5 * time.Second
+	defaultCheckTimeout  = 2 * time.Second
+)
+
+// Checkable is component which reachability may be checked
+type Checkable interface {
+	Check(ctx context.Context) error
+}
+
+// Targets are components checked by Status, backends are grouped by shards
+type Targets struct {
+	Backends          map[string]http.RoundTripper
+	Shards            map[string][]string
+	CredentialsStores map[string]Checkable
+}
+
+// Component is state of backend or credentials store
+type Component struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Shard is state of shard backends
+type Shard struct {
+	Ready           bool `json:"ready"`
+	HealthyBackends int  `json:"healthyBackends"`
+	Backends        int  `json:"backends"`
+}
+
+// Report is result of last check, Healthy means all components are healthy,
+// Ready means readiness criteria are met
+type Report struct {
+	Ready             bool                 `json:"ready"`
+	Healthy           bool                 `json:"healthy"`
+	Reasons           []string             `json:"reasons,omitempty"`
+	CheckedAt         time.Time            `json:"checkedAt"`
+	Shards            map[string]Shard     `json:"shards"`
+	Backends          map[string]Component `json:"backends"`
+	CredentialsStores map[string]Component `json:"credentialsStores"`
+}
+
+// Status checks backends and credentials stores periodically and serves
+// liveness, readiness and health probes
+type Status struct {
+	conf         config.Status
+	mx           sync.RWMutex
+	targets      *Targets
+	report       Report
+	shuttingDown int32
+	checks       chan struct{}
+}
+
+// New creates Status, proxy isn't ready until targets are set and checked
+func New(conf config.Status) *Status {
+	if conf.CheckInterval.Duration <= 0 {
+		conf.CheckInterval.Duration = defaultCheckInterval
+	}
+	if conf.CheckTimeout.Duration <= 0 {
+		conf.CheckTimeout.Duration = defaultCheckTimeout
+	}
+	if conf.Readiness.MinHealthyBackends <= 0 {
+		conf.Readiness.MinHealthyBackends = 1
+	}
+	return &Status{
+		conf:   conf,
+		report: Report{Reasons: []string{"not checked yet"}},
+		checks: make(chan struct{}, 1),
+	}
+}
+
+// Start checks targets every CheckInterval and whenever they're changed
+func (s *Status) Start() {
+	go func() {
+		ticker := time.NewTicker(s.conf.CheckInterval.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.checks:
+			}
+			s.Check()
+		}
+	}()
+}
+
+// SetTargets replaces checked components, they're checked in background
+func (s *Status) SetTargets(targets Targets) {
+	s.mx.Lock()
+	s.targets = &targets
+	s.mx.Unlock()
+	select {
+	case s.checks <- struct{}{}:
+	default:
+	}
+}
+
+// ShutDown makes proxy not ready, so load balancers stop sending requests
+// before listener is closed
+func (s *Status) ShutDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+// Check checks all targets at once and returns new report
+func (s *Status) Check() Report {
+	s.mx.RLock()
+	targets := s.targets
+	s.mx.RUnlock()
+	if targets == nil {
+		return s.Report()
+	}
+	report := Report{
+		CheckedAt:         time.Now(),
+		Shards:            make(map[string]Shard),
+		Backends:          make(map[string]Component),
+		CredentialsStores: make(map[string]Component),
+	}
+	resultsMx := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	check := func(results map[string]Component, name string, checkFunc func(ctx context.Context) error) {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), s.conf.CheckTimeout.Duration)
+		defer cancel()
+		component := Component{Healthy: true}
+		if err := checkFunc(ctx); err != nil {
+			component = Component{Error: err.Error()}
+		}
+		resultsMx.Lock()
+		results[name] = component
+		resultsMx.Unlock()
+	}
+	for name, backend := range targets.Backends {
+		wg.Add(1)
+		go check(report.Backends, name, backendCheck(backend))
+	}
+	for name, store := range targets.CredentialsStores {
+		wg.Add(1)
+		go check(report.CredentialsStores, name, store.Check)
+	}
+	wg.Wait()
+	s.evaluate(&report, targets)
+
+	s.mx.Lock()
+	wasReady := s.report.Ready
+	s.report = report
+	s.mx.Unlock()
+	if wasReady != report.Ready {
+		log.Printf("Readiness changed to %t %v", report.Ready, report.Reasons)
+	}
+	return report
+}
+
+// evaluate fills shards states and judges health and readiness of report
+func (s *Status) evaluate(report *Report, targets *Targets) {
+	report.Healthy = true
+	for _, component := range report.Backends {
+		report.Healthy = report.Healthy && component.Healthy
+	}
+	for _, component := range report.CredentialsStores {
+		report.Healthy = report.Healthy && component.Healthy
+	}
+	for name, backends := range targets.Shards {
+		shard := Shard{Backends: len(backends)}
+		for _, backend := range backends {
+			if report.Backends[backend].Healthy {
+				shard.HealthyBackends++
+			}
+		}
+		shard.Ready = shard.HealthyBackends >= s.conf.Readiness.MinHealthyBackends
+		report.Shards[name] = shard
+	}
+	requiredShards := s.conf.Readiness.Shards
+	if len(requiredShards) == 0 {
+		for name := range targets.Shards {
+			requiredShards = append(requiredShards, name)
+		}
+		sort.Strings(requiredShards)
+	}
+	for _, name := range requiredShards {
+		shard, defined := report.Shards[name]
+		if !defined {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("shard %s is not defined", name))
+			continue
+		}
+		if !shard.Ready {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("shard %s has %d of %d required healthy backends",
+				name, shard.HealthyBackends, s.conf.Readiness.MinHealthyBackends))
+		}
+	}
+	for _, name := range s.conf.Readiness.CredentialsStores {
+		if !report.CredentialsStores[name].Healthy {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("credentials store %s is unreachable", name))
+		}
+	}
+	report.Ready = len(report.Reasons) == 0
+	metrics.UpdateGauge("status.ready", boolToInt(report.Ready))
+	metrics.UpdateGauge("status.healthy", boolToInt(report.Healthy))
+}
+
+// Report returns result of last check
+func (s *Status) Report() Report {
+	s.mx.RLock()
+	report := s.report
+	s.mx.RUnlock()
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		report.Ready = false
+		report.Reasons = append([]string{"shutting down"}, report.Reasons...)
+	}
+	return report
+}
+
+// Register adds /status/ping, /status/ready and /status/health handlers to mux
+func (s *Status) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/status/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, no-store")
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "OK")
+	})
+	mux.HandleFunc("/status/ready", func(w http.ResponseWriter, r *http.Request) {
+		report := s.Report()
+		writeReport(w, report, report.Ready)
+	})
+	mux.HandleFunc("/status/health", func(w http.ResponseWriter, r *http.Request) {
+		report := s.Report()
+		writeReport(w, report, report.Healthy)
+	})
+}
+
+func writeReport(w http.ResponseWriter, report Report, ok bool) {
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Cannot write status report: %s", err)
+	}
+}
+
+// backendCheck sends HEAD request to backend root, any response below 500
+// means backend is healthy
+func backendCheck(backend http.RoundTripper) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodHead, "/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := backend.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if resp.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				log.Debugf("Cannot close status check response body: %s", closeErr)
+			}
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("responded with status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func boolToInt(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
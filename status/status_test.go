@@ -0,0 +1,118 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/status/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backendStub struct {
+	status int
+	err    error
+}
+
+func (bs *backendStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	if bs.err != nil {
+		return nil, bs.err
+	}
+	return &http.Response{StatusCode: bs.status, Request: req}, nil
+}
+
+type storeStub struct {
+	err error
+}
+
+func (ss *storeStub) Check(context.Context) error {
+	return ss.err
+}
+
+func newTargets() Targets {
+	return Targets{
+		Backends: map[string]http.RoundTripper{
+			"dc1": &backendStub{status: http.StatusForbidden},
+			"dc2": &backendStub{status: http.StatusBadGateway},
+			"dc3": &backendStub{err: errors.New("connection refused")},
+		},
+		Shards: map[string][]string{
+			"main":    {"dc1", "dc2"},
+			"archive": {"dc3"},
+		},
+		CredentialsStores: map[string]Checkable{
+			"default": &storeStub{},
+			"backup":  &storeStub{err: errors.New("timeout")},
+		},
+	}
+}
+
+func get(t *testing.T, s *Status, path string) (int, Report) {
+	mux := http.NewServeMux()
+	s.Register(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	report := Report{}
+	if path != "/status/ping" {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	}
+	return w.Code, report
+}
+
+func TestShouldNotBeReadyUntilTargetsAreChecked(t *testing.T) {
+	s := New(config.Status{})
+
+	code, report := get(t, s, "/status/ready")
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"not checked yet"}, report.Reasons)
+	code, _ = get(t, s, "/status/ping")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestShouldReportReadinessByConfiguredCriteria(t *testing.T) {
+	s := New(config.Status{Readiness: config.Readiness{Shards: []string{"main"}, CredentialsStores: []string{"default"}}})
+	s.SetTargets(newTargets())
+
+	report := s.Check()
+
+	assert.True(t, report.Ready)
+	assert.False(t, report.Healthy)
+	assert.Equal(t, Shard{Ready: true, HealthyBackends: 1, Backends: 2}, report.Shards["main"])
+	assert.Equal(t, Component{Error: "responded with status 502"}, report.Backends["dc2"])
+	assert.Equal(t, Component{Error: "timeout"}, report.CredentialsStores["backup"])
+	code, _ := get(t, s, "/status/ready")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get(t, s, "/status/health")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestShouldNotBeReadyIfRequiredComponentsAreUnhealthy(t *testing.T) {
+	s := New(config.Status{Readiness: config.Readiness{MinHealthyBackends: 2, CredentialsStores: []string{"backup"}}})
+	s.SetTargets(newTargets())
+
+	report := s.Check()
+
+	assert.False(t, report.Ready)
+	assert.Equal(t, []string{
+		"shard archive has 0 of 2 required healthy backends",
+		"shard main has 1 of 2 required healthy backends",
+		"credentials store backup is unreachable",
+	}, report.Reasons)
+}
+
+func TestShouldNotBeReadyWhenShuttingDown(t *testing.T) {
+	s := New(config.Status{Readiness: config.Readiness{Shards: []string{"main"}}})
+	s.SetTargets(newTargets())
+	require.True(t, s.Check().Ready)
+
+	s.ShutDown()
+
+	code, report := get(t, s, "/status/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, []string{"shutting down"}, report.Reasons)
+}
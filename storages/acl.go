@@ -0,0 +1,41 @@
+package storages
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+)
+
+// isBucketACLRequest reports if request is addressed to bucket ?acl subresource
+func isBucketACLRequest(request *http.Request) bool {
+	_, acl := request.URL.Query()["acl"]
+	return acl && isBucketPath(request.URL.Path)
+}
+
+// aclResponsePicker applies bucket ACL on all backends. Like bucket delete,
+// failure of any backend is returned to client. Backends which failed while
+// others succeeded are logged and written to synclog, so ACL is reapplied
+type aclResponsePicker struct {
+	*deleteResponsePicker
+}
+
+func newACLResponsePicker(rch <-chan BackendResponse) responsePicker {
+	return &aclResponsePicker{newDeleteResponsePicker(rch).(*deleteResponsePicker)}
+}
+
+// SendSyncLog implements picker interface
+func (arp *aclResponsePicker) SendSyncLog(syncLog *SyncSender) {
+	<-arp.syncLogReady
+	failures := append(arp.errors, arp.softErrors...)
+	if arp.success == emptyBackendResponse || len(failures) == 0 {
+		return
+	}
+	failedBackends := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		failedBackends = append(failedBackends, failure.Backend.Name)
+	}
+	log.Printf("ACL of bucket %s diverges, it's not applied on backends %s, request %s",
+		arp.success.Request.URL.Path, strings.Join(failedBackends, ", "), arp.success.ReqID())
+	sendSynclogs(syncLog, arp.success, failures)
+}
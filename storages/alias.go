@@ -0,0 +1,104 @@
+package storages
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/utils"
+)
+
+// bucketAlias maps bucket name used by clients to name used by backends of
+// shard
+type bucketAlias struct {
+	external string
+	internal string
+}
+
+// bucketAliasOf returns alias of requested bucket
+func (c *ShardClient) bucketAliasOf(req *http.Request) (bucketAlias, bool) {
+	bucket, _ := utils.SplitBucketKey(req.URL.Path)
+	internal, ok := c.bucketAliases[bucket]
+	return bucketAlias{external: bucket, internal: internal}, ok
+}
+
+// aliasedRoundTrip sends request to backend bucket and restores client bucket
+// name in response
+func (c *ShardClient) aliasedRoundTrip(req *http.Request, alias bucketAlias) (*http.Response, error) {
+	metrics.Mark("reqs.alias." + metrics.Clean(alias.external))
+	resp, err := c.roundTrip(c.aliasedRequest(req, alias))
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	resp.Request = req
+	if !namesBucket(req, resp) {
+		return resp, nil
+	}
+	return unaliasResponse(resp, alias)
+}
+
+// aliasedRequest returns copy of request addressed to backend bucket, copy
+// source of aliased bucket is rewritten too
+func (c *ShardClient) aliasedRequest(req *http.Request, alias bucketAlias) *http.Request {
+	aliased := attemptRequest(req)
+	aliased.URL.Path = "/" + alias.internal + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, "/"), alias.external)
+	aliased.URL.RawPath = ""
+	copySource := aliased.Header.Get("X-Amz-Copy-Source")
+	if copySource == "" {
+		return aliased
+	}
+	source, err := url.PathUnescape(copySource)
+	if err != nil {
+		log.Debugf("Cannot unescape copy source %s: %s", copySource, err)
+		return aliased
+	}
+	bucket, key := utils.SplitBucketKey(source)
+	if internal, ok := c.bucketAliases[bucket]; ok && key != "" {
+		aliased.Header.Set("X-Amz-Copy-Source", (&url.URL{Path: "/" + internal + "/" + key}).EscapedPath())
+	}
+	return aliased
+}
+
+// namesBucket reports if response body may contain bucket name: listings,
+// multipart uploads and errors
+func namesBucket(req *http.Request, resp *http.Response) bool {
+	if req.Method == http.MethodHead || resp.Body == nil || !strings.Contains(resp.Header.Get("Content-Type"), "xml") {
+		return false
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return true
+	}
+	query := req.URL.Query()
+	_, uploads := query["uploads"]
+	_, uploadID := query["uploadId"]
+	return (isBucketPath(req.URL.Path) && req.Method == http.MethodGet) || (req.Method == http.MethodPost && (uploads || uploadID))
+}
+
+// unaliasResponse replaces backend bucket name with client bucket name in XML
+// response body
+func unaliasResponse(resp *http.Response, alias bucketAlias) (*http.Response, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		log.Debugf("Cannot close aliased response body: %s", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range []string{"Name", "Bucket", "BucketName"} {
+		body = bytes.Replace(body,
+			[]byte("<"+element+">"+alias.internal+"</"+element+">"),
+			[]byte("<"+element+">"+alias.external+"</"+element+">"), -1)
+	}
+	pathElements := regexp.MustCompile("(<(?:Resource|Location)>[^<]*?/)" + regexp.QuoteMeta(alias.internal) + "([/<])")
+	body = pathElements.ReplaceAll(body, []byte("${1}"+alias.external+"${2}"))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return resp, nil
+}
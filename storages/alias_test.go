@@ -0,0 +1,96 @@
+package storages
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func aliasedShard(respond func(*http.Request) (*http.Response, error)) *ShardClient {
+	return &ShardClient{
+		backends:          []*StorageClient{createDummyBackend(respond)},
+		requestDispatcher: newDispatcherMock(),
+		methodPolicies: map[string]string{
+			http.MethodGet:    config.SingleBackend,
+			config.ListMethod: config.SingleBackend,
+			http.MethodPut:    config.SingleBackend,
+		},
+		bucketAliases: map[string]string{"photos": "tenant1-photos", "docs": "tenant1-docs"},
+	}
+}
+
+func xmlResponse(req *http.Request, status int, body string) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	return &http.Response{Request: req, StatusCode: status, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestBucketAliasShouldRewriteRequestToBackendBucket(t *testing.T) {
+	var sent *http.Request
+	shard := aliasedShard(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{Request: req, StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	})
+	req, err := http.NewRequest(http.MethodPut, "http://localhost/photos/dir/key", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Amz-Copy-Source", "/docs/source%20key")
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, "/tenant1-photos/dir/key", sent.URL.Path)
+	assert.Equal(t, "/tenant1-docs/source%20key", sent.Header.Get("X-Amz-Copy-Source"))
+	assert.Equal(t, "/photos/dir/key", req.URL.Path, "client request should not change")
+	assert.Equal(t, req, resp.Request)
+}
+
+func TestBucketAliasShouldRestoreBucketNameInListing(t *testing.T) {
+	shard := aliasedShard(func(req *http.Request) (*http.Response, error) {
+		return xmlResponse(req, http.StatusOK, "<ListBucketResult><Name>tenant1-photos</Name><Contents><Key>tenant1-photos</Key></Contents></ListBucketResult>"), nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/photos", nil)
+	require.NoError(t, err)
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "<ListBucketResult><Name>photos</Name><Contents><Key>tenant1-photos</Key></Contents></ListBucketResult>", string(body))
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+}
+
+func TestBucketAliasShouldRestoreBucketNameInErrors(t *testing.T) {
+	shard := aliasedShard(func(req *http.Request) (*http.Response, error) {
+		return xmlResponse(req, http.StatusNotFound, "<Error><Code>NoSuchKey</Code><BucketName>tenant1-photos</BucketName><Resource>/tenant1-photos/key</Resource></Error>"), nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/photos/key", nil)
+	require.NoError(t, err)
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "<Error><Code>NoSuchKey</Code><BucketName>photos</BucketName><Resource>/photos/key</Resource></Error>", string(body))
+}
+
+func TestBucketAliasShouldNotChangeObjectContent(t *testing.T) {
+	shard := aliasedShard(func(req *http.Request) (*http.Response, error) {
+		return xmlResponse(req, http.StatusOK, "<Name>tenant1-photos</Name>"), nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/photos/document.xml", nil)
+	require.NoError(t, err)
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "<Name>tenant1-photos</Name>", string(body))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/allegro/akubra/crdstore"
 	"github.com/allegro/akubra/httphandler"
 	"github.com/allegro/akubra/storages/config"
 )
@@ -15,16 +16,28 @@ const (
 	S3FixedKey = "S3FixedKey"
 	// S3AuthService will sign requests using key from external source
 	S3AuthService = "S3AuthService"
+	// GCS will sign requests for Google Cloud Storage with HMAC key
+	GCS = "gcs"
+	// Azure will translate requests to Azure Blob Storage API signed with SharedKey
+	Azure = "azure"
+	// Swift will translate requests to OpenStack Swift API authorized with Keystone
+	Swift = "swift"
+	// FS will serve requests from local or NFS mounted directory
+	FS = "fs"
 )
 
+// DecoratorFactory creates decorator of backend, credentials stores are
+// stores of the handler backend belongs to
+type DecoratorFactory func(backend string, backendConf config.Storage, stores crdstore.Stores) (httphandler.Decorator, error)
+
 // Decorators maps Backend type with httphadler decorators factory
-var Decorators = map[string]func(string, config.Storage) (httphandler.Decorator, error){
-	Passthrough: func(string, config.Storage) (httphandler.Decorator, error) {
+var Decorators = map[string]DecoratorFactory{
+	Passthrough: func(string, config.Storage, crdstore.Stores) (httphandler.Decorator, error) {
 		return func(rt http.RoundTripper) http.RoundTripper {
 			return rt
 		}, nil
 	},
-	S3FixedKey: func(backend string, backendConf config.Storage) (httphandler.Decorator, error) {
+	S3FixedKey: func(backend string, backendConf config.Storage, _ crdstore.Stores) (httphandler.Decorator, error) {
 		accessKey, ok := backendConf.Properties["AccessKey"]
 		if !ok {
 			return nil, fmt.Errorf("no AccessKey defined for backend type %q", S3FixedKey)
@@ -42,12 +55,40 @@ var Decorators = map[string]func(string, config.Storage) (httphandler.Decorator,
 		methods := backendConf.Properties["Methods"]
 		return ForceSignDecorator(keys, backendConf.Backend.Host, methods), nil
 	},
-	S3AuthService: func(backend string, backendConf config.Storage) (httphandler.Decorator, error) {
+	S3AuthService: func(backend string, backendConf config.Storage, stores crdstore.Stores) (httphandler.Decorator, error) {
 		endpoint, ok := backendConf.Properties["AuthServiceEndpoint"]
 		if !ok {
 			endpoint = "default"
 		}
+		credentialsStore, err := stores.Get(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return SignAuthServiceDecorator(backend, backendConf.Backend.Host, credentialsStore), nil
+	},
+	GCS:   gcsDecoratorFactory,
+	Azure: azureDecoratorFactory,
+	Swift: swiftDecoratorFactory,
+	FS:    fsDecoratorFactory,
+}
 
-		return SignAuthServiceDecorator(backend, endpoint, backendConf.Backend.Host), nil
+// TypeCapabilities lists capabilities Backend types lack, translating types
+// support basic object operations only
+var TypeCapabilities = map[string]map[string]bool{
+	GCS: {
+		config.CapabilityStreamingSignatures: false,
+		config.CapabilityVersioning:          false,
+		config.CapabilityTagging:             false,
 	},
+	Azure: translatingTypeCapabilities(),
+	Swift: translatingTypeCapabilities(),
+	FS:    translatingTypeCapabilities(),
+}
+
+func translatingTypeCapabilities() map[string]bool {
+	capabilities := make(map[string]bool)
+	for _, capability := range config.KnownCapabilities {
+		capabilities[capability] = false
+	}
+	return capabilities
 }
@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+)
+
+// azureAPIVersion is Blob Storage REST API version requests are made with
+const azureAPIVersion = "2019-12-12"
+
+// azureAccessTiers maps S3 storage classes to block blob access tiers
+var azureAccessTiers = map[string]string{
+	"STANDARD":           "Hot",
+	"REDUCED_REDUNDANCY": "Hot",
+	"STANDARD_IA":        "Cool",
+	"ONEZONE_IA":         "Cool",
+	"GLACIER":            "Archive",
+	"DEEP_ARCHIVE":       "Archive",
+}
+
+// azureRequestHeaders are passed from S3 request to Azure request unchanged
+var azureRequestHeaders = []string{
+	"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language",
+	"Content-Length", "Content-MD5", "Content-Type", "If-Modified-Since",
+	"If-Unmodified-Since", "Range",
+}
+
+// azureResponseHeaders are passed from Azure response to S3 response unchanged
+var azureResponseHeaders = []string{
+	"Accept-Ranges", "Cache-Control", "Content-Disposition", "Content-Encoding",
+	"Content-Language", "Content-Length", "Content-Range", "Content-Type", "Date",
+	"Last-Modified",
+}
+
+type azureErrorMapping struct {
+	statusCode int
+	code       string
+}
+
+// azureErrors maps Blob Storage error codes to S3 ones
+var azureErrors = map[string]azureErrorMapping{
+	"BlobNotFound":         {http.StatusNotFound, types.S3ErrNoSuchKey},
+	"ContainerNotFound":    {http.StatusNotFound, types.S3ErrNoSuchBucket},
+	"AuthenticationFailed": {http.StatusForbidden, types.S3ErrAccessDenied},
+	"AuthorizationFailure": {http.StatusForbidden, types.S3ErrAccessDenied},
+	"ConditionNotMet":      {http.StatusPreconditionFailed, types.S3ErrPreconditionFailed},
+	"InvalidRange":         {http.StatusRequestedRangeNotSatisfiable, types.S3ErrInvalidRange},
+	"Md5Mismatch":          {http.StatusBadRequest, types.S3ErrBadDigest},
+	"RequestBodyTooLarge":  {http.StatusRequestEntityTooLarge, types.S3ErrEntityTooLarge},
+	"ServerBusy":           {http.StatusServiceUnavailable, types.S3ErrSlowDown},
+}
+
+type azureError struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+type azureEnumerationResults struct {
+	XMLName      xml.Name          `xml:"EnumerationResults"`
+	Blobs        []azureBlob       `xml:"Blobs>Blob"`
+	BlobPrefixes []azureBlobPrefix `xml:"Blobs>BlobPrefix"`
+	NextMarker   string            `xml:"NextMarker"`
+}
+
+type azureBlob struct {
+	Name       string              `xml:"Name"`
+	Properties azureBlobProperties `xml:"Properties"`
+}
+
+type azureBlobProperties struct {
+	LastModified  string `xml:"Last-Modified"`
+	Etag          string `xml:"Etag"`
+	ContentLength int64  `xml:"Content-Length"`
+	ContentType   string `xml:"Content-Type"`
+	ContentMD5    string `xml:"Content-MD5"`
+	AccessTier    string `xml:"AccessTier"`
+}
+
+type azureBlobPrefix struct {
+	Name string `xml:"Name"`
+}
+
+// azureRoundTripper translates S3 object requests to Azure Blob Storage REST
+// API calls signed with storage account SharedKey. Buckets are mapped to
+// containers and objects to block blobs
+type azureRoundTripper struct {
+	rt      http.RoundTripper
+	account string
+	key     []byte
+	host    string
+	now     func() time.Time
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (art azureRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			"Chunked upload signatures are not supported by Azure storage."), nil
+	}
+	container, blob := splitBucketKey(req.URL.Path)
+	switch {
+	case container == "":
+	case blob != "" && isAzureObjectRequest(req):
+		return art.objectRequest(req, container, blob)
+	case blob == "" && isListingRequest(req):
+		return art.listBlobs(req, container)
+	case blob == "" && req.Method == http.MethodHead && req.URL.RawQuery == "":
+		return art.headContainer(req, container)
+	}
+	return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+		"Operation is not supported by Azure storage."), nil
+}
+
+func (art azureRoundTripper) objectRequest(req *http.Request, container, blob string) (*http.Response, error) {
+	azReq := newTranslatedRequest(req, art.host, "/"+container+"/"+blob, nil)
+	if req.ContentLength != 0 {
+		azReq.Body = req.Body
+		azReq.ContentLength = req.ContentLength
+	}
+	copyHeaders(azReq.Header, req.Header, azureRequestHeaders)
+	renameHeaders(azReq.Header, req.Header, "X-Amz-Meta-", "X-Ms-Meta-")
+	if req.Method == http.MethodPut {
+		azReq.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+		if tier, ok := azureAccessTiers[req.Header.Get("X-Amz-Storage-Class")]; ok {
+			azReq.Header.Set("X-Ms-Access-Tier", tier)
+		}
+	}
+	resp, err := art.do(azReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		if req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+			// S3 reports deletes of missing objects as successful
+			closeResponseBody(req, resp)
+			return emptyResponse(req, http.StatusNoContent), nil
+		}
+		return translateAzureError(req, resp), nil
+	}
+	header := make(http.Header)
+	copyHeaders(header, resp.Header, azureResponseHeaders)
+	renameHeaders(header, resp.Header, "X-Ms-Meta-", "X-Amz-Meta-")
+	contentMD5 := resp.Header.Get("X-Ms-Blob-Content-Md5")
+	if contentMD5 == "" && resp.Header.Get("Content-Range") == "" {
+		contentMD5 = resp.Header.Get("Content-Md5")
+	}
+	header.Set("ETag", azureETag(contentMD5, resp.Header.Get("Etag")))
+	resp.Header = header
+	resp.Request = req
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		setStatus(resp, http.StatusOK)
+	case http.StatusAccepted:
+		setStatus(resp, http.StatusNoContent)
+	}
+	return resp, nil
+}
+
+func (art azureRoundTripper) headContainer(req *http.Request, container string) (*http.Response, error) {
+	azReq := newTranslatedRequest(req, art.host, "/"+container, url.Values{"restype": []string{"container"}})
+	resp, err := art.do(azReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return translateAzureError(req, resp), nil
+	}
+	closeResponseBody(req, resp)
+	return emptyResponse(req, http.StatusOK), nil
+}
+
+// listBlobs serves ListObjects and ListObjectsV2 with List Blobs call. Azure
+// markers are opaque, so they are returned as NextMarker and
+// NextContinuationToken and accepted back from clients
+func (art azureRoundTripper) listBlobs(req *http.Request, container string) (*http.Response, error) {
+	params, errResp := parseListingParams(req)
+	if errResp != nil {
+		return errResp, nil
+	}
+	azQuery := url.Values{
+		"restype":    []string{"container"},
+		"comp":       []string{"list"},
+		"maxresults": []string{strconv.FormatInt(params.maxKeys, 10)},
+	}
+	for name, value := range map[string]string{"prefix": params.prefix, "delimiter": params.delimiter, "marker": params.marker} {
+		if value != "" {
+			azQuery.Set(name, value)
+		}
+	}
+	resp, err := art.do(newTranslatedRequest(req, art.host, "/"+container, azQuery))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return translateAzureError(req, resp), nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	closeResponseBody(req, resp)
+	if err != nil {
+		return nil, err
+	}
+	enumeration := azureEnumerationResults{}
+	if err = xml.Unmarshal(body, &enumeration); err != nil {
+		return nil, fmt.Errorf("cannot parse Azure listing of %s: %s", container, err)
+	}
+
+	contents := make(s3datatypes.ObjectInfos, 0, len(enumeration.Blobs))
+	for _, blob := range enumeration.Blobs {
+		lastModified, _ := http.ParseTime(blob.Properties.LastModified)
+		contents = append(contents, s3datatypes.ObjectInfo{
+			Key:          blob.Name,
+			ETag:         azureETag(blob.Properties.ContentMD5, blob.Properties.Etag),
+			LastModified: lastModified,
+			Size:         blob.Properties.ContentLength,
+			StorageClass: "STANDARD",
+		})
+	}
+	prefixes := make(s3datatypes.CommonPrefixes, 0, len(enumeration.BlobPrefixes))
+	for _, prefix := range enumeration.BlobPrefixes {
+		prefixes = append(prefixes, s3datatypes.CommonPrefix{Prefix: prefix.Name})
+	}
+	return params.response(req, container, contents, prefixes, enumeration.NextMarker)
+}
+
+func (art azureRoundTripper) do(azReq *http.Request) (*http.Response, error) {
+	art.sign(azReq)
+	return art.rt.RoundTrip(azReq)
+}
+
+// sign adds SharedKey Authorization header, see
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (art azureRoundTripper) sign(req *http.Request) {
+	req.Header.Set("X-Ms-Date", art.now().UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+	mac := hmac.New(sha256.New, art.key)
+	_, _ = mac.Write([]byte(azureStringToSign(art.account, req)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", art.account, signature))
+}
+
+func azureStringToSign(account string, req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	return strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, X-Ms-Date is signed instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedAzureHeaders(req.Header) + canonicalizedAzureResource(account, req.URL),
+	}, "\n")
+}
+
+func canonicalizedAzureHeaders(header http.Header) string {
+	names := make([]string, 0)
+	values := make(map[string]string)
+	for name, value := range header {
+		lowerName := strings.ToLower(name)
+		if !strings.HasPrefix(lowerName, "x-ms-") {
+			continue
+		}
+		names = append(names, lowerName)
+		trimmed := make([]string, 0, len(value))
+		for _, v := range value {
+			trimmed = append(trimmed, strings.TrimSpace(v))
+		}
+		values[lowerName] = strings.Join(trimmed, ",")
+	}
+	sort.Strings(names)
+	buf := bytes.Buffer{}
+	for _, name := range names {
+		buf.WriteString(name + ":" + values[name] + "\n")
+	}
+	return buf.String()
+}
+
+func canonicalizedAzureResource(account string, resourceURL *url.URL) string {
+	buf := bytes.NewBufferString("/" + account + resourceURL.EscapedPath())
+	query := resourceURL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		buf.WriteString("\n" + strings.ToLower(name) + ":" + strings.Join(values, ","))
+	}
+	return buf.String()
+}
+
+// translateAzureError replaces Azure error response with S3 one
+func translateAzureError(req *http.Request, resp *http.Response) *http.Response {
+	code := resp.Header.Get("X-Ms-Error-Code")
+	message := http.StatusText(resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	closeResponseBody(req, resp)
+	azErr := azureError{}
+	if err == nil && xml.Unmarshal(body, &azErr) == nil {
+		if code == "" {
+			code = azErr.Code
+		}
+		if azErr.Message != "" {
+			// Message is followed by RequestId and Time lines
+			message = strings.SplitN(azErr.Message, "\n", 2)[0]
+		}
+	}
+	mapping, ok := azureErrors[code]
+	if !ok {
+		return types.NewS3ErrorResponseForStatus(req, resp.StatusCode)
+	}
+	return types.NewS3ErrorResponse(req, mapping.statusCode, mapping.code, message)
+}
+
+// azureETag returns S3 like ETag from blob MD5, Azure ETag is used for blobs
+// without stored MD5
+func azureETag(contentMD5, etag string) string {
+	md5Sum, err := base64.StdEncoding.DecodeString(contentMD5)
+	if contentMD5 == "" || err != nil {
+		return etag
+	}
+	return strconv.Quote(hex.EncodeToString(md5Sum))
+}
+
+func isAzureObjectRequest(req *http.Request) bool {
+	// ETags of S3 responses don't match Azure ones, so ETag conditions can't
+	// be passed on
+	return isObjectRequest(req) && req.Header.Get("If-Match") == "" && req.Header.Get("If-None-Match") == ""
+}
+
+// AzureDecorator translates requests to Azure Blob Storage REST API
+func AzureDecorator(account string, key []byte, host string) httphandler.Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return azureRoundTripper{rt: rt, account: account, key: key, host: host, now: time.Now}
+	}
+}
+
+func azureDecoratorFactory(backend string, backendConf config.Storage, _ crdstore.Stores) (httphandler.Decorator, error) {
+	accountKey, ok := backendConf.Properties["AccountKey"]
+	if !ok {
+		return nil, fmt.Errorf("no AccountKey defined for backend type %q", Azure)
+	}
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AccountKey for backend type %q: %s", Azure, err)
+	}
+	account, ok := backendConf.Properties["Account"]
+	if !ok {
+		// <account>.blob.core.windows.net
+		account = strings.SplitN(backendConf.Backend.Hostname(), ".", 2)[0]
+	}
+	return AzureDecorator(account, key, backendConf.Backend.Host), nil
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAzureAccount = "myaccount"
+	testAzureKey     = "azure-account-key"
+)
+
+var testAzureDate = time.Date(2015, 6, 26, 23, 39, 12, 0, time.UTC)
+
+func newTestAzureRoundTripper(host string) azureRoundTripper {
+	return azureRoundTripper{
+		rt:      http.DefaultTransport,
+		account: testAzureAccount,
+		key:     []byte(testAzureKey),
+		host:    host,
+		now:     func() time.Time { return testAzureDate },
+	}
+}
+
+func TestAzureShouldSignRequestsWithSharedKey(t *testing.T) {
+	art := newTestAzureRoundTripper("myaccount.blob.core.windows.net")
+	for _, testCase := range []struct {
+		name                  string
+		method, url           string
+		header                http.Header
+		body                  string
+		expectedStringToSign  string
+		expectedAuthorization string
+	}{
+		{
+			name:   "blob upload",
+			method: http.MethodPut,
+			url:    "http://myaccount.blob.core.windows.net/mycontainer/my%20blob",
+			header: http.Header{
+				"Content-Type":   {"text/plain"},
+				"X-Ms-Blob-Type": {"BlockBlob"},
+				"X-Ms-Meta-Name": {" value "},
+			},
+			body: "hello world",
+			expectedStringToSign: "PUT\n\n\n11\n\ntext/plain\n\n\n\n\n\n\n" +
+				"x-ms-blob-type:BlockBlob\nx-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-meta-name:value\nx-ms-version:2019-12-12\n" +
+				"/myaccount/mycontainer/my%20blob",
+			expectedAuthorization: "SharedKey myaccount:1IiWGHHjsQK0CsM+r97JVyR4/hehvAq57DtptC4bXbk=",
+		},
+		{
+			name:   "blob listing",
+			method: http.MethodGet,
+			url:    "http://myaccount.blob.core.windows.net/mycontainer?restype=container&prefix=a%20b&comp=list",
+			header: http.Header{},
+			expectedStringToSign: "GET\n\n\n\n\n\n\n\n\n\n\n\n" +
+				"x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2019-12-12\n" +
+				"/myaccount/mycontainer\ncomp:list\nprefix:a b\nrestype:container",
+			expectedAuthorization: "SharedKey myaccount:gc5XiAwfa4mhdX3GZiG0sa/F6Z7Ozi5CVeWvcECZDqE=",
+		},
+	} {
+		req := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.body))
+		req.Header = testCase.header
+
+		art.sign(req)
+
+		assert.Equal(t, testCase.expectedStringToSign, azureStringToSign(testAzureAccount, req), testCase.name)
+		assert.Equal(t, testCase.expectedAuthorization, req.Header.Get("Authorization"), testCase.name)
+	}
+}
+
+// azureStub serves Blob Storage API calls with handler and records them
+type azureStub struct {
+	*httptest.Server
+	requests []*http.Request
+}
+
+func newAzureStub(t *testing.T, handler http.HandlerFunc) *azureStub {
+	stub := &azureStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.Header.Get("Authorization"), expectedAzureAuthorization(r))
+		stub.requests = append(stub.requests, r)
+		handler(w, r)
+	}))
+	return stub
+}
+
+func expectedAzureAuthorization(r *http.Request) string {
+	signed := httptest.NewRequest(r.Method, r.URL.String(), nil)
+	signed.Header = r.Header.Clone()
+	signed.ContentLength = r.ContentLength
+	newTestAzureRoundTripper(r.Host).sign(signed)
+	return signed.Header.Get("Authorization")
+}
+
+func (stub *azureStub) roundTrip(t *testing.T, req *http.Request) *http.Response {
+	resp, err := newTestAzureRoundTripper(strings.TrimPrefix(stub.URL, "http://")).RoundTrip(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAzureShouldTranslateObjectUpload(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "hello world", string(body))
+		w.Header().Set("Content-Md5", "XrY7u+Ae7tCTyyK7j1rNww==")
+		w.Header().Set("Etag", `"0x8D5B6C9E4F1A2B3"`)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer stub.Close()
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/container/dir/blob", strings.NewReader("hello world"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Amz-Meta-Owner", "team")
+	req.Header.Set("X-Amz-Storage-Class", "STANDARD_IA")
+
+	resp := stub.roundTrip(t, req)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, resp.Header.Get("ETag"))
+	require.Len(t, stub.requests, 1)
+	azReq := stub.requests[0]
+	assert.Equal(t, http.MethodPut, azReq.Method)
+	assert.Equal(t, "/container/dir/blob", azReq.URL.Path)
+	assert.Equal(t, "BlockBlob", azReq.Header.Get("X-Ms-Blob-Type"))
+	assert.Equal(t, "Cool", azReq.Header.Get("X-Ms-Access-Tier"))
+	assert.Equal(t, "team", azReq.Header.Get("X-Ms-Meta-Owner"))
+	assert.Equal(t, "text/plain", azReq.Header.Get("Content-Type"))
+	assert.Equal(t, azureAPIVersion, azReq.Header.Get("X-Ms-Version"))
+}
+
+func TestAzureShouldTranslateObjectRead(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ms-Meta-Owner", "team")
+		w.Header().Set("X-Ms-Blob-Content-Md5", "XrY7u+Ae7tCTyyK7j1rNww==")
+		w.Header().Set("Content-Range", "bytes 0-4/11")
+		w.Header().Set("Content-Md5", "XUFAKrxLKna5cZ2REBfFkg==")
+		w.Header().Set("X-Ms-Request-Id", "azure-request")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte("hello"))
+	})
+	defer stub.Close()
+	req := httptest.NewRequest(http.MethodGet, "http://akubra.local/container/blob", nil)
+	req.Header.Set("Range", "bytes=0-4")
+
+	resp := stub.roundTrip(t, req)
+
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "team", resp.Header.Get("X-Amz-Meta-Owner"))
+	assert.Equal(t, "bytes 0-4/11", resp.Header.Get("Content-Range"))
+	assert.Empty(t, resp.Header.Get("X-Ms-Request-Id"))
+	assert.Equal(t, "bytes=0-4", stub.requests[0].Header.Get("Range"))
+}
+
+func TestAzureShouldTranslateObjectDeletes(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/container/missing" {
+			w.Header().Set("X-Ms-Error-Code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	defer stub.Close()
+
+	for _, path := range []string{"/container/blob", "/container/missing"} {
+		resp := stub.roundTrip(t, httptest.NewRequest(http.MethodDelete, "http://akubra.local"+path, nil))
+
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, path)
+	}
+	require.Len(t, stub.requests, 2)
+	assert.Equal(t, http.MethodDelete, stub.requests[0].Method)
+}
+
+func TestAzureShouldTranslateContainerHead(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Header().Set("X-Ms-Error-Code", "ContainerNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer stub.Close()
+
+	existing := stub.roundTrip(t, httptest.NewRequest(http.MethodHead, "http://akubra.local/container", nil))
+	missing := stub.roundTrip(t, httptest.NewRequest(http.MethodHead, "http://akubra.local/missing", nil))
+
+	assert.Equal(t, http.StatusOK, existing.StatusCode)
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+	assert.Equal(t, "restype=container", stub.requests[0].URL.RawQuery)
+}
+
+func TestAzureShouldTranslateListing(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<EnumerationResults ContainerName="container">
+  <Blobs>
+    <Blob>
+      <Name>dir/a</Name>
+      <Properties>
+        <Last-Modified>Fri, 26 Jun 2015 23:39:12 GMT</Last-Modified>
+        <Etag>0x8D5B6C9E4F1A2B3</Etag>
+        <Content-Length>11</Content-Length>
+        <Content-MD5>XrY7u+Ae7tCTyyK7j1rNww==</Content-MD5>
+      </Properties>
+    </Blob>
+    <BlobPrefix><Name>dir/sub/</Name></BlobPrefix>
+  </Blobs>
+  <NextMarker>azure-marker</NextMarker>
+</EnumerationResults>`))
+	})
+	defer stub.Close()
+
+	resp := stub.roundTrip(t, httptest.NewRequest(http.MethodGet,
+		"http://akubra.local/container?list-type=2&prefix=dir/&delimiter=/&max-keys=10&continuation-token=previous", nil))
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	query := stub.requests[0].URL.Query()
+	assert.Equal(t, url.Values{
+		"restype":    {"container"},
+		"comp":       {"list"},
+		"maxresults": {"10"},
+		"prefix":     {"dir/"},
+		"delimiter":  {"/"},
+		"marker":     {"previous"},
+	}, query)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	result := s3datatypes.ListBucketV2Result{}
+	require.NoError(t, xml.Unmarshal(body, &result))
+	require.Len(t, result.Contents, 1)
+	assert.Equal(t, "dir/a", result.Contents[0].Key)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, result.Contents[0].ETag)
+	assert.Equal(t, int64(11), result.Contents[0].Size)
+	assert.Equal(t, testAzureDate, result.Contents[0].LastModified.UTC())
+	require.Len(t, result.CommonPrefixes, 1)
+	assert.Equal(t, "dir/sub/", result.CommonPrefixes[0].Prefix)
+	assert.Equal(t, "azure-marker", result.NextContinuationToken)
+	assert.True(t, result.IsTruncated)
+}
+
+func TestAzureShouldTranslateErrors(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?><Error><Code>AuthenticationFailed</Code>` +
+			"<Message>Server failed to authenticate the request.\nRequestId:abc\nTime:2015-06-26T23:39:12Z</Message></Error>"))
+	})
+	defer stub.Close()
+
+	resp := stub.roundTrip(t, httptest.NewRequest(http.MethodGet, "http://akubra.local/container/blob", nil))
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	s3Error := types.S3Error{}
+	require.NoError(t, xml.Unmarshal(body, &s3Error))
+	assert.Equal(t, types.S3ErrAccessDenied, s3Error.Code)
+	assert.Equal(t, "Server failed to authenticate the request.", s3Error.Message)
+}
+
+func TestAzureShouldRejectUnsupportedOperations(t *testing.T) {
+	stub := newAzureStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer stub.Close()
+
+	conditional := httptest.NewRequest(http.MethodGet, "http://akubra.local/container/blob", nil)
+	conditional.Header.Set("If-None-Match", `"etag"`)
+	streaming := httptest.NewRequest(http.MethodPut, "http://akubra.local/container/blob", strings.NewReader("body"))
+	streaming.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "http://akubra.local/container/blob?uploads", nil),
+		httptest.NewRequest(http.MethodGet, "http://akubra.local/container/blob?acl", nil),
+		httptest.NewRequest(http.MethodGet, "http://akubra.local/", nil),
+		conditional,
+		streaming,
+	} {
+		resp := stub.roundTrip(t, req)
+
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode, req.URL.String())
+	}
+	assert.Empty(t, stub.requests)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/types"
+)
+
+// edgeAuthRoundTripper verifies client request signatures before request is
+// passed further, so invalid requests never reach backends
+type edgeAuthRoundTripper struct {
+	rt  http.RoundTripper
+	crd *crdstore.CredentialsStore
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (ert edgeAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if types.IsAnonymousRead(req.Context()) {
+		return ert.rt.RoundTrip(req)
+	}
+	authorization := req.Header.Get("Authorization")
+	if authorization == "" && isPresigned(req) {
+		return ert.roundTripPresigned(req)
+	}
+	if authorization == "" {
+		return ert.reject(req, "anonymous", responseAccessDenied(req))
+	}
+	authHeader, err := ParseAuthorizationHeader(authorization)
+	if err != nil {
+		return ert.reject(req, "malformed", responseMalformedAuthorization(req))
+	}
+	csd, errResp := ert.credentials(req, authHeader.AccessKey)
+	if errResp != nil {
+		return errResp, nil
+	}
+	// Signature was computed for address used by client
+	signed := types.ToVirtualHostedStyle(req)
+	if DoesSignMatch(signed, Keys{AccessKeyID: csd.AccessKey, SecretAccessKey: csd.SecretKey}) != ErrNone {
+		return ert.reject(req, "signature", responseSignatureDoesNotMatch(req))
+	}
+	ctx := types.WithAuthenticatedAccessKey(req.Context(), authHeader.AccessKey)
+	if authHeader.Version == signV4Algorithm && awschunked.IsStreamingUpload(req) {
+		// Chunks are verified by decorator which decodes body
+		verifier, err := awschunked.NewSigner(csd.SecretKey, req.Header.Get("X-Amz-Date"), authHeader.Region, authHeader.Signature)
+		if err != nil {
+			return ert.reject(req, "malformed", responseMalformedAuthorization(req))
+		}
+		ctx = awschunked.WithVerifier(ctx, verifier)
+	}
+	return ert.rt.RoundTrip(req.WithContext(ctx))
+}
+
+// roundTripPresigned verifies signature of request authenticated with query
+// params, it's passed with them to backends
+func (ert edgeAuthRoundTripper) roundTripPresigned(req *http.Request) (*http.Response, error) {
+	pq, err := parsePresignedQuery(req)
+	if err != nil {
+		return ert.reject(req, "malformed", responseMalformedAuthorization(req))
+	}
+	csd, errResp := ert.credentials(req, pq.accessKey)
+	if errResp != nil {
+		return errResp, nil
+	}
+	err = verifyPresigned(pq, types.ToVirtualHostedStyle(req), req, csd.SecretKey, time.Now())
+	if err == errPresignedExpired {
+		return ert.reject(req, "expired", types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied,
+			"Request has expired"))
+	}
+	if err != nil {
+		return ert.reject(req, "signature", responseSignatureDoesNotMatch(req))
+	}
+	return ert.rt.RoundTrip(req.WithContext(types.WithAuthenticatedAccessKey(req.Context(), pq.accessKey)))
+}
+
+// credentials returns client credentials of accessKey, or response rejecting
+// request if they can't be read
+func (ert edgeAuthRoundTripper) credentials(req *http.Request, accessKey string) (*crdstore.CredentialsStoreData, *http.Response) {
+	csd, err := ert.crd.GetWithContext(req.Context(), accessKey, "akubra")
+	if err == crdstore.ErrCredentialsNotFound {
+		resp, _ := ert.reject(req, "unknown-access-key", responseInvalidAccessKey(req))
+		return nil, resp
+	}
+	if err != nil {
+		reqID := req.Context().Value(log.ContextreqIDKey)
+		log.Printf("Cannot get credentials of %s for request %s: %s", accessKey, reqID, err)
+		return nil, types.NewS3ErrorResponseForStatus(req, http.StatusServiceUnavailable)
+	}
+	return csd, nil
+}
+
+func (ert edgeAuthRoundTripper) reject(req *http.Request, reason string, resp *http.Response) (*http.Response, error) {
+	metrics.Mark("reqs.auth.rejected." + reason)
+	log.Debugf("Request %s rejected by authentication: %s", req.Context().Value(log.ContextreqIDKey), reason)
+	return resp, nil
+}
+
+func responseAccessDenied(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied, "Access Denied")
+}
+
+// EdgeDecorator verifies signatures of client requests with credentials of
+// "akubra" backend from credentials store named by endpoint, requests aren't
+// verified if endpoint is empty
+func EdgeDecorator(endpoint string, stores crdstore.Stores) (httphandler.Decorator, error) {
+	if endpoint == "" {
+		return func(rt http.RoundTripper) http.RoundTripper { return rt }, nil
+	}
+	credentialsStore, err := stores.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("edge authentication: %s", err)
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return edgeAuthRoundTripper{rt: rt, crd: credentialsStore}
+	}, nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/crdstore"
+	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/types"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/stretchr/testify/require"
+)
+
+const edgeCredentials = `
+client:
+  akubra:
+    AccessKey: client
+    SecretKey: client-secret
+`
+
+func newEdgeRoundTripper(t *testing.T) (http.RoundTripper, *int) {
+	dir, err := ioutil.TempDir("", "edge")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(edgeCredentials), 0600))
+	stores, err := crdstore.NewStores(crdstoreconfig.CredentialsStoreMap{
+		"edge": crdstoreconfig.CredentialsStore{Type: crdstoreconfig.FileStore, File: file},
+	})
+	require.NoError(t, err)
+	defer stores.Close()
+	decorator, err := EdgeDecorator("edge", stores)
+	require.NoError(t, err)
+	calls := 0
+	backend := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	})
+	return decorator(backend), &calls
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestEdgeAuthShouldPassRequestsWithValidSignature(t *testing.T) {
+	rt, calls := newEdgeRoundTripper(t)
+	req := s3signer.SignV2(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil), "client", "client-secret")
+
+	resp, err := rt.RoundTrip(req)
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 1, *calls)
+	accessKey, verified := types.AuthenticatedAccessKey(resp.Request.Context())
+	require.True(t, verified)
+	require.Equal(t, "client", accessKey)
+}
+
+func TestEdgeAuthShouldRejectInvalidRequestsBeforeBackend(t *testing.T) {
+	rt, calls := newEdgeRoundTripper(t)
+	for name, req := range map[string]*http.Request{
+		"anonymous":       httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil),
+		"wrong secret":    s3signer.SignV2(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil), "client", "wrong"),
+		"unknown access":  s3signer.SignV2(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil), "unknown", "secret"),
+		"tampered object": tamper(s3signer.SignV2(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil), "client", "client-secret")),
+	} {
+		resp, err := rt.RoundTrip(req)
+
+		require.NoError(t, err, name)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, name)
+	}
+	require.Equal(t, 0, *calls, "rejected requests should not reach backends")
+}
+
+func tamper(req *http.Request) *http.Request {
+	req.URL.Path = "/bucket/other"
+	return req
+}
+
+func TestEdgeAuthShouldVerifyPresignedRequests(t *testing.T) {
+	rt, calls := newEdgeRoundTripper(t)
+	presignedV4 := s3signer.PreSignV4(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/dir/a%20key", nil),
+		"client", "client-secret", "", "us-east-1", 3600)
+	presignedV2 := s3signer.PreSignV2(*httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key?acl", nil),
+		"client", "client-secret", 3600, false)
+
+	for name, req := range map[string]*http.Request{"V4": presignedV4, "V2": presignedV2} {
+		resp, err := rt.RoundTrip(req)
+
+		require.NoError(t, err, name)
+		require.Equal(t, http.StatusOK, resp.StatusCode, name)
+		accessKey, verified := types.AuthenticatedAccessKey(resp.Request.Context())
+		require.True(t, verified, name)
+		require.Equal(t, "client", accessKey, name)
+	}
+	require.Equal(t, 2, *calls)
+}
+
+func TestEdgeAuthShouldRejectInvalidPresignedRequests(t *testing.T) {
+	rt, calls := newEdgeRoundTripper(t)
+	presign := func(secret string) *http.Request {
+		return s3signer.PreSignV4(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil),
+			"client", secret, "", "us-east-1", 3600)
+	}
+	for name, req := range map[string]*http.Request{
+		"wrong secret":    presign("wrong"),
+		"tampered object": tamper(presign("client-secret")),
+		"unknown access": s3signer.PreSignV2(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil),
+			"unknown", "secret", 3600, false),
+	} {
+		resp, err := rt.RoundTrip(req)
+
+		require.NoError(t, err, name)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, name)
+	}
+	malformed, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key?Signature=abc", nil))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, malformed.StatusCode)
+	require.Equal(t, 0, *calls, "rejected requests should not reach backends")
+}
+
+func TestPresignedRequestsShouldExpire(t *testing.T) {
+	req := s3signer.PreSignV4(*httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil),
+		"client", "client-secret", "", "us-east-1", 60)
+	pq, err := parsePresignedQuery(req)
+	require.NoError(t, err)
+
+	require.NoError(t, verifyPresigned(pq, req, req, "client-secret", time.Now()))
+	require.Equal(t, errPresignedExpired, verifyPresigned(pq, req, req, "client-secret", time.Now().Add(2*time.Minute)))
+}
@@ -0,0 +1,494 @@
+package auth
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+)
+
+const (
+	// fsTmpDir keeps objects being written, S3 bucket names can't start with dot
+	fsTmpDir = ".tmp"
+	// fsMetaLengthSize is size of metadata length stored at the end of object file
+	fsMetaLengthSize = 4
+	// fsMaxNameLength is file name length limit of most filesystems
+	fsMaxNameLength = 255
+	// fsDefaultContentType is returned for objects stored without Content-Type
+	fsDefaultContentType = "binary/octet-stream"
+)
+
+// fsStoredHeaders are object headers stored in metadata
+var fsStoredHeaders = []string{
+	"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type",
+}
+
+// fsObjectMeta is stored in object file after object data
+type fsObjectMeta struct {
+	ETag         string      `json:"etag"`
+	LastModified time.Time   `json:"lastModified"`
+	Header       http.Header `json:"header"`
+}
+
+// fsRoundTripper serves S3 requests from local or NFS mounted directory, it
+// doesn't pass requests to decorated RoundTripper. Buckets are directories
+// under root and objects are files named with path escaped keys. Object file
+// holds data followed by JSON metadata and its 4 byte big endian length, so
+// object is written to temporary file and replaced atomically with rename
+type fsRoundTripper struct {
+	root string
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (frt fsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			"Chunked upload signatures are not supported by fs storage."), nil
+	}
+	bucket, key := splitBucketKey(req.URL.Path)
+	switch {
+	case bucket == "" || strings.HasPrefix(bucket, "."):
+	case key != "" && isObjectRequest(req):
+		return frt.objectRequest(req, bucket, key)
+	case key == "" && isListingRequest(req):
+		return frt.listObjects(req, bucket)
+	case key == "" && isBucketRequest(req):
+		return frt.bucketRequest(req, bucket)
+	}
+	return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+		"Operation is not supported by fs storage."), nil
+}
+
+func (frt fsRoundTripper) objectRequest(req *http.Request, bucket, key string) (*http.Response, error) {
+	if !frt.bucketExists(bucket) {
+		return noSuchBucket(req), nil
+	}
+	name := fsObjectName(key)
+	if len(name) > fsMaxNameLength {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrKeyTooLong,
+			"Your key is too long."), nil
+	}
+	path := filepath.Join(frt.root, bucket, name)
+	switch req.Method {
+	case http.MethodPut:
+		return frt.putObject(req, path)
+	case http.MethodDelete:
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return emptyResponse(req, http.StatusNoContent), nil
+	}
+	return getObject(req, path)
+}
+
+func (frt fsRoundTripper) putObject(req *http.Request, path string) (*http.Response, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(frt.root, fsTmpDir), "put-")
+	if err != nil {
+		return nil, err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			closeFsFile(tmp)
+		}
+		// Renamed file is gone already
+		if removeErr := os.Remove(tmp.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("Could not remove temporary file %s: %s", tmp.Name(), removeErr)
+		}
+	}()
+	md5Hash := md5.New()
+	var size int64
+	if req.Body != nil {
+		if size, err = io.Copy(io.MultiWriter(tmp, md5Hash), req.Body); err != nil {
+			return nil, err
+		}
+	}
+	if req.ContentLength >= 0 && size != req.ContentLength {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrIncompleteBody,
+			"You did not provide the number of bytes specified by the Content-Length HTTP header."), nil
+	}
+	md5Sum := md5Hash.Sum(nil)
+	if contentMD5 := req.Header.Get("Content-MD5"); contentMD5 != "" && contentMD5 != base64.StdEncoding.EncodeToString(md5Sum) {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrBadDigest,
+			"The Content-MD5 you specified did not match what we received."), nil
+	}
+
+	meta := fsObjectMeta{
+		ETag:         strconv.Quote(hex.EncodeToString(md5Sum)),
+		LastModified: time.Now().UTC().Truncate(time.Second),
+		Header:       make(http.Header),
+	}
+	copyHeaders(meta.Header, req.Header, fsStoredHeaders)
+	renameHeaders(meta.Header, req.Header, "X-Amz-Meta-", "X-Amz-Meta-")
+	if meta.Header.Get("Content-Type") == "" {
+		meta.Header.Set("Content-Type", fsDefaultContentType)
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	metaLength := make([]byte, fsMetaLengthSize)
+	binary.BigEndian.PutUint32(metaLength, uint32(len(metaBytes)))
+	if _, err = tmp.Write(append(metaBytes, metaLength...)); err != nil {
+		return nil, err
+	}
+	if err = tmp.Sync(); err != nil {
+		return nil, err
+	}
+	closed = true
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	resp := emptyResponse(req, http.StatusOK)
+	resp.Header.Set("ETag", meta.ETag)
+	return resp, nil
+}
+
+// getObject serves GET and HEAD with single range and conditional requests
+// support
+func getObject(req *http.Request, path string) (*http.Response, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchKey,
+			"The specified key does not exist."), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta, size, err := readFsObjectMeta(file)
+	if err != nil {
+		closeFsFile(file)
+		return nil, err
+	}
+	header := make(http.Header)
+	for name, values := range meta.Header {
+		header[name] = values
+	}
+	header.Set("ETag", meta.ETag)
+	header.Set("Last-Modified", meta.LastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+
+	if statusCode := checkConditions(req, meta); statusCode != http.StatusOK {
+		closeFsFile(file)
+		if statusCode == http.StatusPreconditionFailed {
+			return types.NewS3ErrorResponse(req, statusCode, types.S3ErrPreconditionFailed,
+				"At least one of the pre-conditions you specified did not hold."), nil
+		}
+		resp := emptyResponse(req, statusCode)
+		resp.Header = header
+		return resp, nil
+	}
+
+	statusCode := http.StatusOK
+	start, length := int64(0), size
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		rangeStart, rangeLength, valid, satisfiable := parseRange(rangeHeader, size)
+		if valid && !satisfiable {
+			closeFsFile(file)
+			resp := types.NewS3ErrorResponse(req, http.StatusRequestedRangeNotSatisfiable, types.S3ErrInvalidRange,
+				"The requested range is not satisfiable.")
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return resp, nil
+		}
+		if valid {
+			statusCode, start, length = http.StatusPartialContent, rangeStart, rangeLength
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		}
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	var body io.ReadCloser = http.NoBody
+	if req.Method == http.MethodHead {
+		closeFsFile(file)
+	} else {
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(file, start, length), file}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}, nil
+}
+
+func (frt fsRoundTripper) bucketRequest(req *http.Request, bucket string) (*http.Response, error) {
+	dir := filepath.Join(frt.root, bucket)
+	switch req.Method {
+	case http.MethodPut:
+		if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
+		return emptyResponse(req, http.StatusOK), nil
+	case http.MethodDelete:
+		names, err := readDirNames(dir, 1)
+		if os.IsNotExist(err) {
+			return noSuchBucket(req), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			return types.NewS3ErrorResponse(req, http.StatusConflict, types.S3ErrBucketNotEmpty,
+				"The bucket you tried to delete is not empty."), nil
+		}
+		if err = os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return emptyResponse(req, http.StatusNoContent), nil
+	}
+	if !frt.bucketExists(bucket) {
+		return noSuchBucket(req), nil
+	}
+	return emptyResponse(req, http.StatusOK), nil
+}
+
+func (frt fsRoundTripper) listObjects(req *http.Request, bucket string) (*http.Response, error) {
+	params, errResp := parseListingParams(req)
+	if errResp != nil {
+		return errResp, nil
+	}
+	dir := filepath.Join(frt.root, bucket)
+	names, err := readDirNames(dir, -1)
+	if os.IsNotExist(err) {
+		return noSuchBucket(req), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string, len(names))
+	sortedKeys := make([]string, 0, len(names))
+	for _, name := range names {
+		key, err := url.PathUnescape(name)
+		if err != nil || !strings.HasPrefix(key, params.prefix) || key <= params.marker {
+			continue
+		}
+		keys[key] = name
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	contents := make(s3datatypes.ObjectInfos, 0)
+	prefixes := make(s3datatypes.CommonPrefixes, 0)
+	lastListed, nextMarker := "", ""
+	for _, key := range sortedKeys {
+		commonPrefix := ""
+		if i := strings.Index(key[len(params.prefix):], params.delimiter); params.delimiter != "" && i >= 0 {
+			commonPrefix = key[:len(params.prefix)+i+len(params.delimiter)]
+			if commonPrefix == lastListed || strings.HasPrefix(params.marker, commonPrefix) {
+				continue
+			}
+		}
+		if int64(len(contents)+len(prefixes)) == params.maxKeys {
+			nextMarker = lastListed
+			break
+		}
+		if commonPrefix != "" {
+			prefixes = append(prefixes, s3datatypes.CommonPrefix{Prefix: commonPrefix})
+			lastListed = commonPrefix
+			continue
+		}
+		objectInfo, err := statFsObject(filepath.Join(dir, keys[key]), key)
+		if err != nil {
+			// Object removed in the meantime
+			log.Debugf("Skipping %s in listing of %s: %s", key, bucket, err)
+			continue
+		}
+		contents = append(contents, objectInfo)
+		lastListed = key
+	}
+	return params.response(req, bucket, contents, prefixes, nextMarker)
+}
+
+func (frt fsRoundTripper) bucketExists(bucket string) bool {
+	info, err := os.Stat(filepath.Join(frt.root, bucket))
+	return err == nil && info.IsDir()
+}
+
+// fsObjectName escapes key to single path segment
+func fsObjectName(key string) string {
+	name := url.PathEscape(key)
+	if name == "." || name == ".." {
+		return strings.Replace(name, ".", "%2E", -1)
+	}
+	return name
+}
+
+func readFsObjectMeta(file *os.File) (fsObjectMeta, int64, error) {
+	meta := fsObjectMeta{}
+	info, err := file.Stat()
+	if err != nil {
+		return meta, 0, err
+	}
+	metaLength := make([]byte, fsMetaLengthSize)
+	if _, err = file.ReadAt(metaLength, info.Size()-fsMetaLengthSize); err != nil {
+		return meta, 0, fmt.Errorf("cannot read metadata length of %s: %s", file.Name(), err)
+	}
+	metaBytes := make([]byte, binary.BigEndian.Uint32(metaLength))
+	size := info.Size() - fsMetaLengthSize - int64(len(metaBytes))
+	if size < 0 {
+		return meta, 0, fmt.Errorf("invalid metadata length of %s", file.Name())
+	}
+	if _, err = file.ReadAt(metaBytes, size); err != nil {
+		return meta, 0, fmt.Errorf("cannot read metadata of %s: %s", file.Name(), err)
+	}
+	if err = json.Unmarshal(metaBytes, &meta); err != nil {
+		return meta, 0, fmt.Errorf("cannot parse metadata of %s: %s", file.Name(), err)
+	}
+	return meta, size, nil
+}
+
+func statFsObject(path, key string) (s3datatypes.ObjectInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return s3datatypes.ObjectInfo{}, err
+	}
+	defer closeFsFile(file)
+	meta, size, err := readFsObjectMeta(file)
+	if err != nil {
+		return s3datatypes.ObjectInfo{}, err
+	}
+	return s3datatypes.ObjectInfo{
+		Key:          key,
+		ETag:         meta.ETag,
+		LastModified: meta.LastModified,
+		Size:         size,
+		StorageClass: "STANDARD",
+	}, nil
+}
+
+// checkConditions evaluates conditional headers of GET and HEAD request as
+// described in RFC 7232, it returns 200 if object should be served
+func checkConditions(req *http.Request, meta fsObjectMeta) int {
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		if !etagMatches(ifMatch, meta.ETag) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Unmodified-Since")); err == nil && meta.LastModified.After(since) {
+		return http.StatusPreconditionFailed
+	}
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagMatches(ifNoneMatch, meta.ETag) {
+			return http.StatusNotModified
+		}
+	} else if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !meta.LastModified.After(since) {
+		return http.StatusNotModified
+	}
+	return http.StatusOK
+}
+
+func etagMatches(condition, etag string) bool {
+	for _, candidate := range strings.Split(condition, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag || strconv.Quote(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses single byte range, multiple ranges and malformed headers
+// are reported as invalid and ignored, like S3 does
+func parseRange(rangeHeader string, size int64) (start, length int64, valid, satisfiable bool) {
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	bounds := strings.Split(spec, "-")
+	if spec == rangeHeader || strings.Contains(spec, ",") || len(bounds) != 2 {
+		return 0, 0, false, false
+	}
+	if bounds[0] == "" {
+		suffix, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, true
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	end := size - 1
+	if bounds[1] != "" {
+		if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil || end < start {
+			return 0, 0, false, false
+		}
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end - start + 1, true, true
+}
+
+func readDirNames(dir string, n int) ([]string, error) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFsFile(file)
+	names, err := file.Readdirnames(n)
+	if err == io.EOF {
+		return names, nil
+	}
+	return names, err
+}
+
+func noSuchBucket(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchBucket,
+		"The specified bucket does not exist.")
+}
+
+func closeFsFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		log.Debugf("Could not close %s: %s", file.Name(), err)
+	}
+}
+
+func fsDecoratorFactory(backend string, backendConf config.Storage, _ crdstore.Stores) (httphandler.Decorator, error) {
+	root, ok := backendConf.Properties["Path"]
+	if !ok {
+		return nil, fmt.Errorf("no Path defined for backend type %q", FS)
+	}
+	if err := os.MkdirAll(filepath.Join(root, fsTmpDir), 0755); err != nil {
+		return nil, fmt.Errorf("cannot create %q storage directory: %s", FS, err)
+	}
+	return func(http.RoundTripper) http.RoundTripper {
+		return fsRoundTripper{root: root}
+	}, nil
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFsRoundTripper(t *testing.T) (http.RoundTripper, string) {
+	root, err := ioutil.TempDir("", "akubra-fs")
+	require.NoError(t, err)
+	decorator, err := fsDecoratorFactory("", config.Storage{Properties: map[string]string{"Path": root}}, nil)
+	require.NoError(t, err)
+	rt := decorator(nil)
+	fsRequest(t, rt, http.MethodPut, "/bucket", "")
+	return rt, root
+}
+
+func fsRequest(t *testing.T, rt http.RoundTripper, method, path, body string) *http.Response {
+	req := httptest.NewRequest(method, "http://akubra.local"+path, strings.NewReader(body))
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func readFsBody(t *testing.T, resp *http.Response) string {
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(body)
+}
+
+func TestFsShouldParseRanges(t *testing.T) {
+	for _, testCase := range []struct {
+		header                           string
+		size                             int64
+		expectedStart, expectedLength    int64
+		expectedValid, expectedSatisfied bool
+	}{
+		{"bytes=0-4", 11, 0, 5, true, true},
+		{"bytes=6-", 11, 6, 5, true, true},
+		{"bytes=6-100", 11, 6, 5, true, true},
+		{"bytes=-5", 11, 6, 5, true, true},
+		{"bytes=-100", 11, 0, 11, true, true},
+		{"bytes=11-", 11, 0, 0, true, false},
+		{"bytes=20-30", 11, 0, 0, true, false},
+		{"bytes=-0", 11, 0, 0, true, false},
+		{"bytes=-5", 0, 0, 0, true, false},
+		{"bytes=0-", 0, 0, 0, true, false},
+		{"bytes=5-4", 11, 0, 0, false, false},
+		{"bytes=0-1,3-4", 11, 0, 0, false, false},
+		{"bytes=a-b", 11, 0, 0, false, false},
+		{"bytes=--1", 11, 0, 0, false, false},
+		{"items=0-4", 11, 0, 0, false, false},
+	} {
+		start, length, valid, satisfiable := parseRange(testCase.header, testCase.size)
+
+		assert.Equal(t, testCase.expectedValid, valid, testCase.header)
+		assert.Equal(t, testCase.expectedSatisfied, satisfiable, testCase.header)
+		assert.Equal(t, testCase.expectedStart, start, testCase.header)
+		assert.Equal(t, testCase.expectedLength, length, testCase.header)
+	}
+}
+
+func TestFsShouldEvaluateConditions(t *testing.T) {
+	lastModified := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta := fsObjectMeta{ETag: `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, LastModified: lastModified}
+	before := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	after := lastModified.Add(time.Hour).Format(http.TimeFormat)
+	for _, testCase := range []struct {
+		name           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{"no conditions", http.Header{}, http.StatusOK},
+		{"if-match", http.Header{"If-Match": {`"5eb63bbbe01eeed093cb22bb8f5acdc3"`}}, http.StatusOK},
+		{"unquoted if-match", http.Header{"If-Match": {"5eb63bbbe01eeed093cb22bb8f5acdc3"}}, http.StatusOK},
+		{"if-match list", http.Header{"If-Match": {`"other", W/"5eb63bbbe01eeed093cb22bb8f5acdc3"`}}, http.StatusOK},
+		{"if-match any", http.Header{"If-Match": {"*"}}, http.StatusOK},
+		{"failed if-match", http.Header{"If-Match": {`"other"`}}, http.StatusPreconditionFailed},
+		{"if-none-match", http.Header{"If-None-Match": {`"5eb63bbbe01eeed093cb22bb8f5acdc3"`}}, http.StatusNotModified},
+		{"if-none-match any", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"other if-none-match", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK},
+		{"if-modified-since before", http.Header{"If-Modified-Since": {before}}, http.StatusOK},
+		{"if-modified-since at", http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}}, http.StatusNotModified},
+		{"if-modified-since after", http.Header{"If-Modified-Since": {after}}, http.StatusNotModified},
+		{"invalid if-modified-since", http.Header{"If-Modified-Since": {"yesterday"}}, http.StatusOK},
+		{"if-unmodified-since before", http.Header{"If-Unmodified-Since": {before}}, http.StatusPreconditionFailed},
+		{"if-unmodified-since after", http.Header{"If-Unmodified-Since": {after}}, http.StatusOK},
+		// If-Match takes precedence over If-Unmodified-Since
+		{"if-match and if-unmodified-since", http.Header{
+			"If-Match": {"*"}, "If-Unmodified-Since": {before}}, http.StatusOK},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"if-none-match and if-modified-since", http.Header{
+			"If-None-Match": {`"other"`}, "If-Modified-Since": {after}}, http.StatusOK},
+		{"failed if-match and if-none-match", http.Header{
+			"If-Match": {`"other"`}, "If-None-Match": {`"5eb63bbbe01eeed093cb22bb8f5acdc3"`}}, http.StatusPreconditionFailed},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil)
+		req.Header = testCase.header
+
+		assert.Equal(t, testCase.expectedStatus, checkConditions(req, meta), testCase.name)
+	}
+}
+
+func TestFsShouldServeRangesAndConditionalRequests(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	putResp := fsRequest(t, rt, http.MethodPut, "/bucket/key", "hello world")
+	require.Equal(t, http.StatusOK, putResp.StatusCode)
+	etag := putResp.Header.Get("ETag")
+
+	for _, testCase := range []struct {
+		header               http.Header
+		expectedStatus       int
+		expectedBody         string
+		expectedContentRange string
+	}{
+		{http.Header{"Range": {"bytes=-5"}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=6-"}}, http.StatusPartialContent, "world", "bytes 6-10/11"},
+		{http.Header{"Range": {"bytes=20-"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */11"},
+		{http.Header{"Range": {"bytes=0-1,3-4"}}, http.StatusOK, "hello world", ""},
+		{http.Header{"If-None-Match": {etag}}, http.StatusNotModified, "", ""},
+		{http.Header{"If-Match": {`"other"`}}, http.StatusPreconditionFailed, "", ""},
+		{http.Header{"If-Match": {etag}, "Range": {"bytes=0-4"}}, http.StatusPartialContent, "hello", "bytes 0-4/11"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil)
+		req.Header = testCase.header
+
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		body := readFsBody(t, resp)
+
+		assert.Equal(t, testCase.expectedStatus, resp.StatusCode, testCase.header)
+		assert.Equal(t, testCase.expectedContentRange, resp.Header.Get("Content-Range"), testCase.header)
+		if resp.StatusCode < http.StatusMultipleChoices {
+			assert.Equal(t, testCase.expectedBody, body, testCase.header)
+			assert.Equal(t, etag, resp.Header.Get("ETag"), testCase.header)
+		}
+	}
+}
+
+func TestFsShouldStoreMetadataAfterObjectData(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/dir/key", strings.NewReader("hello world"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("X-Amz-Meta-Owner", "team")
+	req.Header.Set("X-Amz-Acl", "public-read")
+	putResp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	file, err := os.Open(filepath.Join(root, "bucket", "dir%2Fkey"))
+	require.NoError(t, err)
+	defer file.Close()
+	meta, size, err := readFsObjectMeta(file)
+	require.NoError(t, err)
+	data := make([]byte, size)
+	_, err = file.ReadAt(data, 0)
+	require.NoError(t, err)
+	headResp := fsRequest(t, rt, http.MethodHead, "/bucket/dir/key", "")
+
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, meta.ETag)
+	assert.Equal(t, meta.ETag, putResp.Header.Get("ETag"))
+	assert.Equal(t, http.Header{
+		"Content-Type":     {"text/plain"},
+		"Cache-Control":    {"no-cache"},
+		"X-Amz-Meta-Owner": {"team"},
+	}, meta.Header)
+	assert.Equal(t, http.StatusOK, headResp.StatusCode)
+	assert.Equal(t, "11", headResp.Header.Get("Content-Length"))
+	assert.Equal(t, "text/plain", headResp.Header.Get("Content-Type"))
+	assert.Equal(t, "team", headResp.Header.Get("X-Amz-Meta-Owner"))
+	assert.Equal(t, meta.LastModified.Format(http.TimeFormat), headResp.Header.Get("Last-Modified"))
+	tmpFiles, err := ioutil.ReadDir(filepath.Join(root, fsTmpDir))
+	require.NoError(t, err)
+	assert.Empty(t, tmpFiles)
+}
+
+func TestFsShouldRejectUploadsNotMatchingContentMD5(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", strings.NewReader("hello world"))
+	req.Header.Set("Content-MD5", "XUFAKrxLKna5cZ2REBfFkg==")
+
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, fsRequest(t, rt, http.MethodGet, "/bucket/key", "").StatusCode)
+}
+
+func TestFsShouldListObjectsWithPrefixAndDelimiter(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	for _, key := range []string{"a", "dir/a", "dir/b", "dir/sub/a", "dir/sub/b", "dir/tub/a", "dirx", "z"} {
+		require.Equal(t, http.StatusOK, fsRequest(t, rt, http.MethodPut, "/bucket/"+key, key).StatusCode)
+	}
+	for _, testCase := range []struct {
+		query              string
+		expectedKeys       []string
+		expectedPrefixes   []string
+		expectedNextMarker string
+	}{
+		{"", []string{"a", "dir/a", "dir/b", "dir/sub/a", "dir/sub/b", "dir/tub/a", "dirx", "z"}, nil, ""},
+		{"delimiter=/", []string{"a", "dirx", "z"}, []string{"dir/"}, ""},
+		{"prefix=dir/", []string{"dir/a", "dir/b", "dir/sub/a", "dir/sub/b", "dir/tub/a"}, nil, ""},
+		{"prefix=dir/&delimiter=/", []string{"dir/a", "dir/b"}, []string{"dir/sub/", "dir/tub/"}, ""},
+		{"prefix=dir/&delimiter=/&max-keys=3", []string{"dir/a", "dir/b"}, []string{"dir/sub/"}, "dir/sub/"},
+		{"prefix=dir/&delimiter=/&marker=dir/sub/", nil, []string{"dir/tub/"}, ""},
+		{"prefix=dir/&delimiter=/&marker=dir/sub/a", nil, []string{"dir/tub/"}, ""},
+		{"prefix=dir/s", []string{"dir/sub/a", "dir/sub/b"}, nil, ""},
+		{"max-keys=2", []string{"a", "dir/a"}, nil, "dir/a"},
+		{"prefix=missing/", nil, nil, ""},
+	} {
+		resp := fsRequest(t, rt, http.MethodGet, "/bucket?"+testCase.query, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode, testCase.query)
+		result := s3datatypes.ListBucketResult{}
+		require.NoError(t, xml.Unmarshal([]byte(readFsBody(t, resp)), &result))
+
+		var keys, prefixes []string
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		for _, prefix := range result.CommonPrefixes {
+			prefixes = append(prefixes, prefix.Prefix)
+		}
+		assert.Equal(t, testCase.expectedKeys, keys, testCase.query)
+		assert.Equal(t, testCase.expectedPrefixes, prefixes, testCase.query)
+		assert.Equal(t, testCase.expectedNextMarker, result.NextMarker, testCase.query)
+		assert.Equal(t, testCase.expectedNextMarker != "", result.IsTruncated, testCase.query)
+	}
+}
+
+func TestFsShouldListObjectSizesAndETags(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	fsRequest(t, rt, http.MethodPut, "/bucket/"+url.PathEscape("a b"), "hello world")
+
+	resp := fsRequest(t, rt, http.MethodGet, "/bucket?list-type=2", "")
+	result := s3datatypes.ListBucketV2Result{}
+	require.NoError(t, xml.Unmarshal([]byte(readFsBody(t, resp)), &result))
+
+	require.Len(t, result.Contents, 1)
+	assert.Equal(t, "a b", result.Contents[0].Key)
+	assert.Equal(t, int64(11), result.Contents[0].Size)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, result.Contents[0].ETag)
+}
+
+func TestFsShouldServeBucketOperations(t *testing.T) {
+	rt, root := newTestFsRoundTripper(t)
+	defer os.RemoveAll(root)
+	fsRequest(t, rt, http.MethodPut, "/bucket/key", "data")
+
+	notEmpty := fsRequest(t, rt, http.MethodDelete, "/bucket", "")
+	fsRequest(t, rt, http.MethodDelete, "/bucket/key", "")
+	deleted := fsRequest(t, rt, http.MethodDelete, "/bucket", "")
+	missing := fsRequest(t, rt, http.MethodHead, "/bucket", "")
+	putToMissing := fsRequest(t, rt, http.MethodPut, "/bucket/key", "data")
+	tmpBucket := fsRequest(t, rt, http.MethodGet, "/"+fsTmpDir+"/key", "")
+
+	assert.Equal(t, http.StatusConflict, notEmpty.StatusCode)
+	assert.Equal(t, http.StatusNoContent, deleted.StatusCode)
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+	assert.Equal(t, http.StatusNotFound, putToMissing.StatusCode)
+	s3Error := types.S3Error{}
+	require.NoError(t, xml.Unmarshal([]byte(readFsBody(t, putToMissing)), &s3Error))
+	assert.Equal(t, types.S3ErrNoSuchBucket, s3Error.Code)
+	assert.Equal(t, http.StatusNotImplemented, tmpBucket.StatusCode)
+}
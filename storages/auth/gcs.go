@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/types"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+)
+
+// defaultGCSRegion is used in V4 signatures of GCS XML API requests
+const defaultGCSRegion = "auto"
+
+// gcsStorageClasses maps S3 storage classes to their GCS counterparts
+var gcsStorageClasses = map[string]string{
+	"STANDARD":           "STANDARD",
+	"REDUCED_REDUNDANCY": "STANDARD",
+	"STANDARD_IA":        "NEARLINE",
+	"ONEZONE_IA":         "NEARLINE",
+	"GLACIER":            "COLDLINE",
+	"DEEP_ARCHIVE":       "ARCHIVE",
+}
+
+// gcsRoundTripper adapts S3 requests to Google Cloud Storage XML API in
+// interoperability mode and signs them with HMAC keys
+type gcsRoundTripper struct {
+	rt     http.RoundTripper
+	keys   Keys
+	region string
+	host   string
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (grt gcsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// aws-chunked bodies carry chunk signatures made with client keys
+	if strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			"Chunked upload signatures are not supported by GCS storage."), nil
+	}
+	// Client request isn't modified, it may be sent to other backends
+	gcsReq := req.WithContext(req.Context())
+	gcsURL := *req.URL
+	gcsURL.Host = grt.host
+	gcsReq.URL = &gcsURL
+	gcsReq.Host = grt.host
+	gcsReq.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		gcsReq.Header[k] = v
+	}
+	gcsReq.Header.Del("Authorization")
+	if storageClass := gcsReq.Header.Get("X-Amz-Storage-Class"); storageClass != "" {
+		if gcsStorageClass, ok := gcsStorageClasses[storageClass]; ok {
+			gcsReq.Header.Set("X-Amz-Storage-Class", gcsStorageClass)
+		}
+	}
+	gcsReq = s3signer.SignV4(*gcsReq, grt.keys.AccessKeyID, grt.keys.SecretAccessKey, "", grt.region)
+	return grt.rt.RoundTrip(gcsReq)
+}
+
+// GCSDecorator signs requests for Google Cloud Storage XML API
+func GCSDecorator(keys Keys, region, host string) httphandler.Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return gcsRoundTripper{rt: rt, keys: keys, region: region, host: host}
+	}
+}
+
+func gcsDecoratorFactory(backend string, backendConf config.Storage, _ crdstore.Stores) (httphandler.Decorator, error) {
+	accessKey, ok := backendConf.Properties["AccessKey"]
+	if !ok {
+		return nil, fmt.Errorf("no AccessKey defined for backend type %q", GCS)
+	}
+	secret, ok := backendConf.Properties["Secret"]
+	if !ok {
+		return nil, fmt.Errorf("no Secret defined for backend type %q", GCS)
+	}
+	region, ok := backendConf.Properties["Region"]
+	if !ok {
+		region = defaultGCSRegion
+	}
+	keys := Keys{AccessKeyID: accessKey, SecretAccessKey: secret}
+	return GCSDecorator(keys, region, backendConf.Backend.Host), nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingRoundTripper keeps requests it was given and answers with 200
+type recordingRoundTripper struct {
+	requests []*http.Request
+}
+
+func (rrt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rrt.requests = append(rrt.requests, req)
+	return emptyResponse(req, http.StatusOK), nil
+}
+
+// v4Signature computes AWS V4 signature of canonical request made at
+// amzDate, see https://docs.aws.amazon.com/general/latest/gr/sigv4-calculate-signature.html
+func v4Signature(secret, region, service, amzDate, canonicalRequest string) string {
+	sign := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		_, _ = mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	date := amzDate[:8]
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, date + "/" + region + "/" + service + "/aws4_request",
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+	key := sign(sign(sign(sign([]byte("AWS4"+secret), date), region), service), "aws4_request")
+	return hex.EncodeToString(sign(key, stringToSign))
+}
+
+func TestV4SignatureShouldMatchAWSTestSuite(t *testing.T) {
+	// get-vanilla case of AWS Signature Version 4 test suite
+	canonicalRequest := "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	signature := v4Signature("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		"20150830T123600Z", canonicalRequest)
+
+	assert.Equal(t, "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", signature)
+}
+
+func TestGCSShouldResignRequestsWithHMACKeys(t *testing.T) {
+	backend := &recordingRoundTripper{}
+	decorator, err := gcsDecoratorFactory("", config.Storage{
+		Backend:    types.YAMLUrl{URL: &url.URL{Scheme: "https", Host: "storage.googleapis.com"}},
+		Properties: map[string]string{"AccessKey": "GOOG1EXAMPLE", "Secret": "gcs-secret"},
+	}, nil)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/dir/key?tagging", strings.NewReader("data"))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=CLIENTKEY/20180102/us-east-1/s3/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=client")
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	req.Header.Set("X-Amz-Storage-Class", "STANDARD_IA")
+	req.Header.Set("Content-Type", "text/plain")
+
+	before := time.Now().UTC().Truncate(time.Second)
+	_, err = decorator(backend).RoundTrip(req)
+	require.NoError(t, err)
+
+	require.Len(t, backend.requests, 1)
+	signed := backend.requests[0]
+	assert.Equal(t, "storage.googleapis.com", signed.Host)
+	assert.Equal(t, "storage.googleapis.com", signed.URL.Host)
+	assert.Equal(t, "/bucket/dir/key", signed.URL.Path)
+	assert.Equal(t, "NEARLINE", signed.Header.Get("X-Amz-Storage-Class"))
+	amzDate := signed.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	require.NoError(t, err)
+	assert.False(t, signedAt.Before(before))
+	canonicalRequest := strings.Join([]string{
+		http.MethodPut,
+		"/bucket/dir/key",
+		"tagging=",
+		"host:storage.googleapis.com",
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD",
+		"x-amz-date:" + amzDate,
+		"x-amz-storage-class:NEARLINE",
+		"",
+		"host;x-amz-content-sha256;x-amz-date;x-amz-storage-class",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	expectedAuthorization := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=GOOG1EXAMPLE/%s/auto/s3/aws4_request, "+
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-storage-class, Signature=%s",
+		amzDate[:8], v4Signature("gcs-secret", defaultGCSRegion, "s3", amzDate, canonicalRequest))
+	assert.Equal(t, expectedAuthorization, signed.Header.Get("Authorization"))
+	// client request is left as it was
+	assert.Equal(t, "akubra.local", req.Host)
+	assert.Equal(t, "STANDARD_IA", req.Header.Get("X-Amz-Storage-Class"))
+	assert.Contains(t, req.Header.Get("Authorization"), "CLIENTKEY")
+}
+
+func TestGCSShouldRejectChunkedUploads(t *testing.T) {
+	backend := &recordingRoundTripper{}
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", strings.NewReader("data"))
+	req.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+
+	resp, err := GCSDecorator(Keys{AccessKeyID: "GOOG1EXAMPLE", SecretAccessKey: "gcs-secret"},
+		defaultGCSRegion, "storage.googleapis.com")(backend).RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	assert.Empty(t, backend.requests)
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// keystoneTokenMargin is time before token expiration when it's renewed
+	keystoneTokenMargin = time.Minute
+	// keystoneTimeout limits time of single authentication request
+	keystoneTimeout = 5 * time.Second
+	// objectStoreServiceType is Swift service type in Keystone catalog
+	objectStoreServiceType = "object-store"
+)
+
+type keystoneTokenResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string `json:"type"`
+			Endpoints []struct {
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// keystoneAuth obtains project scoped Keystone v3 tokens with password
+// authentication. Token and object store account path from service catalog
+// are cached until token expires
+type keystoneAuth struct {
+	authURL       string
+	user          string
+	password      string
+	userDomain    string
+	project       string
+	projectDomain string
+	region        string
+	iface         string
+	client        *http.Client
+
+	mx          sync.Mutex
+	token       string
+	storagePath string
+	expires     time.Time
+	now         func() time.Time
+}
+
+// credentials returns valid token and object store account path, token is
+// renewed if it's about to expire
+func (ka *keystoneAuth) credentials(ctx context.Context) (string, string, error) {
+	ka.mx.Lock()
+	defer ka.mx.Unlock()
+	if ka.token == "" || !ka.now().Add(keystoneTokenMargin).Before(ka.expires) {
+		if err := ka.authenticate(ctx); err != nil {
+			return "", "", err
+		}
+	}
+	return ka.token, ka.storagePath, nil
+}
+
+// invalidate drops token rejected by storage, unless it's already renewed
+func (ka *keystoneAuth) invalidate(token string) {
+	ka.mx.Lock()
+	defer ka.mx.Unlock()
+	if ka.token == token {
+		ka.token = ""
+	}
+}
+
+func (ka *keystoneAuth) authenticate(ctx context.Context) error {
+	body, err := json.Marshal(ka.authRequest())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(ka.authURL, "/")+"/auth/tokens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ka.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("keystone authentication failed: %s", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("keystone authentication of %q failed with status %d", ka.user, resp.StatusCode)
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	tokenResponse := keystoneTokenResponse{}
+	if err = json.Unmarshal(respBody, &tokenResponse); err != nil {
+		return fmt.Errorf("cannot parse keystone token: %s", err)
+	}
+	storagePath, err := ka.objectStorePath(tokenResponse)
+	if err != nil {
+		return err
+	}
+	ka.token = resp.Header.Get("X-Subject-Token")
+	ka.expires = tokenResponse.Token.ExpiresAt
+	ka.storagePath = storagePath
+	return nil
+}
+
+// objectStorePath finds account path (/v1/AUTH_<project id>) of object store
+// endpoint in catalog. Requests are sent to configured backend, so endpoint
+// host is not used
+func (ka *keystoneAuth) objectStorePath(tokenResponse keystoneTokenResponse) (string, error) {
+	for _, service := range tokenResponse.Token.Catalog {
+		if service.Type != objectStoreServiceType {
+			continue
+		}
+		for _, endpoint := range service.Endpoints {
+			if endpoint.Interface != ka.iface || (ka.region != "" && endpoint.Region != ka.region) {
+				continue
+			}
+			endpointURL, err := url.Parse(endpoint.URL)
+			if err != nil {
+				return "", fmt.Errorf("invalid object store endpoint %q: %s", endpoint.URL, err)
+			}
+			return strings.TrimSuffix(endpointURL.Path, "/"), nil
+		}
+	}
+	return "", fmt.Errorf("no %s endpoint of %s interface in catalog of project %q",
+		objectStoreServiceType, ka.iface, ka.project)
+}
+
+func (ka *keystoneAuth) authRequest() map[string]interface{} {
+	return map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     ka.user,
+						"password": ka.password,
+						"domain":   map[string]string{"name": ka.userDomain},
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"name":   ka.project,
+					"domain": map[string]string{"name": ka.projectDomain},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKeystoneNow = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// keystoneStub issues tokens token-1, token-2... valid for an hour since now
+type keystoneStub struct {
+	*httptest.Server
+	issued       int
+	authRequests []map[string]interface{}
+}
+
+func newKeystoneStub(t *testing.T, now *time.Time) *keystoneStub {
+	stub := &keystoneStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v3/auth/tokens", r.URL.Path)
+		authRequest := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&authRequest))
+		stub.authRequests = append(stub.authRequests, authRequest)
+		stub.issued++
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", stub.issued))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [
+			{"type": "identity", "endpoints": [{"interface": "public", "region": "r1", "url": "https://keystone/v3"}]},
+			{"type": "object-store", "endpoints": [
+				{"interface": "internal", "region": "r1", "url": "https://swift-internal/v1/AUTH_internal"},
+				{"interface": "public", "region": "r1", "url": "https://swift/v1/AUTH_r1/"},
+				{"interface": "public", "region": "r2", "url": "https://swift/v1/AUTH_r2"}
+			]}
+		]}}`, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	return stub
+}
+
+func newTestKeystoneAuth(authURL string, now *time.Time) *keystoneAuth {
+	return &keystoneAuth{
+		authURL:       authURL + "/v3/",
+		user:          "user",
+		password:      "secret",
+		userDomain:    "Default",
+		project:       "project",
+		projectDomain: "Default",
+		region:        "r2",
+		iface:         "public",
+		client:        &http.Client{Timeout: keystoneTimeout},
+		now:           func() time.Time { return *now },
+	}
+}
+
+func TestKeystoneShouldObtainProjectScopedToken(t *testing.T) {
+	now := testKeystoneNow
+	stub := newKeystoneStub(t, &now)
+	defer stub.Close()
+	auth := newTestKeystoneAuth(stub.URL, &now)
+
+	token, storagePath, err := auth.credentials(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, "/v1/AUTH_r2", storagePath)
+	require.Len(t, stub.authRequests, 1)
+	expectedRequest := `{"auth": {
+		"identity": {"methods": ["password"], "password": {"user": {"name": "user", "password": "secret", "domain": {"name": "Default"}}}},
+		"scope": {"project": {"name": "project", "domain": {"name": "Default"}}}
+	}}`
+	actualRequest, err := json.Marshal(stub.authRequests[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, expectedRequest, string(actualRequest))
+}
+
+func TestKeystoneShouldSelectEndpointOfInterfaceAndRegion(t *testing.T) {
+	now := testKeystoneNow
+	stub := newKeystoneStub(t, &now)
+	defer stub.Close()
+	for _, testCase := range []struct {
+		iface, region       string
+		expectedStoragePath string
+	}{
+		{"public", "", "/v1/AUTH_r1"},
+		{"public", "r2", "/v1/AUTH_r2"},
+		{"internal", "", "/v1/AUTH_internal"},
+		{"admin", "", ""},
+		{"public", "r3", ""},
+	} {
+		auth := newTestKeystoneAuth(stub.URL, &now)
+		auth.iface = testCase.iface
+		auth.region = testCase.region
+
+		_, storagePath, err := auth.credentials(context.Background())
+
+		if testCase.expectedStoragePath == "" {
+			assert.Error(t, err, testCase.iface+" "+testCase.region)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expectedStoragePath, storagePath, testCase.iface+" "+testCase.region)
+	}
+}
+
+func TestKeystoneShouldRenewTokenBeforeItExpires(t *testing.T) {
+	now := testKeystoneNow
+	stub := newKeystoneStub(t, &now)
+	defer stub.Close()
+	auth := newTestKeystoneAuth(stub.URL, &now)
+
+	for _, testCase := range []struct {
+		elapsed       time.Duration
+		expectedToken string
+	}{
+		{0, "token-1"},
+		{30 * time.Minute, "token-1"},
+		{time.Hour - keystoneTokenMargin - time.Second, "token-1"},
+		// token expiring within margin is renewed
+		{time.Hour - keystoneTokenMargin, "token-2"},
+		{time.Hour, "token-2"},
+		{2*time.Hour - keystoneTokenMargin, "token-3"},
+	} {
+		now = testKeystoneNow.Add(testCase.elapsed)
+
+		token, _, err := auth.credentials(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expectedToken, token, testCase.elapsed.String())
+	}
+	assert.Equal(t, 3, stub.issued)
+}
+
+func TestKeystoneShouldRenewInvalidatedTokenOnce(t *testing.T) {
+	now := testKeystoneNow
+	stub := newKeystoneStub(t, &now)
+	defer stub.Close()
+	auth := newTestKeystoneAuth(stub.URL, &now)
+
+	first, _, err := auth.credentials(context.Background())
+	require.NoError(t, err)
+	auth.invalidate(first)
+	second, _, err := auth.credentials(context.Background())
+	require.NoError(t, err)
+	// token rejected by concurrent request is already renewed
+	auth.invalidate(first)
+	third, _, err := auth.credentials(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "token-1", first)
+	assert.Equal(t, "token-2", second)
+	assert.Equal(t, "token-2", third)
+}
+
+func TestKeystoneShouldFailIfAuthenticationIsRejected(t *testing.T) {
+	keystone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer keystone.Close()
+	now := testKeystoneNow
+
+	_, _, err := newTestKeystoneAuth(keystone.URL, &now).credentials(context.Background())
+
+	assert.Error(t, err)
+}
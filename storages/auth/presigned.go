@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat = "20060102T150405Z"
+	// maxPresignedExpires is longest validity of V4 presigned URLs, 7 days
+	maxPresignedExpires = 7 * 24 * 60 * 60
+)
+
+var (
+	errPresignedExpired   = errors.New("presigned request has expired")
+	errPresignedMalformed = errors.New("presigned request query is malformed")
+)
+
+// v2SubResources are included in string to sign of V2 signatures
+var v2SubResources = map[string]bool{
+	"acl": true, "cors": true, "delete": true, "lifecycle": true, "location": true, "logging": true,
+	"notification": true, "partNumber": true, "policy": true, "requestPayment": true, "tagging": true,
+	"torrent": true, "uploadId": true, "uploads": true, "versionId": true, "versioning": true, "versions": true,
+	"website": true, "response-cache-control": true, "response-content-disposition": true,
+	"response-content-encoding": true, "response-content-language": true, "response-content-type": true,
+	"response-expires": true,
+}
+
+// presignedQuery holds authentication params of presigned request
+type presignedQuery struct {
+	version   string
+	accessKey string
+	signature string
+	// region is credential scope region of V4 signature
+	region string
+}
+
+// isPresigned reports if request is authenticated with query params
+func isPresigned(req *http.Request) bool {
+	query := req.URL.Query()
+	return query.Get("X-Amz-Signature") != "" || query.Get("Signature") != ""
+}
+
+// parsePresignedQuery extracts authentication params of presigned request
+func parsePresignedQuery(req *http.Request) (presignedQuery, error) {
+	query := req.URL.Query()
+	if signature := query.Get("X-Amz-Signature"); signature != "" {
+		if query.Get("X-Amz-Algorithm") != signV4Algorithm {
+			return presignedQuery{}, errPresignedMalformed
+		}
+		credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+		if len(credential) != 5 || credential[0] == "" {
+			return presignedQuery{}, errPresignedMalformed
+		}
+		return presignedQuery{version: signV4Algorithm, accessKey: credential[0], signature: signature, region: credential[2]}, nil
+	}
+	accessKey := query.Get("AWSAccessKeyId")
+	if accessKey == "" || query.Get("Expires") == "" {
+		return presignedQuery{}, errPresignedMalformed
+	}
+	return presignedQuery{version: signV2Algorithm, accessKey: accessKey, signature: query.Get("Signature")}, nil
+}
+
+// verifyPresigned checks if signature of presigned request matches secret and
+// request hasn't expired at now. V4 signatures are computed for address used
+// by client, V2 signatures for path style resource
+func verifyPresigned(pq presignedQuery, clientReq, pathStyleReq *http.Request, secret string, now time.Time) error {
+	if pq.version == signV4Algorithm {
+		return verifyPresignedV4(pq, clientReq, secret, now)
+	}
+	return verifyPresignedV2(pq, pathStyleReq, secret, now)
+}
+
+func verifyPresignedV4(pq presignedQuery, req *http.Request, secret string, now time.Time) error {
+	query := req.URL.Query()
+	amzDate := query.Get("X-Amz-Date")
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return errPresignedMalformed
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 0 || expires > maxPresignedExpires {
+		return errPresignedMalformed
+	}
+	if now.After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		return errPresignedExpired
+	}
+	signedHeaders := query.Get("X-Amz-SignedHeaders")
+	if signedHeaders == "" {
+		return errPresignedMalformed
+	}
+	query.Del("X-Amz-Signature")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(req.URL.Path, false),
+		canonicalQuery(query),
+		canonicalHeaders(req, strings.Split(signedHeaders, ";")),
+		signedHeaders,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	scope := strings.Join([]string{amzDate[:len("20060102")], pq.region, "s3", "aws4_request"}, "/")
+	canonicalSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{signV4Algorithm, amzDate, scope, hex.EncodeToString(canonicalSum[:])}, "\n")
+	signingKey := []byte("AWS4" + secret)
+	for _, part := range []string{amzDate[:len("20060102")], pq.region, "s3", "aws4_request"} {
+		signingKey = hmacSum(sha256.New, signingKey, part)
+	}
+	expected := hex.EncodeToString(hmacSum(sha256.New, signingKey, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(pq.signature)) {
+		return errors.New("presigned V4 signature does not match")
+	}
+	return nil
+}
+
+func verifyPresignedV2(pq presignedQuery, req *http.Request, secret string, now time.Time) error {
+	query := req.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+	if err != nil {
+		return errPresignedMalformed
+	}
+	if now.Unix() > expires {
+		return errPresignedExpired
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Md5"),
+		req.Header.Get("Content-Type"),
+		query.Get("Expires"),
+		canonicalAmzHeaders(req) + canonicalResource(req),
+	}, "\n")
+	expected := base64.StdEncoding.EncodeToString(hmacSum(sha1.New, []byte(secret), stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(pq.signature)) {
+		return errors.New("presigned V2 signature does not match")
+	}
+	return nil
+}
+
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode encodes all bytes but unreserved characters, slashes are kept
+// unless encodeSlash is set
+func awsURIEncode(value string, encodeSlash bool) string {
+	var encoded bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func canonicalHeaders(req *http.Request, names []string) string {
+	var headers bytes.Buffer
+	for _, name := range names {
+		value := strings.Join(req.Header[http.CanonicalHeaderKey(name)], ",")
+		if name == "host" {
+			value = req.Host
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	return headers.String()
+}
+
+// canonicalAmzHeaders returns x-amz-* headers of V2 string to sign
+func canonicalAmzHeaders(req *http.Request) string {
+	names := make([]string, 0)
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var headers bytes.Buffer
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.Join(req.Header[http.CanonicalHeaderKey(name)], ",") + "\n")
+	}
+	return headers.String()
+}
+
+// canonicalResource returns path style resource with sub-resources of V2
+// string to sign
+func canonicalResource(req *http.Request) string {
+	query := req.URL.Query()
+	names := make([]string, 0)
+	for name := range query {
+		if v2SubResources[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		if value := query.Get(name); value != "" {
+			params = append(params, name+"="+value)
+			continue
+		}
+		params = append(params, name)
+	}
+	resource := req.URL.EscapedPath()
+	if len(params) > 0 {
+		resource += "?" + strings.Join(params, "&")
+	}
+	return resource
+}
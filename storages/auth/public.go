@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+// publicBucketsRoundTripper lets anonymous reads of public buckets bypass
+// authentication, anonymous writes to public buckets are rejected
+type publicBucketsRoundTripper struct {
+	rt      http.RoundTripper
+	buckets map[string]struct{}
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (prt publicBucketsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || isPresigned(req) {
+		return prt.rt.RoundTrip(req)
+	}
+	bucket, _ := splitBucketKey(req.URL.Path)
+	if _, public := prt.buckets[bucket]; !public {
+		return prt.rt.RoundTrip(req)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		metrics.Mark("reqs.auth.anonymous.rejected")
+		log.Debugf("Anonymous %s request %s to public bucket rejected", req.Method, req.Context().Value(log.ContextreqIDKey))
+		return responseAccessDenied(req), nil
+	}
+	metrics.Mark("reqs.auth.anonymous.accepted")
+	return prt.rt.RoundTrip(req.WithContext(types.WithAnonymousRead(req.Context())))
+}
+
+// PublicBucketsDecorator accepts anonymous GET and HEAD requests to buckets,
+// they bypass edge authentication and are sent to backends unsigned. Other
+// anonymous requests to buckets get 403 AccessDenied
+func PublicBucketsDecorator(buckets []string) httphandler.Decorator {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if len(buckets) == 0 {
+			return rt
+		}
+		prt := publicBucketsRoundTripper{rt: rt, buckets: make(map[string]struct{}, len(buckets))}
+		for _, bucket := range buckets {
+			prt.buckets[bucket] = struct{}{}
+		}
+		return prt
+	}
+}
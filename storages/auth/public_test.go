@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicBucketsShouldBypassEdgeAuthForAnonymousReadsOnly(t *testing.T) {
+	edgeRT, calls := newEdgeRoundTripper(t)
+	rt := PublicBucketsDecorator([]string{"public"})(edgeRT)
+	for _, testCase := range []struct {
+		method, url    string
+		expectedStatus int
+	}{
+		{http.MethodGet, "http://akubra.local/public/key", http.StatusOK},
+		{http.MethodHead, "http://akubra.local/public/key", http.StatusOK},
+		{http.MethodGet, "http://akubra.local/public", http.StatusOK},
+		{http.MethodPut, "http://akubra.local/public/key", http.StatusForbidden},
+		{http.MethodDelete, "http://akubra.local/public/key", http.StatusForbidden},
+		{http.MethodGet, "http://akubra.local/private/key", http.StatusForbidden},
+	} {
+		resp, err := rt.RoundTrip(httptest.NewRequest(testCase.method, testCase.url, nil))
+
+		require.NoError(t, err)
+		require.Equal(t, testCase.expectedStatus, resp.StatusCode, testCase.method+" "+testCase.url)
+	}
+	require.Equal(t, 3, *calls)
+}
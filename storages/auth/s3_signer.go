@@ -10,6 +10,8 @@ import (
 	"github.com/allegro/akubra/crdstore"
 	"github.com/allegro/akubra/httphandler"
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/types"
 	"github.com/bnogas/minio-go/pkg/s3signer"
 )
 
@@ -88,15 +90,19 @@ type Keys struct {
 	SecretAccessKey string `json:"secret-key" yaml:"Secret"`
 }
 
-func responseForbidden(req *http.Request) *http.Response {
-	return &http.Response{
-		Status:     "403 Forbidden",
-		StatusCode: http.StatusForbidden,
-		Proto:      req.Proto,
-		ProtoMajor: req.ProtoMajor,
-		ProtoMinor: req.ProtoMinor,
-		Request:    req,
-	}
+func responseSignatureDoesNotMatch(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrSignatureDoesNotMatch,
+		"The request signature we calculated does not match the signature you provided.")
+}
+
+func responseMalformedAuthorization(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrAuthorizationMalformed,
+		"The authorization header is malformed.")
+}
+
+func responseInvalidAccessKey(req *http.Request) *http.Response {
+	return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrInvalidAccessKeyID,
+		"The AWS Access Key Id you provided does not exist in our records.")
 }
 
 type authRoundTripper struct {
@@ -109,7 +115,7 @@ func (art authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error)
 	if DoesSignMatch(req, art.keys) == ErrNone {
 		return art.rt.RoundTrip(req)
 	}
-	return responseForbidden(req), nil
+	return responseSignatureDoesNotMatch(req), nil
 }
 
 // S3Decorator checks if request Signature matches s3 keys
@@ -135,9 +141,12 @@ type signAuthServiceRoundTripper struct {
 
 // RoundTrip implements http.RoundTripper interface
 func (srt signRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if types.IsAnonymousRead(req.Context()) {
+		return srt.rt.RoundTrip(req)
+	}
 	authHeader, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
 	if err != nil {
-		return &http.Response{StatusCode: http.StatusBadRequest, Request: req}, err
+		return responseMalformedAuthorization(req), err
 	}
 
 	req = s3signer.SignV2(*req, srt.keys.AccessKeyID, srt.keys.SecretAccessKey)
@@ -168,41 +177,74 @@ func ParseAuthorizationHeader(authorizationHeader string) (authHeader ParsedAuth
 
 // RoundTrip implements http.RoundTripper interface
 func (srt signAuthServiceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if types.IsAnonymousRead(req.Context()) {
+		req.Host = srt.host
+		req.URL.Host = srt.host
+		return srt.rt.RoundTrip(req)
+	}
 	authHeader, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
 	if err != nil {
-		return &http.Response{StatusCode: http.StatusBadRequest, Request: req}, err
+		return responseMalformedAuthorization(req), err
 	}
 
-	csd, err := srt.crd.Get(authHeader.AccessKey, "akubra")
+	csd, err := srt.crd.GetWithContext(req.Context(), authHeader.AccessKey, "akubra")
 	if err == crdstore.ErrCredentialsNotFound {
-		return &http.Response{StatusCode: http.StatusForbidden, Request: req}, err
+		return responseInvalidAccessKey(req), err
 	}
 	if err != nil {
-		return &http.Response{StatusCode: http.StatusInternalServerError, Request: req}, err
+		return types.NewS3ErrorResponseForStatus(req, http.StatusInternalServerError), err
 	}
-	if DoesSignMatch(req, Keys{AccessKeyID: csd.AccessKey, SecretAccessKey: csd.SecretKey}) != ErrNone {
-		return &http.Response{StatusCode: http.StatusForbidden, Request: req}, err
+	clientKeys := Keys{AccessKeyID: csd.AccessKey, SecretAccessKey: csd.SecretKey}
+	// Requests verified by edge authentication may have been rewritten since,
+	// e.g. encrypted, so their signature doesn't cover them anymore
+	if accessKey, verified := types.AuthenticatedAccessKey(req.Context()); !verified || accessKey != authHeader.AccessKey {
+		if DoesSignMatch(req, clientKeys) != ErrNone {
+			return responseSignatureDoesNotMatch(req), err
+		}
 	}
 
-	csd, err = srt.crd.Get(authHeader.AccessKey, srt.backend)
+	csd, err = srt.crd.GetWithContext(req.Context(), authHeader.AccessKey, srt.backend)
 	if err == crdstore.ErrCredentialsNotFound {
-		return &http.Response{StatusCode: http.StatusForbidden, Request: req}, err
+		return responseInvalidAccessKey(req), err
 	}
 	if err != nil {
-		return &http.Response{StatusCode: http.StatusInternalServerError, Request: req}, err
+		return types.NewS3ErrorResponseForStatus(req, http.StatusInternalServerError), err
 	}
 
 	req.Host = srt.host
 	req.URL.Host = srt.host
-	switch authHeader.Version {
-	case signV2Algorithm:
+	switch {
+	case authHeader.Version == signV4Algorithm && awschunked.IsStreamingUpload(req):
+		return srt.roundTripStreaming(req, authHeader, clientKeys, Keys{AccessKeyID: csd.AccessKey, SecretAccessKey: csd.SecretKey})
+	case authHeader.Version == signV2Algorithm:
 		req = s3signer.SignV2(*req, csd.AccessKey, csd.SecretKey)
-	case signV4Algorithm:
+	case authHeader.Version == signV4Algorithm:
 		req = s3signer.SignV4(*req, csd.AccessKey, csd.SecretKey, "", "")
 	}
 	return srt.rt.RoundTrip(req)
 }
 
+// roundTripStreaming sends chunk signed upload with chunks signed by backend
+// keys, upload with invalid client chunk signature gets SignatureDoesNotMatch
+func (srt signAuthServiceRoundTripper) roundTripStreaming(req *http.Request, authHeader ParsedAuthorizationHeader, client, backend Keys) (*http.Response, error) {
+	resigned, decoder, err := resignStreamingUpload(req, authHeader, client, backend)
+	if err != nil {
+		reqID := req.Context().Value(log.ContextreqIDKey)
+		log.Printf("Cannot resign streaming upload %s: %s", reqID, err)
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidRequest, err.Error()), nil
+	}
+	resp, err := srt.rt.RoundTrip(resigned)
+	if decoder.Err() != awschunked.ErrSignatureMismatch {
+		return resp, err
+	}
+	if resp != nil && resp.Body != nil {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Debugf("Cannot close response body: %s", closeErr)
+		}
+	}
+	return responseSignatureDoesNotMatch(req), nil
+}
+
 // SignDecorator will recompute auth headers for new Key
 func SignDecorator(keys Keys, region, host string) httphandler.Decorator {
 	return func(rt http.RoundTripper) http.RoundTripper {
@@ -211,12 +253,8 @@ func SignDecorator(keys Keys, region, host string) httphandler.Decorator {
 }
 
 // SignAuthServiceDecorator will compute
-func SignAuthServiceDecorator(backend, endpoint, host string) httphandler.Decorator {
+func SignAuthServiceDecorator(backend, host string, credentialsStore *crdstore.CredentialsStore) httphandler.Decorator {
 	return func(rt http.RoundTripper) http.RoundTripper {
-		credentialsStore, err := crdstore.GetInstance(endpoint)
-		if err != nil {
-			log.Fatalf("error CredentialsStore `%s` is not defined", endpoint)
-		}
 		return signAuthServiceRoundTripper{rt: rt, backend: backend, host: host, crd: credentialsStore}
 	}
 }
@@ -231,6 +269,10 @@ type forceSignRoundTripper struct {
 // RoundTrip implements http.RoundTripper interface
 func (srt forceSignRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	if srt.shouldBeSigned(req) {
+		if awschunked.IsStreamingUpload(req) {
+			// V2 signatures don't cover body, chunk signatures of client are dropped
+			req, _ = awschunked.Decode(req, nil)
+		}
 		header := make(http.Header, len(req.Header))
 		for k, v := range req.Header {
 			header[k] = v
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+)
+
+// streamingChunkSize is size of chunks of bodies re-signed for backends
+const streamingChunkSize = 64 * 1024
+
+// resignStreamingUpload replaces chunk signatures made with client keys by
+// ones made with backend keys. Client signatures are verified while body is
+// read, returned Reader reports ErrSignatureMismatch
+func resignStreamingUpload(req *http.Request, clientAuth ParsedAuthorizationHeader, client, backend Keys) (*http.Request, *awschunked.Reader, error) {
+	decodedLength, err := strconv.ParseInt(req.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid X-Amz-Decoded-Content-Length of streaming upload: %s", err)
+	}
+	verifier, err := awschunked.NewSigner(client.SecretAccessKey, req.Header.Get("X-Amz-Date"), clientAuth.Region, clientAuth.Signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	resigned := req.WithContext(req.Context())
+	resigned.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		resigned.Header[name] = values
+	}
+	resigned.ContentLength = awschunked.EncodedLength(decodedLength, streamingChunkSize)
+	resigned.Header.Set("Content-Length", strconv.FormatInt(resigned.ContentLength, 10))
+	resigned = s3signer.SignV4(*resigned, backend.AccessKeyID, backend.SecretAccessKey, "", "")
+	backendAuth, err := ParseAuthorizationHeader(resigned.Header.Get("Authorization"))
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := awschunked.NewSigner(backend.SecretAccessKey, resigned.Header.Get("X-Amz-Date"), backendAuth.Region, backendAuth.Signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	decoder := awschunked.NewReader(req.Body, verifier)
+	resigned.Body = struct {
+		io.Reader
+		io.Closer
+	}{awschunked.NewEncoder(decoder, signer, streamingChunkSize), req.Body}
+	return resigned, decoder, nil
+}
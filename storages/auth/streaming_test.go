@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamingUpload(t *testing.T, keys Keys, data string) (*http.Request, ParsedAuthorizationHeader) {
+	req, err := http.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	req = s3signer.SignV4(*req, keys.AccessKeyID, keys.SecretAccessKey, "", "us-east-1")
+	authHeader, err := ParseAuthorizationHeader(req.Header.Get("Authorization"))
+	require.NoError(t, err)
+	signer, err := awschunked.NewSigner(keys.SecretAccessKey, req.Header.Get("X-Amz-Date"), authHeader.Region, authHeader.Signature)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(awschunked.NewEncoder(strings.NewReader(data), signer, 5))
+	require.NoError(t, err)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return req, authHeader
+}
+
+func TestResignStreamingUploadShouldSignChunksWithBackendKeys(t *testing.T) {
+	client := Keys{AccessKeyID: "client", SecretAccessKey: "client-secret"}
+	backend := Keys{AccessKeyID: "backend", SecretAccessKey: "backend-secret"}
+	req, authHeader := streamingUpload(t, client, "hello world")
+
+	resigned, decoder, err := resignStreamingUpload(req, authHeader, client, backend)
+	require.NoError(t, err)
+	backendAuth, err := ParseAuthorizationHeader(resigned.Header.Get("Authorization"))
+	require.NoError(t, err)
+	require.Equal(t, "backend", backendAuth.AccessKey)
+	verifier, err := awschunked.NewSigner(backend.SecretAccessKey, resigned.Header.Get("X-Amz-Date"), backendAuth.Region, backendAuth.Signature)
+	require.NoError(t, err)
+	encoded, err := ioutil.ReadAll(resigned.Body)
+	require.NoError(t, err)
+	decoded, err := ioutil.ReadAll(awschunked.NewReader(bytes.NewReader(encoded), verifier))
+
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(decoded))
+	assert.Equal(t, int64(len(encoded)), resigned.ContentLength)
+	assert.NoError(t, decoder.Err())
+}
+
+func TestResignStreamingUploadShouldReportInvalidClientChunks(t *testing.T) {
+	client := Keys{AccessKeyID: "client", SecretAccessKey: "client-secret"}
+	req, authHeader := streamingUpload(t, client, "hello world")
+
+	resigned, decoder, err := resignStreamingUpload(req, authHeader, Keys{AccessKeyID: "client", SecretAccessKey: "wrong"},
+		Keys{AccessKeyID: "backend", SecretAccessKey: "backend-secret"})
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resigned.Body)
+
+	assert.Equal(t, awschunked.ErrSignatureMismatch, err)
+	assert.Equal(t, awschunked.ErrSignatureMismatch, decoder.Err())
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/crdstore"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+)
+
+// swiftLastModifiedLayout is format of last_modified field in Swift listings
+const swiftLastModifiedLayout = "2006-01-02T15:04:05.999999999"
+
+// swiftRequestHeaders are passed from S3 request to Swift request unchanged
+var swiftRequestHeaders = []string{
+	"Content-Disposition", "Content-Encoding", "Content-Length", "Content-Type",
+	"If-Match", "If-Modified-Since", "If-None-Match", "If-Unmodified-Since", "Range",
+}
+
+// swiftResponseHeaders are passed from Swift response to S3 response unchanged
+var swiftResponseHeaders = []string{
+	"Accept-Ranges", "Content-Disposition", "Content-Encoding", "Content-Length",
+	"Content-Range", "Content-Type", "Date", "Last-Modified",
+}
+
+type swiftListingEntry struct {
+	Name         string `json:"name"`
+	Hash         string `json:"hash"`
+	Bytes        int64  `json:"bytes"`
+	LastModified string `json:"last_modified"`
+	Subdir       string `json:"subdir"`
+}
+
+// swiftRoundTripper translates S3 requests to OpenStack Swift API calls
+// authorized with Keystone v3 tokens. Buckets are mapped to containers of
+// project account
+type swiftRoundTripper struct {
+	rt   http.RoundTripper
+	auth *keystoneAuth
+	host string
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (srt swiftRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			"Chunked upload signatures are not supported by Swift storage."), nil
+	}
+	container, object := splitBucketKey(req.URL.Path)
+	switch {
+	case container == "":
+	case object != "" && isObjectRequest(req):
+		return srt.objectRequest(req, container, object)
+	case object == "" && isListingRequest(req):
+		return srt.listObjects(req, container)
+	case object == "" && isBucketRequest(req):
+		return srt.containerRequest(req, container)
+	}
+	return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+		"Operation is not supported by Swift storage."), nil
+}
+
+func (srt swiftRoundTripper) objectRequest(req *http.Request, container, object string) (*http.Response, error) {
+	swReq := newTranslatedRequest(req, srt.host, "/"+container+"/"+object, nil)
+	if req.ContentLength != 0 {
+		swReq.Body = req.Body
+		swReq.ContentLength = req.ContentLength
+	}
+	copyHeaders(swReq.Header, req.Header, swiftRequestHeaders)
+	renameHeaders(swReq.Header, req.Header, "X-Amz-Meta-", "X-Object-Meta-")
+	// Swift verifies uploads against hex encoded ETag
+	if md5Sum, err := base64.StdEncoding.DecodeString(req.Header.Get("Content-MD5")); err == nil && len(md5Sum) > 0 {
+		swReq.Header.Set("Etag", hex.EncodeToString(md5Sum))
+	}
+	resp, err := srt.do(swReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		if req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+			// S3 reports deletes of missing objects as successful
+			closeResponseBody(req, resp)
+			return emptyResponse(req, http.StatusNoContent), nil
+		}
+		return translateSwiftError(req, resp, types.S3ErrNoSuchKey), nil
+	}
+	header := make(http.Header)
+	copyHeaders(header, resp.Header, swiftResponseHeaders)
+	renameHeaders(header, resp.Header, "X-Object-Meta-", "X-Amz-Meta-")
+	if etag := resp.Header.Get("Etag"); etag != "" {
+		header.Set("ETag", strconv.Quote(strings.Trim(etag, `"`)))
+	}
+	resp.Header = header
+	resp.Request = req
+	if resp.StatusCode == http.StatusCreated {
+		setStatus(resp, http.StatusOK)
+	}
+	return resp, nil
+}
+
+// containerRequest serves bucket creation, deletion and HEAD
+func (srt swiftRoundTripper) containerRequest(req *http.Request, container string) (*http.Response, error) {
+	resp, err := srt.do(newTranslatedRequest(req, srt.host, "/"+container, nil))
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == http.MethodDelete && resp.StatusCode == http.StatusConflict {
+		closeResponseBody(req, resp)
+		return types.NewS3ErrorResponse(req, http.StatusConflict, types.S3ErrBucketNotEmpty,
+			"The bucket you tried to delete is not empty."), nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return translateSwiftError(req, resp, types.S3ErrNoSuchBucket), nil
+	}
+	closeResponseBody(req, resp)
+	if req.Method == http.MethodDelete {
+		return emptyResponse(req, http.StatusNoContent), nil
+	}
+	return emptyResponse(req, http.StatusOK), nil
+}
+
+// listObjects serves ListObjects and ListObjectsV2. Swift markers are keys as
+// in S3, one more entry is requested to find out if listing is truncated
+func (srt swiftRoundTripper) listObjects(req *http.Request, container string) (*http.Response, error) {
+	params, errResp := parseListingParams(req)
+	if errResp != nil {
+		return errResp, nil
+	}
+	swQuery := url.Values{
+		"format": []string{"json"},
+		"limit":  []string{strconv.FormatInt(params.maxKeys+1, 10)},
+	}
+	for name, value := range map[string]string{"prefix": params.prefix, "delimiter": params.delimiter, "marker": params.marker} {
+		if value != "" {
+			swQuery.Set(name, value)
+		}
+	}
+	resp, err := srt.do(newTranslatedRequest(req, srt.host, "/"+container, swQuery))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return translateSwiftError(req, resp, types.S3ErrNoSuchBucket), nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	closeResponseBody(req, resp)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]swiftListingEntry, 0)
+	// Empty containers may be listed with 204 and no body
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &entries); err != nil {
+			return nil, fmt.Errorf("cannot parse Swift listing of %s: %s", container, err)
+		}
+	}
+
+	nextMarker := ""
+	if int64(len(entries)) > params.maxKeys {
+		entries = entries[:params.maxKeys]
+		last := entries[len(entries)-1]
+		nextMarker = last.Name + last.Subdir
+	}
+	contents := make(s3datatypes.ObjectInfos, 0, len(entries))
+	prefixes := make(s3datatypes.CommonPrefixes, 0)
+	for _, entry := range entries {
+		if entry.Subdir != "" {
+			prefixes = append(prefixes, s3datatypes.CommonPrefix{Prefix: entry.Subdir})
+			continue
+		}
+		lastModified, _ := time.Parse(swiftLastModifiedLayout, entry.LastModified)
+		contents = append(contents, s3datatypes.ObjectInfo{
+			Key:          entry.Name,
+			ETag:         strconv.Quote(entry.Hash),
+			LastModified: lastModified,
+			Size:         entry.Bytes,
+			StorageClass: "STANDARD",
+		})
+	}
+	return params.response(req, container, contents, prefixes, nextMarker)
+}
+
+// do sends request for resource of project account. Request rejected with
+// expired token is retried once with new token, if it has no body to replay
+func (srt swiftRoundTripper) do(swReq *http.Request) (*http.Response, error) {
+	resource := swReq.URL.Path
+	for attempt := 0; ; attempt++ {
+		token, storagePath, err := srt.auth.credentials(swReq.Context())
+		if err != nil {
+			return nil, err
+		}
+		attemptReq := *swReq
+		attemptURL := *swReq.URL
+		attemptURL.Path = storagePath + resource
+		attemptReq.URL = &attemptURL
+		attemptReq.Header = make(http.Header, len(swReq.Header)+1)
+		for name, values := range swReq.Header {
+			attemptReq.Header[name] = values
+		}
+		attemptReq.Header.Set("X-Auth-Token", token)
+		resp, err := srt.rt.RoundTrip(&attemptReq)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		srt.auth.invalidate(token)
+		if attempt > 0 || swReq.Body != nil {
+			return resp, nil
+		}
+		closeResponseBody(swReq, resp)
+	}
+}
+
+// translateSwiftError replaces Swift error response with S3 one, notFoundCode
+// is used for 404 responses
+func translateSwiftError(req *http.Request, resp *http.Response, notFoundCode string) *http.Response {
+	closeResponseBody(req, resp)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		if notFoundCode == types.S3ErrNoSuchBucket {
+			return types.NewS3ErrorResponse(req, http.StatusNotFound, notFoundCode, "The specified bucket does not exist.")
+		}
+		return types.NewS3ErrorResponse(req, http.StatusNotFound, notFoundCode, "The specified key does not exist.")
+	case http.StatusUnauthorized:
+		return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied, "Access Denied")
+	case http.StatusPreconditionFailed:
+		return types.NewS3ErrorResponse(req, http.StatusPreconditionFailed, types.S3ErrPreconditionFailed,
+			"At least one of the pre-conditions you specified did not hold.")
+	case http.StatusRequestedRangeNotSatisfiable:
+		return types.NewS3ErrorResponse(req, http.StatusRequestedRangeNotSatisfiable, types.S3ErrInvalidRange,
+			"The requested range is not satisfiable.")
+	case http.StatusUnprocessableEntity:
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrBadDigest,
+			"The Content-MD5 you specified did not match what we received.")
+	}
+	return types.NewS3ErrorResponseForStatus(req, resp.StatusCode)
+}
+
+func swiftDecoratorFactory(backend string, backendConf config.Storage, _ crdstore.Stores) (httphandler.Decorator, error) {
+	properties := backendConf.Properties
+	for _, name := range []string{"AuthURL", "Username", "Password", "Project"} {
+		if _, ok := properties[name]; !ok {
+			return nil, fmt.Errorf("no %s defined for backend type %q", name, Swift)
+		}
+	}
+	auth := &keystoneAuth{
+		authURL:    properties["AuthURL"],
+		user:       properties["Username"],
+		password:   properties["Password"],
+		userDomain: propertyOrDefault(properties, "UserDomain", "Default"),
+		project:    properties["Project"],
+		region:     properties["Region"],
+		iface:      propertyOrDefault(properties, "Interface", "public"),
+		client:     &http.Client{Timeout: keystoneTimeout},
+		now:        time.Now,
+	}
+	auth.projectDomain = propertyOrDefault(properties, "ProjectDomain", auth.userDomain)
+	host := backendConf.Backend.Host
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return swiftRoundTripper{rt: rt, auth: auth, host: host}
+	}, nil
+}
+
+func propertyOrDefault(properties map[string]string, name, defaultValue string) string {
+	if value, ok := properties[name]; ok {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// swiftStub records Swift API calls and answers them with handler
+type swiftStub struct {
+	*httptest.Server
+	keystone *keystoneStub
+	requests []*http.Request
+	rt       http.RoundTripper
+}
+
+func newSwiftStub(t *testing.T, handler http.HandlerFunc) *swiftStub {
+	now := testKeystoneNow
+	stub := &swiftStub{keystone: newKeystoneStub(t, &now)}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.requests = append(stub.requests, r)
+		handler(w, r)
+	}))
+	stub.rt = swiftRoundTripper{
+		rt:   http.DefaultTransport,
+		auth: newTestKeystoneAuth(stub.keystone.URL, &now),
+		host: strings.TrimPrefix(stub.URL, "http://"),
+	}
+	return stub
+}
+
+func (stub *swiftStub) Close() {
+	stub.Server.Close()
+	stub.keystone.Close()
+}
+
+func (stub *swiftStub) roundTrip(t *testing.T, req *http.Request) *http.Response {
+	resp, err := stub.rt.RoundTrip(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestSwiftShouldTranslateOperations(t *testing.T) {
+	for _, testCase := range []struct {
+		name                string
+		method, url         string
+		swiftStatus         int
+		expectedSwiftMethod string
+		expectedSwiftURL    string
+		expectedStatus      int
+	}{
+		{"get object", http.MethodGet, "/bucket/dir/key", http.StatusOK,
+			http.MethodGet, "/v1/AUTH_r2/bucket/dir/key", http.StatusOK},
+		{"head object", http.MethodHead, "/bucket/key", http.StatusOK,
+			http.MethodHead, "/v1/AUTH_r2/bucket/key", http.StatusOK},
+		{"put object", http.MethodPut, "/bucket/key", http.StatusCreated,
+			http.MethodPut, "/v1/AUTH_r2/bucket/key", http.StatusOK},
+		{"delete object", http.MethodDelete, "/bucket/key", http.StatusNoContent,
+			http.MethodDelete, "/v1/AUTH_r2/bucket/key", http.StatusNoContent},
+		{"delete missing object", http.MethodDelete, "/bucket/key", http.StatusNotFound,
+			http.MethodDelete, "/v1/AUTH_r2/bucket/key", http.StatusNoContent},
+		{"get missing object", http.MethodGet, "/bucket/key", http.StatusNotFound,
+			http.MethodGet, "/v1/AUTH_r2/bucket/key", http.StatusNotFound},
+		{"create bucket", http.MethodPut, "/bucket", http.StatusCreated,
+			http.MethodPut, "/v1/AUTH_r2/bucket", http.StatusOK},
+		{"head bucket", http.MethodHead, "/bucket", http.StatusNoContent,
+			http.MethodHead, "/v1/AUTH_r2/bucket", http.StatusOK},
+		{"delete bucket", http.MethodDelete, "/bucket", http.StatusNoContent,
+			http.MethodDelete, "/v1/AUTH_r2/bucket", http.StatusNoContent},
+		{"delete not empty bucket", http.MethodDelete, "/bucket", http.StatusConflict,
+			http.MethodDelete, "/v1/AUTH_r2/bucket", http.StatusConflict},
+		{"list objects", http.MethodGet, "/bucket?prefix=dir/&delimiter=/&max-keys=10", http.StatusOK,
+			http.MethodGet, "/v1/AUTH_r2/bucket?delimiter=%2F&format=json&limit=11&prefix=dir%2F", http.StatusOK},
+		{"list objects v2", http.MethodGet, "/bucket?list-type=2&continuation-token=dir/a", http.StatusOK,
+			http.MethodGet, "/v1/AUTH_r2/bucket?format=json&limit=1001&marker=dir%2Fa", http.StatusOK},
+		{"expired token", http.MethodGet, "/bucket/key", http.StatusUnauthorized,
+			http.MethodGet, "/v1/AUTH_r2/bucket/key", http.StatusForbidden},
+		{"multipart upload", http.MethodPost, "/bucket/key?uploads", 0, "", "", http.StatusNotImplemented},
+		{"object acl", http.MethodGet, "/bucket/key?acl", 0, "", "", http.StatusNotImplemented},
+		{"list buckets", http.MethodGet, "/", 0, "", "", http.StatusNotImplemented},
+	} {
+		stub := newSwiftStub(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("format") == "json" {
+				_, _ = w.Write([]byte("[]"))
+				return
+			}
+			w.WriteHeader(testCase.swiftStatus)
+		})
+		resp := stub.roundTrip(t, httptest.NewRequest(testCase.method, "http://akubra.local"+testCase.url, nil))
+		stub.Close()
+
+		assert.Equal(t, testCase.expectedStatus, resp.StatusCode, testCase.name)
+		if testCase.expectedSwiftMethod == "" {
+			assert.Empty(t, stub.requests, testCase.name)
+			continue
+		}
+		require.NotEmpty(t, stub.requests, testCase.name)
+		swReq := stub.requests[len(stub.requests)-1]
+		assert.Equal(t, testCase.expectedSwiftMethod, swReq.Method, testCase.name)
+		assert.Equal(t, testCase.expectedSwiftURL, swReq.URL.String(), testCase.name)
+		assert.Equal(t, fmt.Sprintf("token-%d", stub.keystone.issued), swReq.Header.Get("X-Auth-Token"), testCase.name)
+	}
+}
+
+func TestSwiftShouldRetryRequestRejectedWithExpiredTokenOnce(t *testing.T) {
+	stub := newSwiftStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") == "token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	defer stub.Close()
+
+	resp := stub.roundTrip(t, httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket/key", nil))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, stub.requests, 2)
+	assert.Equal(t, "token-1", stub.requests[0].Header.Get("X-Auth-Token"))
+	assert.Equal(t, "token-2", stub.requests[1].Header.Get("X-Auth-Token"))
+}
+
+func TestSwiftShouldRejectCopiesAndChunkedUploads(t *testing.T) {
+	stub := newSwiftStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	defer stub.Close()
+	copyReq := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", nil)
+	copyReq.Header.Set("X-Amz-Copy-Source", "/bucket/other")
+	chunked := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", strings.NewReader("body"))
+	chunked.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+
+	for _, req := range []*http.Request{copyReq, chunked} {
+		assert.Equal(t, http.StatusNotImplemented, stub.roundTrip(t, req).StatusCode)
+	}
+	assert.Empty(t, stub.requests)
+	assert.Zero(t, stub.keystone.issued)
+}
+
+func TestSwiftShouldTranslateObjectHeaders(t *testing.T) {
+	stub := newSwiftStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", "5eb63bbbe01eeed093cb22bb8f5acdc3")
+		w.Header().Set("X-Object-Meta-Owner", "team")
+		w.Header().Set("X-Trans-Id", "swift-transaction")
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer stub.Close()
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key", strings.NewReader("hello world"))
+	req.Header.Set("Content-MD5", "XrY7u+Ae7tCTyyK7j1rNww==")
+	req.Header.Set("X-Amz-Meta-Owner", "team")
+
+	resp := stub.roundTrip(t, req)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "team", resp.Header.Get("X-Amz-Meta-Owner"))
+	assert.Empty(t, resp.Header.Get("X-Trans-Id"))
+	swReq := stub.requests[0]
+	assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", swReq.Header.Get("Etag"))
+	assert.Equal(t, "team", swReq.Header.Get("X-Object-Meta-Owner"))
+}
+
+func TestSwiftShouldTranslateListing(t *testing.T) {
+	stub := newSwiftStub(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[
+			{"name": "dir/a", "hash": "5eb63bbbe01eeed093cb22bb8f5acdc3", "bytes": 11, "last_modified": "2018-01-02T03:04:05.123456"},
+			{"subdir": "dir/sub/"},
+			{"name": "dir/z", "hash": "d41d8cd98f00b204e9800998ecf8427e", "bytes": 0, "last_modified": "2018-01-02T03:04:05"}
+		]`))
+	})
+	defer stub.Close()
+
+	resp := stub.roundTrip(t, httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket?prefix=dir/&delimiter=/&max-keys=2", nil))
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	result := s3datatypes.ListBucketResult{}
+	require.NoError(t, xml.Unmarshal(body, &result))
+	require.Len(t, result.Contents, 1)
+	assert.Equal(t, "dir/a", result.Contents[0].Key)
+	assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, result.Contents[0].ETag)
+	assert.Equal(t, int64(11), result.Contents[0].Size)
+	assert.Equal(t, time.Date(2018, 1, 2, 3, 4, 5, 123456000, time.UTC), result.Contents[0].LastModified.UTC())
+	require.Len(t, result.CommonPrefixes, 1)
+	assert.Equal(t, "dir/sub/", result.CommonPrefixes[0].Prefix)
+	assert.True(t, result.IsTruncated)
+	assert.Equal(t, "dir/sub/", result.NextMarker)
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/allegro/akubra/types"
+)
+
+// Helpers shared by storage types translating S3 API to other object storage APIs
+
+// defaultMaxKeys is number of keys listed if client didn't set max-keys, it's
+// also the limit of keys listed at once
+const defaultMaxKeys = 1000
+
+// listingQueryParams are S3 listing query parameters translated listings serve
+var listingQueryParams = map[string]struct{}{
+	"list-type": {}, "prefix": {}, "delimiter": {}, "marker": {}, "max-keys": {},
+	"continuation-token": {}, "encoding-type": {}, "fetch-owner": {},
+}
+
+// listingParams are ListObjects (V1 or V2) request parameters
+type listingParams struct {
+	listV2       bool
+	prefix       string
+	delimiter    string
+	marker       string
+	encodingType string
+	maxKeys      int64
+}
+
+// isObjectRequest reports if request is plain object GET, HEAD, PUT or DELETE
+func isObjectRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return req.URL.RawQuery == "" && req.Header.Get("X-Amz-Copy-Source") == ""
+	}
+	return false
+}
+
+// isBucketRequest reports if request is bucket creation, deletion or HEAD
+func isBucketRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodHead, http.MethodPut, http.MethodDelete:
+		return req.URL.RawQuery == ""
+	}
+	return false
+}
+
+func isListingRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	query := req.URL.Query()
+	for name := range query {
+		if _, ok := listingQueryParams[name]; !ok {
+			return false
+		}
+	}
+	listType := query.Get("list-type")
+	return listType == "" || listType == "2"
+}
+
+// parseListingParams reads listing parameters, continuation token of V2
+// listing is returned as marker
+func parseListingParams(req *http.Request) (listingParams, *http.Response) {
+	query := req.URL.Query()
+	params := listingParams{
+		listV2:       query.Get("list-type") == "2",
+		prefix:       query.Get("prefix"),
+		delimiter:    query.Get("delimiter"),
+		marker:       query.Get("marker"),
+		encodingType: query.Get("encoding-type"),
+		maxKeys:      defaultMaxKeys,
+	}
+	if params.listV2 {
+		params.marker = query.Get("continuation-token")
+	}
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxKeys < 1 {
+			return params, types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidArgument,
+				"Provided max-keys is not valid.")
+		}
+		params.maxKeys = maxKeys
+	}
+	if params.maxKeys > defaultMaxKeys {
+		params.maxKeys = defaultMaxKeys
+	}
+	return params, nil
+}
+
+// response creates ListBucketResult or ListBucketV2Result response, keys are
+// url encoded if client asked for it
+func (lp listingParams) response(req *http.Request, bucket string, contents s3datatypes.ObjectInfos,
+	prefixes s3datatypes.CommonPrefixes, nextMarker string) (*http.Response, error) {
+	encode := func(value string) string {
+		if lp.encodingType == "url" {
+			return url.QueryEscape(value)
+		}
+		return value
+	}
+	for i := range contents {
+		contents[i].Key = encode(contents[i].Key)
+	}
+	for i := range prefixes {
+		prefixes[i].Prefix = encode(prefixes[i].Prefix)
+	}
+	var result interface{}
+	if lp.listV2 {
+		result = s3datatypes.ListBucketV2Result{
+			Name:                  bucket,
+			Prefix:                encode(lp.prefix),
+			Delimiter:             encode(lp.delimiter),
+			EncodingType:          lp.encodingType,
+			MaxKeys:               lp.maxKeys,
+			ContinuationToken:     lp.marker,
+			NextContinuationToken: nextMarker,
+			IsTruncated:           nextMarker != "",
+			Contents:              contents,
+			CommonPrefixes:        prefixes,
+		}
+	} else {
+		result = s3datatypes.ListBucketResult{
+			Name:           bucket,
+			Prefix:         encode(lp.prefix),
+			Delimiter:      encode(lp.delimiter),
+			EncodingType:   lp.encodingType,
+			MaxKeys:        lp.maxKeys,
+			Marker:         encode(lp.marker),
+			NextMarker:     encode(nextMarker),
+			IsTruncated:    nextMarker != "",
+			Contents:       contents,
+			CommonPrefixes: prefixes,
+		}
+	}
+	body, err := xml.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return xmlResponse(req, append([]byte(xml.Header), body...)), nil
+}
+
+// newTranslatedRequest creates request to backend resource without body and
+// headers of original request
+func newTranslatedRequest(req *http.Request, host, path string, query url.Values) *http.Request {
+	backendReq := req.WithContext(req.Context())
+	backendURL := *req.URL
+	backendURL.Host = host
+	backendURL.Path = path
+	backendURL.RawPath = ""
+	backendURL.RawQuery = query.Encode()
+	backendReq.URL = &backendURL
+	backendReq.Host = host
+	backendReq.Header = make(http.Header)
+	backendReq.Body = nil
+	backendReq.ContentLength = 0
+	return backendReq
+}
+
+// splitBucketKey is utils.SplitBucketKey, which can't be imported here as
+// utils imports this package
+func splitBucketKey(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func copyHeaders(dst, src http.Header, names []string) {
+	for _, name := range names {
+		if values, ok := src[http.CanonicalHeaderKey(name)]; ok {
+			dst[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+}
+
+func renameHeaders(dst, src http.Header, fromPrefix, toPrefix string) {
+	for name, values := range src {
+		if strings.HasPrefix(name, fromPrefix) {
+			dst[toPrefix+strings.TrimPrefix(name, fromPrefix)] = values
+		}
+	}
+}
+
+func setStatus(resp *http.Response, statusCode int) {
+	resp.StatusCode = statusCode
+	resp.Status = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+}
+
+func emptyResponse(req *http.Request, statusCode int) *http.Response {
+	resp := xmlResponse(req, nil)
+	resp.Header.Del("Content-Type")
+	setStatus(resp, statusCode)
+	return resp
+}
+
+func xmlResponse(req *http.Request, body []byte) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func closeResponseBody(req *http.Request, resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Could not close backend response body for request %s: %s",
+			req.Context().Value(log.ContextreqIDKey), err)
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldClassifyTranslatedRequests(t *testing.T) {
+	for _, testCase := range []struct {
+		method, url                    string
+		copySource                     string
+		expectedObject, expectedBucket bool
+		expectedListing                bool
+	}{
+		{http.MethodGet, "/bucket/key", "", true, false, true},
+		{http.MethodHead, "/bucket/key", "", true, true, false},
+		{http.MethodPut, "/bucket/key", "", true, true, false},
+		{http.MethodDelete, "/bucket/key", "", true, true, false},
+		{http.MethodPut, "/bucket/key", "/bucket/other", false, true, false},
+		{http.MethodPost, "/bucket/key", "", false, false, false},
+		{http.MethodGet, "/bucket/key?acl", "", false, false, false},
+		{http.MethodPut, "/bucket?versioning", "", false, false, false},
+		{http.MethodGet, "/bucket?prefix=a&delimiter=/&max-keys=1&encoding-type=url", "", false, false, true},
+		{http.MethodGet, "/bucket?list-type=2&continuation-token=t&fetch-owner=true", "", false, false, true},
+		{http.MethodGet, "/bucket?list-type=3", "", false, false, false},
+		{http.MethodGet, "/bucket?versions", "", false, false, false},
+	} {
+		req := httptest.NewRequest(testCase.method, "http://akubra.local"+testCase.url, nil)
+		if testCase.copySource != "" {
+			req.Header.Set("X-Amz-Copy-Source", testCase.copySource)
+		}
+		name := testCase.method + " " + testCase.url
+
+		assert.Equal(t, testCase.expectedObject, isObjectRequest(req), name)
+		assert.Equal(t, testCase.expectedBucket, isBucketRequest(req), name)
+		assert.Equal(t, testCase.expectedListing, isListingRequest(req), name)
+	}
+}
+
+func TestShouldParseListingParams(t *testing.T) {
+	for _, testCase := range []struct {
+		query          string
+		expectedParams listingParams
+		expectedStatus int
+	}{
+		{"", listingParams{maxKeys: defaultMaxKeys}, 0},
+		{"prefix=a/&delimiter=/&marker=a/b&max-keys=10",
+			listingParams{prefix: "a/", delimiter: "/", marker: "a/b", maxKeys: 10}, 0},
+		{"list-type=2&continuation-token=token&marker=ignored&encoding-type=url",
+			listingParams{listV2: true, marker: "token", encodingType: "url", maxKeys: defaultMaxKeys}, 0},
+		{"max-keys=5000", listingParams{maxKeys: defaultMaxKeys}, 0},
+		{"max-keys=0", listingParams{}, http.StatusBadRequest},
+		{"max-keys=many", listingParams{}, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket?"+testCase.query, nil)
+
+		params, errResp := parseListingParams(req)
+
+		if testCase.expectedStatus != 0 {
+			require.NotNil(t, errResp, testCase.query)
+			assert.Equal(t, testCase.expectedStatus, errResp.StatusCode, testCase.query)
+			continue
+		}
+		require.Nil(t, errResp, testCase.query)
+		assert.Equal(t, testCase.expectedParams, params, testCase.query)
+	}
+}
+
+func TestListingResponseShouldEncodeKeysIfClientAskedForIt(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://akubra.local/bucket?prefix=a%20b/&encoding-type=url", nil)
+	params, errResp := parseListingParams(req)
+	require.Nil(t, errResp)
+
+	resp, err := params.response(req, "bucket",
+		s3datatypes.ObjectInfos{{Key: "a b/c&d"}},
+		s3datatypes.CommonPrefixes{{Prefix: "a b/e f/"}}, "a b/c&d")
+
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	result := s3datatypes.ListBucketResult{}
+	require.NoError(t, xml.Unmarshal(body, &result))
+	assert.Equal(t, "a+b%2F", result.Prefix)
+	assert.Equal(t, "a+b%2Fc%26d", result.Contents[0].Key)
+	assert.Equal(t, "a+b%2Fe+f%2F", result.CommonPrefixes[0].Prefix)
+	assert.Equal(t, "a+b%2Fc%26d", result.NextMarker)
+	assert.True(t, result.IsTruncated)
+}
+
+func TestTranslatedRequestShouldTargetBackendResourceOnly(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "http://akubra.local/bucket/key?acl", nil)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=...")
+
+	backendReq := newTranslatedRequest(req, "backend:8080", "/container/key", map[string][]string{"comp": {"list"}})
+
+	assert.Equal(t, "http://backend:8080/container/key?comp=list", backendReq.URL.String())
+	assert.Equal(t, "backend:8080", backendReq.Host)
+	assert.Empty(t, backendReq.Header)
+	assert.Nil(t, backendReq.Body)
+	assert.Equal(t, "http://akubra.local/bucket/key?acl", req.URL.String())
+}
@@ -0,0 +1,301 @@
+// Package awschunked decodes, verifies and encodes aws-chunked bodies of
+// streaming V4 signed uploads (STREAMING-AWS4-HMAC-SHA256-PAYLOAD):
+//
+//	<hex size>;chunk-signature=<signature>\r\n<data>\r\n ... 0;chunk-signature=<signature>\r\n\r\n
+package awschunked
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/allegro/akubra/types"
+)
+
+const (
+	chunkSignaturePrefix = "chunk-signature="
+	// emptySHA256 is hex encoded sha256 sum of empty string
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ErrSignatureMismatch is returned by Reader when chunk signature is invalid
+var ErrSignatureMismatch = errors.New("aws-chunked chunk signature does not match")
+
+// IsStreamingUpload reports if request body is aws-chunked encoded
+func IsStreamingUpload(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-")
+}
+
+// Signer computes chained chunk signatures, chunks have to be signed in
+// order they are sent
+type Signer struct {
+	signingKey    []byte
+	amzDate       string
+	scope         string
+	prevSignature string
+}
+
+// NewSigner creates Signer of chunks following seedSignature, which is
+// signature of request headers. amzDate is X-Amz-Date of request and region
+// is region of request credential scope
+func NewSigner(secretKey, amzDate, region, seedSignature string) (*Signer, error) {
+	if len(amzDate) < len("20060102") {
+		return nil, fmt.Errorf("invalid X-Amz-Date %q", amzDate)
+	}
+	day := amzDate[:len("20060102")]
+	signingKey := sum([]byte("AWS4"+secretKey), day)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		signingKey = sum(signingKey, part)
+	}
+	return &Signer{
+		signingKey:    signingKey,
+		amzDate:       amzDate,
+		scope:         strings.Join([]string{day, region, "s3", "aws4_request"}, "/"),
+		prevSignature: seedSignature,
+	}, nil
+}
+
+// Next returns signature of chunk with given sha256 sum
+func (s *Signer) Next(chunkSum []byte) string {
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-PAYLOAD", s.amzDate, s.scope, s.prevSignature, emptySHA256, fmt.Sprintf("%x", chunkSum),
+	}, "\n")
+	s.prevSignature = fmt.Sprintf("%x", sum(s.signingKey, stringToSign))
+	return s.prevSignature
+}
+
+func sum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+type verifierKey struct{}
+
+// WithVerifier attaches Signer of client chunks to context of request which
+// seed signature was verified, so decorators rewriting body may verify chunks
+func WithVerifier(ctx context.Context, verifier *Signer) context.Context {
+	return context.WithValue(ctx, verifierKey{}, verifier)
+}
+
+// VerifierOf returns copy of Signer set by WithVerifier, nil if there is none
+func VerifierOf(ctx context.Context) *Signer {
+	verifier, ok := ctx.Value(verifierKey{}).(*Signer)
+	if !ok {
+		return nil
+	}
+	fresh := *verifier
+	return &fresh
+}
+
+// Reader reads data of aws-chunked encoded body, chunk signatures are
+// verified if verifier is set
+type Reader struct {
+	reader    *bufio.Reader
+	verifier  *Signer
+	remaining int64
+	done      bool
+	signature string
+	hash      hash.Hash
+	err       error
+	// mx guards err, which may be checked while body is still read
+	mx sync.Mutex
+}
+
+// NewReader creates Reader of aws-chunked body, signatures are dropped without
+// verification if verifier is nil
+func NewReader(r io.Reader, verifier *Signer) *Reader {
+	return &Reader{reader: bufio.NewReader(r), verifier: verifier, hash: sha256.New()}
+}
+
+// Read implements io.Reader interface
+func (r *Reader) Read(p []byte) (int, error) {
+	if err := r.Err(); err != nil {
+		return 0, err
+	}
+	for r.remaining == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.nextChunk(); err != nil {
+			return 0, r.fail(err)
+		}
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	_, _ = r.hash.Write(p[:n])
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && r.remaining == 0 {
+		err = r.verify()
+	}
+	if err != nil {
+		return n, r.fail(err)
+	}
+	return n, nil
+}
+
+// Err returns error which stopped reading, ErrSignatureMismatch if chunk
+// signature was invalid
+func (r *Reader) Err() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.err
+}
+
+func (r *Reader) fail(err error) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.err = err
+	return err
+}
+
+// nextChunk reads chunk header skipping line break ending previous chunk
+func (r *Reader) nextChunk() error {
+	header := ""
+	for header == "" {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		header = strings.TrimSpace(line)
+	}
+	parts := strings.SplitN(header, ";", 2)
+	size, err := strconv.ParseInt(parts[0], 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid aws-chunked chunk header %q", header)
+	}
+	r.signature = ""
+	if len(parts) > 1 {
+		r.signature = strings.TrimPrefix(strings.TrimSpace(parts[1]), chunkSignaturePrefix)
+	}
+	r.hash.Reset()
+	r.remaining = size
+	r.done = size == 0
+	if r.done {
+		return r.verify()
+	}
+	return nil
+}
+
+func (r *Reader) verify() error {
+	if r.verifier == nil {
+		return nil
+	}
+	expected := r.verifier.Next(r.hash.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.signature)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// Encoder encodes data of source to aws-chunked body signed by signer
+type Encoder struct {
+	source  io.Reader
+	signer  *Signer
+	chunk   []byte
+	pending bytes.Buffer
+	done    bool
+}
+
+// NewEncoder creates Encoder splitting source to chunks of chunkSize
+func NewEncoder(source io.Reader, signer *Signer, chunkSize int) *Encoder {
+	return &Encoder{source: source, signer: signer, chunk: make([]byte, chunkSize)}
+}
+
+// Read implements io.Reader interface
+func (e *Encoder) Read(p []byte) (int, error) {
+	for e.pending.Len() == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.encodeChunk(); err != nil {
+			return 0, err
+		}
+	}
+	return e.pending.Read(p)
+}
+
+func (e *Encoder) encodeChunk() error {
+	n, err := io.ReadFull(e.source, e.chunk)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	data := e.chunk[:n]
+	chunkSum := sha256.Sum256(data)
+	e.pending.Reset()
+	fmt.Fprintf(&e.pending, "%x;%s%s\r\n", n, chunkSignaturePrefix, e.signer.Next(chunkSum[:]))
+	_, _ = e.pending.Write(data)
+	_, _ = e.pending.WriteString("\r\n")
+	e.done = n == 0
+	return nil
+}
+
+// EncodedLength returns length of aws-chunked body of data with given length
+// split to chunks of chunkSize
+func EncodedLength(decodedLength int64, chunkSize int) int64 {
+	size := int64(chunkSize)
+	length := (decodedLength/size)*chunkLength(size) + chunkLength(0)
+	if rest := decodedLength % size; rest > 0 {
+		length += chunkLength(rest)
+	}
+	return length
+}
+
+func chunkLength(size int64) int64 {
+	header := len(strconv.FormatInt(size, 16)) + len(";"+chunkSignaturePrefix) + sha256.Size*2 + len("\r\n")
+	return int64(header) + size + int64(len("\r\n"))
+}
+
+// Decode returns copy of request with plain body, signatures are verified if
+// verifier is set. Returned Reader reports errors of decoding
+func Decode(req *http.Request, verifier *Signer) (*http.Request, *Reader) {
+	decoded := req.WithContext(req.Context())
+	decoded.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		decoded.Header[name] = values
+	}
+	if resetter, ok := req.Body.(types.Resetter); ok {
+		decoded.Body = resetter.Reset()
+	}
+	var reader *Reader
+	if decoded.Body != nil {
+		reader = NewReader(decoded.Body, verifier)
+		decoded.Body = struct {
+			io.Reader
+			io.Closer
+		}{reader, decoded.Body}
+	}
+	decoded.ContentLength = -1
+	if length, err := strconv.ParseInt(req.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64); err == nil {
+		decoded.ContentLength = length
+		decoded.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	encodings := make([]string, 0)
+	for _, encoding := range strings.Split(req.Header.Get("Content-Encoding"), ",") {
+		if encoding = strings.TrimSpace(encoding); encoding != "" && encoding != "aws-chunked" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	decoded.Header.Del("Content-Encoding")
+	if len(encodings) > 0 {
+		decoded.Header.Set("Content-Encoding", strings.Join(encodings, ","))
+	}
+	decoded.Header.Del("X-Amz-Decoded-Content-Length")
+	decoded.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	return decoded, reader
+}
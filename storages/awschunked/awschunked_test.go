@@ -0,0 +1,94 @@
+package awschunked
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Example of streaming upload from AWS Signature Version 4 documentation
+const (
+	exampleSecret        = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	exampleDate          = "20130524T000000Z"
+	exampleRegion        = "us-east-1"
+	exampleSeedSignature = "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9"
+)
+
+func exampleSigner(t *testing.T) *Signer {
+	signer, err := NewSigner(exampleSecret, exampleDate, exampleRegion, exampleSeedSignature)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestSignerShouldChainChunkSignatures(t *testing.T) {
+	signer := exampleSigner(t)
+	for _, chunk := range []struct {
+		data      []byte
+		signature string
+	}{
+		{bytes.Repeat([]byte("a"), 65536), "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+		{bytes.Repeat([]byte("a"), 1024), "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+		{nil, "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"},
+	} {
+		chunkSum := sha256.Sum256(chunk.data)
+		assert.Equal(t, chunk.signature, signer.Next(chunkSum[:]))
+	}
+}
+
+func TestEncodedBodyShouldBeDecodedWithVerifiedSignatures(t *testing.T) {
+	data := strings.Repeat("a", 66560)
+	encoded, err := ioutil.ReadAll(NewEncoder(strings.NewReader(data), exampleSigner(t), 65536))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(encoded)), EncodedLength(int64(len(data)), 65536))
+
+	decoded, err := ioutil.ReadAll(NewReader(bytes.NewReader(encoded), exampleSigner(t)))
+
+	require.NoError(t, err)
+	assert.Equal(t, data, string(decoded))
+}
+
+func TestReaderShouldRejectTamperedChunks(t *testing.T) {
+	encoded, err := ioutil.ReadAll(NewEncoder(strings.NewReader("hello world"), exampleSigner(t), 6))
+	require.NoError(t, err)
+	tampered := bytes.Replace(encoded, []byte("world"), []byte("w0rld"), 1)
+
+	reader := NewReader(bytes.NewReader(tampered), exampleSigner(t))
+	_, err = ioutil.ReadAll(reader)
+
+	assert.Equal(t, ErrSignatureMismatch, err)
+	assert.Equal(t, ErrSignatureMismatch, reader.Err())
+}
+
+func TestEncodedLengthShouldMatchEncodedBody(t *testing.T) {
+	for _, length := range []int{0, 1, 15, 16, 17, 100} {
+		encoded, err := ioutil.ReadAll(NewEncoder(strings.NewReader(strings.Repeat("a", length)), exampleSigner(t), 16))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(encoded)), EncodedLength(int64(length), 16), "length %d", length)
+	}
+}
+
+func TestDecodeShouldStripStreamingHeaders(t *testing.T) {
+	chunked := "6;chunk-signature=aa\r\nhello \r\n5;chunk-signature=bb\r\nworld\r\n0;chunk-signature=cc\r\n\r\n"
+	req, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", strings.NewReader(chunked))
+	require.NoError(t, err)
+	req.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	req.Header.Set("X-Amz-Decoded-Content-Length", "11")
+	req.Header.Set("Content-Encoding", "aws-chunked")
+
+	decoded, _ := Decode(req, nil)
+	body, err := ioutil.ReadAll(decoded.Body)
+
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+	assert.Equal(t, int64(11), decoded.ContentLength)
+	assert.Equal(t, "UNSIGNED-PAYLOAD", decoded.Header.Get("X-Amz-Content-Sha256"))
+	assert.Empty(t, decoded.Header.Get("Content-Encoding"))
+	assert.True(t, IsStreamingUpload(req))
+	assert.False(t, IsStreamingUpload(decoded))
+}
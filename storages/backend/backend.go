@@ -10,6 +10,7 @@ import (
 
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
 	"github.com/allegro/akubra/types"
 )
 
@@ -19,11 +20,35 @@ type Backend struct {
 	Endpoint    url.URL
 	Name        string
 	Maintenance bool
+	// Shadow gets copy of traffic, its responses are never returned to client
+	Shadow bool
+	// PreserveAddressingStyle restores virtual hosted style of requests
+	// rewritten to path style
+	PreserveAddressingStyle bool
+	// Capabilities lists features backend supports
+	Capabilities *Capabilities
+	// SSE manages server side encryption headers
+	SSE *config.SSE
 }
 
 // RoundTrip satisfies http.RoundTripper interface
 func (b *Backend) RoundTrip(req *http.Request) (resp *http.Response, err error) {
 	defer b.collectMetrics(resp, err, time.Now())
+	done := types.TimingsOf(req.Context()).Start(b.Name)
+	if !b.Shadow {
+		types.RoutingOf(req.Context()).AddBackend(b.Name)
+	}
+	defer func() {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		done(status, err)
+	}()
+	req = b.applySSE(req)
+	if b.PreserveAddressingStyle {
+		req = types.ToVirtualHostedStyle(req)
+	}
 	req.URL.Host = b.Endpoint.Host
 	req.URL.Scheme = b.Endpoint.Scheme
 
@@ -35,7 +60,7 @@ func (b *Backend) RoundTrip(req *http.Request) (resp *http.Response, err error)
 			OrigErr: types.ErrorBackendMaintenance}
 	}
 
-	resp, oerror := b.RoundTripper.RoundTrip(req)
+	resp, oerror := b.roundTripWithCapabilities(req)
 	log.Debugf("Response for req %s from %s%s with %q err", reqID, req.URL.Host, req.URL.Path, oerror)
 	if oerror != nil {
 		err = &types.BackendError{HostName: b.Endpoint.Host, OrigErr: oerror}
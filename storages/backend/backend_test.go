@@ -1,9 +1,12 @@
 package backend
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -72,3 +75,162 @@ func TestBackendShouldWrapErrorWithBackendError(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, host, berr.Backend())
 }
+
+func TestBackendShouldRestoreVirtualHostedStyleIfConfigured(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{Request: req}, nil
+	}
+	r, err := http.NewRequest("GET", "http://bucket.s3.local/key", nil)
+	require.NoError(t, err)
+	r = types.ToPathStyle(r, types.VirtualHost{Host: r.Host, Bucket: "bucket"}, "s3.local")
+
+	pathStyle := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}}
+	resp, err := pathStyle.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, "s3.local", resp.Request.Host)
+	require.Equal(t, "/bucket/key", resp.Request.URL.Path)
+
+	preserving := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}, PreserveAddressingStyle: true}
+	resp, err = preserving.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, "bucket.s3.local", resp.Request.Host)
+	require.Equal(t, "/key", resp.Request.URL.Path)
+	require.Equal(t, "someremote.backend:8080", resp.Request.URL.Host)
+}
+
+func TestBackendShouldEmulateUnsupportedCopy(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	var put *http.Request
+	var putBody []byte
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		switch req.Method {
+		case http.MethodGet:
+			require.Equal(t, "/src bucket/key", req.URL.Path)
+			header := http.Header{"Content-Type": []string{"text/plain"}, "X-Amz-Meta-Origin": []string{"source"}}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, ContentLength: 4,
+				Body: ioutil.NopCloser(strings.NewReader("data")), Request: req}, nil
+		case http.MethodPut:
+			put = req
+			putBody, err = ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": []string{`"etag"`}},
+				Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}
+		return nil, fmt.Errorf("unexpected %s", req.Method)
+	}
+	b := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper},
+		Capabilities: NewCapabilities(map[string]bool{config.CapabilityCopy: false})}
+
+	r, err := http.NewRequest(http.MethodPut, "http://localhost:8080/dst/key", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Copy-Source", "/src%20bucket/key")
+	r.Header.Set("X-Amz-Meta-Origin", "ignored")
+	resp, err := b.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NotNil(t, put)
+	require.Equal(t, "/dst/key", put.URL.Path)
+	require.Equal(t, "data", string(putBody))
+	require.Empty(t, put.Header.Get("X-Amz-Copy-Source"))
+	require.Equal(t, "source", put.Header.Get("X-Amz-Meta-Origin"))
+	require.Equal(t, "text/plain", put.Header.Get("Content-Type"))
+	result := types.CopyObjectResult{}
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, xml.Unmarshal(body, &result))
+	require.Equal(t, `"etag"`, result.ETag)
+}
+
+func TestBackendShouldDecodeStreamingUploadIfUnsupported(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	var body []byte
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		require.Equal(t, "UNSIGNED-PAYLOAD", req.Header.Get("X-Amz-Content-Sha256"))
+		require.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+		require.Equal(t, int64(11), req.ContentLength)
+		body, err = ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	b := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper},
+		Capabilities: NewCapabilities(map[string]bool{config.CapabilityStreamingSignatures: false})}
+
+	chunked := "6;chunk-signature=aa\r\nhello \r\n5;chunk-signature=bb\r\nworld\r\n0;chunk-signature=cc\r\n\r\n"
+	r, err := http.NewRequest(http.MethodPut, "http://localhost:8080/bucket/key", strings.NewReader(chunked))
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	r.Header.Set("X-Amz-Decoded-Content-Length", "11")
+	r.Header.Set("Content-Encoding", "aws-chunked,gzip")
+	_, err = b.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(body))
+}
+
+func TestBackendShouldDisableCapabilityRejectedWithNotImplemented(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	calls := 0
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		calls++
+		return types.NewS3ErrorResponseForStatus(req, http.StatusNotImplemented), nil
+	}
+	b := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}, Capabilities: NewCapabilities()}
+
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest(http.MethodGet, "http://localhost:8080/bucket/key?versionId=1", nil)
+		require.NoError(t, err)
+		resp, err := b.RoundTrip(r)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	}
+	require.Equal(t, 1, calls)
+	require.False(t, b.Supports(config.CapabilityVersioning))
+	require.True(t, b.Supports(config.CapabilityCopy))
+}
+
+func TestBackendShouldPassNilResponseOfTransport(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	roundtripper := func(*http.Request) (*http.Response, error) {
+		return nil, nil
+	}
+	b := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}, Capabilities: NewCapabilities()}
+
+	r, err := http.NewRequest(http.MethodGet, "http://localhost:8080/bucket/key", nil)
+	require.NoError(t, err)
+	resp, err := b.RoundTrip(r)
+	require.NoError(t, err)
+	require.Nil(t, resp)
+}
+
+func TestBackendWithoutTaggingShouldDropTagsOfWritesAndRejectTaggingRequests(t *testing.T) {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	var tags []string
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		tags = append(tags, req.Header.Get("X-Amz-Tagging"))
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	capabilities := NewCapabilities(map[string]bool{config.CapabilityTagging: false})
+	b := &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}, Capabilities: capabilities}
+
+	r, err := http.NewRequest(http.MethodPut, "http://localhost:8080/bucket/key", strings.NewReader("data"))
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Tagging", "team=storage")
+	resp, err := b.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "team=storage", r.Header.Get("X-Amz-Tagging"))
+
+	r, err = http.NewRequest(http.MethodGet, "http://localhost:8080/bucket/key?tagging", nil)
+	require.NoError(t, err)
+	resp, err = b.RoundTrip(r)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	require.Equal(t, []string{""}, tags)
+}
@@ -0,0 +1,262 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/types"
+)
+
+// copySourceConditions maps CopyObject source conditions to GET conditions
+var copySourceConditions = map[string]string{
+	"X-Amz-Copy-Source-If-Match":            "If-Match",
+	"X-Amz-Copy-Source-If-None-Match":       "If-None-Match",
+	"X-Amz-Copy-Source-If-Modified-Since":   "If-Modified-Since",
+	"X-Amz-Copy-Source-If-Unmodified-Since": "If-Unmodified-Since",
+}
+
+// copiedHeaders are taken from source object if metadata directive is COPY
+var copiedHeaders = []string{
+	"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Content-Type",
+}
+
+// Capabilities holds features supported by backend. Features are supported
+// unless declared otherwise or detected as unsupported with NotImplemented
+// backend response
+type Capabilities struct {
+	mx          sync.RWMutex
+	unsupported map[string]bool
+}
+
+// NewCapabilities creates Capabilities from declarations, later declarations
+// override former ones
+func NewCapabilities(declarations ...map[string]bool) *Capabilities {
+	capabilities := &Capabilities{unsupported: make(map[string]bool)}
+	for _, declaration := range declarations {
+		for capability, supported := range declaration {
+			capabilities.unsupported[capability] = !supported
+		}
+	}
+	return capabilities
+}
+
+// Supports reports if capability is supported
+func (c *Capabilities) Supports(capability string) bool {
+	if c == nil {
+		return true
+	}
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return !c.unsupported[capability]
+}
+
+// Disable marks capability as unsupported, it reports if it was supported before
+func (c *Capabilities) Disable(capability string) bool {
+	if c == nil {
+		return false
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.unsupported[capability] {
+		return false
+	}
+	c.unsupported[capability] = true
+	return true
+}
+
+// Supports reports if backend supports capability
+func (b *Backend) Supports(capability string) bool {
+	return b.Capabilities.Supports(capability)
+}
+
+// roundTripWithCapabilities adapts request to backend capabilities. Chunk
+// signed uploads are decoded, CopyObject is emulated with GET and PUT and
+// tags of writes are dropped, other requests needing unsupported capability
+// are answered with NotImplemented without contacting backend
+func (b *Backend) roundTripWithCapabilities(req *http.Request) (*http.Response, error) {
+	if awschunked.IsStreamingUpload(req) && !b.Supports(config.CapabilityStreamingSignatures) {
+		// Chunk signatures are dropped, backends sign requests on their own
+		req, _ = awschunked.Decode(req, nil)
+	}
+	if req.Header.Get("X-Amz-Tagging") != "" && !b.Supports(config.CapabilityTagging) {
+		// Tags of written object are dropped, object itself is stored
+		req = withHeaderCopy(req)
+		req.Header.Del("X-Amz-Tagging")
+	}
+	capability := requiredCapability(req)
+	if capability == config.CapabilityCopy && !b.Supports(capability) {
+		return b.emulateCopy(req)
+	}
+	if capability != "" && !b.Supports(capability) {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			fmt.Sprintf("%s is not supported by storage.", capability)), nil
+	}
+	resp, err := b.RoundTripper.RoundTrip(req)
+	if err != nil || resp == nil || resp.StatusCode != http.StatusNotImplemented {
+		return resp, err
+	}
+	if awschunked.IsStreamingUpload(req) {
+		capability = config.CapabilityStreamingSignatures
+	}
+	if capability == "" || !b.Capabilities.Disable(capability) {
+		return resp, err
+	}
+	log.Printf("Backend %s responded NotImplemented to %s %s, %s capability disabled",
+		b.Name, req.Method, req.URL.Path, capability)
+	metrics.Mark(fmt.Sprintf("reqs.backend.%s.unsupported.%s", b.Name, capability))
+	if capability == config.CapabilityCopy {
+		discardBody(resp)
+		return b.emulateCopy(req)
+	}
+	return resp, err
+}
+
+// emulateCopy copies object with GET of source and PUT of its body
+func (b *Backend) emulateCopy(req *http.Request) (*http.Response, error) {
+	metrics.Mark(fmt.Sprintf("reqs.backend.%s.emulated.copy", b.Name))
+	source := strings.SplitN(req.Header.Get("X-Amz-Copy-Source"), "?", 2)
+	if len(source) > 1 {
+		return types.NewS3ErrorResponse(req, http.StatusNotImplemented, types.S3ErrNotImplemented,
+			"Copying object versions is not supported by storage."), nil
+	}
+	sourcePath, err := url.PathUnescape(source[0])
+	if err != nil {
+		return types.NewS3ErrorResponse(req, http.StatusBadRequest, types.S3ErrInvalidArgument,
+			"Invalid copy source encoding."), nil
+	}
+	getURL := *req.URL
+	getURL.Path = "/" + strings.TrimPrefix(sourcePath, "/")
+	getURL.RawPath = ""
+	getURL.RawQuery = ""
+	getReq, err := http.NewRequest(http.MethodGet, getURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	getReq = getReq.WithContext(req.Context())
+	getReq.Host = req.Host
+	for copyCondition, condition := range copySourceConditions {
+		if value := req.Header.Get(copyCondition); value != "" {
+			getReq.Header.Set(condition, value)
+		}
+	}
+	getResp, err := b.RoundTripper.RoundTrip(getReq)
+	if err != nil {
+		return nil, err
+	}
+	if getResp.StatusCode == http.StatusNotModified {
+		discardBody(getResp)
+		return types.NewS3ErrorResponse(req, http.StatusPreconditionFailed, types.S3ErrPreconditionFailed,
+			"At least one of the pre-conditions you specified did not hold."), nil
+	}
+	if getResp.StatusCode != http.StatusOK {
+		getResp.Request = req
+		return getResp, nil
+	}
+	defer discardBody(getResp)
+
+	putReq := req.WithContext(req.Context())
+	putReq.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		if !strings.HasPrefix(name, "X-Amz-Copy-Source") {
+			putReq.Header[name] = values
+		}
+	}
+	if req.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+		for name := range putReq.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				putReq.Header.Del(name)
+			}
+		}
+		for name, values := range getResp.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				putReq.Header[name] = values
+			}
+		}
+		for _, name := range copiedHeaders {
+			putReq.Header.Del(name)
+			if values, ok := getResp.Header[name]; ok {
+				putReq.Header[name] = values
+			}
+		}
+	}
+	putReq.Header.Del("X-Amz-Metadata-Directive")
+	putReq.Header.Del("Content-Md5")
+	putReq.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	putReq.Header.Set("Content-Length", strconv.FormatInt(getResp.ContentLength, 10))
+	putReq.Body = getResp.Body
+	putReq.ContentLength = getResp.ContentLength
+	putResp, err := b.RoundTripper.RoundTrip(putReq)
+	if err != nil {
+		return nil, err
+	}
+	if !IsSuccessful(putResp, nil) {
+		putResp.Request = req
+		return putResp, nil
+	}
+	discardBody(putResp)
+	body, err := xml.Marshal(types.CopyObjectResult{
+		LastModified: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		ETag:         putResp.Header.Get("ETag"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	body = append([]byte(xml.Header), body...)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// requiredCapability returns capability request depends on, if any
+func requiredCapability(req *http.Request) string {
+	query := req.URL.Query()
+	switch {
+	case isSSECustomerKeyRequest(req):
+		return config.CapabilitySSECustomerKey
+	case query.Get("uploadId") != "" || query["uploads"] != nil:
+		return config.CapabilityMultipart
+	case query["versionId"] != nil || query["versions"] != nil || query["versioning"] != nil:
+		return config.CapabilityVersioning
+	case query["tagging"] != nil:
+		return config.CapabilityTagging
+	case req.Method == http.MethodPut && req.Header.Get("X-Amz-Copy-Source") != "":
+		return config.CapabilityCopy
+	}
+	return ""
+}
+
+func discardBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		log.Debugf("Could not discard response body: %s", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Could not close response body: %s", err)
+	}
+}
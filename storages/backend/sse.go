@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+)
+
+const (
+	sseHeader                            = "X-Amz-Server-Side-Encryption"
+	sseKMSKeyIDHeader                    = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	sseCustomerHeadersPrefix             = "X-Amz-Server-Side-Encryption-Customer-"
+	sseCopySourceCustomerAlgorithmHeader = "X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm"
+)
+
+// isSSECustomerKeyRequest reports if request carries customer provided key
+// of object or of copy source
+func isSSECustomerKeyRequest(req *http.Request) bool {
+	return req.Header.Get(sseCustomerHeadersPrefix+"Algorithm") != "" || req.Header.Get(sseCopySourceCustomerAlgorithmHeader) != ""
+}
+
+// applySSE injects or strips server side encryption headers according to
+// backend SSE policy. Headers are shared by requests replicated to all
+// backends of shard, so they're copied before change
+func (b *Backend) applySSE(req *http.Request) *http.Request {
+	if b.SSE == nil {
+		return req
+	}
+	if b.SSE.Strip {
+		return b.stripSSE(req)
+	}
+	if b.SSE.Inject == "" || !createsObject(req) || req.Header.Get(sseHeader) != "" || isSSECustomerKeyRequest(req) {
+		return req
+	}
+	metrics.Mark("reqs.backend." + b.Name + ".sse.injected")
+	req = withHeaderCopy(req)
+	req.Header.Set(sseHeader, b.SSE.Inject)
+	if b.SSE.Inject == config.SSEKMS && b.SSE.KMSKeyID != "" {
+		req.Header.Set(sseKMSKeyIDHeader, b.SSE.KMSKeyID)
+	}
+	return req
+}
+
+// stripSSE removes SSE-S3 and SSE-KMS headers, SSE-C headers are kept
+func (b *Backend) stripSSE(req *http.Request) *http.Request {
+	stripped := false
+	for name := range req.Header {
+		if !strings.HasPrefix(name, sseHeader) || strings.HasPrefix(name, sseCustomerHeadersPrefix) {
+			continue
+		}
+		if !stripped {
+			req = withHeaderCopy(req)
+			stripped = true
+		}
+		req.Header.Del(name)
+	}
+	if stripped {
+		metrics.Mark("reqs.backend." + b.Name + ".sse.stripped")
+	}
+	return req
+}
+
+// createsObject reports if request creates object: upload, copy or multipart
+// upload initiation. Parts inherit encryption of multipart upload
+func createsObject(req *http.Request) bool {
+	if strings.Count(strings.Trim(req.URL.Path, "/"), "/") == 0 {
+		return false
+	}
+	query := req.URL.Query()
+	switch req.Method {
+	case http.MethodPut:
+		return len(query) == 0
+	case http.MethodPost:
+		_, uploads := query["uploads"]
+		return uploads
+	}
+	return false
+}
+
+func withHeaderCopy(req *http.Request) *http.Request {
+	copied := req.WithContext(req.Context())
+	copied.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		copied.Header[name] = append([]string(nil), values...)
+	}
+	return copied
+}
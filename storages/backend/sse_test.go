@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/stretchr/testify/require"
+)
+
+func sseBackend(t *testing.T, sse *config.SSE, capabilities *Capabilities, sent *[]*http.Request) *Backend {
+	netURL, err := url.Parse("http://someremote.backend:8080")
+	require.NoError(t, err)
+	roundtripper := func(req *http.Request) (*http.Response, error) {
+		*sent = append(*sent, req)
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	return &Backend{Endpoint: *netURL, RoundTripper: &testRt{rt: roundtripper}, SSE: sse, Capabilities: capabilities}
+}
+
+func TestBackendShouldInjectSSEHeadersToObjectCreation(t *testing.T) {
+	var sent []*http.Request
+	b := sseBackend(t, &config.SSE{Inject: config.SSEKMS, KMSKeyID: "key-1"}, NewCapabilities(), &sent)
+
+	for _, request := range []struct{ method, url string }{
+		{http.MethodPut, "http://localhost/bucket/key"},
+		{http.MethodPost, "http://localhost/bucket/key?uploads"},
+		{http.MethodPut, "http://localhost/bucket/key?partNumber=1&uploadId=1"},
+		{http.MethodPut, "http://localhost/bucket"},
+		{http.MethodGet, "http://localhost/bucket/key"},
+	} {
+		r, err := http.NewRequest(request.method, request.url, nil)
+		require.NoError(t, err)
+		_, err = b.RoundTrip(r)
+		require.NoError(t, err)
+		require.Empty(t, r.Header.Get(sseHeader), "client request should not change")
+	}
+
+	require.Len(t, sent, 5)
+	for i, expected := range []string{config.SSEKMS, config.SSEKMS, "", "", ""} {
+		require.Equal(t, expected, sent[i].Header.Get(sseHeader), sent[i].URL.String())
+	}
+	require.Equal(t, "key-1", sent[0].Header.Get(sseKMSKeyIDHeader))
+}
+
+func TestBackendShouldKeepSSEDeclaredByClient(t *testing.T) {
+	var sent []*http.Request
+	b := sseBackend(t, &config.SSE{Inject: config.SSEAES256}, NewCapabilities(), &sent)
+	r, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+
+	_, err = b.RoundTrip(r)
+
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	require.Empty(t, sent[0].Header.Get(sseHeader))
+}
+
+func TestBackendShouldStripSSEHeadersExceptCustomerKey(t *testing.T) {
+	var sent []*http.Request
+	b := sseBackend(t, &config.SSE{Strip: true}, NewCapabilities(), &sent)
+	r, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+	r.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", "key-1")
+	r.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key", "c2VjcmV0")
+
+	_, err = b.RoundTrip(r)
+
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	require.Empty(t, sent[0].Header.Get(sseHeader))
+	require.Empty(t, sent[0].Header.Get(sseKMSKeyIDHeader))
+	require.Equal(t, "c2VjcmV0", sent[0].Header.Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+	require.Equal(t, "aws:kms", r.Header.Get(sseHeader), "client request should not change")
+}
+
+func TestBackendShouldNotSendCustomerKeyToIncapableBackend(t *testing.T) {
+	var sent []*http.Request
+	b := sseBackend(t, nil, NewCapabilities(map[string]bool{config.CapabilitySSECustomerKey: false}), &sent)
+	r, err := http.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	r.Header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+	r.Header.Set("X-Amz-Server-Side-Encryption-Customer-Key", "c2VjcmV0")
+
+	resp, err := b.RoundTrip(r)
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	require.Empty(t, sent)
+}
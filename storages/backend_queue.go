@@ -0,0 +1,118 @@
+package storages
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+)
+
+// ErrBackendQueueFull is returned if backend has no free worker and its
+// queue is full, it counts as backend failure, so balancer breaker of
+// saturated backend opens and writes are fixed by synclog
+var ErrBackendQueueFull = errors.New("backend queue is full")
+
+// backendQueue bounds requests sent to single backend at once, so slow
+// backend holds only requests of its own queue
+type backendQueue struct {
+	roundTripper  http.RoundTripper
+	workers       chan struct{}
+	queued        int64
+	size          int64
+	timeout       time.Duration
+	metricsPrefix string
+}
+
+func newBackendQueue(name string, roundTripper http.RoundTripper, conf *config.Queue) http.RoundTripper {
+	if conf == nil {
+		return roundTripper
+	}
+	return &backendQueue{
+		roundTripper:  roundTripper,
+		workers:       make(chan struct{}, conf.Workers),
+		size:          int64(conf.Size),
+		timeout:       conf.Timeout.Duration,
+		metricsPrefix: "reqs.backend." + metrics.Clean(name) + ".queue",
+	}
+}
+
+// RoundTrip implements http.RoundTripper interface, worker is held until
+// response body is closed
+func (bq *backendQueue) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := bq.acquire(req); err != nil {
+		return nil, err
+	}
+	resp, err := bq.roundTripper.RoundTrip(req)
+	if err != nil || resp == nil || resp.Body == nil {
+		bq.release()
+		return resp, err
+	}
+	resp.Body = &workerBody{ReadCloser: resp.Body, release: bq.release}
+	return resp, err
+}
+
+func (bq *backendQueue) acquire(req *http.Request) error {
+	select {
+	case bq.workers <- struct{}{}:
+		bq.updateBusy()
+		return nil
+	default:
+	}
+	queued := atomic.AddInt64(&bq.queued, 1)
+	defer func() {
+		metrics.UpdateGauge(bq.metricsPrefix+".queued", atomic.AddInt64(&bq.queued, -1))
+	}()
+	if queued > bq.size {
+		metrics.Mark(bq.metricsPrefix + ".rejected")
+		log.Debugf("Request %s rejected, queue of %s is full", req.Context().Value(log.ContextreqIDKey), req.URL.Host)
+		return ErrBackendQueueFull
+	}
+	metrics.UpdateGauge(bq.metricsPrefix+".queued", queued)
+	start := time.Now()
+	defer metrics.UpdateSince(bq.metricsPrefix+".wait", start)
+
+	var timeout <-chan time.Time
+	if bq.timeout > 0 {
+		timer := time.NewTimer(bq.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case bq.workers <- struct{}{}:
+		bq.updateBusy()
+		return nil
+	case <-timeout:
+		metrics.Mark(bq.metricsPrefix + ".rejected")
+		return ErrBackendQueueFull
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (bq *backendQueue) release() {
+	<-bq.workers
+	bq.updateBusy()
+}
+
+func (bq *backendQueue) updateBusy() {
+	metrics.UpdateGauge(bq.metricsPrefix+".busy", int64(len(bq.workers)))
+}
+
+// workerBody frees backend worker when response body is closed
+type workerBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (wb *workerBody) Close() error {
+	err := wb.ReadCloser.Close()
+	wb.once.Do(wb.release)
+	return err
+}
@@ -0,0 +1,78 @@
+package storages
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func okResponse(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok")), Request: req}, nil
+}
+
+func TestBackendQueueShouldRejectRequestsOverWorkersAndQueueSize(t *testing.T) {
+	queue := newBackendQueue("slow", &testRt{rt: okResponse}, &config.Queue{Workers: 1, Size: 1})
+
+	first, err := queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/first", nil))
+	require.NoError(t, err)
+
+	queued := make(chan error)
+	go func() {
+		resp, err := queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/queued", nil))
+		if err == nil {
+			err = resp.Body.Close()
+		}
+		queued <- err
+	}()
+	require.True(t, waitForQueued(queue.(*backendQueue), 1))
+
+	_, err = queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/rejected", nil))
+	assert.Equal(t, ErrBackendQueueFull, err)
+
+	require.NoError(t, first.Body.Close())
+	assert.NoError(t, <-queued)
+}
+
+func TestBackendQueueShouldRejectRequestAfterTimeout(t *testing.T) {
+	queue := newBackendQueue("slow", &testRt{rt: okResponse}, &config.Queue{Workers: 1, Size: 1, Timeout: metrics.Interval{Duration: 10 * time.Millisecond}})
+	first, err := queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/first", nil))
+	require.NoError(t, err)
+	defer first.Body.Close()
+
+	_, err = queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/second", nil))
+
+	assert.Equal(t, ErrBackendQueueFull, err)
+}
+
+func TestBackendQueueShouldStopWaitingForCanceledRequest(t *testing.T) {
+	queue := newBackendQueue("slow", &testRt{rt: okResponse}, &config.Queue{Workers: 1, Size: 1})
+	first, err := queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/first", nil))
+	require.NoError(t, err)
+	defer first.Body.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = queue.RoundTrip(httptest.NewRequest(http.MethodGet, "http://slow/bucket/second", nil).WithContext(ctx))
+
+	assert.Equal(t, context.Canceled, err)
+}
+
+func waitForQueued(queue *backendQueue, queued int64) bool {
+	for i := 0; i < 100; i++ {
+		if atomic.LoadInt64(&queue.queued) == queued {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package storages
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/transport"
+)
+
+// backendConfigurableTransport is implemented by transports which can be
+// derived with backend specific settings
+type backendConfigurableTransport interface {
+	ForBackend(transport.BackendOptions) (http.RoundTripper, error)
+}
+
+func newBackendTLSConfig(conf config.TLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.RootCAFile != "" {
+		caPEM, err := ioutil.ReadFile(conf.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read RootCAFile: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in RootCAFile %q", conf.RootCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+func backendTransport(roundTripper http.RoundTripper, name string, storageDef config.Storage) (http.RoundTripper, error) {
+	configurable, ok := roundTripper.(backendConfigurableTransport)
+	if !ok {
+		if storageDef.TLS != nil || storageDef.HTTP2 != "" || storageDef.Transport != nil {
+			return nil, fmt.Errorf("transport %T doesn't support backend specific settings", roundTripper)
+		}
+		return roundTripper, nil
+	}
+	options := transport.BackendOptions{Name: name, HTTP2: storageDef.HTTP2, Properties: storageDef.Transport}
+	if storageDef.TLS != nil {
+		tlsConfig, err := newBackendTLSConfig(*storageDef.TLS)
+		if err != nil {
+			return nil, err
+		}
+		options.TLSConfig = tlsConfig
+	}
+	return configurable.ForBackend(options)
+}
@@ -0,0 +1,78 @@
+package storages
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type backendTransportMock struct {
+	http.RoundTripper
+	options transport.BackendOptions
+}
+
+func (btm *backendTransportMock) ForBackend(options transport.BackendOptions) (http.RoundTripper, error) {
+	return &backendTransportMock{options: options}, nil
+}
+
+func TestBackendTransportShouldKeepNotConfigurableTransportWithoutBackendSettings(t *testing.T) {
+	result, err := backendTransport(http.DefaultTransport, "default", config.Storage{})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.DefaultTransport, result)
+}
+
+func TestBackendTransportShouldFailIfTransportIsNotConfigurable(t *testing.T) {
+	_, err := backendTransport(http.DefaultTransport, "default", config.Storage{TLS: &config.TLS{}})
+	assert.Error(t, err)
+
+	_, err = backendTransport(http.DefaultTransport, "default", config.Storage{HTTP2: "h2c"})
+	assert.Error(t, err)
+}
+
+func TestBackendTransportShouldPassBackendOptions(t *testing.T) {
+	result, err := backendTransport(&backendTransportMock{}, "default", config.Storage{HTTP2: "h2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, transport.BackendOptions{Name: "default", HTTP2: "h2"}, result.(*backendTransportMock).options)
+}
+
+func TestBackendTransportShouldApplyTLSSettings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile, err := ioutil.TempFile("", "akubra-ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	require.NoError(t, pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	require.NoError(t, caFile.Close())
+
+	result, err := backendTransport(&backendTransportMock{}, "default", config.Storage{TLS: &config.TLS{
+		RootCAFile: caFile.Name(),
+		ServerName: "example.com",
+	}})
+	require.NoError(t, err)
+
+	tlsConfig := result.(*backendTransportMock).options.TLSConfig
+	assert.Equal(t, "example.com", tlsConfig.ServerName)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestNewBackendTLSConfigShouldFailOnMissingFiles(t *testing.T) {
+	_, err := newBackendTLSConfig(config.TLS{RootCAFile: "/nonexistent/ca.pem"})
+	assert.Error(t, err)
+
+	_, err = newBackendTLSConfig(config.TLS{CertFile: "/nonexistent/cert.pem", KeyFile: "/nonexistent/key.pem"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package storages
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+)
+
+// conditionalHeaders are headers making read result depend on object state
+var conditionalHeaders = []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// isConditionalRead reports if GET or HEAD request has preconditions
+func isConditionalRead(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	for _, header := range conditionalHeaders {
+		if req.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerRoundTrip reads from shard owner, the first storage of shard.
+// Replicas may differ until replication completes, so conditions evaluated by
+// replica which answered first would give random results. Next storages are
+// asked in order only if owner is in maintenance, fails or doesn't have the
+// object
+func (c *ShardClient) ownerRoundTrip(req *http.Request) (resp *http.Response, err error) {
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	for i, storage := range c.backends {
+		if storage.Maintenance {
+			continue
+		}
+		if resp != nil {
+			discardResponse(resp)
+		}
+		if i > 0 {
+			metrics.Mark("reqs.conditional.owner_fallback")
+			log.Debugf("Conditional request %s falls back to %s", reqID, storage.Name)
+		}
+		resp, err = storage.RoundTrip(attemptRequest(req))
+		if err == nil && resp != nil && resp.StatusCode != http.StatusNotFound && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+	}
+	if resp == nil && err == nil {
+		return nil, fmt.Errorf("no available storage for conditional request %s", reqID)
+	}
+	return resp, err
+}
+
+func discardResponse(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Could not close response body: %s", err)
+	}
+}
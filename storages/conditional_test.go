@@ -0,0 +1,77 @@
+package storages
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replicaWithETag evaluates If-Match and If-None-Match against object etag,
+// empty etag means replica has no object yet
+func replicaWithETag(etag string, calls *int) *StorageClient {
+	return createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		status := http.StatusOK
+		switch {
+		case etag == "":
+			status = http.StatusNotFound
+		case req.Header.Get("If-Match") != "" && req.Header.Get("If-Match") != etag:
+			status = http.StatusPreconditionFailed
+		case req.Header.Get("If-None-Match") == etag:
+			status = http.StatusNotModified
+		}
+		return &http.Response{Request: req, StatusCode: status, Header: http.Header{"Etag": []string{etag}}}, nil
+	})
+}
+
+func conditionalRequest(t *testing.T, header, etag string) *http.Request {
+	req, err := makeGetObjectRequest()
+	require.NoError(t, err)
+	req.Header.Set(header, etag)
+	return req
+}
+
+func TestConditionalReadsShouldBeEvaluatedByShardOwner(t *testing.T) {
+	ownerCalls, replicaCalls := 0, 0
+	shard := &ShardClient{backends: []*StorageClient{replicaWithETag(`"new"`, &ownerCalls), replicaWithETag(`"old"`, &replicaCalls)}}
+
+	for _, testCase := range []struct {
+		header, etag   string
+		expectedStatus int
+	}{
+		{"If-None-Match", `"new"`, http.StatusNotModified},
+		{"If-None-Match", `"old"`, http.StatusOK},
+		{"If-Match", `"new"`, http.StatusOK},
+		{"If-Match", `"old"`, http.StatusPreconditionFailed},
+	} {
+		for i := 0; i < 3; i++ {
+			resp, err := shard.RoundTrip(conditionalRequest(t, testCase.header, testCase.etag))
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedStatus, resp.StatusCode, testCase.header+" "+testCase.etag)
+		}
+	}
+	assert.Equal(t, 0, replicaCalls)
+}
+
+func TestConditionalReadsShouldFallBackInShardOrder(t *testing.T) {
+	for name, owner := range map[string]*StorageClient{
+		"owner without object": replicaWithETag("", new(int)),
+		"failing owner": createDummyBackend(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{Request: req, StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		"owner in maintenance": &StorageClient{Maintenance: true},
+	} {
+		secondCalls, thirdCalls := 0, 0
+		shard := &ShardClient{backends: []*StorageClient{owner, replicaWithETag(`"old"`, &secondCalls), replicaWithETag(`"new"`, &thirdCalls)}}
+
+		resp, err := shard.RoundTrip(conditionalRequest(t, "If-None-Match", `"old"`))
+
+		require.NoError(t, err, name)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode, name)
+		assert.Equal(t, 1, secondCalls, name)
+		assert.Equal(t, 0, thirdCalls, name)
+	}
+}
@@ -2,24 +2,182 @@ package config
 
 import (
 	"github.com/allegro/akubra/metrics"
+	transportconfig "github.com/allegro/akubra/transport/config"
 	"github.com/allegro/akubra/types"
 )
 
 const (
 	// S3 represents s3 compiliant storages
 	S3 string = "S3"
-	// GCS represents Google Cloud Storage compiliant storages
-	GCS = "GCS"
+	// GCS represents Google Cloud Storage accessed with XML API
+	GCS = "gcs"
+	// Azure represents Azure Blob Storage accessed through S3 translation
+	Azure = "azure"
+	// Swift represents OpenStack Swift accessed through S3 translation
+	Swift = "swift"
+	// FS represents objects stored in local directory
+	FS = "fs"
 	// Passthrough does not re-sign requests
 	Passthrough = "passthrough"
 )
 
+const (
+	// PathStyle sends requests to backend with bucket in path
+	PathStyle = "path"
+	// PreserveStyle sends requests to backend addressed the same way as client did
+	PreserveStyle = "preserve"
+)
+
+const (
+	// SpoolBody buffers request body, so it can be replayed for each backend
+	SpoolBody = "spool"
+	// StreamBody sends request body to all backends simultaneously without buffering
+	StreamBody = "stream"
+)
+
+const (
+	// SingleBackend sends request to one storage of shard, chosen by read
+	// preference
+	SingleBackend = "single"
+	// ReplicateRequest sends request to all storages of shard
+	ReplicateRequest = "replicate"
+	// AggregateResponses sends request to all storages of shard and merges
+	// their responses
+	AggregateResponses = "aggregate"
+	// ListMethod denotes bucket listing (GET on bucket) in MethodPolicies
+	ListMethod = "LIST"
+)
+
+// AllowedMethodPolicies lists routing policies which may be declared for
+// each method in Shard MethodPolicies
+var AllowedMethodPolicies = map[string][]string{
+	"GET":      {SingleBackend, ReplicateRequest},
+	"HEAD":     {SingleBackend, ReplicateRequest},
+	"OPTIONS":  {SingleBackend, ReplicateRequest},
+	ListMethod: {SingleBackend, AggregateResponses},
+	"PUT":      {ReplicateRequest},
+	"POST":     {ReplicateRequest},
+	"DELETE":   {ReplicateRequest},
+}
+
+// Backend capabilities which may be declared in Storage Capabilities
+const (
+	// CapabilityVersioning is support of object versions
+	CapabilityVersioning = "Versioning"
+	// CapabilityStreamingSignatures is support of chunk signed uploads
+	// (STREAMING-AWS4-HMAC-SHA256-PAYLOAD)
+	CapabilityStreamingSignatures = "StreamingSignatures"
+	// CapabilityCopy is support of server side CopyObject
+	CapabilityCopy = "Copy"
+	// CapabilityMultipart is support of multipart uploads
+	CapabilityMultipart = "Multipart"
+	// CapabilitySSECustomerKey is support of encryption with customer
+	// provided keys (SSE-C), keys are never sent to backends lacking it
+	CapabilitySSECustomerKey = "SSECustomerKey"
+	// CapabilityTagging is support of object tagging, tagging subresource
+	// and X-Amz-Tagging header of writes
+	CapabilityTagging = "Tagging"
+)
+
+// KnownCapabilities lists capabilities which may be declared
+var KnownCapabilities = []string{CapabilityVersioning, CapabilityStreamingSignatures, CapabilityCopy, CapabilityMultipart, CapabilitySSECustomerKey, CapabilityTagging}
+
+// Server side encryption algorithms which may be injected
+const (
+	// SSEAES256 is encryption with keys managed by storage
+	SSEAES256 = "AES256"
+	// SSEKMS is encryption with keys managed by KMS
+	SSEKMS = "aws:kms"
+)
+
+// SSE defines server side encryption headers policy of storage
+type SSE struct {
+	// Inject sets x-amz-server-side-encryption algorithm of uploads which
+	// don't declare encryption, "AES256" or "aws:kms"
+	Inject string `yaml:"Inject"`
+	// KMSKeyID is injected with "aws:kms" algorithm, storage default key is
+	// used if empty
+	KMSKeyID string `yaml:"KMSKeyID"`
+	// Strip removes x-amz-server-side-encryption headers for storages
+	// rejecting them, SSE-C headers are governed by SSECustomerKey capability
+	Strip bool `yaml:"Strip"`
+}
+
 // Storage defines backend
 type Storage struct {
 	Backend     types.YAMLUrl     `yaml:"Backend"`
 	Type        string            `yaml:"Type"`
 	Maintenance bool              `yaml:"Maintenance"`
 	Properties  map[string]string `yaml:"Properties"`
+	TLS         *TLS              `yaml:"TLS,omitempty"`
+	// Shadow storage gets copy of all shard traffic, its responses never
+	// influence client response and its errors are only logged
+	Shadow bool `yaml:"Shadow"`
+	// HTTP2 enables HTTP/2 for backend connections, "h2" or "h2c"
+	HTTP2 string `yaml:"HTTP2"`
+	// Transport overrides connection pool settings for this backend
+	Transport *transportconfig.BackendTransportProperties `yaml:"Transport,omitempty"`
+	// AddressingStyle is "path" or "preserve", default: "preserve" for passthrough
+	// storages, which need unchanged requests for signature match, "path" otherwise
+	AddressingStyle string `yaml:"AddressingStyle"`
+	// Capabilities overrides storage type defaults, features are assumed to
+	// be supported unless declared otherwise
+	Capabilities map[string]bool `yaml:"Capabilities"`
+	// SSE manages server side encryption headers of requests to storage
+	SSE *SSE `yaml:"SSE,omitempty"`
+	// Queue bounds requests sent to storage at once, not bounded if empty
+	Queue *Queue `yaml:"Queue,omitempty"`
+	// Faults are injected into requests to storage, for resilience testing
+	// in staging only
+	Faults []Fault `yaml:"Faults,omitempty"`
+}
+
+// Queue of storage requests, requests over Workers wait in queue for free
+// worker, further requests fail as storage errors
+type Queue struct {
+	// Workers is number of requests sent to storage at once, worker is
+	// held until response body is closed
+	Workers int `yaml:"Workers"`
+	// Size is number of requests waiting for free worker
+	Size int `yaml:"Size"`
+	// Timeout is maximal time request waits in queue, zero means until
+	// request is canceled
+	Timeout metrics.Interval `yaml:"Timeout"`
+}
+
+// Fault injected into percentage of storage requests, Latency may be
+// combined with Status or Reset
+type Fault struct {
+	// Percentage of requests fault is injected into, faults of storage
+	// share 100 percent of requests
+	Percentage float64 `yaml:"Percentage"`
+	// Latency delays requests before they're sent
+	Latency metrics.Interval `yaml:"Latency"`
+	// Status replaces storage response with S3 error of 5xx status
+	Status int `yaml:"Status"`
+	// Reset fails requests as if storage reset connection
+	Reset bool `yaml:"Reset"`
+}
+
+// PreservesAddressingStyle reports if virtual hosted style requests should be sent to backend unchanged
+func (s Storage) PreservesAddressingStyle() bool {
+	if s.AddressingStyle == "" {
+		return s.Type == Passthrough
+	}
+	return s.AddressingStyle == PreserveStyle
+}
+
+// TLS defines https backend connection options
+type TLS struct {
+	// RootCAFile is PEM encoded CA bundle used instead of system roots
+	RootCAFile string `yaml:"RootCAFile"`
+	// CertFile and KeyFile are client certificate for mutual TLS
+	CertFile string `yaml:"CertFile"`
+	KeyFile  string `yaml:"KeyFile"`
+	// ServerName overrides SNI and verified certificate host name
+	ServerName string `yaml:"ServerName"`
+	// InsecureSkipVerify disables certificate verification, use in test environments only
+	InsecureSkipVerify bool `yaml:"InsecureSkipVerify"`
 }
 
 // StoragesMap is map of Backend
@@ -28,6 +186,14 @@ type StoragesMap map[string]Storage
 // Shard defines shard storages configuration
 type Shard struct {
 	Storages Storages `yaml:"Storages"`
+	// BodyMode is "spool" (default) or "stream"
+	BodyMode string `yaml:"BodyMode"`
+	// MethodPolicies maps HTTP method (or LIST) to routing policy, methods
+	// not listed keep default routing
+	MethodPolicies map[string]string `yaml:"MethodPolicies"`
+	// BucketAliases maps bucket names used by clients to bucket names on
+	// storages of shard
+	BucketAliases map[string]string `yaml:"BucketAliases"`
 }
 
 // ShardsMap is map of Cluster
@@ -48,4 +214,7 @@ type StorageBreakerProperties struct {
 	Priority                       int              `yaml:"Priority"`
 	MeterResolution                metrics.Interval `yaml:"MeterResolution"`
 	MeterRetention                 metrics.Interval `yaml:"MeterRetention"`
+	// Weight is read preference among storages of the same priority, storages
+	// with positive weight get reads in proportion to it
+	Weight int `yaml:"Weight"`
 }
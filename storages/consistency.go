@@ -0,0 +1,82 @@
+package storages
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+)
+
+// consistencyHeaders identify object version, they should be equal for
+// responses of all backends
+var consistencyHeaders = []string{"ETag", "Last-Modified"}
+
+// metadataMismatch returns headers of object read responses which differ,
+// responses of different statuses aren't compared
+func metadataMismatch(first, other BackendResponse) []string {
+	if first.Response == nil || other.Response == nil || first.Response.StatusCode != other.Response.StatusCode {
+		return nil
+	}
+	mismatched := make([]string, 0)
+	for _, header := range consistencyHeaders {
+		if first.Response.Header.Get(header) != other.Response.Header.Get(header) {
+			mismatched = append(mismatched, header)
+		}
+	}
+	return mismatched
+}
+
+// checkConsistency records successful object read response which metadata
+// differs from the first successful one
+func (bp *BasePicker) checkConsistency(bresp BackendResponse) {
+	req := bresp.Request
+	if req == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) || !isObjectPath(req.URL.Path) {
+		return
+	}
+	mismatched := metadataMismatch(bp.success, bresp)
+	if len(mismatched) == 0 {
+		return
+	}
+	for _, header := range mismatched {
+		metrics.Mark("reqs.consistency.mismatch." + strings.ToLower(header))
+	}
+	log.Printf("Object %s %s differs on backends %s and %s, request %s", req.URL.Path, strings.Join(mismatched, ", "),
+		extractDestinationHostName(bp.success), extractDestinationHostName(bresp), bresp.ReqID())
+	bp.divergent = append(bp.divergent, bresp)
+}
+
+// repair writes object which metadata differs among backends to synclog, so
+// it's copied from backend with the newest Last-Modified to the others
+func (slf *SyncSender) repair(first BackendResponse, divergent []BackendResponse) {
+	if slf == nil || !slf.ReadRepair || slf.SyncLog == nil || len(divergent) == 0 {
+		return
+	}
+	responses := append([]BackendResponse{first}, divergent...)
+	newest := first
+	for _, bresp := range divergent {
+		if lastModified(bresp).After(lastModified(newest)) {
+			newest = bresp
+		}
+	}
+	for _, bresp := range responses {
+		if len(metadataMismatch(newest, bresp)) == 0 {
+			continue
+		}
+		syncLogMsg := newSyncLogMessage(newest, bresp)
+		syncLogMsg.Method = http.MethodPut
+		syncLogMsg.ErrorMsg = fmt.Sprintf("metadata mismatch: %s", strings.Join(metadataMismatch(newest, bresp), ", "))
+		slf.write(syncLogMsg)
+		metrics.Mark(fmt.Sprintf("reqs.consistency.repair.%s", metrics.Clean(extractDestinationHostName(bresp))))
+	}
+}
+
+func lastModified(bresp BackendResponse) time.Time {
+	modified, err := http.ParseTime(bresp.Response.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}
+	}
+	return modified
+}
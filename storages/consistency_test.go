@@ -0,0 +1,81 @@
+package storages
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type objectVersion struct {
+	host, etag, lastModified string
+}
+
+func readResponses(t *testing.T, versions ...objectVersion) chan BackendResponse {
+	request, err := http.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	responses := make(chan BackendResponse, len(versions))
+	for _, version := range versions {
+		header := http.Header{}
+		header.Set("ETag", version.etag)
+		header.Set("Last-Modified", version.lastModified)
+		responses <- BackendResponse{
+			Request:  request,
+			Response: &http.Response{Request: request, StatusCode: http.StatusOK, Header: header},
+			Backend:  &StorageClient{Endpoint: url.URL{Host: version.host}},
+		}
+	}
+	close(responses)
+	return responses
+}
+
+func pickRead(t *testing.T, syncLog *SyncSender, versions ...objectVersion) *http.Response {
+	picker := newObjectResponsePicker(readResponses(t, versions...))
+	resp, err := picker.Pick()
+	require.NoError(t, err)
+	picker.SendSyncLog(syncLog)
+	return resp
+}
+
+func TestObjectsWithDivergentMetadataShouldBeRepairedFromNewestCopy(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	syncLog := &SyncSender{SyncLog: recorder, ReadRepair: true}
+
+	resp := pickRead(t, syncLog,
+		objectVersion{"stale:8080", `"old"`, "Mon, 01 Jan 2018 00:00:00 GMT"},
+		objectVersion{"fresh:8080", `"new"`, "Tue, 02 Jan 2018 00:00:00 GMT"},
+		objectVersion{"synced:8080", `"new"`, "Tue, 02 Jan 2018 00:00:00 GMT"})
+
+	assert.Equal(t, `"old"`, resp.Header.Get("ETag"), "first response is still returned")
+	require.Len(t, recorder.lines, 1)
+	msg := httphandler.SyncLogMessageData{}
+	require.NoError(t, json.Unmarshal([]byte(recorder.lines[0]), &msg))
+	assert.Equal(t, http.MethodPut, msg.Method)
+	assert.Equal(t, "/bucket/key", msg.Path)
+	assert.Equal(t, "fresh:8080", msg.SuccessHost)
+	assert.Equal(t, "stale:8080", msg.FailedHost)
+}
+
+func TestObjectsWithDivergentMetadataShouldNotBeRepairedIfDisabled(t *testing.T) {
+	recorder := &syncLogRecorder{}
+
+	pickRead(t, &SyncSender{SyncLog: recorder},
+		objectVersion{"stale:8080", `"old"`, "Mon, 01 Jan 2018 00:00:00 GMT"},
+		objectVersion{"fresh:8080", `"new"`, "Tue, 02 Jan 2018 00:00:00 GMT"})
+
+	assert.Empty(t, recorder.lines)
+}
+
+func TestConsistentObjectsShouldNotBeRepaired(t *testing.T) {
+	recorder := &syncLogRecorder{}
+
+	pickRead(t, &SyncSender{SyncLog: recorder, ReadRepair: true},
+		objectVersion{"first:8080", `"new"`, "Tue, 02 Jan 2018 00:00:00 GMT"},
+		objectVersion{"second:8080", `"new"`, "Tue, 02 Jan 2018 00:00:00 GMT"})
+
+	assert.Empty(t, recorder.lines)
+}
@@ -0,0 +1,90 @@
+package storages
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/types"
+)
+
+// faultInjector injects configured faults into percentage of requests to
+// single backend, so retries, breakers and synclog may be verified in staging
+type faultInjector struct {
+	roundTripper  http.RoundTripper
+	faults        []config.Fault
+	metricsPrefix string
+	// random returns number in [0, 100) range
+	random func() float64
+}
+
+func newFaultInjector(name string, roundTripper http.RoundTripper, faults []config.Fault) http.RoundTripper {
+	if len(faults) == 0 {
+		return roundTripper
+	}
+	log.Printf("Faults are injected into requests to storage %q", name)
+	return &faultInjector{
+		roundTripper:  roundTripper,
+		faults:        faults,
+		metricsPrefix: "reqs.backend." + metrics.Clean(name) + ".faults",
+		random:        func() float64 { return rand.Float64() * 100 },
+	}
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (fi *faultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, injected := fi.pick()
+	if !injected {
+		return fi.roundTripper.RoundTrip(req)
+	}
+	if fault.Latency.Duration > 0 {
+		metrics.Mark(fi.metricsPrefix + ".latency")
+		timer := time.NewTimer(fault.Latency.Duration)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+	switch {
+	case fault.Reset:
+		metrics.Mark(fi.metricsPrefix + ".reset")
+		closeRequestBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case fault.Status != 0:
+		metrics.Mark(fi.metricsPrefix + ".status")
+		closeRequestBody(req)
+		return types.NewS3ErrorResponseForStatus(req, fault.Status), nil
+	}
+	return fi.roundTripper.RoundTrip(req)
+}
+
+// pick draws fault of request, faults share 100 percent of requests
+func (fi *faultInjector) pick() (config.Fault, bool) {
+	drawn := fi.random()
+	for _, fault := range fi.faults {
+		if drawn < fault.Percentage {
+			return fault, true
+		}
+		drawn -= fault.Percentage
+	}
+	return config.Fault{}, false
+}
+
+// closeRequestBody closes body of request not sent, as transport would
+func closeRequestBody(req *http.Request) {
+	if req.Body == nil {
+		return
+	}
+	if err := req.Body.Close(); err != nil {
+		log.Debugf("Cannot close body of request %s: %s", req.Context().Value(log.ContextreqIDKey), err)
+	}
+}
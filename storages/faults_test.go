@@ -0,0 +1,81 @@
+package storages
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFaultInjector(drawn float64, faults ...config.Fault) (*faultInjector, *int) {
+	sent := 0
+	injector := newFaultInjector("staging", &testRt{rt: func(req *http.Request) (*http.Response, error) {
+		sent++
+		return okResponse(req)
+	}}, faults).(*faultInjector)
+	injector.random = func() float64 { return drawn }
+	return injector, &sent
+}
+
+func TestFaultInjectorShouldShareRequestsAmongFaults(t *testing.T) {
+	faults := []config.Fault{{Percentage: 10, Status: http.StatusServiceUnavailable}, {Percentage: 5, Reset: true}}
+	testCases := []struct {
+		drawn  float64
+		status int
+		reset  bool
+	}{
+		{drawn: 0, status: http.StatusServiceUnavailable},
+		{drawn: 9.9, status: http.StatusServiceUnavailable},
+		{drawn: 10, reset: true},
+		{drawn: 14.9, reset: true},
+		{drawn: 15, status: http.StatusOK},
+		{drawn: 99.9, status: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		injector, sent := newTestFaultInjector(tc.drawn, faults...)
+
+		resp, err := injector.RoundTrip(httptest.NewRequest(http.MethodGet, "http://staging/bucket/key", nil))
+
+		if tc.reset {
+			opErr, ok := err.(*net.OpError)
+			require.True(t, ok, "drawn %f", tc.drawn)
+			assert.Contains(t, opErr.Error(), syscall.ECONNRESET.Error())
+			assert.Equal(t, 0, *sent)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.status, resp.StatusCode, "drawn %f", tc.drawn)
+		assert.Equal(t, tc.status == http.StatusOK, *sent == 1, "drawn %f", tc.drawn)
+	}
+}
+
+func TestFaultInjectorShouldDelayRequests(t *testing.T) {
+	injector, sent := newTestFaultInjector(0, config.Fault{Percentage: 100, Latency: metrics.Interval{Duration: 20 * time.Millisecond}})
+
+	start := time.Now()
+	resp, err := injector.RoundTrip(httptest.NewRequest(http.MethodGet, "http://staging/bucket/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.Equal(t, 1, *sent)
+}
+
+func TestFaultInjectorShouldStopDelayingCanceledRequests(t *testing.T) {
+	injector, sent := newTestFaultInjector(0, config.Fault{Percentage: 100, Latency: metrics.Interval{Duration: time.Hour}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := injector.RoundTrip(httptest.NewRequest(http.MethodGet, "http://staging/bucket/key", nil).WithContext(ctx))
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, *sent)
+}
@@ -0,0 +1,74 @@
+package storages
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/awschunked"
+	"github.com/allegro/akubra/types"
+)
+
+// ErrChecksumMismatch is set on write response of backend which returned
+// ETag other than checksum of request body
+var ErrChecksumMismatch = errors.New("stored object checksum mismatch")
+
+// bodyMD5 returns checksum of buffered body of object write, nil if body
+// wasn't buffered or backend doesn't store body as sent
+func bodyMD5(req *http.Request) []byte {
+	if req.Method != http.MethodPut || !isObjectPath(req.URL.Path) || req.Header.Get("X-Amz-Copy-Source") != "" {
+		return nil
+	}
+	if awschunked.IsStreamingUpload(req) {
+		return nil
+	}
+	digester, ok := req.Body.(types.Digester)
+	if !ok {
+		return nil
+	}
+	digest, ok := digester.MD5()
+	if !ok {
+		return nil
+	}
+	return digest
+}
+
+// etagMD5 returns checksum carried by ETag, ETags of encrypted objects and
+// ones not being MD5 at all are not comparable
+func etagMD5(resp *http.Response) ([]byte, bool) {
+	if resp.Header.Get("X-Amz-Server-Side-Encryption") == "aws:kms" ||
+		resp.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return nil, false
+	}
+	digest, err := hex.DecodeString(strings.Trim(resp.Header.Get("ETag"), `"`))
+	if err != nil || len(digest) != 16 {
+		return nil, false
+	}
+	return digest, true
+}
+
+// verifyChecksum marks write failed if backend stored object other than
+// sent, such response is written to synclog like any other failure
+func verifyChecksum(bresp *BackendResponse, digest []byte) {
+	if digest == nil || !bresp.IsSuccessful() {
+		return
+	}
+	etag, ok := etagMD5(bresp.Response)
+	if !ok || bytes.Equal(etag, digest) {
+		return
+	}
+	host := extractDestinationHostName(*bresp)
+	log.Printf("Object %s stored on backend %s has ETag %s, expected %x, request %s", bresp.Request.URL.Path,
+		host, bresp.Response.Header.Get("ETag"), digest, bresp.ReqID())
+	metrics.Mark(fmt.Sprintf("reqs.integrity.mismatch.%s", metrics.Clean(host)))
+	if err := bresp.DiscardBody(); err != nil {
+		log.Debugf("Could not close tuple body: %s", err)
+	}
+	bresp.Response = nil
+	bresp.Error = ErrChecksumMismatch
+}
@@ -0,0 +1,90 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// digestedBody is replayable body with checksum, like spooled one
+type digestedBody struct {
+	io.Reader
+	content []byte
+}
+
+func (db *digestedBody) Close() error { return nil }
+
+func (db *digestedBody) Reset() io.ReadCloser {
+	return &digestedBody{Reader: bytes.NewReader(db.content), content: db.content}
+}
+
+func (db *digestedBody) MD5() ([]byte, bool) {
+	digest := md5.Sum(db.content)
+	return digest[:], true
+}
+
+func backendStoring(host, etag string) *StorageClient {
+	return &StorageClient{Endpoint: url.URL{Host: host}, RoundTripper: &testRt{rt: func(req *http.Request) (*http.Response, error) {
+		if _, err := ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		header := http.Header{}
+		header.Set("ETag", etag)
+		return &http.Response{Request: req, StatusCode: http.StatusOK, Header: header, Body: http.NoBody}, nil
+	}}}
+}
+
+func putObject(t *testing.T, syncLog *SyncSender, backends ...*StorageClient) (*http.Response, error) {
+	content := []byte("content")
+	request, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	request.Body = &digestedBody{Reader: bytes.NewReader(content), content: content}
+	picker := newObjectResponsePicker(newReplicationClient(backends).Do(request))
+	resp, err := picker.Pick()
+	picker.SendSyncLog(syncLog)
+	return resp, err
+}
+
+func TestReplicaWithMismatchedETagShouldBeRepaired(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	syncLog := &SyncSender{SyncLog: recorder, AllowedMethods: map[string]struct{}{http.MethodPut: {}}}
+	digest := md5.Sum([]byte("content"))
+	etag := `"` + hex.EncodeToString(digest[:]) + `"`
+
+	resp, err := putObject(t, syncLog, backendStoring("corrupted:8080", `"00000000000000000000000000000000"`),
+		backendStoring("valid:8080", etag))
+
+	require.NoError(t, err)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	require.Len(t, recorder.lines, 1)
+	msg := httphandler.SyncLogMessageData{}
+	require.NoError(t, json.Unmarshal([]byte(recorder.lines[0]), &msg))
+	assert.Equal(t, "corrupted:8080", msg.FailedHost)
+	assert.Equal(t, "valid:8080", msg.SuccessHost)
+	assert.Contains(t, msg.ErrorMsg, ErrChecksumMismatch.Error())
+}
+
+func TestWriteShouldFailIfNoReplicaStoredBody(t *testing.T) {
+	_, err := putObject(t, nil, backendStoring("corrupted:8080", `"00000000000000000000000000000000"`))
+
+	assert.Equal(t, ErrChecksumMismatch, err)
+}
+
+func TestNotMD5ETagsShouldNotBeVerified(t *testing.T) {
+	for _, etag := range []string{`"0x8D5A5F5E2D1C3B0"`, `"9b2cf535f27731c974343645a3985328-2"`, ""} {
+		resp, err := putObject(t, nil, backendStoring("other:8080", etag))
+
+		require.NoError(t, err, etag)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, etag)
+	}
+}
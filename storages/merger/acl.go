@@ -0,0 +1,127 @@
+package merger
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/backend"
+	"github.com/allegro/akubra/types"
+)
+
+// ownerGrantee replaces owner id in grant keys, as owner ids of the same
+// account differ among backends
+const ownerGrantee = "owner"
+
+// MergeACLResponses returns grants common to ACLs of all backends, so client
+// never sees permission which isn't effective everywhere. Divergent ACLs are
+// logged and marked with warning header
+func MergeACLResponses(successes []backend.Response) (*http.Response, error) {
+	if len(successes) == 0 {
+		return nil, fmt.Errorf("No successful responses")
+	}
+	first := successes[0]
+	policies := make([]types.AccessControlPolicy, 0, len(successes))
+	var firstBody []byte
+	for i, bresp := range successes {
+		body, err := ioutil.ReadAll(bresp.Response.Body)
+		if discardErr := bresp.DiscardBody(); discardErr != nil {
+			log.Debugf("Response discard error in MergeACLResponses %s", discardErr)
+		}
+		if i == 0 {
+			firstBody = body
+		}
+		var policy types.AccessControlPolicy
+		if err == nil {
+			err = xml.Unmarshal(body, &policy)
+		}
+		if err != nil {
+			log.Printf("Cannot parse ACL of request %s from backend %s: %s", first.ReqID(), backendName(bresp), err)
+			return aclResponse(first.Response, firstBody, true), nil
+		}
+		policies = append(policies, policy)
+	}
+	common, divergent := commonGrants(policies)
+	if !divergent {
+		return aclResponse(first.Response, firstBody, false), nil
+	}
+	descriptions := make([]string, 0, len(successes))
+	for i, bresp := range successes {
+		descriptions = append(descriptions, fmt.Sprintf("%s: [%s]", backendName(bresp), strings.Join(grantKeys(policies[i]), ", ")))
+	}
+	log.Printf("ACL of %s diverges among backends, request %s, %s", first.Request.URL.Path, first.ReqID(), strings.Join(descriptions, "; "))
+	merged := policies[0]
+	merged.Grants = common
+	body, err := xml.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return aclResponse(first.Response, append([]byte(xml.Header), body...), true), nil
+}
+
+// commonGrants returns grants of first policy present in all policies, it
+// reports if policies have different grants
+func commonGrants(policies []types.AccessControlPolicy) (common []types.Grant, divergent bool) {
+	counts := make(map[string]int)
+	for _, policy := range policies {
+		for _, key := range grantKeys(policy) {
+			counts[key]++
+		}
+	}
+	for _, count := range counts {
+		if count != len(policies) {
+			divergent = true
+		}
+	}
+	common = make([]types.Grant, 0, len(policies[0].Grants))
+	for _, grant := range policies[0].Grants {
+		if counts[grantKey(policies[0].Owner, grant)] == len(policies) {
+			common = append(common, grant)
+		}
+	}
+	return common, divergent
+}
+
+// grantKeys returns sorted, unique keys of policy grants
+func grantKeys(policy types.AccessControlPolicy) []string {
+	unique := make(map[string]struct{})
+	for _, grant := range policy.Grants {
+		unique[grantKey(policy.Owner, grant)] = struct{}{}
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func grantKey(owner types.ACLOwner, grant types.Grant) string {
+	grantee := grant.Grantee.ID
+	if grantee != "" && grantee == owner.ID {
+		grantee = ownerGrantee
+	}
+	return fmt.Sprintf("%s:%s%s%s=%s", grant.Grantee.Type, grantee, grant.Grantee.URI, grant.Grantee.EmailAddress, grant.Permission)
+}
+
+func aclResponse(resp *http.Response, body []byte, inconsistent bool) *http.Response {
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	if inconsistent {
+		resp.Header.Set(warningHeader, inconsitentRespInfo)
+	}
+	return resp
+}
+
+func backendName(bresp backend.Response) string {
+	if bresp.Backend == nil {
+		return "unknown"
+	}
+	return bresp.Backend.Name
+}
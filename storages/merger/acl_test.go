@@ -0,0 +1,74 @@
+package merger
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/allegro/akubra/storages/backend"
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const allUsersURI = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+func aclPolicy(ownerID string, grants ...types.Grant) types.AccessControlPolicy {
+	return types.AccessControlPolicy{Owner: types.ACLOwner{ID: ownerID}, Grants: grants}
+}
+
+func ownerGrant(ownerID string) types.Grant {
+	return types.Grant{Grantee: types.Grantee{Type: "CanonicalUser", ID: ownerID}, Permission: "FULL_CONTROL"}
+}
+
+func publicReadGrant() types.Grant {
+	return types.Grant{Grantee: types.Grantee{Type: "Group", URI: allUsersURI}, Permission: "READ"}
+}
+
+func mergeACL(t *testing.T, policies ...types.AccessControlPolicy) (*http.Response, types.AccessControlPolicy) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/bucket?acl", nil)
+	require.NoError(t, err)
+	successes := make([]backend.Response, 0, len(policies))
+	for _, policy := range policies {
+		body, marshalErr := xml.Marshal(policy)
+		require.NoError(t, marshalErr)
+		successes = append(successes, backend.Response{
+			Request: req,
+			Response: &http.Response{
+				StatusCode: http.StatusOK,
+				Request:    req,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			},
+		})
+	}
+	resp, err := MergeACLResponses(successes)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	merged := types.AccessControlPolicy{}
+	require.NoError(t, xml.Unmarshal(body, &merged))
+	return resp, merged
+}
+
+func TestMergeACLShouldTreatOwnerGrantsOfDifferentOwnerIDsAsEqual(t *testing.T) {
+	resp, merged := mergeACL(t,
+		aclPolicy("owner-a", ownerGrant("owner-a"), publicReadGrant()),
+		aclPolicy("owner-b", ownerGrant("owner-b"), publicReadGrant()))
+
+	assert.Empty(t, resp.Header.Get(warningHeader))
+	assert.Equal(t, "owner-a", merged.Owner.ID)
+	assert.Len(t, merged.Grants, 2)
+}
+
+func TestMergeACLShouldReturnCommonGrantsOfDivergentACLs(t *testing.T) {
+	resp, merged := mergeACL(t,
+		aclPolicy("owner-a", ownerGrant("owner-a"), publicReadGrant()),
+		aclPolicy("owner-b", ownerGrant("owner-b")))
+
+	assert.Equal(t, inconsitentRespInfo, resp.Header.Get(warningHeader))
+	require.Len(t, merged.Grants, 1)
+	assert.Equal(t, ownerGrant("owner-a"), merged.Grants[0])
+}
@@ -113,6 +113,7 @@ type UserInfo struct {
 type VersionMarker interface {
 	GetKey() string
 	GetVersionID() string
+	GetLastModified() time.Time
 }
 
 // VersionInfo version item container
@@ -141,6 +142,11 @@ func (vi VersionInfo) GetVersionID() string {
 	return vi.VersionID
 }
 
+// GetLastModified returns modification time to satisfy Marker interface
+func (vi VersionInfo) GetLastModified() time.Time {
+	return vi.LastModified
+}
+
 // DeleteMarkerInfo container
 type DeleteMarkerInfo struct {
 	Key          string
@@ -164,6 +170,11 @@ func (dmi DeleteMarkerInfo) GetVersionID() string {
 	return dmi.VersionID
 }
 
+// GetLastModified returns modification time to satisfy Marker interface
+func (dmi DeleteMarkerInfo) GetLastModified() time.Time {
+	return dmi.LastModified
+}
+
 // ListVersionsResult container for Bucket Object versions response
 // see: https://docs.aws.amazon.com/AmazonS3/latest/API/RESTBucketGETVersion.html
 type ListVersionsResult struct {
@@ -174,8 +185,13 @@ type ListVersionsResult struct {
 	// VersionIDMarker Marks the last version of the Key returned in a truncated response.
 	VersionIDMarker string
 	MaxKeys         int64
+	Delimiter       string
 	EncodingType    string
 
+	// A response can contain CommonPrefixes only if you have
+	// specified a delimiter.
+	CommonPrefixes CommonPrefixes
+
 	// A flag that indicates whether or not ListObjects returned all of the results
 	// that satisfied the search criteria.
 	IsTruncated  bool
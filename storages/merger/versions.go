@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/allegro/akubra/log"
@@ -20,16 +21,24 @@ func MergeVersionsResponses(successes []backend.Response) (resp *http.Response,
 		err = fmt.Errorf("No successful responses")
 		return
 	}
-	keysContainer := &objectsContainer{
+	versions := &versionsContainer{set: make(map[string]struct{})}
+	prefixes := objectsContainer{
 		list: make([]fmt.Stringer, 0),
 		set:  make(map[string]struct{}),
 	}
 	var listBucketResult s3datatypes.ListVersionsResult
+	isTruncated := false
 	for _, tuple := range successes {
 		resp = tuple.Response
 		listBucketResult = extractListVersionsResults(resp)
-		keysContainer.append(listBucketResult.Version.ToStringer()...)
-		keysContainer.append(listBucketResult.DeleteMarker.ToStringer()...)
+		isTruncated = isTruncated || listBucketResult.IsTruncated
+		for _, version := range listBucketResult.Version {
+			versions.append(version)
+		}
+		for _, deleteMarker := range listBucketResult.DeleteMarker {
+			versions.append(deleteMarker)
+		}
+		prefixes.append(listBucketResult.CommonPrefixes.ToStringer()...)
 
 		discardErr := tuple.DiscardBody()
 		if discardErr != nil {
@@ -45,7 +54,8 @@ func MergeVersionsResponses(successes []backend.Response) (resp *http.Response,
 		maxKeys = 1000
 	}
 
-	listBucketResult = createVersionResultSet(keysContainer, maxKeys, listBucketResult)
+	listBucketResult.IsTruncated = isTruncated
+	listBucketResult = createVersionResultSet(versions, prefixes, maxKeys, listBucketResult)
 
 	bodyBytes, err := xml.Marshal(listBucketResult)
 	if err != nil {
@@ -61,6 +71,40 @@ func MergeVersionsResponses(successes []backend.Response) (resp *http.Response,
 	return resp, nil
 }
 
+// versionsContainer collects versions and delete markers of many backends,
+// entries are unique by key and version id
+type versionsContainer struct {
+	set  map[string]struct{}
+	list []s3datatypes.VersionMarker
+}
+
+func (vc *versionsContainer) append(entry s3datatypes.VersionMarker) {
+	id := entry.GetKey() + "\x00" + entry.GetVersionID()
+	if _, ok := vc.set[id]; ok {
+		return
+	}
+	vc.set[id] = struct{}{}
+	vc.list = append(vc.list, entry)
+}
+
+// first returns up to limit entries in S3 order: by key, newest version first
+func (vc *versionsContainer) first(limit int) []s3datatypes.VersionMarker {
+	sort.SliceStable(vc.list, func(i, j int) bool {
+		left, right := vc.list[i], vc.list[j]
+		if left.GetKey() != right.GetKey() {
+			return left.GetKey() < right.GetKey()
+		}
+		if !left.GetLastModified().Equal(right.GetLastModified()) {
+			return left.GetLastModified().After(right.GetLastModified())
+		}
+		return left.GetVersionID() < right.GetVersionID()
+	})
+	if limit >= len(vc.list) {
+		return vc.list
+	}
+	return vc.list[0:limit]
+}
+
 func extractListVersionsResults(resp *http.Response) s3datatypes.ListVersionsResult {
 	lbr := s3datatypes.ListVersionsResult{}
 	if resp.Body == nil {
@@ -82,39 +126,44 @@ func extractListVersionsResults(resp *http.Response) s3datatypes.ListVersionsRes
 	return lbr
 }
 
-func createVersionResultSet(keysContainer *objectsContainer, maxKeys int, versionsResult s3datatypes.ListVersionsResult) s3datatypes.ListVersionsResult {
+func createVersionResultSet(versions *versionsContainer, prefixes objectsContainer, maxKeys int, versionsResult s3datatypes.ListVersionsResult) s3datatypes.ListVersionsResult {
+	versionsResult.CommonPrefixes = versionsResult.CommonPrefixes.FromStringer(prefixes.first(maxKeys))
+	entriesCount := maxKeys - len(versionsResult.CommonPrefixes)
+	if entriesCount < 0 {
+		entriesCount = 0
+	}
 	deleteMarkers := s3datatypes.DeleteMarkerInfos{}
-	versions := s3datatypes.VersionInfos{}
-
-	keys := keysContainer.first(maxKeys + 1)
-	numOfKeys := len(keys)
+	versionInfos := s3datatypes.VersionInfos{}
+	// Each backend marks its own newest version, only the newest of all
+	// merged entries of a key is the latest one
+	keysSeen := make(map[string]struct{})
 	var lastMarker s3datatypes.VersionMarker
-	for _, key := range keys[0:numOfKeys] {
-		switch v := key.(type) {
+	for _, entry := range versions.first(entriesCount) {
+		_, seen := keysSeen[entry.GetKey()]
+		keysSeen[entry.GetKey()] = struct{}{}
+		switch v := entry.(type) {
 		case s3datatypes.DeleteMarkerInfo:
+			v.IsLatest = v.IsLatest && !seen
 			deleteMarkers = append(deleteMarkers, v)
-			lastMarker = v
 		case s3datatypes.VersionInfo:
-			versions = append(versions, v)
-			lastMarker = v
+			v.IsLatest = v.IsLatest && !seen
+			versionInfos = append(versionInfos, v)
 		}
-
+		lastMarker = entry
 	}
-	versionsResult.Version = versions
+	versionsResult.Version = versionInfos
 	versionsResult.DeleteMarker = deleteMarkers
-	if lastMarker != nil {
-		versionsResult.KeyMarker = lastMarker.GetKey()
-		versionsResult.VersionIDMarker = lastMarker.GetVersionID()
-	}
 
-	versionsResult.IsTruncated = versionsResult.IsTruncated || keysContainer.Len() > maxKeys
+	versionsResult.IsTruncated = versionsResult.IsTruncated || len(versions.list)+prefixes.Len() > maxKeys
+	versionsResult.NextKeyMarker = ""
+	versionsResult.NextVersionIDMarker = ""
 	if versionsResult.IsTruncated {
-		if keysContainer.Len() > maxKeys {
-			nextMarker := keysContainer.Get(maxKeys + 1).(s3datatypes.VersionMarker)
-			versionsResult.NextKeyMarker = nextMarker.GetKey()
-			versionsResult.NextVersionIDMarker = nextMarker.GetVersionID()
+		if lastMarker != nil {
+			versionsResult.NextKeyMarker = lastMarker.GetKey()
+			versionsResult.NextVersionIDMarker = lastMarker.GetVersionID()
+		} else if len(versionsResult.CommonPrefixes) > 0 {
+			versionsResult.NextKeyMarker = versionsResult.CommonPrefixes[len(versionsResult.CommonPrefixes)-1].Prefix
 		}
-
 	}
 	return versionsResult
 }
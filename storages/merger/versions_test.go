@@ -1 +1,107 @@
 package merger
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/storages/backend"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var versionsBaseTime = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func versionsResponse(t *testing.T, req *http.Request, result s3datatypes.ListVersionsResult) backend.Response {
+	body, err := xml.Marshal(result)
+	require.NoError(t, err)
+	return backend.Response{
+		Request: req,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Request:    req,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		},
+	}
+}
+
+func version(key, id string, age time.Duration, isLatest bool) s3datatypes.VersionInfo {
+	return s3datatypes.VersionInfo{Key: key, VersionID: id, LastModified: versionsBaseTime.Add(-age), IsLatest: isLatest}
+}
+
+func mergeVersions(t *testing.T, url string, results ...s3datatypes.ListVersionsResult) s3datatypes.ListVersionsResult {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	successes := make([]backend.Response, 0, len(results))
+	for _, result := range results {
+		successes = append(successes, versionsResponse(t, req, result))
+	}
+	resp, err := MergeVersionsResponses(successes)
+	require.NoError(t, err)
+	merged := s3datatypes.ListVersionsResult{}
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, xml.Unmarshal(body, &merged))
+	return merged
+}
+
+func TestMergeVersionsShouldOrderByKeyAndNewestVersionFirst(t *testing.T) {
+	merged := mergeVersions(t, "http://localhost/bucket?versions",
+		s3datatypes.ListVersionsResult{
+			Version: s3datatypes.VersionInfos{version("b", "b1", 0, true), version("b", "b0", time.Hour, false)},
+		},
+		s3datatypes.ListVersionsResult{
+			Version:      s3datatypes.VersionInfos{version("a", "a0", time.Hour, true), version("b", "b1", 0, true)},
+			DeleteMarker: s3datatypes.DeleteMarkerInfos{{Key: "a", VersionID: "a1", LastModified: versionsBaseTime, IsLatest: true}},
+		})
+
+	require.Len(t, merged.Version, 3)
+	assert.Equal(t, "a0", merged.Version[0].VersionID)
+	assert.False(t, merged.Version[0].IsLatest, "delete marker is newer")
+	assert.Equal(t, "b1", merged.Version[1].VersionID)
+	assert.True(t, merged.Version[1].IsLatest)
+	assert.Equal(t, "b0", merged.Version[2].VersionID)
+	require.Len(t, merged.DeleteMarker, 1)
+	assert.True(t, merged.DeleteMarker[0].IsLatest)
+	assert.False(t, merged.IsTruncated)
+}
+
+func TestMergeVersionsShouldTruncateToMaxKeys(t *testing.T) {
+	merged := mergeVersions(t, "http://localhost/bucket?versions&max-keys=2&key-marker=0",
+		s3datatypes.ListVersionsResult{
+			KeyMarker: "0",
+			Version:   s3datatypes.VersionInfos{version("a", "a0", 0, true), version("c", "c0", 0, true)},
+		},
+		s3datatypes.ListVersionsResult{
+			KeyMarker: "0",
+			Version:   s3datatypes.VersionInfos{version("b", "b0", 0, true)},
+		})
+
+	require.Len(t, merged.Version, 2)
+	assert.True(t, merged.IsTruncated)
+	assert.Equal(t, "0", merged.KeyMarker)
+	assert.Equal(t, "b", merged.NextKeyMarker)
+	assert.Equal(t, "b0", merged.NextVersionIDMarker)
+}
+
+func TestMergeVersionsShouldMergeCommonPrefixes(t *testing.T) {
+	merged := mergeVersions(t, "http://localhost/bucket?versions&delimiter=/",
+		s3datatypes.ListVersionsResult{
+			Delimiter:      "/",
+			CommonPrefixes: s3datatypes.CommonPrefixes{{Prefix: "dir/"}},
+		},
+		s3datatypes.ListVersionsResult{
+			Delimiter:      "/",
+			CommonPrefixes: s3datatypes.CommonPrefixes{{Prefix: "dir/"}, {Prefix: "other/"}},
+			Version:        s3datatypes.VersionInfos{version("a", "a0", 0, true)},
+		})
+
+	require.Len(t, merged.CommonPrefixes, 2)
+	assert.Equal(t, "dir/", merged.CommonPrefixes[0].Prefix)
+	assert.Equal(t, "other/", merged.CommonPrefixes[1].Prefix)
+	require.Len(t, merged.Version, 1)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/storages/backend"
+	"github.com/allegro/akubra/storages/config"
 	"github.com/allegro/akubra/types"
 	"github.com/serialx/hashring"
 )
@@ -36,7 +37,7 @@ func newMultiPartRoundTripper(backends []*StorageClient) client {
 	multiPartRoundTripper.backendsRoundTrippers = make(map[string]*StorageClient)
 
 	for _, backend := range backends {
-		if !backend.Maintenance {
+		if !backend.Maintenance && backend.Supports(config.CapabilityMultipart) {
 			multiPartRoundTripper.backendsRoundTrippers[backend.Endpoint.Host] = backend
 			activeBackendsEndpoints = append(activeBackendsEndpoints, backend.Endpoint.Host)
 		}
@@ -0,0 +1,155 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+)
+
+// partValidator is client decorator for UploadPart requests. It checks part
+// digests before the part is sent to any backend and aborts the upload on all
+// backends once one of them rejects a part, so backends are not left with
+// mismatched multipart state
+type partValidator struct {
+	client
+	backends []*StorageClient
+}
+
+// validatingParts decorates client factory with partValidator
+func validatingParts(factory func([]*StorageClient) client) func([]*StorageClient) client {
+	return func(backends []*StorageClient) client {
+		return &partValidator{client: factory(backends), backends: backends}
+	}
+}
+
+// Do validates part and passes it to decorated client
+func (pv *partValidator) Do(request *http.Request) <-chan BackendResponse {
+	if resp := validatePartDigests(request); resp != nil {
+		responses := make(chan BackendResponse, 1)
+		responses <- BackendResponse{Request: request, Response: resp}
+		close(responses)
+		return responses
+	}
+	responses := pv.client.Do(request)
+	out := make(chan BackendResponse)
+	go func() {
+		defer close(out)
+		for bresp := range responses {
+			if isPartRejected(bresp) {
+				pv.abortUpload(request)
+			}
+			out <- bresp
+		}
+	}()
+	return out
+}
+
+// abortUpload sends AbortMultipartUpload to all backends, backends which don't
+// know the upload respond with NoSuchUpload
+func (pv *partValidator) abortUpload(request *http.Request) {
+	reqID := utils.RequestID(request)
+	uploadID := request.URL.Query().Get("uploadId")
+	log.Printf("Part of upload %s rejected for %s, aborting upload on all backends, RequestID %s",
+		uploadID, request.URL.Path, reqID)
+	metrics.Mark("multipart.aborted")
+	for _, backend := range pv.backends {
+		abortURL := *request.URL
+		abortURL.RawQuery = url.Values{"uploadId": []string{uploadID}}.Encode()
+		abortRequest, err := http.NewRequest(http.MethodDelete, abortURL.String(), nil)
+		if err != nil {
+			log.Printf("Cannot create abort request for upload %s: %s", uploadID, err)
+			return
+		}
+		abortRequest = abortRequest.WithContext(request.Context())
+		abortRequest.Host = request.Host
+		resp, err := backend.RoundTrip(abortRequest)
+		bresp := BackendResponse{Request: abortRequest, Response: resp, Error: err, Backend: backend}
+		if err != nil || !bresp.IsSuccessful() {
+			log.Debugf("Abort of upload %s on %s failed: %s", uploadID, backend.Name, err)
+		}
+		if discardErr := bresp.DiscardBody(); discardErr != nil {
+			log.Debugf("Could not close tuple body: %s", discardErr)
+		}
+	}
+}
+
+func isUploadPartRequest(request *http.Request) bool {
+	reqQuery := request.URL.Query()
+	_, hasPartNumber := reqQuery["partNumber"]
+	return request.Method == http.MethodPut && hasPartNumber && containsUploadID(request) &&
+		request.Header.Get("X-Amz-Copy-Source") == ""
+}
+
+// isPartRejected reports if backend refused part for reason which won't be
+// fixed by retry, like missing upload or invalid part. Authorization and
+// throttling errors don't break upload state
+func isPartRejected(bresp BackendResponse) bool {
+	if bresp.Error != nil || bresp.Response == nil {
+		return false
+	}
+	switch status := bresp.Response.StatusCode; {
+	case status == http.StatusForbidden, status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return false
+	default:
+		return status >= http.StatusBadRequest && status < http.StatusInternalServerError
+	}
+}
+
+// validatePartDigests compares Content-MD5 and X-Amz-Content-Sha256 headers
+// with part body and returns S3 error response on mismatch. Bodies which can't
+// be read before sending, like streamed ones, are left for backends to check
+func validatePartDigests(request *http.Request) *http.Response {
+	contentMD5 := request.Header.Get("Content-MD5")
+	contentSHA256 := request.Header.Get("X-Amz-Content-Sha256")
+	expectedMD5, md5Err := base64.StdEncoding.DecodeString(contentMD5)
+	if contentMD5 != "" && (md5Err != nil || len(expectedMD5) != md5.Size) {
+		return types.NewS3ErrorResponse(request, http.StatusBadRequest, types.S3ErrInvalidDigest,
+			"The Content-MD5 you specified was invalid.")
+	}
+	// Unsigned and chunk signed payloads are not hashed as whole
+	expectedSHA256, sha256Err := hex.DecodeString(contentSHA256)
+	validateSHA256 := sha256Err == nil && len(expectedSHA256) == sha256.Size
+	if contentMD5 == "" && !validateSHA256 {
+		return nil
+	}
+	resetter, ok := request.Body.(types.Resetter)
+	if !ok {
+		return nil
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	body := resetter.Reset()
+	_, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), body)
+	if closeErr := body.Close(); closeErr != nil {
+		log.Debugf("Could not close part body: %s", closeErr)
+	}
+	if err != nil {
+		log.Printf("Cannot read part body of %s for validation: %s", request.URL.Path, err)
+		return nil
+	}
+	if contentMD5 != "" && !digestEqual(md5Hash, expectedMD5) {
+		metrics.Mark("multipart.invalid_parts")
+		return types.NewS3ErrorResponse(request, http.StatusBadRequest, types.S3ErrBadDigest,
+			"The Content-MD5 you specified did not match what we received.")
+	}
+	if validateSHA256 && !digestEqual(sha256Hash, expectedSHA256) {
+		metrics.Mark("multipart.invalid_parts")
+		return types.NewS3ErrorResponse(request, http.StatusBadRequest, types.S3ErrContentSHA256Mismatch,
+			"The provided 'x-amz-content-sha256' header does not match what was computed.")
+	}
+	return nil
+}
+
+func digestEqual(h hash.Hash, expected []byte) bool {
+	return bytes.Equal(h.Sum(nil), expected)
+}
@@ -0,0 +1,143 @@
+package storages
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/allegro/akubra/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type resettableBody struct {
+	io.Reader
+	data []byte
+}
+
+func newResettableBody(data []byte) *resettableBody {
+	return &resettableBody{Reader: bytes.NewReader(data), data: data}
+}
+
+func (rb *resettableBody) Reset() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(rb.data))
+}
+
+func (rb *resettableBody) Close() error { return nil }
+
+func newUploadPartRequest(t *testing.T, body io.ReadCloser, headers map[string]string) *http.Request {
+	request, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/object?partNumber=1&uploadId=u1", body)
+	require.NoError(t, err)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	return request
+}
+
+func TestUploadPartDigestsValidation(t *testing.T) {
+	part := []byte("part content")
+	md5Sum := md5.Sum(part)
+	sha256Sum := sha256.Sum256(part)
+	otherMD5Sum := md5.Sum([]byte("other"))
+	otherSHA256Sum := sha256.Sum256([]byte("other"))
+
+	testCases := []struct {
+		headers      map[string]string
+		expectedCode string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:])}, ""},
+		{map[string]string{"X-Amz-Content-Sha256": hex.EncodeToString(sha256Sum[:])}, ""},
+		{map[string]string{"X-Amz-Content-Sha256": "UNSIGNED-PAYLOAD"}, ""},
+		{map[string]string{"Content-MD5": "not base64"}, types.S3ErrInvalidDigest},
+		{map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(otherMD5Sum[:])}, types.S3ErrBadDigest},
+		{map[string]string{"X-Amz-Content-Sha256": hex.EncodeToString(otherSHA256Sum[:])}, types.S3ErrContentSHA256Mismatch},
+	}
+
+	for _, testCase := range testCases {
+		request := newUploadPartRequest(t, newResettableBody(part), testCase.headers)
+		resp := validatePartDigests(request)
+		if testCase.expectedCode == "" {
+			assert.Nil(t, resp, "%v", testCase.headers)
+			continue
+		}
+		require.NotNil(t, resp, "%v", testCase.headers)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "<Code>"+testCase.expectedCode+"</Code>")
+	}
+}
+
+func TestUploadPartDigestsOfNotResettableBodyAreNotValidated(t *testing.T) {
+	otherMD5Sum := md5.Sum([]byte("other"))
+	request := newUploadPartRequest(t, ioutil.NopCloser(bytes.NewReader([]byte("part content"))),
+		map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(otherMD5Sum[:])})
+
+	assert.Nil(t, validatePartDigests(request))
+}
+
+func TestPartValidatorShouldNotSendInvalidPart(t *testing.T) {
+	clientMock := replicationClientMock{&mock.Mock{}}
+	validator := &partValidator{client: clientMock}
+	request := newUploadPartRequest(t, newResettableBody([]byte("part content")),
+		map[string]string{"Content-MD5": "not base64"})
+
+	responses := make([]BackendResponse, 0)
+	for bresp := range validator.Do(request) {
+		responses = append(responses, bresp)
+	}
+
+	require.Len(t, responses, 1)
+	assert.Equal(t, http.StatusBadRequest, responses[0].Response.StatusCode)
+	clientMock.AssertNotCalled(t, "Do", request)
+}
+
+func TestPartValidatorShouldAbortUploadOnAllBackendsWhenPartIsRejected(t *testing.T) {
+	for status, shouldAbort := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            true,
+		http.StatusBadRequest:          true,
+		http.StatusForbidden:           false,
+		http.StatusInternalServerError: false,
+	} {
+		mx := sync.Mutex{}
+		aborts := make([]string, 0)
+		abortHandler := func(req *http.Request) (*http.Response, error) {
+			mx.Lock()
+			defer mx.Unlock()
+			aborts = append(aborts, req.Method+" "+req.URL.RequestURI())
+			return &http.Response{Request: req, StatusCode: http.StatusNoContent}, nil
+		}
+		backends := []*StorageClient{createDummyBackend(abortHandler), createDummyBackend(abortHandler)}
+		request := newUploadPartRequest(t, newResettableBody([]byte("part content")), nil)
+		clientMock := replicationClientMock{&mock.Mock{}}
+		partResponses := make(chan BackendResponse, 1)
+		partResponses <- BackendResponse{
+			Request:  request,
+			Response: &http.Response{Request: request, StatusCode: status},
+			Backend:  backends[0],
+		}
+		close(partResponses)
+		clientMock.On("Do", request).Return(partResponses)
+		validator := validatingParts(func([]*StorageClient) client { return clientMock })(backends)
+
+		for bresp := range validator.Do(request) {
+			assert.Equal(t, status, bresp.Response.StatusCode)
+		}
+
+		if shouldAbort {
+			assert.Equal(t, []string{"DELETE /bucket/object?uploadId=u1", "DELETE /bucket/object?uploadId=u1"}, aborts, "status %d", status)
+		} else {
+			assert.Empty(t, aborts, "status %d", status)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package storages
+
+import (
+	"net/http"
+
+	"github.com/allegro/akubra/log"
+)
+
+// isRangeRead reports if GET or HEAD request asks for part of object
+func isRangeRead(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && req.Header.Get("Range") != ""
+}
+
+// attemptRequest returns copy of request with own headers, so every replica
+// asked in turn gets the same headers (and Range) even if previous attempt
+// changed them
+func attemptRequest(req *http.Request) *http.Request {
+	attempt := req.WithContext(req.Context())
+	attempt.Header = make(http.Header, len(req.Header))
+	for name, values := range req.Header {
+		attempt.Header[name] = append([]string(nil), values...)
+	}
+	attemptURL := *req.URL
+	attempt.URL = &attemptURL
+	return attempt
+}
+
+// rangeResponsePicker chooses partial content response over full one, as
+// backend may ignore Range. Ranges of different backends are never merged
+type rangeResponsePicker struct {
+	*ObjectResponsePicker
+}
+
+func newRangeResponsePicker(rch <-chan BackendResponse) responsePicker {
+	return &rangeResponsePicker{newObjectResponsePicker(rch).(*ObjectResponsePicker)}
+}
+
+// Pick returns first partial content response, first successful one if
+// there is none, discards others
+func (rrp *rangeResponsePicker) Pick() (*http.Response, error) {
+	outChan := make(chan BackendResponse)
+	go rrp.pullResponses(outChan)
+	bresp := <-outChan
+	return bresp.Response, bresp.Error
+}
+
+func (rrp *rangeResponsePicker) pullResponses(out chan<- BackendResponse) {
+	for bresp := range rrp.responsesChan {
+		switch {
+		case !bresp.IsSuccessful():
+			rrp.collectFailureResponse(bresp)
+		case rrp.sent:
+			rrp.collectSuccessResponse(bresp)
+		case bresp.Response.StatusCode == http.StatusPartialContent:
+			if rrp.hasSuccessfulResponse() {
+				discardBackendResponse(rrp.success)
+			}
+			rrp.success = bresp
+			rrp.send(out, bresp)
+		default:
+			rrp.collectSuccessResponse(bresp)
+		}
+	}
+	if !rrp.sent && rrp.hasSuccessfulResponse() {
+		rrp.send(out, rrp.success)
+	}
+	if !rrp.sent {
+		rrp.send(out, rrp.failure)
+	}
+	close(out)
+	rrp.syncLogReady <- struct{}{}
+	close(rrp.syncLogReady)
+}
+
+func discardBackendResponse(bresp BackendResponse) {
+	if err := bresp.DiscardBody(); err != nil {
+		log.Debugf("Could not close tuple body: %s", err)
+	}
+}
@@ -0,0 +1,72 @@
+package storages
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chanOfStatuses(statuses ...int) chan BackendResponse {
+	request, _ := http.NewRequest(http.MethodGet, "http://some.domain/bucket/object", nil)
+	request.Header.Set("Range", "bytes=0-9")
+	backend := &StorageClient{Endpoint: *request.URL, Name: "somebackend"}
+	brespChan := make(chan BackendResponse)
+	go func() {
+		for _, status := range statuses {
+			brespChan <- BackendResponse{Response: &http.Response{Request: request, StatusCode: status}, Backend: backend}
+		}
+		close(brespChan)
+	}()
+	return brespChan
+}
+
+func TestRangeResponsePickerShouldPreferPartialContent(t *testing.T) {
+	for _, testCase := range []struct {
+		statuses       []int
+		expectedStatus int
+	}{
+		{[]int{http.StatusOK, http.StatusPartialContent}, http.StatusPartialContent},
+		{[]int{http.StatusPartialContent, http.StatusOK}, http.StatusPartialContent},
+		{[]int{http.StatusServiceUnavailable, http.StatusOK, http.StatusPartialContent}, http.StatusPartialContent},
+		{[]int{http.StatusServiceUnavailable, http.StatusOK}, http.StatusOK},
+		{[]int{http.StatusServiceUnavailable, http.StatusRequestedRangeNotSatisfiable}, http.StatusServiceUnavailable},
+	} {
+		picker := newRangeResponsePicker(chanOfStatuses(testCase.statuses...))
+		go picker.SendSyncLog(nil)
+
+		resp, err := picker.Pick()
+
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expectedStatus, resp.StatusCode, "%v", testCase.statuses)
+	}
+}
+
+func TestRangeReadsShouldAskReplicasInTurnForTheSameRange(t *testing.T) {
+	ranges := []string{}
+	failing := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		// Backend translating request changes its headers
+		req.Header.Set("Range", "bytes=0-")
+		return &http.Response{Request: req, StatusCode: http.StatusServiceUnavailable}, nil
+	})
+	partial := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		return &http.Response{Request: req, StatusCode: http.StatusPartialContent}, nil
+	})
+	unused := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		return &http.Response{Request: req, StatusCode: http.StatusOK}, nil
+	})
+	shard := &ShardClient{backends: []*StorageClient{failing, partial, unused}, requestDispatcher: newDispatcherMock()}
+	req, err := makeGetObjectRequest()
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=10-19")
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, []string{"bytes=10-19", "bytes=10-19"}, ranges)
+}
@@ -3,8 +3,9 @@ package storages
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
-	"sync"
+	"sync/atomic"
 
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/storages/backend"
@@ -27,33 +28,76 @@ func newReplicationClient(backends []*backend.Backend) client {
 
 // Do send request to all given backends
 func (rc *ReplicationClient) Do(request *http.Request) <-chan BackendResponse {
-	responsesChan := make(chan BackendResponse)
-	wg := sync.WaitGroup{}
+	// Buffered, so backends never wait for responses of slower ones to be
+	// consumed
+	responsesChan := make(chan BackendResponse, len(rc.Backends))
+	pending := int32(len(rc.Backends))
+	done := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			close(responsesChan)
+		}
+	}
+	if len(rc.Backends) == 0 {
+		close(responsesChan)
+	}
 	reqIDValue, ok := request.Context().Value(log.ContextreqIDKey).(string)
 	if !ok {
 		reqIDValue = ""
 	}
 	newContext := context.Background()
 	newContextWithValue := context.WithValue(newContext, log.ContextreqIDKey, reqIDValue)
+	if types.IsAnonymousRead(request.Context()) {
+		newContextWithValue = types.WithAnonymousRead(newContextWithValue)
+	}
+	if timings := types.TimingsOf(request.Context()); timings != nil {
+		newContextWithValue = types.WithTimings(newContextWithValue, timings)
+	}
+	if routing := types.RoutingOf(request.Context()); routing != nil {
+		newContextWithValue = types.WithRouting(newContextWithValue, routing)
+	}
 	ctx, cancelFunc := context.WithCancel(newContextWithValue)
 	rc.cancelFunc = cancelFunc
 
-	for _, backend := range rc.Backends {
-		wg.Add(1)
-		go func(backend *StorageClient) {
-			requestWithContext := request.WithContext(ctx)
-			if resetter, ok := request.Body.(types.Resetter); ok {
-				requestWithContext.Body = resetter.Reset()
+	resetter, resettable := request.Body.(types.Resetter)
+	var teedBodies []io.ReadCloser
+	if !resettable && request.Body != nil && request.Body != http.NoBody && len(rc.Backends) > 1 {
+		teedBodies = teeBody(request.Body, len(rc.Backends))
+	}
+	for i, backend := range rc.Backends {
+		requestWithContext := request.WithContext(ctx)
+		if resettable {
+			requestWithContext.Body = resetter.Reset()
+		}
+		if teedBodies != nil {
+			requestWithContext.Body = teedBodies[i]
+		}
+		call := func(backend *StorageClient, request *http.Request) func() {
+			return func() {
+				callBackend(request, backend, responsesChan)
+				done()
+			}
+		}(backend, requestWithContext)
+		if teedBodies != nil {
+			// Teed bodies are read at once, all calls have to run together
+			go call()
+			continue
+		}
+		if !backendCalls.run(request.Context(), call) {
+			if requestWithContext.Body != nil {
+				if err := requestWithContext.Body.Close(); err != nil {
+					log.Debugf("Cannot close request %s body: %s", reqIDValue, err)
+				}
 			}
-			callBackend(requestWithContext, backend, responsesChan)
-			wg.Done()
-		}(backend)
+			responsesChan <- BackendResponse{Error: ErrRequestCanceled, Backend: backend, Request: requestWithContext}
+			done()
+		}
+	}
+	// Each backend got its own body reader, source may be released
+	if resettable {
+		if err := request.Body.Close(); err != nil {
+			log.Debugf("Cannot close request %s body: %s", reqIDValue, err)
+		}
 	}
-
-	go func() {
-		wg.Wait()
-		close(responsesChan)
-	}()
 	return responsesChan
 }
 
@@ -77,6 +121,7 @@ func callBackend(request *http.Request, backend *backend.Backend, backendRespons
 	resp, err := backend.RoundTrip(request)
 	contextErr := request.Context().Err()
 	bresp := BackendResponse{Response: resp, Error: err, Backend: backend, Request: request}
+	verifyChecksum(&bresp, bodyMD5(request))
 
 	select {
 	case <-request.Context().Done():
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -90,6 +91,49 @@ func TestReplicationClientCancelRequest(t *testing.T) {
 
 }
 
+func TestReplicationClientShouldRunCallsOnWorkers(t *testing.T) {
+	pool := &workerPool{jobs: make(chan func())}
+	go pool.work()
+	defer close(pool.jobs)
+	backendCalls = pool
+	defer func() { backendCalls = nil }()
+	inFlight, maxInFlight := int32(0), int32(0)
+	handler := func(req *http.Request) (*http.Response, error) {
+		if current := atomic.AddInt32(&inFlight, 1); current > atomic.LoadInt32(&maxInFlight) {
+			atomic.StoreInt32(&maxInFlight, current)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return successRoundTripper(req)
+	}
+	backends := []*StorageClient{createDummyBackend(handler), createDummyBackend(handler), createDummyBackend(handler)}
+
+	responsesCount := 0
+	for resp := range newReplicationClient(backends).Do(dummyRequest()) {
+		require.NoError(t, resp.Error)
+		responsesCount++
+	}
+
+	require.Equal(t, len(backends), responsesCount)
+	require.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestReplicationClientShouldCancelCallsWaitingForWorker(t *testing.T) {
+	backendCalls = &workerPool{jobs: make(chan func())}
+	defer func() { backendCalls = nil }()
+	backends := []*StorageClient{createDummyBackend(successRoundTripper), createDummyBackend(successRoundTripper)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	responsesCount := 0
+	for resp := range newReplicationClient(backends).Do(dummyRequest().WithContext(ctx)) {
+		require.Equal(t, ErrRequestCanceled, resp.Error)
+		responsesCount++
+	}
+
+	require.Equal(t, len(backends), responsesCount)
+}
+
 func dummyRequest() *http.Request {
 	request, _ := http.NewRequest("GET", "http://example.com", nil)
 	return request
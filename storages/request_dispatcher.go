@@ -33,13 +33,18 @@ func NewRequestDispatcher(backends []*backend.Backend, syncLog *SyncSender) *Req
 func (rd *RequestDispatcher) Dispatch(request *http.Request) (*http.Response, error) {
 	clientFactory := rd.pickClientFactory(request)
 	cli := clientFactory(rd.Backends)
-	respChan := cli.Do(request)
+	respChan := rd.syncLog.audit(request, cli.Do(request))
 	pickerFactory := rd.pickResponsePickerFactory(request)
 	pickr := pickerFactory(respChan)
 	go pickr.SendSyncLog(rd.syncLog)
 	return pickr.Pick()
 }
 
+// isVersionRequest reports if request is addressed to specific object version
+func isVersionRequest(request *http.Request) bool {
+	return request.URL.Query().Get("versionId") != ""
+}
+
 type responsePicker interface {
 	Pick() (*http.Response, error)
 	SendSyncLog(*SyncSender)
@@ -51,6 +56,9 @@ type client interface {
 }
 
 var defaultReplicationClientFactory = func(request *http.Request) func([]*backend.Backend) client {
+	if isUploadPartRequest(request) {
+		return validatingParts(newMultiPartRoundTripper)
+	}
 	if isMultiPartUploadRequest(request) {
 		return newMultiPartRoundTripper
 	}
@@ -58,6 +66,18 @@ var defaultReplicationClientFactory = func(request *http.Request) func([]*backen
 }
 
 var defaultResponsePickerFactory = func(request *http.Request) func(<-chan BackendResponse) responsePicker {
+	if isVersionRequest(request) {
+		return newVersionResponsePicker
+	}
+
+	if isRangeRead(request) {
+		return newRangeResponsePicker
+	}
+
+	if isBucketACLRequest(request) && request.Method == http.MethodPut {
+		return newACLResponsePicker
+	}
+
 	if isBucketPath(request.URL.Path) && (request.Method == http.MethodGet) {
 		return newResponseHandler
 	}
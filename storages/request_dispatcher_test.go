@@ -1,9 +1,17 @@
 package storages
 
 import (
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/allegro/akubra/audit"
+	auditconfig "github.com/allegro/akubra/audit/config"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
@@ -25,10 +33,18 @@ func TestRequestDispatcherPicks(t *testing.T) {
 		_, ok := pic.(*deleteResponsePicker)
 		return ok
 	}
+	matchVersionPicker := func(pic interface{}) bool {
+		_, ok := pic.(*versionResponsePicker)
+		return ok
+	}
 	multipartMultipartReplicator := func(rep interface{}) bool {
 		_, ok := rep.(*MultiPartRoundTripper)
 		return ok
 	}
+	matchPartValidator := func(rep interface{}) bool {
+		validator, ok := rep.(*partValidator)
+		return ok && multipartMultipartReplicator(validator.client)
+	}
 	testCases := []struct {
 		method             string
 		url                string
@@ -41,9 +57,13 @@ func TestRequestDispatcherPicks(t *testing.T) {
 		{"DELETE", "http://some.storage/bucket/object", matchReplicationClient, matchDeletePicker},
 		{"POST", "http://some.storage/bucket/object?uploads", multipartMultipartReplicator, matchObjectResponsePicker},
 		{"POST", "http://some.storage/bucket/object?uploadId=ssssss", multipartMultipartReplicator, matchObjectResponsePicker},
+		{"PUT", "http://some.storage/bucket/object?partNumber=1&uploadId=ssssss", matchPartValidator, matchObjectResponsePicker},
 		{"GET", "http://some.storage/bucket", matchReplicationClient, matchResponseMerger},
 		{"HEAD", "http://some.storage/bucket", matchReplicationClient, matchObjectResponsePicker},
 		{"PUT", "http://some.storage/bucket", matchReplicationClient, matchDeletePicker},
+		{"GET", "http://some.storage/bucket/object?versionId=v1", matchReplicationClient, matchVersionPicker},
+		{"DELETE", "http://some.storage/bucket/object?versionId=v1", matchReplicationClient, matchVersionPicker},
+		{"GET", "http://some.storage/bucket?versions", matchReplicationClient, matchResponseMerger},
 	}
 
 	dispatcher := NewRequestDispatcher(nil, nil)
@@ -129,3 +149,42 @@ func (rpm *responsePickerMock) Pick() (*http.Response, error) {
 	return httpResponse, err
 }
 func (*responsePickerMock) SendSyncLog(*SyncSender) {}
+
+func TestSyncSenderShouldAuditMutatingRequestsAfterAllResponses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.New(auditconfig.Audit{Path: path})
+	require.NoError(t, err)
+	syncSender := &SyncSender{Audit: auditLog}
+
+	request, err := http.NewRequest(http.MethodPut, "http://random.domain/bucket/object", nil)
+	require.NoError(t, err)
+	responses := make(chan BackendResponse, 2)
+	responses <- BackendResponse{Response: &http.Response{StatusCode: http.StatusOK}, Backend: &StorageClient{Name: "first"}, Request: request}
+	responses <- BackendResponse{Error: errors.New("timeout"), Backend: &StorageClient{Name: "second"}, Request: request}
+	close(responses)
+
+	passed := syncSender.audit(request, responses)
+	count := 0
+	for range passed {
+		count++
+	}
+	var content []byte
+	for deadline := time.Now().Add(time.Second); len(content) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		content, err = ioutil.ReadFile(path)
+		require.NoError(t, err)
+	}
+	require.NoError(t, auditLog.Close())
+
+	assert.Equal(t, 2, count)
+	assert.Contains(t, string(content), `"results":[{"backend":"first","status":200},{"backend":"second","error":"timeout"}]`)
+
+	getRequest, err := http.NewRequest(http.MethodGet, "http://random.domain/bucket/object", nil)
+	require.NoError(t, err)
+	assert.Equal(t, (<-chan BackendResponse)(responses), syncSender.audit(getRequest, responses))
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/storages/merger"
+	"github.com/allegro/akubra/types"
 )
 
 const listTypeV2 = "2"
@@ -27,6 +28,9 @@ func isSuccess(response BackendResponse) bool {
 
 func (rm *responseMerger) createResponse(firstResponse BackendResponse, successes []BackendResponse) (resp *http.Response, err error) {
 	reqQuery := firstResponse.Request.URL.Query()
+	if isBucketACLRequest(firstResponse.Request) {
+		return merger.MergeACLResponses(successes)
+	}
 	if rm.isPartiallyMergable(firstResponse.Request) {
 		return merger.MergePartially(firstResponse, successes)
 	}
@@ -85,6 +89,7 @@ var unsupportedQueryParamNames = []string{
 var partialSupportQueryParamNames = []string{"acl",
 	"accelerate",
 	"tags",
+	"tagging",
 	"requestPayment",
 	"replication",
 	"policy",
@@ -97,6 +102,7 @@ var partialSupportQueryParamNames = []string{"acl",
 	"cors",
 	"analytics",
 	"website",
+	"versioning",
 }
 
 func (rm *responseMerger) isMergable(req *http.Request) bool {
@@ -160,10 +166,7 @@ func (rm *responseMerger) Pick() (*http.Response, error) {
 			log.Debugf("Could not close tuple body: %s", err)
 		}
 
-		return &http.Response{
-			Request:    firstTuple.Request,
-			StatusCode: http.StatusNotImplemented,
-		}, nil
+		return types.NewS3ErrorResponseForStatus(firstTuple.Request, http.StatusNotImplemented), nil
 	}
 	result := rm.merge(firstTuple, rm.responsesChannel)
 	return result.Response, result.Error
@@ -15,6 +15,8 @@ type BasePicker struct {
 	failure       BackendResponse
 	errors        []BackendResponse
 	sent          bool
+	// divergent are successful responses with metadata other than success
+	divergent []BackendResponse
 }
 
 func (bp *BasePicker) collectSuccessResponse(bresp BackendResponse) {
@@ -90,6 +92,7 @@ func (orp *ObjectResponsePicker) Pick() (*http.Response, error) {
 func (orp *ObjectResponsePicker) SendSyncLog(syncLog *SyncSender) {
 	for range orp.syncLogReady {
 		sendSynclogs(syncLog, orp.success, orp.errors)
+		syncLog.repair(orp.success, orp.divergent)
 	}
 }
 
@@ -99,6 +102,9 @@ func (orp *ObjectResponsePicker) pullResponses(out chan<- BackendResponse) {
 		success := bresp.IsSuccessful()
 		if success {
 			shouldSend = !orp.hasSuccessfulResponse()
+			if !shouldSend {
+				orp.checkConsistency(bresp)
+			}
 			orp.collectSuccessResponse(bresp)
 		} else {
 			orp.collectFailureResponse(bresp)
@@ -116,6 +122,24 @@ func (orp *ObjectResponsePicker) pullResponses(out chan<- BackendResponse) {
 	close(orp.syncLogReady)
 }
 
+// versionResponsePicker chooses first successful response of request addressed
+// to specific object version. Version ids are generated by each backend, so
+// failures of backends which don't store the version are expected and are
+// not written to synclog
+type versionResponsePicker struct {
+	*ObjectResponsePicker
+}
+
+func newVersionResponsePicker(rch <-chan BackendResponse) responsePicker {
+	return &versionResponsePicker{newObjectResponsePicker(rch).(*ObjectResponsePicker)}
+}
+
+// SendSyncLog implements picker interface
+func (vrp *versionResponsePicker) SendSyncLog(*SyncSender) {
+	for range vrp.syncLogReady {
+	}
+}
+
 type deleteResponsePicker struct {
 	BasePicker
 	softErrors   []BackendResponse
@@ -133,6 +157,18 @@ func (drp *deleteResponsePicker) Pick() (*http.Response, error) {
 func newDeleteResponsePicker(rch <-chan BackendResponse) responsePicker {
 	return &deleteResponsePicker{BasePicker{responsesChan: rch}, []BackendResponse{}, make(chan struct{})}
 }
+func (drp *deleteResponsePicker) collectSuccessResponse(bresp BackendResponse) {
+	if drp.sent && !drp.hasSuccessfulResponse() {
+		// Failure is already sent to client, success is kept for synclog only
+		if err := bresp.DiscardBody(); err != nil {
+			log.Debugf("Could not close tuple body: %s", err)
+		}
+		drp.success = bresp
+		return
+	}
+	drp.BasePicker.collectSuccessResponse(bresp)
+}
+
 func (drp *deleteResponsePicker) collectFailureResponse(bresp BackendResponse) {
 	if bresp.Backend.Maintenance {
 		drp.softErrors = append(drp.softErrors, bresp)
@@ -142,15 +178,14 @@ func (drp *deleteResponsePicker) collectFailureResponse(bresp BackendResponse) {
 }
 
 func (drp *deleteResponsePicker) pullResponses(out chan<- BackendResponse) {
-	shouldSend := false
 	for bresp := range drp.responsesChan {
-		success := bresp.IsSuccessful()
-		if success {
+		if bresp.IsSuccessful() {
 			drp.collectSuccessResponse(bresp)
-		} else {
-			shouldSend = !drp.hasFailureResponse() && !bresp.Backend.Maintenance
-			drp.collectFailureResponse(bresp)
+			continue
 		}
+		// Only the first hard failure is sent, later responses are kept for synclog
+		shouldSend := !drp.sent && !bresp.Backend.Maintenance
+		drp.collectFailureResponse(bresp)
 		if shouldSend {
 			drp.send(out, bresp)
 		}
@@ -167,5 +202,9 @@ func (drp *deleteResponsePicker) pullResponses(out chan<- BackendResponse) {
 // SendSyncLog implements picker interface
 func (drp *deleteResponsePicker) SendSyncLog(syncLog *SyncSender) {
 	<-drp.syncLogReady
+	if syncLog != nil && drp.success != emptyBackendResponse && isObjectDelete(drp.success.Request) {
+		syncLog.recordDelete(drp.success, append(drp.errors, drp.softErrors...))
+		return
+	}
 	sendSynclogs(syncLog, drp.success, drp.softErrors)
 }
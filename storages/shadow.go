@@ -0,0 +1,53 @@
+package storages
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+// mirrorToShadows sends copy of request to shadow storages of shard. Shadow
+// responses never reach client nor synclog, failures are logged only
+func (c *ShardClient) mirrorToShadows(req *http.Request) {
+	if len(c.shadows) == 0 {
+		return
+	}
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	resetter, resettable := req.Body.(types.Resetter)
+	if !resettable && req.Body != nil && req.Body != http.NoBody {
+		// Streamed body is read once by primary storages
+		log.Debugf("Request %s not mirrored to shadow storages, body is not spooled", reqID)
+		metrics.Mark("reqs.shadow.skipped")
+		return
+	}
+	ctx := context.WithValue(context.Background(), log.ContextreqIDKey, reqID)
+	if types.IsAnonymousRead(req.Context()) {
+		ctx = types.WithAnonymousRead(ctx)
+	}
+	for _, shadow := range c.shadows {
+		shadowReq := attemptRequest(req).WithContext(ctx)
+		if resettable {
+			shadowReq.Body = resetter.Reset()
+		}
+		go shadowRoundTrip(shadow, shadowReq)
+	}
+}
+
+func shadowRoundTrip(shadow *StorageClient, req *http.Request) {
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	resp, err := shadow.RoundTrip(req)
+	switch {
+	case err != nil:
+		log.Printf("Shadow storage %s failed request %s %s: %s", shadow.Name, reqID, req.URL.Path, err)
+		metrics.Mark("reqs.shadow." + metrics.Clean(shadow.Name) + ".err")
+	case resp.StatusCode >= http.StatusInternalServerError:
+		log.Printf("Shadow storage %s responded %d to request %s %s", shadow.Name, resp.StatusCode, reqID, req.URL.Path)
+		metrics.Mark("reqs.shadow." + metrics.Clean(shadow.Name) + ".err")
+	}
+	if resp != nil {
+		discardResponse(resp)
+	}
+}
@@ -0,0 +1,70 @@
+package storages
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/spool"
+	spoolconfig "github.com/allegro/akubra/spool/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowStorageShouldGetCopyOfRequestButNotAnswer(t *testing.T) {
+	primary := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{Request: req, StatusCode: http.StatusOK}, nil
+	})
+	mirrored := make(chan *http.Request, 1)
+	shadow := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		mirrored <- req
+		return &http.Response{Request: req, StatusCode: http.StatusServiceUnavailable}, nil
+	})
+	shadow.Shadow = true
+	shard, err := newShard("shard", []string{"primary", "shadow"},
+		map[string]*StorageClient{"primary": primary, "shadow": shadow}, nil)
+	require.NoError(t, err)
+	req, err := makeGetObjectRequest()
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=0-9")
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []*StorageClient{primary}, shard.Backends())
+	select {
+	case shadowReq := <-mirrored:
+		assert.Equal(t, "/testbucket/testkey", shadowReq.URL.Path)
+		assert.Equal(t, "bytes=0-9", shadowReq.Header.Get("Range"))
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored to shadow storage")
+	}
+}
+
+func TestShadowStorageShouldGetCopyOfSpooledBody(t *testing.T) {
+	mirrored := make(chan string, 1)
+	shadow := createDummyBackend(func(req *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		mirrored <- string(body)
+		return &http.Response{Request: req, StatusCode: http.StatusOK}, nil
+	})
+	shard := &ShardClient{shadows: []*StorageClient{shadow}}
+	body, err := spool.New(spoolconfig.Spooling{}).Spool(strings.NewReader("content"))
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	req.Body = body
+
+	shard.mirrorToShadows(req)
+
+	select {
+	case body := <-mirrored:
+		assert.Equal(t, "content", body)
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored to shadow storage")
+	}
+}
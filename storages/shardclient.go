@@ -6,6 +6,9 @@ import (
 
 	"github.com/allegro/akubra/balancing"
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/types"
 
 	set "github.com/deckarep/golang-set"
 )
@@ -15,6 +18,7 @@ type NamedShardClient interface {
 	http.RoundTripper
 	Name() string
 	Backends() []*StorageClient
+	StreamsBody() bool
 }
 
 // ShardClient stores information about cluster backends
@@ -25,21 +29,73 @@ type ShardClient struct {
 	MethodSet         set.Set
 	requestDispatcher dispatcher
 	balancer          *balancing.BalancerPrioritySet
+	streamBody        bool
+	// shadows get copy of requests, their responses are ignored
+	shadows []*StorageClient
+	// methodPolicies overrides default routing of methods, see config.Shard
+	methodPolicies map[string]string
+	// bucketAliases maps client bucket names to backend bucket names
+	bucketAliases map[string]string
 }
 
 // RoundTrip implements http.RoundTripper interface
 func (c *ShardClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	if alias, ok := c.bucketAliasOf(req); ok {
+		return c.aliasedRoundTrip(req, alias)
+	}
+	return c.roundTrip(req)
+}
+
+func (c *ShardClient) roundTrip(req *http.Request) (*http.Response, error) {
 
 	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
 	log.Debugf("Shard: Got request id %s", reqID)
+	if c.synclog.isTombstoned(req) {
+		log.Debugf("Request %s suppressed, object %s is not deleted on all backends yet", reqID, req.URL.Path)
+		metrics.Mark("reqs.tombstones.suppressed")
+		return types.NewS3ErrorResponse(req, http.StatusNotFound, types.S3ErrNoSuchKey, "The specified key does not exist."), nil
+	}
+	c.mirrorToShadows(req)
+	if isConditionalRead(req) && len(c.backends) > 0 {
+		return c.ownerRoundTrip(req)
+	}
+	if isRangeRead(req) && c.balancer == nil && len(c.backends) > 0 {
+		// Range is read from single replica, parts of replicas are never merged
+		return c.ownerRoundTrip(req)
+	}
+	switch c.methodPolicy(req) {
+	case config.SingleBackend:
+		if c.balancer == nil {
+			return c.ownerRoundTrip(req)
+		}
+		return c.balancerRoundTrip(req)
+	case config.ReplicateRequest, config.AggregateResponses:
+		return c.dispatch(req)
+	}
 	if c.balancer != nil && (req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions) {
 		resp, err := c.balancerRoundTrip(req)
 		log.Debugf("Request %s, processed by balancer error %s", reqID, err)
 		return resp, err
 
 	}
+	return c.dispatch(req)
+}
+
+func (c *ShardClient) dispatch(req *http.Request) (*http.Response, error) {
 	log.Debug("Request %s processed by dispatcher, reqId")
-	return c.requestDispatcher.Dispatch(req)
+	resp, err := c.requestDispatcher.Dispatch(req)
+	c.synclog.clearTombstone(req, resp)
+	return resp, err
+}
+
+// methodPolicy returns routing policy configured for request method, bucket
+// listings are configured as LIST. Empty policy means default routing
+func (c *ShardClient) methodPolicy(req *http.Request) string {
+	method := req.Method
+	if method == http.MethodGet && isBucketPath(req.URL.Path) {
+		method = config.ListMethod
+	}
+	return c.methodPolicies[method]
 }
 
 func (c *ShardClient) balancerRoundTrip(req *http.Request) (resp *http.Response, err error) {
@@ -52,7 +108,7 @@ func (c *ShardClient) balancerRoundTrip(req *http.Request) (resp *http.Response,
 		if node == nil {
 			return nil, fmt.Errorf("no available node")
 		}
-		resp, err = node.RoundTrip(req)
+		resp, err = node.RoundTrip(attemptRequest(req))
 		if (resp == nil && err != balancing.ErrNoActiveNodes) || resp.StatusCode == http.StatusNotFound {
 			notFoundNodes = append(notFoundNodes, node)
 			continue
@@ -67,6 +123,11 @@ func (c *ShardClient) Name() string {
 	return c.name
 }
 
+// StreamsBody reports if request bodies should be streamed to backends instead of buffered
+func (c *ShardClient) StreamsBody() bool {
+	return c.streamBody
+}
+
 // TODO: rename to storages
 
 // Backends get http.RoundTripper slice
@@ -76,14 +137,19 @@ func (c *ShardClient) Backends() []*StorageClient {
 
 func newShard(name string, storageNames []string, storages map[string]*StorageClient, synclog *SyncSender) (*ShardClient, error) {
 	shardStorages := make([]*StorageClient, 0)
+	shadowStorages := make([]*StorageClient, 0)
 	for _, storageName := range storageNames {
 		backendRT, ok := storages[storageName]
 		if !ok {
 			return nil, fmt.Errorf("no such storage %q in 'storages::newShard'", storageName)
 		}
+		if backendRT.Shadow {
+			shadowStorages = append(shadowStorages, backendRT)
+			continue
+		}
 		shardStorages = append(shardStorages, backendRT)
 	}
-	log.Debugf("Shard %s storages %v", name, shardStorages)
-	cluster := &ShardClient{backends: shardStorages, name: name, requestDispatcher: NewRequestDispatcher(shardStorages, synclog), synclog: synclog}
+	log.Debugf("Shard %s storages %v, shadow storages %v", name, shardStorages, shadowStorages)
+	cluster := &ShardClient{backends: shardStorages, shadows: shadowStorages, name: name, requestDispatcher: NewRequestDispatcher(shardStorages, synclog), synclog: synclog}
 	return cluster, nil
 }
@@ -6,8 +6,11 @@ import (
 	"testing"
 
 	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/storages/config"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -87,3 +90,46 @@ func (trt *dispatcherMock) Dispatch(request *http.Request) (*http.Response, erro
 func newDispatcherMock() dispatcher {
 	return &dispatcherMock{mock.Mock{}}
 }
+
+func TestMethodPoliciesShouldRouteReadsToSingleBackend(t *testing.T) {
+	called := []string{}
+	backend := func(name string) *StorageClient {
+		return createDummyBackend(func(req *http.Request) (*http.Response, error) {
+			called = append(called, name)
+			return &http.Response{Request: req, StatusCode: http.StatusOK}, nil
+		})
+	}
+	shard := &ShardClient{
+		backends:          []*StorageClient{backend("first"), backend("second")},
+		requestDispatcher: newDispatcherMock(),
+		methodPolicies:    map[string]string{http.MethodGet: config.SingleBackend},
+	}
+	req, err := makeGetObjectRequest()
+	require.NoError(t, err)
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"first"}, called)
+}
+
+func TestMethodPoliciesShouldAggregateListingsSeparatelyFromObjectReads(t *testing.T) {
+	shard := &ShardClient{
+		requestDispatcher: newDispatcherMock(),
+		methodPolicies: map[string]string{
+			http.MethodGet:    config.SingleBackend,
+			config.ListMethod: config.AggregateResponses,
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/testbucket", nil)
+	require.NoError(t, err)
+	dispatchMock := shard.requestDispatcher.(*dispatcherMock)
+	dispatchMock.On("Dispatch", req).Return(makeSuccessfulResponse(req, http.StatusOK), nil)
+
+	resp, err := shard.RoundTrip(req)
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	dispatchMock.AssertNumberOfCalls(t, "Dispatch", 1)
+}
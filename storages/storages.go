@@ -5,11 +5,13 @@ import (
 	"net/http"
 
 	"github.com/allegro/akubra/balancing"
+	"github.com/allegro/akubra/crdstore"
 
 	"github.com/allegro/akubra/httphandler"
 	"github.com/allegro/akubra/log"
 
 	"github.com/allegro/akubra/storages/auth"
+	"github.com/allegro/akubra/storages/backend"
 	"github.com/allegro/akubra/storages/config"
 	"github.com/allegro/akubra/storages/merger"
 )
@@ -51,6 +53,11 @@ func (st *Storages) MergeShards(name string, clusters ...NamedShardClient) Named
 		for _, backend := range cluster.Backends() {
 			backendsNames = append(backendsNames, backend.Name)
 		}
+		if shard, ok := cluster.(*ShardClient); ok {
+			for _, shadow := range shard.shadows {
+				backendsNames = append(backendsNames, shadow.Name)
+			}
+		}
 	}
 	log.Debugf("Backend names %v\n", backendsNames)
 	sCluster, err := newShard(name, backendsNames, st.Backends, st.syncLog)
@@ -61,9 +68,10 @@ func (st *Storages) MergeShards(name string, clusters ...NamedShardClient) Named
 	return sCluster
 }
 
-// InitStorages setups storages
+// InitStorages setups storages, backends get credentials from
+// credentialsStores
 func InitStorages(transport http.RoundTripper, clustersConf config.ShardsMap,
-	storagesMap config.StoragesMap, syncLog *SyncSender) (*Storages, error) {
+	storagesMap config.StoragesMap, credentialsStores crdstore.Stores, syncLog *SyncSender) (*Storages, error) {
 	shards := make(map[string]NamedShardClient)
 	storageClients := make(map[string]*StorageClient)
 
@@ -75,7 +83,7 @@ func InitStorages(transport http.RoundTripper, clustersConf config.ShardsMap,
 		if storage.Maintenance {
 			log.Printf("storage %q in maintenance mode", name)
 		}
-		decoratedBackend, err := decorateBackend(transport, name, storage)
+		decoratedBackend, err := decorateBackend(transport, name, storage, credentialsStores)
 		if err != nil {
 			return nil, err
 		}
@@ -88,10 +96,13 @@ func InitStorages(transport http.RoundTripper, clustersConf config.ShardsMap,
 
 	for name, clusterConf := range clustersConf {
 		cluster, err := newShard(name, storageNames(clusterConf), storageClients, syncLog)
-		cluster.balancer = balancing.NewBalancerPrioritySet(clusterConf.Storages, convertToRoundTrippersMap(storageClients))
 		if err != nil {
 			return nil, err
 		}
+		cluster.balancer = balancing.NewBalancerPrioritySet(primaryStorages(clusterConf, storagesMap), convertToRoundTrippersMap(storageClients))
+		cluster.streamBody = clusterConf.BodyMode == config.StreamBody
+		cluster.methodPolicies = clusterConf.MethodPolicies
+		cluster.bucketAliases = clusterConf.BucketAliases
 		shards[name] = cluster
 	}
 
@@ -112,6 +123,18 @@ func convertToRoundTrippersMap(backends map[string]*StorageClient) map[string]ht
 	return newMap
 }
 
+// primaryStorages returns shard storages without shadow ones, which never
+// serve reads
+func primaryStorages(conf config.Shard, storagesMap config.StoragesMap) config.Storages {
+	primaries := make(config.Storages, 0, len(conf.Storages))
+	for _, storageConfig := range conf.Storages {
+		if !storagesMap[storageConfig.Name].Shadow {
+			primaries = append(primaries, storageConfig)
+		}
+	}
+	return primaries
+}
+
 func storageNames(conf config.Shard) []string {
 	names := make([]string, 0)
 	for _, storageConfig := range conf.Storages {
@@ -120,23 +143,43 @@ func storageNames(conf config.Shard) []string {
 	return names
 }
 
-func decorateBackend(transport http.RoundTripper, name string, storageDef config.Storage) (*StorageClient, error) {
+func decorateBackend(transport http.RoundTripper, name string, storageDef config.Storage, credentialsStores crdstore.Stores) (*StorageClient, error) {
 
 	errPrefix := fmt.Sprintf("initialization of backend '%s' resulted with error", name)
 	decoratorFactory, ok := auth.Decorators[storageDef.Type]
 	if !ok {
 		return nil, fmt.Errorf("%s: no decorator defined for type '%s'", errPrefix, storageDef.Type)
 	}
-	decorator, err := decoratorFactory(name, storageDef)
+	decorator, err := decoratorFactory(name, storageDef, credentialsStores)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %q", errPrefix, err)
 	}
+	transport, err = backendTransport(transport, name, storageDef)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %q", errPrefix, err)
+	}
+	transport = newFaultInjector(name, transport, storageDef.Faults)
+	transport = newBackendQueue(name, transport, storageDef.Queue)
 
+	capabilities := backend.NewCapabilities(auth.TypeCapabilities[storageDef.Type], schemeCapabilities(storageDef), storageDef.Capabilities)
 	backend := &StorageClient{
-		RoundTripper: httphandler.Decorate(transport, decorator, merger.ListV2Interceptor),
-		Endpoint:     *storageDef.Backend.URL,
-		Name:         name,
-		Maintenance:  storageDef.Maintenance,
+		RoundTripper:            httphandler.Decorate(transport, decorator, merger.ListV2Interceptor),
+		Endpoint:                *storageDef.Backend.URL,
+		Name:                    name,
+		Maintenance:             storageDef.Maintenance,
+		Shadow:                  storageDef.Shadow,
+		PreserveAddressingStyle: storageDef.PreservesAddressingStyle(),
+		Capabilities:            capabilities,
+		SSE:                     storageDef.SSE,
 	}
 	return backend, nil
 }
+
+// schemeCapabilities disables SSE-C for plain http backends, customer keys
+// are sent over them only if declared explicitly
+func schemeCapabilities(storageDef config.Storage) map[string]bool {
+	if storageDef.Backend.URL != nil && storageDef.Backend.Scheme == "https" {
+		return nil
+	}
+	return map[string]bool{config.CapabilitySSECustomerKey: false}
+}
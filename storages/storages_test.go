@@ -1,12 +1,21 @@
 package storages
 
 import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"net/url"
 
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/s3mem"
 	"github.com/allegro/akubra/storages/config"
+	"github.com/allegro/akubra/storages/merger/s3datatypes"
 	"github.com/allegro/akubra/types"
 
 	"github.com/stretchr/testify/require"
@@ -67,9 +76,89 @@ func TestShouldNotInitStoragesWithWrongBackendType(t *testing.T) {
 		Type:        backendType,
 	}}
 
-	_, err := InitStorages(http.DefaultTransport, clustersConf, storagesMap, nil)
+	_, err := InitStorages(http.DefaultTransport, clustersConf, storagesMap, nil, nil)
 
 	require.Error(t, err)
 	require.Contains(t, err.Error(),
 		"initialization of backend 'backend1' resulted with error: no decorator defined for type 'unknown'")
 }
+
+func newInMemoryShard(t *testing.T, servers s3mem.Transport) NamedShardClient {
+	storagesMap := config.StoragesMap{}
+	shardConf := config.Shard{MethodPolicies: map[string]string{config.ListMethod: config.AggregateResponses}}
+	for host := range servers {
+		storagesMap[host] = config.Storage{
+			Backend: types.YAMLUrl{URL: &url.URL{Scheme: "http", Host: host}},
+			Type:    config.Passthrough,
+		}
+		shardConf.Storages = append(shardConf.Storages, config.StorageBreakerProperties{Name: host})
+	}
+	storages, err := InitStorages(servers, config.ShardsMap{"shard": shardConf}, storagesMap, nil, nil)
+	require.NoError(t, err)
+	shard, err := storages.GetShard("shard")
+	require.NoError(t, err)
+	return shard
+}
+
+// eventually polls condition, replicas may be written after response of the
+// first one is picked
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+func shardRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, "http://akubra"+path, strings.NewReader(body))
+	return req.WithContext(context.WithValue(context.Background(), log.ContextreqIDKey, "testid"))
+}
+
+func TestShardShouldReplicateObjectsToAllStorages(t *testing.T) {
+	first, second := s3mem.New(), s3mem.New()
+	first.CreateBucket("bucket")
+	second.CreateBucket("bucket")
+	shard := newInMemoryShard(t, s3mem.Transport{"first:9000": first, "second:9000": second})
+
+	resp, err := shard.RoundTrip(shardRequest(http.MethodPut, "/bucket/key", "data"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, server := range []*s3mem.Server{first, second} {
+		require.True(t, eventually(func() bool {
+			data, ok := server.Object("bucket", "key")
+			return ok && string(data) == "data"
+		}))
+	}
+
+	resp, err = shard.RoundTrip(shardRequest(http.MethodDelete, "/bucket/key", ""))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, first.Keys("bucket"))
+	require.Empty(t, second.Keys("bucket"))
+}
+
+func TestShardShouldMergeListingsOfAllStorages(t *testing.T) {
+	first, second := s3mem.New(), s3mem.New()
+	first.PutObject("bucket", "a", []byte("a"))
+	first.PutObject("bucket", "b", []byte("b"))
+	second.PutObject("bucket", "b", []byte("b"))
+	second.PutObject("bucket", "c", []byte("c"))
+	shard := newInMemoryShard(t, s3mem.Transport{"first:9000": first, "second:9000": second})
+
+	resp, err := shard.RoundTrip(shardRequest(http.MethodGet, "/bucket", ""))
+
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	result := s3datatypes.ListBucketResult{}
+	require.NoError(t, xml.Unmarshal(body, &result))
+	keys := []string{}
+	for _, object := range result.Contents {
+		keys = append(keys, object.Key)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, keys)
+}
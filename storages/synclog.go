@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/allegro/akubra/audit"
 	"github.com/allegro/akubra/httphandler"
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/metrics"
@@ -17,6 +19,15 @@ import (
 type SyncSender struct {
 	AllowedMethods map[string]struct{}
 	SyncLog        log.Logger
+	// Tombstones tracks objects deleted on part of backends, nil disables
+	// read suppression
+	Tombstones *Tombstones
+	// ReadRepair enables writing objects which metadata differs among
+	// backends to synclog
+	ReadRepair bool
+	// Audit records outcome of mutating requests on each backend, nil
+	// disables auditing
+	Audit *audit.Log
 }
 
 func (slf SyncSender) shouldResponseBeLogged(bresp BackendResponse) bool {
@@ -39,30 +50,132 @@ func (slf SyncSender) send(success, failure BackendResponse) {
 		return
 	}
 
-	errorMsg := emptyStrOrErrorMsg(failure.Error)
-	contentLength := success.Response.ContentLength
-	reqID := utils.RequestID(success.Request)
+	metrics.Mark(fmt.Sprintf("reqs.inconsistencies.%s.method-%s", metrics.Clean(failure.Backend.Endpoint.Host), success.Request.Method))
+	slf.write(newSyncLogMessage(success, failure))
+}
+
+// recordDelete tracks outcome of object delete. Delete successful on all
+// backends clears tombstone of the object, partially failed one sets it and
+// is written to synclog with tombstone flag for each failed backend, so the
+// replayer propagates it instead of resurrecting the object
+func (slf SyncSender) recordDelete(success BackendResponse, failures []BackendResponse) {
+	if success == emptyBackendResponse {
+		return
+	}
+	path := success.Request.URL.Path
+	if len(failures) == 0 {
+		if slf.Tombstones != nil {
+			slf.Tombstones.Remove(path)
+		}
+		return
+	}
+	if slf.Tombstones != nil {
+		slf.Tombstones.Add(path)
+		metrics.UpdateGauge("reqs.tombstones.count", int64(slf.Tombstones.Len()))
+	}
+	if slf.SyncLog == nil {
+		return
+	}
+	for _, failure := range failures {
+		syncLogMsg := newSyncLogMessage(success, failure)
+		syncLogMsg.Tombstone = true
+		slf.write(syncLogMsg)
+		metrics.Mark(fmt.Sprintf("reqs.tombstones.%s", metrics.Clean(extractDestinationHostName(failure))))
+	}
+}
+
+// isTombstoned reports if object read should be suppressed, because object was
+// not deleted on all backends yet
+func (slf *SyncSender) isTombstoned(req *http.Request) bool {
+	if slf == nil || slf.Tombstones == nil {
+		return false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if isVersionRequest(req) {
+		return false
+	}
+	return isObjectPath(req.URL.Path) && slf.Tombstones.Has(req.URL.Path)
+}
+
+// clearTombstone drops tombstone of object written again after delete
+func (slf *SyncSender) clearTombstone(req *http.Request, resp *http.Response) {
+	if slf == nil || slf.Tombstones == nil || resp == nil || resp.StatusCode >= http.StatusMultipleChoices {
+		return
+	}
+	createsObject := (req.Method == http.MethodPut && !containsUploadID(req)) ||
+		(req.Method == http.MethodPost && containsUploadID(req))
+	if createsObject {
+		slf.Tombstones.Remove(req.URL.Path)
+	}
+}
 
-	syncLogMsg := &httphandler.SyncLogMessageData{
+// audit passes responses through, when all of them are received outcome of
+// mutating request is written to audit log
+func (slf *SyncSender) audit(req *http.Request, responses <-chan BackendResponse) <-chan BackendResponse {
+	if slf == nil || slf.Audit == nil || !audit.IsMutation(req) {
+		return responses
+	}
+	record := audit.NewRecord(req, utils.RequestID(req), utils.ExtractAccessKey(req))
+	passed := make(chan BackendResponse, cap(responses))
+	go func() {
+		for bresp := range responses {
+			record.Results = append(record.Results, newBackendResult(bresp))
+			passed <- bresp
+		}
+		close(passed)
+		slf.Audit.Write(record)
+	}()
+	return passed
+}
+
+func newBackendResult(bresp BackendResponse) audit.BackendResult {
+	result := audit.BackendResult{Backend: extractDestinationHostName(bresp)}
+	if bresp.Backend != nil && bresp.Backend.Name != "" {
+		result.Backend = bresp.Backend.Name
+	}
+	if bresp.Response != nil {
+		result.Status = bresp.Response.StatusCode
+	}
+	if bresp.Error != nil {
+		result.Error = bresp.Error.Error()
+	}
+	return result
+}
+
+func (slf SyncSender) write(syncLogMsg *httphandler.SyncLogMessageData) {
+	logMsg, err := json.Marshal(syncLogMsg)
+	if err != nil {
+		log.Debugf("Marshall synclog error %s", err)
+		return
+	}
+	slf.SyncLog.Println(string(logMsg))
+}
+
+func newSyncLogMessage(success, failure BackendResponse) *httphandler.SyncLogMessageData {
+	return &httphandler.SyncLogMessageData{
 		Method:        success.Request.Method,
 		FailedHost:    extractDestinationHostName(failure),
 		SuccessHost:   extractDestinationHostName(success),
 		Path:          success.Request.URL.Path,
 		AccessKey:     utils.ExtractAccessKey(success.Request),
 		UserAgent:     success.Request.Header.Get("User-Agent"),
-		ContentLength: contentLength,
-		ErrorMsg:      errorMsg,
-		ReqID:         reqID,
+		ContentLength: success.Response.ContentLength,
+		ErrorMsg:      emptyStrOrErrorMsg(failure.Error),
+		ReqID:         utils.RequestID(success.Request),
 		Time:          time.Now().Format(time.RFC3339Nano),
 	}
+}
 
-	metrics.Mark(fmt.Sprintf("reqs.inconsistencies.%s.method-%s", metrics.Clean(failure.Backend.Endpoint.Host), success.Request.Method))
-	logMsg, err := json.Marshal(syncLogMsg)
-	if err != nil {
-		log.Debugf("Marshall synclog error %s", err)
-		return
-	}
-	slf.SyncLog.Println(string(logMsg))
+// isObjectDelete reports if request deletes whole object, version and
+// multipart upload deletes don't remove other data of the key
+func isObjectDelete(req *http.Request) bool {
+	return req != nil && req.Method == http.MethodDelete && req.URL.RawQuery == "" && isObjectPath(req.URL.Path)
+}
+
+func isObjectPath(path string) bool {
+	return strings.Contains(strings.Trim(path, "/"), "/")
 }
 
 func sendSynclogs(syncLog *SyncSender, success BackendResponse, failures []BackendResponse) {
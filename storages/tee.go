@@ -0,0 +1,102 @@
+package storages
+
+import (
+	"io"
+	"sync"
+
+	"github.com/allegro/akubra/metrics"
+)
+
+const teeChunkSize = 32 * 1024
+
+// teeBufferPool has no New function, so misses can be counted
+var teeBufferPool = sync.Pool{}
+
+// getTeeBuffer takes buffer from pool, hits and misses are counted in
+// tee.buffers.hit and tee.buffers.miss meters
+func getTeeBuffer() []byte {
+	if buf, ok := teeBufferPool.Get().([]byte); ok {
+		metrics.Mark("tee.buffers.hit")
+		return buf
+	}
+	metrics.Mark("tee.buffers.miss")
+	return make([]byte, teeChunkSize)
+}
+
+// teeBody returns n readers of body. Body is read once, each chunk is written
+// to all readers simultaneously. Reader closed by its consumer (e.g. after
+// backend failure) stops receiving data, remaining readers are not affected.
+// Body is not read until first read of any reader, so it's never read if all
+// backends reject request before accepting body (Expect: 100-continue).
+func teeBody(body io.Reader, n int) []io.ReadCloser {
+	readers := make([]io.ReadCloser, n)
+	writers := make([]*io.PipeWriter, n)
+	pump := &sync.Once{}
+	start := func() {
+		pump.Do(func() { go pumpBody(body, writers) })
+	}
+	for i := range readers {
+		var reader *io.PipeReader
+		reader, writers[i] = io.Pipe()
+		readers[i] = &teeReader{PipeReader: reader, start: start}
+	}
+	return readers
+}
+
+// teeReader starts pumping body on first read
+type teeReader struct {
+	*io.PipeReader
+	start func()
+}
+
+func (tr *teeReader) Read(p []byte) (int, error) {
+	tr.start()
+	return tr.PipeReader.Read(p)
+}
+
+func pumpBody(body io.Reader, writers []*io.PipeWriter) {
+	buf := getTeeBuffer()
+	// all writes are complete before pumpBody returns
+	defer teeBufferPool.Put(buf)
+	for len(writers) > 0 {
+		n, err := body.Read(buf)
+		if n > 0 {
+			writers = writeAll(writers, buf[:n])
+		}
+		if err == io.EOF {
+			for _, writer := range writers {
+				_ = writer.Close()
+			}
+			return
+		}
+		if err != nil {
+			for _, writer := range writers {
+				_ = writer.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// writeAll writes p to all writers and returns the ones which accepted it
+func writeAll(writers []*io.PipeWriter, p []byte) []*io.PipeWriter {
+	failed := make([]bool, len(writers))
+	wg := sync.WaitGroup{}
+	for i, writer := range writers {
+		wg.Add(1)
+		go func(i int, writer *io.PipeWriter) {
+			defer wg.Done()
+			if _, err := writer.Write(p); err != nil {
+				failed[i] = true
+			}
+		}(i, writer)
+	}
+	wg.Wait()
+	active := writers[:0]
+	for i, writer := range writers {
+		if !failed[i] {
+			active = append(active, writer)
+		}
+	}
+	return active
+}
@@ -0,0 +1,72 @@
+package storages
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeBodyShouldDeliverWholeBodyToEachReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10*1024)
+	readers := teeBody(bytes.NewReader(content), 3)
+
+	wg := sync.WaitGroup{}
+	for _, reader := range readers {
+		wg.Add(1)
+		go func(reader io.ReadCloser) {
+			defer wg.Done()
+			read, err := ioutil.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, content, read)
+		}(reader)
+	}
+	wg.Wait()
+}
+
+func TestTeeBodyShouldNotBeAffectedByClosedReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10*1024)
+	readers := teeBody(bytes.NewReader(content), 2)
+
+	_, err := io.ReadFull(readers[0], make([]byte, 100))
+	require.NoError(t, err)
+	require.NoError(t, readers[0].Close())
+
+	read, err := ioutil.ReadAll(readers[1])
+	require.NoError(t, err)
+	assert.Equal(t, content, read)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("client disconnected")
+}
+
+func TestTeeBodyShouldPassSourceErrorToAllReaders(t *testing.T) {
+	readers := teeBody(failingReader{}, 2)
+
+	for _, reader := range readers {
+		_, err := ioutil.ReadAll(reader)
+		assert.EqualError(t, err, "client disconnected")
+	}
+}
+
+func TestTeeBodyShouldNotReadBodyBeforeFirstRead(t *testing.T) {
+	body := bytes.NewBufferString("content")
+	readers := teeBody(body, 2)
+
+	require.NoError(t, readers[0].Close())
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, len("content"), body.Len())
+
+	read, err := ioutil.ReadAll(readers[1])
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(read))
+}
@@ -0,0 +1,81 @@
+package storages
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTombstonesTTL is used if no ttl is configured
+const DefaultTombstonesTTL = time.Hour
+
+// Tombstones keeps paths of objects deleted on part of backends only. Until
+// the delete is propagated to remaining backends they still may serve such
+// objects, so reads of tombstoned paths are answered with NoSuchKey
+type Tombstones struct {
+	mx        sync.Mutex
+	entries   map[string]time.Time
+	ttl       time.Duration
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewTombstones creates Tombstones, entries expire after ttl, it should be
+// long enough for synclog replayer to propagate deletes
+func NewTombstones(ttl time.Duration) *Tombstones {
+	if ttl <= 0 {
+		ttl = DefaultTombstonesTTL
+	}
+	return &Tombstones{entries: make(map[string]time.Time), ttl: ttl, now: time.Now}
+}
+
+// Add marks path as deleted
+func (t *Tombstones) Add(path string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	now := t.now()
+	t.sweep(now)
+	t.entries[path] = now.Add(t.ttl)
+}
+
+// Remove clears tombstone of path, once delete is fully propagated or object
+// is written again
+func (t *Tombstones) Remove(path string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	delete(t.entries, path)
+}
+
+// Has reports if path has unexpired tombstone
+func (t *Tombstones) Has(path string) bool {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	expires, ok := t.entries[path]
+	if !ok {
+		return false
+	}
+	if !t.now().Before(expires) {
+		delete(t.entries, path)
+		return false
+	}
+	return true
+}
+
+// Len returns number of tombstones, including expired ones not swept yet
+func (t *Tombstones) Len() int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return len(t.entries)
+}
+
+// sweep drops expired entries at most once per ttl
+func (t *Tombstones) sweep(now time.Time) {
+	if now.Before(t.nextSweep) {
+		return
+	}
+	for path, expires := range t.entries {
+		if !now.Before(expires) {
+			delete(t.entries, path)
+		}
+	}
+	t.nextSweep = now.Add(t.ttl)
+}
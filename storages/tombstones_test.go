@@ -0,0 +1,154 @@
+package storages
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncLogRecorder struct {
+	log.Logger
+	lines []string
+}
+
+func (slr *syncLogRecorder) Println(v ...interface{}) {
+	slr.lines = append(slr.lines, fmt.Sprint(v...))
+}
+
+func TestTombstonesShouldExpire(t *testing.T) {
+	now := time.Now()
+	tombstones := NewTombstones(time.Minute)
+	tombstones.now = func() time.Time { return now }
+
+	tombstones.Add("/bucket/key")
+	assert.True(t, tombstones.Has("/bucket/key"))
+	assert.False(t, tombstones.Has("/bucket/other"))
+
+	now = now.Add(time.Minute)
+	assert.False(t, tombstones.Has("/bucket/key"))
+	assert.Equal(t, 0, tombstones.Len())
+}
+
+func TestTombstonesShouldSweepExpiredEntries(t *testing.T) {
+	now := time.Now()
+	tombstones := NewTombstones(time.Minute)
+	tombstones.now = func() time.Time { return now }
+
+	tombstones.Add("/bucket/first")
+	now = now.Add(time.Minute)
+	tombstones.Add("/bucket/second")
+
+	assert.Equal(t, 1, tombstones.Len())
+	assert.True(t, tombstones.Has("/bucket/second"))
+}
+
+func TestPartiallyFailedDeleteShouldBeLoggedWithTombstone(t *testing.T) {
+	for _, order := range [][]bool{{true, false}, {false, true}} {
+		recorder := &syncLogRecorder{}
+		syncLog := &SyncSender{SyncLog: recorder, Tombstones: NewTombstones(time.Minute)}
+
+		picker := newDeleteResponsePicker(deleteResponses(t, "/bucket/key", order...))
+		_, err := picker.Pick()
+		require.Error(t, err)
+		picker.SendSyncLog(syncLog)
+
+		assert.True(t, syncLog.Tombstones.Has("/bucket/key"))
+		require.Len(t, recorder.lines, 1)
+		msg := httphandler.SyncLogMessageData{}
+		require.NoError(t, json.Unmarshal([]byte(recorder.lines[0]), &msg))
+		assert.Equal(t, http.MethodDelete, msg.Method)
+		assert.Equal(t, "/bucket/key", msg.Path)
+		assert.Equal(t, "success:8080", msg.SuccessHost)
+		assert.Equal(t, "failed:8080", msg.FailedHost)
+		assert.True(t, msg.Tombstone)
+	}
+}
+
+func TestDeleteShouldClearTombstoneOnceSuccessfulOnAllBackends(t *testing.T) {
+	recorder := &syncLogRecorder{}
+	syncLog := &SyncSender{SyncLog: recorder, Tombstones: NewTombstones(time.Minute)}
+	syncLog.Tombstones.Add("/bucket/key")
+
+	picker := newDeleteResponsePicker(deleteResponses(t, "/bucket/key", true, true))
+	_, err := picker.Pick()
+	require.NoError(t, err)
+	picker.SendSyncLog(syncLog)
+
+	assert.False(t, syncLog.Tombstones.Has("/bucket/key"))
+	assert.Empty(t, recorder.lines)
+}
+
+func TestFailedBucketDeleteShouldNotSetTombstone(t *testing.T) {
+	syncLog := &SyncSender{SyncLog: &syncLogRecorder{}, Tombstones: NewTombstones(time.Minute)}
+
+	picker := newDeleteResponsePicker(deleteResponses(t, "/bucket", true, false))
+	_, err := picker.Pick()
+	require.Error(t, err)
+	picker.SendSyncLog(syncLog)
+
+	assert.Equal(t, 0, syncLog.Tombstones.Len())
+}
+
+func TestShardClientShouldSuppressReadsOfTombstonedObjects(t *testing.T) {
+	syncLog := &SyncSender{Tombstones: NewTombstones(time.Minute)}
+	syncLog.Tombstones.Add("/bucket/key")
+	dispatcherMock := &dispatcherStub{response: &http.Response{StatusCode: http.StatusOK}}
+	shard := &ShardClient{synclog: syncLog, requestDispatcher: dispatcherMock}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		req, err := http.NewRequest(method, "http://localhost/bucket/key", nil)
+		require.NoError(t, err)
+		resp, err := shard.RoundTrip(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+	assert.Equal(t, 0, dispatcherMock.calls)
+
+	req, err := http.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	require.NoError(t, err)
+	resp, err := shard.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, syncLog.Tombstones.Has("/bucket/key"))
+}
+
+type dispatcherStub struct {
+	response *http.Response
+	calls    int
+}
+
+func (ds *dispatcherStub) Dispatch(request *http.Request) (*http.Response, error) {
+	ds.calls++
+	return ds.response, nil
+}
+
+func deleteResponses(t *testing.T, path string, successful ...bool) chan BackendResponse {
+	request, err := http.NewRequest(http.MethodDelete, "http://localhost"+path, nil)
+	require.NoError(t, err)
+	responses := make(chan BackendResponse, len(successful))
+	for _, good := range successful {
+		if good {
+			responses <- BackendResponse{
+				Request:  request,
+				Response: &http.Response{Request: request, StatusCode: http.StatusNoContent},
+				Backend:  &StorageClient{Endpoint: url.URL{Host: "success:8080"}},
+			}
+			continue
+		}
+		responses <- BackendResponse{
+			Request: request,
+			Error:   fmt.Errorf("someerror"),
+			Backend: &StorageClient{Endpoint: url.URL{Host: "failed:8080"}},
+		}
+	}
+	close(responses)
+	return responses
+}
@@ -0,0 +1,61 @@
+package storages
+
+import (
+	"context"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+)
+
+// workerPool runs backend calls on fixed number of goroutines, so memory
+// usage doesn't grow with number of requests in flight
+type workerPool struct {
+	jobs chan func()
+}
+
+// backendCalls runs backend calls of replicated requests, each call gets
+// own goroutine if nil
+var backendCalls *workerPool
+
+// StartWorkers replaces goroutine per backend call with fixed pool of
+// workers, calls wait for free worker. It should be called once, before
+// requests are served, workers live until process exits
+func StartWorkers(workers int) {
+	if workers <= 0 {
+		return
+	}
+	pool := &workerPool{jobs: make(chan func())}
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	backendCalls = pool
+	log.Printf("Backend calls are run by %d workers", workers)
+}
+
+func (wp *workerPool) work() {
+	for job := range wp.jobs {
+		job()
+	}
+}
+
+// run passes job to free worker, it returns false if ctx is done first
+func (wp *workerPool) run(ctx context.Context, job func()) bool {
+	if wp == nil {
+		go job()
+		return true
+	}
+	select {
+	case wp.jobs <- job:
+		return true
+	default:
+	}
+	start := time.Now()
+	defer metrics.UpdateSince("reqs.workers.wait", start)
+	select {
+	case wp.jobs <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
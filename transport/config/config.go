@@ -5,6 +5,14 @@ import (
 	"regexp"
 
 	"github.com/allegro/akubra/metrics"
+	units "github.com/docker/go-units"
+)
+
+const (
+	// HTTP2 enables HTTP/2 over TLS (h2) for backend connections
+	HTTP2 = "h2"
+	// HTTP2Cleartext enables HTTP/2 with prior knowledge over plain TCP (h2c)
+	HTTP2Cleartext = "h2c"
 )
 
 // ClientTransportProperties details
@@ -23,6 +31,67 @@ type ClientTransportProperties struct {
 	// DisableKeepAlives see: https://golang.org/pkg/net/http/#Transport
 	// Default false
 	DisableKeepAlives bool `yaml:"DisableKeepAlives"`
+	// ExpectContinueTimeout see: https://golang.org/pkg/net/http/#Transport
+	// Bodies of requests with "Expect: 100-continue" header are sent after
+	// backend accepts them or timeout passes. Default 1s
+	ExpectContinueTimeout metrics.Interval `yaml:"ExpectContinueTimeout"`
+}
+
+// BackendTransportProperties overrides transport properties for single backend,
+// zero values keep properties of matched transport definition
+type BackendTransportProperties struct {
+	// MaxIdleConnsPerHost overrides ClientTransportProperties.MaxIdleConnsPerHost
+	MaxIdleConnsPerHost int `yaml:"MaxIdleConnsPerHost" validate:"min=0"`
+	// MaxConnsPerHost limits all open connections to backend,
+	// dialing waits for a free slot. Zero means no limit.
+	MaxConnsPerHost int `yaml:"MaxConnsPerHost" validate:"min=0"`
+	// IdleConnTimeout overrides ClientTransportProperties.IdleConnTimeout
+	IdleConnTimeout metrics.Interval `yaml:"IdleConnTimeout"`
+	// DisableKeepAlives overrides ClientTransportProperties.DisableKeepAlives if set
+	DisableKeepAlives *bool `yaml:"DisableKeepAlives"`
+	// KeepAlive is TCP keep-alive period of backend connections
+	KeepAlive metrics.Interval `yaml:"KeepAlive"`
+	// EgressBandwidth limits request bodies upload rate to backend, e.g. "10MB" per second
+	EgressBandwidth BytesPerSecond `yaml:"EgressBandwidth"`
+}
+
+// BytesPerSecond is bandwidth defined in human readable units, e.g. "512KB"
+type BytesPerSecond struct {
+	Value int64
+}
+
+// UnmarshalYAML for BytesPerSecond
+func (bps *BytesPerSecond) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var size string
+	if err := unmarshal(&size); err != nil {
+		return err
+	}
+	value, err := units.RAMInBytes(size)
+	if err != nil {
+		return fmt.Errorf("Unable to parse bandwidth %q: %s", size, err)
+	}
+	if value < 1 {
+		return fmt.Errorf("Bandwidth must be greater than zero")
+	}
+	bps.Value = value
+	return nil
+}
+
+// Apply returns properties overridden with backend specific values
+func (btp *BackendTransportProperties) Apply(properties ClientTransportProperties) ClientTransportProperties {
+	if btp == nil {
+		return properties
+	}
+	if btp.MaxIdleConnsPerHost > 0 {
+		properties.MaxIdleConnsPerHost = btp.MaxIdleConnsPerHost
+	}
+	if btp.IdleConnTimeout.Duration > 0 {
+		properties.IdleConnTimeout = btp.IdleConnTimeout
+	}
+	if btp.DisableKeepAlives != nil {
+		properties.DisableKeepAlives = *btp.DisableKeepAlives
+	}
+	return properties
 }
 
 // ClientTransportRules properties
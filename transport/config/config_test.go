@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/allegro/akubra/metrics"
 	"github.com/stretchr/testify/assert"
@@ -176,3 +177,29 @@ func prepareTransportConfig(method, path, queryParam string) ClientTransportRule
 		QueryParam: queryParam,
 	}
 }
+
+func TestBackendTransportPropertiesShouldOverrideOnlySetValues(t *testing.T) {
+	properties := ClientTransportProperties{
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   5,
+		IdleConnTimeout:       metrics.Interval{Duration: time.Second},
+		ResponseHeaderTimeout: metrics.Interval{Duration: time.Second},
+	}
+	disableKeepAlives := true
+	var noOverrides *BackendTransportProperties
+
+	assert.Equal(t, properties, noOverrides.Apply(properties))
+	assert.Equal(t, properties, (&BackendTransportProperties{}).Apply(properties))
+
+	overridden := (&BackendTransportProperties{
+		MaxIdleConnsPerHost: 50,
+		IdleConnTimeout:     metrics.Interval{Duration: time.Minute},
+		DisableKeepAlives:   &disableKeepAlives,
+	}).Apply(properties)
+
+	assert.Equal(t, 10, overridden.MaxIdleConns)
+	assert.Equal(t, 50, overridden.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, overridden.IdleConnTimeout.Duration)
+	assert.Equal(t, time.Second, overridden.ResponseHeaderTimeout.Duration)
+	assert.True(t, overridden.DisableKeepAlives)
+}
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+)
+
+// limitedConn frees connection slot on close
+type limitedConn struct {
+	net.Conn
+	slots  chan struct{}
+	closed int32
+}
+
+func (lc *limitedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&lc.closed, 0, 1) {
+		<-lc.slots
+	}
+	return lc.Conn.Close()
+}
+
+// limitedDialContext allows at most limit open connections, dialing waits
+// until one of them is closed or context is done
+func limitedDialContext(limit int, dial dialContext) dialContext {
+	slots := make(chan struct{}, limit)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			<-slots
+			return nil, err
+		}
+		return &limitedConn{Conn: conn, slots: slots}, nil
+	}
+}
@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/allegro/akubra/metrics"
+)
+
+// openConnections counts open connections of all transports
+var openConnections int64
+
+// OpenConnections returns number of open backend connections
+func OpenConnections() int64 {
+	return atomic.LoadInt64(&openConnections)
+}
+
+// countedConn decrements open connections count on close
+type countedConn struct {
+	net.Conn
+	closed int32
+}
+
+func (cc *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&cc.closed, 0, 1) {
+		atomic.AddInt64(&openConnections, -1)
+	}
+	return cc.Conn.Close()
+}
+
+// countedDialContext counts connections of all backends
+func countedDialContext(dial dialContext) dialContext {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&openConnections, 1)
+		return &countedConn{Conn: conn}, nil
+	}
+}
+
+// meteredConn reports connection close to backend connection metrics
+type meteredConn struct {
+	net.Conn
+	prefix string
+	active *int64
+	closed int32
+}
+
+func (mc *meteredConn) Close() error {
+	if atomic.CompareAndSwapInt32(&mc.closed, 0, 1) {
+		metrics.Mark(mc.prefix + ".closed")
+		metrics.UpdateGauge(mc.prefix+".active", atomic.AddInt64(mc.active, -1))
+	}
+	return mc.Conn.Close()
+}
+
+// meteredDialContext collects opened, closed, failed and active connections
+// metrics for given backend
+func meteredDialContext(backendName string, dial dialContext) dialContext {
+	prefix := fmt.Sprintf("connections.backend.%s", metrics.Clean(backendName))
+	active := new(int64)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			metrics.Mark(prefix + ".dial_errors")
+			return nil, err
+		}
+		metrics.Mark(prefix + ".opened")
+		metrics.UpdateGauge(prefix+".active", atomic.AddInt64(active, 1))
+		return &meteredConn{Conn: conn, prefix: prefix, active: active}, nil
+	}
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/allegro/akubra/metrics"
+)
+
+const (
+	minThrottledChunk = 512
+	maxThrottledChunk = 32 * 1024
+)
+
+// bandwidthLimiter schedules byte transfers so their total rate doesn't
+// exceed configured bandwidth
+type bandwidthLimiter struct {
+	mx          sync.Mutex
+	bytesPerSec float64
+	next        time.Time
+}
+
+// reserve returns how long caller has to wait before sending n bytes
+func (bl *bandwidthLimiter) reserve(n int, now time.Time) time.Duration {
+	bl.mx.Lock()
+	defer bl.mx.Unlock()
+	if bl.next.Before(now) {
+		bl.next = now
+	}
+	wait := bl.next.Sub(now)
+	bl.next = bl.next.Add(time.Duration(float64(n) / bl.bytesPerSec * float64(time.Second)))
+	return wait
+}
+
+// chunkSize keeps single wait around 100ms
+func (bl *bandwidthLimiter) chunkSize() int {
+	chunk := int(bl.bytesPerSec / 10)
+	if chunk < minThrottledChunk {
+		return minThrottledChunk
+	}
+	if chunk > maxThrottledChunk {
+		return maxThrottledChunk
+	}
+	return chunk
+}
+
+type throttledBody struct {
+	io.ReadCloser
+	limiter    *bandwidthLimiter
+	metricName string
+	now        func() time.Time
+	sleep      func(time.Duration)
+}
+
+func (tb *throttledBody) Read(p []byte) (int, error) {
+	if chunk := tb.limiter.chunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := tb.ReadCloser.Read(p)
+	if n > 0 {
+		start := tb.now()
+		if wait := tb.limiter.reserve(n, start); wait > 0 {
+			tb.sleep(wait)
+			metrics.UpdateSince(tb.metricName, start)
+		}
+	}
+	return n, err
+}
+
+type throttledRoundTripper struct {
+	roundTripper http.RoundTripper
+	limiter      *bandwidthLimiter
+	metricName   string
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (trt *throttledRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return trt.roundTripper.RoundTrip(req)
+	}
+	throttledReq := *req
+	throttledReq.Body = &throttledBody{
+		ReadCloser: req.Body,
+		limiter:    trt.limiter,
+		metricName: trt.metricName,
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+	return trt.roundTripper.RoundTrip(&throttledReq)
+}
+
+// throttledRoundTrippers limits request bodies egress of all given round trippers
+// to shared bandwidth
+func throttledRoundTrippers(roundTrippers map[string]http.RoundTripper, backendName string, bytesPerSec int64) {
+	limiter := &bandwidthLimiter{bytesPerSec: float64(bytesPerSec)}
+	metricName := fmt.Sprintf("throttle.backend.%s.wait", metrics.Clean(backendName))
+	for name, roundTripper := range roundTrippers {
+		roundTrippers[name] = &throttledRoundTripper{
+			roundTripper: roundTripper,
+			limiter:      limiter,
+			metricName:   metricName,
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bodyReadingRoundTripper struct {
+	body []byte
+}
+
+func (brrt *bodyReadingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		brrt.body = body
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+}
+
+func TestBandwidthLimiterShouldScheduleTransfers(t *testing.T) {
+	now := time.Now()
+	limiter := &bandwidthLimiter{bytesPerSec: 1000}
+
+	assert.Equal(t, time.Duration(0), limiter.reserve(500, now))
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(500, now))
+	assert.Equal(t, 800*time.Millisecond, limiter.reserve(100, now.Add(200*time.Millisecond)))
+	assert.Equal(t, time.Duration(0), limiter.reserve(100, now.Add(10*time.Second)))
+}
+
+func TestThrottledBodyShouldWaitForBandwidth(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 3000)
+	var slept time.Duration
+	start := time.Now()
+	body := &throttledBody{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(content)),
+		limiter:    &bandwidthLimiter{bytesPerSec: 1000},
+		metricName: "throttle.backend.test.wait",
+		now:        func() time.Time { return start.Add(slept) },
+		sleep:      func(d time.Duration) { slept += d },
+	}
+
+	read := bytes.NewBuffer(nil)
+	_, err := io.CopyBuffer(struct{ io.Writer }{read}, body, make([]byte, 4096))
+
+	require.NoError(t, err)
+	assert.Equal(t, content, read.Bytes())
+	assert.Equal(t, 2560*time.Millisecond, slept, "last 440 bytes chunk should be sent without waiting")
+}
+
+func TestThrottledRoundTripperShouldWrapOnlyRequestsWithBody(t *testing.T) {
+	backend := &bodyReadingRoundTripper{}
+	roundTrippers := map[string]http.RoundTripper{"default": backend}
+	throttledRoundTrippers(roundTrippers, "test", 1024*1024)
+
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", bytes.NewBufferString("content"))
+	_, err := roundTrippers["default"].RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(backend.body))
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+	_, err = roundTrippers["default"].RoundTrip(req)
+	require.NoError(t, err)
+}
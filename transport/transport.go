@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -10,17 +12,51 @@ import (
 	httphandlerConfig "github.com/allegro/akubra/httphandler/config"
 	"github.com/allegro/akubra/log"
 	"github.com/allegro/akubra/transport/config"
+	"golang.org/x/net/http2"
 )
 
 const (
-	defaultMaxIdleConnsPerHost = 100
-	defaultDialTimeout         = time.Second
+	defaultMaxIdleConnsPerHost   = 100
+	defaultDialTimeout           = time.Second
+	defaultExpectContinueTimeout = time.Second
 )
 
 // Matcher mapping initialized Transports with http.RoundTripper by transport name
 type Matcher struct {
 	RoundTrippers    map[string]http.RoundTripper
 	TransportsConfig config.Transports
+	clientConf       httphandlerConfig.Client
+}
+
+// BackendOptions defines backend specific transport settings
+type BackendOptions struct {
+	// Name is used in connection metrics names, metrics are not collected if empty
+	Name string
+	// TLSConfig is used for https connections
+	TLSConfig *tls.Config
+	// HTTP2 is one of config.HTTP2, config.HTTP2Cleartext or empty for HTTP/1.1
+	HTTP2 string
+	// Properties overrides transports properties and sets connection limits
+	Properties *config.BackendTransportProperties
+}
+
+// ForBackend returns Matcher with the same transports definitions
+// configured with backend specific options
+func (m *Matcher) ForBackend(options BackendOptions) (http.RoundTripper, error) {
+	roundTrippers := make(map[string]http.RoundTripper)
+	dialContext := dialContextFunc(m.clientConf, options)
+	for _, transport := range m.TransportsConfig {
+		properties := options.Properties.Apply(transport.Properties)
+		roundTripper, err := perepareTransport(properties, defaultMaxIdleConnsPerHost, dialContext, options)
+		if err != nil {
+			return nil, err
+		}
+		roundTrippers[transport.Name] = roundTripper
+	}
+	if options.Properties != nil && options.Properties.EgressBandwidth.Value > 0 {
+		throttledRoundTrippers(roundTrippers, options.Name, options.Properties.EgressBandwidth.Value)
+	}
+	return &Matcher{RoundTrippers: roundTrippers, TransportsConfig: m.TransportsConfig, clientConf: m.clientConf}, nil
 }
 
 // SelectTransportDefinition returns transport instance by method, path and queryParams
@@ -59,11 +95,16 @@ func (m *Matcher) SelectTransportRoundTripper(request *http.Request) (selectedRo
 // ConfigureHTTPTransports returns RoundTrippers mapped by transport name from configuration
 func ConfigureHTTPTransports(clientConf httphandlerConfig.Client) (http.RoundTripper, error) {
 	roundTrippers := make(map[string]http.RoundTripper)
-	transportMatcher := &Matcher{TransportsConfig: clientConf.Transports}
+	transportMatcher := &Matcher{TransportsConfig: clientConf.Transports, clientConf: clientConf}
 	maxIdleConnsPerHost := defaultMaxIdleConnsPerHost
+	dialContext := dialContextFunc(clientConf, BackendOptions{})
 	if len(clientConf.Transports) > 0 {
 		for _, transport := range clientConf.Transports {
-			roundTrippers[transport.Name] = perepareTransport(transport.Properties, clientConf, maxIdleConnsPerHost)
+			roundTripper, err := perepareTransport(transport.Properties, maxIdleConnsPerHost, dialContext, BackendOptions{})
+			if err != nil {
+				return nil, err
+			}
+			roundTrippers[transport.Name] = roundTripper
 		}
 		transportMatcher.RoundTrippers = roundTrippers
 	} else {
@@ -78,26 +119,73 @@ type DefinitionError struct {
 	error
 }
 
+type dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func dialContextFunc(clientConf httphandlerConfig.Client, options BackendOptions) dialContext {
+	timeout := defaultDialTimeout
+	if clientConf.DialTimeout.Duration > 0 {
+		timeout = clientConf.DialTimeout.Duration
+	}
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	if options.Properties != nil {
+		dialer.KeepAlive = options.Properties.KeepAlive.Duration
+	}
+	dial := countedDialContext(dialer.DialContext)
+	if options.Name != "" {
+		dial = meteredDialContext(options.Name, dial)
+	}
+	if options.Properties != nil && options.Properties.MaxConnsPerHost > 0 {
+		dial = limitedDialContext(options.Properties.MaxConnsPerHost, dial)
+	}
+	return dial
+}
+
 // perepareTransport with properties
-func perepareTransport(properties config.ClientTransportProperties, clientConf httphandlerConfig.Client, maxIdleConnsPerHost int) http.RoundTripper {
+func perepareTransport(properties config.ClientTransportProperties, maxIdleConnsPerHost int,
+	dial dialContext, options BackendOptions) (http.RoundTripper, error) {
 	if properties.MaxIdleConnsPerHost != 0 {
 		maxIdleConnsPerHost = properties.MaxIdleConnsPerHost
 	}
+	expectContinueTimeout := defaultExpectContinueTimeout
+	if properties.ExpectContinueTimeout.Duration != 0 {
+		expectContinueTimeout = properties.ExpectContinueTimeout.Duration
+	}
 
-	timeout := defaultDialTimeout
-	if clientConf.DialTimeout.Duration > 0 {
-		timeout = clientConf.DialTimeout.Duration
+	if options.HTTP2 == config.HTTP2Cleartext {
+		// h2c uses prior knowledge, connections are plain TCP
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(context.Background(), network, addr)
+			},
+		}, nil
 	}
 
+	tlsConfig := options.TLSConfig
+	if tlsConfig != nil {
+		// each transport gets own copy, http2 configuration modifies it
+		tlsConfig = tlsConfig.Clone()
+	}
 	httpTransport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: timeout,
-		}).DialContext,
+		DialContext:           dial,
 		MaxIdleConns:          properties.MaxIdleConns,
 		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
 		IdleConnTimeout:       properties.IdleConnTimeout.Duration,
 		ResponseHeaderTimeout: properties.ResponseHeaderTimeout.Duration,
 		DisableKeepAlives:     properties.DisableKeepAlives,
+		ExpectContinueTimeout: expectContinueTimeout,
+		TLSClientConfig:       tlsConfig,
+	}
+	switch options.HTTP2 {
+	case "":
+		return httpTransport, nil
+	case config.HTTP2:
+		if err := http2.ConfigureTransport(httpTransport); err != nil {
+			return nil, fmt.Errorf("cannot enable HTTP/2: %s", err)
+		}
+		return httpTransport, nil
 	}
-	return httpTransport
+	return nil, fmt.Errorf("unsupported HTTP2 mode %q", options.HTTP2)
 }
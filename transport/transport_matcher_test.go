@@ -1,9 +1,14 @@
 package transport
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"fmt"
 
@@ -12,8 +17,11 @@ import (
 	httphandlerConfig "github.com/allegro/akubra/httphandler/config"
 	"github.com/allegro/akubra/log"
 	transportConfig "github.com/allegro/akubra/transport/config"
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
 )
 
 type LoggerMock struct {
@@ -76,3 +84,82 @@ func prepareClientConfig(transportName, method string) httphandlerConfig.Client
 		Transports: testConfig,
 	}
 }
+
+func TestShouldCreateMatcherForBackendWithTLSConfig(t *testing.T) {
+	clientConfig := prepareClientConfig("TestTransport", "GET")
+	matcher, err := ConfigureHTTPTransports(clientConfig)
+	assert.NoError(t, err)
+	tlsConfig := &tls.Config{ServerName: "backend.internal"}
+
+	backendMatcher, err := matcher.(*Matcher).ForBackend(BackendOptions{TLSConfig: tlsConfig})
+
+	require.NoError(t, err)
+	assert.Equal(t, clientConfig.Transports, backendMatcher.(*Matcher).TransportsConfig)
+	for name, roundTripper := range backendMatcher.(*Matcher).RoundTrippers {
+		assert.Equal(t, "backend.internal", roundTripper.(*http.Transport).TLSClientConfig.ServerName, name)
+		assert.Nil(t, matcher.(*Matcher).RoundTrippers[name].(*http.Transport).TLSClientConfig, name)
+	}
+}
+
+func TestShouldCreateMatcherForBackendWithHTTP2(t *testing.T) {
+	clientConfig := prepareClientConfig("TestTransport", "GET")
+	matcher, err := ConfigureHTTPTransports(clientConfig)
+	assert.NoError(t, err)
+
+	h2Matcher, err := matcher.(*Matcher).ForBackend(BackendOptions{HTTP2: transportConfig.HTTP2})
+	require.NoError(t, err)
+	for name, roundTripper := range h2Matcher.(*Matcher).RoundTrippers {
+		assert.Contains(t, roundTripper.(*http.Transport).TLSClientConfig.NextProtos, "h2", name)
+	}
+
+	h2cMatcher, err := matcher.(*Matcher).ForBackend(BackendOptions{HTTP2: transportConfig.HTTP2Cleartext})
+	require.NoError(t, err)
+	for name, roundTripper := range h2cMatcher.(*Matcher).RoundTrippers {
+		assert.True(t, roundTripper.(*http2.Transport).AllowHTTP, name)
+	}
+
+	_, err = matcher.(*Matcher).ForBackend(BackendOptions{HTTP2: "spdy"})
+	assert.Error(t, err)
+}
+
+func TestShouldCollectBackendConnectionMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dial := meteredDialContext("test.backend", (&net.Dialer{}).DialContext)
+
+	conn, err := dial(context.Background(), "tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	opened, _ := metrics.Get("connections.backend.test_backend.opened").(metrics.Meter)
+	active, _ := metrics.Get("connections.backend.test_backend.active").(metrics.Gauge)
+	require.NotNil(t, opened)
+	require.NotNil(t, active)
+	assert.Equal(t, int64(1), opened.Count())
+	assert.Equal(t, int64(1), active.Value())
+
+	require.NoError(t, conn.Close())
+	assert.Error(t, conn.Close())
+	closed, _ := metrics.Get("connections.backend.test_backend.closed").(metrics.Meter)
+	require.NotNil(t, closed)
+	assert.Equal(t, int64(1), closed.Count())
+	assert.Equal(t, int64(0), active.Value())
+}
+
+func TestLimitedDialContextShouldWaitForFreeSlot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+	dial := limitedDialContext(1, (&net.Dialer{}).DialContext)
+
+	first, err := dial(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = dial(ctx, "tcp", addr)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, first.Close())
+	second, err := dial(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	assert.NoError(t, second.Close())
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type virtualHostKey struct{}
+
+// VirtualHost describes original addressing of virtual hosted style request
+// rewritten to path style
+type VirtualHost struct {
+	// Host is original Host header, e.g. "bucket.s3.example.com"
+	Host string
+	// Bucket is bucket name extracted from Host
+	Bucket string
+}
+
+// ToPathStyle returns copy of virtual hosted style request with bucket moved to
+// path and Host set to serviceHost, original addressing is kept in context
+func ToPathStyle(req *http.Request, vh VirtualHost, serviceHost string) *http.Request {
+	pathStyleReq := req.WithContext(context.WithValue(req.Context(), virtualHostKey{}, vh))
+	pathStyleReq.URL = copyURL(req.URL)
+	pathStyleReq.Host = serviceHost
+	pathStyleReq.URL.Path = "/" + vh.Bucket + ensureLeadingSlash(req.URL.Path)
+	if req.URL.RawPath != "" {
+		pathStyleReq.URL.RawPath = "/" + vh.Bucket + ensureLeadingSlash(req.URL.RawPath)
+	}
+	return pathStyleReq
+}
+
+// ToVirtualHostedStyle returns copy of request rewritten by ToPathStyle with
+// original addressing restored, other requests are returned unchanged
+func ToVirtualHostedStyle(req *http.Request) *http.Request {
+	vh, ok := VirtualHostOf(req)
+	if !ok {
+		return req
+	}
+	prefix := "/" + vh.Bucket
+	if !strings.HasPrefix(req.URL.Path, prefix) {
+		return req
+	}
+	restored := req.WithContext(req.Context())
+	restored.URL = copyURL(req.URL)
+	restored.Host = vh.Host
+	restored.URL.Path = ensureLeadingSlash(strings.TrimPrefix(req.URL.Path, prefix))
+	if req.URL.RawPath != "" {
+		restored.URL.RawPath = ensureLeadingSlash(strings.TrimPrefix(req.URL.RawPath, prefix))
+	}
+	return restored
+}
+
+// VirtualHostOf returns original addressing of request rewritten to path style
+func VirtualHostOf(req *http.Request) (VirtualHost, bool) {
+	vh, ok := req.Context().Value(virtualHostKey{}).(VirtualHost)
+	return vh, ok
+}
+
+func copyURL(u *url.URL) *url.URL {
+	copied := *u
+	return &copied
+}
+
+func ensureLeadingSlash(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/" + path
+}
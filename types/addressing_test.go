@@ -0,0 +1,50 @@
+package types
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRewriteVirtualHostedRequestToPathStyleAndBack(t *testing.T) {
+	for path, expectedPath := range map[string]string{
+		"/key":        "/bucket/key",
+		"/dir/key":    "/bucket/dir/key",
+		"/":           "/bucket/",
+		"/bucket/key": "/bucket/bucket/key",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://bucket.s3.local:8080"+path, nil)
+		vh := VirtualHost{Host: req.Host, Bucket: "bucket"}
+
+		pathStyleReq := ToPathStyle(req, vh, "s3.local:8080")
+
+		assert.Equal(t, expectedPath, pathStyleReq.URL.Path)
+		assert.Equal(t, "s3.local:8080", pathStyleReq.Host)
+		assert.Equal(t, path, req.URL.Path, "original request should not be modified")
+		actualVH, ok := VirtualHostOf(pathStyleReq)
+		assert.True(t, ok)
+		assert.Equal(t, vh, actualVH)
+
+		restored := ToVirtualHostedStyle(pathStyleReq)
+		assert.Equal(t, path, restored.URL.Path)
+		assert.Equal(t, "bucket.s3.local:8080", restored.Host)
+		assert.Equal(t, expectedPath, pathStyleReq.URL.Path, "path style request should not be modified")
+	}
+}
+
+func TestShouldRewriteEscapedPath(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://bucket.s3.local/a%2Fb", nil)
+
+	pathStyleReq := ToPathStyle(req, VirtualHost{Host: req.Host, Bucket: "bucket"}, "s3.local")
+	assert.Equal(t, "/bucket/a%2Fb", pathStyleReq.URL.EscapedPath())
+
+	restored := ToVirtualHostedStyle(pathStyleReq)
+	assert.Equal(t, "/a%2Fb", restored.URL.EscapedPath())
+}
+
+func TestShouldNotRestorePathStyleRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://s3.local/bucket/key", nil)
+	assert.Equal(t, req, ToVirtualHostedStyle(req))
+}
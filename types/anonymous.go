@@ -0,0 +1,17 @@
+package types
+
+import "context"
+
+type anonymousReadKey struct{}
+
+// WithAnonymousRead marks context of anonymous read of public bucket, such
+// requests aren't authenticated nor signed for backends
+func WithAnonymousRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, anonymousReadKey{}, true)
+}
+
+// IsAnonymousRead reports if context was marked by WithAnonymousRead
+func IsAnonymousRead(ctx context.Context) bool {
+	anonymous, _ := ctx.Value(anonymousReadKey{}).(bool)
+	return anonymous
+}
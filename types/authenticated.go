@@ -0,0 +1,18 @@
+package types
+
+import "context"
+
+type authenticatedKey struct{}
+
+// WithAuthenticatedAccessKey marks context of request which signature was
+// verified with secret of access key
+func WithAuthenticatedAccessKey(ctx context.Context, accessKey string) context.Context {
+	return context.WithValue(ctx, authenticatedKey{}, accessKey)
+}
+
+// AuthenticatedAccessKey returns access key set by WithAuthenticatedAccessKey,
+// requests without it weren't verified by Akubra
+func AuthenticatedAccessKey(ctx context.Context) (string, bool) {
+	accessKey, ok := ctx.Value(authenticatedKey{}).(string)
+	return accessKey, ok
+}
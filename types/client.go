@@ -0,0 +1,16 @@
+package types
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns address of client, without port. Behind trusted proxies
+// request RemoteAddr is replaced with address of client by netacl.Decorator
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -6,3 +6,15 @@ import "io"
 type Resetter interface {
 	Reset() io.ReadCloser
 }
+
+// Streamer interface is implemented by bodies which may be read once without buffering
+type Streamer interface {
+	// Stream returns underlying reader, false if body was already buffered
+	Stream() (io.Reader, bool)
+}
+
+// Digester interface is implemented by bodies which checksum is computed while buffered
+type Digester interface {
+	// MD5 returns body checksum, false if body wasn't buffered
+	MD5() ([]byte, bool)
+}
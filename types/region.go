@@ -0,0 +1,17 @@
+package types
+
+import "context"
+
+type regionHintKey struct{}
+
+// WithRegionHint marks context of request which should be routed to named
+// region, regardless of its host and bucket
+func WithRegionHint(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionHintKey{}, region)
+}
+
+// RegionHint returns region set by WithRegionHint
+func RegionHint(ctx context.Context) (string, bool) {
+	region, ok := ctx.Value(regionHintKey{}).(string)
+	return region, ok && region != ""
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+type routingKey struct{}
+
+// Routing records where request was routed to, nil Routing records nothing
+type Routing struct {
+	mx       sync.Mutex
+	region   string
+	shard    string
+	backends []string
+}
+
+// WithRouting attaches routing to context
+func WithRouting(ctx context.Context, routing *Routing) context.Context {
+	return context.WithValue(ctx, routingKey{}, routing)
+}
+
+// RoutingOf returns routing attached to context, nil if none
+func RoutingOf(ctx context.Context) *Routing {
+	routing, _ := ctx.Value(routingKey{}).(*Routing)
+	return routing
+}
+
+// SetShard records region and its shard which served request, the last
+// recorded wins, so shards of regression calls and failover regions replace
+// previous ones
+func (r *Routing) SetShard(region, shard string) {
+	if r == nil {
+		return
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.region = region
+	r.shard = shard
+}
+
+// AddBackend records backend request was sent to
+func (r *Routing) AddBackend(backend string) {
+	if r == nil {
+		return
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.backends = append(r.backends, backend)
+}
+
+// Shard returns recorded region and shard
+func (r *Routing) Shard() (region, shard string) {
+	if r == nil {
+		return "", ""
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.region, r.shard
+}
+
+// Backends returns backends in order requests were sent to them
+func (r *Routing) Backends() []string {
+	if r == nil {
+		return nil
+	}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]string(nil), r.backends...)
+}
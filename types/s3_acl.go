@@ -0,0 +1,51 @@
+package types
+
+import "encoding/xml"
+
+// xsiNamespace is namespace of grantee type attribute
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// AccessControlPolicy is body of ?acl subresource requests and responses
+type AccessControlPolicy struct {
+	XMLName xml.Name `xml:"AccessControlPolicy"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Owner   ACLOwner `xml:"Owner"`
+	Grants  []Grant  `xml:"AccessControlList>Grant"`
+}
+
+// ACLOwner is owner of bucket or object
+type ACLOwner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName,omitempty"`
+}
+
+// Grant gives permission to grantee
+type Grant struct {
+	Grantee    Grantee `xml:"Grantee"`
+	Permission string  `xml:"Permission"`
+}
+
+// Grantee is user (CanonicalUser, AmazonCustomerByEmail) or group of users (Group)
+type Grantee struct {
+	Type         string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	ID           string `xml:"ID,omitempty"`
+	DisplayName  string `xml:"DisplayName,omitempty"`
+	URI          string `xml:"URI,omitempty"`
+	EmailAddress string `xml:"EmailAddress,omitempty"`
+}
+
+// MarshalXML writes grantee type with conventional "xsi" prefix, which
+// encoding/xml would replace with generated one
+func (g Grantee) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = []xml.Attr{
+		{Name: xml.Name{Local: "xmlns:xsi"}, Value: xsiNamespace},
+		{Name: xml.Name{Local: "xsi:type"}, Value: g.Type},
+	}
+	content := struct {
+		ID           string `xml:"ID,omitempty"`
+		DisplayName  string `xml:"DisplayName,omitempty"`
+		URI          string `xml:"URI,omitempty"`
+		EmailAddress string `xml:"EmailAddress,omitempty"`
+	}{g.ID, g.DisplayName, g.URI, g.EmailAddress}
+	return e.EncodeElement(content, start)
+}
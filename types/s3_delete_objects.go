@@ -0,0 +1,44 @@
+package types
+
+import "encoding/xml"
+
+// S3Namespace is XML name space of S3 API documents
+const S3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// DeleteObjectsRequest is body of Multi-Object Delete request
+// (POST /bucket?delete)
+type DeleteObjectsRequest struct {
+	XMLName xml.Name           `xml:"Delete"`
+	Quiet   bool               `xml:"Quiet,omitempty"`
+	Objects []ObjectIdentifier `xml:"Object"`
+}
+
+// ObjectIdentifier identifies object or its version
+type ObjectIdentifier struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+// DeleteObjectsResult is body of Multi-Object Delete response
+type DeleteObjectsResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Deleted []DeletedObject `xml:"Deleted"`
+	Errors  []DeleteError   `xml:"Error"`
+}
+
+// DeletedObject describes successfully deleted object
+type DeletedObject struct {
+	Key                   string `xml:"Key"`
+	VersionID             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty"`
+}
+
+// DeleteError describes object which couldn't be deleted
+type DeleteError struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+	Code      string `xml:"Code"`
+	Message   string `xml:"Message"`
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/allegro/akubra/log"
+)
+
+// S3Error is S3 compatible error response body
+type S3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// S3 error codes used by proxy, see
+// http://docs.aws.amazon.com/AmazonS3/latest/API/ErrorResponses.html
+const (
+	S3ErrInvalidRequest         = "InvalidRequest"
+	S3ErrAccessDenied           = "AccessDenied"
+	S3ErrInvalidAccessKeyID     = "InvalidAccessKeyId"
+	S3ErrSignatureDoesNotMatch  = "SignatureDoesNotMatch"
+	S3ErrAuthorizationMalformed = "AuthorizationHeaderMalformed"
+	S3ErrNotFound               = "NotFound"
+	S3ErrNoSuchKey              = "NoSuchKey"
+	S3ErrNoSuchBucket           = "NoSuchBucket"
+	S3ErrBucketNotEmpty         = "BucketNotEmpty"
+	S3ErrMethodNotAllowed       = "MethodNotAllowed"
+	S3ErrMissingContentLength   = "MissingContentLength"
+	S3ErrEntityTooLarge         = "EntityTooLarge"
+	S3ErrInternalError          = "InternalError"
+	S3ErrNotImplemented         = "NotImplemented"
+	S3ErrServiceUnavailable     = "ServiceUnavailable"
+	S3ErrSlowDown               = "SlowDown"
+	S3ErrBadDigest              = "BadDigest"
+	S3ErrInvalidDigest          = "InvalidDigest"
+	S3ErrContentSHA256Mismatch  = "XAmzContentSHA256Mismatch"
+	S3ErrMalformedXML           = "MalformedXML"
+	S3ErrInvalidArgument        = "InvalidArgument"
+	S3ErrInvalidRange           = "InvalidRange"
+	S3ErrPreconditionFailed     = "PreconditionFailed"
+	S3ErrKeyTooLong             = "KeyTooLongError"
+	S3ErrIncompleteBody         = "IncompleteBody"
+)
+
+type s3ErrorDescription struct {
+	code    string
+	message string
+}
+
+var defaultS3Errors = map[int]s3ErrorDescription{
+	http.StatusBadRequest:            {S3ErrInvalidRequest, "Invalid request."},
+	http.StatusForbidden:             {S3ErrAccessDenied, "Access Denied"},
+	http.StatusNotFound:              {S3ErrNotFound, "Not Found"},
+	http.StatusMethodNotAllowed:      {S3ErrMethodNotAllowed, "The specified method is not allowed against this resource."},
+	http.StatusLengthRequired:        {S3ErrMissingContentLength, "You must provide the Content-Length HTTP header."},
+	http.StatusRequestEntityTooLarge: {S3ErrEntityTooLarge, "Your proposed upload exceeds the maximum allowed object size."},
+	http.StatusInternalServerError:   {S3ErrInternalError, "We encountered an internal error. Please try again."},
+	http.StatusNotImplemented:        {S3ErrNotImplemented, "A header you provided implies functionality that is not implemented."},
+	http.StatusBadGateway:            {S3ErrServiceUnavailable, "Storage backend is unavailable."},
+	http.StatusServiceUnavailable:    {S3ErrServiceUnavailable, "Please reduce your request rate."},
+	http.StatusGatewayTimeout:        {S3ErrServiceUnavailable, "Storage backend did not respond in time."},
+}
+
+// NewS3ErrorResponseForStatus creates S3 error response with default code and
+// message for given status
+func NewS3ErrorResponseForStatus(req *http.Request, statusCode int) *http.Response {
+	description := errorDescription(statusCode)
+	return NewS3ErrorResponse(req, statusCode, description.code, description.message)
+}
+
+// NewS3ErrorResponseWithMessage creates S3 error response with default code
+// for given status and custom message
+func NewS3ErrorResponseWithMessage(req *http.Request, statusCode int, message string) *http.Response {
+	return NewS3ErrorResponse(req, statusCode, errorDescription(statusCode).code, message)
+}
+
+func errorDescription(statusCode int) s3ErrorDescription {
+	description, ok := defaultS3Errors[statusCode]
+	if !ok {
+		text := http.StatusText(statusCode)
+		description = s3ErrorDescription{strings.Replace(text, " ", "", -1), text}
+		if statusCode >= http.StatusInternalServerError {
+			description = defaultS3Errors[http.StatusInternalServerError]
+		}
+	}
+	return description
+}
+
+// NewS3ErrorResponse creates response with S3 XML error body for given request
+func NewS3ErrorResponse(req *http.Request, statusCode int, code, message string) *http.Response {
+	reqID, _ := req.Context().Value(log.ContextreqIDKey).(string)
+	resource := ""
+	if req.URL != nil {
+		resource = req.URL.Path
+	}
+	body, err := xml.Marshal(S3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  resource,
+		RequestID: reqID,
+	})
+	if err != nil {
+		log.Printf("Cannot marshal S3 error for request %s: %s", reqID, err)
+	}
+	body = append([]byte(xml.Header), body...)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,66 @@
+package types
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/akubra/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldCreateS3ErrorResponse(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "http://localhost/bucket/key", nil)
+	req = req.WithContext(context.WithValue(req.Context(), log.ContextreqIDKey, "req-id"))
+
+	resp := NewS3ErrorResponse(req, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate.")
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "application/xml", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	s3Error := S3Error{}
+	require.NoError(t, xml.Unmarshal(body, &s3Error))
+	assert.Equal(t, "SlowDown", s3Error.Code)
+	assert.Equal(t, "Please reduce your request rate.", s3Error.Message)
+	assert.Equal(t, "/bucket/key", s3Error.Resource)
+	assert.Equal(t, "req-id", s3Error.RequestID)
+}
+
+func TestShouldCreateS3ErrorResponseWithDefaultCodeForStatus(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/bucket/key", nil)
+
+	for status, expectedCode := range map[int]string{
+		http.StatusForbidden:           S3ErrAccessDenied,
+		http.StatusInternalServerError: S3ErrInternalError,
+		http.StatusPreconditionFailed:  "PreconditionFailed",
+		599:                            S3ErrInternalError,
+	} {
+		resp := NewS3ErrorResponseForStatus(req, status)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		s3Error := S3Error{}
+		require.NoError(t, xml.Unmarshal(body, &s3Error))
+		assert.Equal(t, status, resp.StatusCode)
+		assert.Equal(t, expectedCode, s3Error.Code)
+		assert.NotEmpty(t, s3Error.Message)
+	}
+}
+
+func TestShouldCreateS3ErrorResponseForRequestWithoutURL(t *testing.T) {
+	req := &http.Request{Host: "unknown.domain"}
+
+	resp := NewS3ErrorResponseForStatus(req, http.StatusNotFound)
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	s3Error := S3Error{}
+	require.NoError(t, xml.Unmarshal(body, &s3Error))
+	assert.Empty(t, s3Error.Resource)
+}
@@ -11,3 +11,10 @@ type CompleteMultipartUploadResult struct {
 	Key      string
 	ETag     string
 }
+
+// CopyObjectResult is body of CopyObject response
+type CopyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult" json:"-"`
+	LastModified string
+	ETag         string
+}
@@ -0,0 +1,101 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timingsKey struct{}
+
+// BackendTiming describes request sent to one backend
+type BackendTiming struct {
+	Backend string
+	Start   time.Time
+	// Duration of finished request, time since Start of request in flight
+	Duration time.Duration
+	InFlight bool
+	Status   int
+	Err      error
+}
+
+// String formats timing for logs
+func (bt BackendTiming) String() string {
+	switch {
+	case bt.InFlight:
+		return fmt.Sprintf("%s in flight for %s", bt.Backend, bt.Duration)
+	case bt.Err != nil:
+		return fmt.Sprintf("%s failed in %s: %s", bt.Backend, bt.Duration, bt.Err)
+	}
+	return fmt.Sprintf("%s %d in %s", bt.Backend, bt.Status, bt.Duration)
+}
+
+// Timings collects timings of backend requests made on behalf of client
+// request, nil Timings records nothing
+type Timings struct {
+	mx       sync.Mutex
+	backends []*BackendTiming
+}
+
+// WithTimings attaches timings to context
+func WithTimings(ctx context.Context, timings *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, timings)
+}
+
+// TimingsOf returns timings attached to context, nil if none
+func TimingsOf(ctx context.Context) *Timings {
+	timings, _ := ctx.Value(timingsKey{}).(*Timings)
+	return timings
+}
+
+// Start records backend request start, returned function records its end
+func (t *Timings) Start(backend string) func(status int, err error) {
+	if t == nil {
+		return func(int, error) {}
+	}
+	timing := &BackendTiming{Backend: backend, Start: time.Now(), InFlight: true}
+	t.mx.Lock()
+	t.backends = append(t.backends, timing)
+	t.mx.Unlock()
+	return func(status int, err error) {
+		t.mx.Lock()
+		defer t.mx.Unlock()
+		timing.Duration = time.Since(timing.Start)
+		timing.InFlight = false
+		timing.Status = status
+		timing.Err = err
+	}
+}
+
+// Backends returns timings of backend requests in order they were started
+func (t *Timings) Backends() []BackendTiming {
+	if t == nil {
+		return nil
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	timings := make([]BackendTiming, 0, len(t.backends))
+	for _, timing := range t.backends {
+		copied := *timing
+		if copied.InFlight {
+			copied.Duration = time.Since(copied.Start)
+		}
+		timings = append(timings, copied)
+	}
+	return timings
+}
+
+// String formats all timings for logs
+func (t *Timings) String() string {
+	timings := t.Backends()
+	if len(timings) == 0 {
+		return "no backend requests"
+	}
+	formatted := make([]string, 0, len(timings))
+	for _, timing := range timings {
+		formatted = append(formatted, timing.String())
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+)
+
+const (
+	// File sink appends records to local file as JSON lines
+	File = "file"
+	// Statsd sink sends records as statsd counters
+	Statsd = "statsd"
+	// KafkaREST sink produces records to Kafka topic through REST Proxy
+	KafkaREST = "kafka-rest"
+)
+
+// Usage configuration, usage is not accounted if Sink is not defined
+type Usage struct {
+	// Sink records are flushed to: "file", "statsd" or "kafka-rest"
+	Sink string `yaml:"Sink"`
+	// Interval between flushes, default: 1m
+	Interval metrics.Interval `yaml:"Interval"`
+	// Path of file records are appended to
+	Path string `yaml:"Path"`
+	// Addr of statsd daemon
+	Addr string `yaml:"Addr"`
+	// Prefix of statsd counters
+	Prefix string `yaml:"Prefix"`
+	// Endpoint of Kafka REST Proxy
+	Endpoint types.YAMLUrl `yaml:"Endpoint"`
+	// Topic records are produced to
+	Topic string `yaml:"Topic"`
+}
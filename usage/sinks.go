@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/usage/config"
+)
+
+// statsdPacketSize keeps packets below common MTU
+const statsdPacketSize = 1432
+
+// sink writes flushed records
+type sink interface {
+	write(records []Record) error
+}
+
+func newSink(conf config.Usage) (sink, error) {
+	switch conf.Sink {
+	case config.File:
+		if conf.Path == "" {
+			return nil, errors.New("no usage Path defined")
+		}
+		return &fileSink{path: conf.Path}, nil
+	case config.Statsd:
+		if conf.Addr == "" {
+			return nil, errors.New("no statsd Addr defined")
+		}
+		prefix := conf.Prefix
+		if prefix != "" && !strings.HasSuffix(prefix, ".") {
+			prefix += "."
+		}
+		return &statsdSink{addr: conf.Addr, prefix: prefix}, nil
+	case config.KafkaREST:
+		if conf.Endpoint.URL == nil || conf.Topic == "" {
+			return nil, errors.New("no Kafka REST Proxy Endpoint or Topic defined")
+		}
+		url := strings.TrimSuffix(conf.Endpoint.String(), "/") + "/topics/" + conf.Topic
+		return &kafkaRESTSink{client: &http.Client{Timeout: 10 * time.Second}, url: url}, nil
+	}
+	return nil, fmt.Errorf("unsupported usage sink %q", conf.Sink)
+}
+
+// fileSink appends records to file as JSON lines
+type fileSink struct {
+	path string
+}
+
+func (fs *fileSink) write(records []Record) error {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// statsdSink sends records as counters named
+// <prefix><tenant>.<class>.<requests|ingress|egress>
+type statsdSink struct {
+	addr   string
+	prefix string
+}
+
+func (ss *statsdSink) write(records []Record) error {
+	conn, err := net.Dial("udp", ss.addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Debugf("Cannot close statsd connection: %s", closeErr)
+		}
+	}()
+	packet := &bytes.Buffer{}
+	for _, record := range records {
+		name := ss.prefix + metrics.Clean(record.Tenant) + "." + record.Class
+		for _, counter := range []struct {
+			suffix string
+			value  int64
+		}{{"requests", record.Requests}, {"ingress", record.Ingress}, {"egress", record.Egress}} {
+			line := fmt.Sprintf("%s.%s:%d|c\n", name, counter.suffix, counter.value)
+			if packet.Len()+len(line) > statsdPacketSize {
+				if _, err = conn.Write(packet.Bytes()); err != nil {
+					return err
+				}
+				packet.Reset()
+			}
+			packet.WriteString(line)
+		}
+	}
+	_, err = conn.Write(packet.Bytes())
+	return err
+}
+
+// kafkaRESTSink produces records keyed by tenant with Kafka REST Proxy v2 API
+type kafkaRESTSink struct {
+	client *http.Client
+	url    string
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Record `json:"value"`
+}
+
+func (ks *kafkaRESTSink) write(records []Record) error {
+	payload := struct {
+		Records []kafkaRecord `json:"records"`
+	}{make([]kafkaRecord, 0, len(records))}
+	for _, record := range records {
+		payload.Records = append(payload.Records, kafkaRecord{Key: record.Tenant, Value: record})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, ks.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to make request to Kafka REST Proxy - err: %s", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Cannot close Kafka REST Proxy response body: %q", closeErr)
+		}
+	}()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read Kafka REST Proxy response - err: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka REST Proxy request failed - StatusCode: %d, %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
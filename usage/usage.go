@@ -0,0 +1,259 @@
+package usage
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/usage/config"
+	"github.com/allegro/akubra/utils"
+)
+
+const (
+	defaultInterval = time.Minute
+	// anonymous is tenant of requests without access key
+	anonymous = "anonymous"
+)
+
+// Request classes
+const (
+	ReadClass   = "read"
+	ListClass   = "list"
+	WriteClass  = "write"
+	DeleteClass = "delete"
+	OtherClass  = "other"
+)
+
+// Record is usage of tenant in one class of requests between Start and End
+type Record struct {
+	Tenant   string    `json:"tenant"`
+	Class    string    `json:"class"`
+	Requests int64     `json:"requests"`
+	Ingress  int64     `json:"ingress"`
+	Egress   int64     `json:"egress"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+type recordKey struct {
+	tenant, class string
+}
+
+type counters struct {
+	requests, ingress, egress int64
+}
+
+// Accounting aggregates usage of tenants in memory and flushes it to sink
+// periodically, records which couldn't be flushed are kept for next flush
+type Accounting struct {
+	mx       sync.Mutex
+	usage    map[recordKey]*counters
+	since    time.Time
+	sink     sink
+	interval time.Duration
+	now      func() time.Time
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// New creates Accounting, it returns nil if no sink is configured
+func New(conf config.Usage) (*Accounting, error) {
+	if conf.Sink == "" {
+		return nil, nil
+	}
+	sink, err := newSink(conf)
+	if err != nil {
+		return nil, err
+	}
+	interval := conf.Interval.Duration
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	return &Accounting{usage: make(map[recordKey]*counters), since: time.Now(), sink: sink,
+		interval: interval, now: time.Now, stop: make(chan struct{})}, nil
+}
+
+// Start flushes usage every Interval until Stop is called
+func (a *Accounting) Start() {
+	a.stopped.Add(1)
+	go func() {
+		defer a.stopped.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Flush(); err != nil {
+					log.Printf("Usage flush failed: %s", err)
+				}
+			case <-a.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops periodic flushes and flushes usage accounted so far
+func (a *Accounting) Stop() error {
+	close(a.stop)
+	a.stopped.Wait()
+	return a.Flush()
+}
+
+// Flush writes usage accounted since previous flush to sink
+func (a *Accounting) Flush() error {
+	a.mx.Lock()
+	usage, since, now := a.usage, a.since, a.now()
+	a.usage, a.since = make(map[recordKey]*counters), now
+	a.mx.Unlock()
+	if len(usage) == 0 {
+		return nil
+	}
+	records := make([]Record, 0, len(usage))
+	for key, c := range usage {
+		records = append(records, Record{Tenant: key.tenant, Class: key.class, Requests: c.requests,
+			Ingress: c.ingress, Egress: c.egress, Start: since, End: now})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Tenant != records[j].Tenant {
+			return records[i].Tenant < records[j].Tenant
+		}
+		return records[i].Class < records[j].Class
+	})
+	if err := a.sink.write(records); err != nil {
+		metrics.Mark("usage.flush.failure")
+		a.restore(usage, since)
+		return err
+	}
+	metrics.Mark("usage.flush.success")
+	return nil
+}
+
+// restore merges usage which wasn't flushed with usage accounted meanwhile
+func (a *Accounting) restore(usage map[recordKey]*counters, since time.Time) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	for key, c := range usage {
+		a.addLocked(key, *c)
+	}
+	a.since = since
+}
+
+func (a *Accounting) add(key recordKey, c counters) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.addLocked(key, c)
+}
+
+func (a *Accounting) addLocked(key recordKey, c counters) {
+	current, ok := a.usage[key]
+	if !ok {
+		current = &counters{}
+		a.usage[key] = current
+	}
+	current.requests += c.requests
+	current.ingress += c.ingress
+	current.egress += c.egress
+}
+
+// requestClass groups requests by operation they're charged for
+func requestClass(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		if strings.Contains(strings.Trim(req.URL.Path, "/"), "/") {
+			return ReadClass
+		}
+		return ListClass
+	case http.MethodPost:
+		if _, multiDelete := req.URL.Query()["delete"]; multiDelete {
+			return DeleteClass
+		}
+		return WriteClass
+	case http.MethodPut:
+		return WriteClass
+	case http.MethodDelete:
+		return DeleteClass
+	}
+	return OtherClass
+}
+
+// countingReader counts bytes read from body
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+// Read implements io.Reader interface
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	atomic.AddInt64(&cr.read, int64(n))
+	return n, err
+}
+
+func (cr *countingReader) count() int64 {
+	return atomic.LoadInt64(&cr.read)
+}
+
+// accountingReader accounts bytes sent to client once body is closed
+type accountingReader struct {
+	countingReader
+	once    sync.Once
+	account func(egress int64)
+}
+
+// Close implements io.Closer interface
+func (ar *accountingReader) Close() error {
+	ar.once.Do(func() { ar.account(ar.count()) })
+	return ar.ReadCloser.Close()
+}
+
+type accountingRoundTripper struct {
+	roundTripper http.RoundTripper
+	accounting   *Accounting
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (art *accountingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tenant := utils.ExtractAccessKey(req)
+	if tenant == "" {
+		tenant = anonymous
+	}
+	key := recordKey{tenant: tenant, class: requestClass(req)}
+	var body *countingReader
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &countingReader{ReadCloser: req.Body}
+		countedReq := *req
+		countedReq.Body = body
+		req = &countedReq
+	}
+	resp, err := art.roundTripper.RoundTrip(req)
+	usage := counters{requests: 1}
+	if body != nil {
+		usage.ingress = body.count()
+	}
+	art.accounting.add(key, usage)
+	if resp != nil && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &accountingReader{countingReader: countingReader{ReadCloser: resp.Body}, account: func(egress int64) {
+			art.accounting.add(key, counters{egress: egress})
+		}}
+	}
+	return resp, err
+}
+
+// Decorator creates httphandler.Decorator accounting requests and
+// transferred bytes of each access key
+func Decorator(accounting *Accounting) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if accounting == nil {
+			return roundTripper
+		}
+		return &accountingRoundTripper{roundTripper: roundTripper, accounting: accounting}
+	}
+}
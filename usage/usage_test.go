@@ -0,0 +1,184 @@
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/usage/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sinkStub struct {
+	records []Record
+	err     error
+}
+
+func (ss *sinkStub) write(records []Record) error {
+	if ss.err != nil {
+		return ss.err
+	}
+	ss.records = append(ss.records, records...)
+	return nil
+}
+
+type roundTripperStub struct{}
+
+func (rts *roundTripperStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		if _, err := ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Request: req, Body: ioutil.NopCloser(strings.NewReader("content"))}, nil
+}
+
+func newAccounting(sink sink) *Accounting {
+	return &Accounting{usage: make(map[recordKey]*counters), since: time.Now(), sink: sink,
+		interval: time.Minute, now: time.Now, stop: make(chan struct{})}
+}
+
+func roundTrip(t *testing.T, rt http.RoundTripper, method, path, accessKey, body string) {
+	req := httptest.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+	if accessKey != "" {
+		req.Header.Set("Authorization", "AWS "+accessKey+":signature")
+	}
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
+
+func TestShouldAccountRequestsAndBytesPerTenantAndClass(t *testing.T) {
+	sink := &sinkStub{}
+	accounting := newAccounting(sink)
+	rt := Decorator(accounting)(&roundTripperStub{})
+
+	roundTrip(t, rt, http.MethodPut, "/bucket/key", "tenant", "0123456789")
+	roundTrip(t, rt, http.MethodPut, "/bucket/other", "tenant", "01234")
+	roundTrip(t, rt, http.MethodGet, "/bucket/key", "tenant", "")
+	roundTrip(t, rt, http.MethodGet, "/bucket", "", "")
+	require.NoError(t, accounting.Flush())
+
+	require.Len(t, sink.records, 3)
+	assert.Equal(t, Record{Tenant: anonymous, Class: ListClass, Requests: 1, Egress: 7},
+		withoutPeriod(sink.records[0]))
+	assert.Equal(t, Record{Tenant: "tenant", Class: ReadClass, Requests: 1, Egress: 7},
+		withoutPeriod(sink.records[1]))
+	assert.Equal(t, Record{Tenant: "tenant", Class: WriteClass, Requests: 2, Ingress: 15, Egress: 14},
+		withoutPeriod(sink.records[2]))
+
+	require.NoError(t, accounting.Flush())
+	assert.Len(t, sink.records, 3, "flushed usage should not be written again")
+}
+
+func withoutPeriod(record Record) Record {
+	record.Start, record.End = time.Time{}, time.Time{}
+	return record
+}
+
+func TestUsageShouldBeKeptUntilFlushSucceeds(t *testing.T) {
+	sink := &sinkStub{err: errors.New("unavailable")}
+	accounting := newAccounting(sink)
+	rt := Decorator(accounting)(&roundTripperStub{})
+	roundTrip(t, rt, http.MethodDelete, "/bucket/key", "tenant", "")
+	start := accounting.since
+
+	assert.Error(t, accounting.Flush())
+	roundTrip(t, rt, http.MethodPost, "/bucket?delete", "tenant", "")
+	sink.err = nil
+	require.NoError(t, accounting.Flush())
+
+	require.Len(t, sink.records, 1)
+	assert.Equal(t, int64(2), sink.records[0].Requests)
+	assert.Equal(t, DeleteClass, sink.records[0].Class)
+	assert.Equal(t, start, sink.records[0].Start)
+}
+
+func TestDecoratorShouldNotWrapWithoutSink(t *testing.T) {
+	accounting, err := New(config.Usage{})
+	require.NoError(t, err)
+	stub := &roundTripperStub{}
+
+	assert.Equal(t, stub, Decorator(accounting)(stub))
+}
+
+func TestFileSinkShouldAppendJSONLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-usage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sink, err := newSink(config.Usage{Sink: config.File, Path: filepath.Join(dir, "usage.log")})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.write([]Record{{Tenant: "first", Class: ReadClass, Requests: 1}}))
+	require.NoError(t, sink.write([]Record{{Tenant: "second", Class: WriteClass, Requests: 2}}))
+
+	file, err := os.Open(filepath.Join(dir, "usage.log"))
+	require.NoError(t, err)
+	defer file.Close()
+	tenants := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := Record{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		tenants = append(tenants, record.Tenant)
+	}
+	assert.Equal(t, []string{"first", "second"}, tenants)
+}
+
+func TestStatsdSinkShouldSendCounters(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	sink, err := newSink(config.Usage{Sink: config.Statsd, Addr: conn.LocalAddr().String(), Prefix: "akubra.usage"})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.write([]Record{{Tenant: "access.key", Class: WriteClass, Requests: 2, Ingress: 10}}))
+
+	packet := make([]byte, statsdPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(packet)
+	require.NoError(t, err)
+	assert.Equal(t, "akubra.usage.access_key.write.requests:2|c\n"+
+		"akubra.usage.access_key.write.ingress:10|c\n"+
+		"akubra.usage.access_key.write.egress:0|c\n", string(packet[:n]))
+}
+
+func TestKafkaRESTSinkShouldProduceRecordsKeyedByTenant(t *testing.T) {
+	var produced []byte
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/topics/usage", r.URL.Path)
+		require.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		produced, _ = ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 1}]}`))
+	}))
+	defer proxy.Close()
+	endpoint, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	sink, err := newSink(config.Usage{Sink: config.KafkaREST, Endpoint: types.YAMLUrl{URL: endpoint}, Topic: "usage"})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.write([]Record{{Tenant: "tenant", Class: ReadClass, Requests: 1}}))
+
+	payload := struct {
+		Records []kafkaRecord `json:"records"`
+	}{}
+	require.NoError(t, json.NewDecoder(bytes.NewReader(produced)).Decode(&payload))
+	require.Len(t, payload.Records, 1)
+	assert.Equal(t, "tenant", payload.Records[0].Key)
+	assert.Equal(t, int64(1), payload.Records[0].Value.Requests)
+}
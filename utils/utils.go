@@ -2,6 +2,7 @@ package utils
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/allegro/akubra/log"
 	auth2 "github.com/allegro/akubra/storages/auth"
@@ -41,3 +42,14 @@ func ExtractAccessKey(req *http.Request) string {
 	}
 	return parsedAuthHeader.AccessKey
 }
+
+// SplitBucketKey splits path of path style request into bucket and object key,
+// virtual hosted style requests are already rewritten by
+// httphandler.VirtualHostedStyle
+func SplitBucketKey(path string) (bucket, key string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBucketKey(t *testing.T) {
+	for path, expected := range map[string][2]string{
+		"":                {"", ""},
+		"/":               {"", ""},
+		"/bucket":         {"bucket", ""},
+		"/bucket/":        {"bucket", ""},
+		"/bucket/key":     {"bucket", "key"},
+		"/bucket/dir/key": {"bucket", "dir/key"},
+		"bucket/dir/key/": {"bucket", "dir/key/"},
+		"/bucket//key":    {"bucket", "/key"},
+	} {
+		bucket, key := SplitBucketKey(path)
+		assert.Equal(t, expected, [2]string{bucket, key}, path)
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// Watchdog configuration, resources are not sampled if Interval is not defined
+type Watchdog struct {
+	// Interval between samples
+	Interval metrics.Interval `yaml:"Interval"`
+	// MaxGoroutines raises alarm when exceeded, 0 disables alarm
+	MaxGoroutines int64 `yaml:"MaxGoroutines"`
+	// MaxConnections to backends raises alarm when exceeded, 0 disables alarm
+	MaxConnections int64 `yaml:"MaxConnections"`
+	// MaxSpoolFiles raises alarm when exceeded, 0 disables alarm
+	MaxSpoolFiles int64 `yaml:"MaxSpoolFiles"`
+	// MaxOpenFiles (all descriptors of process) raises alarm when exceeded,
+	// 0 disables alarm
+	MaxOpenFiles int64 `yaml:"MaxOpenFiles"`
+	// DumpPath is directory goroutine dumps are written to on alarm, dumps
+	// are disabled if empty
+	DumpPath string `yaml:"DumpPath"`
+	// DumpInterval is minimal time between dumps, default: 10m
+	DumpInterval metrics.Interval `yaml:"DumpInterval"`
+}
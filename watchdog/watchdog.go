@@ -0,0 +1,140 @@
+package watchdog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/watchdog/config"
+)
+
+const defaultDumpInterval = 10 * time.Minute
+
+// Resources sampled besides goroutines and open files of process
+type Resources struct {
+	// Connections returns number of open backend connections
+	Connections func() int64
+	// SpoolFiles returns number of temporary files of spooled bodies
+	SpoolFiles func() int64
+}
+
+// probe samples one resource, negative sample means it's not available
+type probe struct {
+	name   string
+	sample func() int64
+	limit  int64
+}
+
+// Watchdog samples resources which leak silently, exports them as gauges and
+// writes goroutine dump once any of them exceeds its limit
+type Watchdog struct {
+	probes       []probe
+	interval     time.Duration
+	dumpPath     string
+	dumpInterval time.Duration
+	lastDump     time.Time
+	now          func() time.Time
+}
+
+// New creates Watchdog
+func New(conf config.Watchdog, resources Resources) *Watchdog {
+	dumpInterval := conf.DumpInterval.Duration
+	if dumpInterval <= 0 {
+		dumpInterval = defaultDumpInterval
+	}
+	probes := []probe{
+		{name: "goroutines", sample: func() int64 { return int64(runtime.NumGoroutine()) }, limit: conf.MaxGoroutines},
+		{name: "open_files", sample: openFiles, limit: conf.MaxOpenFiles},
+	}
+	if resources.Connections != nil {
+		probes = append(probes, probe{name: "connections", sample: resources.Connections, limit: conf.MaxConnections})
+	}
+	if resources.SpoolFiles != nil {
+		probes = append(probes, probe{name: "spool_files", sample: resources.SpoolFiles, limit: conf.MaxSpoolFiles})
+	}
+	return &Watchdog{probes: probes, interval: conf.Interval.Duration, dumpPath: conf.DumpPath,
+		dumpInterval: dumpInterval, now: time.Now}
+}
+
+// Start samples resources every Interval
+func (w *Watchdog) Start() {
+	go func() {
+		for range time.Tick(w.interval) {
+			w.Check()
+		}
+	}()
+}
+
+// Check samples resources and returns names of ones over their limits
+func (w *Watchdog) Check() []string {
+	samples := make([]string, 0, len(w.probes))
+	alarms := make([]string, 0)
+	for _, p := range w.probes {
+		value := p.sample()
+		if value < 0 {
+			continue
+		}
+		metrics.UpdateGauge("watchdog."+p.name, value)
+		samples = append(samples, fmt.Sprintf("%s=%d", p.name, value))
+		if p.limit > 0 && value > p.limit {
+			metrics.Mark("watchdog.alarm." + p.name)
+			alarms = append(alarms, p.name)
+		}
+	}
+	summary := strings.Join(samples, " ")
+	if len(alarms) == 0 {
+		log.Debugf("Watchdog: %s", summary)
+		return alarms
+	}
+	log.Printf("Watchdog alarm, %s over limit: %s", strings.Join(alarms, ", "), summary)
+	w.dump(summary)
+	return alarms
+}
+
+// dump writes goroutines stacks, at most once per DumpInterval
+func (w *Watchdog) dump(summary string) {
+	now := w.now()
+	if w.dumpPath == "" || (!w.lastDump.IsZero() && now.Sub(w.lastDump) < w.dumpInterval) {
+		return
+	}
+	w.lastDump = now
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s\n\n", summary)
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 2); err != nil {
+		log.Printf("Watchdog cannot dump goroutines: %s", err)
+		return
+	}
+	name := filepath.Join(w.dumpPath, fmt.Sprintf("akubra-watchdog-%s.txt", now.UTC().Format("20060102T150405Z")))
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		log.Printf("Watchdog cannot write dump: %s", err)
+		return
+	}
+	log.Printf("Watchdog dump written to %s", name)
+}
+
+// openFiles counts descriptors of process, it's available on linux only
+func openFiles() int64 {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	defer func() {
+		if closeErr := dir.Close(); closeErr != nil {
+			log.Debugf("Cannot close /proc/self/fd: %s", closeErr)
+		}
+	}()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return -1
+	}
+	// descriptor of listed directory is not counted
+	return int64(len(names)) - 1
+}
@@ -0,0 +1,54 @@
+package watchdog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/watchdog/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchdogShouldNotRaiseAlarmUnderLimits(t *testing.T) {
+	watchdog := New(config.Watchdog{MaxConnections: 10, MaxSpoolFiles: 10}, Resources{
+		Connections: func() int64 { return 10 },
+		SpoolFiles:  func() int64 { return 0 },
+	})
+
+	assert.Empty(t, watchdog.Check())
+}
+
+func TestWatchdogShouldDumpGoroutinesOnAlarmAtMostOncePerInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akubra-watchdog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	watchdog := New(config.Watchdog{
+		MaxConnections: 10,
+		MaxGoroutines:  1,
+		DumpPath:       dir,
+		DumpInterval:   metrics.Interval{Duration: time.Minute},
+	}, Resources{Connections: func() int64 { return 11 }})
+	watchdog.now = func() time.Time { return now }
+
+	alarms := watchdog.Check()
+	now = now.Add(30 * time.Second)
+	watchdog.Check()
+	now = now.Add(time.Minute)
+	watchdog.Check()
+
+	assert.Equal(t, []string{"goroutines", "connections"}, alarms)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "akubra-watchdog-20180102T030405Z.txt", files[0].Name())
+	dump, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.True(t, strings.Contains(string(dump), "connections=11"))
+	assert.True(t, strings.Contains(string(dump), "TestWatchdogShouldDumpGoroutinesOnAlarmAtMostOncePerInterval"))
+}
@@ -0,0 +1,17 @@
+package config
+
+import "github.com/allegro/akubra/metrics"
+
+// WORM configuration, objects of buckets not listed are mutable
+type WORM struct {
+	// Buckets maps bucket name to its immutability rule
+	Buckets map[string]Rule `yaml:"Buckets"`
+}
+
+// Rule of bucket immutability
+type Rule struct {
+	// NoOverwrite rejects writes to existing keys
+	NoOverwrite bool `yaml:"NoOverwrite"`
+	// Retention rejects overwrites and deletes of objects younger than it
+	Retention metrics.Interval `yaml:"Retention"`
+}
@@ -0,0 +1,173 @@
+package worm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/allegro/akubra/audit"
+	"github.com/allegro/akubra/httphandler"
+	"github.com/allegro/akubra/log"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/utils"
+	"github.com/allegro/akubra/worm/config"
+)
+
+// headHeaders are copied from checked request to HEAD request reading
+// object state, so storages resign it with backend keys of the same client.
+// Client signature doesn't cover the HEAD request, it's verified at the edge
+var headHeaders = []string{"Authorization", "X-Amz-Security-Token", "User-Agent"}
+
+type wormRoundTripper struct {
+	roundTripper http.RoundTripper
+	buckets      map[string]config.Rule
+	auditLog     *audit.Log
+	now          func() time.Time
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (wrt *wormRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket, key := utils.SplitBucketKey(req.URL.Path)
+	rule, ok := wrt.buckets[bucket]
+	if !ok {
+		return wrt.roundTripper.RoundTrip(req)
+	}
+	if key == "" {
+		if req.Method == http.MethodPost && isMultiObjectDelete(req) && rule.Retention.Duration > 0 {
+			return wrt.violation(req, "Multi-Object Delete is not allowed in bucket with retention")
+		}
+		return wrt.roundTripper.RoundTrip(req)
+	}
+	overwrite := isObjectWrite(req)
+	if !overwrite && !isObjectDelete(req) {
+		return wrt.roundTripper.RoundTrip(req)
+	}
+	if !overwrite && rule.Retention.Duration <= 0 {
+		return wrt.roundTripper.RoundTrip(req)
+	}
+	if _, verified := types.AuthenticatedAccessKey(req.Context()); !verified {
+		return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied,
+			"Writes to WORM buckets require verified signature."), nil
+	}
+	// State check and write aren't atomic, concurrent writes of missing key
+	// may all pass NoOverwrite rule
+	exists, lastModified, err := wrt.objectState(req)
+	if err != nil {
+		metrics.Mark("worm.unverified")
+		log.Printf("Object lock of request %s not verified: %s", utils.RequestID(req), err)
+		return types.NewS3ErrorResponse(req, http.StatusServiceUnavailable, types.S3ErrServiceUnavailable,
+			"Object lock could not be verified, please retry later."), nil
+	}
+	if !exists {
+		return wrt.roundTripper.RoundTrip(req)
+	}
+	if overwrite && rule.NoOverwrite {
+		return wrt.violation(req, "Object exists and bucket doesn't allow overwrites")
+	}
+	if retainUntil := lastModified.Add(rule.Retention.Duration); wrt.now().Before(retainUntil) {
+		return wrt.violation(req, fmt.Sprintf("Object is retained until %s", retainUntil.UTC().Format(time.RFC3339)))
+	}
+	return wrt.roundTripper.RoundTrip(req)
+}
+
+// objectState reads if object exists and when it was modified last
+func (wrt *wormRoundTripper) objectState(req *http.Request) (bool, time.Time, error) {
+	headReq, err := http.NewRequest(http.MethodHead, req.URL.String(), nil)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	headReq = headReq.WithContext(req.Context())
+	headReq.Host = req.Host
+	headReq.URL.RawQuery = ""
+	if versionID := req.URL.Query().Get("versionId"); versionID != "" {
+		headReq.URL.RawQuery = "versionId=" + versionID
+	}
+	for _, header := range headHeaders {
+		if value := req.Header.Get(header); value != "" {
+			headReq.Header.Set(header, value)
+		}
+	}
+	resp, err := wrt.roundTripper.RoundTrip(headReq)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	discardBody(resp)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return false, time.Time{}, nil
+	case http.StatusOK:
+		lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+		if err != nil {
+			return true, time.Time{}, fmt.Errorf("invalid Last-Modified header: %s", err)
+		}
+		return true, lastModified, nil
+	}
+	return false, time.Time{}, fmt.Errorf("object state responded with status %d", resp.StatusCode)
+}
+
+// violation rejects request with 403 AccessDenied and writes it to audit log
+func (wrt *wormRoundTripper) violation(req *http.Request, reason string) (*http.Response, error) {
+	metrics.Mark("worm.violations")
+	reqID := utils.RequestID(req)
+	log.Printf("Request %s %s %s rejected by WORM rule: %s", reqID, req.Method, req.URL.Path, reason)
+	record := audit.NewRecord(req, reqID, utils.ExtractAccessKey(req))
+	record.Results = []audit.BackendResult{}
+	record.Violation = reason
+	wrt.auditLog.Write(record)
+	return types.NewS3ErrorResponse(req, http.StatusForbidden, types.S3ErrAccessDenied, reason), nil
+}
+
+// isObjectWrite reports if request creates object, parts of multipart
+// uploads are checked when upload is initiated and completed
+func isObjectWrite(req *http.Request) bool {
+	query := req.URL.Query()
+	_, initiates := query["uploads"]
+	_, hasUploadID := query["uploadId"]
+	switch req.Method {
+	case http.MethodPut:
+		return !hasUploadID && len(query) == 0
+	case http.MethodPost:
+		return initiates || (hasUploadID && query.Get("partNumber") == "")
+	}
+	return false
+}
+
+// isObjectDelete reports if request deletes object or its version, aborts
+// of multipart uploads don't remove data
+func isObjectDelete(req *http.Request) bool {
+	if req.Method != http.MethodDelete {
+		return false
+	}
+	_, hasUploadID := req.URL.Query()["uploadId"]
+	return !hasUploadID
+}
+
+func isMultiObjectDelete(req *http.Request) bool {
+	_, deletes := req.URL.Query()["delete"]
+	return deletes
+}
+
+func discardBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if err := resp.Body.Close(); err != nil {
+		log.Debugf("Cannot close object state response body: %s", err)
+	}
+}
+
+// Decorator creates httphandler.Decorator rejecting overwrites and deletes
+// of objects locked by bucket rules with 403 AccessDenied, violations are
+// written to auditLog
+func Decorator(conf config.WORM, auditLog *audit.Log) httphandler.Decorator {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		if len(conf.Buckets) == 0 {
+			return roundTripper
+		}
+		return &wormRoundTripper{roundTripper: roundTripper, buckets: conf.Buckets, auditLog: auditLog, now: time.Now}
+	}
+}
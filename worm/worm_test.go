@@ -0,0 +1,210 @@
+package worm
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/akubra/audit"
+	auditconfig "github.com/allegro/akubra/audit/config"
+	"github.com/allegro/akubra/crdstore"
+	crdstoreconfig "github.com/allegro/akubra/crdstore/config"
+	"github.com/allegro/akubra/metrics"
+	"github.com/allegro/akubra/storages/auth"
+	"github.com/allegro/akubra/types"
+	"github.com/allegro/akubra/worm/config"
+	"github.com/bnogas/minio-go/pkg/s3signer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)
+
+// storageStub keeps last modification times of existing objects
+type storageStub struct {
+	objects map[string]time.Time
+	headErr error
+	methods []string
+}
+
+func (ss *storageStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	ss.methods = append(ss.methods, req.Method)
+	if req.Method != http.MethodHead {
+		return &http.Response{StatusCode: http.StatusOK, Request: req}, nil
+	}
+	if ss.headErr != nil {
+		return nil, ss.headErr
+	}
+	lastModified, ok := ss.objects[req.URL.Path]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Request: req}, nil
+	}
+	header := make(http.Header)
+	header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Request: req}, nil
+}
+
+func newWORMRoundTripper(stub *storageStub, auditLog *audit.Log) http.RoundTripper {
+	conf := config.WORM{Buckets: map[string]config.Rule{
+		"immutable": {NoOverwrite: true},
+		"retained":  {Retention: metrics.Interval{Duration: 24 * time.Hour}},
+	}}
+	roundTripper := Decorator(conf, auditLog)(stub)
+	roundTripper.(*wormRoundTripper).now = func() time.Time { return now }
+	return roundTripper
+}
+
+// verifiedRequest returns request of client verified by edge authentication
+func verifiedRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, "http://localhost"+target, nil)
+	return req.WithContext(types.WithAuthenticatedAccessKey(req.Context(), "client"))
+}
+
+func TestShouldRejectOverwritesOfExistingObjects(t *testing.T) {
+	stub := &storageStub{objects: map[string]time.Time{"/immutable/existing": now.Add(-48 * time.Hour)}}
+	roundTripper := newWORMRoundTripper(stub, nil)
+
+	statuses := make([]int, 0)
+	for _, target := range []string{"/immutable/existing", "/immutable/new", "/immutable/existing?uploads",
+		"/immutable/existing?uploadId=1&partNumber=1", "/immutable/existing?acl", "/mutable/existing"} {
+		method := http.MethodPut
+		if target == "/immutable/existing?uploads" {
+			method = http.MethodPost
+		}
+		resp, err := roundTripper.RoundTrip(verifiedRequest(method, target))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{403, 200, 403, 200, 200, 200}, statuses)
+
+	resp, err := roundTripper.RoundTrip(verifiedRequest(http.MethodDelete, "/immutable/existing"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestShouldRejectDeletesAndOverwritesBeforeRetentionPeriod(t *testing.T) {
+	stub := &storageStub{objects: map[string]time.Time{
+		"/retained/young": now.Add(-time.Hour),
+		"/retained/old":   now.Add(-25 * time.Hour),
+	}}
+	roundTripper := newWORMRoundTripper(stub, nil)
+
+	statuses := make([]int, 0)
+	for _, request := range []struct{ method, target string }{
+		{http.MethodDelete, "/retained/young"},
+		{http.MethodPut, "/retained/young"},
+		{http.MethodDelete, "/retained/young?uploadId=1"},
+		{http.MethodDelete, "/retained/old"},
+		{http.MethodPut, "/retained/old"},
+		{http.MethodDelete, "/retained/missing"},
+		{http.MethodPost, "/retained?delete"},
+	} {
+		resp, err := roundTripper.RoundTrip(verifiedRequest(request.method, request.target))
+		require.NoError(t, err)
+		statuses = append(statuses, resp.StatusCode)
+	}
+
+	assert.Equal(t, []int{403, 403, 200, 200, 200, 200, 403}, statuses)
+}
+
+func TestShouldRejectMutationsIfObjectStateIsUnknown(t *testing.T) {
+	stub := &storageStub{headErr: errors.New("timeout")}
+	roundTripper := newWORMRoundTripper(stub, nil)
+
+	resp, err := roundTripper.RoundTrip(verifiedRequest(http.MethodPut, "/immutable/key"))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, []string{http.MethodHead}, stub.methods)
+}
+
+func TestViolationsShouldBeWrittenToAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "worm")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "audit.log")
+	auditLog, err := audit.New(auditconfig.Audit{Path: path})
+	require.NoError(t, err)
+	stub := &storageStub{objects: map[string]time.Time{"/retained/key": now.Add(-time.Hour)}}
+	roundTripper := newWORMRoundTripper(stub, auditLog)
+
+	resp, err := roundTripper.RoundTrip(verifiedRequest(http.MethodDelete, "/retained/key"))
+	require.NoError(t, err)
+	require.NoError(t, auditLog.Close())
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"method":"DELETE","bucket":"retained","key":"key"`)
+	assert.Contains(t, string(content), `"results":[],"violation":"Object is retained until 2018-01-11T11:00:00Z"`)
+}
+
+func TestShouldRejectUnverifiedWrites(t *testing.T) {
+	stub := &storageStub{}
+	roundTripper := newWORMRoundTripper(stub, nil)
+
+	resp, err := roundTripper.RoundTrip(httptest.NewRequest(http.MethodPut, "http://localhost/immutable/key", nil))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, stub.methods)
+}
+
+const testCredentials = `
+client:
+  akubra:
+    AccessKey: client
+    SecretKey: client-secret
+  backend:
+    AccessKey: backend
+    SecretKey: backend-secret
+`
+
+func TestObjectStateShouldBeResignedByAuthService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "worm")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	file := filepath.Join(dir, "credentials.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(testCredentials), 0600))
+	stores, err := crdstore.NewStores(crdstoreconfig.CredentialsStoreMap{
+		"auth": crdstoreconfig.CredentialsStore{Type: crdstoreconfig.FileStore, File: file},
+	})
+	require.NoError(t, err)
+	defer stores.Close()
+	store, err := stores.Get("auth")
+	require.NoError(t, err)
+	stub := &storageStub{objects: map[string]time.Time{"/immutable/existing": now}}
+	signed := make([]*http.Request, 0)
+	storage := auth.SignAuthServiceDecorator("backend", "backend:9000", store)(roundTripperFunc(
+		func(req *http.Request) (*http.Response, error) {
+			signed = append(signed, req)
+			return stub.RoundTrip(req)
+		}))
+	roundTripper := Decorator(config.WORM{Buckets: map[string]config.Rule{"immutable": {NoOverwrite: true}}}, nil)(storage)
+	req := s3signer.SignV4(*httptest.NewRequest(http.MethodPut, "http://localhost/immutable/existing", nil),
+		"client", "client-secret", "", "us-east-1")
+
+	resp, err := roundTripper.RoundTrip(req.WithContext(types.WithAuthenticatedAccessKey(req.Context(), "client")))
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Len(t, signed, 1)
+	assert.Equal(t, http.MethodHead, signed[0].Method)
+	assert.Contains(t, signed[0].Header.Get("Authorization"), "Credential=backend/")
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}